@@ -0,0 +1,522 @@
+// Package api contains the request and response types of the agent HTTP API.
+// The package is shared with the operator so both sides use the same schema.
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload task statuses
+const (
+	StatusInProgress = "IN_PROGRESS"
+	StatusCanceled   = "CANCELED"
+	StatusFailure    = "FAILURE"
+	StatusPartial    = "PARTIAL"
+	StatusSuccess    = "SUCCESS"
+	// StatusSizeExceeded is a failed upload of a backup larger than the maximum backup size
+	StatusSizeExceeded = "SIZE_EXCEEDED"
+	// StatusSkipped is a scheduled backup that started too late for its missed-run policy
+	StatusSkipped = "SKIPPED"
+)
+
+// Missed-run policies of scheduled backups, like for a CronJob a run is missed if the backup starts
+// later than it was scheduled, e.g. because the sidecar was down during node maintenance
+const (
+	// MissedRunSkip only runs backups that start on time, missed runs are not caught up
+	MissedRunSkip = "SKIP"
+	// MissedRunRun runs missed backups as soon as they are triggered
+	MissedRunRun = "RUN"
+	// MissedRunDeadline runs missed backups that start at most StartingDeadlineSeconds late
+	MissedRunDeadline = "DEADLINE"
+)
+
+// Task priorities, restore-critical work should use PriorityHigh and background work PriorityLow
+const (
+	PriorityHigh   = "HIGH"
+	PriorityNormal = "NORMAL"
+	PriorityLow    = "LOW"
+)
+
+// Canned ACLs of uploaded objects, the bucket owner needs access when it is another account than the writer
+const (
+	ACLPrivate                = "private"
+	ACLBucketOwnerRead        = "bucket-owner-read"
+	ACLBucketOwnerFullControl = "bucket-owner-full-control"
+)
+
+// QueueLengthHeader holds the number of waiting tasks on upload responses of a saturated agent,
+// together with a Retry-After header
+const QueueLengthHeader = "X-Agent-Queue-Length"
+
+// Validator is implemented by requests that can check their own fields. The fields carry validate
+// tags for the rules of a single field, Validate checks them and the rules across fields.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned when a request field has an invalid value
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid field %q: %s", e.Field, e.Reason)
+}
+
+// Req is a backup Service backup method request
+type Req struct {
+	BackupBaseDir string `json:"backup_base_dir" validate:"required"`
+	MemberID      int    `json:"member_id" validate:"min=0"`
+}
+
+func (r *Req) Validate() error {
+	return validateFields(r)
+}
+
+// Resp is a backup Service backup method response, Continue is set if more backups are available
+type Resp struct {
+	Backups  []string `json:"backups"`
+	Continue string   `json:"continue,omitempty"`
+}
+
+// UploadReq is a backup Service upload method request
+type UploadReq struct {
+	BucketURL       string `json:"bucket_url" validate:"required,url"`
+	BackupBaseDir   string `json:"backup_base_dir" validate:"required"`
+	HazelcastCRName string `json:"hz_cr_name" validate:"required"`
+	SecretName      string `json:"secret_name"`
+	MemberID        int    `json:"member_id" validate:"min=0"`
+	TimeBoxSeconds  int    `json:"time_box_seconds,omitempty" validate:"min=0"`
+	Priority        string `json:"priority,omitempty" validate:"oneof=HIGH NORMAL LOW"`
+	// FallbackBucketURLs are tried in order when the upload to BucketURL fails
+	FallbackBucketURLs []string `json:"fallback_bucket_urls,omitempty" validate:"url"`
+	// ACL is the canned ACL of the uploaded objects, empty uses the default of the sidecar
+	ACL string `json:"acl,omitempty" validate:"oneof=private bucket-owner-read bucket-owner-full-control"`
+	// MirrorBucketURLs get a copy of every completed backup, e.g. the old bucket while migrating to BucketURL
+	MirrorBucketURLs []string `json:"mirror_bucket_urls,omitempty" validate:"url"`
+	// MirrorUntil ends the grace period of the migration, the mirrors are written until then, always if nil
+	MirrorUntil *time.Time `json:"mirror_until,omitempty"`
+	// ClusterSize is the number of members taking the backup, it is recorded on the archive so that
+	// a restore detects dated folders that miss the archives of failed uploads, 0 records nothing
+	ClusterSize int `json:"cluster_size,omitempty" validate:"min=0"`
+	// ClusterName, HazelcastVersion and PartitionCount describe the cluster in the backup manifest,
+	// restores compare them with the cluster they restore into
+	ClusterName      string `json:"cluster_name,omitempty"`
+	HazelcastVersion string `json:"hazelcast_version,omitempty"`
+	PartitionCount   int    `json:"partition_count,omitempty" validate:"min=0"`
+	// EncryptionSecret names the secret whose encryption-key entry encrypts the archive with AES-256-GCM,
+	// empty uploads it unencrypted
+	EncryptionSecret string `json:"encryption_secret,omitempty"`
+	// Snapshot stores the backup as a directory of hard links to the previous snapshot of the member
+	// instead of an archive, only file buckets support it
+	Snapshot bool `json:"snapshot,omitempty"`
+	// ScheduledAt is the time a scheduled backup was due, a backup starting later is handled by
+	// MissedRunPolicy. Nil runs the backup whenever it starts.
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// MissedRunPolicy is SKIP, RUN or DEADLINE, empty uses the policy of the sidecar
+	MissedRunPolicy string `json:"missed_run_policy,omitempty" validate:"oneof=SKIP RUN DEADLINE"`
+	// StartingDeadlineSeconds is how late a backup of the DEADLINE policy may start
+	StartingDeadlineSeconds int `json:"starting_deadline_seconds,omitempty" validate:"min=0"`
+}
+
+// Manifest returns the backup manifest stored in the archive, nil if the request describes no cluster
+func (r *UploadReq) Manifest() *BackupManifest {
+	m := BackupManifest{ClusterName: r.ClusterName, HazelcastVersion: r.HazelcastVersion, MemberCount: r.ClusterSize, PartitionCount: r.PartitionCount}
+	if m == (BackupManifest{}) {
+		return nil
+	}
+	return &m
+}
+
+// BackupManifest describes the cluster that took a backup, it is stored as meta/manifest.json in
+// the archive. Empty fields are not known.
+type BackupManifest struct {
+	ClusterName      string `json:"cluster_name,omitempty"`
+	HazelcastVersion string `json:"hazelcast_version,omitempty"`
+	MemberCount      int    `json:"member_count,omitempty"`
+	PartitionCount   int    `json:"partition_count,omitempty"`
+	// Snapshot is recorded by the agent, the fields above are set by the operator
+	Snapshot *SnapshotInfo `json:"snapshot,omitempty"`
+}
+
+// SnapshotInfo records when the agent scanned the backup folder right before archiving it and the
+// modification times of its files. The newest modification time bounds the recovery point of the
+// backup: no write after it is in the archive.
+type SnapshotInfo struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	OldestModTime time.Time `json:"oldest_mod_time"`
+	NewestModTime time.Time `json:"newest_mod_time"`
+}
+
+// BucketURLs returns the primary bucket URL followed by the fallbacks
+func (r *UploadReq) BucketURLs() []string {
+	return append([]string{r.BucketURL}, r.FallbackBucketURLs...)
+}
+
+func (r *UploadReq) Validate() error {
+	if err := validateFields(r); err != nil {
+		return err
+	}
+	if r.Snapshot {
+		for _, b := range r.BucketURLs() {
+			if u, _ := url.Parse(b); u.Scheme != "file" {
+				return &ValidationError{"snapshot", "requires file buckets"}
+			}
+		}
+		if len(r.MirrorBucketURLs) > 0 || r.EncryptionSecret != "" || r.TimeBoxSeconds > 0 {
+			return &ValidationError{"snapshot", "cannot be mirrored, encrypted or time boxed"}
+		}
+	}
+	if r.MissedRunPolicy == MissedRunDeadline && r.StartingDeadlineSeconds == 0 {
+		return &ValidationError{"starting_deadline_seconds", "must be set for the " + MissedRunDeadline + " policy"}
+	}
+	return nil
+}
+
+// BatchUploadReq uploads the backups of several member directories as one task, e.g. of the whole
+// cluster. The fields of UploadReq apply to every item, the items set the directory, member and key
+// prefix of their backup and use the ones of the request if they leave them empty.
+type BatchUploadReq struct {
+	UploadReq
+	Items []BatchItem `json:"items" validate:"required"`
+}
+
+// BatchItem is a backup of a batch upload
+type BatchItem struct {
+	BackupBaseDir   string `json:"backup_base_dir,omitempty"`
+	HazelcastCRName string `json:"hz_cr_name,omitempty"`
+	MemberID        int    `json:"member_id"`
+}
+
+// Item returns the upload request of the i-th item
+func (r *BatchUploadReq) Item(i int) UploadReq {
+	req := r.UploadReq
+	item := r.Items[i]
+	if item.BackupBaseDir != "" {
+		req.BackupBaseDir = item.BackupBaseDir
+	}
+	if item.HazelcastCRName != "" {
+		req.HazelcastCRName = item.HazelcastCRName
+	}
+	req.MemberID = item.MemberID
+	return req
+}
+
+func (r *BatchUploadReq) Validate() error {
+	if err := validateFields(r); err != nil {
+		return err
+	}
+	if r.TimeBoxSeconds > 0 {
+		return &ValidationError{"time_box_seconds", "cannot be set for a batch"}
+	}
+	seen := make(map[Req]bool, len(r.Items))
+	for i := range r.Items {
+		req := r.Item(i)
+		if err := req.Validate(); err != nil {
+			var ve *ValidationError
+			if errors.As(err, &ve) {
+				return &ValidationError{fmt.Sprintf("items[%d].%s", i, ve.Field), ve.Reason}
+			}
+			return err
+		}
+		key := Req{BackupBaseDir: req.BackupBaseDir, MemberID: req.MemberID}
+		if seen[key] {
+			return &ValidationError{fmt.Sprintf("items[%d]", i), "duplicates the backup of another item"}
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// UploadResp ia a backup Service upload method response
+type UploadResp struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// StatusResp is a backup Service task status response
+type StatusResp struct {
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	BackupKey string `json:"backup_key,omitempty"`
+	// BucketURL is the bucket that was written to, it differs from the requested one after a failover
+	BucketURL string  `json:"bucket_url,omitempty"`
+	Caller    *Caller `json:"caller,omitempty"`
+	// Mirrors are the outcomes of the copies to the mirror buckets, a failed copy does not fail the task
+	Mirrors []MirrorStatus `json:"mirrors,omitempty"`
+	// LargestContributors are the largest folders of a backup that exceeded the maximum backup size
+	LargestContributors []SizeContributor `json:"largest_contributors,omitempty"`
+	// Pruned is the outcome of the retention policy applied after the backup, a failed pruning does not fail the task
+	Pruned *PruneResult `json:"pruned,omitempty"`
+	// LocalCleanup lists the local backups deleted after the upload was verified
+	LocalCleanup *LocalCleanup `json:"local_cleanup,omitempty"`
+	// ReusedBytes is the size of the objects of an incremental archive that were uploaded by earlier backups
+	ReusedBytes int64 `json:"reused_bytes,omitempty"`
+	// Batch is the progress of a batch upload and the status of its items
+	Batch *BatchStatus `json:"batch,omitempty"`
+}
+
+// BatchStatus is the aggregate progress of a batch upload, the items are in the order of the request
+type BatchStatus struct {
+	Total  int `json:"total"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	// UploadedBytes is the size of the archives written to the bucket so far
+	UploadedBytes int64             `json:"uploaded_bytes"`
+	Items         []BatchItemStatus `json:"items"`
+}
+
+// BatchItemStatus is the status of an item of a batch upload
+type BatchItemStatus struct {
+	BatchItem
+	StatusResp
+}
+
+// PruneResult is the outcome of the retention policy in the bucket
+type PruneResult struct {
+	DryRun bool `json:"dry_run,omitempty"`
+	// Folders are the dated backup folders that were deleted, or would have been in a dry run
+	Folders []string `json:"folders,omitempty"`
+	Objects int      `json:"objects"`
+	Bytes   int64    `json:"bytes"`
+	// SharedObjects are the objects of incremental archives that no archive references anymore, they are included in Objects
+	SharedObjects int `json:"shared_objects,omitempty"`
+	// Message is the error that stopped the pruning, the folders before it were deleted
+	Message string `json:"message,omitempty"`
+}
+
+// LocalCleanup is the outcome of deleting the local backups of a member
+type LocalCleanup struct {
+	// Deleted are the <sequence>/<uuid> paths of the deleted backups
+	Deleted []string `json:"deleted"`
+	Bytes   int64    `json:"bytes"`
+	// Message is the error that stopped the cleanup, the backups before it were deleted
+	Message string `json:"message,omitempty"`
+}
+
+// SizeContributor is a folder of a backup with the bytes of the files directly in it
+type SizeContributor struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// EstimateResp is the estimated upload of the latest local backup of a member, compared with the
+// backup uploaded last
+type EstimateResp struct {
+	// Backup is the <sequence>/<uuid> path of the latest local backup
+	Backup string `json:"backup"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	// ChangedFiles and ChangedBytes count the files that are new or differ in size or modification time
+	// from the last upload, all files if there was none
+	ChangedFiles int   `json:"changed_files"`
+	ChangedBytes int64 `json:"changed_bytes"`
+	RemovedFiles int   `json:"removed_files"`
+	// UploadBytes is the estimated size of the archive, based on the compression ratio of the last upload
+	UploadBytes int64 `json:"upload_bytes"`
+	// DurationSeconds is the estimated duration of the upload, 0 if no upload was measured yet
+	DurationSeconds float64 `json:"duration_seconds"`
+	// LastUpload is the time the last backup was uploaded, nil if there was none
+	LastUpload *time.Time `json:"last_upload,omitempty"`
+	LastKey    string     `json:"last_key,omitempty"`
+}
+
+// MirrorStatus is the outcome of the copy of a backup to a mirror bucket, Status is SUCCESS or FAILURE
+type MirrorStatus struct {
+	BucketURL string `json:"bucket_url"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Task types
+const (
+	TaskTypeUpload      = "UPLOAD"
+	TaskTypeBatchUpload = "BATCH_UPLOAD"
+)
+
+// TaskInfo is an entry of the task list
+type TaskInfo struct {
+	ID       uuid.UUID `json:"id"`
+	Type     string    `json:"type"`
+	Priority string    `json:"priority,omitempty"`
+	MemberID int       `json:"member_id"`
+	StatusResp
+}
+
+// TaskListResp is a page of the task list, Continue is passed as the continue parameter to fetch the next page
+type TaskListResp struct {
+	Tasks    []TaskInfo `json:"tasks"`
+	Continue string     `json:"continue,omitempty"`
+}
+
+// ScheduleStatus is the state of the backups the sidecar triggers on its own cron schedule
+type ScheduleStatus struct {
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone"`
+	// NextRun is the time the next backup is due, nil if the schedule never runs again
+	NextRun *time.Time `json:"next_run,omitempty"`
+	// LastRun is the time the last triggered backup was due and LastTaskID its task
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastTaskID *uuid.UUID `json:"last_task_id,omitempty"`
+	// LastStatus is the status of the last task, empty if it was deleted
+	LastStatus string `json:"last_status,omitempty"`
+	// Skipped counts the runs that were not triggered because the previous backup was still running,
+	// LastSkip is the reason of the latest one
+	Skipped  int    `json:"skipped"`
+	LastSkip string `json:"last_skip,omitempty"`
+}
+
+// RuntimeStats is the Go runtime state of the sidecar returned by its debug endpoint
+type RuntimeStats struct {
+	GoVersion     string  `json:"go_version"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Goroutines    int     `json:"goroutines"`
+	NumCPU        int     `json:"num_cpu"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	// HeapAlloc is the size of the live heap objects and Sys the memory obtained from the OS
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	Sys        uint64 `json:"sys_bytes"`
+	TotalAlloc uint64 `json:"total_alloc_bytes"`
+	NumGC      uint32 `json:"num_gc"`
+	// GCPause is the total stop-the-world pause of the garbage collector
+	GCPauseSeconds float64    `json:"gc_pause_total_seconds"`
+	LastGC         *time.Time `json:"last_gc,omitempty"`
+}
+
+// SchedulerIdentity is the caller identity of the backups triggered by the schedule of the sidecar
+const SchedulerIdentity = "scheduler"
+
+// Caller identifies who triggered a task, Identity is the subject of the verified client certificate
+type Caller struct {
+	Identity   string    `json:"identity,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Restore phases
+const (
+	RestorePhaseStarting    = "STARTING"
+	RestorePhaseDownloading = "DOWNLOADING"
+	RestorePhaseExtracting  = "EXTRACTING"
+	RestorePhaseSucceeded   = "SUCCEEDED"
+	RestorePhaseFailed      = "FAILED"
+	// RestorePhaseSkipped is reported if the member was restored before
+	RestorePhaseSkipped = "SKIPPED"
+)
+
+// RestoreReasonClusterSizeMismatch is the reason in the termination message of a restore that was
+// rejected because the backup has more or fewer member archives than the cluster has members
+const RestoreReasonClusterSizeMismatch = "CLUSTER_SIZE_MISMATCH"
+
+// RestoreReasonPartialBackup is the reason in the termination message of a restore that was
+// rejected because the dated backup folder misses the archives of some members
+const RestoreReasonPartialBackup = "PARTIAL_BACKUP"
+
+// RestoreReasonIncompatibleBackup is the reason in the termination message of a restore that was
+// rejected because the backup manifest does not match the cluster
+const RestoreReasonIncompatibleBackup = "INCOMPATIBLE_BACKUP"
+
+// RestoreReasonCorruptedFiles is the reason in the termination message of a restore that failed
+// because restored files do not match the file manifest of the backup
+const RestoreReasonCorruptedFiles = "CORRUPTED_FILES"
+
+// RestoreReasonDestinationNotWritable is the reason in the termination message of a restore that
+// failed because the Hazelcast container could not write the destination or the restored files
+const RestoreReasonDestinationNotWritable = "DESTINATION_NOT_WRITABLE"
+
+// RestoreReasonErrorBudgetExceeded is the reason in the termination message of a restore that
+// failed because more archive entries could not be restored than its error budget allows
+const RestoreReasonErrorBudgetExceeded = "ERROR_BUDGET_EXCEEDED"
+
+// RestoreReasonLayoutMigrationFailed is the reason in the termination message of a restore that
+// failed because the restored backup could not be migrated to the layout of the cluster version
+const RestoreReasonLayoutMigrationFailed = "LAYOUT_MIGRATION_FAILED"
+
+// FailedEntry is an archive entry that failed during a restore with an error budget
+type FailedEntry struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	// Recovered is set if the entry was restored by reading it again from the archive, only entries
+	// that were not recovered count against the budget
+	Recovered bool `json:"recovered"`
+}
+
+// RestoreStatus is the progress of a restore agent. Streamed archives are extracted while they are
+// downloaded, staged archives are extracted once the download is complete.
+type RestoreStatus struct {
+	Phase  string `json:"phase"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// BytesTotal is the size of the archive, 0 if it is not known
+	BytesTotal      int64 `json:"bytes_total,omitempty"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	// BytesExtracted is the size of the restored files written so far
+	BytesExtracted int64 `json:"bytes_extracted"`
+	// Retries counts the retried bucket operations and downloads
+	Retries   int64     `json:"retries"`
+	Errors    []string  `json:"errors,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// Checksum is the verified SHA-256 digest of the archive, empty until it is verified or if the archive has none
+	Checksum string `json:"checksum,omitempty"`
+	// FailedEntries are the entries that failed during a restore with an error budget
+	FailedEntries []FailedEntry `json:"failed_entries,omitempty"`
+}
+
+// RestoreResult is written to the result file of a restore agent when it exits, so that what happened
+// in an init container can be told after its logs are gone
+type RestoreResult struct {
+	// Status is SUCCESS or FAILURE
+	Status string `json:"status"`
+	// Phase is the last RestorePhase, SKIPPED if the member was restored before or has no archive
+	Phase     string `json:"phase"`
+	RestoreID string `json:"restore_id,omitempty"`
+	Hostname  string `json:"hostname"`
+	Bucket    string `json:"bucket,omitempty"`
+	// Key is the restored archive, or the folder of a local backup
+	Key      string `json:"key,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	// Bytes is the size of the hot-restart data in the destination
+	Bytes           int64     `json:"bytes"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	// Error is the last error logged by a failed restore, Reason is set for the failures the operator handles
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// FailedEntries are the entries that failed during a restore with an error budget
+	FailedEntries []FailedEntry `json:"failed_entries,omitempty"`
+}
+
+// DialRequest is a dial Service request
+type DialRequest struct {
+	Endpoints []string `json:"endpoints" validate:"required"`
+}
+
+func (r *DialRequest) Validate() error {
+	if err := validateFields(r); err != nil {
+		return err
+	}
+	for _, e := range r.Endpoints {
+		if _, _, err := net.SplitHostPort(e); err != nil {
+			return &ValidationError{"endpoints", fmt.Sprintf("%q is not a host:port pair", e)}
+		}
+	}
+	return nil
+}
+
+// DialResponse is a dial Service response
+type DialResponse struct {
+	Success       bool     `json:"success"`
+	ErrorMessages []string `json:"error_messages"`
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data", HazelcastCRName: "hz"}
+	withUpload := func(fn func(r *UploadReq)) *UploadReq {
+		r := valid
+		fn(&r)
+		return &r
+	}
+
+	tests := []struct {
+		name      string
+		req       Validator
+		wantField string
+	}{
+		{"valid upload", &valid, ""},
+		{"missing bucket", withUpload(func(r *UploadReq) { r.BucketURL = "" }), "bucket_url"},
+		{"relative bucket", withUpload(func(r *UploadReq) { r.BucketURL = "bucket/prefix" }), "bucket_url"},
+		{"fallback buckets", withUpload(func(r *UploadReq) { r.FallbackBucketURLs = []string{"gs://mirror"} }), ""},
+		{"relative fallback bucket", withUpload(func(r *UploadReq) { r.FallbackBucketURLs = []string{"mirror"} }), "fallback_bucket_urls"},
+		{"mirror buckets", withUpload(func(r *UploadReq) { r.MirrorBucketURLs = []string{"s3://old-bucket"} }), ""},
+		{"relative mirror bucket", withUpload(func(r *UploadReq) { r.MirrorBucketURLs = []string{"old-bucket"} }), "mirror_bucket_urls"},
+		{"missing base dir", withUpload(func(r *UploadReq) { r.BackupBaseDir = "" }), "backup_base_dir"},
+		{"missing cr name", withUpload(func(r *UploadReq) { r.HazelcastCRName = "" }), "hz_cr_name"},
+		{"negative member", withUpload(func(r *UploadReq) { r.MemberID = -1 }), "member_id"},
+		{"negative time box", withUpload(func(r *UploadReq) { r.TimeBoxSeconds = -1 }), "time_box_seconds"},
+		{"negative cluster size", withUpload(func(r *UploadReq) { r.ClusterSize = -1 }), "cluster_size"},
+		{"negative partition count", withUpload(func(r *UploadReq) { r.PartitionCount = -1 }), "partition_count"},
+		{"low priority", withUpload(func(r *UploadReq) { r.Priority = PriorityLow }), ""},
+		{"unknown priority", withUpload(func(r *UploadReq) { r.Priority = "urgent" }), "priority"},
+		{"deadline policy", withUpload(func(r *UploadReq) { r.MissedRunPolicy, r.StartingDeadlineSeconds = MissedRunDeadline, 600 }), ""},
+		{"deadline policy without deadline", withUpload(func(r *UploadReq) { r.MissedRunPolicy = MissedRunDeadline }), "starting_deadline_seconds"},
+		{"negative starting deadline", withUpload(func(r *UploadReq) { r.StartingDeadlineSeconds = -1 }), "starting_deadline_seconds"},
+		{"unknown missed-run policy", withUpload(func(r *UploadReq) { r.MissedRunPolicy = "later" }), "missed_run_policy"},
+		{"owner acl", withUpload(func(r *UploadReq) { r.ACL = ACLBucketOwnerFullControl }), ""},
+		{"unknown acl", withUpload(func(r *UploadReq) { r.ACL = "public-read" }), "acl"},
+		{"file snapshot", withUpload(func(r *UploadReq) { r.BucketURL, r.Snapshot = "file:///mnt/backups", true }), ""},
+		{"bucket snapshot", withUpload(func(r *UploadReq) { r.Snapshot = true }), "snapshot"},
+		{"encrypted snapshot", withUpload(func(r *UploadReq) {
+			r.BucketURL, r.Snapshot, r.EncryptionSecret = "file:///mnt/backups", true, "key"
+		}), "snapshot"},
+		{"valid batch", &BatchUploadReq{UploadReq: valid, Items: []BatchItem{{MemberID: 0}, {BackupBaseDir: "/data2"}}}, ""},
+		{"empty batch", &BatchUploadReq{UploadReq: valid}, "items"},
+		{"time-boxed batch", &BatchUploadReq{UploadReq: *withUpload(func(r *UploadReq) { r.TimeBoxSeconds = 60 }), Items: []BatchItem{{}}}, "time_box_seconds"},
+		{"invalid batch item", &BatchUploadReq{UploadReq: valid, Items: []BatchItem{{}, {MemberID: -1}}}, "items[1].member_id"},
+		{"duplicate batch item", &BatchUploadReq{UploadReq: valid, Items: []BatchItem{{MemberID: 1}, {BackupBaseDir: "/data", MemberID: 1}}}, "items[1]"},
+		{"valid list", &Req{BackupBaseDir: "/data"}, ""},
+		{"list without base dir", &Req{}, "backup_base_dir"},
+		{"valid dial", &DialRequest{Endpoints: []string{"10.0.0.1:5701", "[::1]:5701"}}, ""},
+		{"empty dial", &DialRequest{}, "endpoints"},
+		{"dial without port", &DialRequest{Endpoints: []string{"10.0.0.1"}}, "endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantField == "" {
+				require.Nil(t, err)
+				return
+			}
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			require.Equal(t, tt.wantField, verr.Field)
+		})
+	}
+}
+
+func TestUploadReqManifest(t *testing.T) {
+	require.Nil(t, (&UploadReq{BucketURL: "s3://bucket"}).Manifest())
+	r := &UploadReq{ClusterName: "prod", HazelcastVersion: "5.3.1", ClusterSize: 3, PartitionCount: 271}
+	require.Equal(t, &BackupManifest{ClusterName: "prod", HazelcastVersion: "5.3.1", MemberCount: 3, PartitionCount: 271}, r.Manifest())
+}
+
+func TestValidateFields(t *testing.T) {
+	err := (&UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data", HazelcastCRName: "hz", Priority: "urgent"}).Validate()
+	require.EqualError(t, err, `invalid field "priority": must be one of HIGH, NORMAL or LOW`)
+	err = (&UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data", HazelcastCRName: "hz", ACL: "public-read"}).Validate()
+	require.EqualError(t, err, `invalid field "acl": must be one of private, bucket-owner-read or bucket-owner-full-control`)
+	err = (&UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data", HazelcastCRName: "hz", MissedRunPolicy: "later"}).Validate()
+	require.EqualError(t, err, `invalid field "missed_run_policy": must be one of SKIP, RUN or DEADLINE`)
+	require.EqualError(t, (&DialRequest{}).Validate(), `invalid field "endpoints": must not be empty`)
+	require.EqualError(t, (&Req{BackupBaseDir: "/data", MemberID: -1}).Validate(), `invalid field "member_id": must not be negative`)
+}
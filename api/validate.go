@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// validateFields checks the validate tags of the fields of the struct v points to. The rules are
+// separated by commas:
+//   - required: the field is not empty
+//   - min=<n>: the integer is at least n
+//   - url: the string, or every string of the slice, is an absolute URL
+//   - oneof=<a b c>: the string is empty or one of the values
+//
+// Rules that depend on several fields are checked by the Validate methods.
+func validateFields(v interface{}) error {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag, ok := rt.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		for _, rule := range strings.Split(tag, ",") {
+			if reason := checkRule(rv.Field(i), rule); reason != "" {
+				return &ValidationError{name, reason}
+			}
+		}
+	}
+	return nil
+}
+
+// checkRule returns why the field breaks the rule, empty if it does not
+func checkRule(f reflect.Value, rule string) string {
+	rule, arg, _ := strings.Cut(rule, "=")
+	switch rule {
+	case "required":
+		if f.IsZero() || (f.Kind() == reflect.Slice && f.Len() == 0) {
+			return "must not be empty"
+		}
+	case "min":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid validate rule min=%s", arg))
+		}
+		if f.Int() < n {
+			if n == 0 {
+				return "must not be negative"
+			}
+			return fmt.Sprintf("must be at least %d", n)
+		}
+	case "url":
+		if f.Kind() == reflect.Slice {
+			for i := 0; i < f.Len(); i++ {
+				if !absoluteURL(f.Index(i).String()) {
+					return "must be absolute URLs"
+				}
+			}
+		} else if f.String() != "" && !absoluteURL(f.String()) {
+			return "must be an absolute URL"
+		}
+	case "oneof":
+		values := strings.Fields(arg)
+		if f.String() == "" {
+			return ""
+		}
+		for _, v := range values {
+			if f.String() == v {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s or %s", strings.Join(values[:len(values)-1], ", "), values[len(values)-1])
+	default:
+		panic(fmt.Sprintf("unknown validate rule %q", rule))
+	}
+	return ""
+}
+
+func absoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
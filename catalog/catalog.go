@@ -0,0 +1,196 @@
+package catalog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// Output formats of the inventory
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Source is the bucket prefix holding the backups of a cluster
+type Source struct {
+	Cluster string
+	URL     string
+}
+
+// ParseSources parses a comma separated list of cluster=bucket-url pairs, a URL without a cluster
+// name is named after itself
+func ParseSources(list string) ([]Source, error) {
+	var sources []Source
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		src := Source{Cluster: s, URL: s}
+		// URLs contain no = before their scheme, query parameters only follow it
+		if name, u, ok := strings.Cut(s, "="); ok && !strings.Contains(name, ":") {
+			src = Source{Cluster: strings.TrimSpace(name), URL: strings.TrimSpace(u)}
+		}
+		if src.Cluster == "" || src.URL == "" {
+			return nil, fmt.Errorf("invalid source %q, expected cluster=bucket-url", s)
+		}
+		if seen[src.Cluster] {
+			return nil, fmt.Errorf("cluster %s is listed twice", src.Cluster)
+		}
+		seen[src.Cluster] = true
+		sources = append(sources, src)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources")
+	}
+	return sources, nil
+}
+
+// Backup is a dated backup folder of a cluster
+type Backup struct {
+	Cluster string    `json:"cluster"`
+	Folder  string    `json:"folder"`
+	Time    time.Time `json:"time"`
+	// AgeSeconds is the age of the backup when the inventory was generated
+	AgeSeconds int64 `json:"age_seconds"`
+	// Archives is the number of member archives in the folder
+	Archives int `json:"archives"`
+	// Bytes is the size of all objects in the folder, including parts and checksums
+	Bytes int64 `json:"bytes"`
+	// Expected is the number of members that took the backup as recorded by the uploads, 0 if
+	// the archives record none
+	Expected int `json:"expected,omitempty"`
+	// Partial is set if the folder has fewer archives than members took the backup, e.g. because
+	// some uploads failed. Restores refuse such folders unless they are confirmed.
+	Partial bool `json:"partial"`
+}
+
+// SourceError is a source that could not be scanned
+type SourceError struct {
+	Cluster string `json:"cluster"`
+	Error   string `json:"error"`
+}
+
+// Inventory lists the backups of all sources, ordered by cluster and time
+type Inventory struct {
+	Generated time.Time     `json:"generated"`
+	Backups   []Backup      `json:"backups"`
+	Errors    []SourceError `json:"errors,omitempty"`
+}
+
+// Scan returns the dated backup folders at the top of the bucket. Objects outside of dated folders,
+// e.g. restore reports, are ignored. Folder names without zone offset are in loc.
+func Scan(ctx context.Context, bucket *blob.Bucket, cluster string, loc *time.Location, now time.Time) ([]Backup, error) {
+	folders := make(map[string]*Backup)
+	keys := make(map[string][]string)
+	iter := bucket.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		folder, name, ok := strings.Cut(obj.Key, "/")
+		if !ok || obj.IsDir {
+			continue
+		}
+		b, ok := folders[folder]
+		if !ok {
+			t, err := fileutil.ParseFolderTime(folder, loc)
+			if err != nil {
+				continue
+			}
+			b = &Backup{Cluster: cluster, Folder: folder, Time: t.UTC(), AgeSeconds: int64(now.Sub(t).Seconds())}
+			folders[folder] = b
+		}
+		b.Bytes += obj.Size
+		// archives are stored directly in their folder, the manifest stands for an archive in parts
+		if key, ok := archive.Key(name); ok && !strings.Contains(name, "/") {
+			b.Archives++
+			keys[folder] = append(keys[folder], folder+"/"+key)
+		}
+	}
+
+	backups := make([]Backup, 0, len(folders))
+	for folder, b := range folders {
+		for _, key := range keys[folder] {
+			size, err := archive.ReadClusterSize(ctx, bucket, key)
+			if err != nil {
+				return nil, err
+			}
+			if size > b.Expected {
+				b.Expected = size
+			}
+		}
+		b.Partial = b.Archives < b.Expected
+		backups = append(backups, *b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// Aggregate scans every source, a source that cannot be opened or listed is recorded in the errors
+// of the inventory and the others are still scanned
+func Aggregate(ctx context.Context, sources []Source, open func(ctx context.Context, url string) (*blob.Bucket, error), loc *time.Location, now time.Time) Inventory {
+	inv := Inventory{Generated: now.UTC(), Backups: []Backup{}}
+	for _, src := range sources {
+		backups, err := scanSource(ctx, src, open, loc, now)
+		if err != nil {
+			inv.Errors = append(inv.Errors, SourceError{Cluster: src.Cluster, Error: err.Error()})
+			continue
+		}
+		inv.Backups = append(inv.Backups, backups...)
+	}
+	return inv
+}
+
+func scanSource(ctx context.Context, src Source, open func(ctx context.Context, url string) (*blob.Bucket, error), loc *time.Location, now time.Time) ([]Backup, error) {
+	b, err := open(ctx, src.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	return Scan(ctx, b, src.Cluster, loc, now)
+}
+
+// Write writes the inventory in the format, CSV lists the backups only
+func Write(w io.Writer, inv Inventory, format string) error {
+	switch format {
+	case FormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(inv)
+	case FormatCSV:
+		c := csv.NewWriter(w)
+		if err := c.Write([]string{"cluster", "folder", "time", "age_seconds", "archives", "bytes", "expected", "partial"}); err != nil {
+			return err
+		}
+		for _, b := range inv.Backups {
+			err := c.Write([]string{b.Cluster, b.Folder, b.Time.Format(time.RFC3339),
+				strconv.FormatInt(b.AgeSeconds, 10), strconv.Itoa(b.Archives), strconv.FormatInt(b.Bytes, 10), strconv.Itoa(b.Expected), strconv.FormatBool(b.Partial)})
+			if err != nil {
+				return err
+			}
+		}
+		c.Flush()
+		return c.Error()
+	default:
+		return fmt.Errorf("unknown format %q, expected json or csv", format)
+	}
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []Source
+		wantErr bool
+	}{
+		{"named", "prod=s3://backups/prod, staging=gs://backups/staging", []Source{{"prod", "s3://backups/prod"}, {"staging", "gs://backups/staging"}}, false},
+		{"unnamed", "s3://backups/prod?region=eu-west-1", []Source{{"s3://backups/prod?region=eu-west-1", "s3://backups/prod?region=eu-west-1"}}, false},
+		{"named with query", "prod=s3://backups/prod?region=eu-west-1", []Source{{"prod", "s3://backups/prod?region=eu-west-1"}}, false},
+		{"empty", " , ", nil, true},
+		{"missing url", "prod=", nil, true},
+		{"duplicate", "prod=s3://a,prod=s3://b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSources(tt.list)
+			require.Equal(t, tt.wantErr, err != nil, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func writeObjects(t *testing.T, b *blob.Bucket, objects map[string]int) {
+	for key, size := range objects {
+		require.Nil(t, b.WriteAll(context.Background(), key, make([]byte, size), nil))
+	}
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	writeObjects(t, b, map[string]int{
+		"2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz":        100,
+		"2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz.sha256": 10,
+		"2022-07-28-19-00-55/00000000-0000-0000-0000-000000000002.tar.gz":        200,
+		// an archive uploaded in parts
+		"2022-07-29-19-00-55+0200/00000000-0000-0000-0000-000000000001.tar.zst.part-0000": 50,
+		"2022-07-29-19-00-55+0200/00000000-0000-0000-0000-000000000001.tar.zst.part-0001": 50,
+		"2022-07-29-19-00-55+0200/00000000-0000-0000-0000-000000000001.tar.zst.parts":     5,
+		"reports/2022-07-28-19-00-55-hazelcast-0.json":                                    7,
+		"unrelated.txt": 1,
+	})
+
+	now := time.Date(2022, 7, 30, 19, 0, 55, 0, time.UTC)
+	got, err := Scan(ctx, b, "prod", time.UTC, now)
+	require.Nil(t, err)
+	require.Equal(t, []Backup{
+		{Cluster: "prod", Folder: "2022-07-28-19-00-55", Time: time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC), AgeSeconds: 2 * 86400, Archives: 2, Bytes: 310},
+		{Cluster: "prod", Folder: "2022-07-29-19-00-55+0200", Time: time.Date(2022, 7, 29, 17, 0, 55, 0, time.UTC), AgeSeconds: 26 * 3600, Archives: 1, Bytes: 105},
+	}, got)
+}
+
+func TestScanPartial(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	// the upload of the second of three members failed
+	for _, key := range []string{"00000000-0000-0000-0000-000000000001.tar.gz", "00000000-0000-0000-0000-000000000003.tar.gz"} {
+		require.Nil(t, b.WriteAll(ctx, "2022-07-28-19-00-55/"+key, make([]byte, 10), archive.WithClusterSize(nil, 3)))
+	}
+	require.Nil(t, b.WriteAll(ctx, "2022-07-29-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz", make([]byte, 10), archive.WithClusterSize(nil, 1)))
+
+	got, err := Scan(ctx, b, "prod", time.UTC, time.Date(2022, 7, 30, 19, 0, 55, 0, time.UTC))
+	require.Nil(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, 3, got[0].Expected)
+	require.True(t, got[0].Partial)
+	require.Equal(t, 1, got[1].Expected)
+	require.False(t, got[1].Partial)
+}
+
+func TestAggregate(t *testing.T) {
+	ctx := context.Background()
+	prod := memblob.OpenBucket(nil)
+	writeObjects(t, prod, map[string]int{"2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz": 100})
+	require.Nil(t, prod.Close())
+
+	open := func(ctx context.Context, url string) (*blob.Bucket, error) {
+		if url == "mem://staging" {
+			return nil, errors.New("access denied")
+		}
+		b := memblob.OpenBucket(nil)
+		writeObjects(t, b, map[string]int{"2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz": 100})
+		return b, nil
+	}
+	now := time.Date(2022, 7, 28, 20, 0, 55, 0, time.UTC)
+	inv := Aggregate(ctx, []Source{{"prod", "mem://prod"}, {"staging", "mem://staging"}}, open, time.UTC, now)
+	require.Equal(t, now, inv.Generated)
+	require.Len(t, inv.Backups, 1)
+	require.Equal(t, "prod", inv.Backups[0].Cluster)
+	require.Equal(t, int64(3600), inv.Backups[0].AgeSeconds)
+	require.Equal(t, []SourceError{{Cluster: "staging", Error: "access denied"}}, inv.Errors)
+
+	var buf bytes.Buffer
+	require.Nil(t, Write(&buf, inv, FormatCSV))
+	require.Equal(t, "cluster,folder,time,age_seconds,archives,bytes,expected,partial\nprod,2022-07-28-19-00-55,2022-07-28T19:00:55Z,3600,1,100,0,false\n", buf.String())
+
+	buf.Reset()
+	require.Nil(t, Write(&buf, inv, FormatJSON))
+	require.Contains(t, buf.String(), `"age_seconds": 3600`)
+	require.Contains(t, buf.String(), `"error": "access denied"`)
+
+	require.NotNil(t, Write(&buf, inv, "xml"))
+}
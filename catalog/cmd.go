@@ -0,0 +1,131 @@
+package catalog
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+var log = logger.New().Named("catalog")
+
+// Cmd groups the catalog subcommands, e.g. catalog aggregate
+type Cmd struct{}
+
+func (*Cmd) Name() string     { return "catalog" }
+func (*Cmd) Synopsis() string { return "inventory of the backups of many clusters" }
+func (*Cmd) Usage() string    { return "catalog aggregate [flags]\n" }
+
+func (*Cmd) SetFlags(*flag.FlagSet) {}
+
+func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, c.Name())
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(cdr.FlagsCommand(), "")
+	cdr.Register(&AggregateCmd{}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+type AggregateCmd struct {
+	Sources    string `envconfig:"CATALOG_SOURCES"`
+	SecretName string `envconfig:"CATALOG_SECRET_NAME"`
+	Format     string `envconfig:"CATALOG_FORMAT"`
+	Output     string `envconfig:"CATALOG_OUTPUT"`
+	Timezone   string `envconfig:"CATALOG_TIMEZONE"`
+}
+
+func (*AggregateCmd) Name() string { return "aggregate" }
+func (*AggregateCmd) Synopsis() string {
+	return "scan the backup buckets of many clusters into a JSON or CSV inventory"
+}
+func (*AggregateCmd) Usage() string { return "" }
+
+func (a *AggregateCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&a.Sources, "sources", "", "comma separated cluster=bucket-url pairs, e.g. prod=s3://backups/prod,staging=gs://backups/staging")
+	f.StringVar(&a.SecretName, "secret-name", "", "secret name for the bucket credentials of all sources")
+	f.StringVar(&a.Format, "format", FormatJSON, "inventory format: json or csv")
+	f.StringVar(&a.Output, "output", "", "file the inventory is written to, stdout if empty")
+	f.StringVar(&a.Timezone, "timezone", "UTC", "time zone of backup folder names without zone offset")
+}
+
+func (a *AggregateCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	// overwrite config with environment variables
+	if err := config.Process("catalog", a, f); err != nil {
+		log.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	sources, err := ParseSources(a.Sources)
+	if err != nil {
+		log.Error("invalid sources: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		log.Error("error while loading time zone: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if err = Write(io.Discard, Inventory{}, a.Format); err != nil {
+		log.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	log.Info("reading secret", zap.String("secret name", a.SecretName))
+	secretData, err := bucket.SecretData(ctx, a.SecretName)
+	if err != nil {
+		log.Error("error fetching secret data: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	open := func(ctx context.Context, u string) (*blob.Bucket, error) {
+		bucketURI, err := uri.NormalizeURI(u)
+		if err != nil {
+			return nil, err
+		}
+		return bucket.OpenBucket(ctx, bucketURI, secretData)
+	}
+	inv := Aggregate(ctx, sources, open, loc, clock.Now())
+	for _, e := range inv.Errors {
+		log.Error("could not scan source: "+e.Error, zap.String("cluster", e.Cluster))
+	}
+
+	if a.Output == "" {
+		err = Write(os.Stdout, inv, a.Format)
+	} else {
+		err = writeFile(a.Output, inv, a.Format)
+	}
+	if err != nil {
+		log.Error("could not write inventory: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	log.Info("inventory written", zap.Int("backups", len(inv.Backups)), zap.Int("failed sources", len(inv.Errors)))
+	// an incomplete inventory must not pass for a complete one
+	if len(inv.Errors) > 0 {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+func writeFile(name string, inv Inventory, format string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = Write(f, inv, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
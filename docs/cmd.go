@@ -0,0 +1,46 @@
+package docs
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/google/subcommands"
+
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+var log = logger.New().Named("docs")
+
+type Cmd struct {
+	Format string
+}
+
+func (*Cmd) Name() string     { return "docs" }
+func (*Cmd) Synopsis() string { return "print the flag and environment variable reference" }
+func (*Cmd) Usage() string    { return "" }
+
+func (d *Cmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&d.Format, "format", "markdown", "output format, markdown or json")
+}
+
+func (d *Cmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	ref := Generate(flag.CommandLine, config.Specs())
+
+	var err error
+	switch d.Format {
+	case "markdown":
+		err = WriteMarkdown(os.Stdout, ref)
+	case "json":
+		err = WriteJSON(os.Stdout, ref)
+	default:
+		log.Error("unknown format: " + d.Format)
+		return subcommands.ExitUsageError
+	}
+	if err != nil {
+		log.Error("could not write reference: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
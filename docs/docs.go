@@ -0,0 +1,134 @@
+package docs
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/google/subcommands"
+)
+
+// Option is a setting that can be given as a flag, an environment variable or both
+type Option struct {
+	Flag    string `json:"flag,omitempty"`
+	Env     string `json:"env,omitempty"`
+	Default string `json:"default,omitempty"`
+	Usage   string `json:"usage,omitempty"`
+}
+
+// Command is the reference of a single subcommand
+type Command struct {
+	Name     string   `json:"name"`
+	Synopsis string   `json:"synopsis"`
+	Options  []Option `json:"options"`
+}
+
+// Reference lists all commands and the options shared by them
+type Reference struct {
+	Global   []Option  `json:"global"`
+	Commands []Command `json:"commands"`
+}
+
+// Generate builds the reference from the global flags and the registered envconfig specs,
+// specs that are subcommands are documented as commands, the others as global options
+func Generate(global *flag.FlagSet, specs []interface{}) Reference {
+	var ref Reference
+	global.VisitAll(func(f *flag.Flag) {
+		ref.Global = append(ref.Global, Option{Flag: "-" + f.Name, Default: f.DefValue, Usage: f.Usage})
+	})
+
+	for _, spec := range specs {
+		cmd, ok := spec.(subcommands.Command)
+		if !ok {
+			ref.Global = append(ref.Global, options(spec, nil)...)
+			continue
+		}
+
+		f := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+		cmd.SetFlags(f)
+		ref.Commands = append(ref.Commands, Command{
+			Name:     cmd.Name(),
+			Synopsis: cmd.Synopsis(),
+			Options:  options(spec, f),
+		})
+	}
+	return ref
+}
+
+// options matches the flags to the spec fields they are bound to, fields keep their order
+func options(spec interface{}, f *flag.FlagSet) []Option {
+	flags := make(map[uintptr]*flag.Flag)
+	if f != nil {
+		f.VisitAll(func(fl *flag.Flag) {
+			if v := reflect.ValueOf(fl.Value); v.Kind() == reflect.Ptr {
+				flags[v.Pointer()] = fl
+			}
+		})
+	}
+
+	v := reflect.ValueOf(spec).Elem()
+	used := make(map[string]bool)
+	var opts []Option
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		o := Option{Env: field.Tag.Get("envconfig"), Default: field.Tag.Get("default"), Usage: field.Tag.Get("desc")}
+		if fl, ok := flags[v.Field(i).Addr().Pointer()]; ok {
+			o.Flag, o.Default, o.Usage = "-"+fl.Name, fl.DefValue, fl.Usage
+			used[fl.Name] = true
+		}
+		if o.Env == "" && o.Flag == "" {
+			continue
+		}
+		opts = append(opts, o)
+	}
+
+	// flags without a spec field, in flag order
+	if f != nil {
+		f.VisitAll(func(fl *flag.Flag) {
+			if !used[fl.Name] {
+				opts = append(opts, Option{Flag: "-" + fl.Name, Default: fl.DefValue, Usage: fl.Usage})
+			}
+		})
+	}
+	return opts
+}
+
+// WriteJSON writes the reference as indented JSON
+func WriteJSON(w io.Writer, ref Reference) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(ref)
+}
+
+// WriteMarkdown writes the reference as markdown tables
+func WriteMarkdown(w io.Writer, ref Reference) error {
+	var b strings.Builder
+	b.WriteString("# Configuration Reference\n\n")
+	b.WriteString("## Global options\n\n")
+	writeTable(&b, ref.Global)
+	for _, c := range ref.Commands {
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", c.Name, c.Synopsis)
+		writeTable(&b, c.Options)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTable(b *strings.Builder, opts []Option) {
+	b.WriteString("| Flag | Environment variable | Default | Description |\n")
+	b.WriteString("|------|----------------------|---------|-------------|\n")
+	for _, o := range opts {
+		fmt.Fprintf(b, "| %s | %s | %s | %s |\n", code(o.Flag), code(o.Env), code(o.Default), strings.ReplaceAll(o.Usage, "|", "\\|"))
+	}
+	b.WriteString("\n")
+}
+
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
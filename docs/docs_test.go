@@ -0,0 +1,74 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/stretchr/testify/require"
+)
+
+type testCmd struct {
+	Source   string `envconfig:"TEST_SOURCE"`
+	Retries  int    `envconfig:"TEST_RETRIES"`
+	EnvOnly  string `envconfig:"TEST_ENV_ONLY"`
+	flagOnly bool
+}
+
+func (*testCmd) Name() string     { return "test" }
+func (*testCmd) Synopsis() string { return "test command" }
+func (*testCmd) Usage() string    { return "" }
+
+func (c *testCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Source, "src", "/data", "source path")
+	f.IntVar(&c.Retries, "retries", 3, "number of retries")
+	f.BoolVar(&c.flagOnly, "dry-run", false, "only print")
+}
+
+func (c *testCmd) Execute(context.Context, *flag.FlagSet, ...interface{}) subcommands.ExitStatus {
+	return subcommands.ExitSuccess
+}
+
+type testTuning struct {
+	Size int `envconfig:"TEST_SIZE" desc:"size in bytes"`
+}
+
+func TestGenerate(t *testing.T) {
+	global := flag.NewFlagSet("agent", flag.ContinueOnError)
+	global.Bool("strict", false, "strict mode")
+
+	ref := Generate(global, []interface{}{&testCmd{}, &testTuning{}})
+
+	require.Equal(t, []Option{
+		{Flag: "-strict", Default: "false", Usage: "strict mode"},
+		{Env: "TEST_SIZE", Usage: "size in bytes"},
+	}, ref.Global)
+	require.Equal(t, []Command{{
+		Name:     "test",
+		Synopsis: "test command",
+		Options: []Option{
+			{Flag: "-src", Env: "TEST_SOURCE", Default: "/data", Usage: "source path"},
+			{Flag: "-retries", Env: "TEST_RETRIES", Default: "3", Usage: "number of retries"},
+			{Env: "TEST_ENV_ONLY"},
+			{Flag: "-dry-run", Default: "false", Usage: "only print"},
+		},
+	}}, ref.Commands)
+}
+
+func TestWrite(t *testing.T) {
+	ref := Generate(flag.NewFlagSet("agent", flag.ContinueOnError), []interface{}{&testCmd{}})
+
+	var md bytes.Buffer
+	require.Nil(t, WriteMarkdown(&md, ref))
+	require.Contains(t, md.String(), "## test\n\ntest command\n")
+	require.Contains(t, md.String(), "| `-src` | `TEST_SOURCE` | `/data` | source path |\n")
+
+	var js bytes.Buffer
+	require.Nil(t, WriteJSON(&js, ref))
+	var got Reference
+	require.Nil(t, json.Unmarshal(js.Bytes(), &got))
+	require.Equal(t, ref, got)
+}
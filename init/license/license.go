@@ -0,0 +1,314 @@
+package license
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+// maxLicenseSize bounds the license read from a secret or object, keys are a few hundred bytes
+const maxLicenseSize = 64 << 10
+
+var log = logger.New().Named("license")
+
+// Cmd places the Hazelcast Enterprise license from a secret or a bucket object into the license file.
+// With a refresh interval it keeps running as a sidecar and rewrites the file when the license changes.
+type Cmd struct {
+	SecretName       string        `envconfig:"LICENSE_SECRET_NAME"`
+	SecretKey        string        `envconfig:"LICENSE_SECRET_KEY"`
+	BucketURL        string        `envconfig:"LICENSE_BUCKET_URL"`
+	ObjectKey        string        `envconfig:"LICENSE_OBJECT_KEY"`
+	BucketSecretName string        `envconfig:"LICENSE_BUCKET_SECRET_NAME"`
+	Destination      string        `envconfig:"LICENSE_DESTINATION"`
+	FileMode         string        `envconfig:"LICENSE_FILE_MODE"`
+	Chown            string        `envconfig:"LICENSE_CHOWN"`
+	RefreshInterval  time.Duration `envconfig:"LICENSE_REFRESH_INTERVAL"`
+}
+
+func (*Cmd) Name() string     { return "license" }
+func (*Cmd) Synopsis() string { return "Place the Hazelcast Enterprise license file" }
+func (*Cmd) Usage() string    { return "" }
+
+func (r *Cmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.SecretName, "secret-name", "", "secret the license is read from")
+	f.StringVar(&r.SecretKey, "secret-key", "license-key", "key of the license in the secret")
+	f.StringVar(&r.BucketURL, "src", "", "bucket the license object is read from, instead of a secret")
+	f.StringVar(&r.ObjectKey, "key", "", "key of the license object in the bucket")
+	f.StringVar(&r.BucketSecretName, "bucket-secret-name", "", "secret name for the bucket credentials")
+	f.StringVar(&r.Destination, "dst", "/opt/hazelcast/license/license-key", "file the license is written to")
+	f.StringVar(&r.FileMode, "file-mode", "0440", "octal permission bits of the license file")
+	f.StringVar(&r.Chown, "chown", "", "numeric uid:gid, uid or :gid of the license file, e.g. the user of the Hazelcast container")
+	f.DurationVar(&r.RefreshInterval, "refresh-interval", 0, "interval of the checks for a changed license, 0 places the license once and exits")
+}
+
+func (r *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
+	log.Info("starting license agent...")
+
+	start := time.Now()
+	var result *placement
+	defer func() { termination.Report(r.Name(), status, start, result) }()
+
+	// overwrite config with environment variables
+	if err := config.Process("license", r, f); err != nil {
+		log.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	fetch, err := r.source()
+	if err != nil {
+		log.Error("invalid license source: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	file, err := r.file()
+	if err != nil {
+		log.Error("invalid license file: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	p, err := place(ctx, fetch, file)
+	if err != nil {
+		log.Error("could not place license: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	result = &p
+	if r.RefreshInterval <= 0 {
+		return subcommands.ExitSuccess
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	refresh(ctx, fetch, file, r.RefreshInterval)
+	return subcommands.ExitSuccess
+}
+
+// fetchFunc returns the current license
+type fetchFunc func(ctx context.Context) ([]byte, error)
+
+// source returns the fetch function of the configured source, exactly one of the secret and the
+// bucket must be set
+func (r *Cmd) source() (fetchFunc, error) {
+	switch {
+	case r.SecretName != "" && r.BucketURL != "":
+		return nil, errors.New("set either secret-name or src, not both")
+	case r.SecretName != "":
+		if r.SecretKey == "" {
+			return nil, errors.New("secret-key is required")
+		}
+		return secretSource(r.SecretName, r.SecretKey), nil
+	case r.BucketURL != "":
+		if r.ObjectKey == "" {
+			return nil, errors.New("key is required with src")
+		}
+		bucketURI, err := uri.NormalizeURI(r.BucketURL)
+		if err != nil {
+			return nil, err
+		}
+		return bucketSource(bucketURI, r.ObjectKey, r.BucketSecretName), nil
+	default:
+		return nil, errors.New("secret-name or src is required")
+	}
+}
+
+func secretSource(name, key string) fetchFunc {
+	return func(ctx context.Context) ([]byte, error) {
+		data, err := bucket.SecretData(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := data[key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s has no %s entry", name, key)
+		}
+		return v, nil
+	}
+}
+
+func bucketSource(bucketURI, key, secretName string) fetchFunc {
+	return func(ctx context.Context) ([]byte, error) {
+		secretData, err := bucket.SecretData(ctx, secretName)
+		if err != nil {
+			return nil, err
+		}
+		b, err := bucket.OpenBucket(ctx, bucketURI, secretData)
+		if err != nil {
+			return nil, err
+		}
+		defer b.Close()
+
+		attrs, err := b.Attributes(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if attrs.Size > maxLicenseSize {
+			return nil, fmt.Errorf("license object %s has %d bytes, at most %d are allowed", key, attrs.Size, maxLicenseSize)
+		}
+		return b.ReadAll(ctx, key)
+	}
+}
+
+// licenseFile is the destination of the license with its permissions
+type licenseFile struct {
+	name string
+	mode fs.FileMode
+	// uid and gid are -1 to keep the owner or the group of the agent
+	uid, gid int
+}
+
+func (r *Cmd) file() (licenseFile, error) {
+	if r.Destination == "" {
+		return licenseFile{}, errors.New("dst is required")
+	}
+	l := licenseFile{name: r.Destination, uid: -1, gid: -1}
+	mode, err := strconv.ParseUint(r.FileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return licenseFile{}, fmt.Errorf("invalid file-mode %q, expected octal permission bits like 0440", r.FileMode)
+	}
+	l.mode = fs.FileMode(mode)
+	if r.Chown != "" {
+		if l.uid, l.gid, err = fileutil.ParseChown(r.Chown, "chown"); err != nil {
+			return licenseFile{}, err
+		}
+	}
+	return l, nil
+}
+
+// placement is reported in the termination message, the license itself is never reported or logged
+type placement struct {
+	Destination string `json:"destination"`
+	// Digest is the start of the SHA-256 of the license, enough to tell licenses apart
+	Digest  string `json:"digest"`
+	Changed bool   `json:"changed"`
+}
+
+// place fetches the license and writes it to the file if it changed
+func place(ctx context.Context, fetch fetchFunc, f licenseFile) (placement, error) {
+	data, err := fetch(ctx)
+	if err != nil {
+		return placement{}, err
+	}
+	key, err := parseLicense(data)
+	if err != nil {
+		return placement{}, err
+	}
+	p := placement{Destination: f.name, Digest: digest(key)}
+
+	old, err := os.ReadFile(f.name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return placement{}, err
+	}
+	if bytes.Equal(old, key) {
+		// the permissions may have been reset, e.g. by a new volume mount
+		if err = f.apply(f.name); err != nil {
+			return placement{}, err
+		}
+		log.Debug("license is unchanged", zap.String("destination", f.name), zap.String("digest", p.Digest))
+		return p, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(f.name), 0755); err != nil {
+		return placement{}, err
+	}
+	if err = f.write(key); err != nil {
+		return placement{}, err
+	}
+	p.Changed = true
+	log.Info("license placed", zap.String("destination", f.name), zap.String("digest", p.Digest))
+	return p, nil
+}
+
+// parseLicense trims the whitespace and line breaks secrets and objects often end with, the
+// license must be a single non-empty line
+func parseLicense(data []byte) ([]byte, error) {
+	if len(data) > maxLicenseSize {
+		return nil, fmt.Errorf("license has %d bytes, at most %d are allowed", len(data), maxLicenseSize)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, errors.New("license is empty")
+	}
+	if bytes.ContainsAny(key, "\r\n") {
+		return nil, errors.New("license has more than one line")
+	}
+	return key, nil
+}
+
+func digest(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// write replaces the file through a temporary file, Hazelcast never reads a partial license
+func (f licenseFile) write(key []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.name), filepath.Base(f.name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(key); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = f.apply(tmp.Name())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// apply sets the mode and the owner of the file
+func (f licenseFile) apply(name string) error {
+	if err := os.Chmod(name, f.mode); err != nil {
+		return err
+	}
+	if f.uid == -1 && f.gid == -1 {
+		return nil
+	}
+	return os.Lchown(name, f.uid, f.gid)
+}
+
+// refresh places the license every interval until the context is canceled. Failures are logged and
+// keep the current license file, a temporarily unreadable secret must not remove a valid license.
+func refresh(ctx context.Context, fetch fetchFunc, f licenseFile, interval time.Duration) {
+	log.Info("watching license for changes", zap.Duration("interval", interval))
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("stopping license agent")
+			return
+		case <-t.C:
+		}
+		if _, err := place(ctx, fetch, f); err != nil && ctx.Err() == nil {
+			log.Error("could not refresh license: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package license
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+)
+
+func staticSource(key string) fetchFunc {
+	return func(context.Context) ([]byte, error) {
+		return []byte(key), nil
+	}
+}
+
+func TestPlace(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "license", "license-key")
+	f := licenseFile{name: dst, mode: 0440, uid: -1, gid: -1}
+
+	p, err := place(context.Background(), staticSource("ENTERPRISE#key\n"), f)
+	require.Nil(t, err)
+	require.True(t, p.Changed)
+	require.Len(t, p.Digest, 12)
+	data, err := os.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, "ENTERPRISE#key", string(data))
+	info, err := os.Stat(dst)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0440), info.Mode().Perm())
+
+	// an unchanged license keeps the file but restores its mode
+	require.Nil(t, os.Chmod(dst, 0600))
+	p2, err := place(context.Background(), staticSource("ENTERPRISE#key"), f)
+	require.Nil(t, err)
+	require.False(t, p2.Changed)
+	require.Equal(t, p.Digest, p2.Digest)
+	info, err = os.Stat(dst)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0440), info.Mode().Perm())
+
+	p3, err := place(context.Background(), staticSource("ENTERPRISE#other"), f)
+	require.Nil(t, err)
+	require.True(t, p3.Changed)
+	require.NotEqual(t, p.Digest, p3.Digest)
+	data, err = os.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, "ENTERPRISE#other", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	require.Nil(t, err)
+	require.Len(t, entries, 1, "no temporary files are left")
+}
+
+func TestPlaceKeepsLicenseOnError(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "license-key")
+	require.Nil(t, os.WriteFile(dst, []byte("ENTERPRISE#key"), 0440))
+	f := licenseFile{name: dst, mode: 0440, uid: -1, gid: -1}
+
+	failing := func(context.Context) ([]byte, error) { return nil, errors.New("secret not found") }
+	for _, fetch := range []fetchFunc{failing, staticSource("  \n")} {
+		_, err := place(context.Background(), fetch, f)
+		require.NotNil(t, err)
+		data, err := os.ReadFile(dst)
+		require.Nil(t, err)
+		require.Equal(t, "ENTERPRISE#key", string(data))
+	}
+}
+
+func TestPlaceChown(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	dst := filepath.Join(t.TempDir(), "license-key")
+	f := licenseFile{name: dst, mode: 0440, uid: 1001, gid: 0}
+
+	_, err := place(context.Background(), staticSource("ENTERPRISE#key"), f)
+	require.Nil(t, err)
+	info, err := os.Stat(dst)
+	require.Nil(t, err)
+	st := info.Sys().(*syscall.Stat_t)
+	require.Equal(t, uint32(1001), st.Uid)
+	require.Equal(t, uint32(0), st.Gid)
+}
+
+func TestParseLicense(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"trailing line break", "ENTERPRISE#key\r\n", "ENTERPRISE#key", false},
+		{"empty", " \n", "", true},
+		{"several lines", "ENTERPRISE#key\nother", "", true},
+		{"too large", strings.Repeat("a", maxLicenseSize+1), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseLicense([]byte(tt.data))
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, string(key))
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     Cmd
+		wantErr bool
+	}{
+		{"secret", Cmd{SecretName: "license", SecretKey: "license-key"}, false},
+		{"bucket", Cmd{BucketURL: "file:///tmp/licenses", ObjectKey: "license-key"}, false},
+		{"no source", Cmd{SecretKey: "license-key"}, true},
+		{"both sources", Cmd{SecretName: "license", SecretKey: "license-key", BucketURL: "file:///tmp/licenses", ObjectKey: "license-key"}, true},
+		{"no object key", Cmd{BucketURL: "file:///tmp/licenses"}, true},
+		{"no secret key", Cmd{SecretName: "license"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cmd.source()
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	f, err := (&Cmd{Destination: "/license", FileMode: "0444", Chown: ":5000"}).file()
+	require.Nil(t, err)
+	require.Equal(t, licenseFile{name: "/license", mode: 0444, uid: -1, gid: 5000}, f)
+
+	for _, c := range []Cmd{
+		{Destination: "/license", FileMode: "rw"},
+		{Destination: "/license", FileMode: "01777"},
+		{Destination: "/license", FileMode: "0440", Chown: "hazelcast"},
+		{FileMode: "0440"},
+	} {
+		_, err = c.file()
+		require.NotNil(t, err, "Cmd: %+v", c)
+	}
+}
+
+func TestBucketSource(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	b, err := blob.OpenBucket(ctx, "file://"+dir)
+	require.Nil(t, err)
+	require.Nil(t, b.WriteAll(ctx, "licenses/license-key", []byte("ENTERPRISE#key\n"), nil))
+	require.Nil(t, b.WriteAll(ctx, "large", make([]byte, maxLicenseSize+1), nil))
+	require.Nil(t, b.Close())
+
+	data, err := bucketSource("file://"+dir, "licenses/license-key", "")(ctx)
+	require.Nil(t, err)
+	require.Equal(t, "ENTERPRISE#key\n", string(data))
+
+	_, err = bucketSource("file://"+dir, "large", "")(ctx)
+	require.NotNil(t, err)
+	_, err = bucketSource("file://"+dir, "missing", "")(ctx)
+	require.NotNil(t, err)
+}
+
+func TestRefresh(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "license-key")
+	f := licenseFile{name: dst, mode: 0440, uid: -1, gid: -1}
+
+	keys := make(chan string, 2)
+	keys <- "ENTERPRISE#old"
+	keys <- "ENTERPRISE#new"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetch := func(context.Context) ([]byte, error) {
+		select {
+		case k := <-keys:
+			return []byte(k), nil
+		default:
+			return nil, errors.New("secret not found")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		refresh(ctx, fetch, f, 10*time.Millisecond)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(dst)
+		return string(data) == "ENTERPRISE#new"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// later failures keep the license
+	time.Sleep(30 * time.Millisecond)
+	data, err := os.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, "ENTERPRISE#new", string(data))
+
+	cancel()
+	<-done
+}
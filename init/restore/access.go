@@ -0,0 +1,196 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// containerUser is the user the Hazelcast container runs as, taken from the runAsUser, runAsGroup and
+// fsGroup of its securityContext. The agent often runs as another user, so a restore can succeed on
+// files Hazelcast then fails to open with EACCES. A nil user checks nothing.
+type containerUser struct {
+	uid  int
+	gids []int
+}
+
+// parseContainerUser parses the numeric -run-as uid:gid or uid and the -fs-group, it returns nil if
+// neither is set
+func parseContainerUser(runAs, fsGroup string) (*containerUser, error) {
+	if runAs == "" && fsGroup == "" {
+		return nil, nil
+	}
+	// the images of Hazelcast run as root if no runAsUser is set
+	u := &containerUser{}
+	if runAs != "" {
+		uid, gid, _ := strings.Cut(runAs, ":")
+		var err error
+		if u.uid, err = strconv.Atoi(uid); err != nil || u.uid < 0 {
+			return nil, fmt.Errorf("invalid run-as %q, expected numeric uid:gid or uid", runAs)
+		}
+		if gid != "" {
+			g, err := strconv.Atoi(gid)
+			if err != nil || g < 0 {
+				return nil, fmt.Errorf("invalid run-as %q, expected numeric uid:gid or uid", runAs)
+			}
+			u.gids = append(u.gids, g)
+		}
+	}
+	if fsGroup != "" {
+		g, err := strconv.Atoi(fsGroup)
+		if err != nil || g < 0 {
+			return nil, fmt.Errorf("invalid fs-group %q, expected a numeric gid", fsGroup)
+		}
+		u.gids = append(u.gids, g)
+	}
+	return u, nil
+}
+
+func (u *containerUser) String() string {
+	s := "uid " + strconv.Itoa(u.uid)
+	for _, g := range u.gids {
+		s += ", gid " + strconv.Itoa(g)
+	}
+	return s
+}
+
+// canWrite reports whether the user can read and write the file, folders also need to be searchable.
+// Files of unknown owners count as writable.
+func (u *containerUser) canWrite(info fs.FileInfo) bool {
+	need := fs.FileMode(06)
+	if info.IsDir() {
+		need = 07
+	}
+	return u.can(info, need)
+}
+
+// canRead reports whether the user can read the file, files of unknown owners count as readable
+func (u *containerUser) canRead(info fs.FileInfo) bool {
+	return u.can(info, 04)
+}
+
+// can reports whether the permission bits of the file grant the user the access in need
+func (u *containerUser) can(info fs.FileInfo, need fs.FileMode) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || u.uid == 0 {
+		return true
+	}
+	perm := info.Mode().Perm()
+	switch {
+	case int(st.Uid) == u.uid:
+		perm >>= 6
+	case u.inGroup(int(st.Gid)):
+		perm >>= 3
+	}
+	return perm&need == need
+}
+
+func (u *containerUser) inGroup(gid int) bool {
+	for _, g := range u.gids {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// accessError is returned if the Hazelcast container could not write restored files
+type accessError struct {
+	User *containerUser
+	// Files are the first files that are not writable, with their owner and mode
+	Files []string
+	// More counts the files that are not listed
+	More int
+	Hint string
+}
+
+func (e *accessError) Error() string {
+	more := ""
+	if e.More > 0 {
+		more = fmt.Sprintf(" and %d more", e.More)
+	}
+	return fmt.Sprintf("the Hazelcast container (%s) cannot write %s%s, %s", e.User, strings.Join(e.Files, ", "), more, e.Hint)
+}
+
+// Reason returns the reason reported in the termination message
+func (e *accessError) Reason() string {
+	return api.RestoreReasonDestinationNotWritable
+}
+
+// describe returns the path with its owner and mode, e.g. /data/x (owner 0:0, mode drwxr-xr-x)
+func describe(name string, info fs.FileInfo) string {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%s (owner %d:%d, mode %s)", name, st.Uid, st.Gid, info.Mode())
+	}
+	return fmt.Sprintf("%s (mode %s)", name, info.Mode())
+}
+
+// checkDestinationAccess fails before the restore if the container user cannot write the destination.
+// A destination that does not exist yet is created by the restore and not checked.
+func checkDestinationAccess(u *containerUser, dst string) error {
+	if u == nil {
+		return nil
+	}
+	info, err := os.Stat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.canWrite(info) {
+		return nil
+	}
+	return &accessError{User: u, Files: []string{describe(dst, info)},
+		Hint: "set the fsGroup of the pod to a group that can write the volume, or fix the permissions of the volume"}
+}
+
+// checkRestoredAccess fails after the restore if the container user cannot write a restored file or
+// folder in the hot-restart folders of dst. The size of the folders is recorded along the way.
+func checkRestoredAccess(u *containerUser, dst string, size *restoredSize) error {
+	if u == nil {
+		return nil
+	}
+	uuids, err := fileutil.FolderUUIDs(dst)
+	if err != nil {
+		return err
+	}
+	e := &accessError{User: u, Hint: "restore with -chown set to the uid:gid of the container, or with -chmod-dirs and -chmod-files granting the group access"}
+	var total int64
+	for _, d := range uuids {
+		err = filepath.Walk(filepath.Join(dst, d.Name()), func(name string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				total += info.Size()
+			}
+			// symlinks get the permissions of their target
+			if info.Mode()&fs.ModeSymlink != 0 || u.canWrite(info) {
+				return nil
+			}
+			if len(e.Files) < maxListedFiles {
+				e.Files = append(e.Files, describe(name, info))
+			} else {
+				e.More++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	size.set(total)
+	if len(e.Files) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,121 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func TestParseContainerUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		runAs   string
+		fsGroup string
+		want    *containerUser
+		wantErr bool
+	}{
+		{"none", "", "", nil, false},
+		{"uid and gid", "1000:2000", "", &containerUser{uid: 1000, gids: []int{2000}}, false},
+		{"uid", "65534", "", &containerUser{uid: 65534}, false},
+		{"fs group", "1000", "3000", &containerUser{uid: 1000, gids: []int{3000}}, false},
+		{"fs group only", "", "3000", &containerUser{uid: 0, gids: []int{3000}}, false},
+		{"name", "hazelcast", "", nil, true},
+		{"negative gid", "1000:-1", "", nil, true},
+		{"invalid fs group", "1000", "staff", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseContainerUser(tt.runAs, tt.fsGroup)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCanWrite(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	dir := t.TempDir()
+	name := filepath.Join(dir, "chunk")
+	require.Nil(t, os.WriteFile(name, nil, 0600))
+
+	tests := []struct {
+		name     string
+		uid, gid int
+		mode     os.FileMode
+		user     containerUser
+		want     bool
+	}{
+		{"owner", 1000, 1000, 0600, containerUser{uid: 1000}, true},
+		{"owner read only", 1000, 1000, 0400, containerUser{uid: 1000}, false},
+		{"other user", 0, 0, 0644, containerUser{uid: 1000, gids: []int{1000}}, false},
+		{"fs group", 0, 3000, 0660, containerUser{uid: 1000, gids: []int{3000}}, true},
+		{"group read only", 0, 3000, 0640, containerUser{uid: 1000, gids: []int{3000}}, false},
+		{"world writable", 0, 0, 0666, containerUser{uid: 1000}, true},
+		{"root", 1000, 1000, 0400, containerUser{uid: 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Nil(t, os.Chown(name, tt.uid, tt.gid))
+			require.Nil(t, os.Chmod(name, tt.mode))
+			info, err := os.Stat(name)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, tt.user.canWrite(info))
+		})
+	}
+
+	// folders also need to be searchable
+	require.Nil(t, os.Chown(dir, 1000, 1000))
+	require.Nil(t, os.Chmod(dir, 0600))
+	info, err := os.Stat(dir)
+	require.Nil(t, err)
+	require.False(t, (&containerUser{uid: 1000}).canWrite(info))
+	require.Nil(t, os.Chmod(dir, 0700))
+}
+
+func TestCheckAccess(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	dst := t.TempDir()
+	member := filepath.Join(dst, "00000000-0000-0000-0000-000000000001")
+	require.Nil(t, os.MkdirAll(filepath.Join(member, "s00"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(member, "s00", "0000000000000001.chunk"), []byte("data"), 0644))
+	user := &containerUser{uid: 1000, gids: []int{1000}}
+
+	require.Nil(t, checkDestinationAccess(nil, dst), "nothing is checked without a user")
+	require.Nil(t, checkDestinationAccess(user, filepath.Join(dst, "missing")))
+	require.Nil(t, checkRestoredAccess(nil, dst, &restoredSize{dir: dst}))
+
+	// the agent restored the files as root
+	err := checkDestinationAccess(user, dst)
+	var accessErr *accessError
+	require.True(t, errors.As(err, &accessErr), "Error is: ", err)
+	require.Equal(t, api.RestoreReasonDestinationNotWritable, failureReason(err))
+	require.Contains(t, err.Error(), "fsGroup")
+
+	err = checkRestoredAccess(user, dst, &restoredSize{dir: dst})
+	require.True(t, errors.As(err, &accessErr), "Error is: ", err)
+	require.Len(t, accessErr.Files, 3)
+	require.Contains(t, err.Error(), "-chown")
+
+	// a restore with -chown 1000:1000
+	require.Nil(t, os.Chown(dst, 0, 1000))
+	require.Nil(t, os.Chmod(dst, 0770))
+	require.Nil(t, filepath.Walk(member, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chown(name, 1000, 1000)
+	}))
+	require.Nil(t, checkDestinationAccess(user, dst))
+	size := &restoredSize{}
+	require.Nil(t, checkRestoredAccess(user, dst, size))
+	require.Equal(t, int64(4), size.bytes(), "the size is taken from the access check")
+}
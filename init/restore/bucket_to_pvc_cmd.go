@@ -2,30 +2,95 @@ package restore
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/google/subcommands"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
+	"gocloud.dev/blob"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/metrics"
+	"github.com/hazelcast/platform-operator-agent/internal/tty"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
 
 var bucketToPVCLog = logger.New().Named("restore_from_bucket_to_pvc")
 
 type BucketToPVCCmd struct {
-	Bucket      string `envconfig:"RESTORE_BUCKET"`
-	Destination string `envconfig:"RESTORE_DESTINATION"`
-	Hostname    string `envconfig:"RESTORE_HOSTNAME"`
-	SecretName  string `envconfig:"RESTORE_SECRET_NAME"`
-	RestoreID   string `envconfig:"RESTORE_ID"`
+	Bucket       string        `envconfig:"RESTORE_BUCKET"`
+	Destination  string        `envconfig:"RESTORE_DESTINATION"`
+	Hostname     string        `envconfig:"RESTORE_HOSTNAME"`
+	SecretName   string        `envconfig:"RESTORE_SECRET_NAME"`
+	Encryption   string        `envconfig:"RESTORE_ENCRYPTION_SECRET"`
+	RestoreID    string        `envconfig:"RESTORE_ID"`
+	MCURL        string        `envconfig:"RESTORE_MC_URL"`
+	MCToken      string        `envconfig:"RESTORE_MC_TOKEN"`
+	Timezone     string        `envconfig:"RESTORE_TIMEZONE"`
+	LockTTL      time.Duration `envconfig:"RESTORE_LOCK_TTL"`
+	ForceUnlock  bool          `envconfig:"RESTORE_FORCE_UNLOCK"`
+	Pushgateway  string        `envconfig:"RESTORE_PUSHGATEWAY_URL"`
+	Fallbacks    string        `envconfig:"RESTORE_FALLBACK_BUCKETS"`
+	Timestamp    string        `envconfig:"RESTORE_TIMESTAMP"`
+	BackupKey    string        `envconfig:"RESTORE_BACKUP_KEY"`
+	ClusterSize  int           `envconfig:"RESTORE_CLUSTER_SIZE"`
+	ScalePolicy  string        `envconfig:"RESTORE_SCALE_POLICY"`
+	AllowPartial bool          `envconfig:"RESTORE_ALLOW_PARTIAL"`
+	AllowExtra   bool          `envconfig:"RESTORE_ALLOW_EXTRA_MEMBERS"`
+	ClusterName  string        `envconfig:"RESTORE_CLUSTER_NAME"`
+	LockCluster  string        `envconfig:"RESTORE_LOCK_CLUSTER_NAME"`
+	HzVersion    string        `envconfig:"RESTORE_HAZELCAST_VERSION"`
+	Partitions   int           `envconfig:"RESTORE_PARTITION_COUNT"`
+	Force        bool          `envconfig:"RESTORE_FORCE"`
+	Report       bool          `envconfig:"RESTORE_REPORT"`
+	Workers      int           `envconfig:"RESTORE_DOWNLOAD_WORKERS"`
+	PartSize     int64         `envconfig:"RESTORE_DOWNLOAD_PART_SIZE"`
+	Retries      int           `envconfig:"RESTORE_DOWNLOAD_RETRIES"`
+	Version      string        `envconfig:"RESTORE_OBJECT_VERSION"`
+	Symlinks     string        `envconfig:"RESTORE_SYMLINKS"`
+	SkipSpace    bool          `envconfig:"RESTORE_SKIP_SPACE_CHECK"`
+	StatusAddr   string        `envconfig:"RESTORE_STATUS_ADDRESS"`
+	DirtyRatio   float64       `envconfig:"RESTORE_DIRTY_RATIO"`
+	Bandwidth    string        `envconfig:"RESTORE_MAX_BANDWIDTH"`
+	RetryMax     int           `envconfig:"RESTORE_RETRY_ATTEMPTS"`
+	RetryDelay   time.Duration `envconfig:"RESTORE_RETRY_BACKOFF"`
+	RetryCap     time.Duration `envconfig:"RESTORE_RETRY_MAX_BACKOFF"`
+	RetryJitter  float64       `envconfig:"RESTORE_RETRY_JITTER"`
+	CompleteFile string        `envconfig:"RESTORE_COMPLETE_FILE"`
+	SkipFiles    bool          `envconfig:"RESTORE_SKIP_FILE_CHECK"`
+	PreHook      string        `envconfig:"RESTORE_PRE_HOOK"`
+	PostHook     string        `envconfig:"RESTORE_POST_HOOK"`
+	HookTimeout  time.Duration `envconfig:"RESTORE_HOOK_TIMEOUT"`
+	HookFailure  string        `envconfig:"RESTORE_HOOK_FAILURE"`
+	ResultFile   string        `envconfig:"RESTORE_RESULT_FILE"`
+	ProgressLog  time.Duration `envconfig:"RESTORE_PROGRESS_LOG_INTERVAL"`
+	Payer        bool          `envconfig:"RESTORE_REQUESTER_PAYS"`
+	Billing      string        `envconfig:"RESTORE_BILLING_PROJECT"`
+	WriteWorkers int           `envconfig:"RESTORE_WRITE_WORKERS"`
+	Chown        string        `envconfig:"RESTORE_CHOWN"`
+	ChmodDirs    string        `envconfig:"RESTORE_CHMOD_DIRS"`
+	ChmodFiles   string        `envconfig:"RESTORE_CHMOD_FILES"`
+	Namespace    string        `envconfig:"RESTORE_NAMESPACE"`
+	RunAs        string        `envconfig:"RESTORE_RUN_AS"`
+	FSGroup      string        `envconfig:"RESTORE_FS_GROUP"`
+	KeepExisting bool          `envconfig:"RESTORE_KEEP_EXISTING"`
+	ErrorBudget  int           `envconfig:"RESTORE_ERROR_BUDGET"`
+	Migrate      bool          `envconfig:"RESTORE_MIGRATE_LAYOUT"`
+	Migrations   string        `envconfig:"RESTORE_LAYOUT_MIGRATIONS"`
+	SourceFormat string        `envconfig:"RESTORE_SOURCE_FORMAT"`
+	ImportDir    string        `envconfig:"RESTORE_IMPORT_DIR"`
+	ControlChown string        `envconfig:"RESTORE_CONTROL_CHOWN"`
+	ControlChmod string        `envconfig:"RESTORE_CONTROL_CHMOD"`
 }
 
 func (*BucketToPVCCmd) Name() string     { return "restore_pvc" }
@@ -39,17 +104,119 @@ func (r *BucketToPVCCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.Bucket, "src", "", "src bucket path")
 	f.StringVar(&r.Destination, "dst", "/data/persistence/backup", "dst filesystem path")
 	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the bucket credentials")
+	f.BoolVar(&r.Payer, "requester-pays", false, "accept the charges of requester-pays S3 and GCS buckets, e.g. a shared DR bucket of another account")
+	f.StringVar(&r.Billing, "billing-project", "", "GCP project billed for the requests to requester-pays GCS buckets, the project of the credentials if empty")
+	f.StringVar(&r.Encryption, "encryption-secret", "", "secret name for the key of encrypted backups")
+	f.StringVar(&r.MCURL, "mc-url", "", "management center endpoint for restore events")
+	f.StringVar(&r.MCToken, "mc-token", "", "management center endpoint token")
+	f.StringVar(&r.Timezone, "timezone", "UTC", "time zone of backup folder names without zone offset")
+	f.DurationVar(&r.LockTTL, "lock-ttl", 0, "age after which a restore lock is stale, 0 means locks never expire")
+	f.BoolVar(&r.ForceUnlock, "force-unlock", false, "remove an existing restore lock and restore again")
+	f.StringVar(&r.Pushgateway, "pushgateway-url", "", "prometheus pushgateway for restore metrics")
+	f.StringVar(&r.Timestamp, "backup-timestamp", "", "dated backup folder to restore, e.g. 2006-01-02-15-04-05, the latest one if empty")
+	f.StringVar(&r.BackupKey, "backup-key", "", "archive to restore regardless of the member index, e.g. 2006-01-02-15-04-05/<uuid>.tar.gz, selected by index if empty")
+	f.IntVar(&r.ClusterSize, "cluster-size", 0, "number of members restored, a backup with another number of member archives is handled by -scale-policy, 0 skips the check")
+	f.StringVar(&r.ScalePolicy, "scale-policy", scaleReject, "backups of another cluster size: reject, or merge to restore every archive once, member i restoring archives i, i+size, ...")
+	f.BoolVar(&r.AllowPartial, "allow-partial", false, "restore from a backup folder that misses the archives of members whose upload failed")
+	f.BoolVar(&r.AllowExtra, "allow-extra-members", false, "members beyond the archives of the backup skip the restore instead of failing, e.g. after a scale-up")
+	f.StringVar(&r.ClusterName, "cluster-name", "", "cluster name the backup manifest must match, not checked if empty")
+	f.StringVar(&r.LockCluster, "lock-cluster-name", "", "name of the Hazelcast cluster recorded in the restore lock, locks of other clusters are stale")
+	f.StringVar(&r.Namespace, "namespace", os.Getenv("POD_NAMESPACE"), "namespace of the Hazelcast cluster recorded in the restore lock, locks of other clusters are stale")
+	f.StringVar(&r.HzVersion, "hazelcast-version", "", "Hazelcast version of the cluster, the backup manifest must have the same minor version, not checked if empty")
+	f.BoolVar(&r.Migrate, "migrate-layout", false, "restore backups of older minor versions than -hazelcast-version, or $HZ_VERSION if empty, and migrate their hot-restart layout to it")
+	f.StringVar(&r.Migrations, "layout-migrations", "", "JSON file with layout migration steps in addition to the built-in ones, used with -migrate-layout")
+	f.StringVar(&r.SourceFormat, "source-format", sourceHotRestart, "format of the backups in src: hot-restart archives, or export for snapshots of the data export tools with an export file per map")
+	f.StringVar(&r.ImportDir, "import-dir", "/data/import", "folder the export files are placed into with -source-format export, for the cluster to import the maps from")
+	f.IntVar(&r.Partitions, "partition-count", 0, "partition count the backup manifest must match, 0 skips the check")
+	f.BoolVar(&r.Force, "force", false, "restore a backup whose manifest does not match the cluster")
+	f.BoolVar(&r.Report, "report", false, "upload a report of a successful restore to reports/ in the bucket")
+	f.IntVar(&r.Workers, "download-workers", 0, "parallel ranged reads into a resumable staging file, 0 streams the archive")
+	f.Int64Var(&r.PartSize, "download-part-size", defaultPartSize, "size of a ranged read in bytes")
+	f.IntVar(&r.Retries, "download-retries", 3, "number of retries of a failed ranged read")
+	f.StringVar(&r.Version, "object-version", "", "version ID of the archive in a versioned bucket, the latest version if empty")
+	f.StringVar(&r.Symlinks, "symlinks", symlinkSkip, "symlink entries of the archive: skip, allow (only into the destination) or deny")
+	f.BoolVar(&r.SkipSpace, "skip-space-check", false, "restore without checking the free space of the destination first")
+	f.BoolVar(&r.SkipFiles, "skip-file-check", false, "restore without verifying the extracted files against the file manifest of the backup")
+	f.StringVar(&r.StatusAddr, "status-address", "", "address of the listener serving the restore progress on /restore/status, e.g. :8080, disabled if empty")
+	f.IntVar(&r.WriteWorkers, "write-workers", 4, "files of the archive written in parallel, e.g. more for network volumes with a high latency, 1 writes one file after the other")
+	f.StringVar(&r.Chown, "chown", "", "numeric uid:gid, uid or :gid the restored files and folders are owned by, e.g. 65534:65534, the owner of the archive if empty")
+	f.StringVar(&r.ChmodDirs, "chmod-dirs", "", "octal permissions of the restored folders, e.g. 0750, the mode of the archive if empty")
+	f.StringVar(&r.ChmodFiles, "chmod-files", "", "octal permissions of the restored files, e.g. 0640, the mode of the archive if empty")
+	f.StringVar(&r.ControlChown, "control-chown", "", "numeric uid:gid, uid or :gid the restore lock, completion, result, metadata marker and staging progress files are owned by, e.g. 65534:65534, the user of the agent if empty")
+	f.StringVar(&r.ControlChmod, "control-chmod", "", "octal permissions of the restore lock, completion, result, metadata marker and staging progress files, e.g. 0640, 0600 for the lock and the staging progress and 0644 for the others if empty")
+	f.StringVar(&r.RunAs, "run-as", "", "numeric runAsUser:runAsGroup or runAsUser of the Hazelcast container, the destination and the restored files are checked to be writable by it if set")
+	f.StringVar(&r.FSGroup, "fs-group", "", "numeric fsGroup of the pod, a group the Hazelcast container writes the destination with")
+	f.BoolVar(&r.KeepExisting, "keep-existing", false, "keep the existing hot-restart folders in place until the archives are extracted and verified next to them, they are only replaced once the restore succeeded")
+	f.IntVar(&r.ErrorBudget, "error-budget", 0, "archive entries that may be lost, failed entries are read again from the archive and only fail the restore if more than this many cannot be restored, 0 fails on the first broken entry")
+	f.Float64Var(&r.DirtyRatio, "dirty-ratio", 0.25, "part of the container memory limit that extracted data not written to disk yet may use before writes are paced, 0 disables pacing")
+	f.StringVar(&r.Bandwidth, "max-bandwidth", "", "maximum download bandwidth per second shared by all parts, e.g. 50MiB, empty means unlimited")
+	f.IntVar(&r.RetryMax, "retry-attempts", 5, "attempts of a bucket operation that fails with a transient error, e.g. throttling")
+	f.DurationVar(&r.RetryDelay, "retry-backoff", time.Second, "delay before the first retry of a bucket operation, it doubles with every retry")
+	f.DurationVar(&r.RetryCap, "retry-max-backoff", 30*time.Second, "maximum delay between two retries of a bucket operation")
+	f.Float64Var(&r.RetryJitter, "retry-jitter", 0.2, "fraction by which the retry delays are randomized")
+	f.StringVar(&r.CompleteFile, "complete-file", defaultCompleteFile, "file written into dst once the restore succeeded, for the Hazelcast entrypoint to wait on, disabled if empty")
+	f.StringVar(&r.ResultFile, "result-file", defaultResultFile, "file in dst the outcome of the restore is written to as JSON when the agent exits, disabled if empty")
+	f.StringVar(&r.PreHook, "pre-hook", "", "command run before the restore, e.g. \"sh -c 'systemctl stop node-cache'\", none if empty")
+	f.StringVar(&r.PostHook, "post-hook", "", "command run after the restore, before the restore lock is written, HOOK_RESULT is succeeded or failed, none if empty")
+	f.DurationVar(&r.HookTimeout, "hook-timeout", 5*time.Minute, "time after which a hook is killed, 0 means no limit")
+	f.StringVar(&r.HookFailure, "hook-failure", hookFail, "failing hooks: fail the restore, or warn and continue")
+	f.DurationVar(&r.ProgressLog, "progress-log-interval", 30*time.Second, "interval of the progress log lines when stdout is not a terminal, a terminal shows progress bars, 0 disables the lines")
+	f.StringVar(&r.Fallbacks, "fallback-src", "", "comma separated bucket paths tried in order when src is not reachable")
 }
 
-func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (r *BucketToPVCCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
 	bucketToPVCLog.Info("starting restore agent...")
 
+	start := time.Now()
+	var used, reason string
+	size := &restoredSize{dir: r.Destination}
+	defer func() { writeRestoreSummary(r.Name(), status, start, used, size, reason) }()
+
 	// overwrite config with environment variables
-	if err := envconfig.Process("restore", r); err != nil {
+	if err := config.Process("restore", r, f); err != nil {
 		bucketToPVCLog.Error("an error occurred while processing config from env: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
+	progress := newRestoreProgress()
+	// parsed with the other options, the result of invalid options is written with the defaults
+	var control *ownership
+	// registered first, so that it runs once the final phase is set
+	defer func() {
+		res := newRestoreResult(status, progress.snapshot(), start, size, reason)
+		res.RestoreID, res.Hostname = r.RestoreID, r.Hostname
+		writeResult(bucketToPVCLog, destinationFile(r.Destination, r.ResultFile), res, control)
+	}()
+	if r.StatusAddr != "" {
+		// the status is for monitoring only, the restore runs without it
+		stop, err := serveStatus(r.StatusAddr, progress)
+		if err != nil {
+			bucketToPVCLog.Warn("could not start status listener: " + err.Error())
+		} else {
+			defer stop()
+			bucketToPVCLog.Info("serving restore status", zap.String("address", r.StatusAddr))
+		}
+	}
+	bars := tty.New(os.Stdout, bucketToPVCLog, r.ProgressLog)
+	defer bars.Add("download", func() (int64, int64) {
+		s := progress.snapshot()
+		return s.BytesDownloaded, s.BytesTotal
+	})()
+	// the size of the extracted files is not known before the archive is read
+	defer bars.Add("extract", func() (int64, int64) { return progress.snapshot().BytesExtracted, 0 })()
+	defer func() { progress.setPhase(finalPhase(status, progress.snapshot().Phase)) }()
+
+	// the reported bucket is the one the backup was restored from
+	used = r.Bucket
+	events := mancenter.New(r.MCURL, r.MCToken)
+	reportRestore(ctx, events, mancenter.Started, r.Bucket)
+	defer func() { reportRestoreStatus(ctx, events, status, used) }()
+
+	pusher := metrics.NewPusher(r.Pushgateway, "hazelcast_restore")
+	defer func() {
+		pushRestoreMetrics(ctx, pusher, r.Hostname, status, start, size, progress.snapshot(), reason)
+	}()
+
 	if !hostnameRE.MatchString(r.Hostname) {
 		bucketToPVCLog.Error("invalid hostname, need to conform to statefulset naming scheme")
 		return subcommands.ExitFailure
@@ -61,83 +228,398 @@ func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...inte
 	}
 	bucketToPVCLog.Info("agent id parse successfully", zap.Int("agent id", id))
 
-	bucketURI, err := uri.NormalizeURI(r.Bucket)
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		bucketToPVCLog.Error("invalid time zone: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if r.RetryJitter < 0 || r.RetryJitter > 1 {
+		bucketToPVCLog.Error("retry jitter must be between 0 and 1")
+		return subcommands.ExitFailure
+	}
+
+	if r.DirtyRatio < 0 || r.DirtyRatio >= 1 {
+		bucketToPVCLog.Error("dirty ratio must be at least 0 and less than 1")
+		return subcommands.ExitFailure
+	}
+
+	bandwidth, err := bucket.ParseBandwidth(r.Bandwidth)
+	if err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = validSymlinkPolicy(r.Symlinks); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	owner, err := parseOwnership(r.Chown, r.ChmodDirs, r.ChmodFiles)
+	if err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	user, err := parseContainerUser(r.RunAs, r.FSGroup)
+	if err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if control, err = parseControlOwnership(r.ControlChown, r.ControlChmod); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if r.ClusterSize < 0 || r.Partitions < 0 {
+		bucketToPVCLog.Error("cluster size and partition count must not be negative")
+		return subcommands.ExitFailure
+	}
+
+	if err = validScalePolicy(r.ScalePolicy); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = validHookPolicy(r.HookFailure); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+	preHook, err := newHook(hookPre, r.PreHook, r.HookTimeout, r.HookFailure)
+	if err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+	postHook, err := newHook(hookPost, r.PostHook, r.HookTimeout, r.HookFailure)
 	if err != nil {
+		bucketToPVCLog.Error(err.Error())
 		return subcommands.ExitFailure
 	}
-	bucketToPVCLog.Info("bucket uri normalized successfully", zap.String("bucket URI", bucketURI))
+
+	if err = validSourceFormat(r.SourceFormat); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+	if r.SourceFormat == sourceExport && r.BackupKey != "" {
+		bucketToPVCLog.Error("backup key is not supported for exported snapshots, select them by backup timestamp")
+		return subcommands.ExitFailure
+	}
+
+	var migration *layoutMigration
+	if r.Migrate {
+		// the image of the Hazelcast container names its version, the migration target can default to it
+		if r.HzVersion == "" {
+			r.HzVersion = os.Getenv("HZ_VERSION")
+		}
+		if migration, err = newLayoutMigration(r.HzVersion, r.Migrations); err != nil {
+			bucketToPVCLog.Error(err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	sel := backupSelector{Location: loc, ClusterSize: r.ClusterSize, ScalePolicy: r.ScalePolicy, AllowPartial: r.AllowPartial, AllowExtraMembers: r.AllowExtra}
+	if r.Timestamp != "" {
+		sel.At, err = fileutil.ParseFolderTime(r.Timestamp, loc)
+		if err != nil {
+			bucketToPVCLog.Error("invalid backup timestamp, expected " + fileutil.FolderTimeFormat + ": " + err.Error())
+			return subcommands.ExitFailure
+		}
+		bucketToPVCLog.Info("restoring backup by timestamp", zap.String("timestamp", r.Timestamp))
+	}
+	if r.BackupKey != "" {
+		if r.Timestamp != "" {
+			bucketToPVCLog.Error("backup key and backup timestamp are mutually exclusive")
+			return subcommands.ExitFailure
+		}
+		key, ok := archive.Key(strings.TrimPrefix(r.BackupKey, "/"))
+		if !ok {
+			bucketToPVCLog.Error("invalid backup key, expected an archive like 2006-01-02-15-04-05/<uuid>.tar.gz: " + r.BackupKey)
+			return subcommands.ExitFailure
+		}
+		sel.Key = key
+		bucketToPVCLog.Info("restoring backup by key", zap.String("key", key))
+	}
+
+	var bucketURIs []string
+	for _, b := range r.buckets() {
+		bucketURI, err := uri.NormalizeURI(b)
+		if err != nil {
+			return subcommands.ExitFailure
+		}
+		bucketToPVCLog.Info("bucket uri normalized successfully", zap.String("bucket URI", bucketURI))
+		bucketURIs = append(bucketURIs, bucketURI)
+	}
 
 	lock := filepath.Join(r.Destination, lockFileName(r.RestoreID, id))
+	complete := destinationFile(r.Destination, r.CompleteFile)
 
-	if _, err = os.Stat(lock); err == nil || os.IsExist(err) {
+	controlFiles := append([]string{lock, complete, destinationFile(r.Destination, r.ResultFile), filepath.Join(r.Destination, metadataReadyFile)}, stagingProgressFiles(r.Destination)...)
+	unreadable, err := prepareControlFiles(user, control, controlFiles...)
+	if err != nil {
+		bucketToPVCLog.Error("error preparing control files: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if len(unreadable) > 0 {
+		bucketToPVCLog.Warn("the Hazelcast container cannot read the control files, set -control-chown or -control-chmod", zap.Strings("files", unreadable))
+	}
+
+	locked, err := isLocked(bucketToPVCLog, lock, lockPolicy{TTL: r.LockTTL, Force: r.ForceUnlock, Cluster: r.LockCluster, Namespace: r.Namespace})
+	if err != nil {
+		bucketToPVCLog.Error("error reading restore lock: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if locked {
 		// If restore lock exists exit
 		bucketToPVCLog.Info("restore lock exists, exiting")
+		if err = ensureComplete(complete, r.Destination, restoreComplete{RestoreID: r.RestoreID, Hostname: r.Hostname}, control); err != nil {
+			bucketToPVCLog.Error("error writing restore completion file: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		progress.setPhase(api.RestorePhaseSkipped)
 		return subcommands.ExitSuccess
 	}
+	// the member must not start on the data while it is replaced
+	if err = removeComplete(complete); err != nil {
+		bucketToPVCLog.Error("error removing restore completion file: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = checkDestinationAccess(user, r.Destination); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		progress.addError(err.Error())
+		reason = failureReason(err)
+		return subcommands.ExitFailure
+	}
+
+	// events are still reported after a termination signal stopped the restore
+	rctx, stop := withSignals(ctx, bucketToPVCLog)
+	defer stop()
+
+	// the hooks only run if the member is restored, the post hook also learns about failures
+	if err = preHook.run(rctx, r.hookEnv(hookPre, "", "")); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+	postDone := false
+	defer func() {
+		if !postDone && status != subcommands.ExitSuccess {
+			// the restore failed anyway, the outcome of the hook changes nothing
+			_ = postHook.run(ctx, r.hookEnv(hookPost, hookFailed, ""))
+		}
+	}()
 
 	bucketToPVCLog.Info("reading secret", zap.String("secret name", r.SecretName))
-	secretData, err := bucket.SecretData(ctx, r.SecretName)
+	secretData, err := bucket.SecretData(rctx, r.SecretName)
 	if err != nil {
 		bucketToPVCLog.Error("error fetching secret data: " + err.Error())
 		return subcommands.ExitFailure
 	}
+	if r.Payer || r.Billing != "" {
+		bucketToPVCLog.Info("accepting requester-pays charges", zap.String("billing project", r.Billing))
+		secretData = bucket.WithRequesterPays(secretData, r.Billing)
+	}
+
+	var encryptionKey []byte
+	if r.Encryption != "" {
+		bucketToPVCLog.Info("reading encryption key", zap.String("secret name", r.Encryption))
+		if encryptionKey, err = bucket.EncryptionKey(rctx, r.Encryption); err != nil {
+			bucketToPVCLog.Error("error reading encryption key: " + err.Error())
+			return subcommands.ExitFailure
+		}
+	}
 
 	// run download process
 	bucketToPVCLog.Info("Starting download:", zap.Int(r.Destination, id))
-	if err = downloadFromBucketToPvc(ctx, bucketURI, r.Destination, id, secretData); err != nil {
+	if r.Version != "" {
+		bucketToPVCLog.Info("restoring pinned archive version", zap.String("version", r.Version))
+	}
+	opts := downloadOptions{Workers: r.Workers, PartSize: r.PartSize, Retries: r.Retries, StagingDir: r.Destination, Version: r.Version, Symlinks: r.Symlinks, SkipSpaceCheck: r.SkipSpace, Progress: progress, DirtyRatio: r.DirtyRatio,
+		Retry:  bucket.Retry{Attempts: r.RetryMax, Backoff: r.RetryDelay, MaxBackoff: r.RetryCap, Jitter: r.RetryJitter, Retried: progress.retryCounter()},
+		Expect: &clusterExpectation{ClusterName: r.ClusterName, Version: r.HzVersion, PartitionCount: r.Partitions, Force: r.Force, Upgrade: r.Migrate}, EncryptionKey: encryptionKey, Throttle: bucket.NewThrottle(bandwidth), SkipFileCheck: r.SkipFiles, WriteWorkers: r.WriteWorkers, Owner: owner, KeepExisting: r.KeepExisting,
+		Control: control, Budget: newErrorBudget(r.ErrorBudget), Migration: migration}
+	var res restoreResult
+	if r.SourceFormat == sourceExport {
+		bucketToPVCLog.Info("restoring exported snapshot", zap.String("import dir", r.ImportDir))
+		res, err = downloadExport(rctx, bucketURIs, r.ImportDir, secretData, sel, opts)
+	} else {
+		res, err = downloadFromBucketToPvc(rctx, bucketURIs, r.Destination, id, secretData, sel, opts)
+	}
+	if err != nil {
 		bucketToPVCLog.Error("download error: " + err.Error())
+		progress.addError(err.Error())
+		reason = failureReason(err)
 		return subcommands.ExitFailure
 	}
+	used = res.Bucket
+	if res.Extra {
+		progress.setPhase(api.RestorePhaseSkipped)
+	}
 
-	if err = cleanupLocks(r.Destination, id); err != nil {
+	if err = checkRestoredAccess(user, r.Destination, size); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		progress.addError(err.Error())
+		reason = failureReason(err)
+		return subcommands.ExitFailure
+	}
+
+	if err = cleanupLocks(r.Destination, id, lockFileName(r.RestoreID, id)); err != nil {
 		bucketToPVCLog.Error("error cleaning up locks: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
-	if err = os.WriteFile(lock, []byte{}, 0600); err != nil {
+	// a failing post hook leaves the member unlocked, so that the next attempt restores again
+	postDone = true
+	if err = postHook.run(rctx, r.hookEnv(hookPost, hookSucceeded, res.Key)); err != nil {
+		bucketToPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = writeLock(lock, lockInfo{RestoreID: r.RestoreID, Hostname: r.Hostname, Cluster: r.LockCluster, Namespace: r.Namespace}, control); errors.Is(err, errLockConflict) {
+		bucketToPVCLog.Error("another agent restored the same member: " + err.Error())
+		return subcommands.ExitFailure
+	} else if err != nil {
 		bucketToPVCLog.Error("lock file creation error: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
-	bucketToPVCLog.Info("restore successful")
+	if err = writeComplete(complete, r.Destination, restoreComplete{RestoreID: r.RestoreID, Hostname: r.Hostname, Key: res.Key}, control); err != nil {
+		bucketToPVCLog.Error("error writing restore completion file: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if r.Report && !res.Extra {
+		rep := newRestoreReport(r.RestoreID, r.Hostname, res, start, size.bytes())
+		// the report is for monitoring only, the restore itself succeeded
+		if err = uploadReport(ctx, used, secretData, rep); err != nil {
+			bucketToPVCLog.Warn("could not upload restore report: " + err.Error())
+		}
+	}
+
+	bucketToPVCLog.Info("restore successful", zap.String("bucket URI", used))
 	return subcommands.ExitSuccess
 }
 
-func downloadFromBucketToPvc(ctx context.Context, src, dst string, id int, secretData map[string][]byte) error {
-	b, err := bucket.OpenBucket(ctx, src, secretData)
-	if err != nil {
-		return err
+// hookEnv returns the variables describing the restore to a hook
+func (r *BucketToPVCCmd) hookEnv(phase, result, key string) []string {
+	env := []string{
+		"HOOK_PHASE=" + phase,
+		"HOOK_DESTINATION=" + r.Destination,
+		"HOOK_HOSTNAME=" + r.Hostname,
+		"HOOK_RESTORE_ID=" + r.RestoreID,
 	}
-	defer b.Close()
+	if result != "" {
+		env = append(env, "HOOK_RESULT="+result)
+	}
+	if key != "" {
+		env = append(env, "HOOK_BACKUP_KEY="+key)
+	}
+	return env
+}
 
-	// find keys, they are sorted
-	keys, err := find(ctx, b)
-	if err != nil {
-		return err
+// buckets returns the source bucket followed by the fallbacks
+func (r *BucketToPVCCmd) buckets() []string {
+	buckets := []string{r.Bucket}
+	for _, b := range strings.Split(r.Fallbacks, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			buckets = append(buckets, b)
+		}
 	}
+	return buckets
+}
+
+// restoreResult describes where a backup was restored from
+type restoreResult struct {
+	Bucket string
+	Key    string
+	// Merged are the archives restored in addition to Key into a smaller cluster
+	Merged []string
+	// Extra is set for a member beyond the archives of the backup, nothing was restored
+	Extra bool
+	// Errors of the buckets that failed before the one that was used
+	Errors []string
+}
 
-	if id >= len(keys) {
-		return fmt.Errorf("member index %d is greater than number of archived backup files %d", id, len(keys))
+// downloadFromBucketToPvc restores from the first reachable bucket with backups
+func downloadFromBucketToPvc(ctx context.Context, srcs []string, dst string, id int, secretData map[string][]byte, sel backupSelector, opts downloadOptions) (restoreResult, error) {
+	var res restoreResult
+	var b *blob.Bucket
+	var keys []string
+	src, err := bucket.Failover(ctx, srcs, func(src string) error {
+		var err error
+		b, keys, err = openBackups(ctx, src, secretData, sel, opts.Retry)
+		if err != nil {
+			res.Errors = append(res.Errors, logger.Redact(src)+": "+err.Error())
+			opts.Progress.addError(logger.Redact(src) + ": " + err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return res, err
 	}
+	defer b.Close()
+	res.Bucket = src
 
-	// find backup UUIDs, they are sorted
-	hotRestartUUIDs, err := fileutil.FolderUUIDs(dst)
+	if sel.Key != "" {
+		// the named archive is the only key, it is restored whatever the member index
+		keys, id = keys[:1], 0
+	}
+	member, err := memberKeys(keys, id, sel)
+	if errors.Is(err, errExtraMember) {
+		bucketToPVCLog.Info("member is beyond the archives of the backup, skipping restore", zap.Int("member", id), zap.Int("archives", len(keys)))
+		res.Extra = true
+		return res, nil
+	}
 	if err != nil {
-		return err
+		return res, err
+	}
+	keys = member
+	if len(keys) == 0 {
+		// a member added after the backup starts with empty hot-restart folders
+		bucketToPVCLog.Warn("no archive left for this member, it starts empty", zap.Int("member", id), zap.Int("cluster size", sel.ClusterSize))
+	} else {
+		res.Key, res.Merged = keys[0], keys[1:]
+	}
+	if len(res.Merged) > 0 {
+		bucketToPVCLog.Warn("restoring the archives of a larger cluster", zap.Strings("keys", keys), zap.Int("cluster size", sel.ClusterSize))
 	}
 
-	// Remove the hot-restart folder at the destination
-	for _, uuid := range hotRestartUUIDs {
-		err = os.RemoveAll(path.Join(dst, uuid.Name()))
-		if err != nil {
-			return err
+	if !opts.SkipSpaceCheck && len(keys) > 0 {
+		if err = checkSpace(ctx, b, keys, dst, opts); err != nil {
+			return res, err
 		}
 	}
 
-	bucketToPVCLog.Info("restoring ", zap.String("key", keys[id]))
-	if err = saveFromArchive(ctx, b, keys[id], dst); err != nil {
-		return err
+	// a marker left by an interrupted restore names a folder that no longer exists
+	opts.MetadataMarker = filepath.Join(dst, metadataReadyFile)
+	removeMarker(opts.MetadataMarker)
+	defer removeMarker(opts.MetadataMarker)
+
+	opts.Progress.setPhase(api.RestorePhaseDownloading)
+	err = restoreInto(dst, opts.KeepExisting, func(tmp string) error {
+		for _, key := range keys {
+			bucketToPVCLog.Info("restoring ", zap.String("key", key))
+			opts.Progress.setArchive(src, key)
+			if err := saveFromArchive(ctx, b, key, tmp, opts); err != nil {
+				return err
+			}
+		}
+		return opts.Migration.migrate(tmp)
+	})
+	return res, err
+}
+
+// openBackups opens the bucket and finds the backup keys, they are sorted
+func openBackups(ctx context.Context, src string, secretData map[string][]byte, sel backupSelector, retry bucket.Retry) (*blob.Bucket, []string, error) {
+	b, err := bucket.OpenBucket(ctx, src, secretData)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	keys, err := find(ctx, b, sel, retry)
+	if err != nil {
+		b.Close()
+		return nil, nil, err
+	}
+	return b, keys, nil
 }
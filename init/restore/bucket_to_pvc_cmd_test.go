@@ -2,15 +2,22 @@ package restore
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gocloud.dev/blob/fileblob"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
 var exampleTarGzFiles = []fileutil.File{
@@ -55,7 +62,7 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 		{"mixed keys",
 			[]string{
 				"00000000-0000-0000-0000-000000000001",
-				"00000000-0000-0000-0000-000000000002.tar",
+				"00000000-0000-0000-0000-000000000002.tar.bz2",
 				"00000000-0000-0000-0000-000000000003.tar.gz",
 				"00000000-0000-0000-0000-000000000004.tar.gz",
 			},
@@ -113,7 +120,7 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 
 			// test
 
-			err = downloadFromBucketToPvc(ctx, "file://"+bucketPath, dstPath, tt.id, nil)
+			_, err = downloadFromBucketToPvc(ctx, []string{"file://" + bucketPath}, dstPath, tt.id, nil, backupSelector{Location: time.UTC}, downloadOptions{})
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -136,3 +143,200 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadFromBucketToPVCFailover(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_failover")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+
+	// the primary bucket is empty, the mirror has the backup
+	primary := path.Join(tmpdir, "primary")
+	require.Nil(t, os.MkdirAll(primary, 0700))
+	mirror := path.Join(tmpdir, "mirror")
+	uuid := "00000000-0000-0000-0000-000000000001"
+	require.Nil(t, createArchiveFile(archiveDir, uuid, path.Join(mirror, "2006-01-02-15-04-01", uuid+".tar.gz")))
+
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, os.MkdirAll(dst, 0700))
+
+	res, err := downloadFromBucketToPvc(ctx, []string{"file://" + primary, "file://" + mirror}, dst, 0, nil, backupSelector{Location: time.UTC}, downloadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "file://"+mirror, res.Bucket)
+	require.Equal(t, "2006-01-02-15-04-01/"+uuid+".tar.gz", res.Key)
+	require.Len(t, res.Errors, 1)
+	require.DirExists(t, path.Join(dst, uuid, "cluster"))
+}
+
+func TestDownloadFromBucketToPVCKey(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_key")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+
+	// the older backup of the first member is restored by the third member
+	src := path.Join(tmpdir, "bucket")
+	uuids := []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+	for _, folder := range []string{"2006-01-02-15-04-01", "2006-01-02-15-04-02"} {
+		for _, uuid := range uuids {
+			require.Nil(t, createArchiveFile(archiveDir, uuid, path.Join(src, folder, uuid+".tar.gz")))
+		}
+	}
+
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, os.MkdirAll(dst, 0700))
+
+	key := "2006-01-02-15-04-01/" + uuids[0] + ".tar.gz"
+	res, err := downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 2, nil, backupSelector{Location: time.UTC, Key: key}, downloadOptions{WriteWorkers: 4})
+	require.Nil(t, err)
+	require.Equal(t, key, res.Key)
+	require.DirExists(t, path.Join(dst, uuids[0], "cluster"))
+}
+
+func TestFileBucket(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_file_bucket")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// the sidecar backs up to a directory, e.g. on an NFS-backed volume
+	uuid := "00000000-0000-0000-0000-000000000001"
+	backupsDir := path.Join(tmpdir, "backup", sidecar.DirName)
+	require.Nil(t, fileutil.CreateFiles(path.Join(backupsDir, "backup-1659034855438", uuid), exampleTarGzFiles, true))
+	src := path.Join(tmpdir, "bucket")
+	require.Nil(t, os.MkdirAll(src, 0700))
+
+	bucketURI, err := uri.NormalizeURI("file://" + src + "/")
+	require.Nil(t, err)
+	require.Equal(t, "file://"+src, bucketURI)
+	b, err := bucket.OpenBucket(ctx, bucketURI, nil)
+	require.Nil(t, err)
+	key, err := sidecar.UploadBackup(ctx, b, backupsDir, "hazelcast", 0)
+	require.Nil(t, err)
+	require.Nil(t, b.Close())
+	require.FileExists(t, path.Join(src, key))
+
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, os.MkdirAll(dst, 0700))
+	res, err := downloadFromBucketToPvc(ctx, []string{bucketURI + "?prefix=hazelcast/"}, dst, 0, nil, backupSelector{Location: time.UTC}, downloadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, strings.TrimPrefix(key, "hazelcast/"), res.Key)
+	require.DirExists(t, path.Join(dst, uuid, "cluster"))
+}
+
+func TestDownloadFromBucketToPVCDirectory(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_directory")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// the hot-restart folders are synced to the bucket without an archive
+	src := path.Join(tmpdir, "bucket")
+	uuids := []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+	for _, uuid := range uuids {
+		require.Nil(t, fileutil.CreateFiles(path.Join(src, "2006-01-02-15-04-01", uuid), exampleTarGzFiles, true))
+		require.Nil(t, os.WriteFile(path.Join(src, "2006-01-02-15-04-01", uuid, "s00/value/01/0000000000000001.chunk"), []byte(uuid), 0600))
+	}
+
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, os.MkdirAll(dst, 0700))
+	progress := &restoreProgress{}
+	res, err := downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 1, nil, backupSelector{Location: time.UTC}, downloadOptions{Progress: progress, Retries: 1})
+	require.Nil(t, err)
+	require.Equal(t, "2006-01-02-15-04-01/"+uuids[1]+"/", res.Key)
+	// empty folders are not stored as objects
+	for _, f := range exampleTarGzFiles {
+		if !f.IsDir {
+			require.FileExists(t, path.Join(dst, uuids[1], f.Name))
+		}
+	}
+	data, err := os.ReadFile(path.Join(dst, uuids[1], "s00/value/01/0000000000000001.chunk"))
+	require.Nil(t, err)
+	require.Equal(t, uuids[1], string(data))
+	require.NoDirExists(t, path.Join(dst, uuids[0]))
+	s := progress.snapshot()
+	require.Equal(t, int64(len(uuids[1])), s.BytesDownloaded)
+	require.Equal(t, s.BytesDownloaded, s.BytesExtracted)
+}
+
+func TestDownloadFromBucketToPVCFileManifest(t *testing.T) {
+	uuid := "00000000-0000-0000-0000-000000000001"
+	tests := []struct {
+		name      string
+		manifest  func(t *testing.T, dir string) []string
+		skipCheck bool
+		wantErr   bool
+	}{
+		{"files match", func(t *testing.T, dir string) []string { return nil }, false, false},
+		{"corrupted file", func(t *testing.T, dir string) []string {
+			// the manifest is taken from a backup whose chunk differs from the uploaded one
+			files, _, err := archive.HashFiles(context.Background(), dir, 1, nil)
+			require.Nil(t, err)
+			for i := range files {
+				files[i].Path = path.Join(uuid, files[i].Path)
+				if strings.HasSuffix(files[i].Path, ".chunk") {
+					files[i].SHA256 = strings.Repeat("0", 64)
+				}
+			}
+			data, err := json.Marshal(files)
+			require.Nil(t, err)
+			name := path.Join(t.TempDir(), archive.FileManifestName)
+			require.Nil(t, os.WriteFile(name, data, 0600))
+			return []string{name}
+		}, false, true},
+		{"corrupted file without check", func(t *testing.T, dir string) []string {
+			name := path.Join(t.TempDir(), archive.FileManifestName)
+			require.Nil(t, os.WriteFile(name, []byte(`[{"path":"`+uuid+`/missing","size":1,"sha256":""}]`), 0600))
+			return []string{name}
+		}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tmpdir, err := os.MkdirTemp("", "restore_file_manifest")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			backupsDir := path.Join(tmpdir, "backup", sidecar.DirName)
+			backupDir := path.Join(backupsDir, "backup-1659034855438", uuid)
+			require.Nil(t, fileutil.CreateFiles(backupDir, exampleTarGzFiles, true))
+			meta := tt.manifest(t, backupDir)
+
+			src := path.Join(tmpdir, "bucket")
+			require.Nil(t, os.MkdirAll(src, 0700))
+			b, err := fileblob.OpenBucket(src, nil)
+			require.Nil(t, err)
+			// a file manifest in the meta files stands in for the generated one
+			_, _, err = sidecar.UploadBackupWithin(ctx, b, backupsDir, "", 0, sidecar.UploadOptions{MetaFiles: meta, FileManifest: meta == nil})
+			require.Nil(t, err)
+			require.Nil(t, b.Close())
+
+			dst := path.Join(tmpdir, "dest")
+			require.Nil(t, os.MkdirAll(dst, 0700))
+			progress := newRestoreProgress()
+			_, err = downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 0, nil, backupSelector{Location: time.UTC}, downloadOptions{SkipFileCheck: tt.skipCheck, Progress: progress})
+			if !tt.wantErr {
+				require.Nil(t, err)
+				require.FileExists(t, path.Join(dst, archive.MetaDir, archive.FileManifestName))
+				// the checksum of the archive is recorded once it is verified
+				require.Len(t, progress.snapshot().Checksum, 64)
+				return
+			}
+			var cerr *corruptedFilesError
+			require.ErrorAs(t, err, &cerr)
+			require.Equal(t, []string{uuid + "/s00/tombstone/02/0000000000000002.chunk", uuid + "/s00/value/01/0000000000000001.chunk"}, cerr.Files)
+			require.Equal(t, api.RestoreReasonCorruptedFiles, failureReason(err))
+		})
+	}
+}
+
+func TestBucketToPVCBuckets(t *testing.T) {
+	r := &BucketToPVCCmd{Bucket: "s3://primary", Fallbacks: "gs://mirror, ,azblob://dr"}
+	require.Equal(t, []string{"s3://primary", "gs://mirror", "azblob://dr"}, r.buckets())
+}
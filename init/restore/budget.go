@@ -0,0 +1,292 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+// errorBudget lets a restore succeed although some archive entries could not be restored. A failed
+// entry is read again from the archive on its own with a ranged read of the archive index, only
+// the entries that fail again count against the budget. A nil budget fails on the first error.
+type errorBudget struct {
+	// max is the number of entries that may fail
+	max    int
+	mu     sync.Mutex
+	failed []api.FailedEntry
+}
+
+func newErrorBudget(max int) *errorBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &errorBudget{max: max}
+}
+
+func (b *errorBudget) record(e api.FailedEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed = append(b.failed, e)
+	if e.Recovered {
+		bucketToPVCLog.Warn("archive entry recovered", zap.String("key", e.Key), zap.String("path", e.Path), zap.String("error", e.Error))
+	} else {
+		bucketToPVCLog.Error("archive entry could not be restored", zap.String("key", e.Key), zap.String("path", e.Path), zap.String("error", e.Error))
+	}
+}
+
+// report returns the failed entries in the order they failed
+func (b *errorBudget) report() []api.FailedEntry {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]api.FailedEntry(nil), b.failed...)
+}
+
+// check returns an errorBudgetExceededError if more entries were not recovered than the budget allows
+func (b *errorBudget) check() error {
+	if b == nil {
+		return nil
+	}
+	var lost []api.FailedEntry
+	for _, e := range b.report() {
+		if !e.Recovered {
+			lost = append(lost, e)
+		}
+	}
+	if len(lost) > b.max {
+		return &errorBudgetExceededError{Max: b.max, Lost: lost}
+	}
+	return nil
+}
+
+// errorBudgetExceededError fails a restore with more lost entries than its error budget
+type errorBudgetExceededError struct {
+	Max  int
+	Lost []api.FailedEntry
+}
+
+func (e *errorBudgetExceededError) Error() string {
+	names := make([]string, 0, maxListedFiles)
+	for _, l := range e.Lost {
+		if len(names) == maxListedFiles {
+			names = append(names, fmt.Sprintf("and %d more", len(e.Lost)-maxListedFiles))
+			break
+		}
+		names = append(names, l.Path)
+	}
+	return fmt.Sprintf("%d archive entries could not be restored, the error budget allows %d: %s", len(e.Lost), e.Max, strings.Join(names, ", "))
+}
+
+// Reason returns the reason reported in the termination message
+func (e *errorBudgetExceededError) Reason() string {
+	return api.RestoreReasonErrorBudgetExceeded
+}
+
+// checkBudget publishes the failed entries and fails the restore if the budget is exceeded
+func checkBudget(opts downloadOptions) error {
+	opts.Progress.setFailedEntries(opts.Budget.report())
+	return opts.Budget.check()
+}
+
+// streamError is a read error of the archive stream. Entry is the entry that was extracted last, empty
+// if the first header was broken.
+type streamError struct {
+	Entry string
+	err   error
+}
+
+func (e *streamError) Error() string {
+	if e.Entry == "" {
+		return "reading the archive: " + e.err.Error()
+	}
+	return fmt.Sprintf("reading archive entry %s: %s", e.Entry, e.err.Error())
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// entryReader marks the read errors of the content of an entry as stream errors
+type entryReader struct {
+	name string
+	r    io.Reader
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &streamError{Entry: r.name, err: err}
+	}
+	return n, err
+}
+
+// rejectedEntryError is returned if a recovered entry fails the checks of the extraction, it fails
+// the restore whatever the budget, like it does for the entries of the stream
+type rejectedEntryError struct {
+	err error
+}
+
+func (e *rejectedEntryError) Error() string { return e.err.Error() }
+func (e *rejectedEntryError) Unwrap() error { return e.err }
+
+// readIndex reads the index of the archive, archives of a pinned version are not read by key
+func readIndex(ctx context.Context, bucket *blob.Bucket, key string, opts downloadOptions) (*archive.Index, error) {
+	if opts.Version != "" {
+		return nil, errors.New("the entries of a pinned archive version cannot be read one by one")
+	}
+	var index *archive.Index
+	err := opts.Retry.Do(ctx, "reading the index of "+key, func() error {
+		var err error
+		index, err = archive.ReadIndex(ctx, bucket, key)
+		return err
+	})
+	return index, err
+}
+
+// recoverEntries reads the entry that broke the stream and the entries the stream did not reach one
+// by one. The broken entry is recorded as failed, entries that cannot be read either as lost.
+func recoverEntries(ctx context.Context, bucket *blob.Bucket, key, target string, done map[string]bool, entries *entryChecker, expect *clusterExpectation, cause *streamError, opts downloadOptions) error {
+	if ctx.Err() != nil {
+		return cause
+	}
+	index, err := readIndex(ctx, bucket, key, opts)
+	if err != nil {
+		bucketToPVCLog.Error("archive entries cannot be recovered: " + err.Error())
+		return cause
+	}
+	bucketToPVCLog.Warn("archive stream broke, reading the remaining entries one by one", zap.String("key", key), zap.String("error", cause.Error()))
+
+	broken := cause.Entry
+	for _, e := range index.Entries {
+		if done[e.Name] && e.Name != broken {
+			continue
+		}
+		if broken == "" {
+			// a broken header belongs to the first entry that was not extracted
+			broken = e.Name
+		}
+		err = opts.Retry.Do(ctx, "reading archive entry "+e.Name, func() error {
+			return readEntry(ctx, bucket, key, target, e, entries, expect, opts.Owner)
+		})
+		var rejected *rejectedEntryError
+		if errors.As(err, &rejected) || ctx.Err() != nil {
+			return err
+		}
+		switch {
+		case e.Name == broken:
+			opts.Budget.record(api.FailedEntry{Key: key, Path: e.Name, Error: cause.err.Error(), Recovered: err == nil})
+		case err != nil:
+			opts.Budget.record(api.FailedEntry{Key: key, Path: e.Name, Error: err.Error()})
+		}
+	}
+	return checkBudget(opts)
+}
+
+// repairFiles reads the restored files that do not match the file manifest again from the archive
+// and verifies them once more
+func repairFiles(ctx context.Context, bucket *blob.Bucket, key, target string, corrupted *corruptedFilesError, entries *entryChecker, opts downloadOptions) error {
+	index, err := readIndex(ctx, bucket, key, opts)
+	if err != nil {
+		bucketToPVCLog.Error("corrupted files cannot be read again: " + err.Error())
+		for _, f := range corrupted.Files {
+			opts.Budget.record(api.FailedEntry{Key: key, Path: f, Error: "does not match the file manifest"})
+		}
+		return checkBudget(opts)
+	}
+	want := make(map[string]archive.FileEntry, len(corrupted.manifest))
+	for _, f := range corrupted.manifest {
+		want[f.Path] = f
+	}
+
+	for _, f := range corrupted.Files {
+		e, ok := index.Find(f)
+		if !ok {
+			opts.Budget.record(api.FailedEntry{Key: key, Path: f, Error: "does not match the file manifest and is not in the archive index"})
+			continue
+		}
+		err = opts.Retry.Do(ctx, "reading archive entry "+f, func() error {
+			return readEntry(ctx, bucket, key, target, e, entries, nil, opts.Owner)
+		})
+		if ctx.Err() != nil {
+			return err
+		}
+		if err == nil {
+			var still []string
+			if still, err = archive.VerifyFiles(ctx, target, []archive.FileEntry{want[f]}, 1); err == nil && len(still) > 0 {
+				err = errors.New("does not match the file manifest when read again")
+			}
+		}
+		failed := api.FailedEntry{Key: key, Path: f, Error: "does not match the file manifest", Recovered: err == nil}
+		if err != nil {
+			failed.Error = err.Error()
+		}
+		opts.Budget.record(failed)
+	}
+	return checkBudget(opts)
+}
+
+// readEntry writes the archive entry e into target with a ranged read of the archive
+func readEntry(ctx context.Context, bucket *blob.Bucket, key, target string, e archive.Entry, entries *entryChecker, expect *clusterExpectation, owner *ownership) error {
+	h, r, err := archive.OpenEntry(ctx, bucket, key, e)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// archives with an index are written in the layout of the agent
+	name, ok, err := newLayoutDetector(key).remap(h.Name)
+	if err == nil && ok {
+		ok, err = entries.check(name, h)
+	}
+	if err != nil {
+		return &rejectedEntryError{err: err}
+	}
+	if !ok {
+		return nil
+	}
+	dst := filepath.Join(target, name)
+	if h.Typeflag == tar.TypeSymlink {
+		// the symlink of a broken stream may exist already
+		if err = os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return createSymlink(dst, h.Linkname, owner)
+	}
+
+	var content io.Reader = r
+	if name == path.Join(archive.MetaDir, archive.BackupManifestName) {
+		data, err := io.ReadAll(io.LimitReader(r, maxManifestSize))
+		if err != nil {
+			return err
+		}
+		if err = expect.check(key, data); err != nil {
+			return &rejectedEntryError{err: err}
+		}
+		content = bytes.NewReader(data)
+	}
+	f, err := openEntry(dst, h.FileInfo(), owner)
+	if err != nil || f == nil {
+		return err
+	}
+	if _, err = io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	return closeFile(f)
+}
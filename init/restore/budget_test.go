@@ -0,0 +1,198 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+const budgetKey = "backup.tar.gz"
+
+// budgetArchive returns a v2 archive of files with distinct content, meta files are stored under meta/
+func budgetArchive(t *testing.T, files int, meta ...string) []byte {
+	dir := filepath.Join(t.TempDir(), "data")
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	for i := 0; i < files; i++ {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), bytes.Repeat([]byte{byte('a' + i)}, 4096), 0644))
+	}
+	var buf bytes.Buffer
+	_, err := archive.CreatePart(&buf, archive.DefaultCodec, dir, "data", meta, &archive.Progress{}, func() bool { return false })
+	require.Nil(t, err)
+	return buf.Bytes()
+}
+
+// corrupt returns a copy of the archive with a byte of the entry changed at the offset from its start,
+// negative offsets count from its end
+func corrupt(t *testing.T, data []byte, name string, offset int64) []byte {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	require.Nil(t, b.WriteAll(context.Background(), budgetKey, data, nil))
+	index, err := archive.ReadIndex(context.Background(), b, budgetKey)
+	require.Nil(t, err)
+	e, ok := index.Find(name)
+	require.True(t, ok)
+
+	out := append([]byte(nil), data...)
+	if offset < 0 {
+		offset += e.Length
+	}
+	out[e.Offset+offset] ^= 0xff
+	return out
+}
+
+func extractWithBudget(t *testing.T, stored, streamed []byte, budget *errorBudget) (string, error) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { bucket.Close() })
+	require.Nil(t, bucket.WriteAll(ctx, budgetKey, stored, nil))
+	target := t.TempDir()
+	opts := downloadOptions{Budget: budget, SkipFileCheck: budget == nil}
+	return target, extractArchive(ctx, bucket, budgetKey, target, bytes.NewReader(streamed), int64(len(streamed)), time.Millisecond, opts)
+}
+
+func requireRestored(t *testing.T, target string, files ...int) {
+	for _, i := range files {
+		data, err := os.ReadFile(filepath.Join(target, "data", fmt.Sprintf("file%d", i)))
+		require.Nil(t, err)
+		require.Equal(t, bytes.Repeat([]byte{byte('a' + i)}, 4096), data)
+	}
+}
+
+func TestErrorBudgetRecoversBrokenStream(t *testing.T) {
+	data := budgetArchive(t, 5)
+	// the checksum of the compressed member is only verified at its end
+	broken := corrupt(t, data, "data/file2", -5)
+
+	_, err := extractWithBudget(t, data, broken, nil)
+	require.NotNil(t, err, "without a budget the restore fails")
+
+	budget := newErrorBudget(1)
+	target, err := extractWithBudget(t, data, broken, budget)
+	require.Nil(t, err)
+	requireRestored(t, target, 0, 1, 2, 3, 4)
+	report := budget.report()
+	require.Len(t, report, 1)
+	require.Equal(t, "data/file2", report[0].Path)
+	require.True(t, report[0].Recovered)
+	require.Nil(t, budget.check())
+}
+
+func TestErrorBudgetExceeded(t *testing.T) {
+	data := budgetArchive(t, 5)
+	// the entries are broken in the bucket as well, reading them again fails
+	broken := corrupt(t, corrupt(t, data, "data/file1", 0), "data/file3", 0)
+
+	budget := newErrorBudget(2)
+	target, err := extractWithBudget(t, broken, broken, budget)
+	require.Nil(t, err)
+	requireRestored(t, target, 0, 2, 4)
+	var lost []string
+	for _, e := range budget.report() {
+		if !e.Recovered {
+			lost = append(lost, e.Path)
+		}
+	}
+	require.Equal(t, []string{"data/file1", "data/file3"}, lost)
+
+	_, err = extractWithBudget(t, broken, broken, newErrorBudget(1))
+	var exceeded *errorBudgetExceededError
+	require.True(t, errors.As(err, &exceeded), "Error is: ", err)
+	require.Len(t, exceeded.Lost, 2)
+	require.Equal(t, api.RestoreReasonErrorBudgetExceeded, failureReason(err))
+}
+
+func TestErrorBudgetRepairsFiles(t *testing.T) {
+	// the file manifest does not match the second file in the archive
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, archive.FileManifestName)
+	sum := sha256.Sum256(bytes.Repeat([]byte{'a'}, 4096))
+	files := []archive.FileEntry{
+		{Path: "data/file0", Size: 4096, SHA256: hex.EncodeToString(sum[:])},
+		{Path: "data/file1", Size: 4096, SHA256: hex.EncodeToString(sum[:])},
+	}
+	content, err := json.Marshal(files)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(manifest, content, 0644))
+	data := budgetArchive(t, 2, manifest)
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, budgetKey, data, nil))
+
+	extract := func(budget *errorBudget) error {
+		return extractArchive(ctx, bucket, budgetKey, t.TempDir(), bytes.NewReader(data), int64(len(data)), time.Millisecond, downloadOptions{Budget: budget})
+	}
+	var corrupted *corruptedFilesError
+	require.True(t, errors.As(extract(nil), &corrupted))
+
+	budget := newErrorBudget(1)
+	require.Nil(t, extract(budget))
+	report := budget.report()
+	require.Len(t, report, 1)
+	require.Equal(t, "data/file1", report[0].Path)
+	require.False(t, report[0].Recovered)
+
+	// a budget that allows no lost entries still reads the file again
+	var exceeded *errorBudgetExceededError
+	require.True(t, errors.As(extract(&errorBudget{}), &exceeded))
+}
+
+func TestErrorBudgetRepairsFilesOfArchiveManifest(t *testing.T) {
+	// the archive has no file manifest, the manifest next to it does not match the second file
+	data := budgetArchive(t, 2)
+	sum := sha256.Sum256(bytes.Repeat([]byte{'a'}, 4096))
+	files := []archive.FileEntry{
+		{Path: "data/file0", Size: 4096, SHA256: hex.EncodeToString(sum[:])},
+		{Path: "data/file1", Size: 4096, SHA256: hex.EncodeToString(sum[:])},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, budgetKey, data, nil))
+	extract := func(budget *errorBudget) error {
+		return extractArchive(ctx, bucket, budgetKey, t.TempDir(), bytes.NewReader(data), int64(len(data)), time.Millisecond, downloadOptions{Budget: budget})
+	}
+	require.Nil(t, extract(nil), "archives without any manifest are not checked")
+
+	require.Nil(t, archive.WriteArchiveManifest(ctx, bucket, budgetKey, &archive.ArchiveManifest{Archive: budgetKey, Files: files}, nil))
+	var corrupted *corruptedFilesError
+	require.True(t, errors.As(extract(nil), &corrupted))
+	require.Equal(t, []string{"data/file1"}, corrupted.Files)
+
+	budget := newErrorBudget(1)
+	require.Nil(t, extract(budget))
+	report := budget.report()
+	require.Len(t, report, 1)
+	require.Equal(t, "data/file1", report[0].Path)
+	require.False(t, report[0].Recovered)
+}
+
+func TestErrorBudgetNoIndex(t *testing.T) {
+	data := budgetArchive(t, 3)
+	broken := corrupt(t, data, "data/file1", -5)
+
+	// without the index behind the archive, the entries cannot be read one by one
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, budgetKey, data[:len(data)-64], nil))
+	err := extractArchive(ctx, bucket, budgetKey, t.TempDir(), bytes.NewReader(broken), int64(len(broken)), time.Millisecond, downloadOptions{Budget: newErrorBudget(5), SkipFileCheck: true})
+	var streamErr *streamError
+	require.True(t, errors.As(err, &streamErr), "Error is: ", err)
+}
@@ -2,77 +2,550 @@ package restore
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
 	"gocloud.dev/blob"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/cgroup"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/metrics"
+	"github.com/hazelcast/platform-operator-agent/internal/notify"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
 	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
-func saveFromArchive(ctx context.Context, bucket *blob.Bucket, key, target string) error {
-	s, err := bucket.NewReader(ctx, key, nil)
+func saveFromArchive(ctx context.Context, bucket *blob.Bucket, key, target string, opts downloadOptions) error {
+	if isDirectoryKey(key) {
+		return saveFromDirectory(ctx, bucket, key, target, opts)
+	}
+	if archive.Encrypted(key) && opts.EncryptionKey == nil {
+		return fmt.Errorf("archive %s is encrypted, the encryption secret is not set", key)
+	}
+	if opts.Workers > 0 {
+		return saveFromStagedArchive(ctx, bucket, key, target, opts)
+	}
+
+	start := time.Now()
+	s, err := openArchive(ctx, bucket, key, opts)
 	if err != nil {
 		return err
 	}
 	defer s.Close()
 
-	g, err := gzip.NewReader(s)
+	// size is unknown for archives stored in parts
+	var size int64
+	if sr, ok := s.(interface{ Size() int64 }); ok {
+		size = sr.Size()
+		opts.Progress.setTotal(size)
+	}
+	return extractArchive(ctx, bucket, key, target, opts.Progress.reader(opts.Throttle.Reader(ctx, s)), size, time.Since(start), opts)
+}
+
+// openArchive opens the archive, a pinned version is read from a single object even if the latest
+// version was deleted. A stream broken by a transient error is reopened where it stopped.
+func openArchive(ctx context.Context, bucket *blob.Bucket, key string, opts downloadOptions) (io.ReadCloser, error) {
+	return opts.Retry.NewRetryReader(ctx, "reading "+key, func(offset int64) (io.ReadCloser, error) {
+		if opts.Version == "" {
+			return archive.NewOffsetReader(ctx, bucket, key, offset)
+		}
+		r, err := bucket.NewRangeReader(ctx, key, offset, -1, bkt.VersionOptions(opts.Version))
+		if err != nil {
+			return nil, fmt.Errorf("reading version %s of %s, versions can only be pinned for archives stored as a single object: %w", opts.Version, key, err)
+		}
+		return r, nil
+	})
+}
+
+// saveFromStagedArchive downloads the archive into its staging file first, the staging file is
+// removed once it is restored or if its content is corrupted
+func saveFromStagedArchive(ctx context.Context, bucket *blob.Bucket, key, target string, opts downloadOptions) error {
+	name, err := stageArchive(ctx, bucket, key, opts)
+	if err != nil {
+		return err
+	}
+	opts.Progress.setPhase(api.RestorePhaseExtracting)
+
+	start := time.Now()
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = extractArchive(ctx, bucket, key, target, f, info.Size(), time.Since(start), opts)
+	if err == nil || errors.Is(err, archive.ErrChecksumMismatch) {
+		if rerr := removeStaging(opts.StagingDir, key); rerr != nil {
+			bucketToPVCLog.Warn("could not remove staging file: " + rerr.Error())
+		}
+	}
+	return err
+}
+
+// extractArchive restores the archive read from s into target, the size is 0 if unknown
+func extractArchive(ctx context.Context, bucket *blob.Bucket, key, target string, s io.Reader, size int64, latency time.Duration, opts downloadOptions) error {
+	version := opts.Version
+	var want []byte
+	var err error
+	if version == "" {
+		err = opts.Retry.Do(ctx, "reading the checksum of "+key, func() error {
+			want, err = archive.ReadChecksum(ctx, bucket, key)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	h := sha256.New()
+	// staged archives are read from a local file, the reads stop once the restore is canceled
+	var src io.Reader = &ctxReader{ctx: ctx, r: s}
+	switch {
+	case want != nil:
+		// the digest is computed while streaming, the archive is not read twice
+		src = io.TeeReader(src, h)
+	case version != "":
+		// the latest checksum belongs to the latest version of the archive
+		bucketToPVCLog.Info("archive version is pinned, skipping checksum verification", zap.String("key", key), zap.String("version", version))
+	default:
+		bucketToPVCLog.Info("archive has no checksum, skipping verification", zap.String("key", key))
+	}
+
+	// the download runs ahead of the decompression, which runs ahead of the disk writes
+	chunkSize, depth := bkt.ReadBufferSize(size, latency), bkt.PipelineDepth()
+	r := newReadAhead(src, chunkSize, depth)
+	defer r.Close()
+
+	// the checksum is computed over the encrypted bytes, the decryption authenticates every frame
+	var plain io.Reader = r
+	if archive.Encrypted(key) {
+		plain = archive.NewDecryptReader(r, opts.EncryptionKey)
+	}
+	g, err := archive.Decompress(plain, key)
 	if err != nil {
 		return err
 	}
 	defer g.Close()
 
+	w := newDiskWriter(chunkSize, depth, opts.WriteWorkers)
+	w.progress = opts.Progress
+	w.pacer = newWritePacer(cgroup.Root, opts.DirtyRatio)
+	w.owner = opts.Owner
+	entries := newEntryChecker(opts.Symlinks)
+	done := make(map[string]bool)
+	err = extract(g, key, target, w, entries, newMetadataMarker(opts.MetadataMarker, key, target, opts.Control), opts.Expect, done)
+	if err == nil && want != nil {
+		// the extraction stops at the end of the tar stream, the index behind it is part of the digest
+		_, err = io.Copy(io.Discard, r)
+	}
+	// the error of the writer is the cause if it failed first
+	if werr := w.close(); werr != nil {
+		return werr
+	}
+	var streamErr *streamError
+	if errors.As(err, &streamErr) && opts.Budget != nil {
+		// the digest covers the whole stream, the recovered entries are only verified by the file manifest
+		want = nil
+		err = recoverEntries(ctx, bucket, key, target, done, entries, opts.Expect, streamErr, opts)
+	}
+	if err == nil && want != nil {
+		if err = archive.VerifyChecksum(key, want, h.Sum(nil)); err == nil {
+			opts.Progress.setChecksum(hex.EncodeToString(want))
+		}
+	}
+	if err != nil || opts.SkipFileCheck {
+		return err
+	}
+	err = verifyFiles(ctx, bucket, key, target, opts)
+	var corrupted *corruptedFilesError
+	if errors.As(err, &corrupted) && opts.Budget != nil {
+		return repairFiles(ctx, bucket, key, target, corrupted, entries, opts)
+	}
+	return err
+}
+
+// extract writes the entries of the tar stream g into target. The names of the entries handed to
+// the writer are added to done, read errors of the stream are returned as streamError.
+func extract(g io.Reader, key, target string, w *diskWriter, entries *entryChecker, marker *metadataMarker, expect *clusterExpectation, done map[string]bool) error {
+	defer entries.report()
+	manifest := path.Join(archive.MetaDir, archive.BackupManifestName)
+
+	// archives of older agents and manual tar invocations are remapped to the current layout
+	layout := newLayoutDetector(key)
+	save := func(headers []*tar.Header, src io.Reader) error {
+		if src != nil && len(headers) > 0 {
+			src = &entryReader{name: headers[len(headers)-1].Name, r: src}
+		}
+		for _, h := range headers {
+			name, ok, err := layout.remap(h.Name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if ok, err = entries.check(name, h); err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if h.Typeflag == tar.TypeSymlink {
+				if err = w.symlink(filepath.Join(target, name), h.Linkname); err != nil {
+					return err
+				}
+				continue
+			}
+			if !h.FileInfo().IsDir() && archive.IsChunkFile(name) {
+				if err = marker.mark(w); err != nil {
+					return err
+				}
+			}
+			if err = w.entry(filepath.Join(target, name), h.FileInfo()); err != nil {
+				return err
+			}
+			content := src
+			if name == manifest && h.Typeflag == tar.TypeReg && src != nil {
+				// the metadata is stored first, so nothing of the member is written before the check
+				data, err := io.ReadAll(io.LimitReader(src, maxManifestSize))
+				if err != nil {
+					return err
+				}
+				if err = expect.check(key, data); err != nil {
+					return err
+				}
+				content = bytes.NewReader(data)
+			}
+			if !h.FileInfo().IsDir() && content != nil {
+				if err = w.copyFrom(content); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
 	t := tar.NewReader(g)
+	var last string
 	for {
 		header, err := t.Next()
 		if err == io.EOF {
-			return nil
+			headers := layout.flush()
+			if err = save(headers, nil); err != nil {
+				return err
+			}
+			for _, h := range headers {
+				done[h.Name] = true
+			}
+			// a backup without chunk files
+			return marker.mark(w)
 		}
 		if err != nil {
+			// a compressed member is only verified once it is read to its end, which is when the
+			// header of the next entry is read
+			return &streamError{Entry: last, err: err}
+		}
+		last = header.Name
+
+		headers := layout.add(header)
+		if err = save(headers, t); err != nil {
 			return err
 		}
+		for _, h := range headers {
+			done[h.Name] = true
+		}
+	}
+}
+
+const (
+	backupSuffix     = ".bak"
+	restoreTmpPrefix = ".restore-tmp-"
+	// swappedMarker is written once the restored folders replaced the original ones, until the
+	// originals are removed. Without it the originals of an interrupted restore are moved back.
+	swappedMarker = ".restore-swapped"
+)
+
+// localData keeps the hot-restart folders that were moved aside during a restore
+type localData struct {
+	dir   string
+	names []string
+}
+
+// moveAsideHotRestart renames the hot-restart folders in dir to <uuid>.bak so that they can be rolled back
+// if the restore fails. Folders left by an interrupted restore are moved back first.
+func moveAsideHotRestart(dir string) (*localData, error) {
+	if err := recoverHotRestart(dir); err != nil {
+		return nil, err
+	}
+	return moveAside(dir)
+}
 
-		name := filepath.Join(target, header.Name)
-		if err = saveFile(name, header.FileInfo(), t); err != nil {
+// moveAside renames the hot-restart folders in dir to <uuid>.bak
+func moveAside(dir string) (*localData, error) {
+	uuids, err := fileutil.FolderUUIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &localData{dir: dir}
+	for _, uuid := range uuids {
+		name := path.Join(dir, uuid.Name())
+		if err = os.Rename(name, name+backupSuffix); err != nil {
+			return nil, err
+		}
+		l.names = append(l.names, uuid.Name())
+	}
+	return l, nil
+}
+
+// recoverHotRestart moves back folders left by an interrupted restore and removes stale ones. The
+// originals are only removed if the marker proves that the restored folders were moved in
+// completely, otherwise the restored folders are removed and the originals moved back.
+func recoverHotRestart(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	marker := path.Join(dir, swappedMarker)
+	_, err = os.Stat(marker)
+	swapped := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	moved := false
+	for _, e := range entries {
+		uuid := strings.TrimSuffix(e.Name(), backupSuffix)
+		if e.IsDir() && uuid != e.Name() && fileutil.UUIDRegex.MatchString(uuid) {
+			moved = true
+		}
+	}
+	for _, e := range entries {
+		// partial extraction of an interrupted restore
+		if e.IsDir() && strings.HasPrefix(e.Name(), restoreTmpPrefix) {
+			if err = os.RemoveAll(path.Join(dir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+
+		uuid := strings.TrimSuffix(e.Name(), backupSuffix)
+		if !e.IsDir() || !fileutil.UUIDRegex.MatchString(uuid) {
+			continue
+		}
+		name := path.Join(dir, uuid)
+		if uuid == e.Name() {
+			// the folders were all moved aside before the restored ones were moved in
+			if moved && !swapped {
+				if err = os.RemoveAll(name); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if swapped {
+			err = os.RemoveAll(name + backupSuffix)
+		} else {
+			if err = os.RemoveAll(name); err == nil {
+				err = os.Rename(name+backupSuffix, name)
+			}
+		}
+		if err != nil {
 			return err
 		}
 	}
+	if err = os.Remove(marker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return syncDir(dir)
 }
 
-func saveFile(name string, info fs.FileInfo, src io.Reader) error {
-	if info.IsDir() {
-		return os.MkdirAll(name, info.Mode())
+// extractAtomically runs extract into a temporary folder in dst and moves the extracted folders
+// into dst once it succeeded, so that a crash never leaves a partial folder Hazelcast could load
+func extractAtomically(dst string, extract func(tmp string) error) error {
+	tmp, err := os.MkdirTemp(dst, restoreTmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err = extract(tmp); err != nil {
+		return err
 	}
+	return moveIn(tmp, dst)
+}
 
-	dst, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+// moveIn moves the extracted folders of tmp into dst
+func moveIn(tmp, dst string) error {
+	entries, err := os.ReadDir(tmp)
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
+	for _, e := range entries {
+		// hot-restart folders were moved aside, only meta data of an older restore can be replaced
+		target := path.Join(dst, e.Name())
+		if err = os.RemoveAll(target); err != nil {
+			return err
+		}
+		if err = os.Rename(path.Join(tmp, e.Name()), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	_, err = io.Copy(dst, src)
-	return err
+// restoreKeepingExisting extracts into a temporary folder next to the hot-restart folders in dst and
+// only swaps them for the extracted ones once the extraction succeeded and was verified. The existing
+// folders stay in place during the download, a failed restore leaves dst as it was.
+func restoreKeepingExisting(dst string, extract func(tmp string) error) error {
+	if err := recoverHotRestart(dst); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dst, restoreTmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err = extract(tmp); err != nil {
+		return err
+	}
+	if err = verifyStaged(tmp); err != nil {
+		return err
+	}
+
+	// an interrupted swap is rolled back by recoverHotRestart unless it was complete
+	local, err := moveAside(dst)
+	if err != nil {
+		return err
+	}
+	return restoreOrRollback(local, func() error {
+		return moveIn(tmp, dst)
+	})
+}
+
+// verifyStaged fails if an extracted hot-restart folder is empty, the checksums and the files of the
+// archive were already verified during the extraction
+func verifyStaged(tmp string) error {
+	uuids, err := fileutil.FolderUUIDs(tmp)
+	if err != nil {
+		return err
+	}
+	for _, uuid := range uuids {
+		entries, err := os.ReadDir(path.Join(tmp, uuid.Name()))
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("restored hot-restart folder %s is empty", uuid.Name())
+		}
+	}
+	return nil
+}
+
+// restoreInto runs extract into a temporary folder and replaces the hot-restart folders in dst with
+// the extracted ones. keep leaves the existing folders in place until the extraction succeeded.
+func restoreInto(dst string, keep bool, extract func(tmp string) error) error {
+	if keep {
+		return restoreKeepingExisting(dst, extract)
+	}
+	local, err := moveAsideHotRestart(dst)
+	if err != nil {
+		return err
+	}
+	return restoreOrRollback(local, func() error {
+		return extractAtomically(dst, extract)
+	})
+}
+
+// rollback removes the partially restored folders and moves the original data back
+func (l *localData) rollback() error {
+	uuids, err := fileutil.FolderUUIDs(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, uuid := range uuids {
+		if err = os.RemoveAll(path.Join(l.dir, uuid.Name())); err != nil {
+			return err
+		}
+	}
+	for _, n := range l.names {
+		name := path.Join(l.dir, n)
+		if err = os.Rename(name+backupSuffix, name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func cleanupLocks(folder string, id int) error {
+// commit removes the original data once the restore succeeded. The marker tells an interrupted
+// commit apart from an interrupted restore.
+func (l *localData) commit() error {
+	marker := path.Join(l.dir, swappedMarker)
+	if len(l.names) > 0 {
+		if err := os.WriteFile(marker, nil, 0600); err != nil {
+			return err
+		}
+		if err := syncDir(l.dir); err != nil {
+			return err
+		}
+	}
+	for _, n := range l.names {
+		if err := os.RemoveAll(path.Join(l.dir, n+backupSuffix)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(marker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// restoreOrRollback runs restore and rolls the local data back if it fails
+func restoreOrRollback(l *localData, restore func() error) error {
+	if err := restore(); err != nil {
+		if rerr := l.rollback(); rerr != nil {
+			return fmt.Errorf("%v, rollback failed: %w", err, rerr)
+		}
+		return err
+	}
+	return l.commit()
+}
+
+// cleanupLocks removes the locks of earlier restores of the member, the lock of the current
+// restore is kept so that writeLock detects another agent that restored the same member
+func cleanupLocks(folder string, id int, current string) error {
 	locks, err := getLocks(folder)
 	if err != nil {
 		return err
 	}
 
 	for _, lock := range locks {
-		if strings.HasSuffix(lock.Name(), "."+strconv.Itoa(id)) {
+		if lock.Name() != current && strings.HasSuffix(lock.Name(), "."+strconv.Itoa(id)) {
 			err = os.Remove(path.Join(folder, lock.Name()))
 			if err != nil {
 				return err
@@ -98,55 +571,112 @@ func getLocks(dir string) ([]os.DirEntry, error) {
 	return locks, nil
 }
 
-func find(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
-	var keys []string
-	var latest string
-	iter := bucket.List(nil)
-	for {
-		obj, err := iter.Next(ctx)
-		if err == io.EOF {
-			break
-		}
+// backupSelector selects the backup folder and the archives of a member to restore
+type backupSelector struct {
+	// Location is the time zone of folder names without zone offset, UTC if nil
+	Location *time.Location
+	// At is the time of the folder to restore, zero selects the latest one
+	At time.Time
+	// Key is the archive to restore whatever the member index, empty selects by index
+	Key string
+	// ClusterSize is the number of members the backup is restored into, 0 if it is not known
+	ClusterSize int
+	// ScalePolicy decides how a backup of another cluster size is restored
+	ScalePolicy string
+	// AllowPartial confirms the restore of a folder that misses the archives of some members
+	AllowPartial bool
+	// AllowExtraMembers lets members beyond the archives of the backup skip the restore
+	AllowExtraMembers bool
+}
+
+// find returns the archive keys of the selected backup. The top of the bucket is listed for the
+// dated backup folders first, then only the objects of the selected folder are listed, so the time
+// to find a backup does not grow with the history of the bucket.
+func find(ctx context.Context, bucket *blob.Bucket, sel backupSelector, retry bkt.Retry) ([]string, error) {
+	if sel.Key != "" {
+		objKeys, err := listKeys(ctx, bucket, strings.TrimSuffix(sel.Key, "/"), retry)
 		if err != nil {
 			return nil, err
 		}
+		return findKey(objKeys, sel.Key)
+	}
 
-		// naive validation, we only want tgz files
-		if !strings.HasSuffix(obj.Key, ".tar.gz") {
-			continue
+	folders, err := listDatedFolders(ctx, bucket, sel.Location, retry)
+	if err != nil {
+		return nil, err
+	}
+	if !sel.At.IsZero() {
+		times := make(map[string]time.Time, len(folders))
+		for _, f := range folders {
+			times[f.name] = f.time
 		}
-
-		// find the latest directory if key starts with date (is in a directory with backups)
-		if dateRE.MatchString(obj.Key) {
-			dir := filepath.Dir(obj.Key)
-			// lexicographical comparison is good enough
-			if dir > latest {
-				latest = dir
-			}
+		dir, err := selectFolder(times, sel.At)
+		if err != nil {
+			return nil, err
 		}
-
-		keys = append(keys, obj.Key)
+		folders = []datedFolder{{name: dir, time: times[dir]}}
 	}
 
-	// this was a directory with backups, filter keys in the latest backup
-	if latest != "" {
-		var l []string
-		for _, k := range keys {
-			if strings.HasPrefix(k, latest) {
-				l = append(l, k)
-			}
+	if len(folders) == 0 {
+		// backups that are not in dated folders
+		objKeys, err := listKeys(ctx, bucket, "", retry)
+		if err != nil {
+			return nil, err
+		}
+		keys := backupKeys(objKeys, "")
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("there are no archived backup files in the bucket")
 		}
-		keys = l
+		return keys, nil
 	}
 
-	if len(keys) == 0 {
-		return nil, fmt.Errorf("there are no archived backup files in the bucket")
+	// the latest folder with archives, folders of failed uploads may have none
+	for _, f := range folders {
+		objKeys, err := listKeys(ctx, bucket, f.name+"/", retry)
+		if err != nil {
+			return nil, err
+		}
+		keys := backupKeys(objKeys, f.name)
+		if len(keys) == 0 {
+			continue
+		}
+		if err = checkComplete(ctx, bucket, f.name, keys, sel.AllowPartial, retry); err != nil {
+			return nil, err
+		}
+		return keys, nil
 	}
+	return nil, fmt.Errorf("there are no archived backup files in the bucket")
+}
 
-	// to be extra safe we always sort the keys
-	sort.Strings(keys)
+// findKey returns the named archive or member folder if it is in the bucket, the trailing slash of
+// a folder is optional
+func findKey(objKeys []string, key string) ([]string, error) {
+	for _, objKey := range objKeys {
+		if k, ok := archive.Key(objKey); ok && k == key {
+			return []string{key}, nil
+		}
+		if k, ok := directoryKey(objKey); ok && k == strings.TrimSuffix(key, "/")+"/" {
+			return []string{k}, nil
+		}
+	}
+	return nil, fmt.Errorf("backup %s not found in the bucket", key)
+}
 
-	return keys, nil
+// selectFolder returns the folder of the backup taken at the given time, folders in other
+// time zones match as well
+func selectFolder(folders map[string]time.Time, at time.Time) (string, error) {
+	var available []string
+	for dir, t := range folders {
+		if t.Equal(at) {
+			return dir, nil
+		}
+		available = append(available, dir)
+	}
+	if len(available) == 0 {
+		return "", fmt.Errorf("backup %s not found, there are no dated backup folders in the bucket", at.Format(fileutil.FolderTimeFormat))
+	}
+	sort.Strings(available)
+	return "", fmt.Errorf("backup %s not found, available backups: %s", at.Format(fileutil.FolderTimeFormat), strings.Join(available, ", "))
 }
 
 var errParseID = errors.New("couldn't parse statefulset hostname")
@@ -172,3 +702,116 @@ func createArchiveFile(dir, baseDir, outPath string) error {
 
 	return sidecar.CreateArchive(outFile, dir, baseDir)
 }
+
+var eventsLog = logger.New().Named("restore_events")
+
+// reportRestore sends a restore event to Management Center, failures are only logged
+func reportRestore(ctx context.Context, events *mancenter.Client, phase, key string) {
+	e := mancenter.Event{Type: mancenter.Restore, Phase: phase, Key: logger.Redact(key)}
+	if err := events.Report(ctx, e); err != nil {
+		eventsLog.Warn("could not report event to management center: " + err.Error())
+	}
+	if err := notify.Send(ctx, e); err != nil {
+		eventsLog.Warn("could not send notification: " + err.Error())
+	}
+}
+
+func reportRestoreStatus(ctx context.Context, events *mancenter.Client, status subcommands.ExitStatus, key string) {
+	phase := mancenter.Succeeded
+	if status != subcommands.ExitSuccess {
+		phase = mancenter.Failed
+	}
+	reportRestore(ctx, events, phase, key)
+}
+
+// finalPhase returns the phase a restore ends in, a skipped restore stays skipped
+func finalPhase(status subcommands.ExitStatus, phase string) string {
+	switch {
+	case status != subcommands.ExitSuccess:
+		return api.RestorePhaseFailed
+	case phase != api.RestorePhaseSkipped:
+		return api.RestorePhaseSucceeded
+	}
+	return phase
+}
+
+// pushRestoreMetrics pushes the outcome, duration, transferred and restored bytes and the retries to the
+// Pushgateway, failures are only logged. The result is labeled with the final phase and the failure reason.
+func pushRestoreMetrics(ctx context.Context, p *metrics.Pusher, instance string, status subcommands.ExitStatus, start time.Time, size *restoredSize, s api.RestoreStatus, reason string) {
+	success := 0.0
+	if status == subcommands.ExitSuccess {
+		success = 1
+	}
+	result := map[string]string{"phase": finalPhase(status, s.Phase), "reason": reason}
+	err := p.Push(ctx, instance, []metrics.Metric{
+		{Name: "hazelcast_restore_success", Help: "Whether the last restore succeeded.", Value: success},
+		{Name: "hazelcast_restore_result", Help: "Outcome of the last restore, labeled with its final phase and the failure reason.", Value: 1, Labels: result},
+		{Name: "hazelcast_restore_duration_seconds", Help: "Duration of the last restore in seconds.", Value: time.Since(start).Seconds()},
+		{Name: "hazelcast_restore_bytes", Help: "Size of the restored hot-restart data in bytes.", Value: float64(size.bytes())},
+		{Name: "hazelcast_restore_transferred_bytes", Help: "Bytes downloaded from the bucket by the last restore.", Value: float64(s.BytesDownloaded)},
+		{Name: "hazelcast_restore_retries", Help: "Retried bucket operations and downloads of the last restore.", Value: float64(s.Retries)},
+		{Name: "hazelcast_restore_last_completion_timestamp_seconds", Help: "Unix time of the last restore completion.", Value: float64(clock.Now().Unix())},
+	})
+	if err != nil {
+		eventsLog.Warn("could not push metrics to pushgateway: " + err.Error())
+	}
+}
+
+// restoreSummary is the detail of the termination message of a restore
+type restoreSummary struct {
+	Source string `json:"source,omitempty"`
+	Bytes  int64  `json:"bytes"`
+	// Reason tells the operator why a restore failed, e.g. api.RestoreReasonClusterSizeMismatch
+	Reason string `json:"reason,omitempty"`
+}
+
+func writeRestoreSummary(command string, status subcommands.ExitStatus, start time.Time, source string, size *restoredSize, reason string) {
+	termination.Report(command, status, start, restoreSummary{Source: logger.Redact(source), Bytes: size.bytes(), Reason: reason})
+}
+
+// failureReason returns the reason of errors that the operator handles, empty for other errors
+func failureReason(err error) string {
+	var r interface{ Reason() string }
+	if errors.As(err, &r) {
+		return r.Reason()
+	}
+	return ""
+}
+
+// restoredSize is the size of the hot-restart folders in dir once the restore ended. The folders are
+// walked once for the result, the metrics, the termination message and the report, or the size is
+// taken from the walk of the access check.
+type restoredSize struct {
+	dir   string
+	n     int64
+	known bool
+}
+
+func (s *restoredSize) bytes() int64 {
+	if !s.known {
+		s.set(restoredBytes(s.dir))
+	}
+	return s.n
+}
+
+func (s *restoredSize) set(n int64) {
+	s.n, s.known = n, true
+}
+
+// restoredBytes returns the size of the hot-restart folders in dir
+func restoredBytes(dir string) int64 {
+	uuids, err := fileutil.FolderUUIDs(dir)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, uuid := range uuids {
+		_ = filepath.Walk(path.Join(dir, uuid.Name()), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				size += info.Size()
+			}
+			return nil
+		})
+	}
+	return size
+}
@@ -1,16 +1,22 @@
 package restore
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/memblob"
 
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 )
 
@@ -58,7 +64,7 @@ func TestSaveFromArchive(t *testing.T) {
 			destDir := path.Join(tmpdir, "dest")
 			require.Nil(t, err)
 
-			err = saveFromArchive(ctx, bucket, tarName, destDir)
+			err = saveFromArchive(ctx, bucket, tarName, destDir, downloadOptions{})
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -71,6 +77,122 @@ func TestSaveFromArchive(t *testing.T) {
 	}
 }
 
+func TestSaveFromArchiveChecksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum func(data []byte) []byte
+		version  string
+		wantErr  error
+	}{
+		{"valid", func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] }, "", nil},
+		{"mismatch", func([]byte) []byte { return make([]byte, sha256.Size) }, "", archive.ErrChecksumMismatch},
+		{"no checksum", nil, "", nil},
+		// the checksum of the latest version does not apply to older versions
+		{"pinned version", func([]byte) []byte { return make([]byte, sha256.Size) }, "1", nil},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "save_from_archive_checksum")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			uuid := "00000000-0000-0000-0000-000000000001"
+			archiveDir := path.Join(tmpdir, "archive")
+			require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+			var buf bytes.Buffer
+			require.Nil(t, archive.Create(&buf, archiveDir, uuid))
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			key := uuid + ".tar.gz"
+			require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+			if tt.checksum != nil {
+				require.Nil(t, archive.WriteChecksum(ctx, bucket, key, tt.checksum(buf.Bytes()), nil))
+			}
+
+			err = saveFromArchive(ctx, bucket, key, path.Join(tmpdir, "dest"), downloadOptions{Version: tt.version})
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSaveFromArchiveCompressions(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []archive.Compression{archive.Gzip, archive.Zstd, archive.None} {
+		t.Run(string(c), func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "save_from_archive_compression")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			uuid := "00000000-0000-0000-0000-000000000001"
+			archiveDir := path.Join(tmpdir, "archive")
+			require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+			var buf bytes.Buffer
+			_, err = archive.CreatePart(&buf, archive.Codec{Compression: c}, archiveDir, uuid, nil, &archive.Progress{}, func() bool { return false })
+			require.Nil(t, err)
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			key := uuid + c.Extension()
+			require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+			sum := sha256.Sum256(buf.Bytes())
+			require.Nil(t, archive.WriteChecksum(ctx, bucket, key, sum[:], nil))
+
+			dest := path.Join(tmpdir, "dest")
+			require.Nil(t, saveFromArchive(ctx, bucket, key, dest, downloadOptions{}))
+			_, err = os.Stat(path.Join(dest, uuid, "cluster", "cluster-state.txt"))
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestSaveFromArchiveEncrypted(t *testing.T) {
+	encryptionKey := bytes.Repeat([]byte{1}, 32)
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr error
+	}{
+		{"decrypted", encryptionKey, nil},
+		{"wrong key", bytes.Repeat([]byte{2}, 32), archive.ErrDecrypt},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "save_from_archive_encrypted")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			uuid := "00000000-0000-0000-0000-000000000001"
+			archiveDir := path.Join(tmpdir, "archive")
+			require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+			var buf bytes.Buffer
+			w, err := archive.NewEncryptWriter(&buf, encryptionKey)
+			require.Nil(t, err)
+			require.Nil(t, archive.Create(w, archiveDir, uuid))
+			require.Nil(t, w.Close())
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			key := uuid + ".tar.gz.enc"
+			require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+			sum := sha256.Sum256(buf.Bytes())
+			require.Nil(t, archive.WriteChecksum(ctx, bucket, key, sum[:], nil))
+
+			dest := path.Join(tmpdir, "dest")
+			require.NotNil(t, saveFromArchive(ctx, bucket, key, dest, downloadOptions{}), "encrypted archive restored without a key")
+
+			err = saveFromArchive(ctx, bucket, key, dest, downloadOptions{EncryptionKey: tt.key})
+			require.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				_, err = os.Stat(path.Join(dest, uuid, "cluster", "cluster-state.txt"))
+				require.Nil(t, err)
+			}
+		})
+	}
+}
+
 func TestParseID(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -147,6 +269,34 @@ func TestFind(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"parts",
+			[]string{
+				"2006-01-02-15-04-01/a.tar.gz",
+				"2022-06-13-00-00-00/a.tar.gz.part-0000",
+				"2022-06-13-00-00-00/a.tar.gz.part-0001",
+				"2022-06-13-00-00-00/a.tar.gz.parts",
+				"2022-06-13-00-00-00/b.tar.gz",
+				"2022-06-14-00-00-00/a.tar.gz.part-0000",
+			},
+			[]string{
+				"2022-06-13-00-00-00/a.tar.gz",
+				"2022-06-13-00-00-00/b.tar.gz",
+			},
+			false,
+		},
+		{
+			"zone offsets",
+			[]string{
+				"2022-06-13-00-30-00/a.tar.gz",
+				"2022-06-13-01-00-00+0200/a.tar.gz",
+				"2022-06-12-19-00-00-0500/a.tar.gz",
+			},
+			[]string{
+				"2022-06-13-00-30-00/a.tar.gz",
+			},
+			false,
+		},
 		{
 			"mixed",
 			[]string{
@@ -159,6 +309,21 @@ func TestFind(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"directory layout",
+			[]string{
+				"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000001.tar.gz",
+				"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000002/cluster/cluster-state.txt",
+				"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000002/s00/value/01/0000000000000001.chunk",
+				"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001/cluster/cluster-state.txt",
+				"2022-06-13-00-00-00/not-a-uuid/cluster/cluster-state.txt",
+			},
+			[]string{
+				"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001/",
+				"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000002/",
+			},
+			false,
+		},
 	}
 
 	ctx := context.Background()
@@ -173,7 +338,7 @@ func TestFind(t *testing.T) {
 			}
 
 			// test
-			got, err := find(ctx, bucket)
+			got, err := find(ctx, bucket, backupSelector{Location: time.UTC}, bkt.Retry{})
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -182,3 +347,287 @@ func TestFind(t *testing.T) {
 		})
 	}
 }
+
+func TestFindAt(t *testing.T) {
+	keys := []string{
+		"2022-06-12-00-00-00/a.tar.gz",
+		"2022-06-13-00-00-00/a.tar.gz",
+		"2022-06-13-00-00-00/b.tar.gz",
+		"2022-06-14-02-00-00+0200/a.tar.gz",
+	}
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02-15-04-05", s)
+		require.Nil(t, err)
+		return v
+	}
+	tests := []struct {
+		name    string
+		keys    []string
+		at      time.Time
+		want    []string
+		wantErr string
+	}{
+		{"older backup", keys, at("2022-06-12-00-00-00"), []string{"2022-06-12-00-00-00/a.tar.gz"}, ""},
+		{"all members", keys, at("2022-06-13-00-00-00"), []string{"2022-06-13-00-00-00/a.tar.gz", "2022-06-13-00-00-00/b.tar.gz"}, ""},
+		{"zone offset", keys, at("2022-06-14-00-00-00"), []string{"2022-06-14-02-00-00+0200/a.tar.gz"}, ""},
+		{
+			"missing",
+			keys,
+			at("2022-06-15-00-00-00"),
+			nil,
+			"backup 2022-06-15-00-00-00 not found, available backups: 2022-06-12-00-00-00, 2022-06-13-00-00-00, 2022-06-14-02-00-00+0200",
+		},
+		{"no folders", []string{"a.tar.gz"}, at("2022-06-12-00-00-00"), nil, "backup 2022-06-12-00-00-00 not found, there are no dated backup folders in the bucket"},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			for _, k := range tt.keys {
+				require.Nil(t, bucket.WriteAll(ctx, k, []byte(""), nil))
+			}
+
+			got, err := find(ctx, bucket, backupSelector{Location: time.UTC, At: tt.at}, bkt.Retry{})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindKey(t *testing.T) {
+	keys := []string{
+		"2022-06-13-00-00-00/a.tar.gz",
+		"2022-06-13-00-00-00/b.tar.gz.part-0000",
+		"2022-06-13-00-00-00/b.tar.gz.parts",
+		"2022-06-14-00-00-00/a.tar.gz",
+		"2022-06-14-00-00-00/00000000-0000-0000-0000-000000000001/cluster/cluster-state.txt",
+	}
+	tests := []struct {
+		name    string
+		key     string
+		want    []string
+		wantErr string
+	}{
+		{"older folder", "2022-06-13-00-00-00/a.tar.gz", []string{"2022-06-13-00-00-00/a.tar.gz"}, ""},
+		{"parts", "2022-06-13-00-00-00/b.tar.gz", []string{"2022-06-13-00-00-00/b.tar.gz"}, ""},
+		{"missing", "2022-06-14-00-00-00/b.tar.gz", nil, "backup 2022-06-14-00-00-00/b.tar.gz not found in the bucket"},
+		{"directory", "2022-06-14-00-00-00/00000000-0000-0000-0000-000000000001", []string{"2022-06-14-00-00-00/00000000-0000-0000-0000-000000000001/"}, ""},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	for _, k := range keys {
+		require.Nil(t, bucket.WriteAll(ctx, k, []byte(""), nil))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := find(ctx, bucket, backupSelector{Location: time.UTC, Key: tt.key}, bkt.Retry{})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRestoreOrRollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		restoreErr error
+		want       string
+	}{
+		{"successful restore removes original data", nil, "00000000-0000-0000-0000-000000000002"},
+		{"failed restore rolls back original data", errors.New("download failed"), "00000000-0000-0000-0000-000000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir, err := os.MkdirTemp("", "restore_rollback")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			err = fileutil.CreateFiles(tmpdir, []fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001/cluster/members.bin"},
+			}, false)
+			require.Nil(t, err)
+
+			// Test
+			local, err := moveAsideHotRestart(tmpdir)
+			require.Nil(t, err)
+			require.DirExists(t, path.Join(tmpdir, "00000000-0000-0000-0000-000000000001.bak"))
+
+			err = restoreOrRollback(local, func() error {
+				err := fileutil.CreateFiles(tmpdir, []fileutil.File{
+					{Name: "00000000-0000-0000-0000-000000000002/cluster", IsDir: true},
+				}, false)
+				require.Nil(t, err)
+				return tt.restoreErr
+			})
+			require.Equal(t, tt.restoreErr, err)
+
+			files, err := os.ReadDir(tmpdir)
+			require.Nil(t, err)
+			require.Len(t, files, 1)
+			require.Equal(t, tt.want, files[0].Name())
+			if tt.restoreErr != nil {
+				require.FileExists(t, path.Join(tmpdir, tt.want, "cluster/members.bin"))
+			}
+		})
+	}
+}
+
+func TestMoveAsideRecoversInterruptedRestore(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_recover")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	err = fileutil.CreateFiles(tmpdir, []fileutil.File{
+		// interrupted before the new data was written
+		{Name: "00000000-0000-0000-0000-000000000001.bak", IsDir: true},
+		// interrupted while the restored data was moved in, the original data is the only good copy
+		{Name: "00000000-0000-0000-0000-000000000002", IsDir: true},
+		{Name: "00000000-0000-0000-0000-000000000002/partial", IsDir: false},
+		{Name: "00000000-0000-0000-0000-000000000002.bak", IsDir: true},
+		{Name: "00000000-0000-0000-0000-000000000002.bak/original", IsDir: false},
+		// interrupted while extracting
+		{Name: restoreTmpPrefix + "123/00000000-0000-0000-0000-000000000003", IsDir: true},
+	}, false)
+	require.Nil(t, err)
+
+	local, err := moveAsideHotRestart(tmpdir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}, local.names)
+
+	require.Nil(t, local.rollback())
+	f, err := fileutil.FolderUUIDs(tmpdir)
+	require.Nil(t, err)
+	require.Len(t, f, 2)
+	require.NoDirExists(t, path.Join(tmpdir, "00000000-0000-0000-0000-000000000002.bak"))
+	require.FileExists(t, path.Join(tmpdir, "00000000-0000-0000-0000-000000000002", "original"))
+	require.NoFileExists(t, path.Join(tmpdir, "00000000-0000-0000-0000-000000000002", "partial"))
+	require.NoDirExists(t, path.Join(tmpdir, restoreTmpPrefix+"123"))
+}
+
+func TestRecoverHotRestartAfterSwap(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(dir, []fileutil.File{
+		{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+		{Name: "00000000-0000-0000-0000-000000000001/restored", IsDir: false},
+		{Name: "00000000-0000-0000-0000-000000000001.bak", IsDir: true},
+	}, false))
+	// interrupted while the original data was removed
+	require.Nil(t, os.WriteFile(path.Join(dir, swappedMarker), nil, 0600))
+
+	require.Nil(t, recoverHotRestart(dir))
+	require.FileExists(t, path.Join(dir, "00000000-0000-0000-0000-000000000001", "restored"))
+	require.NoDirExists(t, path.Join(dir, "00000000-0000-0000-0000-000000000001.bak"))
+	require.NoFileExists(t, path.Join(dir, swappedMarker))
+}
+
+func TestRestoreKeepingExisting(t *testing.T) {
+	const (
+		old      = "00000000-0000-0000-0000-000000000001"
+		restored = "00000000-0000-0000-0000-000000000002"
+	)
+	tests := []struct {
+		name       string
+		files      []fileutil.File
+		extractErr error
+		wantErr    bool
+		want       string
+	}{
+		{"success", []fileutil.File{{Name: restored + "/cluster/members.bin"}}, nil, false, restored},
+		{"failed download", []fileutil.File{{Name: restored + "/cluster/members.bin"}}, errors.New("connection reset"), true, old},
+		{"empty folder", []fileutil.File{{Name: restored, IsDir: true}}, nil, true, old},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: old + "/cluster/members.bin"}}, false))
+
+			err := restoreInto(dst, true, func(tmp string) error {
+				// the existing folder stays in place during the download
+				require.FileExists(t, path.Join(dst, old, "cluster/members.bin"))
+				require.Nil(t, fileutil.CreateFiles(tmp, tt.files, false))
+				return tt.extractErr
+			})
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+
+			entries, err := os.ReadDir(dst)
+			require.Nil(t, err)
+			require.Len(t, entries, 1, "no staging or moved aside folders are left")
+			require.Equal(t, tt.want, entries[0].Name())
+			require.FileExists(t, path.Join(dst, tt.want, "cluster/members.bin"))
+		})
+	}
+}
+
+func TestRestoreKeepingExistingSameUUID(t *testing.T) {
+	const uuid = "00000000-0000-0000-0000-000000000001"
+	dst := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: uuid + "/old.chunk"}}, false))
+
+	err := restoreInto(dst, true, func(tmp string) error {
+		return fileutil.CreateFiles(tmp, []fileutil.File{{Name: uuid + "/new.chunk"}}, false)
+	})
+	require.Nil(t, err)
+	require.FileExists(t, path.Join(dst, uuid, "new.chunk"))
+	require.NoFileExists(t, path.Join(dst, uuid, "old.chunk"))
+	require.NoDirExists(t, path.Join(dst, uuid+backupSuffix))
+}
+
+func TestExtractAtomically(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractFn func(tmp string) error
+		wantErr   bool
+		wantDirs  []string
+	}{
+		{"success", func(tmp string) error {
+			return fileutil.CreateFiles(tmp, []fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+				{Name: "00000000-0000-0000-0000-000000000001/value.chunk"},
+				{Name: "meta/hazelcast.yaml"},
+			}, false)
+		}, false, []string{"00000000-0000-0000-0000-000000000001", "meta"}},
+		{"crash mid extract", func(tmp string) error {
+			err := fileutil.CreateFiles(tmp, []fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+			}, false)
+			require.Nil(t, err)
+			return errors.New("connection reset")
+		}, true, []string{"meta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "restore_extract")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+			// meta data of an older restore
+			require.Nil(t, fileutil.CreateFiles(tmpdir, []fileutil.File{{Name: "meta/old.yaml"}}, false))
+
+			err = extractAtomically(tmpdir, tt.extractFn)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+
+			entries, err := os.ReadDir(tmpdir)
+			require.Nil(t, err)
+			var dirs []string
+			for _, e := range entries {
+				dirs = append(dirs, e.Name())
+			}
+			require.Equal(t, tt.wantDirs, dirs)
+			if !tt.wantErr {
+				require.NoFileExists(t, path.Join(tmpdir, "meta/old.yaml"))
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// maxManifestSize limits the backup manifest that is read into memory
+const maxManifestSize = 1 << 20
+
+// clusterExpectation describes the cluster a backup is restored into, empty fields are not checked
+type clusterExpectation struct {
+	ClusterName    string
+	Version        string
+	PartitionCount int
+	// Force restores a backup that does not match with a warning
+	Force bool
+	// Upgrade accepts backups of older minor versions, their layout is migrated after the restore
+	Upgrade bool
+}
+
+func (e *clusterExpectation) empty() bool {
+	return e == nil || (e.ClusterName == "" && e.Version == "" && e.PartitionCount == 0)
+}
+
+// incompatibleBackupError is returned if the backup manifest does not match the cluster
+type incompatibleBackupError struct {
+	Key      string
+	Problems []string
+}
+
+func (e *incompatibleBackupError) Error() string {
+	return fmt.Sprintf("backup %s is incompatible with the cluster: %s, restore with -force to use it anyway", e.Key, strings.Join(e.Problems, ", "))
+}
+
+// Reason returns the reason reported in the termination message
+func (e *incompatibleBackupError) Reason() string {
+	return api.RestoreReasonIncompatibleBackup
+}
+
+// check compares the manifest of the archive stored under key with the cluster. Fields that the
+// manifest does not know are not compared.
+func (e *clusterExpectation) check(key string, data []byte) error {
+	if e.empty() {
+		return nil
+	}
+	var m api.BackupManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("invalid backup manifest of %s: %w", key, err)
+	}
+
+	var problems []string
+	if e.ClusterName != "" && m.ClusterName != "" && e.ClusterName != m.ClusterName {
+		problems = append(problems, fmt.Sprintf("cluster name %s, expected %s", m.ClusterName, e.ClusterName))
+	}
+	if e.Version != "" && m.HazelcastVersion != "" && !compatibleVersions(e.Version, m.HazelcastVersion) &&
+		!(e.Upgrade && olderVersion(m.HazelcastVersion, e.Version)) {
+		problems = append(problems, fmt.Sprintf("Hazelcast version %s, expected %s", m.HazelcastVersion, e.Version))
+	}
+	if e.PartitionCount > 0 && m.PartitionCount > 0 && e.PartitionCount != m.PartitionCount {
+		problems = append(problems, fmt.Sprintf("partition count %d, expected %d", m.PartitionCount, e.PartitionCount))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	err := &incompatibleBackupError{Key: key, Problems: problems}
+	if !e.Force {
+		return err
+	}
+	bucketToPVCLog.Warn("forcing restore of an incompatible backup: " + err.Error())
+	return nil
+}
+
+// compatibleVersions reports if the persistence formats of two Hazelcast versions match, which
+// is the case for the same minor version, e.g. 5.3.1 and 5.3.6
+func compatibleVersions(a, b string) bool {
+	return minorVersion(a) == minorVersion(b)
+}
+
+// minorVersion returns the major and minor part of a version, e.g. 5.3 of 5.3.2-SNAPSHOT
+func minorVersion(v string) string {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return v
+	}
+	minor, _, _ := strings.Cut(parts[1], "-")
+	return parts[0] + "." + minor
+}
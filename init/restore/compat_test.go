@@ -0,0 +1,110 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func TestClusterExpectationCheck(t *testing.T) {
+	manifest := api.BackupManifest{ClusterName: "prod", HazelcastVersion: "5.1.4", MemberCount: 3, PartitionCount: 271}
+	tests := []struct {
+		name    string
+		expect  *clusterExpectation
+		wantErr string
+	}{
+		{"no expectation", nil, ""},
+		{"matching", &clusterExpectation{ClusterName: "prod", Version: "5.1.7", PartitionCount: 271}, ""},
+		{"cluster name", &clusterExpectation{ClusterName: "dev"}, "cluster name prod, expected dev"},
+		{"version", &clusterExpectation{Version: "5.3.0"}, "Hazelcast version 5.1.4, expected 5.3.0"},
+		{"partition count", &clusterExpectation{PartitionCount: 1021}, "partition count 271, expected 1021"},
+		{"forced", &clusterExpectation{Version: "5.3.0", Force: true}, ""},
+		{"upgrade", &clusterExpectation{Version: "5.3.0", Upgrade: true}, ""},
+		{"no downgrade", &clusterExpectation{Version: "5.0.2", Upgrade: true}, "Hazelcast version 5.1.4, expected 5.0.2"},
+	}
+	data, err := json.Marshal(manifest)
+	require.Nil(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.expect.check("a.tar.gz", data)
+			if tt.wantErr == "" {
+				require.Nil(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+			require.Equal(t, api.RestoreReasonIncompatibleBackup, failureReason(err))
+		})
+	}
+
+	// manifests of older agents know fewer fields
+	require.Nil(t, (&clusterExpectation{ClusterName: "dev", Version: "5.3.0"}).check("a.tar.gz", []byte(`{"partition_count":271}`)))
+}
+
+func TestCompatibleVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"5.3.1", "5.3.6", true},
+		{"5.3", "5.3.2-SNAPSHOT", true},
+		{"v5.3.0", "5.3.0", true},
+		{"5.1.4", "5.3.0", false},
+		{"4.2.8", "5.2.8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			require.Equal(t, tt.want, compatibleVersions(tt.a, tt.b))
+		})
+	}
+}
+
+func TestSaveFromArchiveManifest(t *testing.T) {
+	data, err := json.Marshal(api.BackupManifest{ClusterName: "prod", HazelcastVersion: "5.1.4"})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+	w := tar.NewWriter(g)
+	require.Nil(t, w.WriteHeader(&tar.Header{Name: "meta/", Mode: 0700, Typeflag: tar.TypeDir}))
+	require.Nil(t, w.WriteHeader(&tar.Header{Name: "meta/manifest.json", Mode: 0600, Typeflag: tar.TypeReg, Size: int64(len(data))}))
+	_, err = w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.WriteHeader(&tar.Header{Name: layoutUUID + "/", Mode: 0700, Typeflag: tar.TypeDir}))
+	require.Nil(t, w.WriteHeader(&tar.Header{Name: layoutUUID + "/members.bin", Mode: 0600, Typeflag: tar.TypeReg}))
+	require.Nil(t, w.Close())
+	require.Nil(t, g.Close())
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	key := layoutUUID + ".tar.gz"
+	require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+
+	tmpdir, err := os.MkdirTemp("", "restore_manifest")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// the member data is not written if the manifest does not match
+	dest := path.Join(tmpdir, "rejected")
+	err = saveFromArchive(ctx, bucket, key, dest, downloadOptions{Expect: &clusterExpectation{Version: "5.3.0"}})
+	var incompatible *incompatibleBackupError
+	require.ErrorAs(t, err, &incompatible)
+	require.NoDirExists(t, path.Join(dest, layoutUUID))
+
+	dest = path.Join(tmpdir, "restored")
+	require.Nil(t, saveFromArchive(ctx, bucket, key, dest, downloadOptions{Expect: &clusterExpectation{Version: "5.1.0"}}))
+	got, err := os.ReadFile(path.Join(dest, "meta", "manifest.json"))
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+	require.FileExists(t, path.Join(dest, layoutUUID, "members.bin"))
+}
@@ -0,0 +1,123 @@
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+)
+
+// defaultCompleteFile is written to the destination once the restore succeeded. The entrypoint of the
+// Hazelcast container waits for it instead of relying on the order of the init containers.
+const defaultCompleteFile = "restore_complete"
+
+// restoreComplete is the content of the completion file
+type restoreComplete struct {
+	RestoreID string `json:"restore_id,omitempty"`
+	Hostname  string `json:"hostname"`
+	// Key is the restored archive, empty if the restore was skipped or copied a local backup
+	Key string `json:"key,omitempty"`
+	// ManifestSHA256 is the digest of the restored meta/manifest.json, empty if the backup has none
+	ManifestSHA256 string    `json:"manifest_sha256,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// destinationFile returns a file written by the restore, relative names are in dst. It is empty if
+// the file is disabled.
+func destinationFile(dst, name string) string {
+	if name == "" {
+		return ""
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dst, name)
+}
+
+// removeComplete removes the completion file of an earlier restore before the data is replaced
+func removeComplete(name string) error {
+	if name == "" {
+		return nil
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// writeComplete writes the completion file atomically, the manifest digest is taken from the restored data in dst
+func writeComplete(name, dst string, c restoreComplete, control *ownership) error {
+	if name == "" {
+		return nil
+	}
+	sum, err := manifestDigest(dst)
+	if err != nil {
+		return err
+	}
+	c.ManifestSHA256 = sum
+	c.Time = clock.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, data, control)
+}
+
+// writeFileAtomic writes the file through a temporary file, a reader never sees a partial file and
+// the file survives a crash once it is written. The file gets the ownership of the control files.
+func writeFileAtomic(name string, data []byte, control *ownership) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = control.apply(f.Name(), 0)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// ensureComplete writes the completion file of a skipped restore if it is missing, e.g. for data
+// restored by an agent that did not write it yet
+func ensureComplete(name, dst string, c restoreComplete, control *ownership) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return writeComplete(name, dst, c, control)
+}
+
+func manifestDigest(dst string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dst, archive.MetaDir, archive.BackupManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,78 @@
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+func readComplete(t *testing.T, name string) restoreComplete {
+	data, err := os.ReadFile(name)
+	require.Nil(t, err)
+	var c restoreComplete
+	require.Nil(t, json.Unmarshal(data, &c))
+	return c
+}
+
+func TestWriteComplete(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_complete")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	manifest := []byte(`{"cluster_name":"prod"}`)
+	require.Nil(t, os.Mkdir(path.Join(tmpdir, archive.MetaDir), 0755))
+	require.Nil(t, os.WriteFile(path.Join(tmpdir, archive.MetaDir, archive.BackupManifestName), manifest, 0600))
+
+	name := destinationFile(tmpdir, defaultCompleteFile)
+	require.Nil(t, writeComplete(name, tmpdir, restoreComplete{RestoreID: "12345", Hostname: "hazelcast-0", Key: "2022-07-28-19-00-55/uuid.tar.gz"}, nil))
+
+	sum := sha256.Sum256(manifest)
+	c := readComplete(t, name)
+	require.Equal(t, "12345", c.RestoreID)
+	require.Equal(t, "hazelcast-0", c.Hostname)
+	require.Equal(t, "2022-07-28-19-00-55/uuid.tar.gz", c.Key)
+	require.Equal(t, hex.EncodeToString(sum[:]), c.ManifestSHA256)
+	require.False(t, c.Time.IsZero())
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(tmpdir)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+
+	require.Nil(t, removeComplete(name))
+	_, err = os.Stat(name)
+	require.True(t, os.IsNotExist(err))
+	require.Nil(t, removeComplete(name))
+}
+
+func TestEnsureComplete(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_complete")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// a skipped restore writes a missing file without a manifest digest
+	name := destinationFile(tmpdir, defaultCompleteFile)
+	require.Nil(t, ensureComplete(name, tmpdir, restoreComplete{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+	c := readComplete(t, name)
+	require.Equal(t, "12345", c.RestoreID)
+	require.Empty(t, c.ManifestSHA256)
+
+	// the file of the restore that wrote the data is kept
+	require.Nil(t, ensureComplete(name, tmpdir, restoreComplete{RestoreID: "67890", Hostname: "hazelcast-0"}, nil))
+	require.Equal(t, "12345", readComplete(t, name).RestoreID)
+}
+
+func TestCompleteFileDisabled(t *testing.T) {
+	name := destinationFile("/data/persistence/backup", "")
+	require.Empty(t, name)
+	require.Nil(t, removeComplete(name))
+	require.Nil(t, writeComplete(name, "/data/persistence/backup", restoreComplete{}, nil))
+	require.Equal(t, "/ready/done", destinationFile("/data/persistence/backup", "/ready/done"))
+}
@@ -0,0 +1,55 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// The control files are the files the agent writes next to the data to coordinate with later runs
+// and with the Hazelcast container: the restore lock, the completion file, the result file, the
+// metadata marker and the progress of the staging files. An agent running as root writes them as
+// root, so that an agent or an entrypoint running as another user cannot read them later.
+// -control-chown and -control-chmod give them another ownership.
+
+// prepareControlFiles brings the control files of an earlier run to the ownership of the control
+// files and fails if the agent cannot read them. It returns the files the container user cannot
+// read. Empty names and missing files are skipped.
+func prepareControlFiles(u *containerUser, control *ownership, names ...string) ([]string, error) {
+	var unreadable []string
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = control.apply(name, info.Mode()); err != nil {
+			return nil, err
+		}
+		f, err := os.Open(name)
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, fmt.Errorf("control file %s of an earlier run cannot be read by the agent, set -control-chown to the uid:gid the agent runs as, or remove the file: %w", describe(name, info), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+
+		if u == nil {
+			continue
+		}
+		if info, err = os.Stat(name); err != nil {
+			return nil, err
+		}
+		if !u.canRead(info) {
+			unreadable = append(unreadable, describe(name, info))
+		}
+	}
+	return unreadable, nil
+}
@@ -0,0 +1,65 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlFilesOwnership(t *testing.T) {
+	dir := t.TempDir()
+	control := &ownership{uid: -1, gid: -1, fileMode: 0640}
+	lock := filepath.Join(dir, lockFileName("12345", 0))
+	complete := filepath.Join(dir, defaultCompleteFile)
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, control))
+	require.Nil(t, writeComplete(complete, dir, restoreComplete{Hostname: "hazelcast-0"}, control))
+	progress := stagingName(dir, "2022-07-28-19-00-55/member.tar.gz") + ".progress"
+	require.Nil(t, writeStagingProgress(progress, &stagingProgress{}, control))
+	require.Equal(t, []string{progress}, stagingProgressFiles(dir))
+	marker := filepath.Join(dir, metadataReadyFile)
+	w := newDiskWriter(0, 0, 0)
+	require.Nil(t, newMetadataMarker(marker, "2022-07-28-19-00-55/member.tar.gz", dir, control).mark(w))
+	require.Nil(t, w.close())
+	for _, name := range []string{lock, complete, progress, marker} {
+		info, err := os.Stat(name)
+		require.Nil(t, err)
+		require.Equal(t, os.FileMode(0640), info.Mode(), name)
+	}
+}
+
+func TestPrepareControlFiles(t *testing.T) {
+	dir := t.TempDir()
+	lock := filepath.Join(dir, lockFileName("12345", 0))
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+
+	// missing and disabled files are skipped
+	unreadable, err := prepareControlFiles(nil, nil, lock, filepath.Join(dir, defaultCompleteFile), "")
+	require.Nil(t, err)
+	require.Empty(t, unreadable)
+
+	// the lock of an earlier run gets the ownership of the control files
+	_, err = prepareControlFiles(nil, &ownership{uid: -1, gid: -1, fileMode: 0644}, lock)
+	require.Nil(t, err)
+	info, err := os.Stat(lock)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode())
+
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	user := &containerUser{uid: 1000, gids: []int{1000}}
+	require.Nil(t, os.Chmod(lock, 0600))
+	unreadable, err = prepareControlFiles(user, nil, lock)
+	require.Nil(t, err)
+	require.Len(t, unreadable, 1)
+
+	unreadable, err = prepareControlFiles(user, &ownership{uid: 1000, gid: 1000}, lock)
+	require.Nil(t, err)
+	require.Empty(t, unreadable)
+	info, err = os.Stat(lock)
+	require.Nil(t, err)
+	require.Equal(t, uint32(1000), info.Sys().(*syscall.Stat_t).Uid)
+}
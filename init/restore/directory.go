@@ -0,0 +1,156 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/download"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// Backups synced to the bucket as individual objects, e.g. with rclone or the snapshots of the
+// sidecar, have no archive. The objects of a member are stored below a folder named by its UUID,
+// <folder>/<uuid>/<path>, the key of the backup is the folder with a trailing slash.
+
+// directoryKey returns the key of the member folder the object is stored in, false if it is in none
+func directoryKey(objKey string) (string, bool) {
+	parts := strings.Split(objKey, "/")
+	// the last part is the name of the object itself
+	for i := 0; i < len(parts)-1; i++ {
+		if fileutil.UUIDRegex.MatchString(parts[i]) {
+			return strings.Join(parts[:i+1], "/") + "/", true
+		}
+	}
+	return "", false
+}
+
+// isDirectoryKey reports whether the key names a member folder instead of an archive
+func isDirectoryKey(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// directoryObjects lists the objects of the member folder with their paths relative to it
+func directoryObjects(ctx context.Context, bucket *blob.Bucket, key string, retry bkt.Retry) ([]stagedObject, error) {
+	var objects []stagedObject
+	err := retry.Do(ctx, "listing "+key, func() error {
+		objects = objects[:0]
+		iter := bucket.List(&blob.ListOptions{Prefix: key})
+		for {
+			obj, err := iter.Next(ctx)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// folder placeholders of some sync tools hold no data
+			if obj.IsDir || strings.HasSuffix(obj.Key, "/") {
+				continue
+			}
+			objects = append(objects, stagedObject{Key: obj.Key, Size: obj.Size, ModTime: obj.ModTime})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("backup folder %s has no objects", key)
+	}
+	return objects, nil
+}
+
+// saveFromDirectory downloads the objects of the member folder concurrently into the UUID folder of target
+func saveFromDirectory(ctx context.Context, bucket *blob.Bucket, key, target string, opts downloadOptions) error {
+	if opts.Version != "" {
+		return fmt.Errorf("versions can only be pinned for archives, %s is a folder of objects", key)
+	}
+	if opts.EncryptionKey != nil {
+		bucketToPVCLog.Info("backup folder is not encrypted, ignoring the encryption secret", zap.String("key", key))
+	}
+
+	start := time.Now()
+	objects, err := directoryObjects(ctx, bucket, key, opts.Retry)
+	if err != nil {
+		return err
+	}
+	latency := time.Since(start)
+
+	uuid := path.Base(strings.TrimSuffix(key, "/"))
+	names := make([]string, 0, len(objects))
+	sizes := make(map[string]int64, len(objects))
+	var total int64
+	for _, o := range objects {
+		rel := path.Clean(strings.TrimPrefix(o.Key, key))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("object %s is outside of the backup folder %s", o.Key, key)
+		}
+		names = append(names, rel)
+		sizes[rel] = o.Size
+		total += o.Size
+	}
+	opts.Progress.setTotal(total)
+	bucketToPVCLog.Info("restoring backup folder", zap.String("key", key), zap.Int("objects", len(objects)), zap.Int64("bytes", total))
+
+	report := download.All(ctx, names, download.Options{Retries: opts.Retries, Backoff: time.Second, Concurrency: bkt.Concurrency(len(names), latency)},
+		func(ctx context.Context, rel string) error {
+			return saveObject(ctx, bucket, key+rel, filepath.Join(target, uuid, filepath.FromSlash(rel)), sizes[rel], latency, opts)
+		})
+	opts.Progress.addRetries(report.Retries())
+	if err = report.Err(); err != nil {
+		for _, r := range report.Files {
+			if !r.Success {
+				return fmt.Errorf("%w, object %s: %s", err, key+r.Name, r.Error)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// saveObject writes the object to name, a failed attempt leaves no partial file behind
+func saveObject(ctx context.Context, bucket *blob.Bucket, key, name string, size int64, latency time.Duration, opts downloadOptions) error {
+	if err := opts.Owner.mkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, bkt.ReadBufferSize(size, latency))
+	err = opts.Owner.apply(name, 0)
+	var n int64
+	if err == nil {
+		n, err = io.CopyBuffer(f, opts.Progress.reader(opts.Throttle.Reader(ctx, r)), buf)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if rerr := os.Remove(name); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			bucketToPVCLog.Warn("could not remove partial file: " + rerr.Error())
+		}
+		return err
+	}
+	opts.Progress.addExtracted(n)
+	return nil
+}
@@ -0,0 +1,46 @@
+package restore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+)
+
+func TestDirectoryKey(t *testing.T) {
+	tests := []struct {
+		objKey string
+		want   string
+		ok     bool
+	}{
+		{"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001/cluster/members.bin", "2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001/", true},
+		{"00000000-0000-0000-0000-000000000001/cluster/members.bin", "00000000-0000-0000-0000-000000000001/", true},
+		// the object itself is no folder
+		{"2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001", "", false},
+		{"2022-06-13-00-00-00/member/cluster/members.bin", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.objKey, func(t *testing.T) {
+			got, ok := directoryKey(tt.objKey)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSaveFromDirectoryOutside(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	key := "2022-06-13-00-00-00/00000000-0000-0000-0000-000000000001/"
+	require.Nil(t, bucket.WriteAll(ctx, key+"../escape", []byte("x"), nil))
+
+	err := saveFromDirectory(ctx, bucket, key, t.TempDir(), downloadOptions{Retry: bkt.Retry{}})
+	require.ErrorContains(t, err, "outside of the backup folder")
+
+	_, err = directoryObjects(ctx, bucket, "2022-06-13-00-00-00/00000000-0000-0000-0000-000000000002/", bkt.Retry{})
+	require.ErrorContains(t, err, "has no objects")
+}
@@ -0,0 +1,157 @@
+package restore
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Policies for symlink entries of an archive
+const (
+	// symlinkSkip does not create symlinks and reports them
+	symlinkSkip = "skip"
+	// symlinkAllow creates symlinks that point into the target folder
+	symlinkAllow = "allow"
+	// symlinkDeny fails the restore on the first symlink
+	symlinkDeny = "deny"
+)
+
+func validSymlinkPolicy(p string) error {
+	switch p {
+	case symlinkSkip, symlinkAllow, symlinkDeny:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink policy %q, supported are %s, %s and %s", p, symlinkSkip, symlinkAllow, symlinkDeny)
+}
+
+// entryChecker decides which archive entries are extracted. Hot-restart backups only hold
+// directories and regular files, other entry types are skipped and counted.
+type entryChecker struct {
+	symlinks string
+	// links are the targets of the symlinks created so far by their names
+	links   map[string]string
+	skipped map[string]int
+}
+
+// maxLinkDepth limits the symlinks followed to resolve a link target, like ELOOP of the kernel
+const maxLinkDepth = 40
+
+func newEntryChecker(symlinks string) *entryChecker {
+	if symlinks == "" {
+		symlinks = symlinkSkip
+	}
+	return &entryChecker{symlinks: symlinks, links: make(map[string]string), skipped: make(map[string]int)}
+}
+
+// check returns true if the entry with the name relative to the target folder is extracted
+func (c *entryChecker) check(name string, h *tar.Header) (bool, error) {
+	// nothing is written through or over a symlink of the archive
+	for l := range c.links {
+		if name == l || strings.HasPrefix(name, l+"/") {
+			return false, fmt.Errorf("archive entry %s is written through the symlink %s", name, l)
+		}
+	}
+
+	switch h.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeDir:
+		return true, nil
+	case tar.TypeSymlink:
+		switch c.symlinks {
+		case symlinkAllow:
+			if err := c.checkLinkTarget(name, h.Linkname); err != nil {
+				return false, err
+			}
+			c.links[name] = h.Linkname
+			return true, nil
+		case symlinkDeny:
+			return false, fmt.Errorf("archive entry %s is a symlink", name)
+		}
+	}
+
+	t := entryType(h.Typeflag)
+	c.skipped[t]++
+	bucketToPVCLog.Warn("skipping archive entry", zap.String("name", name), zap.String("type", t))
+	return false, nil
+}
+
+// checkLinkTarget rejects symlinks that are absolute or point outside of the target folder. The
+// target is resolved through the symlinks created so far, a chain of links must not leave the
+// target folder either.
+func (c *entryChecker) checkLinkTarget(name, link string) error {
+	if path.IsAbs(link) {
+		return fmt.Errorf("archive entry %s is a symlink to the absolute path %s", name, link)
+	}
+	if _, err := c.resolve(path.Dir(name)+"/"+link, 0); err != nil {
+		return fmt.Errorf("archive entry %s is a symlink outside of the target folder: %s: %w", name, link, err)
+	}
+	return nil
+}
+
+// resolve returns the path p relative to the target folder with the symlinks created so far
+// followed. p is not cleaned up front, ".." after a symlink leaves the folder the link points to.
+func (c *entryChecker) resolve(p string, depth int) (string, error) {
+	var parts []string
+	for _, elem := range strings.Split(p, "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(parts) == 0 {
+				return "", fmt.Errorf("%s leaves the target folder", p)
+			}
+			parts = parts[:len(parts)-1]
+			continue
+		}
+		cur := path.Join(append(parts, elem)...)
+		link, ok := c.links[cur]
+		if !ok {
+			parts = append(parts, elem)
+			continue
+		}
+		if path.IsAbs(link) || depth >= maxLinkDepth {
+			return "", fmt.Errorf("the symlink %s cannot be followed", cur)
+		}
+		resolved, err := c.resolve(path.Dir(cur)+"/"+link, depth+1)
+		if err != nil {
+			return "", err
+		}
+		parts = nil
+		if resolved != "" {
+			parts = strings.Split(resolved, "/")
+		}
+	}
+	return path.Join(parts...), nil
+}
+
+// report logs the number of skipped entries by type
+func (c *entryChecker) report() {
+	if len(c.skipped) == 0 {
+		return
+	}
+	fields := make([]zap.Field, 0, len(c.skipped))
+	for t, n := range c.skipped {
+		fields = append(fields, zap.Int(t, n))
+	}
+	bucketToPVCLog.Warn("skipped archive entries of unsupported types", fields...)
+}
+
+func entryType(flag byte) string {
+	switch flag {
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hard link"
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	case tar.TypeXGlobalHeader:
+		return "pax global header"
+	}
+	return fmt.Sprintf("type %q", flag)
+}
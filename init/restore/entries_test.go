@@ -0,0 +1,164 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestSaveFromArchiveEntries(t *testing.T) {
+	dir := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Mode: 0700, Typeflag: tar.TypeDir}
+	}
+	file := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Mode: 0600, Typeflag: tar.TypeReg}
+	}
+	symlink := func(name, link string) *tar.Header {
+		return &tar.Header{Name: name, Linkname: link, Mode: 0777, Typeflag: tar.TypeSymlink}
+	}
+	uuidDir := layoutUUID + "/"
+
+	tests := []struct {
+		name     string
+		symlinks string
+		headers  []*tar.Header
+		want     []fileutil.File
+		wantErr  string
+	}{
+		{
+			"parent traversal", symlinkSkip,
+			[]*tar.Header{dir(uuidDir), file(layoutUUID + "/../../evil")},
+			nil, "outside of the target folder",
+		},
+		{
+			"symlink skipped", symlinkSkip,
+			[]*tar.Header{dir(uuidDir), dir(uuidDir + "cluster/"), symlink(uuidDir+"link", "cluster"), file(uuidDir + "cluster/members.bin")},
+			[]fileutil.File{{Name: layoutUUID, IsDir: true}, {Name: layoutUUID + "/cluster", IsDir: true}, {Name: layoutUUID + "/cluster/members.bin"}},
+			"",
+		},
+		{
+			"symlink denied", symlinkDeny,
+			[]*tar.Header{dir(uuidDir), symlink(uuidDir+"link", "cluster")},
+			nil, "is a symlink",
+		},
+		{
+			"symlink allowed", symlinkAllow,
+			[]*tar.Header{dir(uuidDir), dir(uuidDir + "cluster/"), symlink(uuidDir+"link", "cluster")},
+			[]fileutil.File{{Name: layoutUUID, IsDir: true}, {Name: layoutUUID + "/cluster", IsDir: true}, {Name: layoutUUID + "/link"}},
+			"",
+		},
+		{
+			"absolute symlink", symlinkAllow,
+			[]*tar.Header{dir(uuidDir), symlink(uuidDir+"link", "/etc")},
+			nil, "absolute path",
+		},
+		{
+			"symlink escaping", symlinkAllow,
+			[]*tar.Header{dir(uuidDir), symlink(uuidDir+"link", "../../etc")},
+			nil, "outside of the target folder",
+		},
+		{
+			"write through symlink", symlinkAllow,
+			[]*tar.Header{dir(uuidDir), dir(uuidDir + "cluster/"), symlink(uuidDir+"link", "cluster"), file(uuidDir + "link/members.bin")},
+			nil, "through the symlink",
+		},
+		{
+			"overwrite symlink", symlinkAllow,
+			[]*tar.Header{dir(uuidDir), symlink(uuidDir+"link", "members.bin"), file(uuidDir + "link")},
+			nil, "through the symlink",
+		},
+		{
+			"special entries skipped", symlinkAllow,
+			[]*tar.Header{
+				dir(uuidDir),
+				file(uuidDir + "members.bin"),
+				{Name: uuidDir + "hard", Linkname: uuidDir + "members.bin", Typeflag: tar.TypeLink},
+				{Name: uuidDir + "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3},
+				{Name: uuidDir + "fifo", Typeflag: tar.TypeFifo},
+			},
+			[]fileutil.File{{Name: layoutUUID, IsDir: true}, {Name: layoutUUID + "/members.bin"}},
+			"",
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			key := layoutUUID + ".tar.gz"
+			require.Nil(t, bucket.WriteAll(ctx, key, tarGzHeaders(t, tt.headers), nil))
+
+			tmpdir, err := os.MkdirTemp("", "restore_entries")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+			dest := path.Join(tmpdir, "dest")
+
+			err = saveFromArchive(ctx, bucket, key, dest, downloadOptions{Symlinks: tt.symlinks})
+			// nothing is ever written next to the destination
+			entries, rerr := os.ReadDir(tmpdir)
+			require.Nil(t, rerr)
+			for _, e := range entries {
+				require.Equal(t, "dest", e.Name())
+			}
+			if tt.wantErr != "" {
+				require.NotNil(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			got, err := fileutil.DirFileList(dest)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckLinkTarget(t *testing.T) {
+	c := newEntryChecker(symlinkAllow)
+	require.Nil(t, c.checkLinkTarget("uuid/a/link", "../b"))
+	require.Nil(t, c.checkLinkTarget("uuid/link", "../other-uuid"))
+	require.NotNil(t, c.checkLinkTarget("uuid/link", "../../b"))
+	require.NotNil(t, c.checkLinkTarget("link", ".."))
+	require.NotNil(t, c.checkLinkTarget("uuid/link", "/data"))
+
+	// targets are resolved through the links created before
+	link := func(name, target string) error {
+		_, err := c.check(name, &tar.Header{Typeflag: tar.TypeSymlink, Linkname: target})
+		return err
+	}
+	require.Nil(t, link("d/a", ".."))
+	require.NotNil(t, link("e", "d/a/.."), "d/a is the target folder itself")
+	require.Nil(t, link("f", "d/a/d"))
+	require.NotNil(t, link("g", "f/a/.."))
+	require.Nil(t, link("h", "f/a/uuid"))
+	require.NotNil(t, link("d/a/b", "../.."), "written through d/a")
+
+	// a cycle of links is not followed forever
+	cycle := newEntryChecker(symlinkAllow)
+	cycle.links["x"] = "y"
+	cycle.links["y"] = "x"
+	require.NotNil(t, cycle.checkLinkTarget("z", "x/.."))
+	require.Nil(t, validSymlinkPolicy(symlinkAllow))
+	require.NotNil(t, validSymlinkPolicy("follow"))
+}
+
+func tarGzHeaders(t *testing.T, headers []*tar.Header) []byte {
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+	w := tar.NewWriter(g)
+	for _, h := range headers {
+		require.Nil(t, w.WriteHeader(h))
+	}
+	require.Nil(t, w.Close())
+	require.Nil(t, g.Close())
+	return buf.Bytes()
+}
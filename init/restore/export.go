@@ -0,0 +1,178 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/download"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+// Snapshots written by the data export tools of Hazelcast hold an export file per map instead of
+// hot-restart folders, below the export folder of a dated folder or of the top of the bucket, e.g.
+// 2022-06-13-00-00-00/export/orders.json.gz. They are restored by placing the files into the import
+// directory the cluster loads its maps from, for clusters moving from exports to hot-restart.
+
+const (
+	sourceHotRestart = "hot-restart"
+	sourceExport     = "export"
+)
+
+// exportDir is the folder of a snapshot holding its export files
+const exportDir = "export"
+
+func validSourceFormat(f string) error {
+	switch f {
+	case sourceHotRestart, sourceExport:
+		return nil
+	}
+	return fmt.Errorf("unknown source format %q, supported are %s and %s", f, sourceHotRestart, sourceExport)
+}
+
+// exportMapName returns the map of an export file, its name up to the first dot
+func exportMapName(rel string) string {
+	name, _, _ := strings.Cut(path.Base(rel), ".")
+	return name
+}
+
+// findExport returns the export folder of the selected snapshot with a trailing slash. Like backups,
+// the latest dated folder with export files is selected unless the selector names a time.
+func findExport(ctx context.Context, bucket *blob.Bucket, sel backupSelector, retry bkt.Retry) (string, error) {
+	folders, err := listDatedFolders(ctx, bucket, sel.Location, retry)
+	if err != nil {
+		return "", err
+	}
+	if !sel.At.IsZero() {
+		times := make(map[string]time.Time, len(folders))
+		for _, f := range folders {
+			times[f.name] = f.time
+		}
+		dir, err := selectFolder(times, sel.At)
+		if err != nil {
+			return "", err
+		}
+		folders = []datedFolder{{name: dir, time: times[dir]}}
+	}
+
+	// exports that are not in dated folders
+	prefixes := []string{exportDir + "/"}
+	if len(folders) > 0 {
+		prefixes = prefixes[:0]
+		for _, f := range folders {
+			prefixes = append(prefixes, f.name+"/"+exportDir+"/")
+		}
+	}
+	for _, prefix := range prefixes {
+		keys, err := listKeys(ctx, bucket, prefix, retry)
+		if err != nil {
+			return "", err
+		}
+		for _, k := range keys {
+			if !strings.HasSuffix(k, "/") {
+				return prefix, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("there are no exported snapshots in the bucket")
+}
+
+// saveExport downloads the export files below key into dir. The files are downloaded into a
+// temporary folder first and replace the files of the same names once all of them succeeded.
+func saveExport(ctx context.Context, bucket *blob.Bucket, key, dir string, opts downloadOptions) error {
+	if opts.Version != "" {
+		return fmt.Errorf("versions can only be pinned for archives, %s is an exported snapshot", key)
+	}
+	if opts.EncryptionKey != nil {
+		bucketToPVCLog.Info("exported snapshot is not encrypted, ignoring the encryption secret", zap.String("key", key))
+	}
+
+	start := time.Now()
+	objects, err := directoryObjects(ctx, bucket, key, opts.Retry)
+	if err != nil {
+		return err
+	}
+	latency := time.Since(start)
+
+	names := make([]string, 0, len(objects))
+	sizes := make(map[string]int64, len(objects))
+	maps := make(map[string]bool)
+	var total int64
+	for _, o := range objects {
+		rel := path.Clean(strings.TrimPrefix(o.Key, key))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("object %s is outside of the exported snapshot %s", o.Key, key)
+		}
+		if exportMapName(rel) == "" {
+			return fmt.Errorf("export file %s has no map name", o.Key)
+		}
+		names = append(names, rel)
+		sizes[rel] = o.Size
+		maps[exportMapName(rel)] = true
+		total += o.Size
+	}
+	opts.Progress.setTotal(total)
+	bucketToPVCLog.Info("restoring exported snapshot", zap.String("key", key), zap.Int("maps", len(maps)), zap.Int("files", len(objects)), zap.Int64("bytes", total))
+
+	if err = opts.Owner.mkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// partial downloads of an interrupted restore
+	if err = recoverHotRestart(dir); err != nil {
+		return err
+	}
+	return extractAtomically(dir, func(tmp string) error {
+		report := download.All(ctx, names, download.Options{Retries: opts.Retries, Backoff: time.Second, Concurrency: bkt.Concurrency(len(names), latency)},
+			func(ctx context.Context, rel string) error {
+				return saveObject(ctx, bucket, key+rel, filepath.Join(tmp, filepath.FromSlash(rel)), sizes[rel], latency, opts)
+			})
+		opts.Progress.addRetries(report.Retries())
+		if err := report.Err(); err != nil {
+			for _, r := range report.Files {
+				if !r.Success {
+					return fmt.Errorf("%w, object %s: %s", err, key+r.Name, r.Error)
+				}
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// downloadExport restores the export files of the selected snapshot from the first reachable bucket
+// with exported snapshots into dir. Every member places the same files.
+func downloadExport(ctx context.Context, srcs []string, dir string, secretData map[string][]byte, sel backupSelector, opts downloadOptions) (restoreResult, error) {
+	var res restoreResult
+	var b *blob.Bucket
+	var key string
+	src, err := bkt.Failover(ctx, srcs, func(src string) error {
+		var err error
+		if b, err = bkt.OpenBucket(ctx, src, secretData); err == nil {
+			if key, err = findExport(ctx, b, sel, opts.Retry); err != nil {
+				b.Close()
+			}
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, logger.Redact(src)+": "+err.Error())
+			opts.Progress.addError(logger.Redact(src) + ": " + err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	defer b.Close()
+	res.Bucket, res.Key = src, key
+
+	opts.Progress.setPhase(api.RestorePhaseDownloading)
+	opts.Progress.setArchive(src, key)
+	return res, saveExport(ctx, b, key, dir, opts)
+}
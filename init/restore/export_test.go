@@ -0,0 +1,87 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
+
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+)
+
+func TestExportMapName(t *testing.T) {
+	require.Equal(t, "orders", exportMapName("orders.json.gz"))
+	require.Equal(t, "orders", exportMapName("part-1/orders.csv"))
+	require.Equal(t, "", exportMapName(".hidden"))
+}
+
+func TestFindExport(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	_, err := findExport(ctx, bucket, backupSelector{Location: time.UTC}, bkt.Retry{})
+	require.ErrorContains(t, err, "no exported snapshots")
+
+	require.Nil(t, bucket.WriteAll(ctx, "export/orders.json", []byte("{}"), nil))
+	key, err := findExport(ctx, bucket, backupSelector{Location: time.UTC}, bkt.Retry{})
+	require.Nil(t, err)
+	require.Equal(t, "export/", key)
+
+	// the latest dated folder with export files, the folder of a failed export has none
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-13-00-00-00/export/orders.json", []byte("{}"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-14-00-00-00/00000000-0000-0000-0000-000000000001.tar.gz", []byte("x"), nil))
+	key, err = findExport(ctx, bucket, backupSelector{Location: time.UTC}, bkt.Retry{})
+	require.Nil(t, err)
+	require.Equal(t, "2022-06-13-00-00-00/export/", key)
+
+	_, err = findExport(ctx, bucket, backupSelector{Location: time.UTC, At: time.Date(2022, 6, 14, 0, 0, 0, 0, time.UTC)}, bkt.Retry{})
+	require.ErrorContains(t, err, "no exported snapshots")
+}
+
+func TestDownloadExport(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	bucket, err := fileblob.OpenBucket(src, nil)
+	require.Nil(t, err)
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-13-00-00-00/export/orders.json", []byte("old"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-14-00-00-00/export/orders.json", []byte("orders"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-14-00-00-00/export/customers.csv.gz", []byte("customers"), nil))
+	require.Nil(t, bucket.Close())
+
+	dir := filepath.Join(t.TempDir(), "import")
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	// files of an earlier restore are replaced, other files are kept
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "orders.json"), []byte("stale"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte("other"), 0644))
+
+	res, err := downloadExport(ctx, []string{"file://" + src}, dir, nil, backupSelector{Location: time.UTC}, downloadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "2022-06-14-00-00-00/export/", res.Key)
+	for name, want := range map[string]string{"orders.json": "orders", "customers.csv.gz": "customers", "other.json": "other"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.Nil(t, err)
+		require.Equal(t, want, string(data))
+	}
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 3, "no temporary folder is left")
+
+	_, err = downloadExport(ctx, []string{"file://" + src}, dir, nil, backupSelector{Location: time.UTC}, downloadOptions{Version: "1"})
+	require.ErrorContains(t, err, "versions can only be pinned")
+}
+
+func TestSaveExportOutside(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "export/../escape.json", []byte("x"), nil))
+
+	err := saveExport(ctx, bucket, "export/", t.TempDir(), downloadOptions{})
+	require.ErrorContains(t, err, "outside of the exported snapshot")
+}
@@ -0,0 +1,76 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+// maxListedFiles limits the corrupted files named in the error, all of them are logged
+const maxListedFiles = 10
+
+// corruptedFilesError is returned if restored files do not match the file manifest of the archive
+type corruptedFilesError struct {
+	Key   string
+	Files []string
+	// manifest are the entries the files were compared with
+	manifest []archive.FileEntry
+}
+
+func (e *corruptedFilesError) Error() string {
+	files := e.Files
+	more := ""
+	if len(files) > maxListedFiles {
+		files, more = files[:maxListedFiles], fmt.Sprintf(" and %d more", len(e.Files)-maxListedFiles)
+	}
+	return fmt.Sprintf("%d restored files of %s do not match the file manifest: %s%s", len(e.Files), e.Key, strings.Join(files, ", "), more)
+}
+
+// Reason returns the reason reported in the termination message
+func (e *corruptedFilesError) Reason() string {
+	return api.RestoreReasonCorruptedFiles
+}
+
+// verifyFiles compares the files extracted into target with the file manifest of the archive, or
+// with the files listed in the manifest next to the archive. Archives without either are not checked.
+func verifyFiles(ctx context.Context, bucket *blob.Bucket, key, target string, opts downloadOptions) error {
+	files, err := archive.ReadFileManifest(filepath.Join(target, archive.MetaDir, archive.FileManifestName))
+	if err != nil {
+		return err
+	}
+	// the manifest next to the archive belongs to its latest version
+	if files == nil && opts.Version == "" {
+		var m *archive.ArchiveManifest
+		err = opts.Retry.Do(ctx, "reading the manifest of "+key, func() error {
+			m, err = archive.ReadArchiveManifest(ctx, bucket, key)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			files = m.Files
+		}
+	}
+	if files == nil {
+		bucketToPVCLog.Info("archive has no file manifest, skipping file verification", zap.String("key", key))
+		return nil
+	}
+	corrupted, err := archive.VerifyFiles(ctx, target, files, 0)
+	if err != nil {
+		return err
+	}
+	if len(corrupted) > 0 {
+		bucketToPVCLog.Error("restored files do not match the file manifest", zap.String("key", key), zap.Strings("files", corrupted))
+		return &corruptedFilesError{Key: key, Files: corrupted, manifest: files}
+	}
+	bucketToPVCLog.Info("restored files verified", zap.String("key", key), zap.Int("files", len(files)))
+	return nil
+}
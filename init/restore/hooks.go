@@ -0,0 +1,143 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Hook failure policies
+const (
+	hookFail = "fail"
+	hookWarn = "warn"
+)
+
+// Hook names, passed to the hooks as HOOK_PHASE
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+// Restore results passed to the post hook as HOOK_RESULT
+const (
+	hookSucceeded = "succeeded"
+	hookFailed    = "failed"
+)
+
+func validHookPolicy(p string) error {
+	switch p {
+	case hookFail, hookWarn:
+		return nil
+	default:
+		return fmt.Errorf("unknown hook failure policy %q, expected fail or warn", p)
+	}
+}
+
+// hook is a command run before or after the restore, e.g. to quiesce node-local services or to fix
+// the ownership of the restored files
+type hook struct {
+	Name    string
+	Command []string
+	// Timeout kills the command, 0 means no limit
+	Timeout time.Duration
+	// Policy is fail to fail the restore if the command fails, warn to log a warning only
+	Policy string
+}
+
+func newHook(name, command string, timeout time.Duration, policy string) (hook, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return hook{}, fmt.Errorf("invalid %s hook: %w", name, err)
+	}
+	return hook{Name: name, Command: args, Timeout: timeout, Policy: policy}, nil
+}
+
+// run executes the command with the environment of the agent and env, its output goes to the
+// output of the agent. Nothing is run for an empty command.
+func (h hook) run(ctx context.Context, env []string) error {
+	if len(h.Command) == 0 {
+		return nil
+	}
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	bucketToPVCLog.Info("running "+h.Name+" hook", zap.Strings("command", h.Command))
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	// the output is not piped, a killed command cannot leave the agent waiting for its children
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", h.Timeout)
+	}
+	if err == nil {
+		bucketToPVCLog.Info(h.Name+" hook succeeded", zap.Duration("duration", time.Since(start)))
+		return nil
+	}
+
+	err = fmt.Errorf("%s hook failed: %w", h.Name, err)
+	if h.Policy == hookWarn {
+		bucketToPVCLog.Warn(err.Error())
+		return nil
+	}
+	return err
+}
+
+// splitCommand splits a command line into its arguments. Arguments are separated by spaces, single
+// quotes keep everything, double quotes and backslashes escape spaces and quotes like in a shell.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
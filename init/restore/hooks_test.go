@@ -0,0 +1,87 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "  ", nil, false},
+		{"args", "chown -R 65532:65532  /data", []string{"chown", "-R", "65532:65532", "/data"}, false},
+		{"single quotes", `sh -c 'echo "$HOOK_PHASE" > /tmp/x'`, []string{"sh", "-c", `echo "$HOOK_PHASE" > /tmp/x`}, false},
+		{"double quotes", `notify "restore done" ""`, []string{"notify", "restore done", ""}, false},
+		{"escapes", `touch a\ b \"c\"`, []string{"touch", "a b", `"c"`}, false},
+		{"unterminated quote", `sh -c 'echo`, nil, true},
+		{"unterminated escape", `echo \`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			require.Equal(t, tt.wantErr, err != nil, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHookRun(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_hook")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	out := path.Join(tmpdir, "out")
+
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		policy  string
+		wantErr string
+	}{
+		{"no hook", "", 0, hookFail, ""},
+		{"succeeds", `sh -c 'echo "$HOOK_PHASE $HOOK_RESULT" > ` + out + `'`, time.Minute, hookFail, ""},
+		{"fails", "sh -c 'exit 3'", time.Minute, hookFail, "pre hook failed: exit status 3"},
+		{"fails with warning", "sh -c 'exit 3'", time.Minute, hookWarn, ""},
+		{"not found", "/nonexistent/hook", time.Minute, hookFail, "pre hook failed"},
+		{"times out", "sleep 10", 50 * time.Millisecond, hookFail, "pre hook failed: timed out after 50ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newHook(hookPre, tt.command, tt.timeout, tt.policy)
+			require.Nil(t, err)
+			err = h.run(context.Background(), []string{"HOOK_PHASE=pre", "HOOK_RESULT=succeeded"})
+			if tt.wantErr == "" {
+				require.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	data, err := os.ReadFile(out)
+	require.Nil(t, err)
+	require.Equal(t, "pre succeeded\n", string(data))
+}
+
+func TestBucketToPVCHookEnv(t *testing.T) {
+	r := &BucketToPVCCmd{Destination: "/data/persistence/backup", Hostname: "hazelcast-0", RestoreID: "12345"}
+	require.Equal(t, []string{
+		"HOOK_PHASE=post",
+		"HOOK_DESTINATION=/data/persistence/backup",
+		"HOOK_HOSTNAME=hazelcast-0",
+		"HOOK_RESTORE_ID=12345",
+		"HOOK_RESULT=succeeded",
+		"HOOK_BACKUP_KEY=2022-07-28-19-00-55/uuid.tar.gz",
+	}, r.hookEnv(hookPost, hookSucceeded, "2022-07-28-19-00-55/uuid.tar.gz"))
+	require.Len(t, r.hookEnv(hookPre, "", ""), 4)
+}
@@ -0,0 +1,119 @@
+package restore
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// layout maps the entry names of an archive to the <uuid>/... layout written by the agent. Older
+// agent versions and manual tar invocations stored the backup below leading folders, with
+// absolute paths or without the UUID folder at all.
+type layout struct {
+	// prefix is removed from every entry, entries that are not in a UUID folder below it are skipped
+	prefix string
+	// base is prepended to every entry of archives without the UUID folder
+	base string
+}
+
+// detectLayout detects the layout from a single entry, it returns nil if the entry does not reveal it
+func detectLayout(name string, isDir bool, uuid string) *layout {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		if fileutil.UUIDRegex.MatchString(p) {
+			return &layout{prefix: strings.Join(parts[:i], "/")}
+		}
+	}
+	if isDir {
+		return nil
+	}
+
+	// a file outside of any UUID folder, the archive holds the content of the UUID folder
+	// named by the key, other archives are extracted as they are
+	if !fileutil.UUIDRegex.MatchString(uuid) {
+		return &layout{}
+	}
+	return &layout{base: uuid}
+}
+
+// layoutDetector holds back the first entries until one of them reveals the layout of the archive
+type layoutDetector struct {
+	uuid    string
+	layout  *layout
+	pending []*tar.Header
+}
+
+func newLayoutDetector(key string) *layoutDetector {
+	return &layoutDetector{uuid: archive.TrimExtension(key)}
+}
+
+// add returns the entries that can be extracted. Only directories are held back, a file always
+// decides the layout, so the content of an entry never has to be buffered.
+func (d *layoutDetector) add(h *tar.Header) []*tar.Header {
+	name := cleanName(h.Name)
+	if d.layout != nil || isMeta(name) {
+		return []*tar.Header{h}
+	}
+
+	l := detectLayout(name, h.Typeflag == tar.TypeDir, d.uuid)
+	if l == nil {
+		d.pending = append(d.pending, h)
+		return nil
+	}
+
+	d.layout = l
+	entries := append(d.pending, h)
+	d.pending = nil
+	return entries
+}
+
+// flush returns the held back entries of archives that have no file
+func (d *layoutDetector) flush() []*tar.Header {
+	if d.layout == nil {
+		d.layout = &layout{}
+	}
+	entries := d.pending
+	d.pending = nil
+	return entries
+}
+
+// remap returns the name of the entry relative to the target folder, false if the entry is skipped
+func (d *layoutDetector) remap(name string) (string, bool, error) {
+	name = cleanName(name)
+	if !isMeta(name) && d.layout != nil {
+		if p := d.layout.prefix; p != "" {
+			if name != p && !strings.HasPrefix(name, p+"/") {
+				return "", false, nil
+			}
+			name = strings.TrimPrefix(strings.TrimPrefix(name, p), "/")
+			// only the UUID folders are kept of the folder they were stored in
+			if !fileutil.UUIDRegex.MatchString(strings.SplitN(name, "/", 2)[0]) {
+				return "", false, nil
+			}
+		}
+		if d.layout.base != "" {
+			name = path.Join(d.layout.base, name)
+		}
+	}
+	if name == "" || name == "." {
+		return "", false, nil
+	}
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false, fmt.Errorf("archive entry is outside of the target folder: %s", name)
+	}
+	return name, true, nil
+}
+
+// isMeta reports if the entry is in the configuration snapshot folder, it is never remapped
+func isMeta(name string) bool {
+	return name == archive.MetaDir || strings.HasPrefix(name, archive.MetaDir+"/")
+}
+
+// cleanName removes leading slashes and dot folders, e.g. of "tar -C dir ." invocations
+func cleanName(name string) string {
+	return path.Clean(strings.TrimLeft(name, "/"))
+}
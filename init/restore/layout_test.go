@@ -0,0 +1,132 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+const layoutUUID = "00000000-0000-0000-0000-000000000001"
+
+func TestSaveFromArchiveLayouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		entries []string
+		want    []fileutil.File
+		wantErr bool
+	}{
+		{
+			"current",
+			layoutUUID + ".tar.gz",
+			[]string{"meta/", "meta/hazelcast.yaml", layoutUUID + "/", layoutUUID + "/cluster/", layoutUUID + "/cluster/members.bin"},
+			[]fileutil.File{
+				{Name: "meta", IsDir: true},
+				{Name: "meta/hazelcast.yaml"},
+				{Name: layoutUUID, IsDir: true},
+				{Name: layoutUUID + "/cluster", IsDir: true},
+				{Name: layoutUUID + "/cluster/members.bin"},
+			},
+			false,
+		},
+		{
+			"content of the uuid folder",
+			"2022-06-13-00-00-00/" + layoutUUID + ".tar.gz",
+			[]string{"./", "./cluster/", "./cluster/members.bin"},
+			[]fileutil.File{
+				{Name: layoutUUID, IsDir: true},
+				{Name: layoutUUID + "/cluster", IsDir: true},
+				{Name: layoutUUID + "/cluster/members.bin"},
+			},
+			false,
+		},
+		{
+			"leading folders",
+			layoutUUID + ".tar.gz",
+			[]string{"backup-0000000000001/", "backup-0000000000001/" + layoutUUID + "/", "backup-0000000000001/" + layoutUUID + "/cluster/members.bin", "backup-0000000000001/other"},
+			[]fileutil.File{
+				{Name: layoutUUID, IsDir: true},
+				{Name: layoutUUID + "/cluster", IsDir: true},
+				{Name: layoutUUID + "/cluster/members.bin"},
+			},
+			false,
+		},
+		{
+			"absolute paths",
+			"backup.tar.gz",
+			[]string{"/data/hot-backup/" + layoutUUID + "/", "/data/hot-backup/" + layoutUUID + "/cluster/members.bin"},
+			[]fileutil.File{
+				{Name: layoutUUID, IsDir: true},
+				{Name: layoutUUID + "/cluster", IsDir: true},
+				{Name: layoutUUID + "/cluster/members.bin"},
+			},
+			false,
+		},
+		{
+			"meta before content of the uuid folder",
+			layoutUUID + ".tar.gz",
+			[]string{"meta/", "meta/hazelcast.yaml", "cluster/", "cluster/members.bin"},
+			[]fileutil.File{
+				{Name: "meta", IsDir: true},
+				{Name: "meta/hazelcast.yaml"},
+				{Name: layoutUUID, IsDir: true},
+				{Name: layoutUUID + "/cluster", IsDir: true},
+				{Name: layoutUUID + "/cluster/members.bin"},
+			},
+			false,
+		},
+		{
+			"outside of the target",
+			"backup.tar.gz",
+			[]string{"../evil"},
+			nil,
+			true,
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			require.Nil(t, bucket.WriteAll(ctx, tt.key, tarGz(t, tt.entries), nil))
+
+			tmpdir, err := os.MkdirTemp("", "restore_layout")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			err = saveFromArchive(ctx, bucket, tt.key, tmpdir, downloadOptions{})
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if err != nil {
+				return
+			}
+			got, err := fileutil.DirFileList(tmpdir)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func tarGz(t *testing.T, entries []string) []byte {
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+	w := tar.NewWriter(g)
+	for _, e := range entries {
+		h := &tar.Header{Name: e, Mode: 0700, Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e, "/") {
+			h.Typeflag = tar.TypeDir
+		}
+		require.Nil(t, w.WriteHeader(h))
+	}
+	require.Nil(t, w.Close())
+	require.Nil(t, g.Close())
+	return buf.Bytes()
+}
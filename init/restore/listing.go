@@ -0,0 +1,111 @@
+package restore
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// listPageSize is the number of objects of a listing page, the maximum page of S3
+const listPageSize = 1000
+
+// listPages calls fn with the objects of the listing page by page. A failed page is retried without
+// listing the pages before it again.
+func listPages(ctx context.Context, bucket *blob.Bucket, opts *blob.ListOptions, retry bkt.Retry, fn func(*blob.ListObject)) error {
+	token := blob.FirstPageToken
+	for {
+		var page []*blob.ListObject
+		var next []byte
+		err := retry.Do(ctx, "listing the bucket", func() error {
+			var err error
+			page, next, err = bucket.ListPage(ctx, token, listPageSize, opts)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, obj := range page {
+			fn(obj)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		token = next
+	}
+}
+
+// listKeys returns the keys of the objects under the prefix
+func listKeys(ctx context.Context, bucket *blob.Bucket, prefix string, retry bkt.Retry) ([]string, error) {
+	var keys []string
+	err := listPages(ctx, bucket, &blob.ListOptions{Prefix: prefix}, retry, func(obj *blob.ListObject) {
+		keys = append(keys, obj.Key)
+	})
+	return keys, err
+}
+
+// datedFolder is a backup folder named after the time of the backup
+type datedFolder struct {
+	name string
+	time time.Time
+}
+
+// listDatedFolders returns the dated backup folders at the top of the bucket, the latest first. Only
+// the folder names are listed, the objects in the folders are not.
+func listDatedFolders(ctx context.Context, bucket *blob.Bucket, loc *time.Location, retry bkt.Retry) ([]datedFolder, error) {
+	var names []string
+	err := listPages(ctx, bucket, &blob.ListOptions{Delimiter: "/"}, retry, func(obj *blob.ListObject) {
+		if obj.IsDir && dateRE.MatchString(obj.Key) {
+			names = append(names, strings.TrimSuffix(obj.Key, "/"))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make([]datedFolder, 0, len(names))
+	for _, n := range names {
+		t, err := fileutil.ParseFolderTime(n, loc)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, datedFolder{name: n, time: t})
+	}
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].time.After(folders[j].time)
+	})
+	return folders, nil
+}
+
+// backupKeys returns the archives and the member folders among the object keys, sorted. Only keys
+// directly in folder are returned if it is set.
+func backupKeys(objKeys []string, folder string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, objKey := range objKeys {
+		// naive validation, we only want tgz files, manifests of tgz files uploaded in parts or
+		// objects synced below a member folder
+		key, ok := archive.Key(objKey)
+		if !ok {
+			key, ok = directoryKey(objKey)
+		}
+		if !ok || seen[key] {
+			continue
+		}
+		if folder != "" && filepath.Dir(strings.TrimSuffix(key, "/")) != folder {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	// to be extra safe we always sort the keys
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+)
+
+func TestListKeysPages(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	n := 2*listPageSize + 10
+	for i := 0; i < n; i++ {
+		require.Nil(t, bucket.WriteAll(ctx, fmt.Sprintf("2022-06-13-00-00-00/%05d.tar.gz", i), nil, nil))
+	}
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-14-00-00-00/a.tar.gz", nil, nil))
+
+	keys, err := listKeys(ctx, bucket, "2022-06-13-00-00-00/", bkt.Retry{})
+	require.Nil(t, err)
+	require.Len(t, keys, n)
+	require.Equal(t, "2022-06-13-00-00-00/00000.tar.gz", keys[0])
+	require.Equal(t, fmt.Sprintf("2022-06-13-00-00-00/%05d.tar.gz", n-1), keys[n-1])
+}
+
+func TestListDatedFolders(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	for _, k := range []string{
+		"2022-06-12-00-00-00/a.tar.gz",
+		"2022-06-14-02-00-00+0200/a.tar.gz",
+		"2022-06-13-00-30-00/a.tar.gz",
+		"2022-06-13-00-30-00/b.tar.gz",
+		"not-dated/a.tar.gz",
+		"a.tar.gz",
+	} {
+		require.Nil(t, bucket.WriteAll(ctx, k, nil, nil))
+	}
+
+	folders, err := listDatedFolders(ctx, bucket, time.UTC, bkt.Retry{})
+	require.Nil(t, err)
+	var names []string
+	for _, f := range folders {
+		names = append(names, f.name)
+	}
+	require.Equal(t, []string{"2022-06-14-02-00-00+0200", "2022-06-13-00-30-00", "2022-06-12-00-00-00"}, names)
+}
+
+func TestFindListsLatestFolderOnly(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	// a long history of backups
+	for day := 1; day <= 28; day++ {
+		for m := 0; m < 3; m++ {
+			require.Nil(t, bucket.WriteAll(ctx, fmt.Sprintf("2022-05-%02d-00-00-00/%d.tar.gz", day, m), nil, nil))
+		}
+	}
+	// the latest folder of an upload that failed has no archive
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-01-00-00-00/0.tar.gz.part-0000", nil, nil))
+	// keys below other folders of a dated folder are not backups of it
+	require.Nil(t, bucket.WriteAll(ctx, "2022-05-28-00-00-00/old/0.tar.gz", nil, nil))
+
+	keys, err := find(ctx, bucket, backupSelector{Location: time.UTC}, bkt.Retry{})
+	require.Nil(t, err)
+	require.Equal(t, []string{"2022-05-28-00-00-00/0.tar.gz", "2022-05-28-00-00-00/1.tar.gz", "2022-05-28-00-00-00/2.tar.gz"}, keys)
+}
@@ -2,6 +2,7 @@ package restore
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,15 +11,19 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/subcommands"
-	"github.com/kelseyhightower/envconfig"
 	_ "gocloud.dev/blob/azureblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/metrics"
 	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
@@ -28,8 +33,8 @@ var (
 	// StatefulSet hostname is always DSN RFC 1123 and number
 	hostnameRE = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?-([0-9]+)$")
 
-	// Backup directory name is a formated date e.g. 2006-01-02-15-04-05/
-	dateRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}/`)
+	// Backup directory name is a formated date e.g. 2006-01-02-15-04-05/ or 2006-01-02-15-04-05+0100/
+	dateRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}([+-]\d{4})?/`)
 
 	// lock file, e.g. .restore_lock.12345.12
 	lockRE = regexp.MustCompile(`^\.` + restoreLock + `\.[a-z0-9]*\.\d*$`)
@@ -38,10 +43,27 @@ var (
 )
 
 type LocalInPVCCmd struct {
-	BackupSequenceFolderName string `envconfig:"RESTORE_LOCAL_BACKUP_FOLDER_NAME"`
-	BackupBaseDir            string `envconfig:"RESTORE_LOCAL_BACKUP_BASE_DIR"`
-	Hostname                 string `envconfig:"RESTORE_LOCAL_HOSTNAME"`
-	RestoreID                string `envconfig:"RESTORE_LOCAL_ID"`
+	BackupSequenceFolderName string        `envconfig:"RESTORE_LOCAL_BACKUP_FOLDER_NAME"`
+	BackupBaseDir            string        `envconfig:"RESTORE_LOCAL_BACKUP_BASE_DIR"`
+	Hostname                 string        `envconfig:"RESTORE_LOCAL_HOSTNAME"`
+	RestoreID                string        `envconfig:"RESTORE_LOCAL_ID"`
+	MCURL                    string        `envconfig:"RESTORE_LOCAL_MC_URL"`
+	MCToken                  string        `envconfig:"RESTORE_LOCAL_MC_TOKEN"`
+	LockTTL                  time.Duration `envconfig:"RESTORE_LOCAL_LOCK_TTL"`
+	ForceUnlock              bool          `envconfig:"RESTORE_LOCAL_FORCE_UNLOCK"`
+	Pushgateway              string        `envconfig:"RESTORE_LOCAL_PUSHGATEWAY_URL"`
+	CompleteFile             string        `envconfig:"RESTORE_LOCAL_COMPLETE_FILE"`
+	ResultFile               string        `envconfig:"RESTORE_LOCAL_RESULT_FILE"`
+	LockCluster              string        `envconfig:"RESTORE_LOCAL_LOCK_CLUSTER_NAME"`
+	Namespace                string        `envconfig:"RESTORE_LOCAL_NAMESPACE"`
+	RunAs                    string        `envconfig:"RESTORE_LOCAL_RUN_AS"`
+	FSGroup                  string        `envconfig:"RESTORE_LOCAL_FS_GROUP"`
+	KeepExisting             bool          `envconfig:"RESTORE_LOCAL_KEEP_EXISTING"`
+	Chown                    string        `envconfig:"RESTORE_LOCAL_CHOWN"`
+	ChmodDirs                string        `envconfig:"RESTORE_LOCAL_CHMOD_DIRS"`
+	ChmodFiles               string        `envconfig:"RESTORE_LOCAL_CHMOD_FILES"`
+	ControlChown             string        `envconfig:"RESTORE_LOCAL_CONTROL_CHOWN"`
+	ControlChmod             string        `envconfig:"RESTORE_LOCAL_CONTROL_CHMOD"`
 }
 
 func (*LocalInPVCCmd) Name() string     { return "restore_pvc_local" }
@@ -52,20 +74,63 @@ func (r *LocalInPVCCmd) SetFlags(f *flag.FlagSet) {
 	// We ignore error because this is just a default value
 	hostname, _ := os.Hostname()
 	f.StringVar(&r.Hostname, "hostname", hostname, "dst filesystem path")
-	f.StringVar(&r.BackupSequenceFolderName, "src", "", "src backup folder path")
+	f.StringVar(&r.BackupSequenceFolderName, "src", "", "src backup sequence folder, e.g. backup-1659034855000, the latest sequence if empty or \"latest\"")
 	f.StringVar(&r.BackupBaseDir, "dst", "/data/persistence/backup", "dst filesystem path")
 	f.StringVar(&r.RestoreID, "restore-id", "", "Restore ID for which the lock will be created.")
+	f.StringVar(&r.MCURL, "mc-url", "", "management center endpoint for restore events")
+	f.StringVar(&r.MCToken, "mc-token", "", "management center endpoint token")
+	f.DurationVar(&r.LockTTL, "lock-ttl", 0, "age after which a restore lock is stale, 0 means locks never expire")
+	f.BoolVar(&r.ForceUnlock, "force-unlock", false, "remove an existing restore lock and restore again")
+	f.StringVar(&r.Pushgateway, "pushgateway-url", "", "prometheus pushgateway for restore metrics")
+	f.StringVar(&r.CompleteFile, "complete-file", defaultCompleteFile, "file written into dst once the restore succeeded, for the Hazelcast entrypoint to wait on, disabled if empty")
+	f.StringVar(&r.ResultFile, "result-file", defaultResultFile, "file in dst the outcome of the restore is written to as JSON when the agent exits, disabled if empty")
+	f.StringVar(&r.LockCluster, "lock-cluster-name", "", "name of the Hazelcast cluster recorded in the restore lock, locks of other clusters are stale")
+	f.StringVar(&r.Namespace, "namespace", os.Getenv("POD_NAMESPACE"), "namespace of the Hazelcast cluster recorded in the restore lock, locks of other clusters are stale")
+	f.StringVar(&r.Chown, "chown", "", "numeric uid:gid, uid or :gid the copied files and folders are owned by, e.g. 65534:65534, the owner of the backup if empty")
+	f.StringVar(&r.ChmodDirs, "chmod-dirs", "", "octal permissions of the copied folders, e.g. 0750, the mode of the backup if empty")
+	f.StringVar(&r.ChmodFiles, "chmod-files", "", "octal permissions of the copied files, e.g. 0640, the mode of the backup if empty")
+	f.StringVar(&r.ControlChown, "control-chown", "", "numeric uid:gid, uid or :gid the restore lock, completion and result files are owned by, e.g. 65534:65534, the user of the agent if empty")
+	f.StringVar(&r.ControlChmod, "control-chmod", "", "octal permissions of the restore lock, completion and result files, e.g. 0640, 0600 for the lock and 0644 for the others if empty")
+	f.StringVar(&r.RunAs, "run-as", "", "numeric runAsUser:runAsGroup or runAsUser of the Hazelcast container, the destination and the restored files are checked to be writable by it if set")
+	f.StringVar(&r.FSGroup, "fs-group", "", "numeric fsGroup of the pod, a group the Hazelcast container writes the destination with")
+	f.BoolVar(&r.KeepExisting, "keep-existing", false, "keep the existing hot-restart folder in place until the backup is copied next to it, it is only replaced once the copy succeeded")
 }
 
-func (r *LocalInPVCCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (r *LocalInPVCCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
 	localInPVCLog.Info("starting restore pvc local agent...")
 
+	start := time.Now()
+	var reason string
+	size := &restoredSize{dir: r.BackupBaseDir}
+	defer func() {
+		writeRestoreSummary(r.Name(), status, start, r.BackupSequenceFolderName, size, reason)
+	}()
+
 	// overwrite config with environment variables
-	if err := envconfig.Process("restoreLocal", r); err != nil {
+	if err := config.Process("restoreLocal", r, f); err != nil {
 		localInPVCLog.Error("an error occurred while processing config from env: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
+	phase := api.RestorePhaseStarting
+	// parsed with the other options, the result of invalid options is written with the defaults
+	var control *ownership
+	defer func() {
+		phase = finalPhase(status, phase)
+		res := newRestoreResult(status, api.RestoreStatus{Phase: phase, Key: r.BackupSequenceFolderName}, start, size, reason)
+		res.RestoreID, res.Hostname = r.RestoreID, r.Hostname
+		writeResult(localInPVCLog, destinationFile(r.BackupBaseDir, r.ResultFile), res, control)
+	}()
+
+	events := mancenter.New(r.MCURL, r.MCToken)
+	reportRestore(ctx, events, mancenter.Started, r.BackupSequenceFolderName)
+	defer func() { reportRestoreStatus(ctx, events, status, r.BackupSequenceFolderName) }()
+
+	pusher := metrics.NewPusher(r.Pushgateway, "hazelcast_restore")
+	defer func() {
+		pushRestoreMetrics(ctx, pusher, r.Hostname, status, start, size, api.RestoreStatus{Phase: phase}, reason)
+	}()
+
 	if !hostnameRE.MatchString(r.Hostname) {
 		localInPVCLog.Error("invalid hostname, need to conform to statefulset naming scheme")
 		return subcommands.ExitFailure
@@ -77,35 +142,117 @@ func (r *LocalInPVCCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interfa
 		return subcommands.ExitFailure
 	}
 
+	owner, err := parseOwnership(r.Chown, r.ChmodDirs, r.ChmodFiles)
+	if err != nil {
+		localInPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	user, err := parseContainerUser(r.RunAs, r.FSGroup)
+	if err != nil {
+		localInPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if control, err = parseControlOwnership(r.ControlChown, r.ControlChmod); err != nil {
+		localInPVCLog.Error(err.Error())
+		return subcommands.ExitFailure
+	}
+
 	lock := filepath.Join(r.BackupBaseDir, lockFileName(r.RestoreID, id))
+	complete := destinationFile(r.BackupBaseDir, r.CompleteFile)
 
-	if _, err = os.Stat(lock); err == nil || os.IsExist(err) {
+	unreadable, err := prepareControlFiles(user, control, lock, complete, destinationFile(r.BackupBaseDir, r.ResultFile))
+	if err != nil {
+		localInPVCLog.Error("error preparing control files: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if len(unreadable) > 0 {
+		localInPVCLog.Warn("the Hazelcast container cannot read the control files, set -control-chown or -control-chmod: " + strings.Join(unreadable, ", "))
+	}
+
+	locked, err := isLocked(localInPVCLog, lock, lockPolicy{TTL: r.LockTTL, Force: r.ForceUnlock, Cluster: r.LockCluster, Namespace: r.Namespace})
+	if err != nil {
+		localInPVCLog.Error("error reading restore lock: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if locked {
 		// If restoreLocal lock exists exit
 		localInPVCLog.Info("restore lock exists, exiting")
+		if err = ensureComplete(complete, r.BackupBaseDir, restoreComplete{RestoreID: r.RestoreID, Hostname: r.Hostname}, control); err != nil {
+			localInPVCLog.Error("error writing restore completion file: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		phase = api.RestorePhaseSkipped
 		return subcommands.ExitSuccess
 	}
 
-	err = copyBackupPVC(path.Join(r.BackupBaseDir, sidecar.DirName, r.BackupSequenceFolderName), r.BackupBaseDir)
+	// the backup is only selected once the member restores, a locked member needs none and a
+	// missing backup is recorded in the result file
+	backupsDir := path.Join(r.BackupBaseDir, sidecar.DirName)
+	seq, err := backupSequence(backupsDir, r.BackupSequenceFolderName)
+	if err != nil {
+		localInPVCLog.Error("error selecting the backup sequence: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if seq != r.BackupSequenceFolderName {
+		localInPVCLog.Info("selected backup sequence " + seq)
+		r.BackupSequenceFolderName = seq
+	}
+
+	// the member must not start on the data while it is replaced
+	if err = removeComplete(complete); err != nil {
+		localInPVCLog.Error("error removing restore completion file: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = checkDestinationAccess(user, r.BackupBaseDir); err != nil {
+		localInPVCLog.Error(err.Error())
+		reason = failureReason(err)
+		return subcommands.ExitFailure
+	}
+
+	// events are still reported after a termination signal stopped the copy
+	rctx, stop := withSignals(ctx, localInPVCLog)
+	defer stop()
+
+	err = copyBackupPVC(rctx, path.Join(backupsDir, r.BackupSequenceFolderName), r.BackupBaseDir, r.KeepExisting, owner)
 	if err != nil {
 		localInPVCLog.Error("copy backup failed: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
-	if err = cleanupLocks(r.BackupBaseDir, id); err != nil {
+	if err = checkRestoredAccess(user, r.BackupBaseDir, size); err != nil {
+		localInPVCLog.Error(err.Error())
+		reason = failureReason(err)
+		return subcommands.ExitFailure
+	}
+
+	if err = cleanupLocks(r.BackupBaseDir, id, lockFileName(r.RestoreID, id)); err != nil {
 		localInPVCLog.Error("error cleaning up locks: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
-	if err = os.WriteFile(lock, []byte{}, 0600); err != nil {
+	if err = writeLock(lock, lockInfo{RestoreID: r.RestoreID, Hostname: r.Hostname, Cluster: r.LockCluster, Namespace: r.Namespace}, control); errors.Is(err, errLockConflict) {
+		localInPVCLog.Error("another agent restored the same member: " + err.Error())
+		return subcommands.ExitFailure
+	} else if err != nil {
 		localInPVCLog.Error("lock file creation error: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
+	if err = writeComplete(complete, r.BackupBaseDir, restoreComplete{RestoreID: r.RestoreID, Hostname: r.Hostname}, control); err != nil {
+		localInPVCLog.Error("error writing restore completion file: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
 	localInPVCLog.Info("restore successful")
 	return subcommands.ExitSuccess
 }
 
-func copyBackupPVC(backupDir, destDir string) error {
+// copyBackupPVC copies the backup of the sequence folder into destDir, the copied files and folders
+// get the ownership
+func copyBackupPVC(ctx context.Context, backupDir, destDir string, keep bool, owner *ownership) error {
 	backupUUIDs, err := fileutil.FolderUUIDs(backupDir)
 	if err != nil {
 		return err
@@ -115,36 +262,31 @@ func copyBackupPVC(backupDir, destDir string) error {
 		return fmt.Errorf("incorrect number of backups %d in backup sequence folder", len(backupUUIDs))
 	}
 
-	destBackupUUIDS, err := fileutil.FolderUUIDs(destDir)
-	if err != nil {
-		return err
-	}
-
-	// Remove the hot-restart folder at the destination
-	for _, uuid := range destBackupUUIDS {
-		err = os.RemoveAll(path.Join(destDir, uuid.Name()))
-		if err != nil {
-			return err
-		}
-	}
-
 	bk := backupUUIDs[0].Name()
-	return copyDir(path.Join(backupDir, bk), path.Join(destDir, bk))
+	return restoreInto(destDir, keep, func(tmp string) error {
+		return copyDir(ctx, path.Join(backupDir, bk), path.Join(tmp, bk), owner)
+	})
 }
 
 func lockFileName(restoreId string, memberId int) string {
 	return fmt.Sprintf(".%s.%s.%d", restoreLock, restoreId, memberId)
 }
 
-func copyDir(source, destination string) error {
+func copyDir(ctx context.Context, source, destination string, owner *ownership) error {
 	var err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		var out = filepath.Join(destination, strings.TrimPrefix(path, source))
 
 		if info.IsDir() {
-			return os.Mkdir(filepath.Join(out), info.Mode())
+			if err = os.Mkdir(filepath.Join(out), info.Mode()); err != nil {
+				return err
+			}
+			return owner.apply(out, info.Mode())
 		}
 		err = func() error {
 			in, err := os.Open(path)
@@ -167,8 +309,10 @@ func copyDir(source, destination string) error {
 			}
 
 			// copy content
-			_, err = io.Copy(fh, in)
-			return err
+			if _, err = io.Copy(fh, &ctxReader{ctx: ctx, r: in}); err != nil {
+				return err
+			}
+			return owner.apply(out, info.Mode())
 		}()
 
 		return err
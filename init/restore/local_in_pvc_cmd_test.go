@@ -1,12 +1,17 @@
 package restore
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"os"
 	"path"
 	"testing"
 
+	"github.com/google/subcommands"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hazelcast/platform-operator-agent/api"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 )
 
@@ -106,7 +111,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			require.Nil(t, err)
 
 			//test
-			err = copyBackupPVC(backupDir, destDir)
+			err = copyBackupPVC(context.Background(), backupDir, destDir, false, nil)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -120,3 +125,46 @@ func TestCopyBackupPVC(t *testing.T) {
 		})
 	}
 }
+
+func TestCopyBackupPVCOwnership(t *testing.T) {
+	backupDir, destDir := t.TempDir(), t.TempDir()
+	member := "00000000-0000-0000-0000-000000000001"
+	require.Nil(t, os.MkdirAll(path.Join(backupDir, member, "s00"), 0700))
+	require.Nil(t, os.WriteFile(path.Join(backupDir, member, "s00", "0000000000000001.chunk"), []byte("chunk"), 0600))
+
+	owner := &ownership{uid: -1, gid: -1, dirMode: 0750, fileMode: 0640}
+	require.Nil(t, copyBackupPVC(context.Background(), backupDir, destDir, false, owner))
+
+	for name, want := range map[string]os.FileMode{
+		member:                   0750,
+		path.Join(member, "s00"): 0750,
+		path.Join(member, "s00", "0000000000000001.chunk"): 0640,
+	} {
+		info, err := os.Stat(path.Join(destDir, name))
+		require.Nil(t, err)
+		require.Equal(t, want, info.Mode().Perm(), name)
+	}
+}
+
+func TestLocalInPVCLockedWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, writeLock(path.Join(dir, lockFileName("12345", 0)), lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+
+	// a locked member needs no backup to select
+	r := &LocalInPVCCmd{Hostname: "hazelcast-0", BackupBaseDir: dir, RestoreID: "12345", ResultFile: defaultResultFile}
+	require.Equal(t, subcommands.ExitSuccess, r.Execute(context.Background(), flag.NewFlagSet("test", flag.ContinueOnError)))
+	data, err := os.ReadFile(path.Join(dir, defaultResultFile))
+	require.Nil(t, err)
+	var res api.RestoreResult
+	require.Nil(t, json.Unmarshal(data, &res))
+	require.Equal(t, api.RestorePhaseSkipped, res.Phase)
+
+	// without the lock the missing backup fails the restore and is recorded
+	r = &LocalInPVCCmd{Hostname: "hazelcast-0", BackupBaseDir: dir, RestoreID: "67890", ResultFile: defaultResultFile}
+	require.Equal(t, subcommands.ExitFailure, r.Execute(context.Background(), flag.NewFlagSet("test", flag.ContinueOnError)))
+	data, err = os.ReadFile(path.Join(dir, defaultResultFile))
+	require.Nil(t, err)
+	require.Nil(t, json.Unmarshal(data, &res))
+	require.Equal(t, api.StatusFailure, res.Status)
+	require.Contains(t, res.Error, "backup sequence")
+}
@@ -0,0 +1,168 @@
+package restore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fsys"
+)
+
+// lockInfo is the content of a restore lock file, locks written by older agents are empty
+type lockInfo struct {
+	RestoreID string `json:"restore_id"`
+	Hostname  string `json:"hostname"`
+	// Cluster and Namespace tell the Hazelcast cluster that restored the volume, a reused volume can
+	// hold the lock of another cluster
+	Cluster   string    `json:"cluster,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// lockPolicy decides when an existing restore lock is stale
+type lockPolicy struct {
+	// TTL after which a lock is stale, 0 means that locks never expire
+	TTL time.Duration
+	// Force treats every lock as stale
+	Force bool
+	// Cluster and Namespace supersede a lock written by another cluster, empty keeps every lock
+	Cluster   string
+	Namespace string
+}
+
+// foreign returns true if the lock was written by another cluster than the one the policy belongs to,
+// locks and policies without a cluster or namespace match every cluster
+func (p lockPolicy) foreign(l *lockInfo) bool {
+	return differs(p.Cluster, l.Cluster) || differs(p.Namespace, l.Namespace)
+}
+
+func differs(a, b string) bool {
+	return a != "" && b != "" && a != b
+}
+
+// errLockConflict is returned if another agent wrote the restore lock of the member first
+var errLockConflict = errors.New("restore lock conflict")
+
+// writeLock creates the lock exclusively and syncs it with its folder, so that the lock survives
+// a crash once it is written. An existing lock means that another agent restored the same member.
+// The lock gets the ownership of the control files.
+func writeLock(name string, l lockInfo, control *ownership) error {
+	l.Created = clock.Now().UTC()
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	f, err := fsys.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return lockConflict(name)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = control.apply(name, 0)
+	}
+	if err != nil {
+		// a truncated lock could not be read by the next restore
+		fsys.Remove(name)
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// lockConflict describes the agent that wrote the existing lock
+func lockConflict(name string) error {
+	l, err := readLock(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s exists", errLockConflict, name)
+	}
+	by := l.Hostname
+	if l.Cluster != "" || l.Namespace != "" {
+		by += " of cluster " + path.Join(l.Namespace, l.Cluster)
+	}
+	return fmt.Errorf("%w: %s was written by %s for restore %s at %s", errLockConflict, name, by, l.RestoreID, l.Created.Format(time.RFC3339))
+}
+
+// syncDir persists the entries of the folder, e.g. a newly created file
+func syncDir(dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// readLock returns the lock metadata, the modification time stands in for the creation time of empty locks
+func readLock(name string) (*lockInfo, error) {
+	stat, err := fsys.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var l lockInfo
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &l); err != nil {
+			return nil, err
+		}
+	}
+	if l.Created.IsZero() {
+		l.Created = stat.ModTime()
+	}
+	return &l, nil
+}
+
+// isLocked returns true if the restore lock exists and is still valid, a stale lock is removed
+func isLocked(log *zap.Logger, name string, p lockPolicy) (bool, error) {
+	l, err := readLock(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fields := []zap.Field{
+		zap.String("lock", name),
+		zap.String("restore id", l.RestoreID),
+		zap.String("hostname", l.Hostname),
+		zap.String("cluster", l.Cluster),
+		zap.String("namespace", l.Namespace),
+		zap.Time("created", l.Created),
+	}
+	age := clock.Since(l.Created)
+	switch {
+	case p.Force:
+		log.Warn("forcing removal of restore lock, data will be restored again", fields...)
+	case p.foreign(l):
+		log.Warn("restore lock belongs to another cluster, e.g. of a reused volume, data will be restored again", fields...)
+	case p.TTL > 0 && age > p.TTL:
+		log.Warn("restore lock is stale, data will be restored again", append(fields, zap.Duration("age", age))...)
+	default:
+		log.Info("restore lock exists", fields...)
+		return true, nil
+	}
+
+	if err = fsys.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return false, nil
+}
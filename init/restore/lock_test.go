@@ -0,0 +1,189 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fsys"
+)
+
+func TestIsLocked(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	defer clock.Set(fake)()
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, lock string)
+		policy     lockPolicy
+		wantLocked bool
+	}{
+		{"no lock", func(t *testing.T, lock string) {}, lockPolicy{}, false},
+		{"lock without ttl", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+		}, lockPolicy{}, true},
+		{"fresh lock", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+		}, lockPolicy{TTL: time.Hour}, true},
+		{"stale lock", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+			fake.Advance(2 * time.Hour)
+		}, lockPolicy{TTL: time.Hour}, false},
+		{"stale legacy lock", func(t *testing.T, lock string) {
+			require.Nil(t, os.WriteFile(lock, []byte{}, 0600))
+			old := time.Now().Add(-2 * time.Hour)
+			require.Nil(t, os.Chtimes(lock, old, old))
+		}, lockPolicy{TTL: time.Hour}, false},
+		{"forced unlock", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+		}, lockPolicy{TTL: time.Hour, Force: true}, false},
+		{"legacy lock", func(t *testing.T, lock string) {
+			require.Nil(t, os.WriteFile(lock, []byte{}, 0600))
+		}, lockPolicy{}, true},
+		{"same cluster", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0", Cluster: "prod", Namespace: "hz"}, nil))
+		}, lockPolicy{Cluster: "prod", Namespace: "hz"}, true},
+		{"other cluster on a reused volume", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0", Cluster: "staging", Namespace: "hz"}, nil))
+		}, lockPolicy{Cluster: "prod", Namespace: "hz"}, false},
+		{"other namespace", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{Hostname: "hazelcast-0", Cluster: "prod", Namespace: "team-a"}, nil))
+		}, lockPolicy{Cluster: "prod", Namespace: "team-b"}, false},
+		{"lock without cluster", func(t *testing.T, lock string) {
+			require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+		}, lockPolicy{Cluster: "prod", Namespace: "hz"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "restore_lock")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			lock := path.Join(tmpdir, lockFileName("12345", 0))
+			tt.setup(t, lock)
+
+			locked, err := isLocked(zap.NewNop(), lock, tt.policy)
+			require.Nil(t, err)
+			require.Equal(t, tt.wantLocked, locked)
+
+			// a stale lock is removed
+			_, err = os.Stat(lock)
+			require.Equal(t, tt.wantLocked, err == nil)
+		})
+	}
+}
+
+func TestLockLifecycle(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	defer clock.Set(fake)()
+
+	tmpdir, err := os.MkdirTemp("", "restore_lock")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	lock := path.Join(tmpdir, lockFileName("12345", 0))
+	policy := lockPolicy{TTL: time.Hour}
+	check := func(p lockPolicy, want bool) {
+		t.Helper()
+		locked, err := isLocked(zap.NewNop(), lock, p)
+		require.Nil(t, err)
+		require.Equal(t, want, locked)
+	}
+
+	// the first restore writes the lock, restarts of the member skip the restore
+	check(policy, false)
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+	check(policy, true)
+	fake.Advance(30 * time.Minute)
+	check(policy, true)
+
+	// a forced restore removes the lock and writes it again
+	check(lockPolicy{TTL: time.Hour, Force: true}, false)
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+	check(policy, true)
+
+	// the lock expires after the TTL
+	fake.Advance(2 * time.Hour)
+	check(policy, false)
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+
+	// a new restore uses a lock of its own, the lock of the previous one is kept until cleanupLocks
+	check(policy, true)
+	locked, err := isLocked(zap.NewNop(), path.Join(tmpdir, lockFileName("67890", 0)), policy)
+	require.Nil(t, err)
+	require.False(t, locked)
+}
+
+func TestReadLock(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_lock")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	lock := path.Join(tmpdir, lockFileName("12345", 0))
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0", Cluster: "prod", Namespace: "hz"}, nil))
+
+	l, err := readLock(lock)
+	require.Nil(t, err)
+	require.Equal(t, "12345", l.RestoreID)
+	require.Equal(t, "hazelcast-0", l.Hostname)
+	require.Equal(t, "prod", l.Cluster)
+	require.Equal(t, "hz", l.Namespace)
+	require.WithinDuration(t, time.Now(), l.Created, time.Minute)
+}
+
+func TestWriteLockConflict(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_lock")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// a lock of an earlier restore is removed, the one of the current restore is kept
+	old := path.Join(tmpdir, lockFileName("11111", 0))
+	lock := path.Join(tmpdir, lockFileName("12345", 0))
+	require.Nil(t, writeLock(old, lockInfo{RestoreID: "11111", Hostname: "hazelcast-0"}, nil))
+	require.Nil(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil))
+	require.Nil(t, cleanupLocks(tmpdir, 0, lockFileName("12345", 0)))
+	require.NoFileExists(t, old)
+
+	err = writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0-other"}, nil)
+	require.ErrorIs(t, err, errLockConflict)
+	require.Contains(t, err.Error(), "written by hazelcast-0 for restore 12345")
+
+	// the lock of the first agent is not overwritten
+	l, err := readLock(lock)
+	require.Nil(t, err)
+	require.Equal(t, "hazelcast-0", l.Hostname)
+}
+
+// failingSync is a filesystem whose files cannot be synced, like a full or broken volume
+type failingSync struct {
+	fsys.OS
+}
+
+func (f failingSync) OpenFile(name string, flag int, perm os.FileMode) (fsys.File, error) {
+	file, err := f.OS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return syncError{file}, nil
+}
+
+type syncError struct {
+	fsys.File
+}
+
+func (syncError) Sync() error { return errors.New("sync failed") }
+
+func TestWriteLockSyncFailure(t *testing.T) {
+	defer fsys.Set(failingSync{})()
+
+	// a lock that is not persisted is removed, the next restore must not trust it
+	lock := path.Join(t.TempDir(), lockFileName("12345", 0))
+	require.ErrorContains(t, writeLock(lock, lockInfo{RestoreID: "12345", Hostname: "hazelcast-0"}, nil), "sync failed")
+	require.NoFileExists(t, lock)
+}
@@ -0,0 +1,62 @@
+package restore
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fsys"
+)
+
+// metadataReadyFile is written to the destination once the entries before the first chunk file are
+// extracted. Archives store the cluster metadata and configuration before the chunk files, so
+// Hazelcast can validate the folder named in the marker before the whole dataset has landed.
+const metadataReadyFile = ".metadata-ready"
+
+// metadataReady is the content of the marker file
+type metadataReady struct {
+	Key string `json:"key"`
+	// Dir is the folder the archive is extracted into, the restored folders are moved out of it once complete
+	Dir  string    `json:"dir"`
+	Time time.Time `json:"time"`
+}
+
+// metadataMarker writes the marker once, a nil marker writes nothing
+type metadataMarker struct {
+	name    string
+	ready   metadataReady
+	control *ownership
+	done    bool
+}
+
+func newMetadataMarker(name, key, dir string, control *ownership) *metadataMarker {
+	if name == "" {
+		return nil
+	}
+	return &metadataMarker{name: name, ready: metadataReady{Key: key, Dir: dir}, control: control}
+}
+
+// mark queues the marker behind the entries written so far
+func (m *metadataMarker) mark(w *diskWriter) error {
+	if m == nil || m.done {
+		return nil
+	}
+	m.done = true
+	return w.after(func() error {
+		m.ready.Time = clock.Now().UTC()
+		data, err := json.Marshal(m.ready)
+		if err != nil {
+			return err
+		}
+		// readers never see a partial marker
+		return writeFileAtomic(m.name, data, m.control)
+	})
+}
+
+// removeMarker removes the marker of the restore, it is only valid while the restore runs
+func removeMarker(name string) {
+	if err := fsys.Remove(name); err != nil && !os.IsNotExist(err) {
+		bucketToPVCLog.Warn("could not remove metadata marker: " + err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestSaveFromArchiveMetadataMarker(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		files []fileutil.File
+	}{
+		{"with chunks", exampleTarGzFiles},
+		{"without chunks", []fileutil.File{{Name: "cluster", IsDir: true}, {Name: "cluster/members.bin"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "metadata_marker")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			archiveDir := path.Join(tmpdir, "archive")
+			require.Nil(t, fileutil.CreateFiles(archiveDir, tt.files, true))
+			var buf bytes.Buffer
+			require.Nil(t, archive.Create(&buf, archiveDir, layoutUUID))
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			key := layoutUUID + ".tar.gz"
+			require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+
+			dest := path.Join(tmpdir, "dest")
+			marker := path.Join(tmpdir, metadataReadyFile)
+			require.Nil(t, saveFromArchive(ctx, bucket, key, dest, downloadOptions{MetadataMarker: marker}))
+
+			data, err := os.ReadFile(marker)
+			require.Nil(t, err)
+			var ready metadataReady
+			require.Nil(t, json.Unmarshal(data, &ready))
+			require.Equal(t, key, ready.Key)
+			require.Equal(t, dest, ready.Dir)
+
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package restore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// clusterVersionFile holds the cluster version in the hot-restart folder of a member
+const clusterVersionFile = "cluster/cluster-version.txt"
+
+// layoutStep moves the files of the hot-restart folder of a member to where the Hazelcast versions
+// since Since expect them
+type layoutStep struct {
+	// Since is the first minor version with the new layout, e.g. 5.4
+	Since       string `json:"since"`
+	Description string `json:"description"`
+	// Moves rename files or folders relative to the member folder, in order
+	Moves []layoutMove `json:"moves"`
+}
+
+type layoutMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// builtinLayoutSteps are the layout changes between the Hazelcast versions, in the order of their
+// versions. The hot-restart layout has not changed since 5.0, the changes of newer versions are
+// added here, and -layout-migrations adds steps without a new agent.
+var builtinLayoutSteps []layoutStep
+
+// layoutMigration migrates the restored hot-restart folders of a backup taken with an older Hazelcast
+// version to the layout of the target version. The steps between the two versions are applied in order.
+type layoutMigration struct {
+	Target string
+	Steps  []layoutStep
+}
+
+// newLayoutMigration returns the migration to the target version with the built-in steps and those
+// of the JSON file, if set
+func newLayoutMigration(target, file string) (*layoutMigration, error) {
+	if target == "" {
+		return nil, errors.New("the layout migration requires the Hazelcast version of the cluster")
+	}
+	if _, _, err := parseVersion(target); err != nil {
+		return nil, err
+	}
+	steps := append([]layoutStep(nil), builtinLayoutSteps...)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var extra []layoutStep
+		if err = json.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("invalid layout migrations %s: %w", file, err)
+		}
+		steps = append(steps, extra...)
+	}
+	for _, s := range steps {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return compareVersions(steps[i].Since, steps[j].Since) < 0
+	})
+	return &layoutMigration{Target: target, Steps: steps}, nil
+}
+
+func (s layoutStep) validate() error {
+	if _, _, err := parseVersion(s.Since); err != nil {
+		return fmt.Errorf("invalid layout migration %q: %w", s.Description, err)
+	}
+	for _, m := range s.Moves {
+		for _, p := range []string{m.From, m.To} {
+			clean := path.Clean(p)
+			if p == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+				return fmt.Errorf("invalid layout migration %q: path %q must be relative to the member folder", s.Description, p)
+			}
+		}
+	}
+	return nil
+}
+
+// layoutMigrationError fails a restore whose layout could not be migrated
+type layoutMigrationError struct {
+	From, To string
+	err      error
+}
+
+func (e *layoutMigrationError) Error() string {
+	return fmt.Sprintf("migrating the layout of the backup from Hazelcast %s to %s: %s", e.From, e.To, e.err.Error())
+}
+
+func (e *layoutMigrationError) Unwrap() error {
+	return e.err
+}
+
+// Reason returns the reason reported in the termination message
+func (e *layoutMigrationError) Reason() string {
+	return api.RestoreReasonLayoutMigrationFailed
+}
+
+// migrate applies the steps between the version of the backup restored into dir and the target to
+// every member folder. Backups of an unknown version are left as they are, a nil migration does nothing.
+func (m *layoutMigration) migrate(dir string) error {
+	if m == nil {
+		return nil
+	}
+	uuids, err := fileutil.FolderUUIDs(dir)
+	if err != nil {
+		return err
+	}
+	source := backupVersion(dir, uuids)
+	if source == "" {
+		bucketToPVCLog.Warn("the Hazelcast version of the backup is unknown, its layout is not migrated")
+		return nil
+	}
+	if compareVersions(source, m.Target) > 0 {
+		return &layoutMigrationError{From: source, To: m.Target, err: errors.New("backups of newer versions cannot be migrated")}
+	}
+
+	for _, s := range m.Steps {
+		if compareVersions(s.Since, source) <= 0 || compareVersions(s.Since, m.Target) > 0 {
+			continue
+		}
+		bucketToPVCLog.Info("migrating hot-restart layout", zap.String("since", s.Since), zap.String("description", s.Description))
+		for _, uuid := range uuids {
+			for _, mv := range s.Moves {
+				if err = move(filepath.Join(dir, uuid.Name()), mv); err != nil {
+					return &layoutMigrationError{From: source, To: m.Target, err: err}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// move renames a file or folder of the member folder, backups without it are left as they are
+func move(member string, m layoutMove) error {
+	from := filepath.Join(member, filepath.FromSlash(m.From))
+	to := filepath.Join(member, filepath.FromSlash(m.To))
+	if _, err := os.Lstat(from); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("cannot move %s, %s exists already", m.From, m.To)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// backupVersion returns the Hazelcast version of the backup manifest, or the cluster version of the
+// first member folder for backups without one, empty if neither is known
+func backupVersion(dir string, uuids []os.DirEntry) string {
+	if data, err := os.ReadFile(filepath.Join(dir, archive.MetaDir, archive.BackupManifestName)); err == nil {
+		var m api.BackupManifest
+		if json.Unmarshal(data, &m) == nil {
+			if _, _, err = parseVersion(m.HazelcastVersion); err == nil {
+				return m.HazelcastVersion
+			}
+		}
+	}
+	for _, uuid := range uuids {
+		data, err := os.ReadFile(filepath.Join(dir, uuid.Name(), filepath.FromSlash(clusterVersionFile)))
+		if err != nil {
+			continue
+		}
+		v := strings.TrimSpace(string(data))
+		if _, _, err = parseVersion(v); err == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseVersion returns the major and minor number of a version, e.g. 5 and 3 of 5.3.2-SNAPSHOT
+func parseVersion(v string) (int, int, error) {
+	major, minor, ok := strings.Cut(minorVersion(v), ".")
+	if ok {
+		a, errA := strconv.Atoi(major)
+		b, errB := strconv.Atoi(minor)
+		if errA == nil && errB == nil {
+			return a, b, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid Hazelcast version %q", v)
+}
+
+// olderVersion reports whether a is an older minor version than b, both must be valid
+func olderVersion(a, b string) bool {
+	if _, _, err := parseVersion(a); err != nil {
+		return false
+	}
+	if _, _, err := parseVersion(b); err != nil {
+		return false
+	}
+	return compareVersions(a, b) < 0
+}
+
+// compareVersions compares the minor versions of a and b, invalid versions are the oldest
+func compareVersions(a, b string) int {
+	majorA, minorA, _ := parseVersion(a)
+	majorB, minorB, _ := parseVersion(b)
+	switch {
+	case majorA != majorB:
+		return majorA - majorB
+	default:
+		return minorA - minorB
+	}
+}
@@ -0,0 +1,123 @@
+package restore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+const migrateUUID = "00000000-0000-0000-0000-000000000001"
+
+// restoredBackup writes a restored member folder with the files and a backup manifest of the version
+func restoredBackup(t *testing.T, version string, files ...string) string {
+	dir := t.TempDir()
+	for _, f := range files {
+		name := filepath.Join(dir, migrateUUID, filepath.FromSlash(f))
+		require.Nil(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.Nil(t, os.WriteFile(name, []byte(f), 0644))
+	}
+	if version != "" {
+		data, err := json.Marshal(api.BackupManifest{HazelcastVersion: version})
+		require.Nil(t, err)
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, archive.MetaDir), 0755))
+		require.Nil(t, os.WriteFile(filepath.Join(dir, archive.MetaDir, archive.BackupManifestName), data, 0644))
+	}
+	return dir
+}
+
+func requireFile(t *testing.T, dir, name string, exists bool) {
+	_, err := os.Stat(filepath.Join(dir, migrateUUID, filepath.FromSlash(name)))
+	if exists {
+		require.Nil(t, err, name)
+	} else {
+		require.True(t, errors.Is(err, os.ErrNotExist), name)
+	}
+}
+
+func writeMigrations(t *testing.T, steps []layoutStep) string {
+	data, err := json.Marshal(steps)
+	require.Nil(t, err)
+	name := filepath.Join(t.TempDir(), "migrations.json")
+	require.Nil(t, os.WriteFile(name, data, 0644))
+	return name
+}
+
+func TestLayoutMigration(t *testing.T) {
+	file := writeMigrations(t, []layoutStep{
+		{Since: "5.5", Description: "members move", Moves: []layoutMove{{From: "cluster/members.bin", To: "members/members.bin"}}},
+		{Since: "5.4", Description: "configs rename", Moves: []layoutMove{{From: "configs", To: "config"}}},
+	})
+	m, err := newLayoutMigration("5.5.1", file)
+	require.Nil(t, err)
+	require.Equal(t, "5.4", m.Steps[0].Since, "the steps are applied in the order of their versions")
+
+	dir := restoredBackup(t, "5.3.2", "cluster/members.bin", "configs/map.bin", "s00/value/01/0000000000000001.chunk")
+	require.Nil(t, m.migrate(dir))
+	requireFile(t, dir, "members/members.bin", true)
+	requireFile(t, dir, "cluster/members.bin", false)
+	requireFile(t, dir, "config/map.bin", true)
+	requireFile(t, dir, "s00/value/01/0000000000000001.chunk", true)
+
+	// the steps up to the version of the backup were applied when it was taken
+	dir = restoredBackup(t, "5.4.0", "cluster/members.bin", "configs/map.bin")
+	require.Nil(t, m.migrate(dir))
+	requireFile(t, dir, "members/members.bin", true)
+	requireFile(t, dir, "configs/map.bin", true)
+
+	// the steps after the target version do not apply
+	m, err = newLayoutMigration("5.4", file)
+	require.Nil(t, err)
+	dir = restoredBackup(t, "5.3.2", "cluster/members.bin", "configs/map.bin")
+	require.Nil(t, m.migrate(dir))
+	requireFile(t, dir, "cluster/members.bin", true)
+	requireFile(t, dir, "config/map.bin", true)
+}
+
+func TestLayoutMigrationVersions(t *testing.T) {
+	file := writeMigrations(t, []layoutStep{{Since: "5.4", Moves: []layoutMove{{From: "configs", To: "config"}}}})
+	m, err := newLayoutMigration("5.4.1", file)
+	require.Nil(t, err)
+
+	// without a manifest the cluster version of the member folder is used
+	dir := restoredBackup(t, "", "configs/map.bin")
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, migrateUUID, "cluster"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, migrateUUID, clusterVersionFile), []byte("5.3\n"), 0644))
+	require.Nil(t, m.migrate(dir))
+	requireFile(t, dir, "config/map.bin", true)
+
+	// backups of an unknown version are left as they are
+	dir = restoredBackup(t, "", "configs/map.bin")
+	require.Nil(t, m.migrate(dir))
+	requireFile(t, dir, "configs/map.bin", true)
+
+	dir = restoredBackup(t, "5.5.0", "configs/map.bin")
+	err = m.migrate(dir)
+	var migrationErr *layoutMigrationError
+	require.True(t, errors.As(err, &migrationErr), "Error is: ", err)
+	require.Equal(t, api.RestoreReasonLayoutMigrationFailed, failureReason(err))
+
+	// a move never replaces files
+	dir = restoredBackup(t, "5.3.0", "configs/map.bin", "config/map.bin")
+	require.True(t, errors.As(m.migrate(dir), &migrationErr))
+}
+
+func TestNewLayoutMigrationInvalid(t *testing.T) {
+	_, err := newLayoutMigration("", "")
+	require.NotNil(t, err, "the target version is required")
+	_, err = newLayoutMigration("latest", "")
+	require.NotNil(t, err)
+	_, err = newLayoutMigration("5.4", writeMigrations(t, []layoutStep{{Since: "next"}}))
+	require.NotNil(t, err)
+	_, err = newLayoutMigration("5.4", writeMigrations(t, []layoutStep{{Since: "5.4", Moves: []layoutMove{{From: "configs", To: "../config"}}}}))
+	require.NotNil(t, err, "moves stay within the member folder")
+
+	var m *layoutMigration
+	require.Nil(t, m.migrate(t.TempDir()))
+}
@@ -0,0 +1,128 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// ownership is applied to every restored file and folder, e.g. for a Hazelcast container that runs
+// as another user than the archive was created with. A nil ownership keeps the archive's.
+type ownership struct {
+	// uid and gid are -1 to keep the owner or the group
+	uid, gid int
+	// dirMode and fileMode replace the permission bits, 0 keeps the mode of the archive
+	dirMode, fileMode fs.FileMode
+}
+
+// parseOwnership parses the -chown uid:gid and the octal -chmod-dirs and -chmod-files options, it
+// returns nil if none is set
+func parseOwnership(chown, chmodDirs, chmodFiles string) (*ownership, error) {
+	if chown == "" && chmodDirs == "" && chmodFiles == "" {
+		return nil, nil
+	}
+	o := &ownership{uid: -1, gid: -1}
+	if chown != "" {
+		var err error
+		if o.uid, o.gid, err = fileutil.ParseChown(chown, "chown"); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if o.dirMode, err = parseMode(chmodDirs, "chmod-dirs"); err != nil {
+		return nil, err
+	}
+	if o.fileMode, err = parseMode(chmodFiles, "chmod-files"); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parseControlOwnership parses the -control-chown uid:gid and the octal -control-chmod options of
+// the control files, it returns nil if neither is set
+func parseControlOwnership(chown, chmod string) (*ownership, error) {
+	if chown == "" && chmod == "" {
+		return nil, nil
+	}
+	o := &ownership{uid: -1, gid: -1}
+	var err error
+	if chown != "" {
+		if o.uid, o.gid, err = fileutil.ParseChown(chown, "control-chown"); err != nil {
+			return nil, err
+		}
+	}
+	if o.fileMode, err = parseMode(chmod, "control-chmod"); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func parseMode(s, option string) (fs.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m == 0 || m > 0777 {
+		return 0, fmt.Errorf("invalid %s %q, expected octal permissions, e.g. 0750", option, s)
+	}
+	return fs.FileMode(m), nil
+}
+
+// apply sets the owner and the mode of the file or folder, symlinks only get the owner
+func (o *ownership) apply(name string, mode fs.FileMode) error {
+	if o == nil {
+		return nil
+	}
+	if o.uid >= 0 || o.gid >= 0 {
+		if err := os.Lchown(name, o.uid, o.gid); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return fmt.Errorf("%w, changing the owner needs the CHOWN capability, e.g. running the agent as root", err)
+			}
+			return err
+		}
+	}
+	perm := o.fileMode
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return nil
+	case mode.IsDir():
+		perm = o.dirMode
+	}
+	if perm == 0 {
+		return nil
+	}
+	return os.Chmod(name, perm)
+}
+
+// mkdirAll creates the folder and its missing parents, the created folders get the ownership
+func (o *ownership) mkdirAll(dir string, perm fs.FileMode) error {
+	if o == nil {
+		return os.MkdirAll(dir, perm)
+	}
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err = o.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	err = os.Mkdir(dir, perm)
+	// parallel writers create the same parents
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return o.apply(dir, fs.ModeDir|perm)
+}
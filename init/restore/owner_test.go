@@ -0,0 +1,93 @@
+package restore
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOwnership(t *testing.T) {
+	tests := []struct {
+		name                         string
+		chown, chmodDirs, chmodFiles string
+		want                         *ownership
+		wantErr                      bool
+	}{
+		{"none", "", "", "", nil, false},
+		{"uid and gid", "65534:1000", "", "", &ownership{uid: 65534, gid: 1000}, false},
+		{"uid", "185", "", "", &ownership{uid: 185, gid: -1}, false},
+		{"gid", ":1000", "", "", &ownership{uid: -1, gid: 1000}, false},
+		{"modes", "", "0750", "640", &ownership{uid: -1, gid: -1, dirMode: 0750, fileMode: 0640}, false},
+		{"user name", "hazelcast:hazelcast", "", "", nil, true},
+		{"negative", "-1:0", "", "", nil, true},
+		{"not octal", "", "0790", "", nil, true},
+		{"special bits", "", "", "4755", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOwnership(tt.chown, tt.chmodDirs, tt.chmodFiles)
+			require.Equal(t, tt.wantErr, err != nil, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseControlOwnership(t *testing.T) {
+	tests := []struct {
+		name         string
+		chown, chmod string
+		want         *ownership
+		wantErr      string
+	}{
+		{"none", "", "", nil, ""},
+		{"uid and gid", "185:0", "", &ownership{uid: 185, gid: 0}, ""},
+		{"mode", "", "0640", &ownership{uid: -1, gid: -1, fileMode: 0640}, ""},
+		{"user name", "hazelcast", "", nil, "invalid control-chown"},
+		{"not octal", "", "0680", nil, "invalid control-chmod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseControlOwnership(tt.chown, tt.chmod)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.Nil(t, err)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDiskWriterOwnership(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	for _, workers := range writerWorkers {
+		dir := t.TempDir()
+		w := newDiskWriter(10, 2, workers)
+		w.owner = &ownership{uid: 65534, gid: 1000, dirMode: 0750, fileMode: 0640}
+		require.Nil(t, w.entry(filepath.Join(dir, "uuid"), dirInfo{}))
+		require.Nil(t, w.entry(filepath.Join(dir, "uuid", "cluster", "members.bin"), fileInfo{}))
+		require.Nil(t, w.copyFrom(bytes.NewReader([]byte("members"))))
+		require.Nil(t, w.symlink(filepath.Join(dir, "uuid", "link"), "cluster/members.bin"))
+		require.Nil(t, w.close())
+
+		// the parent folder without an entry of its own is owned as well
+		for name, mode := range map[string]fs.FileMode{"uuid": fs.ModeDir | 0750, "uuid/cluster": fs.ModeDir | 0750, "uuid/cluster/members.bin": 0640} {
+			info, err := os.Lstat(filepath.Join(dir, name))
+			require.Nil(t, err)
+			require.Equal(t, mode, info.Mode(), name)
+			st := info.Sys().(*syscall.Stat_t)
+			require.Equal(t, uint32(65534), st.Uid, name)
+			require.Equal(t, uint32(1000), st.Gid, name)
+		}
+		info, err := os.Lstat(filepath.Join(dir, "uuid", "link"))
+		require.Nil(t, err)
+		require.Equal(t, uint32(65534), info.Sys().(*syscall.Stat_t).Uid)
+	}
+}
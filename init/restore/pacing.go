@@ -0,0 +1,96 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/cgroup"
+)
+
+const (
+	// pacingCheckBytes is the amount written between two reads of the cgroup memory
+	pacingCheckBytes = 8 << 20
+	pacingInterval   = 100 * time.Millisecond
+	// pacingMaxWait bounds a single pause, slow volumes make progress even if the cache never drains
+	pacingMaxWait = 10 * time.Second
+)
+
+// writePacer slows down the extraction while the page cache of the container holds too much
+// data that is not on disk yet. Dirty pages count against the memory limit of the cgroup, on
+// slow volumes they pile up faster than they are written back and the container is OOM-killed.
+type writePacer struct {
+	root string
+	// ratio is the part of the memory limit the pending page cache may use
+	ratio    float64
+	interval time.Duration
+	maxWait  time.Duration
+
+	// mu is held during a pause, so that the files written in parallel pause together
+	mu      sync.Mutex
+	written int64
+	paused  time.Duration
+	pauses  int
+}
+
+// newWritePacer returns nil if the ratio is 0 or the container has no memory limit
+func newWritePacer(root string, ratio float64) *writePacer {
+	if ratio <= 0 {
+		return nil
+	}
+	if _, err := cgroup.ReadMemory(root); err != nil {
+		if !errors.Is(err, cgroup.ErrNoLimit) {
+			bucketToPVCLog.Info("write pacing disabled, cgroup memory is not readable: " + err.Error())
+		}
+		return nil
+	}
+	return &writePacer{root: root, ratio: ratio, interval: pacingInterval, maxWait: pacingMaxWait}
+}
+
+// wrote is called after n bytes were written to f. Under pressure f is synced, which writes back
+// its dirty pages, and the writes pause until the pending page cache is below the ratio.
+func (p *writePacer) wrote(n int, f *os.File) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written += int64(n)
+	if p.written < pacingCheckBytes {
+		return nil
+	}
+	p.written = 0
+	if !p.pressure() {
+		return nil
+	}
+
+	start := time.Now()
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	for p.pressure() && time.Since(start) < p.maxWait {
+		time.Sleep(p.interval)
+	}
+	p.paused += time.Since(start)
+	p.pauses++
+	return nil
+}
+
+func (p *writePacer) pressure() bool {
+	m, err := cgroup.ReadMemory(p.root)
+	if err != nil {
+		return false
+	}
+	return float64(m.Pending()) > p.ratio*float64(m.Limit)
+}
+
+// report logs how long the writes were paused
+func (p *writePacer) report() {
+	if p == nil || p.pauses == 0 {
+		return
+	}
+	bucketToPVCLog.Info("paced disk writes because of page cache pressure", zap.Int("pauses", p.pauses), zap.Duration("paused", p.paused))
+}
@@ -0,0 +1,57 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePacer(t *testing.T) {
+	root, err := os.MkdirTemp("", "cgroup")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	setDirty := func(dirty string) {
+		require.Nil(t, os.WriteFile(filepath.Join(root, "memory.stat"), []byte("file_dirty "+dirty+"\nfile_writeback 0\n"), 0600))
+	}
+
+	// no limit, no pacing
+	require.Nil(t, os.WriteFile(filepath.Join(root, "memory.max"), []byte("max\n"), 0600))
+	setDirty("0")
+	require.Nil(t, newWritePacer(root, 0.25))
+
+	require.Nil(t, os.WriteFile(filepath.Join(root, "memory.max"), []byte("1000\n"), 0600))
+	require.Nil(t, newWritePacer(root, 0))
+	p := newWritePacer(root, 0.25)
+	require.NotNil(t, p)
+	p.interval, p.maxWait = time.Millisecond, 50*time.Millisecond
+
+	f, err := os.Create(filepath.Join(root, "data.bin"))
+	require.Nil(t, err)
+	defer f.Close()
+
+	// the cgroup is only read once enough was written
+	setDirty("900")
+	require.Nil(t, p.wrote(pacingCheckBytes-1, f))
+	require.Equal(t, 0, p.pauses)
+
+	// under pressure the writes wait up to the max wait
+	require.Nil(t, p.wrote(1, f))
+	require.Equal(t, 1, p.pauses)
+	require.GreaterOrEqual(t, p.paused, p.maxWait)
+
+	// the pause ends once the page cache drained
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		setDirty("100")
+	}()
+	p.maxWait = 5 * time.Second
+	require.Nil(t, p.wrote(pacingCheckBytes, f))
+	require.Equal(t, 2, p.pauses)
+	require.Less(t, p.paused, p.maxWait)
+
+	require.Nil(t, p.wrote(pacingCheckBytes, f))
+	require.Equal(t, 2, p.pauses)
+}
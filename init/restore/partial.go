@@ -0,0 +1,66 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+)
+
+// partialBackupError is returned for a dated folder with fewer archives than members took the
+// backup, e.g. because some uploads failed, unless the restore was confirmed
+type partialBackupError struct {
+	Folder   string
+	Archives int
+	Expected int
+}
+
+func (e *partialBackupError) Error() string {
+	return fmt.Sprintf("backup %s is partial: %d of %d member archives were uploaded, restore with -allow-partial to use it anyway",
+		e.Folder, e.Archives, e.Expected)
+}
+
+// Reason returns the reason reported in the termination message
+func (e *partialBackupError) Reason() string {
+	return api.RestoreReasonPartialBackup
+}
+
+// checkComplete compares the archives of the folder with the cluster size recorded by the
+// uploads. Archives of older agents and synced member folders record no size, their folders
+// are always complete.
+func checkComplete(ctx context.Context, bucket *blob.Bucket, folder string, keys []string, allowPartial bool, retry bkt.Retry) error {
+	var expected int
+	for _, key := range keys {
+		// synced member folders have no metadata
+		if isDirectoryKey(key) {
+			continue
+		}
+		var size int
+		err := retry.Do(ctx, "reading the attributes of "+key, func() error {
+			var err error
+			size, err = archive.ReadClusterSize(ctx, bucket, key)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if size > expected {
+			expected = size
+		}
+	}
+	if len(keys) >= expected {
+		return nil
+	}
+
+	err := &partialBackupError{Folder: folder, Archives: len(keys), Expected: expected}
+	if !allowPartial {
+		return err
+	}
+	bucketToPVCLog.Warn("restoring a partial backup", zap.String("folder", folder), zap.Int("archives", len(keys)), zap.Int("expected", expected))
+	return nil
+}
@@ -0,0 +1,50 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+)
+
+func TestFindPartial(t *testing.T) {
+	tests := []struct {
+		name         string
+		sizes        map[string]int
+		allowPartial bool
+		want         []string
+		wantErr      bool
+	}{
+		{"complete", map[string]int{"a.tar.gz": 2, "b.tar.gz": 2}, false, []string{"2022-06-13-00-00-00/a.tar.gz", "2022-06-13-00-00-00/b.tar.gz"}, false},
+		{"partial", map[string]int{"a.tar.gz": 3, "b.tar.gz": 3}, false, nil, true},
+		{"partial confirmed", map[string]int{"a.tar.gz": 3}, true, []string{"2022-06-13-00-00-00/a.tar.gz"}, false},
+		{"older agents", map[string]int{"a.tar.gz": 0}, false, []string{"2022-06-13-00-00-00/a.tar.gz"}, false},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			for k, size := range tt.sizes {
+				require.Nil(t, bucket.WriteAll(ctx, "2022-06-13-00-00-00/"+k, []byte(""), archive.WithClusterSize(nil, size)))
+			}
+
+			got, err := find(ctx, bucket, backupSelector{Location: time.UTC, AllowPartial: tt.allowPartial}, bkt.Retry{})
+			if tt.wantErr {
+				var partial *partialBackupError
+				require.ErrorAs(t, err, &partial)
+				require.Equal(t, api.RestoreReasonPartialBackup, failureReason(err))
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
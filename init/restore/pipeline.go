@@ -0,0 +1,431 @@
+package restore
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The restore runs as a pipeline of three stages connected by bounded channels: the network
+// read, the decompression and tar parsing, and the disk write. While the archive is decompressed
+// the next chunks are already downloaded and the previous ones written, so the slowest stage
+// sets the throughput instead of the sum of all stages.
+
+type chunk struct {
+	b   []byte
+	err error
+}
+
+// readAhead reads the source in its own goroutine, up to depth chunks are buffered
+type readAhead struct {
+	chunks chan chunk
+	free   chan []byte
+	done   chan struct{}
+	once   sync.Once
+	cur    []byte
+	buf    []byte
+	err    error
+}
+
+func newReadAhead(src io.Reader, size, depth int) *readAhead {
+	ra := &readAhead{
+		chunks: make(chan chunk, depth),
+		free:   make(chan []byte, depth+1),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < depth+1; i++ {
+		ra.free <- make([]byte, size)
+	}
+	go ra.run(src)
+	return ra
+}
+
+func (ra *readAhead) run(src io.Reader) {
+	defer close(ra.chunks)
+	for {
+		var b []byte
+		select {
+		case b = <-ra.free:
+		case <-ra.done:
+			return
+		}
+
+		n, err := io.ReadFull(src, b)
+		if n > 0 {
+			select {
+			case ra.chunks <- chunk{b: b[:n]}:
+			case <-ra.done:
+				return
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		if err != nil {
+			select {
+			case ra.chunks <- chunk{err: err}:
+			case <-ra.done:
+			}
+			return
+		}
+	}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for len(ra.cur) == 0 {
+		if ra.buf != nil {
+			// the chunk is consumed, hand the buffer back to the reader
+			ra.free <- ra.buf[:cap(ra.buf)]
+			ra.buf = nil
+		}
+		if ra.err != nil {
+			return 0, ra.err
+		}
+		c, ok := <-ra.chunks
+		switch {
+		case !ok:
+			ra.err = io.EOF
+		case c.err != nil:
+			ra.err = c.err
+		default:
+			ra.cur, ra.buf = c.b, c.b
+		}
+	}
+	n := copy(p, ra.cur)
+	ra.cur = ra.cur[n:]
+	return n, nil
+}
+
+// Close stops the reader goroutine, the source is not closed
+func (ra *readAhead) Close() error {
+	ra.once.Do(func() { close(ra.done) })
+	return nil
+}
+
+// writeOp is either the start of an entry, a symlink, a chunk of the current file or a
+// function that runs once everything before it is written
+type writeOp struct {
+	name string
+	info fs.FileInfo
+	link string
+	data []byte
+	fn   func() error
+}
+
+// diskWriter writes the entries in its own goroutine in the order they were added. With more than
+// one worker the files are written in parallel, directories, symlinks and functions are still
+// handled in order.
+type diskWriter struct {
+	ops  chan writeOp
+	free chan []byte
+	done chan struct{}
+	// progress counts the written bytes, it is set before the first entry
+	progress *restoreProgress
+	// pacer throttles the writes under page cache pressure, it is set before the first entry
+	pacer *writePacer
+	// workers is the number of files written at once
+	workers int
+	// owner is applied to the written entries, it is set before the first entry
+	owner *ownership
+
+	mu  sync.Mutex
+	err error
+}
+
+func newDiskWriter(size, depth, workers int) *diskWriter {
+	w := &diskWriter{
+		ops:     make(chan writeOp, depth),
+		free:    make(chan []byte, depth+1),
+		done:    make(chan struct{}),
+		workers: workers,
+	}
+	for i := 0; i < depth+1; i++ {
+		w.free <- make([]byte, size)
+	}
+	go w.run()
+	return w
+}
+
+func (w *diskWriter) run() {
+	defer close(w.done)
+	if w.workers > 1 {
+		w.runParallel()
+		w.pacer.report()
+		return
+	}
+	var f *os.File
+	for op := range w.ops {
+		if w.failed() {
+			// drain the queue so that the producer does not block
+			w.recycle(op)
+			continue
+		}
+
+		var err error
+		switch {
+		case op.fn != nil:
+			err = closeFile(f)
+			f = nil
+			if err == nil {
+				err = op.fn()
+			}
+		case op.link != "":
+			err = closeFile(f)
+			f = nil
+			if err == nil {
+				err = createSymlink(op.name, op.link, w.owner)
+			}
+		case op.info != nil:
+			err = closeFile(f)
+			f = nil
+			if err == nil {
+				f, err = openEntry(op.name, op.info, w.owner)
+			}
+		case f != nil:
+			var n int
+			n, err = f.Write(op.data)
+			w.progress.addExtracted(int64(n))
+			if err == nil {
+				err = w.pacer.wrote(n, f)
+			}
+		}
+		w.recycle(op)
+		w.setErr(err)
+	}
+	w.setErr(closeFile(f))
+	w.pacer.report()
+}
+
+// runParallel hands every file with its chunks to one of the workers. A directory is created before
+// the entries after it are handed out, once the files at or below it are written, its mode must not
+// lock out a running worker. Symlinks and functions wait for all files before them, a link must not
+// change where a running worker writes.
+func (w *diskWriter) runParallel() {
+	slots := make(chan struct{}, w.workers)
+	var wg sync.WaitGroup
+	// inFlight holds the files being written, an archive with the same file twice writes them in order
+	var mu sync.Mutex
+	inFlight := make(map[string]chan struct{})
+
+	var cur chan []byte
+	end := func() {
+		if cur != nil {
+			close(cur)
+			cur = nil
+		}
+	}
+	for op := range w.ops {
+		if w.failed() {
+			end()
+			w.recycle(op)
+			continue
+		}
+
+		switch {
+		case op.fn != nil:
+			end()
+			wg.Wait()
+			if !w.failed() {
+				w.setErr(op.fn())
+			}
+		case op.link != "":
+			end()
+			wg.Wait()
+			if !w.failed() {
+				w.setErr(createSymlink(op.name, op.link, w.owner))
+			}
+		case op.info != nil && op.info.IsDir():
+			end()
+			mu.Lock()
+			var below []chan struct{}
+			for name, done := range inFlight {
+				if name == op.name || strings.HasPrefix(name, op.name+string(filepath.Separator)) {
+					below = append(below, done)
+				}
+			}
+			mu.Unlock()
+			for _, done := range below {
+				<-done
+			}
+			if !w.failed() {
+				_, err := openEntry(op.name, op.info, w.owner)
+				w.setErr(err)
+			}
+		case op.info != nil:
+			end()
+			mu.Lock()
+			prev := inFlight[op.name]
+			done := make(chan struct{})
+			inFlight[op.name] = done
+			mu.Unlock()
+
+			// the chunks of a file never wait for the workers, the free buffers bound them
+			cur = make(chan []byte, cap(w.free))
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(name string, info fs.FileInfo, chunks chan []byte) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				if prev != nil {
+					<-prev
+				}
+				w.writeFile(name, info, chunks)
+				mu.Lock()
+				if inFlight[name] == done {
+					delete(inFlight, name)
+				}
+				mu.Unlock()
+				close(done)
+			}(op.name, op.info, cur)
+		case cur != nil:
+			// the worker recycles the chunk
+			cur <- op.data
+			continue
+		}
+		w.recycle(op)
+	}
+	end()
+	wg.Wait()
+}
+
+// writeFile writes the chunks to the file, after an error the remaining chunks are only recycled
+func (w *diskWriter) writeFile(name string, info fs.FileInfo, chunks chan []byte) {
+	f, err := openEntry(name, info, w.owner)
+	w.setErr(err)
+	for b := range chunks {
+		if f != nil && !w.failed() {
+			n, err := f.Write(b)
+			w.progress.addExtracted(int64(n))
+			if err == nil {
+				err = w.pacer.wrote(n, f)
+			}
+			w.setErr(err)
+		}
+		w.free <- b[:cap(b)]
+	}
+	w.setErr(closeFile(f))
+}
+
+func (w *diskWriter) recycle(op writeOp) {
+	if op.data != nil {
+		w.free <- op.data[:cap(op.data)]
+	}
+}
+
+// entry starts a new entry, files receive their content with copyFrom
+func (w *diskWriter) entry(name string, info fs.FileInfo) error {
+	if err := w.error(); err != nil {
+		return err
+	}
+	w.ops <- writeOp{name: name, info: info}
+	return nil
+}
+
+// symlink queues a symlink to link, it ends the current file
+func (w *diskWriter) symlink(name, link string) error {
+	if err := w.error(); err != nil {
+		return err
+	}
+	w.ops <- writeOp{name: name, link: link}
+	return nil
+}
+
+// after queues fn, it ends the current file and runs once the entries before it are written
+func (w *diskWriter) after(fn func() error) error {
+	if err := w.error(); err != nil {
+		return err
+	}
+	w.ops <- writeOp{fn: fn}
+	return nil
+}
+
+// copyFrom queues the content of the current file in chunks
+func (w *diskWriter) copyFrom(src io.Reader) error {
+	for {
+		if err := w.error(); err != nil {
+			return err
+		}
+		b := <-w.free
+		n, err := io.ReadFull(src, b)
+		if n > 0 {
+			w.ops <- writeOp{data: b[:n]}
+		} else {
+			w.free <- b
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close waits until all queued entries are written and returns the first error
+func (w *diskWriter) close() error {
+	close(w.ops)
+	<-w.done
+	return w.error()
+}
+
+func (w *diskWriter) failed() bool {
+	return w.error() != nil
+}
+
+func (w *diskWriter) error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *diskWriter) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// openEntry creates the directory or opens the file of an entry with the owner of the restore
+func openEntry(name string, info fs.FileInfo, owner *ownership) (*os.File, error) {
+	if info.IsDir() {
+		if err := owner.mkdirAll(name, info.Mode()); err != nil {
+			return nil, err
+		}
+		// the entry of a folder that already exists sets its owner as well
+		return nil, owner.apply(name, info.Mode())
+	}
+	// archives created by hand do not always have entries for the parent folders
+	if err := owner.mkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return nil, err
+	}
+	if err = owner.apply(name, info.Mode()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func createSymlink(name, link string, owner *ownership) error {
+	if err := owner.mkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	if err := os.Symlink(link, name); err != nil {
+		return err
+	}
+	return owner.apply(name, fs.ModeSymlink)
+}
+
+func closeFile(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
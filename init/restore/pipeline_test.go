@@ -0,0 +1,188 @@
+package restore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAhead(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	errRead := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		src     io.Reader
+		chunk   int
+		depth   int
+		want    []byte
+		wantErr error
+	}{
+		{"small chunks", bytes.NewReader(data), 7, 2, data, nil},
+		{"single chunk", bytes.NewReader(data), len(data) * 2, 1, data, nil},
+		{"one byte reads", iotest.OneByteReader(bytes.NewReader(data)), 64, 4, data, nil},
+		{"empty", bytes.NewReader(nil), 16, 4, []byte{}, nil},
+		{"read error", io.MultiReader(bytes.NewReader(data[:100]), iotest.ErrReader(errRead)), 16, 2, data[:100], errRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReadAhead(tt.src, tt.chunk, tt.depth)
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadAheadClose(t *testing.T) {
+	r := newReadAhead(bytes.NewReader(make([]byte, 1<<20)), 16, 2)
+	_, err := r.Read(make([]byte, 4))
+	require.Nil(t, err)
+
+	// the reader goroutine must stop while the chunk channel is full
+	require.Nil(t, r.Close())
+	require.Nil(t, r.Close())
+	for range r.chunks {
+	}
+}
+
+// writerWorkers are the worker counts the disk writer is tested with, one writes the files in order
+var writerWorkers = []int{1, 4}
+
+func TestDiskWriter(t *testing.T) {
+	for _, workers := range writerWorkers {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			dir := t.TempDir()
+			content := bytes.Repeat([]byte("hazelcast"), 100)
+			w := newDiskWriter(10, 2, workers)
+			require.Nil(t, w.entry(filepath.Join(dir, "a"), dirInfo{}))
+			require.Nil(t, w.entry(filepath.Join(dir, "a", "b", "data.bin"), fileInfo{}))
+			require.Nil(t, w.copyFrom(bytes.NewReader(content)))
+			require.Nil(t, w.entry(filepath.Join(dir, "empty.bin"), fileInfo{}))
+			require.Nil(t, w.close())
+
+			got, err := os.ReadFile(filepath.Join(dir, "a", "b", "data.bin"))
+			require.Nil(t, err)
+			require.Equal(t, content, got)
+			got, err = os.ReadFile(filepath.Join(dir, "empty.bin"))
+			require.Nil(t, err)
+			require.Empty(t, got)
+		})
+	}
+}
+
+func TestDiskWriterAfter(t *testing.T) {
+	for _, workers := range writerWorkers {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			dir := t.TempDir()
+			content := bytes.Repeat([]byte("hazelcast"), 100)
+			w := newDiskWriter(10, 2, workers)
+			require.Nil(t, w.entry(filepath.Join(dir, "members.bin"), fileInfo{}))
+			require.Nil(t, w.copyFrom(bytes.NewReader(content)))
+			require.Nil(t, w.entry(filepath.Join(dir, "members.bin.bak"), fileInfo{}))
+			require.Nil(t, w.copyFrom(bytes.NewReader(content)))
+			var ran bool
+			require.Nil(t, w.after(func() error {
+				ran = true
+				// the files before are complete, the one after is not started yet
+				for _, name := range []string{"members.bin", "members.bin.bak"} {
+					got, err := os.ReadFile(filepath.Join(dir, name))
+					require.Nil(t, err)
+					require.Equal(t, content, got)
+				}
+				require.NoFileExists(t, filepath.Join(dir, "0001.chunk"))
+				return nil
+			}))
+			require.Nil(t, w.entry(filepath.Join(dir, "0001.chunk"), fileInfo{}))
+			require.Nil(t, w.close())
+			require.True(t, ran)
+		})
+	}
+}
+
+func TestDiskWriterError(t *testing.T) {
+	for _, workers := range writerWorkers {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			dir := t.TempDir()
+			require.Nil(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0600))
+
+			w := newDiskWriter(10, 2, workers)
+			// a file cannot be the parent of another file
+			require.Nil(t, w.entry(filepath.Join(dir, "file", "data.bin"), fileInfo{}))
+			// the producer must not block on a failed writer
+			_ = w.copyFrom(bytes.NewReader(make([]byte, 1000)))
+			require.NotNil(t, w.close())
+			require.NotNil(t, w.entry(filepath.Join(dir, "other.bin"), fileInfo{}))
+		})
+	}
+}
+
+func TestDiskWriterParallel(t *testing.T) {
+	dir := t.TempDir()
+	w := newDiskWriter(16, 4, 4)
+	for i := 0; i < 50; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("s%02d", i%5))
+		if i < 5 {
+			require.Nil(t, w.entry(sub, dirInfo{}))
+		}
+		require.Nil(t, w.entry(filepath.Join(sub, fmt.Sprintf("%04d.chunk", i)), fileInfo{}))
+		require.Nil(t, w.copyFrom(bytes.NewReader(bytes.Repeat([]byte{byte(i)}, 100+i))))
+	}
+	// a file stored twice keeps the content of the later entry
+	for _, content := range []string{"first version of the file", "second"} {
+		require.Nil(t, w.entry(filepath.Join(dir, "twice.txt"), fileInfo{}))
+		require.Nil(t, w.copyFrom(strings.NewReader(content)))
+	}
+	require.Nil(t, w.close())
+
+	for i := 0; i < 50; i++ {
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("s%02d", i%5), fmt.Sprintf("%04d.chunk", i)))
+		require.Nil(t, err)
+		require.Equal(t, bytes.Repeat([]byte{byte(i)}, 100+i), got)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "twice.txt"))
+	require.Nil(t, err)
+	require.Equal(t, "second", string(got))
+}
+
+func TestDiskWriterParallelOrder(t *testing.T) {
+	dir := t.TempDir()
+	w := newDiskWriter(16, 4, 4)
+	sub := filepath.Join(dir, "s00")
+	for i := 0; i < 20; i++ {
+		require.Nil(t, w.entry(filepath.Join(sub, fmt.Sprintf("%04d.chunk", i)), fileInfo{}))
+		require.Nil(t, w.copyFrom(bytes.NewReader(bytes.Repeat([]byte{byte(i)}, 1000))))
+	}
+	// the entry of the folder after its files and a link to a file written by a worker
+	require.Nil(t, w.entry(sub, dirInfo{}))
+	require.Nil(t, w.symlink(filepath.Join(dir, "latest"), "s00/0019.chunk"))
+	require.Nil(t, w.close())
+
+	for i := 0; i < 20; i++ {
+		got, err := os.ReadFile(filepath.Join(sub, fmt.Sprintf("%04d.chunk", i)))
+		require.Nil(t, err)
+		require.Equal(t, bytes.Repeat([]byte{byte(i)}, 1000), got)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "latest"))
+	require.Nil(t, err)
+	require.Len(t, got, 1000)
+}
+
+type fileInfo struct{ os.FileInfo }
+
+func (fileInfo) IsDir() bool       { return false }
+func (fileInfo) Mode() os.FileMode { return 0600 }
+
+type dirInfo struct{ os.FileInfo }
+
+func (dirInfo) IsDir() bool       { return true }
+func (dirInfo) Mode() os.FileMode { return os.ModeDir | 0700 }
@@ -0,0 +1,176 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+// restoreProgress is the state served by the status listener, a nil progress ignores all updates
+type restoreProgress struct {
+	mu         sync.Mutex
+	status     api.RestoreStatus
+	downloaded atomic.Int64
+	extracted  atomic.Int64
+	retries    atomic.Int64
+}
+
+func newRestoreProgress() *restoreProgress {
+	return &restoreProgress{status: api.RestoreStatus{Phase: api.RestorePhaseStarting, StartedAt: clock.Now().UTC()}}
+}
+
+func (p *restoreProgress) setPhase(phase string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Phase = phase
+}
+
+// setArchive records the archive that is restored, credentials in the bucket URL are redacted
+func (p *restoreProgress) setArchive(bucketURL, key string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Bucket = logger.Redact(bucketURL)
+	p.status.Key = key
+}
+
+// setChecksum records the verified digest of the archive
+func (p *restoreProgress) setChecksum(sum string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Checksum = sum
+}
+
+func (p *restoreProgress) setTotal(size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.BytesTotal = size
+}
+
+func (p *restoreProgress) addError(msg string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Errors = append(p.status.Errors, logger.Redact(msg))
+}
+
+// setFailedEntries records the entries that failed so far
+func (p *restoreProgress) setFailedEntries(entries []api.FailedEntry) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.FailedEntries = entries
+}
+
+func (p *restoreProgress) addDownloaded(n int64) {
+	if p != nil {
+		p.downloaded.Add(n)
+	}
+}
+
+func (p *restoreProgress) addExtracted(n int64) {
+	if p != nil {
+		p.extracted.Add(n)
+	}
+}
+
+func (p *restoreProgress) addRetries(n int) {
+	if p != nil {
+		p.retries.Add(int64(n))
+	}
+}
+
+// retryCounter is the counter of the retries of bucket operations, nil if the progress is nil
+func (p *restoreProgress) retryCounter() *atomic.Int64 {
+	if p == nil {
+		return nil
+	}
+	return &p.retries
+}
+
+func (p *restoreProgress) snapshot() api.RestoreStatus {
+	p.mu.Lock()
+	s := p.status
+	s.Errors = append([]string(nil), p.status.Errors...)
+	s.FailedEntries = append([]api.FailedEntry(nil), p.status.FailedEntries...)
+	p.mu.Unlock()
+	s.BytesDownloaded = p.downloaded.Load()
+	s.BytesExtracted = p.extracted.Load()
+	s.Retries = p.retries.Load()
+	return s
+}
+
+// reader counts the bytes read from r as downloaded
+func (p *restoreProgress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *restoreProgress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.addDownloaded(int64(n))
+	return n, err
+}
+
+func (p *restoreProgress) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		serverutil.HttpError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	serverutil.HttpJSON(w, p.snapshot())
+}
+
+// serveStatus serves the progress on /restore/status at addr until the returned function is called
+func serveStatus(addr string, p *restoreProgress) (func(), error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/restore/status", p.statusHandler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			bucketToPVCLog.Warn("status listener stopped: " + err.Error())
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
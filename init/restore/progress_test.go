@@ -0,0 +1,86 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+func TestRestoreProgress(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_progress")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, os.MkdirAll(path.Join(archiveDir, "cluster"), 0700))
+	require.Nil(t, os.WriteFile(path.Join(archiveDir, "cluster", "members.bin"), []byte(strings.Repeat("a", 100000)), 0600))
+	var buf bytes.Buffer
+	require.Nil(t, archive.Create(&buf, archiveDir, layoutUUID))
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	key := layoutUUID + ".tar.gz"
+	require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+
+	tests := []struct {
+		name      string
+		opts      downloadOptions
+		wantPhase string
+	}{
+		{"streamed", downloadOptions{}, api.RestorePhaseStarting},
+		{"staged", downloadOptions{Workers: 2, PartSize: 1024, StagingDir: tmpdir}, api.RestorePhaseExtracting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRestoreProgress()
+			tt.opts.Progress = p
+			require.Nil(t, saveFromArchive(ctx, bucket, key, path.Join(tmpdir, tt.name), tt.opts))
+
+			s := p.snapshot()
+			require.Equal(t, tt.wantPhase, s.Phase)
+			require.Equal(t, int64(buf.Len()), s.BytesTotal)
+			require.Equal(t, int64(buf.Len()), s.BytesDownloaded)
+			require.Equal(t, int64(100000), s.BytesExtracted)
+		})
+	}
+}
+
+func TestRestoreStatusHandler(t *testing.T) {
+	p := newRestoreProgress()
+	p.setArchive("s3://user:secret@bucket", "backup/key.tar.gz")
+	p.setPhase(api.RestorePhaseDownloading)
+	p.addDownloaded(10)
+	p.addError(errors.New("gs://fallback: not found").Error())
+
+	w := httptest.NewRecorder()
+	p.statusHandler(w, httptest.NewRequest(http.MethodGet, "/restore/status", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var s api.RestoreStatus
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&s))
+	require.Equal(t, api.RestorePhaseDownloading, s.Phase)
+	require.Equal(t, "backup/key.tar.gz", s.Key)
+	require.NotContains(t, s.Bucket, "secret")
+	require.Equal(t, int64(10), s.BytesDownloaded)
+	require.Len(t, s.Errors, 1)
+
+	w = httptest.NewRecorder()
+	p.statusHandler(w, httptest.NewRequest(http.MethodPost, "/restore/status", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	_, err := serveStatus("invalid address", p)
+	require.NotNil(t, err)
+}
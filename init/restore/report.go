@@ -0,0 +1,78 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+// reportPrefix is the folder of the restore reports in the backup bucket
+const reportPrefix = "reports"
+
+// restoreReport is uploaded after a successful restore, collected over time the reports show
+// whether backups can be restored and how long it takes
+type restoreReport struct {
+	RestoreID       string    `json:"restore_id,omitempty"`
+	Hostname        string    `json:"hostname"`
+	Bucket          string    `json:"bucket"`
+	Key             string    `json:"key"`
+	Merged          []string  `json:"merged,omitempty"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Bytes           int64     `json:"bytes"`
+	BytesPerSecond  float64   `json:"bytes_per_second"`
+	Errors          []string  `json:"errors,omitempty"`
+}
+
+func newRestoreReport(restoreID, hostname string, res restoreResult, start time.Time, bytes int64) restoreReport {
+	d := time.Since(start).Seconds()
+	rep := restoreReport{
+		RestoreID:       restoreID,
+		Hostname:        hostname,
+		Bucket:          logger.Redact(res.Bucket),
+		Key:             res.Key,
+		Merged:          res.Merged,
+		Started:         start.UTC(),
+		DurationSeconds: d,
+		Bytes:           bytes,
+		Errors:          res.Errors,
+	}
+	if d > 0 {
+		rep.BytesPerSecond = float64(bytes) / d
+	}
+	return rep
+}
+
+// key returns the object key of the report, reports of the same cluster sort by time
+func (r restoreReport) key() string {
+	name := r.Started.Format(fileutil.FolderTimeFormat) + "-" + r.Hostname
+	if r.RestoreID != "" {
+		name += "-" + r.RestoreID
+	}
+	return path.Join(reportPrefix, name+".json")
+}
+
+// uploadReport writes the report to the bucket the backup was restored from
+func uploadReport(ctx context.Context, bucketURL string, secretData map[string][]byte, r restoreReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	b, err := bucket.OpenBucket(ctx, bucketURL, secretData)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if err = b.WriteAll(ctx, r.key(), data, nil); err != nil {
+		return err
+	}
+	bucketToPVCLog.Info("restore report uploaded: " + r.key())
+	return nil
+}
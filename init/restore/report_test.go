@@ -0,0 +1,37 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadReport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "restore_report")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2022, 6, 13, 10, 0, 0, 0, time.UTC)
+	res := restoreResult{
+		Bucket: "file://" + dir,
+		Key:    "2022-06-12-00-00-00/00000000-0000-0000-0000-000000000001.tar.gz",
+		Errors: []string{"s3://primary: unavailable"},
+	}
+	rep := newRestoreReport("restore-1", "hazelcast-0", res, start, 4<<20)
+	require.Greater(t, rep.DurationSeconds, 0.0)
+	require.InDelta(t, float64(4<<20)/rep.DurationSeconds, rep.BytesPerSecond, 1)
+	require.Equal(t, "reports/2022-06-13-10-00-00-hazelcast-0-restore-1.json", rep.key())
+
+	require.Nil(t, uploadReport(context.Background(), res.Bucket, nil, rep))
+
+	data, err := os.ReadFile(path.Join(dir, "reports", "2022-06-13-10-00-00-hazelcast-0-restore-1.json"))
+	require.Nil(t, err)
+	var got restoreReport
+	require.Nil(t, json.Unmarshal(data, &got))
+	require.Equal(t, rep, got)
+}
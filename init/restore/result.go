@@ -0,0 +1,52 @@
+package restore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+// defaultResultFile is written to the destination when the restore agent exits, whether it
+// succeeded or not
+const defaultResultFile = "restore-result.json"
+
+// newRestoreResult describes the restore of the progress that exited with status and restored size bytes
+func newRestoreResult(status subcommands.ExitStatus, s api.RestoreStatus, start time.Time, size *restoredSize, reason string) api.RestoreResult {
+	res := api.RestoreResult{
+		Status:          api.StatusSuccess,
+		Phase:           s.Phase,
+		Bucket:          s.Bucket,
+		Key:             s.Key,
+		Checksum:        s.Checksum,
+		Bytes:           size.bytes(),
+		StartedAt:       start.UTC(),
+		DurationSeconds: time.Since(start).Seconds(),
+		FailedEntries:   s.FailedEntries,
+	}
+	if status != subcommands.ExitSuccess {
+		res.Status = api.StatusFailure
+		res.Error = logger.LastError()
+		res.Reason = reason
+	}
+	return res
+}
+
+// writeResult writes the result file, a failure is only logged. Nothing is written for an empty
+// name, or if the destination does not exist.
+func writeResult(log *zap.Logger, name string, res api.RestoreResult, control *ownership) {
+	if name == "" {
+		return
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(name, data, control)
+	}
+	if err != nil {
+		log.Warn("could not write restore result file: " + err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package restore
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+func TestNewRestoreResult(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_result")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	require.Nil(t, os.MkdirAll(path.Join(tmpdir, "00000000-0000-0000-0000-000000000001"), 0755))
+	require.Nil(t, os.WriteFile(path.Join(tmpdir, "00000000-0000-0000-0000-000000000001", "0000000000000001.chunk"), []byte("data"), 0600))
+
+	s := api.RestoreStatus{Phase: api.RestorePhaseSucceeded, Bucket: "s3://bucket", Key: "2022-07-28-19-00-55/uuid.tar.gz", Checksum: "abc"}
+	start := time.Now().Add(-time.Minute)
+	size := &restoredSize{dir: tmpdir}
+	res := newRestoreResult(subcommands.ExitSuccess, s, start, size, "")
+	require.Equal(t, api.StatusSuccess, res.Status)
+	require.Equal(t, api.RestorePhaseSucceeded, res.Phase)
+	require.Equal(t, "2022-07-28-19-00-55/uuid.tar.gz", res.Key)
+	require.Equal(t, "abc", res.Checksum)
+	require.Equal(t, int64(4), res.Bytes)
+	require.GreaterOrEqual(t, res.DurationSeconds, 60.0)
+	require.Empty(t, res.Error)
+
+	// a failure is described by the last logged error
+	logger.New().Error("download error: connection reset")
+	s.Phase = api.RestorePhaseFailed
+	res = newRestoreResult(subcommands.ExitFailure, s, start, size, api.RestoreReasonCorruptedFiles)
+	require.Equal(t, api.StatusFailure, res.Status)
+	require.Equal(t, "download error: connection reset", res.Error)
+	require.Equal(t, api.RestoreReasonCorruptedFiles, res.Reason)
+
+	// the size is only walked once
+	require.Nil(t, os.WriteFile(path.Join(tmpdir, "00000000-0000-0000-0000-000000000001", "0000000000000002.chunk"), []byte("more"), 0600))
+	require.Equal(t, int64(4), size.bytes())
+}
+
+func TestWriteResult(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "restore_result")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	name := destinationFile(tmpdir, defaultResultFile)
+	writeResult(bucketToPVCLog, name, api.RestoreResult{Status: api.StatusSuccess, Phase: api.RestorePhaseSkipped, Hostname: "hazelcast-0"}, nil)
+	data, err := os.ReadFile(name)
+	require.Nil(t, err)
+	var res api.RestoreResult
+	require.Nil(t, json.Unmarshal(data, &res))
+	require.Equal(t, api.RestorePhaseSkipped, res.Phase)
+	require.Equal(t, "hazelcast-0", res.Hostname)
+
+	// the result of the next run replaces it, no temporary file is left behind
+	writeResult(bucketToPVCLog, name, api.RestoreResult{Status: api.StatusFailure, Phase: api.RestorePhaseFailed}, nil)
+	entries, err := fileutil.DirFileList(tmpdir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+
+	// a missing destination is only logged
+	writeResult(bucketToPVCLog, path.Join(tmpdir, "missing", defaultResultFile), api.RestoreResult{}, nil)
+	writeResult(bucketToPVCLog, destinationFile(tmpdir, ""), api.RestoreResult{}, nil)
+}
@@ -0,0 +1,72 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// Policies for backups that were taken with another cluster size
+const (
+	// scaleReject fails the restore of every member with a clusterSizeError
+	scaleReject = "reject"
+	// scaleMerge restores every archive exactly once, member i takes the archives i, i+size, ...
+	// Members of a larger cluster without an archive start empty.
+	scaleMerge = "merge"
+)
+
+func validScalePolicy(p string) error {
+	switch p {
+	case scaleReject, scaleMerge:
+		return nil
+	}
+	return fmt.Errorf("unknown scale policy %q, supported are %s and %s", p, scaleReject, scaleMerge)
+}
+
+// clusterSizeError is returned if the backup does not match the cluster size and the policy rejects it
+type clusterSizeError struct {
+	Archives int
+	Members  int
+}
+
+func (e *clusterSizeError) Error() string {
+	return fmt.Sprintf("cluster size mismatch: the backup has %d member archives, the cluster has %d members, restore into %d members or use the %s scale policy",
+		e.Archives, e.Members, e.Archives, scaleMerge)
+}
+
+// Reason returns the reason reported in the termination message
+func (e *clusterSizeError) Reason() string {
+	return api.RestoreReasonClusterSizeMismatch
+}
+
+// errExtraMember is returned for a member beyond the archives of the backup if extra members are allowed
+var errExtraMember = errors.New("member has no archive in the backup")
+
+// memberKeys returns the archives restored by member id, the first one is the archive of the
+// member itself. Without a cluster size every member is mapped to the key at its index.
+func memberKeys(keys []string, id int, sel backupSelector) ([]string, error) {
+	size := sel.ClusterSize
+	if size > 0 && id >= size {
+		return nil, fmt.Errorf("member index %d is outside of the cluster size %d", id, size)
+	}
+	// members added after the backup do not change the mapping of the others
+	if size == 0 || size == len(keys) || (sel.AllowExtraMembers && size > len(keys)) {
+		if id < len(keys) {
+			return keys[id : id+1], nil
+		}
+		if sel.AllowExtraMembers {
+			return nil, errExtraMember
+		}
+		return nil, fmt.Errorf("member index %d is greater than number of archived backup files %d", id, len(keys))
+	}
+	if sel.ScalePolicy != scaleMerge {
+		return nil, &clusterSizeError{Archives: len(keys), Members: size}
+	}
+
+	var l []string
+	for i := id; i < len(keys); i += size {
+		l = append(l, keys[i])
+	}
+	return l, nil
+}
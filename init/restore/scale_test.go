@@ -0,0 +1,123 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestMemberKeys(t *testing.T) {
+	keys := []string{"a.tar.gz", "b.tar.gz", "c.tar.gz", "d.tar.gz", "e.tar.gz"}
+	tests := []struct {
+		name    string
+		id      int
+		size    int
+		policy  string
+		extra   bool
+		want    []string
+		wantErr bool
+	}{
+		{"unknown size", 1, 0, scaleReject, false, []string{"b.tar.gz"}, false},
+		{"unknown size out of range", 5, 0, scaleReject, false, nil, true},
+		{"same size", 4, 5, scaleReject, false, []string{"e.tar.gz"}, false},
+		{"smaller cluster rejected", 0, 3, scaleReject, false, nil, true},
+		{"larger cluster rejected", 0, 7, scaleReject, false, nil, true},
+		{"merge first member", 0, 3, scaleMerge, false, []string{"a.tar.gz", "d.tar.gz"}, false},
+		{"merge last member", 2, 3, scaleMerge, false, []string{"c.tar.gz"}, false},
+		{"merge new member", 6, 7, scaleMerge, false, nil, false},
+		{"member outside cluster", 3, 3, scaleMerge, false, nil, true},
+		{"extra member", 5, 0, scaleReject, true, nil, true},
+		{"extra member of larger cluster", 6, 7, scaleReject, true, nil, true},
+		{"archive member of larger cluster", 4, 7, scaleReject, true, []string{"e.tar.gz"}, false},
+		{"smaller cluster with extra members", 0, 3, scaleReject, true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := memberKeys(keys, tt.id, backupSelector{ClusterSize: tt.size, ScalePolicy: tt.policy, AllowExtraMembers: tt.extra})
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClusterSizeReason(t *testing.T) {
+	_, err := memberKeys([]string{"a.tar.gz", "b.tar.gz"}, 0, backupSelector{ClusterSize: 1, ScalePolicy: scaleReject})
+	require.Equal(t, api.RestoreReasonClusterSizeMismatch, failureReason(fmt.Errorf("download: %w", err)))
+	require.Equal(t, "", failureReason(errInsufficientSpace))
+}
+
+func TestDownloadFromBucketToPVCMerge(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_merge")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+
+	// a backup of three members is restored into two
+	src := path.Join(tmpdir, "bucket")
+	var uuids []string
+	for i := 1; i <= 3; i++ {
+		uuid := fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i)
+		uuids = append(uuids, uuid)
+		require.Nil(t, createArchiveFile(archiveDir, uuid, path.Join(src, "2006-01-02-15-04-01", uuid+".tar.gz")))
+	}
+
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, os.MkdirAll(dst, 0700))
+
+	sel := backupSelector{Location: time.UTC, ClusterSize: 2, ScalePolicy: scaleReject}
+	_, err = downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 0, nil, sel, downloadOptions{})
+	var sizeErr *clusterSizeError
+	require.ErrorAs(t, err, &sizeErr)
+	require.Equal(t, clusterSizeError{Archives: 3, Members: 2}, *sizeErr)
+
+	sel.ScalePolicy = scaleMerge
+	res, err := downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 0, nil, sel, downloadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "2006-01-02-15-04-01/"+uuids[0]+".tar.gz", res.Key)
+	require.Equal(t, []string{"2006-01-02-15-04-01/" + uuids[2] + ".tar.gz"}, res.Merged)
+	require.DirExists(t, path.Join(dst, uuids[0], "cluster"))
+	require.DirExists(t, path.Join(dst, uuids[2], "cluster"))
+	require.NoDirExists(t, path.Join(dst, uuids[1]))
+}
+
+func TestDownloadFromBucketToPVCExtraMember(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "restore_extra")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+
+	src := path.Join(tmpdir, "bucket")
+	uuid := "00000000-0000-0000-0000-000000000001"
+	require.Nil(t, createArchiveFile(archiveDir, uuid, path.Join(src, "2006-01-02-15-04-01", uuid+".tar.gz")))
+
+	// the destination of the extra member is not touched
+	dst := path.Join(tmpdir, "dest")
+	existing := path.Join(dst, "00000000-0000-0000-0000-00000000000a")
+	require.Nil(t, os.MkdirAll(existing, 0700))
+
+	sel := backupSelector{Location: time.UTC}
+	_, err = downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 1, nil, sel, downloadOptions{})
+	require.NotNil(t, err)
+
+	sel.AllowExtraMembers = true
+	res, err := downloadFromBucketToPvc(ctx, []string{"file://" + src}, dst, 1, nil, sel, downloadOptions{})
+	require.Nil(t, err)
+	require.True(t, res.Extra)
+	require.Equal(t, "", res.Key)
+	require.DirExists(t, existing)
+	require.NoDirExists(t, path.Join(dst, uuid))
+}
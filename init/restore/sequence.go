@@ -0,0 +1,40 @@
+package restore
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// latestSequence selects the newest backup sequence folder, like an empty -src
+const latestSequence = "latest"
+
+// backupSequence returns the name of the backup sequence folder to restore from. Hazelcast keeps
+// a backup-<epoch millis> folder per backup, an empty src or "latest" selects the newest. Without
+// sequence folders the UUID folders directly below backupsDir are restored and the name is empty.
+func backupSequence(backupsDir, src string) (string, error) {
+	if src != "" && src != latestSequence {
+		if !fileutil.SequenceRegex.MatchString(path.Base(src)) {
+			localInPVCLog.Warn("backup folder is not named like a backup sequence: " + src)
+		}
+		return src, nil
+	}
+
+	seqs, err := fileutil.FolderSequence(backupsDir)
+	if err != nil {
+		return "", err
+	}
+	if len(seqs) == 0 {
+		uuids, err := fileutil.FolderUUIDs(backupsDir)
+		if err != nil {
+			return "", err
+		}
+		if len(uuids) == 0 {
+			return "", fmt.Errorf("no backup sequence or member folder in %s", backupsDir)
+		}
+		return "", nil
+	}
+	// the epoch millis have a fixed width, so the sorted names are in the order of the backups
+	return seqs[len(seqs)-1].Name(), nil
+}
@@ -0,0 +1,79 @@
+package restore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestBackupSequence(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []fileutil.File
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{
+			"latest by default",
+			[]fileutil.File{
+				{Name: "backup-1659034855000", IsDir: true},
+				{Name: "backup-1659121255000", IsDir: true},
+				{Name: "backup-1659007855000", IsDir: true},
+			},
+			"", "backup-1659121255000", false,
+		},
+		{
+			"latest",
+			[]fileutil.File{
+				{Name: "backup-1659034855000", IsDir: true},
+				{Name: "backup-1659121255000", IsDir: true},
+			},
+			"latest", "backup-1659121255000", false,
+		},
+		{
+			"chosen sequence",
+			[]fileutil.File{
+				{Name: "backup-1659034855000", IsDir: true},
+				{Name: "backup-1659121255000", IsDir: true},
+			},
+			"backup-1659034855000", "backup-1659034855000", false,
+		},
+		{
+			"other folders are ignored",
+			[]fileutil.File{
+				{Name: "backup-1659034855000", IsDir: true},
+				{Name: "backup-tmp", IsDir: true},
+				{Name: "backup-1659121255001", IsDir: false},
+			},
+			"", "backup-1659034855000", false,
+		},
+		{
+			"flat member folders",
+			[]fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+			},
+			"", "", false,
+		},
+		{
+			"no backup",
+			[]fileutil.File{},
+			"", "", true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "backup_sequence")
+			require.Nil(t, err)
+			defer os.RemoveAll(dir)
+			require.Nil(t, fileutil.CreateFiles(dir, tt.files, true))
+
+			got, err := backupSequence(dir, tt.src)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
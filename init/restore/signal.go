@@ -0,0 +1,45 @@
+package restore
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// withSignals returns a context that is canceled on SIGTERM or SIGINT. A restore that is stopped
+// that way removes its partial extraction and moves the original hot-restart data back before
+// the pod is killed, so the destination is never left half restored.
+func withSignals(ctx context.Context, log *zap.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case s := <-signals:
+			log.Warn("signal received, stopping restore", zap.String("signal", s.String()))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// ctxReader fails once the context is canceled, it stops reads of local files that do not watch the context
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
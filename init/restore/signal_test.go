@@ -0,0 +1,53 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestWithSignals(t *testing.T) {
+	ctx, stop := withSignals(context.Background(), bucketToPVCLog)
+	defer stop()
+
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by SIGTERM")
+	}
+}
+
+func TestCanceledRestoreKeepsData(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "canceled_restore")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir, err := os.MkdirTemp(tmpdir, "backupDir")
+	require.Nil(t, err)
+	require.Nil(t, fileutil.CreateFiles(backupDir, []fileutil.File{
+		{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+		{Name: "00000000-0000-0000-0000-000000000001/cluster", IsDir: true},
+		{Name: "00000000-0000-0000-0000-000000000001/cluster/members.bin"},
+	}, true))
+
+	destDir, err := os.MkdirTemp(tmpdir, "destDir")
+	require.Nil(t, err)
+	existing := []fileutil.File{{Name: "00000000-0000-0000-0000-000000000002", IsDir: true}}
+	require.Nil(t, fileutil.CreateFiles(destDir, existing, true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, copyBackupPVC(ctx, backupDir, destDir, false, nil), context.Canceled)
+
+	// the original hot-restart folder is back and no partial extraction is left
+	files, err := fileutil.DirFileList(destDir)
+	require.Nil(t, err)
+	require.ElementsMatch(t, existing, files)
+}
@@ -0,0 +1,110 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+var errInsufficientSpace = errors.New("insufficient disk space")
+
+// requiredSpace estimates the bytes the restore of the archive writes to the destination. The
+// extracted size is taken from the archive index, archives without one are at least as large
+// as their objects. Staged downloads need room for the archive itself too.
+func requiredSpace(ctx context.Context, bucket *blob.Bucket, key string, opts downloadOptions) (int64, error) {
+	// the objects of a member folder are written as they are
+	if isDirectoryKey(key) {
+		objects, err := directoryObjects(ctx, bucket, key, opts.Retry)
+		if err != nil {
+			return 0, err
+		}
+		var size int64
+		for _, o := range objects {
+			size += o.Size
+		}
+		return size, nil
+	}
+	var objects []stagedObject
+	err := opts.Retry.Do(ctx, "reading the attributes of "+key, func() error {
+		var err error
+		objects, err = archiveObjects(ctx, bucket, key, opts.Version)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var compressed int64
+	for _, o := range objects {
+		compressed += o.Size
+	}
+
+	extracted := compressed
+	// the index is read from the latest single object archive only
+	if opts.Version == "" && len(objects) == 1 {
+		if index, err := archive.ReadIndex(ctx, bucket, key); err == nil {
+			extracted = 0
+			for _, e := range index.Entries {
+				extracted += e.Size
+			}
+		} else {
+			bucketToPVCLog.Info("archive has no index, estimating the restored size from the archive size", zap.String("key", key))
+		}
+	}
+
+	if opts.Workers == 0 {
+		return extracted, nil
+	}
+	// a resumed download already allocated the parts it wrote
+	return extracted + compressed - allocated(stagingName(opts.StagingDir, key)), nil
+}
+
+// allocated returns the bytes allocated on disk for the file, 0 if it does not exist
+func allocated(name string) int64 {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return 0
+}
+
+// freeSpace returns the bytes available to unprivileged users on the file system of dir
+func freeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// checkSpace fails if the destination has not enough free space to restore the archives
+func checkSpace(ctx context.Context, bucket *blob.Bucket, keys []string, dst string, opts downloadOptions) error {
+	var required int64
+	for _, key := range keys {
+		n, err := requiredSpace(ctx, bucket, key, opts)
+		if err != nil {
+			return fmt.Errorf("estimating the size of %s: %w", key, err)
+		}
+		required += n
+	}
+	free, err := freeSpace(dst)
+	if err != nil {
+		return fmt.Errorf("reading free space of %s: %w", dst, err)
+	}
+
+	bucketToPVCLog.Info("checked free space", zap.String("destination", dst), zap.Int64("required", required), zap.Int64("free", free))
+	if required > free {
+		return fmt.Errorf("%w: restoring %s needs %d bytes, %s has %d bytes free", errInsufficientSpace, strings.Join(keys, ", "), required, dst, free)
+	}
+	return nil
+}
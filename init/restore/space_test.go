@@ -0,0 +1,58 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+func TestRequiredSpace(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "required_space")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	// well compressible content, the index holds its extracted size
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, os.MkdirAll(path.Join(archiveDir, "cluster"), 0700))
+	require.Nil(t, os.WriteFile(path.Join(archiveDir, "cluster", "members.bin"), []byte(strings.Repeat("a", 100000)), 0600))
+	var buf bytes.Buffer
+	require.Nil(t, archive.Create(&buf, archiveDir, layoutUUID))
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "indexed.tar.gz", buf.Bytes(), nil))
+	legacy := tarGz(t, []string{layoutUUID + "/", layoutUUID + "/cluster/"})
+	require.Nil(t, bucket.WriteAll(ctx, "legacy.tar.gz", legacy, nil))
+
+	compressed := int64(buf.Len())
+	tests := []struct {
+		name string
+		key  string
+		opts downloadOptions
+		want int64
+	}{
+		{"index", "indexed.tar.gz", downloadOptions{}, 100000},
+		{"staged", "indexed.tar.gz", downloadOptions{Workers: 2, StagingDir: tmpdir}, 100000 + compressed},
+		{"no index", "legacy.tar.gz", downloadOptions{}, int64(len(legacy))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requiredSpace(ctx, bucket, tt.key, tt.opts)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	require.Nil(t, checkSpace(ctx, bucket, []string{"indexed.tar.gz"}, tmpdir, downloadOptions{}))
+	require.NotNil(t, checkSpace(ctx, bucket, []string{"missing.tar.gz"}, tmpdir, downloadOptions{}))
+	require.NotNil(t, checkSpace(ctx, bucket, []string{"indexed.tar.gz"}, path.Join(tmpdir, "missing"), downloadOptions{}))
+}
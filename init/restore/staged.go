@@ -0,0 +1,344 @@
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/download"
+)
+
+const (
+	defaultPartSize = 64 << 20
+	stagingPrefix   = ".restore-staging-"
+)
+
+// downloadOptions enable the ranged download of archives into a staging file. Parts are
+// downloaded in parallel and retried on their own, the staging file is kept on failure so
+// that a restarted restore continues with the missing parts.
+type downloadOptions struct {
+	// Workers is the number of parallel ranged reads, 0 streams the archive instead
+	Workers int
+	// PartSize is the size of a ranged read
+	PartSize int64
+	// Retries is the number of extra attempts of a failed part
+	Retries int
+	// StagingDir holds the staging files, it must survive pod restarts
+	StagingDir string
+	// Version pins the object version of the archive in a versioned bucket, empty reads the latest one
+	Version string
+	// Symlinks is the policy for symlink entries of the archive, skip if empty
+	Symlinks string
+	// SkipSpaceCheck restores without comparing the archive size with the free space of the destination
+	SkipSpaceCheck bool
+	// SkipFileCheck restores without comparing the extracted files with the file manifest of the archive
+	SkipFileCheck bool
+	// Progress is updated during the restore, nil if the status is not served
+	Progress *restoreProgress
+	// MetadataMarker is the file written once the metadata of the archive is extracted, empty writes none
+	MetadataMarker string
+	// Control is applied to the metadata marker and the staging progress, nil keeps the user of the agent
+	Control *ownership
+	// Retry is the policy for transient errors of the bucket
+	Retry bkt.Retry
+	// DirtyRatio is the part of the container memory limit that data not written to disk yet may
+	// use before the extraction is paced, 0 disables pacing
+	DirtyRatio float64
+	// Expect is compared with the backup manifest of the archive, nil checks nothing
+	Expect *clusterExpectation
+	// EncryptionKey decrypts archives with the .enc extension
+	EncryptionKey []byte
+	// Throttle limits the download bandwidth of all objects and parts together, nil does not limit
+	Throttle *bkt.Throttle
+	// WriteWorkers is the number of files extracted in parallel, 0 or 1 writes one file after the other
+	WriteWorkers int
+	// Owner is applied to the restored files and folders, nil keeps the owner and the modes of the archive
+	Owner *ownership
+	// KeepExisting leaves the hot-restart folders in place until the archives are extracted and verified
+	KeepExisting bool
+	// Budget recovers failed entries from the archive and fails only if too many are lost, nil fails on the first error
+	Budget *errorBudget
+	// Migration moves the restored files to the layout of the cluster version, nil keeps the layout of the backup
+	Migration *layoutMigration
+}
+
+// stagedObject is an object of the archive, archives uploaded in parts have many
+type stagedObject struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// SHA256 is the digest of an object of an incremental archive, empty for other archives
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// stagingProgress is persisted next to the staging file
+type stagingProgress struct {
+	Objects  []stagedObject `json:"objects"`
+	PartSize int64          `json:"part_size"`
+	Done     map[int]bool   `json:"done"`
+}
+
+// part is a range of an object and its position in the staging file
+type part struct {
+	object int
+	offset int64
+	length int64
+	at     int64
+}
+
+// stagingName returns the staging file of the archive stored under key
+func stagingName(dir, key string) string {
+	return filepath.Join(dir, stagingPrefix+strings.ReplaceAll(key, "/", "_"))
+}
+
+// removeStaging removes the staging file of the archive and its progress
+func removeStaging(dir, key string) error {
+	name := stagingName(dir, key)
+	if err := os.Remove(name + ".progress"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// stageArchive downloads the archive stored under key into its staging file and returns the file name
+func stageArchive(ctx context.Context, bucket *blob.Bucket, key string, opts downloadOptions) (string, error) {
+	var objects []stagedObject
+	err := opts.Retry.Do(ctx, "reading the attributes of "+key, func() error {
+		var err error
+		objects, err = archiveObjects(ctx, bucket, key, opts.Version)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = defaultPartSize
+	}
+
+	name := stagingName(opts.StagingDir, key)
+	progressFile := name + ".progress"
+	p := readStagingProgress(progressFile)
+	if !sameObjects(p.Objects, objects) || p.PartSize != opts.PartSize {
+		// another archive or it changed since, start over
+		p = &stagingProgress{Objects: objects, PartSize: opts.PartSize, Done: make(map[int]bool)}
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var total int64
+	var parts []part
+	for i, o := range objects {
+		for off := int64(0); off < o.Size; off += opts.PartSize {
+			l := opts.PartSize
+			if off+l > o.Size {
+				l = o.Size - off
+			}
+			parts = append(parts, part{object: i, offset: off, length: l, at: total + off})
+		}
+		total += o.Size
+	}
+	if err = f.Truncate(total); err != nil {
+		return "", err
+	}
+	opts.Progress.setTotal(total)
+
+	var pending []string
+	for i, pt := range parts {
+		if !p.Done[i] {
+			pending = append(pending, strconv.Itoa(i))
+		} else {
+			opts.Progress.addDownloaded(pt.length)
+		}
+	}
+	if len(pending) < len(parts) {
+		bucketToPVCLog.Info("resuming download from staging file", zap.String("key", key),
+			zap.Int("parts", len(parts)), zap.Int("missing parts", len(pending)))
+	}
+
+	var mu sync.Mutex
+	report := download.All(ctx, pending, download.Options{Retries: opts.Retries, Backoff: time.Second, Concurrency: opts.Workers},
+		func(ctx context.Context, id string) error {
+			i, _ := strconv.Atoi(id)
+			pt := parts[i]
+			if err := downloadPart(ctx, bucket, objects[pt.object].Key, opts.Version, pt, f, opts); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			p.Done[i] = true
+			return writeStagingProgress(progressFile, p, opts.Control)
+		})
+	opts.Progress.addRetries(report.Retries())
+	if err = report.Err(); err != nil {
+		for _, r := range report.Files {
+			if !r.Success {
+				return "", fmt.Errorf("%w, part %s: %s", err, r.Name, r.Error)
+			}
+		}
+		return "", err
+	}
+	if err = verifyStagedObjects(f, objects); err != nil {
+		if rerr := removeStaging(opts.StagingDir, key); rerr != nil {
+			bucketToPVCLog.Warn("could not remove staging file: " + rerr.Error())
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// verifyStagedObjects compares the objects of an incremental archive in the staging file with their
+// digests, incremental archives have no checksum of the whole archive
+func verifyStagedObjects(f *os.File, objects []stagedObject) error {
+	var at int64
+	for _, o := range objects {
+		if o.SHA256 != "" {
+			h := sha256.New()
+			if _, err := io.Copy(h, io.NewSectionReader(f, at, o.Size)); err != nil {
+				return err
+			}
+			if got := hex.EncodeToString(h.Sum(nil)); got != o.SHA256 {
+				return fmt.Errorf("%w: object %s: expected %s, got %s", archive.ErrChecksumMismatch, o.Key, o.SHA256, got)
+			}
+		}
+		at += o.Size
+	}
+	return nil
+}
+
+// downloadPart writes the range of the object to the staging file, the data is on disk before the part is marked as done
+func downloadPart(ctx context.Context, bucket *blob.Bucket, key, version string, pt part, f *os.File, opts downloadOptions) error {
+	r, err := bucket.NewRangeReader(ctx, key, pt.offset, pt.length, bkt.VersionOptions(version))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	n, err := io.Copy(&offsetWriter{f: f, off: pt.at}, opts.Progress.reader(opts.Throttle.Reader(ctx, r)))
+	if err != nil {
+		return err
+	}
+	if n != pt.length {
+		return fmt.Errorf("short read of %s at %d: %d of %d bytes", key, pt.offset, n, pt.length)
+	}
+	return f.Sync()
+}
+
+// archiveObjects returns the objects of the archive in order, a pinned version is read from a single object
+func archiveObjects(ctx context.Context, bucket *blob.Bucket, key, version string) ([]stagedObject, error) {
+	if version != "" {
+		// the attributes are those of the latest version, read them from the pinned one
+		r, err := bucket.NewRangeReader(ctx, key, 0, 0, bkt.VersionOptions(version))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return []stagedObject{{Key: key, Size: r.Size(), ModTime: r.ModTime()}}, nil
+	}
+
+	keys := []string{key}
+	var digests []archive.ObjectRef
+	exists, err := bucket.Exists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		m, err := archive.ReadManifest(ctx, bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		keys = m.Keys(key)
+		digests = m.Objects
+	}
+
+	objects := make([]stagedObject, 0, len(keys))
+	for i, k := range keys {
+		attrs, err := bucket.Attributes(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		o := stagedObject{Key: k, Size: attrs.Size, ModTime: attrs.ModTime}
+		if digests != nil {
+			o.SHA256 = digests[i].SHA256
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+func sameObjects(a, b []stagedObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].Size != b[i].Size || !a[i].ModTime.Equal(b[i].ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// readStagingProgress returns an empty progress if there is none or it cannot be read
+func readStagingProgress(name string) *stagingProgress {
+	var p stagingProgress
+	data, err := os.ReadFile(name)
+	if err != nil || json.Unmarshal(data, &p) != nil {
+		return &stagingProgress{}
+	}
+	return &p
+}
+
+func writeStagingProgress(name string, p *stagingProgress, control *ownership) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// the progress is replaced atomically, a crash must not leave a truncated file
+	if err = os.WriteFile(name+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err = control.apply(name+".tmp", 0); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// stagingProgressFiles returns the staging progress files an earlier run left in dir
+func stagingProgressFiles(dir string) []string {
+	names, _ := filepath.Glob(filepath.Join(dir, stagingPrefix+"*.progress"))
+	return names
+}
+
+// offsetWriter writes sequentially from the offset on
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,195 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestStageArchive(t *testing.T) {
+	content := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	tests := []struct {
+		name    string
+		objects map[string][]byte
+	}{
+		{"single object", map[string][]byte{"a.tar.gz": content}},
+		{
+			"parts",
+			map[string][]byte{
+				archive.PartKey("a.tar.gz", 0):  content[:300],
+				archive.PartKey("a.tar.gz", 1):  content[300:],
+				archive.ManifestKey("a.tar.gz"): []byte(`{"parts":2}`),
+			},
+		},
+		{
+			"incremental",
+			map[string][]byte{
+				"objects/head":                  content[:300],
+				"objects/shared":                content[300:],
+				archive.ManifestKey("a.tar.gz"): incrementalManifest(content[:300], content[300:]),
+			},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "stage_archive")
+			require.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			for k, v := range tt.objects {
+				require.Nil(t, bucket.WriteAll(ctx, k, v, nil))
+			}
+
+			name, err := stageArchive(ctx, bucket, "a.tar.gz", downloadOptions{Workers: 4, PartSize: 64, StagingDir: dir})
+			require.Nil(t, err)
+			got, err := os.ReadFile(name)
+			require.Nil(t, err)
+			require.Equal(t, content, got)
+
+			require.Nil(t, removeStaging(dir, "a.tar.gz"))
+			require.NoFileExists(t, name)
+			require.NoFileExists(t, name+".progress")
+		})
+	}
+}
+
+// incrementalManifest lists the objects/head and objects/shared objects with the content
+func incrementalManifest(head, shared []byte) []byte {
+	ref := func(key string, data []byte) archive.ObjectRef {
+		sum := sha256.Sum256(data)
+		return archive.ObjectRef{Key: key, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	}
+	data, _ := json.Marshal(archive.Manifest{Parts: 2, Objects: []archive.ObjectRef{ref("objects/head", head), ref("objects/shared", shared)}})
+	return data
+}
+
+func TestStageArchiveVerifiesObjects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "objects/head", []byte("head"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, "objects/shared", []byte("changed"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, archive.ManifestKey("a.tar.gz"), incrementalManifest([]byte("head"), []byte("shared!")), nil))
+
+	_, err := stageArchive(ctx, bucket, "a.tar.gz", downloadOptions{Workers: 2, PartSize: 4, StagingDir: dir})
+	require.ErrorIs(t, err, archive.ErrChecksumMismatch)
+	require.NoFileExists(t, stagingName(dir, "a.tar.gz"))
+}
+
+func TestStageArchiveThrottle(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "stage_archive_throttle")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := make([]byte, 6000)
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "a.tar.gz", content, nil))
+
+	// the parallel parts share the bandwidth, after the initial burst the rest takes a second
+	start := time.Now()
+	opts := downloadOptions{Workers: 4, PartSize: 500, StagingDir: dir, Throttle: bkt.NewThrottle(3000)}
+	name, err := stageArchive(ctx, bucket, "a.tar.gz", opts)
+	require.Nil(t, err)
+	require.Greater(t, time.Since(start), 800*time.Millisecond)
+	got, err := os.ReadFile(name)
+	require.Nil(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestStageArchiveResume(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "stage_archive_resume")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "2022-06-13-00-00-00/a.tar.gz", content, nil))
+	objects, err := archiveObjects(ctx, bucket, "2022-06-13-00-00-00/a.tar.gz", "")
+	require.Nil(t, err)
+
+	// a restarted restore finds the first two parts in the staging file
+	name := stagingName(dir, "2022-06-13-00-00-00/a.tar.gz")
+	staged := make([]byte, len(content))
+	copy(staged, bytes.Repeat([]byte("x"), 200))
+	require.Nil(t, os.WriteFile(name, staged, 0600))
+	p := &stagingProgress{Objects: objects, PartSize: 100, Done: map[int]bool{0: true, 1: true}}
+	require.Nil(t, writeStagingProgress(name+".progress", p, nil))
+
+	got, err := stageArchive(ctx, bucket, "2022-06-13-00-00-00/a.tar.gz", downloadOptions{Workers: 2, PartSize: 100, StagingDir: dir})
+	require.Nil(t, err)
+	require.Equal(t, name, got)
+	data, err := os.ReadFile(name)
+	require.Nil(t, err)
+	// only the missing parts were downloaded
+	require.Equal(t, append(bytes.Repeat([]byte("x"), 200), content[200:]...), data)
+	require.Len(t, readStagingProgress(name+".progress").Done, 10)
+
+	// the progress of another version of the object is discarded
+	p.Objects[0].ModTime = p.Objects[0].ModTime.Add(-time.Hour)
+	p.Done = map[int]bool{0: true, 1: true}
+	require.Nil(t, writeStagingProgress(name+".progress", p, nil))
+	_, err = stageArchive(ctx, bucket, "2022-06-13-00-00-00/a.tar.gz", downloadOptions{Workers: 2, PartSize: 100, StagingDir: dir})
+	require.Nil(t, err)
+	data, err = os.ReadFile(name)
+	require.Nil(t, err)
+	require.Equal(t, content, data)
+}
+
+func TestSaveFromStagedArchive(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "save_from_staged_archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	uuid := "00000000-0000-0000-0000-000000000001"
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+	var buf bytes.Buffer
+	require.Nil(t, archive.Create(&buf, archiveDir, uuid))
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	key := uuid + ".tar.gz"
+	require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+	sum := sha256.Sum256(buf.Bytes())
+	require.Nil(t, archive.WriteChecksum(ctx, bucket, key, sum[:], nil))
+
+	staging := path.Join(tmpdir, "staging")
+	require.Nil(t, os.MkdirAll(staging, 0700))
+	dest := path.Join(tmpdir, "dest")
+	err = saveFromArchive(ctx, bucket, key, dest, downloadOptions{Workers: 3, PartSize: 128, StagingDir: staging})
+	require.Nil(t, err)
+
+	got, err := fileutil.DirFileList(path.Join(dest, uuid))
+	require.Nil(t, err)
+	require.ElementsMatch(t, exampleTarGzFiles, got)
+
+	// the staging file is removed after the restore
+	entries, err := os.ReadDir(staging)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
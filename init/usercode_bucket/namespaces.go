@@ -0,0 +1,47 @@
+package usercode_bucket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// namespace is a Hazelcast user code namespace, the files at the top level of its prefix are
+// downloaded into a folder of the destination named after the namespace, so that the classes
+// of different namespaces do not mix
+type namespace struct {
+	Name   string
+	Prefix string
+}
+
+// parseNamespaces parses a comma separated list of namespace=prefix mappings, e.g.
+// "payments=payments/v2,orders=orders", an empty prefix is the top level of the bucket
+func parseNamespaces(list string) ([]namespace, error) {
+	var namespaces []namespace
+	seen := make(map[string]bool)
+	for _, m := range strings.Split(list, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		name, prefix, ok := strings.Cut(m, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid namespace mapping %q, expected namespace=prefix", m)
+		}
+		// the name is a folder of the destination
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid namespace name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("namespace %s is mapped more than once", name)
+		}
+		seen[name] = true
+
+		prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		namespaces = append(namespaces, namespace{Name: name, Prefix: prefix})
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,35 @@
+package usercode_bucket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []namespace
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"mappings", "payments=/payments/v2/, orders=orders", []namespace{{"payments", "payments/v2/"}, {"orders", "orders/"}}, false},
+		{"bucket top level", "default=", []namespace{{"default", ""}}, false},
+		{"missing prefix", "payments", nil, true},
+		{"missing name", "=payments", nil, true},
+		{"path in name", "../payments=payments", nil, true},
+		{"duplicate", "payments=a,payments=b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNamespaces(tt.list)
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
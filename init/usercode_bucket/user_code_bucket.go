@@ -2,19 +2,25 @@ package usercode_bucket
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/subcommands"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
+	"gocloud.dev/blob"
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/download"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
 
@@ -23,9 +29,15 @@ const usercodeLock = "usercode_bucket_lock"
 var log = logger.New().Named("user_code_bucket")
 
 type Cmd struct {
-	BucketURL   string `envconfig:"UC_BUCKET_URL"`
-	Destination string `envconfig:"UC_BUCKET_DESTINATION"`
-	SecretName  string `envconfig:"UC_BUCKET_SECRET_NAME"`
+	BucketURL   string        `envconfig:"UC_BUCKET_URL"`
+	Destination string        `envconfig:"UC_BUCKET_DESTINATION"`
+	SecretName  string        `envconfig:"UC_BUCKET_SECRET_NAME"`
+	Retries     int           `envconfig:"UC_BUCKET_RETRIES"`
+	Timeout     time.Duration `envconfig:"UC_BUCKET_TIMEOUT"`
+	Report      string        `envconfig:"UC_BUCKET_REPORT"`
+	FileTypes   string        `envconfig:"UC_BUCKET_FILE_TYPES"`
+	Namespaces  string        `envconfig:"UC_BUCKET_NAMESPACES"`
+	ExtractZip  bool          `envconfig:"UC_BUCKET_EXTRACT_ZIP"`
 }
 
 func (*Cmd) Name() string     { return "user-code-bucket" }
@@ -37,17 +49,33 @@ func (r *Cmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.BucketURL, "src", "", "src bucket path")
 	f.StringVar(&r.Destination, "dst", "/opt/hazelcast/userCode/bucket", "dst filesystem path")
 	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the bucket credentials")
+	f.IntVar(&r.Retries, "retries", 2, "number of retries of a failed download")
+	f.DurationVar(&r.Timeout, "timeout", 0, "timeout of a single download attempt, 0 means no timeout")
+	f.StringVar(&r.Report, "report", "", "file the JSON download report is written to, e.g. /dev/termination-log")
+	f.StringVar(&r.FileTypes, "file-types", fileutil.DefaultUserCodeTypes, "comma separated extensions of the files allowed in the destination, empty allows every file")
+	f.StringVar(&r.Namespaces, "namespaces", "", "comma separated namespace=prefix mappings, the files under each prefix are downloaded into a folder named after the namespace")
+	f.BoolVar(&r.ExtractZip, "extract-zip", false, "extract downloaded .zip bundles into the destination instead of keeping them")
 }
 
-func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (r *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
 	log.Info("starting user code bucket agent...")
 
+	start := time.Now()
+	var report *download.Report
+	defer func() { termination.Report(r.Name(), status, start, report) }()
+
 	// overwrite config with environment variables
-	if err := envconfig.Process("uc_bucket", r); err != nil {
+	if err := config.Process("uc_bucket", r, f); err != nil {
 		log.Error("an error occurred while processing config from env: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
+	namespaces, err := parseNamespaces(r.Namespaces)
+	if err != nil {
+		log.Error("error parsing namespaces: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
 	lock := filepath.Join(r.Destination, usercodeLock)
 	if _, err := os.Stat(lock); err == nil || os.IsExist(err) {
 		// If usercodeLock lock exists exit
@@ -70,7 +98,25 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 
 	// run download process
 	log.Info("starting download", zap.String("destination", r.Destination))
-	if err = downloadClassJars(ctx, bucketURI, r.Destination, secretData); err != nil {
+	opts := download.Options{Retries: r.Retries, Timeout: r.Timeout, Backoff: time.Second}
+	rep, err := downloadClassJars(ctx, bucketURI, r.Destination, secretData, fileutil.ParseFileTypes(r.FileTypes), namespaces, r.ExtractZip, opts)
+	if err != nil {
+		log.Error("download error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	report = &rep
+	for _, res := range report.Files {
+		if !res.Success {
+			log.Error("download error: "+res.Error, zap.String("key", res.Name), zap.Int("attempts", res.Attempts))
+		}
+	}
+	log.Info("download finished", zap.Int("succeeded", report.Succeeded), zap.Int("failed", report.Failed))
+	if r.Report != "" {
+		if err = report.WriteFile(r.Report); err != nil {
+			log.Error("could not write download report: " + err.Error())
+		}
+	}
+	if err = report.Err(); err != nil {
 		log.Error("download error: " + err.Error())
 		return subcommands.ExitFailure
 	}
@@ -83,31 +129,79 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 	return subcommands.ExitSuccess
 }
 
-func downloadClassJars(ctx context.Context, src, dst string, secretData map[string][]byte) error {
+// downloadClassJars downloads the files at the top level of the bucket, or of the namespace prefixes into the
+// namespace folders, files of other types than the allowed ones fail the download. Zip bundles are extracted
+// into the folder they were downloaded to if extract is set. An error is only returned if the bucket could
+// not be listed.
+func downloadClassJars(ctx context.Context, src, dst string, secretData map[string][]byte, types fileutil.FileTypes, namespaces []namespace, extract bool, opts download.Options) (download.Report, error) {
 	b, err := bucket.OpenBucket(ctx, src, secretData)
 	if err != nil {
-		return err
+		return download.Report{}, err
 	}
 	defer b.Close()
 
-	iter := b.List(nil)
-	for {
-		obj, err := iter.Next(ctx)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		// naive validation, we only want jar files and no files under subfolders
-		if !strings.HasSuffix(obj.Key, ".jar") || path.Base(obj.Key) != obj.Key {
-			continue
+	if len(namespaces) == 0 {
+		namespaces = []namespace{{}}
+	}
+
+	start := time.Now()
+	// files are reported by their namespace folder and name, keys of the names
+	var names []string
+	keys := make(map[string]string)
+	type rejection struct {
+		name string
+		err  error
+	}
+	var rejected []rejection
+	var latency time.Duration
+	for _, ns := range namespaces {
+		if ns.Name != "" {
+			if err = os.Mkdir(filepath.Join(dst, ns.Name), 0755); err != nil && !os.IsExist(err) {
+				return download.Report{}, err
+			}
 		}
 
-		if err = bucket.SaveFileFromBucket(ctx, b, obj.Key, dst); err != nil {
-			return err
+		iter := b.List(&blob.ListOptions{Prefix: ns.Prefix})
+		for {
+			obj, err := iter.Next(ctx)
+			if latency == 0 {
+				latency = time.Since(start)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return download.Report{}, err
+			}
+			// no files under subfolders
+			rel := strings.TrimPrefix(obj.Key, ns.Prefix)
+			if obj.IsDir || rel == "" || path.Base(rel) != rel {
+				continue
+			}
+			name := path.Join(ns.Name, rel)
+			if err = types.Check(rel, ""); err != nil {
+				rejected = append(rejected, rejection{name, err})
+				continue
+			}
+			names = append(names, name)
+			keys[name] = obj.Key
 		}
 	}
 
-	return nil
+	opts.Concurrency = bucket.Concurrency(len(names), latency)
+	report := download.All(ctx, names, opts, func(ctx context.Context, name string) error {
+		target := filepath.Join(dst, name)
+		err := bucket.SaveFileAs(ctx, b, keys[name], target)
+		if err == nil && extract && fileutil.IsZip(name) {
+			err = fileutil.ExtractBundle(target, filepath.Dir(target), types, log)
+		}
+		if errors.Is(err, fileutil.ErrUnsafeZip) {
+			return download.Permanent(err)
+		}
+		return err
+	})
+	for _, r := range rejected {
+		report.Reject(r.name, r.err)
+	}
+	return report, nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 	_ "gocloud.dev/blob/fileblob"
 
+	"github.com/hazelcast/platform-operator-agent/internal/download"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 )
 
@@ -18,19 +19,23 @@ func TestDownloadClassJars(t *testing.T) {
 		dstPathExists bool
 		files         []fileutil.File
 		wantFiles     []fileutil.File
+		wantRejected  []string
 		wantErr       bool
 	}{
 		{
-			"only jar allowed",
+			"only allowed types",
 			true,
 			[]fileutil.File{
 				{Name: "file1"},
 				{Name: "test1.jar"},
 				{Name: "test2.class"},
+				{Name: "test3.sh"},
 			},
 			[]fileutil.File{
 				{Name: "test1.jar"},
+				{Name: "test2.class"},
 			},
+			[]string{"file1", "test3.sh"},
 			false,
 		},
 		{
@@ -45,6 +50,7 @@ func TestDownloadClassJars(t *testing.T) {
 				{Name: "test1.jar"},
 				{Name: "test2.jar"},
 			},
+			nil,
 			false,
 		},
 		{
@@ -56,6 +62,7 @@ func TestDownloadClassJars(t *testing.T) {
 				{Name: "jarjar"},
 			},
 			[]fileutil.File{},
+			[]string{"jarjar", "test1.jar2"},
 			false,
 		},
 		{
@@ -65,6 +72,7 @@ func TestDownloadClassJars(t *testing.T) {
 				{Name: "test1.jar"},
 			},
 			[]fileutil.File{},
+			nil,
 			true,
 		},
 	}
@@ -88,15 +96,66 @@ func TestDownloadClassJars(t *testing.T) {
 			}
 
 			// Run the tests
-			err = downloadClassJars(context.Background(), "file://"+bucketPath, dstPath, nil)
-			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
-			if err != nil {
-				require.Contains(t, err.Error(), "no such file or directory")
+			types := fileutil.ParseFileTypes(fileutil.DefaultUserCodeTypes)
+			report, err := downloadClassJars(context.Background(), "file://"+bucketPath, dstPath, nil, types, nil, false, download.Options{})
+			require.Nil(t, err)
+			if tt.wantErr {
+				require.NotNil(t, report.Err())
+				require.Contains(t, report.Files[0].Error, "no such file or directory")
 				return
 			}
+
+			// rejected files fail the download, the others are still copied
+			var rejected []string
+			for _, f := range report.Files {
+				if !f.Success {
+					require.Contains(t, f.Error, fileutil.ErrFileTypeNotAllowed.Error())
+					rejected = append(rejected, f.Name)
+				}
+			}
+			require.Equal(t, tt.wantRejected, rejected)
+			require.Equal(t, len(tt.wantRejected) > 0, report.Err() != nil)
+			require.Equal(t, len(tt.wantFiles), report.Succeeded)
 			copiedFiles, err := fileutil.DirFileList(dstPath)
 			require.Nil(t, err)
 			require.ElementsMatch(t, copiedFiles, tt.wantFiles)
 		})
 	}
 }
+
+func TestDownloadClassJarsNamespaces(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "download_class_jars_namespaces")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	bucketPath := path.Join(tmpdir, "bucket")
+	require.Nil(t, fileutil.CreateFiles(bucketPath, []fileutil.File{
+		{Name: "shared.jar"},
+		{Name: "payments/v2/app.jar"},
+		{Name: "payments/v2/old/app.jar"},
+		{Name: "payments/v2/run.sh"},
+		{Name: "orders/app.jar"},
+	}, true))
+	dstPath := path.Join(tmpdir, "dest")
+	require.Nil(t, os.Mkdir(dstPath, 0755))
+
+	namespaces := []namespace{{Name: "payments", Prefix: "payments/v2/"}, {Name: "orders", Prefix: "orders/"}}
+	types := fileutil.ParseFileTypes(fileutil.DefaultUserCodeTypes)
+	report, err := downloadClassJars(context.Background(), "file://"+bucketPath, dstPath, nil, types, namespaces, false, download.Options{})
+	require.Nil(t, err)
+
+	// the same file name of different namespaces is kept apart
+	require.Equal(t, 2, report.Succeeded)
+	require.Equal(t, 1, report.Failed)
+	for _, f := range report.Files {
+		if !f.Success {
+			require.Equal(t, "payments/run.sh", f.Name)
+		}
+	}
+	for _, name := range []string{"payments/app.jar", "orders/app.jar"} {
+		_, err = os.Stat(path.Join(dstPath, name))
+		require.Nil(t, err, name)
+	}
+	_, err = os.Stat(path.Join(dstPath, "shared.jar"))
+	require.True(t, os.IsNotExist(err))
+}
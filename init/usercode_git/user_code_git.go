@@ -0,0 +1,176 @@
+package usercode_git
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
+)
+
+const usercodeLock = "usercode_git_lock"
+
+// Secret keys
+const (
+	GitUsername   = "username"
+	GitToken      = "token"
+	GitSSHKey     = "ssh-privatekey"
+	GitKnownHosts = "known_hosts"
+)
+
+var log = logger.New().Named("user_code_git")
+
+type Cmd struct {
+	RepoURL     string `envconfig:"UC_GIT_URL"`
+	Ref         string `envconfig:"UC_GIT_REF"`
+	Destination string `envconfig:"UC_GIT_DESTINATION"`
+	SecretName  string `envconfig:"UC_GIT_SECRET_NAME"`
+}
+
+func (*Cmd) Name() string     { return "user-code-git" }
+func (*Cmd) Synopsis() string { return "Run User Code Git Agent" }
+func (*Cmd) Usage() string    { return "" }
+
+func (r *Cmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.RepoURL, "repo", "", "git repository url")
+	f.StringVar(&r.Ref, "ref", "", "branch or tag to fetch, default branch if empty")
+	f.StringVar(&r.Destination, "dst", "/opt/hazelcast/userCode/git", "dst filesystem path")
+	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the repository credentials")
+}
+
+func (r *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
+	log.Info("starting user code git agent...")
+
+	start := time.Now()
+	defer func() { termination.Report(r.Name(), status, start, nil) }()
+
+	// overwrite config with environment variables
+	if err := config.Process("uc_git", r, f); err != nil {
+		log.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	lock := filepath.Join(r.Destination, usercodeLock)
+	if _, err := os.Stat(lock); err == nil || os.IsExist(err) {
+		// If usercodeLock lock exists exit
+		log.Info("lock file exists, exiting")
+		return subcommands.ExitSuccess
+	}
+
+	var auth transport.AuthMethod
+	if r.SecretName != "" {
+		log.Info("reading secret", zap.String("secret name", r.SecretName))
+		secretData, err := bucket.SecretData(ctx, r.SecretName)
+		if err != nil {
+			log.Error("error fetching secret data: " + err.Error())
+			return subcommands.ExitFailure
+		}
+
+		auth, err = authMethod(secretData)
+		if err != nil {
+			log.Error("invalid git credentials: " + err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	log.Info("starting clone", zap.String("repository", r.RepoURL), zap.String("ref", r.Ref), zap.String("destination", r.Destination))
+	if err := cloneRepo(ctx, r.RepoURL, r.Ref, r.Destination, auth); err != nil {
+		log.Error("clone error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err := os.WriteFile(lock, []byte{}, 0600); err != nil {
+		log.Error("lock file creation error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// authMethod returns SSH auth if the secret contains a private key, token based HTTPS auth otherwise
+func authMethod(secret map[string][]byte) (transport.AuthMethod, error) {
+	if key, ok := secret[GitSSHKey]; ok {
+		knownHosts, ok := secret[GitKnownHosts]
+		if !ok {
+			return nil, fmt.Errorf("invalid secret: missing key: %v", GitKnownHosts)
+		}
+		if err := setKnownHosts(knownHosts); err != nil {
+			return nil, err
+		}
+		return ssh.NewPublicKeys("git", key, "")
+	}
+
+	token, ok := secret[GitToken]
+	if !ok {
+		return nil, fmt.Errorf("invalid secret: missing key: %v or %v", GitSSHKey, GitToken)
+	}
+
+	// most providers accept any non-empty username with a token
+	username := "git"
+	if u, ok := secret[GitUsername]; ok {
+		username = string(u)
+	}
+	return &http.BasicAuth{Username: username, Password: string(token)}, nil
+}
+
+// setKnownHosts stores the known hosts in a file and points the ssh transport to it
+func setKnownHosts(knownHosts []byte) error {
+	f, err := os.CreateTemp("", "known_hosts")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(knownHosts); err != nil {
+		return err
+	}
+	return os.Setenv("SSH_KNOWN_HOSTS", f.Name())
+}
+
+func cloneRepo(ctx context.Context, repoURL, ref, dst string, auth transport.AuthMethod) error {
+	opts := &git.CloneOptions{
+		URL:          repoURL,
+		Auth:         auth,
+		SingleBranch: true,
+		Depth:        1,
+	}
+
+	// ref could either be a branch or a tag
+	var err error
+	if ref == "" {
+		_, err = git.PlainCloneContext(ctx, dst, false, opts)
+	} else {
+		for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)} {
+			opts.ReferenceName = name
+			_, err = git.PlainCloneContext(ctx, dst, false, opts)
+			if !errors.Is(err, git.NoMatchingRefSpecError{}) {
+				break
+			}
+			// remove leftovers of the failed attempt
+			if rerr := os.RemoveAll(filepath.Join(dst, git.GitDirName)); rerr != nil {
+				return rerr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// only the working tree is needed
+	return os.RemoveAll(filepath.Join(dst, git.GitDirName))
+}
@@ -0,0 +1,112 @@
+package usercode_git
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestCloneRepo(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		wantFiles []fileutil.File
+		wantErr   bool
+	}{
+		{
+			"default branch",
+			"",
+			[]fileutil.File{{Name: "test1.jar"}, {Name: "test2.jar"}},
+			false,
+		},
+		{
+			"tag",
+			"v1",
+			[]fileutil.File{{Name: "test1.jar"}},
+			false,
+		},
+		{
+			"unknown ref",
+			"does-not-exist",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Prepare the repository and destination folder
+			tmpdir, err := os.MkdirTemp("", "clone_repo")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			repoPath := path.Join(tmpdir, "repo")
+			repo, err := git.PlainInit(repoPath, false)
+			require.Nil(t, err)
+			commitFile(t, repo, repoPath, "test1.jar")
+			head, err := repo.Head()
+			require.Nil(t, err)
+			_, err = repo.CreateTag("v1", head.Hash(), nil)
+			require.Nil(t, err)
+			commitFile(t, repo, repoPath, "test2.jar")
+
+			dstPath := path.Join(tmpdir, "dest")
+
+			// Run the tests
+			err = cloneRepo(context.Background(), "file://"+repoPath, tt.ref, dstPath, nil)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if err != nil {
+				return
+			}
+			files, err := fileutil.DirFileList(dstPath)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.wantFiles, files)
+		})
+	}
+}
+
+func TestAuthMethod(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  map[string][]byte
+		want    *http.BasicAuth
+		wantErr bool
+	}{
+		{"token", map[string][]byte{GitToken: []byte("t")}, &http.BasicAuth{Username: "git", Password: "t"}, false},
+		{"token and username", map[string][]byte{GitToken: []byte("t"), GitUsername: []byte("u")}, &http.BasicAuth{Username: "u", Password: "t"}, false},
+		{"ssh key without known hosts", map[string][]byte{GitSSHKey: []byte("key")}, nil, true},
+		{"invalid ssh key", map[string][]byte{GitSSHKey: []byte("key"), GitKnownHosts: []byte("")}, nil, true},
+		{"empty", map[string][]byte{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authMethod(tt.secret)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if err != nil {
+				return
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func commitFile(t *testing.T, repo *git.Repository, repoPath, name string) {
+	err := os.WriteFile(path.Join(repoPath, name), []byte(name), 0600)
+	require.Nil(t, err)
+	w, err := repo.Worktree()
+	require.Nil(t, err)
+	_, err = w.Add(name)
+	require.Nil(t, err)
+	_, err = w.Commit("add "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.Nil(t, err)
+}
@@ -2,18 +2,21 @@ package usercode_url
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/subcommands"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/download"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
 )
 
 const usercodeLock = "usercode_url_lock"
@@ -21,8 +24,13 @@ const usercodeLock = "usercode_url_lock"
 var log = logger.New().Named("user_code_url")
 
 type Cmd struct {
-	URLs        string `envconfig:"UC_URL_URLS"`
-	Destination string `envconfig:"UC_URL_DESTINATION"`
+	URLs        string        `envconfig:"UC_URL_URLS"`
+	Destination string        `envconfig:"UC_URL_DESTINATION"`
+	Retries     int           `envconfig:"UC_URL_RETRIES"`
+	Timeout     time.Duration `envconfig:"UC_URL_TIMEOUT"`
+	Report      string        `envconfig:"UC_URL_REPORT"`
+	FileTypes   string        `envconfig:"UC_URL_FILE_TYPES"`
+	ExtractZip  bool          `envconfig:"UC_URL_EXTRACT_ZIP"`
 }
 
 func (*Cmd) Name() string     { return "user-code-url" }
@@ -33,13 +41,22 @@ func (r *Cmd) SetFlags(f *flag.FlagSet) {
 	// We ignore error because this is just a default value
 	f.StringVar(&r.URLs, "urls", "", "comma separated urls")
 	f.StringVar(&r.Destination, "dst", "/opt/hazelcast/userCode/urls", "dst filesystem path")
+	f.IntVar(&r.Retries, "retries", 2, "number of retries of a failed download")
+	f.DurationVar(&r.Timeout, "timeout", 0, "timeout of a single download attempt, 0 means no timeout")
+	f.StringVar(&r.Report, "report", "", "file the JSON download report is written to, e.g. /dev/termination-log")
+	f.StringVar(&r.FileTypes, "file-types", fileutil.DefaultUserCodeTypes, "comma separated extensions of the files allowed in the destination, empty allows every file")
+	f.BoolVar(&r.ExtractZip, "extract-zip", false, "extract downloaded .zip bundles into the destination instead of keeping them")
 }
 
-func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (r *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
 	log.Info("starting user code url agent...")
 
+	start := time.Now()
+	var report *download.Report
+	defer func() { termination.Report(r.Name(), status, start, report) }()
+
 	// overwrite config with environment variables
-	if err := envconfig.Process("uc_url", r); err != nil {
+	if err := config.Process("uc_url", r, f); err != nil {
 		log.Error("an error occurred while processing config from env: " + err.Error())
 		return subcommands.ExitFailure
 	}
@@ -55,7 +72,21 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 
 	// run download process
 	log.Info("starting download", zap.String("destination", r.Destination))
-	if err := downloadFiles(ctx, urls, r.Destination); err != nil {
+	opts := download.Options{Retries: r.Retries, Timeout: r.Timeout, Backoff: time.Second}
+	rep := downloadFiles(ctx, urls, r.Destination, fileutil.ParseFileTypes(r.FileTypes), r.ExtractZip, opts)
+	report = &rep
+	for _, res := range report.Files {
+		if !res.Success {
+			log.Error("download error: "+res.Error, zap.String("url", res.Name), zap.Int("attempts", res.Attempts))
+		}
+	}
+	log.Info("download finished", zap.Int("succeeded", report.Succeeded), zap.Int("failed", report.Failed))
+	if r.Report != "" {
+		if err := report.WriteFile(r.Report); err != nil {
+			log.Error("could not write download report: " + err.Error())
+		}
+	}
+	if err := report.Err(); err != nil {
 		log.Error("download error: " + err.Error())
 		return subcommands.ExitFailure
 	}
@@ -68,18 +99,16 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 	return subcommands.ExitSuccess
 }
 
-func downloadFiles(ctx context.Context, srcURLs []string, dst string) error {
-	g, groupCtx := errgroup.WithContext(ctx)
-	for _, url := range srcURLs {
-		url := url
-		g.Go(func() error {
-			return fileutil.DownloadFileFromURL(groupCtx, url, dst)
-		})
-	}
-
-	if err := g.Wait(); err != nil {
+// downloadFiles downloads the files into dst, zip bundles are extracted next to them if extract is set
+func downloadFiles(ctx context.Context, srcURLs []string, dst string, types fileutil.FileTypes, extract bool, opts download.Options) download.Report {
+	return download.All(ctx, srcURLs, opts, func(ctx context.Context, url string) error {
+		name, err := fileutil.DownloadFileFromURL(ctx, url, dst, types)
+		if err == nil && extract && fileutil.IsZip(name) {
+			err = fileutil.ExtractBundle(name, dst, types, log)
+		}
+		if errors.Is(err, fileutil.ErrFileTypeNotAllowed) || errors.Is(err, fileutil.ErrUnsafeZip) {
+			return download.Permanent(err)
+		}
 		return err
-	}
-
-	return nil
+	})
 }
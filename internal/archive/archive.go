@@ -0,0 +1,371 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocloud.dev/blob"
+)
+
+// Version is the archive format version written by Create.
+//
+// A v2 archive is a regular tar.gz stream in which every tar entry is compressed
+// as its own gzip member. The tar end-of-archive marker is followed by a gzip member
+// holding a JSON Index and by a fixed size footer member pointing to the index. Legacy
+// readers still see a valid tar.gz, while Index aware readers can list the content and
+// read selected entries with ranged reads without downloading the whole object.
+// Archives compressed with zstd use a frame per member instead, uncompressed archives
+// are a plain tar stream followed by the index.
+const Version = 2
+
+var footerMagic = [8]byte{'H', 'Z', 'A', 'R', 'C', 'I', 'D', 'X'}
+
+var ErrNoIndex = errors.New("archive has no index footer")
+
+// Entry describes a single tar entry stored in its own compressed member
+type Entry struct {
+	Name   string      `json:"name"`
+	IsDir  bool        `json:"is_dir"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	Offset int64       `json:"offset"`
+	Length int64       `json:"length"`
+}
+
+// Index is the list of entries stored at the end of a v2 archive
+type Index struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Find returns the entry with the given name
+func (i *Index) Find(name string) (Entry, bool) {
+	for _, e := range i.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// MetaDir is the archive folder holding the member configuration snapshot
+const MetaDir = "meta"
+
+// BackupManifestName is the file in MetaDir that describes the cluster that took the backup
+const BackupManifestName = "manifest.json"
+
+// IsChunkFile returns true for the data files of a hot-restart store, e.g. 0000000000000001.chunk
+// or an active chunk. They hold the bulk of a backup and are stored after all other entries.
+func IsChunkFile(name string) bool {
+	return strings.Contains(filepath.Base(name), ".chunk")
+}
+
+// Create writes the content of dir to w as a gzip compressed v2 archive, file names are relative to baseDirName
+func Create(w io.Writer, dir, baseDirName string) error {
+	_, err := CreatePart(w, DefaultCodec, dir, baseDirName, nil, &Progress{}, func() bool { return false })
+	return err
+}
+
+// Progress is the state of an archive that is written in multiple parts
+type Progress struct {
+	Parts   int     `json:"parts"`
+	Offset  int64   `json:"offset"`
+	Entries []Entry `json:"entries"`
+}
+
+var errStop = errors.New("stop requested")
+
+// CreatePart writes the entries of dir that are not in p yet to w until stop returns true, at least
+// one entry is written per part. The meta files are stored under MetaDir before the content of dir.
+// It returns true if the archive is complete and w holds its last part.
+// On success p is updated, the concatenation of all parts is a regular v2 archive.
+// All parts of an archive must be written with the same codec.
+func CreatePart(w io.Writer, c Codec, dir, baseDirName string, meta []string, p *Progress, stop func() bool) (bool, error) {
+	m, err := c.newMemberWriter()
+	if err != nil {
+		return false, err
+	}
+
+	cw := &countingWriter{w: w, n: p.Offset}
+	written := make(map[string]bool, len(p.Entries))
+	for _, e := range p.Entries {
+		written[e.Name] = true
+	}
+	entries := append([]Entry{}, p.Entries...)
+
+	var count int
+	add := func(path, name string, info os.FileInfo) error {
+		if written[name] {
+			return nil
+		}
+		if count > 0 && stop() {
+			return errStop
+		}
+
+		header, err := tar.FileInfoHeader(info, info.Name())
+		if err != nil {
+			return err
+		}
+		header.Name = name
+
+		offset := cw.n
+		if err = writeEntry(m, cw, header, path); err != nil {
+			return err
+		}
+		count++
+
+		entries = append(entries, Entry{
+			Name:   header.Name,
+			IsDir:  info.IsDir(),
+			Mode:   info.Mode(),
+			Size:   header.Size,
+			Offset: offset,
+			Length: cw.n - offset,
+		})
+		return nil
+	}
+
+	err = addMeta(meta, add)
+	// folders and metadata go first, the chunk files last, so that a restore can start validating early
+	for _, chunks := range []bool{false, true} {
+		if err != nil {
+			break
+		}
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if IsChunkFile(info.Name()) != chunks {
+				return nil
+			}
+			// make sure files are relative to baseDirName
+			return add(path, filepath.Join(baseDirName, strings.TrimPrefix(path, dir)), info)
+		})
+	}
+
+	done := err == nil
+	if err != nil && err != errStop {
+		return false, err
+	}
+
+	if done {
+		if err = writeTrailer(m, cw, c.Compression, entries); err != nil {
+			return false, err
+		}
+	}
+
+	p.Parts++
+	p.Offset = cw.n
+	p.Entries = entries
+	return done, nil
+}
+
+// addMeta adds the MetaDir folder and the meta files in it
+func addMeta(meta []string, add func(path, name string, info os.FileInfo) error) error {
+	if len(meta) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(filepath.Dir(meta[0]))
+	if err != nil {
+		return err
+	}
+	if err = add("", MetaDir, info); err != nil {
+		return err
+	}
+
+	for _, path := range meta {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err = add(path, filepath.Join(MetaDir, filepath.Base(path)), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTrailer(m memberWriter, cw *countingWriter, c Compression, entries []Entry) error {
+	// tar end-of-archive marker
+	if err := writeMember(m, cw, func(g io.Writer) error {
+		return tar.NewWriter(g).Close()
+	}); err != nil {
+		return err
+	}
+
+	indexOffset := cw.n
+	if err := writeMember(m, cw, func(g io.Writer) error {
+		return json.NewEncoder(g).Encode(Index{Version: Version, Entries: entries})
+	}); err != nil {
+		return err
+	}
+
+	_, err := cw.Write(footer(c, indexOffset))
+	return err
+}
+
+func writeEntry(m memberWriter, w io.Writer, header *tar.Header, path string) error {
+	return writeMember(m, w, func(g io.Writer) error {
+		t := tar.NewWriter(g)
+		if err := t.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if _, err = io.Copy(t, f); err != nil {
+				return err
+			}
+		}
+
+		// pad the entry without writing the end-of-archive marker
+		return t.Flush()
+	})
+}
+
+// writeMember writes the output of fn as a single member, m is reset to w first
+func writeMember(m memberWriter, w io.Writer, fn func(g io.Writer) error) error {
+	m.Reset(w)
+	if err := fn(m); err != nil {
+		m.Close()
+		return err
+	}
+	return m.Close()
+}
+
+// ReadIndex reads the index of a v2 archive stored under key using ranged reads only
+func ReadIndex(ctx context.Context, bucket *blob.Bucket, key string) (*Index, error) {
+	if Encrypted(key) {
+		// the footer and the index are encrypted as well
+		return nil, ErrNoIndex
+	}
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := CompressionOf(key)
+	footerSize := footerSize(c)
+	if attrs.Size < footerSize {
+		return nil, ErrNoIndex
+	}
+
+	f, err := readRange(ctx, bucket, key, attrs.Size-footerSize, footerSize)
+	if err != nil {
+		return nil, ErrNoIndex
+	}
+	if f, err = readFooter(c, f); err != nil {
+		return nil, err
+	}
+	if len(f) != len(footerMagic)+8 || !bytes.Equal(f[:len(footerMagic)], footerMagic[:]) {
+		return nil, ErrNoIndex
+	}
+
+	indexOffset := int64(binary.BigEndian.Uint64(f[len(footerMagic):]))
+	if indexOffset < 0 || indexOffset >= attrs.Size-footerSize {
+		return nil, fmt.Errorf("invalid archive index offset %d", indexOffset)
+	}
+
+	data, err := readMember(ctx, bucket, key, c, indexOffset, attrs.Size-footerSize-indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	if index.Version != Version {
+		return nil, fmt.Errorf("unsupported archive version %d", index.Version)
+	}
+	return &index, nil
+}
+
+func readRange(ctx context.Context, bucket *blob.Bucket, key string, offset, length int64) ([]byte, error) {
+	r, err := bucket.NewRangeReader(ctx, key, offset, length, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func readMember(ctx context.Context, bucket *blob.Bucket, key string, c Compression, offset, length int64) ([]byte, error) {
+	r, err := bucket.NewRangeReader(ctx, key, offset, length, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	g, err := c.decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+
+	return io.ReadAll(g)
+}
+
+// OpenEntry returns a reader for the content of a single archive entry, the caller must close it
+func OpenEntry(ctx context.Context, bucket *blob.Bucket, key string, e Entry) (*tar.Header, io.ReadCloser, error) {
+	r, err := bucket.NewRangeReader(ctx, key, e.Offset, e.Length, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g, err := Decompress(r, key)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+
+	t := tar.NewReader(g)
+	header, err := t.Next()
+	if err != nil {
+		g.Close()
+		r.Close()
+		return nil, nil, err
+	}
+
+	return header, &entryReader{Reader: t, closers: []io.Closer{g, r}}, nil
+}
+
+type entryReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (e *entryReader) Close() error {
+	var err error
+	for _, c := range e.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
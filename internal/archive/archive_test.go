@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+var exampleFiles = []fileutil.File{
+	{Name: "cluster", IsDir: true},
+	{Name: "cluster/cluster-state.txt"},
+	{Name: "cluster/members.bin"},
+	{Name: "s00/value/01", IsDir: true},
+	{Name: "s00/value/01/0000000000000001.chunk"},
+}
+
+func TestCreateIsLegacyTarGz(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "archive_legacy")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	require.Nil(t, fileutil.CreateFiles(tmpdir, exampleFiles, true))
+
+	var b bytes.Buffer
+	require.Nil(t, Create(&b, tmpdir, "uuid"))
+
+	g, err := gzip.NewReader(&b)
+	require.Nil(t, err)
+	tr := tar.NewReader(g)
+
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, h.Name)
+	}
+	require.Contains(t, names, "uuid")
+	require.Contains(t, names, "uuid/cluster/members.bin")
+	require.Contains(t, names, "uuid/s00/value/01/0000000000000001.chunk")
+}
+
+func TestCreateChunkFilesLast(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "archive_order")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	require.Nil(t, fileutil.CreateFiles(tmpdir, []fileutil.File{
+		{Name: "s00/value/01", IsDir: true},
+		{Name: "s00/value/01/0000000000000001.chunk"},
+		{Name: "s00/value/01/0000000000000002.chunk.active"},
+		{Name: "z-cluster", IsDir: true},
+		{Name: "z-cluster/members.bin"},
+	}, true))
+
+	var b bytes.Buffer
+	require.Nil(t, Create(&b, tmpdir, "uuid"))
+	g, err := gzip.NewReader(&b)
+	require.Nil(t, err)
+	tr := tar.NewReader(g)
+
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, h.Name)
+	}
+	require.Equal(t, []string{
+		"uuid", "uuid/s00", "uuid/s00/value", "uuid/s00/value/01", "uuid/z-cluster", "uuid/z-cluster/members.bin",
+		"uuid/s00/value/01/0000000000000001.chunk", "uuid/s00/value/01/0000000000000002.chunk.active",
+	}, names)
+}
+
+func TestReadIndexAndOpenEntry(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "archive_index")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	require.Nil(t, fileutil.CreateFiles(tmpdir, exampleFiles, true))
+	err = os.WriteFile(path.Join(tmpdir, "cluster/cluster-state.txt"), []byte("ACTIVE"), 0600)
+	require.Nil(t, err)
+
+	var b bytes.Buffer
+	require.Nil(t, Create(&b, tmpdir, "uuid"))
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "backup.tar.gz", b.Bytes(), nil))
+
+	index, err := ReadIndex(ctx, bucket, "backup.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, Version, index.Version)
+
+	e, ok := index.Find("uuid/cluster/cluster-state.txt")
+	require.True(t, ok)
+	require.False(t, e.IsDir)
+	require.Equal(t, int64(6), e.Size)
+
+	h, r, err := OpenEntry(ctx, bucket, "backup.tar.gz", e)
+	require.Nil(t, err)
+	defer r.Close()
+	require.Equal(t, e.Name, h.Name)
+	content, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "ACTIVE", string(content))
+
+	_, ok = index.Find("uuid/does-not-exist")
+	require.False(t, ok)
+}
+
+func TestReadIndexNoFooter(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	var b bytes.Buffer
+	g := gzip.NewWriter(&b)
+	require.Nil(t, tar.NewWriter(g).Close())
+	require.Nil(t, g.Close())
+	require.Nil(t, bucket.WriteAll(ctx, "legacy.tar.gz", b.Bytes(), nil))
+
+	_, err := ReadIndex(ctx, bucket, "legacy.tar.gz")
+	require.ErrorIs(t, err, ErrNoIndex)
+}
+
+func TestCreatePartWithMeta(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "archive_meta")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backup")
+	require.Nil(t, fileutil.CreateFiles(backupDir, exampleFiles, true))
+	config := path.Join(tmpdir, "hazelcast.yaml")
+	require.Nil(t, os.WriteFile(config, []byte("hazelcast: {}"), 0600))
+
+	var b bytes.Buffer
+	done, err := CreatePart(&b, DefaultCodec, backupDir, "uuid", []string{config}, &Progress{}, func() bool { return false })
+	require.Nil(t, err)
+	require.True(t, done)
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "backup.tar.gz", b.Bytes(), nil))
+
+	index, err := ReadIndex(ctx, bucket, "backup.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, MetaDir, index.Entries[0].Name)
+	require.True(t, index.Entries[0].IsDir)
+
+	e, ok := index.Find("meta/hazelcast.yaml")
+	require.True(t, ok)
+	_, r, err := OpenEntry(ctx, bucket, "backup.tar.gz", e)
+	require.Nil(t, err)
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "hazelcast: {}", string(content))
+
+	_, ok = index.Find("uuid/cluster/members.bin")
+	require.True(t, ok)
+}
+
+func TestNewOffsetReader(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	content := []byte("0123456789abcdefghij")
+	require.Nil(t, bucket.WriteAll(ctx, "single.tar.gz", content, nil))
+	for i, part := range [][]byte{content[:7], content[7:14], content[14:]} {
+		require.Nil(t, bucket.WriteAll(ctx, PartKey("parts.tar.gz", i), part, nil))
+	}
+	require.Nil(t, WriteManifest(ctx, bucket, "parts.tar.gz", 3, nil))
+
+	for _, key := range []string{"single.tar.gz", "parts.tar.gz"} {
+		for _, offset := range []int64{0, 3, 7, 13, 14, 19, 20} {
+			r, err := NewOffsetReader(ctx, bucket, key, offset)
+			require.Nil(t, err)
+			got, err := io.ReadAll(r)
+			require.Nil(t, err)
+			require.Nil(t, r.Close())
+			require.Equal(t, string(content[offset:]), string(got), "%s at %d", key, offset)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// ChecksumSuffix is appended to the archive key for the SHA-256 digest of the archive,
+// the object has the format of sha256sum
+const ChecksumSuffix = ".sha256"
+
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+// ChecksumKey returns the key of the checksum of the archive stored under key
+func ChecksumKey(key string) string {
+	return key + ChecksumSuffix
+}
+
+// WriteChecksum stores the SHA-256 digest of the archive stored under key, for archives
+// stored in parts it is the digest of all parts
+func WriteChecksum(ctx context.Context, bucket *blob.Bucket, key string, sum []byte, opts *blob.WriterOptions) error {
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum), path.Base(key))
+	return bucket.WriteAll(ctx, ChecksumKey(key), []byte(line), opts)
+}
+
+// ReadChecksum returns the SHA-256 digest of the archive stored under key,
+// archives of older agents have no checksum and nil is returned
+func ReadChecksum(ctx context.Context, bucket *blob.Bucket, key string) ([]byte, error) {
+	data, err := bucket.ReadAll(ctx, ChecksumKey(key))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty checksum of %s", key)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != 32 {
+		return nil, fmt.Errorf("invalid checksum of %s", key)
+	}
+	return sum, nil
+}
+
+// VerifyChecksum compares the digest of the archive stored under key with the expected one
+func VerifyChecksum(key string, want, got []byte) error {
+	if !bytes.Equal(want, got) {
+		return fmt.Errorf("%w: %s: expected %x, got %x", ErrChecksumMismatch, key, want, got)
+	}
+	return nil
+}
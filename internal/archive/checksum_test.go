@@ -0,0 +1,38 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	sum := sha256.Sum256([]byte("archive"))
+	require.Nil(t, WriteChecksum(ctx, bucket, "2022-06-13-00-00-00/a.tar.gz", sum[:], nil))
+
+	// the object can be checked with sha256sum -c
+	data, err := bucket.ReadAll(ctx, "2022-06-13-00-00-00/a.tar.gz.sha256")
+	require.Nil(t, err)
+	require.Regexp(t, `^[0-9a-f]{64}  a\.tar\.gz\n$`, string(data))
+
+	got, err := ReadChecksum(ctx, bucket, "2022-06-13-00-00-00/a.tar.gz")
+	require.Nil(t, err)
+	require.Nil(t, VerifyChecksum("a.tar.gz", sum[:], got))
+	require.ErrorIs(t, VerifyChecksum("a.tar.gz", sum[:], make([]byte, sha256.Size)), ErrChecksumMismatch)
+
+	// archives of older agents have no checksum
+	got, err = ReadChecksum(ctx, bucket, "b.tar.gz")
+	require.Nil(t, err)
+	require.Nil(t, got)
+
+	require.Nil(t, bucket.WriteAll(ctx, "c.tar.gz.sha256", []byte("not-hex  c.tar.gz\n"), nil))
+	_, err = ReadChecksum(ctx, bucket, "c.tar.gz")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,201 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the codec of the archive members
+type Compression string
+
+const (
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+	None Compression = "none"
+)
+
+// compressions supported by the archives
+var compressions = []Compression{Gzip, Zstd, None}
+
+// Extension returns the suffix of the archive keys written with the compression
+func (c Compression) Extension() string {
+	switch c {
+	case Zstd:
+		return ".tar.zst"
+	case None:
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// CompressionOf returns the compression of an archive by the extension of its key, encrypted
+// archives keep the extension of their compression before the encryption one
+func CompressionOf(key string) (Compression, bool) {
+	key = strings.TrimSuffix(key, EncryptedExtension)
+	for _, c := range compressions {
+		if strings.HasSuffix(key, c.Extension()) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// TrimExtension returns the base name of the archive key without its extension
+func TrimExtension(key string) string {
+	base := strings.TrimSuffix(path.Base(key), EncryptedExtension)
+	if c, ok := CompressionOf(base); ok {
+		return strings.TrimSuffix(base, c.Extension())
+	}
+	return base
+}
+
+// Codec is the compression and level used to write an archive
+type Codec struct {
+	Compression Compression
+	// Level is the compression level, zero uses the default of the compression
+	Level int
+}
+
+// DefaultCodec is the codec of archives written without explicit settings
+var DefaultCodec = Codec{Compression: Gzip}
+
+// Validate checks that the compression is known and the level is in its range
+func (c Codec) Validate() error {
+	switch c.Compression {
+	case Gzip:
+		if c.Level != 0 && (c.Level < gzip.HuffmanOnly || c.Level > gzip.BestCompression) {
+			return fmt.Errorf("gzip level %d out of range [%d, %d]", c.Level, gzip.HuffmanOnly, gzip.BestCompression)
+		}
+	case Zstd:
+		if c.Level < 0 || c.Level > 22 {
+			return fmt.Errorf("zstd level %d out of range [1, 22]", c.Level)
+		}
+	case None:
+	default:
+		return fmt.Errorf("unknown compression %q, supported are gzip, zstd and none", c.Compression)
+	}
+	return nil
+}
+
+// memberWriter compresses a single member, it can be reset to write the next one
+type memberWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (c Codec) newMemberWriter() (memberWriter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Compression {
+	case Zstd:
+		level := zstd.SpeedDefault
+		if c.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		return zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	case None:
+		return &plainWriter{}, nil
+	default:
+		level := gzip.DefaultCompression
+		if c.Level != 0 {
+			level = c.Level
+		}
+		return gzip.NewWriterLevel(nil, level)
+	}
+}
+
+// plainWriter writes members without compression
+type plainWriter struct {
+	io.Writer
+}
+
+func (p *plainWriter) Reset(w io.Writer) { p.Writer = w }
+func (p *plainWriter) Close() error      { return nil }
+
+// Decompress returns a reader for the tar stream of an archive with the given key, the caller must close it
+func Decompress(r io.Reader, key string) (io.ReadCloser, error) {
+	c, _ := CompressionOf(key)
+	return c.decompress(r)
+}
+
+func (c Compression) decompress(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case None:
+		return io.NopCloser(r), nil
+	default:
+		return gzip.NewReader(r)
+	}
+}
+
+// zstd skippable frames are ignored by decoders, the footer is stored in one
+const zstdSkippableMagic = 0x184D2A50
+
+// footer holds the offset of the index in a member of a fixed size. Gzip archives get a stored
+// (uncompressed) gzip member, zstd archives a skippable frame and plain archives the raw bytes,
+// which tar readers ignore after the end-of-archive marker.
+func footer(c Compression, indexOffset int64) []byte {
+	payload := make([]byte, len(footerMagic)+8)
+	copy(payload, footerMagic[:])
+	binary.BigEndian.PutUint64(payload[len(footerMagic):], uint64(indexOffset))
+
+	var b bytes.Buffer
+	switch c {
+	case Zstd:
+		var header [8]byte
+		binary.LittleEndian.PutUint32(header[:4], zstdSkippableMagic)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+		b.Write(header[:])
+		b.Write(payload)
+	case None:
+		b.Write(payload)
+	default:
+		g, _ := gzip.NewWriterLevel(&b, gzip.NoCompression)
+		// writing into a buffer can not fail
+		_, _ = g.Write(payload)
+		_ = g.Close()
+	}
+	return b.Bytes()
+}
+
+// readFooter returns the payload of a footer written by footer
+func readFooter(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case Zstd:
+		if len(data) < 8 || binary.LittleEndian.Uint32(data) != zstdSkippableMagic {
+			return nil, ErrNoIndex
+		}
+		return data[8:], nil
+	case None:
+		return data, nil
+	default:
+		g, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrNoIndex
+		}
+		defer g.Close()
+		payload, err := io.ReadAll(g)
+		if err != nil {
+			return nil, ErrNoIndex
+		}
+		return payload, nil
+	}
+}
+
+func footerSize(c Compression) int64 {
+	return int64(len(footer(c, 0)))
+}
@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func TestCompressions(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "archive_compression")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	require.Nil(t, fileutil.CreateFiles(tmpdir, exampleFiles, true))
+	err = os.WriteFile(path.Join(tmpdir, "cluster/cluster-state.txt"), []byte("ACTIVE"), 0600)
+	require.Nil(t, err)
+
+	tests := []struct {
+		name  string
+		codec Codec
+		key   string
+	}{
+		{"gzip", Codec{Compression: Gzip, Level: 1}, "backup.tar.gz"},
+		{"zstd", Codec{Compression: Zstd}, "backup.tar.zst"},
+		{"zstd level", Codec{Compression: Zstd, Level: 19}, "backup.tar.zst"},
+		{"none", Codec{Compression: None}, "backup.tar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.key, "backup"+tt.codec.Compression.Extension())
+
+			// the archive is written in two parts to cover the reuse of the member writer
+			var b bytes.Buffer
+			p := &Progress{}
+			done, err := CreatePart(&b, tt.codec, tmpdir, "uuid", nil, p, func() bool { return true })
+			require.Nil(t, err)
+			require.False(t, done)
+			done, err = CreatePart(&b, tt.codec, tmpdir, "uuid", nil, p, func() bool { return false })
+			require.Nil(t, err)
+			require.True(t, done)
+
+			ctx := context.Background()
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			require.Nil(t, bucket.WriteAll(ctx, tt.key, b.Bytes(), nil))
+
+			index, err := ReadIndex(ctx, bucket, tt.key)
+			require.Nil(t, err)
+			e, ok := index.Find("uuid/cluster/cluster-state.txt")
+			require.True(t, ok)
+			_, r, err := OpenEntry(ctx, bucket, tt.key, e)
+			require.Nil(t, err)
+			content, err := io.ReadAll(r)
+			require.Nil(t, err)
+			require.Nil(t, r.Close())
+			require.Equal(t, "ACTIVE", string(content))
+
+			d, err := Decompress(bytes.NewReader(b.Bytes()), tt.key)
+			require.Nil(t, err)
+			defer d.Close()
+			tr := tar.NewReader(d)
+			var names []string
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				require.Nil(t, err)
+				names = append(names, h.Name)
+			}
+			require.Len(t, names, len(index.Entries))
+			require.Contains(t, names, "uuid/s00/value/01/0000000000000001.chunk")
+		})
+	}
+}
+
+func TestCodecValidate(t *testing.T) {
+	require.Nil(t, Codec{Compression: Gzip}.Validate())
+	require.Nil(t, Codec{Compression: Gzip, Level: 9}.Validate())
+	require.Nil(t, Codec{Compression: Zstd, Level: 22}.Validate())
+	require.Nil(t, Codec{Compression: None}.Validate())
+	require.NotNil(t, Codec{Compression: Gzip, Level: 10}.Validate())
+	require.NotNil(t, Codec{Compression: Zstd, Level: 23}.Validate())
+	require.NotNil(t, Codec{Compression: "lz4"}.Validate())
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		objKey string
+		want   string
+		ok     bool
+	}{
+		{"a.tar.gz", "a.tar.gz", true},
+		{"a.tar.zst", "a.tar.zst", true},
+		{"a.tar", "a.tar", true},
+		{"a.tar.zst.parts", "a.tar.zst", true},
+		{"a.tar.zst.part-0000", "", false},
+		{"a.tar.gz.enc", "a.tar.gz.enc", true},
+		{"a.tar.gz.enc.parts", "a.tar.gz.enc", true},
+		{"a.tar.gz.enc.sha256", "", false},
+		{"a.tar.gz.sha256", "", false},
+		{"a.zip", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Key(tt.objKey)
+		require.Equal(t, tt.ok, ok, tt.objKey)
+		require.Equal(t, tt.want, got, tt.objKey)
+	}
+	require.Equal(t, "uuid", TrimExtension("2022-06-13-00-00-00/uuid.tar.zst"))
+	require.Equal(t, "uuid", TrimExtension("2022-06-13-00-00-00/uuid.tar.zst.enc"))
+}
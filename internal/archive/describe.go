@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// ArchiveManifestSuffix is appended to the archive key for the manifest describing the archive
+const ArchiveManifestSuffix = ".manifest.json"
+
+// ArchiveManifest describes an uploaded archive for restores and external tools. It is written next
+// to the archive once the archive is complete, empty fields are not known.
+type ArchiveManifest struct {
+	ClusterName      string `json:"cluster_name,omitempty"`
+	MemberID         int    `json:"member_id"`
+	HazelcastVersion string `json:"hazelcast_version,omitempty"`
+	// Sequence is the backup sequence folder the archive was created from, e.g. backup-1659034855438
+	Sequence string `json:"sequence"`
+	// Archive is the key of the archive
+	Archive     string      `json:"archive"`
+	Compression Compression `json:"compression"`
+	Encrypted   bool        `json:"encrypted,omitempty"`
+	// SHA256 is the digest of the stored archive, as in its checksum object. Incremental archives
+	// have none, the digests of their objects are in the manifest of their parts.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+	// Files are the files of the backup, named like the entries of the archive
+	Files        []FileEntry `json:"files"`
+	AgentVersion string      `json:"agent_version"`
+	Created      time.Time   `json:"created"`
+}
+
+// ArchiveManifestKey returns the key of the manifest describing the archive stored under key
+func ArchiveManifestKey(key string) string {
+	return key + ArchiveManifestSuffix
+}
+
+// WriteArchiveManifest stores the manifest describing the archive stored under key
+func WriteArchiveManifest(ctx context.Context, bucket *blob.Bucket, key string, m *ArchiveManifest, opts *blob.WriterOptions) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	o := blob.WriterOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.ContentType = "application/json"
+	return bucket.WriteAll(ctx, ArchiveManifestKey(key), data, &o)
+}
+
+// ReadArchiveManifest returns the manifest describing the archive stored under key, archives of
+// older agents have none and nil is returned
+func ReadArchiveManifest(ctx context.Context, bucket *blob.Bucket, key string) (*ArchiveManifest, error) {
+	data, err := bucket.ReadAll(ctx, ArchiveManifestKey(key))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m ArchiveManifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest of %s: %w", key, err)
+	}
+	return &m, nil
+}
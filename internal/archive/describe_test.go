@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestArchiveManifest(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	m, err := ReadArchiveManifest(ctx, bucket, "backup.tar.gz")
+	require.Nil(t, err)
+	require.Nil(t, m, "archives of older agents have no manifest")
+
+	want := &ArchiveManifest{
+		ClusterName:  "hz",
+		MemberID:     1,
+		Sequence:     "backup-1659034855438",
+		Archive:      "backup.tar.gz",
+		Compression:  DefaultCodec.Compression,
+		SHA256:       "abc",
+		Size:         42,
+		Files:        []FileEntry{{Path: "uuid/cluster/members.bin", Size: 4, SHA256: "def"}},
+		AgentVersion: "5.6",
+		Created:      time.Date(2022, 7, 28, 18, 0, 0, 0, time.UTC),
+	}
+	require.Nil(t, WriteArchiveManifest(ctx, bucket, "backup.tar.gz", want, nil))
+	attrs, err := bucket.Attributes(ctx, "backup.tar.gz"+ArchiveManifestSuffix)
+	require.Nil(t, err)
+	require.Equal(t, "application/json", attrs.ContentType)
+
+	got, err := ReadArchiveManifest(ctx, bucket, "backup.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, want, got)
+
+	require.Nil(t, bucket.WriteAll(ctx, ArchiveManifestKey("broken.tar.gz"), []byte("{"), nil))
+	_, err = ReadArchiveManifest(ctx, bucket, "broken.tar.gz")
+	require.NotNil(t, err)
+}
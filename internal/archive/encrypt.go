@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EncryptedExtension is appended to the keys of encrypted archives
+const EncryptedExtension = ".enc"
+
+// EncryptionKeyName is the entry of the Kubernetes secret holding the encryption key
+const EncryptionKeyName = "encryption-key"
+
+// ErrDecrypt is returned if an encrypted archive was written with another key or was modified
+var ErrDecrypt = errors.New("archive could not be decrypted, the encryption key is wrong or the archive is corrupted")
+
+var errWriterClosed = errors.New("encrypt writer is closed")
+
+// Encrypted reports whether the archive key belongs to an encrypted archive
+func Encrypted(key string) bool {
+	return strings.HasSuffix(key, EncryptedExtension)
+}
+
+// ParseEncryptionKey returns the AES-256 key of a secret entry, either 32 raw bytes or their base64 encoding
+func ParseEncryptionKey(data []byte) ([]byte, error) {
+	if len(data) == 32 {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes or their base64 encoding")
+	}
+	return key, nil
+}
+
+// An encrypted stream starts with a header holding a random data key sealed with the encryption key.
+// The data follows in frames of at most frameSize bytes, each sealed with the data key and a nonce
+// counting the frames. The last frame is flagged so a truncated stream is detected. Parts of an
+// archive are encrypted separately, so a stream may be followed by another one.
+var encryptMagic = [6]byte{'H', 'Z', 'E', 'N', 'C', 1}
+
+const (
+	frameSize = 64 << 10
+	lastFrame = 1 << 31
+	// headerSize is the magic, the nonce of the sealed data key and the sealed data key
+	headerSize = len(encryptMagic) + 12 + 32 + 16
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func frameNonce(n uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+// frameData binds a frame to its stream and marks the last one
+func frameData(header []byte, last bool) []byte {
+	ad := append([]byte{}, header...)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	frames uint64
+	err    error
+}
+
+// NewEncryptWriter returns a writer encrypting to w with a new data key sealed by key, the caller must
+// close it to write the last frame
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	nonce := make([]byte, kek.NonceSize())
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte{}, encryptMagic[:]...), nonce...)
+	header = kek.Seal(header, nonce, dataKey, encryptMagic[:])
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header, buf: make([]byte, 0, frameSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	var n int
+	for len(p) > 0 {
+		// a full frame is written once more data follows, the last one is written on close
+		if len(e.buf) == frameSize {
+			if e.err = e.writeFrame(false); e.err != nil {
+				return n, e.err
+			}
+		}
+		c := copy(e.buf[len(e.buf):frameSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) writeFrame(last bool) error {
+	sealed := e.aead.Seal(nil, frameNonce(e.frames), e.buf, frameData(e.header, last))
+	length := uint32(len(sealed))
+	if last {
+		length |= lastFrame
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if _, err := e.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.frames++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.err = e.writeFrame(true); e.err != nil {
+		return e.err
+	}
+	e.err = errWriterClosed
+	return nil
+}
+
+type decryptReader struct {
+	r      io.Reader
+	key    []byte
+	aead   cipher.AEAD
+	header []byte
+	frames uint64
+	// last is set once the last frame of the current stream was read
+	last bool
+	buf  []byte
+	err  error
+}
+
+// NewDecryptReader returns a reader for the data of the encrypted streams read from r
+func NewDecryptReader(r io.Reader, key []byte) io.Reader {
+	return &decryptReader{r: r, key: key, last: true}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next reads the following frame, or the header of the following stream
+func (d *decryptReader) next() error {
+	if d.last {
+		return d.readHeader()
+	}
+
+	var prefix [4]byte
+	if _, err := io.ReadFull(d.r, prefix[:]); err != nil {
+		return truncated(err)
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	last := length&lastFrame != 0
+	length &^= lastFrame
+	if length > frameSize+uint32(d.aead.Overhead()) {
+		return ErrDecrypt
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return truncated(err)
+	}
+	buf, err := d.aead.Open(sealed[:0], frameNonce(d.frames), sealed, frameData(d.header, last))
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.buf, d.last = buf, last
+	d.frames++
+	return nil
+}
+
+func (d *decryptReader) readHeader() error {
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(d.r, header)
+	if n == 0 && err == io.EOF {
+		// the previous stream was the last one
+		return io.EOF
+	}
+	if err != nil {
+		return truncated(err)
+	}
+	if !bytes.Equal(header[:len(encryptMagic)], encryptMagic[:]) {
+		return fmt.Errorf("%w: not an encrypted archive", ErrDecrypt)
+	}
+
+	kek, err := newGCM(d.key)
+	if err != nil {
+		return err
+	}
+	nonce := header[len(encryptMagic) : len(encryptMagic)+kek.NonceSize()]
+	dataKey, err := kek.Open(nil, nonce, header[len(encryptMagic)+kek.NonceSize():], encryptMagic[:])
+	if err != nil {
+		return ErrDecrypt
+	}
+	if d.aead, err = newGCM(dataKey); err != nil {
+		return err
+	}
+	d.header, d.frames, d.last = header, 0, false
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("encrypted archive is truncated: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encrypt(t *testing.T, key, data []byte) []byte {
+	var b bytes.Buffer
+	w, err := NewEncryptWriter(&b, key)
+	require.Nil(t, err)
+	_, err = w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	return b.Bytes()
+}
+
+func TestEncrypt(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.Nil(t, err)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 10},
+		{"one frame", frameSize},
+		{"frame boundary", frameSize + 1},
+		{"many frames", 3*frameSize + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			_, err := rand.Read(data)
+			require.Nil(t, err)
+
+			enc := encrypt(t, key, data)
+			require.False(t, len(data) > 16 && bytes.Contains(enc, data[:16]))
+			got, err := io.ReadAll(NewDecryptReader(bytes.NewReader(enc), key))
+			require.Nil(t, err)
+			require.Equal(t, len(data), len(got))
+			require.True(t, bytes.Equal(data, got))
+		})
+	}
+}
+
+func TestDecryptParts(t *testing.T) {
+	key := make([]byte, 32)
+	enc := append(encrypt(t, key, []byte("first part ")), encrypt(t, key, []byte("second part"))...)
+
+	got, err := io.ReadAll(NewDecryptReader(bytes.NewReader(enc), key))
+	require.Nil(t, err)
+	require.Equal(t, "first part second part", string(got))
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := make([]byte, 32)
+	data := make([]byte, 2*frameSize)
+	enc := encrypt(t, key, data)
+	// the length of the first frame follows the header
+	firstFrame := headerSize + 4 + frameSize + 16
+
+	tampered := append([]byte{}, enc...)
+	tampered[len(tampered)-1] ^= 1
+	wrongKey := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		key     []byte
+		wantErr error
+	}{
+		{"wrong key", enc, wrongKey, ErrDecrypt},
+		{"tampered", tampered, key, ErrDecrypt},
+		{"not encrypted", make([]byte, 100), key, ErrDecrypt},
+		{"truncated frame", enc[:len(enc)-10], key, io.ErrUnexpectedEOF},
+		{"missing last frame", enc[:firstFrame], key, io.ErrUnexpectedEOF},
+		{"truncated header", enc[:10], key, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(NewDecryptReader(bytes.NewReader(tt.data), tt.key))
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"raw", raw, false},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(raw) + "\n"), false},
+		{"short", raw[:16], true},
+		{"short base64", []byte(base64.StdEncoding.EncodeToString(raw[:16])), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEncryptionKey(tt.data)
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, raw, got)
+		})
+	}
+}
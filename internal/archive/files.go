@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileManifestName is the file in MetaDir listing the files of the backup with their digests
+const FileManifestName = "files.json"
+
+// FileEntry is a file of the backup by its slash separated path, the manifests of the agent name the
+// files relative to the folder the archive is extracted into, e.g. <uuid>/cluster/cluster-state.txt
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// CachedHash is the digest of a file as it was when it was hashed
+type CachedHash struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// HashCache holds the digests of earlier manifests by file path, a file is not hashed again
+// as long as its size and modification time did not change
+type HashCache map[string]CachedHash
+
+// HashFiles returns the entries of the regular files of dir in walk order. The files are hashed by
+// the given number of workers, the number of CPUs if not positive, files found unchanged in the cache
+// are not read. It also returns the cache of the current files, to be passed to the following call.
+func HashFiles(ctx context.Context, dir string, workers int, cache HashCache) ([]FileEntry, HashCache, error) {
+	var files []FileEntry
+	var modTimes []time.Time
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileEntry{Path: filepath.ToSlash(rel), Size: info.Size()})
+		modTimes = append(modTimes, info.ModTime().UTC())
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending []int
+	for i, f := range files {
+		c, ok := cache[f.Path]
+		if ok && c.Size == f.Size && c.ModTime.Equal(modTimes[i]) {
+			files[i].SHA256 = c.SHA256
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if err = hashPending(ctx, dir, files, pending, workers); err != nil {
+		return nil, nil, err
+	}
+
+	next := make(HashCache, len(files))
+	for i, f := range files {
+		next[f.Path] = CachedHash{Size: f.Size, ModTime: modTimes[i], SHA256: f.SHA256}
+	}
+	return files, next, nil
+}
+
+// ReadFileManifest returns the entries of a file manifest, nil if it does not exist
+func ReadFileManifest(name string) ([]FileEntry, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []FileEntry
+	if err = json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("invalid file manifest %s: %w", name, err)
+	}
+	return files, nil
+}
+
+// VerifyFiles compares the files below dir with the entries of a file manifest, they are hashed by
+// the given number of workers, the number of CPUs if not positive. It returns the sorted paths of
+// the files that are missing, have another size or another digest.
+func VerifyFiles(ctx context.Context, dir string, files []FileEntry, workers int) ([]string, error) {
+	var corrupted []string
+	var pending []int
+	found := make([]FileEntry, len(files))
+	for i, f := range files {
+		found[i] = FileEntry{Path: f.Path}
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if errors.Is(err, os.ErrNotExist) || (err == nil && (!info.Mode().IsRegular() || info.Size() != f.Size)) {
+			corrupted = append(corrupted, f.Path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, i)
+	}
+	if err := hashPending(ctx, dir, found, pending, workers); err != nil {
+		return nil, err
+	}
+	for _, i := range pending {
+		if found[i].SHA256 != files[i].SHA256 {
+			corrupted = append(corrupted, files[i].Path)
+		}
+	}
+	sort.Strings(corrupted)
+	return corrupted, nil
+}
+
+// hashPending sets the digests of the pending files, the first error stops the workers
+func hashPending(ctx context.Context, dir string, files []FileEntry, pending []int, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sum, err := hashFile(ctx, filepath.Join(dir, filepath.FromSlash(files[i].Path)))
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				// every worker writes other entries
+				files[i].SHA256 = sum
+			}
+		}()
+	}
+
+feed:
+	for _, i := range pending {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func hashFile(ctx context.Context, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, &ctxReader{ctx: ctx, r: f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ctxReader stops reading once the context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
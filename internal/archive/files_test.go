@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHashFiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "hash_files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	content := map[string]string{
+		"a.chunk":         "first",
+		"sub/b.chunk":     "second",
+		"sub/deep/c.conf": "",
+	}
+	for name, data := range content {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.Nil(t, os.WriteFile(p, []byte(data), 0600))
+	}
+
+	for _, workers := range []int{0, 1, 2, 16} {
+		files, cache, err := HashFiles(context.Background(), dir, workers, nil)
+		require.Nil(t, err)
+		require.Len(t, files, len(content))
+		require.Len(t, cache, len(content))
+		for _, f := range files {
+			require.Equal(t, sha256Hex(content[f.Path]), f.SHA256, f.Path)
+			require.Equal(t, int64(len(content[f.Path])), f.Size, f.Path)
+		}
+	}
+}
+
+func TestHashFilesCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "hash_files_cache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "kept"), []byte("kept"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "changed"), []byte("before"), 0600))
+	_, cache, err := HashFiles(context.Background(), dir, 2, nil)
+	require.Nil(t, err)
+
+	// unchanged files are taken from the cache without being read
+	c := cache["kept"]
+	c.SHA256 = "cached"
+	cache["kept"] = c
+	cache["removed"] = CachedHash{Size: 1, SHA256: "gone"}
+	later := time.Now().Add(time.Minute)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "changed"), []byte("after!"), 0600))
+	require.Nil(t, os.Chtimes(filepath.Join(dir, "changed"), later, later))
+
+	files, next, err := HashFiles(context.Background(), dir, 2, cache)
+	require.Nil(t, err)
+	got := make(map[string]string)
+	for _, f := range files {
+		got[f.Path] = f.SHA256
+	}
+	require.Equal(t, map[string]string{"kept": "cached", "changed": sha256Hex("after!")}, got)
+	require.NotContains(t, next, "removed")
+}
+
+func TestHashFilesCanceled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "hash_files_canceled")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = HashFiles(ctx, dir, 2, nil)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestVerifyFiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "verify_files")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"ok", "resized", "modified"} {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte("content"), 0600))
+	}
+	files, _, err := HashFiles(context.Background(), dir, 2, nil)
+	require.Nil(t, err)
+	files = append(files, FileEntry{Path: "missing", Size: 1, SHA256: sha256Hex("x")})
+
+	corrupted, err := VerifyFiles(context.Background(), dir, files, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"missing"}, corrupted)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "resized"), []byte("longer content"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "modified"), []byte("CONTENT"), 0600))
+	corrupted, err = VerifyFiles(context.Background(), dir, files, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"missing", "modified", "resized"}, corrupted)
+}
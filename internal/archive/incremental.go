@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncrementalFile is a chunk file of an incremental archive and the object holding its entry
+type IncrementalFile struct {
+	Size int64       `json:"size"`
+	Mode os.FileMode `json:"mode"`
+	// SHA256 is the hex encoded digest of the content of the file
+	SHA256 string    `json:"sha256,omitempty"`
+	Object ObjectRef `json:"object"`
+}
+
+// ObjectWriter writes a new object of an incremental archive with the output of fn. A shared object
+// holds the entry of a single chunk file and can be referenced by later archives.
+type ObjectWriter func(shared bool, fn func(w io.Writer) error) (ObjectRef, error)
+
+// CreateIncremental writes the content of dir as a v2 archive split into objects. The folders, the
+// meta files and the files other than chunk files go into the first object, the trailer into the
+// last one. Every chunk file is stored in an object of its own, the chunk files found in prev with
+// the same size, mode and digest are not written again but their objects referenced. The digests
+// are the hex encoded SHA-256 of the files by entry name, files without a digest are always written.
+// It returns the objects of the archive in order, whose concatenation is a regular v2 archive, and
+// the chunk files of the archive by entry name to be passed to the following call.
+func CreateIncremental(c Codec, dir, baseDirName string, meta []string, prev map[string]IncrementalFile, digests map[string]string, write ObjectWriter) ([]ObjectRef, map[string]IncrementalFile, error) {
+	m, err := c.newMemberWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var objects []ObjectRef
+	var entries []Entry
+	var offset int64
+	appendObject := func(ref ObjectRef) {
+		objects = append(objects, ref)
+		offset += ref.Size
+	}
+	addEntry := func(cw *countingWriter, path, name string, info os.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, info.Name())
+		if err != nil {
+			return err
+		}
+		header.Name = name
+
+		start := cw.n
+		if err = writeEntry(m, cw, header, path); err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Name: name, IsDir: info.IsDir(), Mode: info.Mode(), Size: header.Size, Offset: start, Length: cw.n - start})
+		return nil
+	}
+
+	type chunk struct {
+		path, name string
+		info       os.FileInfo
+	}
+	var chunks []chunk
+	ref, err := write(false, func(w io.Writer) error {
+		cw := &countingWriter{w: w, n: offset}
+		add := func(path, name string, info os.FileInfo) error {
+			return addEntry(cw, path, name, info)
+		}
+		if err := addMeta(meta, add); err != nil {
+			return err
+		}
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := filepath.Join(baseDirName, strings.TrimPrefix(path, dir))
+			if IsChunkFile(info.Name()) {
+				chunks = append(chunks, chunk{path: path, name: name, info: info})
+				return nil
+			}
+			return add(path, name, info)
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	appendObject(ref)
+
+	next := make(map[string]IncrementalFile, len(chunks))
+	for _, ch := range chunks {
+		f := IncrementalFile{Size: ch.info.Size(), Mode: ch.info.Mode(), SHA256: digests[ch.name]}
+		if p, ok := prev[ch.name]; ok && f.SHA256 != "" && p.SHA256 == f.SHA256 && p.Size == f.Size && p.Mode == f.Mode {
+			f.Object = p.Object
+			entries = append(entries, Entry{Name: ch.name, Mode: f.Mode, Size: f.Size, Offset: offset, Length: p.Object.Size})
+		} else {
+			f.Object, err = write(true, func(w io.Writer) error {
+				return addEntry(&countingWriter{w: w, n: offset}, ch.path, ch.name, ch.info)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		next[ch.name] = f
+		appendObject(f.Object)
+	}
+
+	ref, err = write(false, func(w io.Writer) error {
+		return writeTrailer(m, &countingWriter{w: w, n: offset}, c.Compression, entries)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	appendObject(ref)
+	return objects, next, nil
+}
@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// objectWriter stores the objects in the bucket under sequential keys and counts the shared ones
+func objectWriter(ctx context.Context, t *testing.T, bucket *blob.Bucket, shared *int) ObjectWriter {
+	n := 0
+	return func(s bool, fn func(w io.Writer) error) (ObjectRef, error) {
+		var buf bytes.Buffer
+		if err := fn(&buf); err != nil {
+			return ObjectRef{}, err
+		}
+		if s {
+			*shared++
+		}
+		n++
+		key := fmt.Sprintf("objects/%d-%d", *shared, n)
+		require.Nil(t, bucket.WriteAll(ctx, key, buf.Bytes(), nil))
+		sum := sha256.Sum256(buf.Bytes())
+		return ObjectRef{Key: key, Size: int64(buf.Len()), SHA256: hex.EncodeToString(sum[:])}, nil
+	}
+}
+
+// fileDigests hashes the files of dir by their entry names below baseDirName
+func fileDigests(ctx context.Context, t *testing.T, dir, baseDirName string) map[string]string {
+	files, _, err := HashFiles(ctx, dir, 1, nil)
+	require.Nil(t, err)
+	digests := make(map[string]string, len(files))
+	for _, f := range files {
+		digests[path.Join(baseDirName, f.Path)] = f.SHA256
+	}
+	return digests
+}
+
+func TestCreateIncremental(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	dir := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(dir, exampleFiles, true))
+	chunk := path.Join(dir, "s00/value/01/0000000000000001.chunk")
+	require.Nil(t, os.WriteFile(chunk, []byte("first"), 0600))
+
+	var shared int
+	objects, files, err := CreateIncremental(DefaultCodec, dir, "uuid", nil, nil, fileDigests(ctx, t, dir, "uuid"), objectWriter(ctx, t, bucket, &shared))
+	require.Nil(t, err)
+	require.Len(t, objects, 3, "the head, the chunk file and the trailer")
+	require.Equal(t, 1, shared)
+	require.Contains(t, files, "uuid/s00/value/01/0000000000000001.chunk")
+
+	// the unchanged chunk file is referenced
+	shared = 0
+	again, files, err := CreateIncremental(DefaultCodec, dir, "uuid", nil, files, fileDigests(ctx, t, dir, "uuid"), objectWriter(ctx, t, bucket, &shared))
+	require.Nil(t, err)
+	require.Zero(t, shared)
+	require.Equal(t, objects[1], again[1])
+
+	// the objects form a regular archive with a valid index
+	require.Nil(t, WriteObjectManifest(ctx, bucket, "incremental.tar.gz", again, nil))
+	r, err := NewReader(ctx, bucket, "incremental.tar.gz")
+	require.Nil(t, err)
+	data, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	require.Nil(t, bucket.WriteAll(ctx, "joined.tar.gz", data, nil))
+	index, err := ReadIndex(ctx, bucket, "joined.tar.gz")
+	require.Nil(t, err)
+	e, ok := index.Find("uuid/s00/value/01/0000000000000001.chunk")
+	require.True(t, ok)
+	_, er, err := OpenEntry(ctx, bucket, "joined.tar.gz", e)
+	require.Nil(t, err)
+	content, err := io.ReadAll(er)
+	require.Nil(t, err)
+	require.Nil(t, er.Close())
+	require.Equal(t, "first", string(content))
+	_, ok = index.Find("uuid/cluster/members.bin")
+	require.True(t, ok)
+
+	// a changed chunk file is written again, even with the same size and modification time
+	info, err := os.Stat(chunk)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(chunk, []byte("fifth"), 0600))
+	require.Nil(t, os.Chtimes(chunk, info.ModTime(), info.ModTime()))
+	shared = 0
+	_, files, err = CreateIncremental(DefaultCodec, dir, "uuid", nil, files, fileDigests(ctx, t, dir, "uuid"), objectWriter(ctx, t, bucket, &shared))
+	require.Nil(t, err)
+	require.Equal(t, 1, shared)
+
+	// a chunk file without a digest is written again
+	shared = 0
+	_, _, err = CreateIncremental(DefaultCodec, dir, "uuid", nil, files, nil, objectWriter(ctx, t, bucket, &shared))
+	require.Nil(t, err)
+	require.Equal(t, 1, shared)
+}
+
+func TestIncrementalReaderVerifiesObjects(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "a", []byte("0123"), nil))
+	require.Nil(t, bucket.WriteAll(ctx, "b", []byte("4567"), nil))
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	objects := []ObjectRef{{Key: "a", Size: 4, SHA256: digest("0123")}, {Key: "b", Size: 4, SHA256: digest("4567")}}
+	require.Nil(t, WriteObjectManifest(ctx, bucket, "good.tar.gz", objects, nil))
+	objects[1].SHA256 = digest("other")
+	require.Nil(t, WriteObjectManifest(ctx, bucket, "bad.tar.gz", objects, nil))
+
+	ok, err := Incremental(ctx, bucket, "good.tar.gz")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	for _, offset := range []int64{0, 2, 4, 6} {
+		r, err := NewOffsetReader(ctx, bucket, "good.tar.gz", offset)
+		require.Nil(t, err)
+		got, err := io.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, "01234567"[offset:], string(got))
+	}
+
+	r, err := NewReader(ctx, bucket, "bad.tar.gz")
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+}
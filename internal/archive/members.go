@@ -0,0 +1,49 @@
+package archive
+
+import (
+	"context"
+	"strconv"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// ClusterSizeMetadata is the object metadata key of the number of members that took the backup
+const ClusterSizeMetadata = "cluster-size"
+
+// WithClusterSize returns a copy of opts that records the cluster size in the metadata of the
+// written object, a size of 0 records nothing
+func WithClusterSize(opts *blob.WriterOptions, size int) *blob.WriterOptions {
+	if size <= 0 {
+		return opts
+	}
+	o := blob.WriterOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	md := make(map[string]string, len(o.Metadata)+1)
+	for k, v := range o.Metadata {
+		md[k] = v
+	}
+	md[ClusterSizeMetadata] = strconv.Itoa(size)
+	o.Metadata = md
+	return &o
+}
+
+// ReadClusterSize returns the number of members that took the backup of the archive stored
+// under key, it is recorded on the object or on the manifest of archives stored in parts.
+// Archives of older agents have no cluster size and 0 is returned.
+func ReadClusterSize(ctx context.Context, bucket *blob.Bucket, key string) (int, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		attrs, err = bucket.Attributes(ctx, ManifestKey(key))
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.Atoi(attrs.Metadata[ClusterSizeMetadata])
+	if err != nil || size < 0 {
+		return 0, nil
+	}
+	return size, nil
+}
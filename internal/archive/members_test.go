@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestClusterSize(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	opts := &blob.WriterOptions{Metadata: map[string]string{"owner": "agent"}}
+	require.Nil(t, bucket.WriteAll(ctx, "single.tar.gz", []byte("archive"), WithClusterSize(opts, 5)))
+	require.Nil(t, bucket.WriteAll(ctx, PartKey("parts.tar.gz", 0), []byte("archive"), nil))
+	require.Nil(t, WriteManifest(ctx, bucket, "parts.tar.gz", 1, WithClusterSize(nil, 3)))
+	require.Nil(t, bucket.WriteAll(ctx, "legacy.tar.gz", []byte("archive"), WithClusterSize(nil, 0)))
+	// the options of the caller are not changed
+	require.Equal(t, map[string]string{"owner": "agent"}, opts.Metadata)
+
+	tests := []struct {
+		key     string
+		want    int
+		wantErr bool
+	}{
+		{"single.tar.gz", 5, false},
+		{"parts.tar.gz", 3, false},
+		{"legacy.tar.gz", 0, false},
+		{"missing.tar.gz", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := ReadClusterSize(ctx, bucket, tt.key)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
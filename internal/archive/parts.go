@@ -0,0 +1,231 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"gocloud.dev/blob"
+)
+
+// ManifestSuffix is appended to the archive key for the manifest of an archive stored in parts
+const ManifestSuffix = ".parts"
+
+// Manifest lists the parts of an archive, it is written only after the last part is uploaded
+type Manifest struct {
+	Parts int `json:"parts"`
+	// Objects are the parts of an incremental archive, they are not stored under the part keys and
+	// can be shared with other archives
+	Objects []ObjectRef `json:"objects,omitempty"`
+}
+
+// ObjectRef is an object holding a slice of an archive
+type ObjectRef struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PartKey returns the key of the n-th part of the archive stored under key
+func PartKey(key string, n int) string {
+	return fmt.Sprintf("%s.part-%04d", key, n)
+}
+
+// ManifestKey returns the key of the manifest of the archive stored under key
+func ManifestKey(key string) string {
+	return key + ManifestSuffix
+}
+
+// WriteManifest marks the archive stored under key in the given number of parts as complete
+func WriteManifest(ctx context.Context, bucket *blob.Bucket, key string, parts int, opts *blob.WriterOptions) error {
+	return writeManifest(ctx, bucket, key, Manifest{Parts: parts}, opts)
+}
+
+// WriteObjectManifest marks the incremental archive stored under key in the given objects as complete
+func WriteObjectManifest(ctx context.Context, bucket *blob.Bucket, key string, objects []ObjectRef, opts *blob.WriterOptions) error {
+	return writeManifest(ctx, bucket, key, Manifest{Parts: len(objects), Objects: objects}, opts)
+}
+
+func writeManifest(ctx context.Context, bucket *blob.Bucket, key string, m Manifest, opts *blob.WriterOptions) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return bucket.WriteAll(ctx, ManifestKey(key), data, opts)
+}
+
+// NewReader returns a reader for the archive stored under key, either as a single object or in parts
+func NewReader(ctx context.Context, bucket *blob.Bucket, key string) (io.ReadCloser, error) {
+	return NewOffsetReader(ctx, bucket, key, 0)
+}
+
+// NewOffsetReader returns a reader for the archive stored under key that starts at offset,
+// it is used to continue an interrupted download
+func NewOffsetReader(ctx context.Context, bucket *blob.Bucket, key string, offset int64) (io.ReadCloser, error) {
+	exists, err := bucket.Exists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return bucket.NewRangeReader(ctx, key, offset, -1, nil)
+	}
+
+	m, err := ReadManifest(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &partsReader{ctx: ctx, bucket: bucket, key: key, parts: m.Parts, objects: m.Objects}
+	// skip the parts before the offset
+	for offset > 0 && p.next < p.parts {
+		size, err := p.size(p.next)
+		if err != nil {
+			return nil, err
+		}
+		if offset < size {
+			break
+		}
+		offset -= size
+		p.next++
+	}
+	p.offset = offset
+	return p, nil
+}
+
+// ReadManifest reads the manifest of the archive stored in parts under key
+func ReadManifest(ctx context.Context, bucket *blob.Bucket, key string) (*Manifest, error) {
+	data, err := bucket.ReadAll(ctx, ManifestKey(key))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Parts <= 0 {
+		return nil, fmt.Errorf("invalid number of archive parts %d", m.Parts)
+	}
+	if m.Objects != nil && len(m.Objects) != m.Parts {
+		return nil, fmt.Errorf("archive manifest lists %d objects for %d parts", len(m.Objects), m.Parts)
+	}
+	return &m, nil
+}
+
+// Keys returns the keys of the parts of the archive stored under key in order
+func (m *Manifest) Keys(key string) []string {
+	keys := make([]string, 0, m.Parts)
+	for n := 0; n < m.Parts; n++ {
+		if m.Objects != nil {
+			keys = append(keys, m.Objects[n].Key)
+		} else {
+			keys = append(keys, PartKey(key, n))
+		}
+	}
+	return keys
+}
+
+// Incremental reports whether the archive stored under key is an incremental archive
+func Incremental(ctx context.Context, bucket *blob.Bucket, key string) (bool, error) {
+	exists, err := bucket.Exists(ctx, ManifestKey(key))
+	if err != nil || !exists {
+		return false, err
+	}
+	m, err := ReadManifest(ctx, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	return len(m.Objects) > 0, nil
+}
+
+// partsReader reads the parts of an archive one after the other. The objects of an incremental
+// archive are verified against their digests, unless the first one read starts after 0.
+type partsReader struct {
+	ctx     context.Context
+	bucket  *blob.Bucket
+	key     string
+	parts   int
+	objects []ObjectRef
+	next    int
+	// offset is the position in the next part, only the first part read can start after 0
+	offset int64
+	cur    *blob.Reader
+	// h hashes the object read, nil if it is not verified
+	h    hash.Hash
+	want string
+}
+
+// size returns the size of the n-th part
+func (p *partsReader) size(n int) (int64, error) {
+	if p.objects != nil {
+		return p.objects[n].Size, nil
+	}
+	attrs, err := p.bucket.Attributes(p.ctx, PartKey(p.key, n))
+	if err != nil {
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if p.next >= p.parts {
+				return 0, io.EOF
+			}
+			key := PartKey(p.key, p.next)
+			p.h = nil
+			if p.objects != nil {
+				key = p.objects[p.next].Key
+				if p.offset == 0 {
+					p.h, p.want = sha256.New(), p.objects[p.next].SHA256
+				}
+			}
+			r, err := p.bucket.NewRangeReader(p.ctx, key, p.offset, -1, nil)
+			if err != nil {
+				return 0, err
+			}
+			p.cur = r
+			p.next++
+			p.offset = 0
+		}
+
+		n, err := p.cur.Read(b)
+		if p.h != nil {
+			p.h.Write(b[:n])
+		}
+		if err == io.EOF {
+			err = p.cur.Close()
+			p.cur = nil
+			if err == nil && p.h != nil && hex.EncodeToString(p.h.Sum(nil)) != p.want {
+				err = fmt.Errorf("%w: object %s of %s", ErrChecksumMismatch, p.objects[p.next-1].Key, p.key)
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.cur == nil {
+		return nil
+	}
+	return p.cur.Close()
+}
+
+// Key returns the archive key for an object key in a bucket listing. Archive parts are ignored,
+// manifests stand for the whole archive.
+func Key(objKey string) (string, bool) {
+	key := strings.TrimSuffix(objKey, ManifestSuffix)
+	if _, ok := CompressionOf(key); ok {
+		return key, true
+	}
+	return "", false
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// Object metadata keys of the snapshot of the backup folder, the times are RFC 3339 in UTC
+const (
+	SnapshotStartMetadata = "snapshot-start"
+	SnapshotEndMetadata   = "snapshot-end"
+	OldestModTimeMetadata = "source-oldest-mod-time"
+	NewestModTimeMetadata = "source-newest-mod-time"
+)
+
+// WithSnapshot returns a copy of opts that records the snapshot in the metadata of the written
+// object, a nil snapshot records nothing
+func WithSnapshot(opts *blob.WriterOptions, s *api.SnapshotInfo) *blob.WriterOptions {
+	if s == nil {
+		return opts
+	}
+	o := blob.WriterOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	md := make(map[string]string, len(o.Metadata)+4)
+	for k, v := range o.Metadata {
+		md[k] = v
+	}
+	md[SnapshotStartMetadata] = formatMetadataTime(s.Start)
+	md[SnapshotEndMetadata] = formatMetadataTime(s.End)
+	md[OldestModTimeMetadata] = formatMetadataTime(s.OldestModTime)
+	md[NewestModTimeMetadata] = formatMetadataTime(s.NewestModTime)
+	o.Metadata = md
+	return &o
+}
+
+// ReadSnapshot returns the snapshot recorded on the archive stored under key, or on the manifest
+// of archives stored in parts. Archives of older agents have no snapshot and nil is returned.
+func ReadSnapshot(ctx context.Context, bucket *blob.Bucket, key string) (*api.SnapshotInfo, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		attrs, err = bucket.Attributes(ctx, ManifestKey(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s api.SnapshotInfo
+	for k, t := range map[string]*time.Time{
+		SnapshotStartMetadata: &s.Start,
+		SnapshotEndMetadata:   &s.End,
+		OldestModTimeMetadata: &s.OldestModTime,
+		NewestModTimeMetadata: &s.NewestModTime,
+	} {
+		if *t, err = time.Parse(time.RFC3339Nano, attrs.Metadata[k]); err != nil {
+			return nil, nil
+		}
+	}
+	return &s, nil
+}
+
+func formatMetadataTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	cest := time.FixedZone("CEST", 2*60*60)
+	snap := &api.SnapshotInfo{
+		Start:         time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC),
+		End:           time.Date(2022, 7, 28, 19, 0, 56, 500, time.UTC),
+		OldestModTime: time.Date(2022, 7, 28, 18, 0, 0, 0, time.UTC),
+		NewestModTime: time.Date(2022, 7, 28, 20, 59, 0, 0, cest),
+	}
+	opts := &blob.WriterOptions{Metadata: map[string]string{"owner": "agent"}}
+	require.Nil(t, bucket.WriteAll(ctx, "single.tar.gz", []byte("archive"), WithSnapshot(opts, snap)))
+	require.Nil(t, bucket.WriteAll(ctx, PartKey("parts.tar.gz", 0), []byte("archive"), nil))
+	require.Nil(t, WriteManifest(ctx, bucket, "parts.tar.gz", 1, WithSnapshot(WithClusterSize(nil, 3), snap)))
+	require.Nil(t, bucket.WriteAll(ctx, "legacy.tar.gz", []byte("archive"), WithSnapshot(nil, nil)))
+	// the options of the caller are not changed
+	require.Equal(t, map[string]string{"owner": "agent"}, opts.Metadata)
+
+	attrs, err := bucket.Attributes(ctx, "single.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "2022-07-28T18:59:00Z", attrs.Metadata[NewestModTimeMetadata], "times are stored in UTC")
+
+	tests := []struct {
+		key     string
+		want    *api.SnapshotInfo
+		wantErr bool
+	}{
+		{"single.tar.gz", snap, false},
+		{"parts.tar.gz", snap, false},
+		{"legacy.tar.gz", nil, false},
+		{"missing.tar.gz", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := ReadSnapshot(ctx, bucket, tt.key)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if tt.want == nil {
+				require.Nil(t, got)
+				return
+			}
+			require.True(t, tt.want.Start.Equal(got.Start))
+			require.True(t, tt.want.End.Equal(got.End))
+			require.True(t, tt.want.OldestModTime.Equal(got.OldestModTime))
+			require.True(t, tt.want.NewestModTime.Equal(got.NewestModTime))
+		})
+	}
+}
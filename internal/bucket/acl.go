@@ -0,0 +1,54 @@
+package bucket
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// GCS names of the canned ACLs
+var gcsACLs = map[string]string{
+	api.ACLPrivate:                "private",
+	api.ACLBucketOwnerRead:        "bucketOwnerRead",
+	api.ACLBucketOwnerFullControl: "bucketOwnerFullControl",
+}
+
+// ValidateACL returns an error if the canned ACL is not supported, empty means the bucket default
+func ValidateACL(acl string) error {
+	if _, ok := gcsACLs[acl]; acl != "" && !ok {
+		return fmt.Errorf("unsupported object ACL %q", acl)
+	}
+	return nil
+}
+
+// WithACL sets the canned ACL of the objects written with opts. S3 and GCS apply it, Azure has no
+// object ACLs and ignores it like the other drivers.
+func WithACL(opts *blob.WriterOptions, acl string) (*blob.WriterOptions, error) {
+	if acl == "" {
+		return opts, nil
+	}
+	if err := ValidateACL(acl); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &blob.WriterOptions{}
+	}
+	opts.BeforeWrite = func(as func(interface{}) bool) error {
+		var in *s3manager.UploadInput
+		if as(&in) {
+			in.ACL = aws.String(acl)
+			return nil
+		}
+		var w *storage.Writer
+		if as(&w) {
+			w.PredefinedACL = gcsACLs[acl]
+		}
+		return nil
+	}
+	return opts, nil
+}
@@ -0,0 +1,68 @@
+package bucket
+
+import (
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func TestWithACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		acl     string
+		wantS3  string
+		wantGCS string
+		wantErr bool
+	}{
+		{"owner full control", api.ACLBucketOwnerFullControl, "bucket-owner-full-control", "bucketOwnerFullControl", false},
+		{"owner read", api.ACLBucketOwnerRead, "bucket-owner-read", "bucketOwnerRead", false},
+		{"private", api.ACLPrivate, "private", "private", false},
+		{"unsupported", "public-read", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := WithACL(&blob.WriterOptions{BufferSize: 1024}, tt.acl)
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, 1024, opts.BufferSize)
+
+			// the drivers expose their native request types through the as function
+			in := &s3manager.UploadInput{}
+			require.Nil(t, opts.BeforeWrite(func(i interface{}) bool {
+				p, ok := i.(**s3manager.UploadInput)
+				if ok {
+					*p = in
+				}
+				return ok
+			}))
+			require.Equal(t, tt.wantS3, *in.ACL)
+
+			w := &storage.Writer{}
+			require.Nil(t, opts.BeforeWrite(func(i interface{}) bool {
+				p, ok := i.(**storage.Writer)
+				if ok {
+					*p = w
+				}
+				return ok
+			}))
+			require.Equal(t, tt.wantGCS, w.PredefinedACL)
+
+			// other drivers have no object ACLs
+			require.Nil(t, opts.BeforeWrite(func(interface{}) bool { return false }))
+		})
+	}
+}
+
+func TestWithoutACL(t *testing.T) {
+	opts, err := WithACL(nil, "")
+	require.Nil(t, err)
+	require.Nil(t, opts)
+}
@@ -4,18 +4,29 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
 	"gocloud.dev/blob"
+	"gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/gcsblob"
 	"gocloud.dev/gcp"
 	"golang.org/x/oauth2/google"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/local"
+	"github.com/hazelcast/platform-operator-agent/internal/netutil"
 )
 
 // Blob storage types
@@ -38,6 +49,8 @@ const (
 // GCP
 const (
 	GCPCredentialFile = "google-credentials-path"
+
+	gcpScope = "https://www.googleapis.com/auth/cloud-platform"
 )
 
 // Azure
@@ -65,10 +78,23 @@ func OpenBucket(ctx context.Context, bucketURL string, secretData map[string][]b
 }
 
 func SecretData(ctx context.Context, sn string) (map[string][]byte, error) {
+	// outside of Kubernetes the secret is a folder in the user configuration
+	if local.Enabled {
+		return local.SecretData(sn)
+	}
+	// buckets without credentials, like file buckets, need no secret
+	if sn == "" {
+		return nil, nil
+	}
+	if secretFallbackErr != nil {
+		return nil, secretFallbackErr
+	}
+
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, err
 	}
+	config.Dial = netutil.DialContext
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -81,12 +107,28 @@ func SecretData(ctx context.Context, sn string) (map[string][]byte, error) {
 	}
 
 	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, sn, metav1.GetOptions{})
+	if apierrors.IsForbidden(err) {
+		return secretFallback.fallbackSecretData(sn, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return secret.Data, nil
 }
 
+// EncryptionKey reads the key of encrypted archives from the named secret
+func EncryptionKey(ctx context.Context, sn string) ([]byte, error) {
+	data, err := SecretData(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := data[archive.EncryptionKeyName]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s entry", sn, archive.EncryptionKeyName)
+	}
+	return archive.ParseEncryptionKey(v)
+}
+
 func namespace() (string, error) {
 	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
 		return ns, nil
@@ -101,32 +143,69 @@ func namespace() (string, error) {
 }
 
 func openAWS(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
-	if err := setCredentialEnv(secret, S3AccessKeyID, S3EnvAccessKeyID); err != nil {
+	ambient, err := ambientCredentials(secret)
+	if err != nil {
 		return nil, err
 	}
-	if err := setCredentialEnv(secret, S3Region, S3EnvRegion); err != nil {
-		return nil, err
+	// the default credential chain of the SDK finds the ambient credentials, the region is taken from the URL
+	if !ambient {
+		if err := setCredentialEnv(secret, S3AccessKeyID, S3EnvAccessKeyID); err != nil {
+			return nil, err
+		}
+		if err := setCredentialEnv(secret, S3Region, S3EnvRegion); err != nil {
+			return nil, err
+		}
+		if err := setCredentialEnv(secret, S3SecretAccessKey, S3EnvSecretAccessKey); err != nil {
+			return nil, err
+		}
 	}
-	if err := setCredentialEnv(secret, S3SecretAccessKey, S3EnvSecretAccessKey); err != nil {
+
+	pays, err := requesterPays(secret)
+	if err != nil {
 		return nil, err
 	}
-
+	if pays {
+		return openAWSRequesterPays(ctx, bucketURL)
+	}
 	return blob.OpenBucket(ctx, bucketURL)
 }
 
 func openGCP(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
-	value, ok := secret[GCPCredentialFile]
-	if !ok {
-		return nil, fmt.Errorf("invalid secret for GCP : missing credential: %v", GCPCredentialFile)
+	ambient, err := ambientCredentials(secret)
+	if err != nil {
+		return nil, err
+	}
+	var creds *google.Credentials
+	if ambient {
+		creds, err = google.FindDefaultCredentials(ctx, gcpScope)
+	} else {
+		value, ok := secret[GCPCredentialFile]
+		if !ok {
+			return nil, fmt.Errorf("invalid secret for GCP : missing credential: %v", GCPCredentialFile)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, value, gcpScope)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	creds, err := google.CredentialsFromJSON(ctx, value, "https://www.googleapis.com/auth/cloud-platform")
+	transport := gcp.DefaultTransport()
+	pays, err := requesterPays(secret)
 	if err != nil {
 		return nil, err
 	}
+	if project := string(secret[GCPBillingProject]); project != "" || pays {
+		if project == "" {
+			project = creds.ProjectID
+		}
+		if project == "" {
+			return nil, fmt.Errorf("invalid secret for GCP: requester pays needs %s or a project in the credentials", GCPBillingProject)
+		}
+		transport = &userProjectTransport{base: transport, project: project}
+	}
 
 	client, err := gcp.NewHTTPClient(
-		gcp.DefaultTransport(),
+		transport,
 		gcp.CredentialsTokenSource(creds),
 	)
 	if err != nil {
@@ -147,6 +226,12 @@ func openGCP(ctx context.Context, bucketURL string, secret map[string][]byte) (*
 }
 
 func openAZURE(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
+	if ambient, err := ambientCredentials(secret); err != nil || ambient {
+		if err == nil {
+			err = fmt.Errorf("ambient credentials are not supported for Azure, the storage key is needed")
+		}
+		return nil, err
+	}
 	if err := setCredentialEnv(secret, AzureStorageAccount, AzureEnvStorageAccount); err != nil {
 		return nil, err
 	}
@@ -155,7 +240,56 @@ func openAZURE(ctx context.Context, bucketURL string, secret map[string][]byte)
 		return nil, err
 	}
 
-	return blob.OpenBucket(ctx, bucketURL)
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+	prefix := u.Query().Get("prefix")
+	q := u.Query()
+	q.Del("prefix")
+	u.RawQuery = q.Encode()
+
+	accountName := azureblob.AccountName(secret[AzureStorageAccount])
+	credential, err := azureblob.NewCredential(accountName, azureblob.AccountKey(secret[AzureStorageKey]))
+	if err != nil {
+		return nil, err
+	}
+
+	// the Azure pipeline has its own HTTP client, send the requests with the agent transport instead
+	client := &http.Client{Transport: netutil.Transport()}
+	p := azureblob.NewPipeline(credential, azblob.PipelineOptions{HTTPSender: httpSender(client)})
+
+	domain, _ := azureblob.DefaultStorageDomain()
+	protocol, _ := azureblob.DefaultProtocol()
+	isCDN, _ := azureblob.DefaultIsCDN()
+	opener := &azureblob.URLOpener{
+		AccountName: accountName,
+		Pipeline:    p,
+		Options: azureblob.Options{
+			Credential:    credential,
+			StorageDomain: domain,
+			Protocol:      protocol,
+			IsCDN:         isCDN,
+		},
+	}
+
+	bucket, err := opener.OpenBucketURL(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return blob.PrefixedBucket(bucket, prefix), nil
+}
+
+func httpSender(client *http.Client) pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			r, err := client.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(r), err
+		}
+	})
 }
 
 func setCredentialEnv(secret map[string][]byte, key, name string) error {
@@ -167,13 +301,18 @@ func setCredentialEnv(secret map[string][]byte, key, name string) error {
 }
 
 func SaveFileFromBucket(ctx context.Context, bucket *blob.Bucket, key, path string) error {
+	return SaveFileAs(ctx, bucket, key, filepath.Join(path, key))
+}
+
+// SaveFileAs writes the object to the file destPath
+func SaveFileAs(ctx context.Context, bucket *blob.Bucket, key, destPath string) error {
+	start := time.Now()
 	s, err := bucket.NewReader(ctx, key, nil)
 	if err != nil {
 		return err
 	}
 	defer s.Close()
-
-	destPath := filepath.Join(path, key)
+	buf := make([]byte, ReadBufferSize(s.Size(), time.Since(start)))
 
 	d, err := os.Create(destPath)
 	if err != nil {
@@ -181,7 +320,7 @@ func SaveFileFromBucket(ctx context.Context, bucket *blob.Bucket, key, path stri
 	}
 	defer d.Close()
 
-	if _, err = io.Copy(d, s); err != nil {
+	if _, err = io.CopyBuffer(d, s, buf); err != nil {
 		return err
 	}
 
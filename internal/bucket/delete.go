@@ -0,0 +1,165 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// S3 DeleteObjects accepts at most 1000 keys per request
+const maxDeleteBatchSize = 1000
+
+// DeleteOptions configures DeleteKeys and DeletePrefix
+type DeleteOptions struct {
+	// BucketURL enables the provider batch delete API, the bucket name and prefix are taken from it
+	BucketURL string
+	// BatchSize is the number of objects deleted per batch, 0 means the largest batch allowed
+	BatchSize int
+	// Rate is the maximum number of deleted objects per second, 0 means unlimited
+	Rate float64
+	// DryRun only reports the keys that would be deleted
+	DryRun bool
+}
+
+// DeletePrefix deletes all objects under prefix and returns their keys
+func DeletePrefix(ctx context.Context, b *blob.Bucket, prefix string, opts DeleteOptions) ([]string, error) {
+	start := time.Now()
+	var keys []string
+	var latency time.Duration
+	iter := b.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if latency == 0 {
+			latency = time.Since(start)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return deleteKeys(ctx, b, keys, opts, latency)
+}
+
+// DeleteKeys deletes the objects in rate-limited batches and returns the deleted keys,
+// in dry-run mode nothing is deleted and all keys are returned
+func DeleteKeys(ctx context.Context, b *blob.Bucket, keys []string, opts DeleteOptions) ([]string, error) {
+	return deleteKeys(ctx, b, keys, opts, 0)
+}
+
+func deleteKeys(ctx context.Context, b *blob.Bucket, keys []string, opts DeleteOptions, latency time.Duration) ([]string, error) {
+	if opts.DryRun {
+		return keys, nil
+	}
+
+	size := opts.BatchSize
+	if size <= 0 || size > maxDeleteBatchSize {
+		size = maxDeleteBatchSize
+	}
+	limit := rate.Inf
+	if opts.Rate > 0 {
+		limit = rate.Limit(opts.Rate)
+		// a batch must fit into a single burst
+		if int(opts.Rate) < size {
+			size = int(opts.Rate)
+			if size < 1 {
+				size = 1
+			}
+		}
+	}
+	limiter := rate.NewLimiter(limit, size)
+
+	del := func(ctx context.Context, batch []string) error {
+		return deleteEach(ctx, b, batch, latency)
+	}
+	if s3Client, name, prefix, ok := s3Batch(b, opts.BucketURL); ok {
+		del = func(ctx context.Context, batch []string) error {
+			return deleteS3(ctx, s3Client, name, prefix, batch)
+		}
+	}
+
+	var deleted []string
+	for len(keys) > 0 {
+		n := size
+		if len(keys) < n {
+			n = len(keys)
+		}
+		batch := keys[:n]
+		keys = keys[n:]
+
+		if err := limiter.WaitN(ctx, len(batch)); err != nil {
+			return deleted, err
+		}
+		if err := del(ctx, batch); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, batch...)
+	}
+	return deleted, nil
+}
+
+// deleteEach deletes the objects one by one in parallel, used when the provider has no batch API.
+// Objects that are already gone count as deleted, like with the batch API.
+func deleteEach(ctx context.Context, b *blob.Bucket, keys []string, latency time.Duration) error {
+	g, groupCtx := errgroup.WithContext(ctx)
+	g.SetLimit(Concurrency(len(keys), latency))
+	for _, key := range keys {
+		key := key
+		g.Go(func() error {
+			err := b.Delete(groupCtx, key)
+			if gcerrors.Code(err) == gcerrors.NotFound {
+				return nil
+			}
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+// s3Batch returns the S3 client, bucket name and key prefix if the bucket supports DeleteObjects
+func s3Batch(b *blob.Bucket, bucketURL string) (*s3.S3, string, string, bool) {
+	if bucketURL == "" {
+		return nil, "", "", false
+	}
+	var client *s3.S3
+	if !b.As(&client) {
+		return nil, "", "", false
+	}
+	u, err := url.Parse(bucketURL)
+	if err != nil || u.Scheme != AWS || u.Host == "" {
+		return nil, "", "", false
+	}
+	return client, u.Host, u.Query().Get("prefix"), true
+}
+
+func deleteS3(ctx context.Context, client *s3.S3, name, prefix string, keys []string) error {
+	objects := make([]*s3.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		// backup keys contain no characters escaped by s3blob, so they map to S3 keys directly
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(prefix + key)})
+	}
+	out, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(name),
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(out.Errors) > 0 {
+		e := out.Errors[0]
+		return fmt.Errorf("failed to delete %d objects, first error on %s: %s",
+			len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+	}
+	return nil
+}
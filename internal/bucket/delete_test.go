@@ -0,0 +1,81 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestDeletePrefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      DeleteOptions
+		wantLeft  int
+		wantCount int
+	}{
+		{"delete all", DeleteOptions{}, 2, 25},
+		{"small batches", DeleteOptions{BatchSize: 4}, 2, 25},
+		{"rate limited", DeleteOptions{BatchSize: 10, Rate: 1000}, 2, 25},
+		{"dry run", DeleteOptions{DryRun: true}, 27, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := memblob.OpenBucket(nil)
+			defer b.Close()
+			for i := 0; i < 25; i++ {
+				require.Nil(t, b.WriteAll(ctx, fmt.Sprintf("old/%02d", i), []byte("c"), nil))
+			}
+			require.Nil(t, b.WriteAll(ctx, "new/00", []byte("c"), nil))
+			require.Nil(t, b.WriteAll(ctx, "older", []byte("c"), nil))
+
+			deleted, err := DeletePrefix(ctx, b, "old/", tt.opts)
+			require.Nil(t, err)
+			require.Len(t, deleted, tt.wantCount)
+			require.Equal(t, tt.wantLeft, countObjects(t, b))
+		})
+	}
+}
+
+func TestDeleteKeysCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	require.Nil(t, b.WriteAll(context.Background(), "key", []byte("c"), nil))
+
+	deleted, err := DeleteKeys(ctx, b, []string{"key"}, DeleteOptions{Rate: 1})
+	require.NotNil(t, err)
+	require.Empty(t, deleted)
+}
+
+func TestDeleteKeysMissing(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	require.Nil(t, b.WriteAll(ctx, "key", []byte("c"), nil))
+
+	// another member may have deleted the object first
+	deleted, err := DeleteKeys(ctx, b, []string{"gone", "key"}, DeleteOptions{})
+	require.Nil(t, err)
+	require.Equal(t, []string{"gone", "key"}, deleted)
+	require.Equal(t, 0, countObjects(t, b))
+}
+
+func countObjects(t *testing.T, b *blob.Bucket) int {
+	var n int
+	iter := b.List(nil)
+	for {
+		_, err := iter.Next(context.Background())
+		if err == io.EOF {
+			return n
+		}
+		require.Nil(t, err)
+		n++
+	}
+}
@@ -0,0 +1,46 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+var failoverLog = logger.New().Named("bucket_failover")
+
+// Failover calls fn with the bucket URLs in order until it succeeds and returns the URL that was used.
+// A canceled context stops the failover, if all endpoints fail the errors of all of them are returned.
+func Failover(ctx context.Context, bucketURLs []string, fn func(bucketURL string) error) (string, error) {
+	if len(bucketURLs) == 0 {
+		return "", errors.New("no bucket URL")
+	}
+
+	var errs []string
+	var err error
+	for i, u := range bucketURLs {
+		err = fn(u)
+		if err == nil {
+			if i > 0 {
+				failoverLog.Info("failed over to bucket", zap.String("bucket URL", logger.Redact(u)))
+			}
+			return u, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return "", err
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", logger.Redact(u), err))
+		if i < len(bucketURLs)-1 {
+			failoverLog.Warn("bucket failed, trying the next one: "+err.Error(), zap.String("bucket URL", logger.Redact(u)))
+		}
+	}
+	if len(errs) == 1 {
+		return "", err
+	}
+	return "", errors.New("all buckets failed: " + strings.Join(errs, "; "))
+}
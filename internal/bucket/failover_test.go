@@ -0,0 +1,51 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailover(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	tests := []struct {
+		name      string
+		urls      []string
+		failing   map[string]error
+		want      string
+		wantCalls []string
+		wantErr   string
+	}{
+		{"primary", []string{"s3://a", "gs://b"}, nil, "s3://a", []string{"s3://a"}, ""},
+		{"fallback", []string{"s3://a", "gs://b", "azblob://c"}, map[string]error{"s3://a": errUnavailable}, "gs://b", []string{"s3://a", "gs://b"}, ""},
+		{"single failure", []string{"s3://a"}, map[string]error{"s3://a": errUnavailable}, "", []string{"s3://a"}, "unavailable"},
+		{
+			"all failed",
+			[]string{"s3://a", "gs://b"},
+			map[string]error{"s3://a": errUnavailable, "gs://b": errUnavailable},
+			"",
+			[]string{"s3://a", "gs://b"},
+			"all buckets failed: s3://a: unavailable; gs://b: unavailable",
+		},
+		{"canceled", []string{"s3://a", "gs://b"}, map[string]error{"s3://a": context.Canceled}, "", []string{"s3://a"}, context.Canceled.Error()},
+		{"no bucket", nil, nil, "", nil, "no bucket URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			got, err := Failover(context.Background(), tt.urls, func(u string) error {
+				calls = append(calls, u)
+				return tt.failing[u]
+			})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.Nil(t, err)
+			}
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gcaws "gocloud.dev/aws"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/s3blob"
+)
+
+// Requester-pays buckets bill the requests to the reader instead of the owner, e.g. a shared DR bucket
+// of another account. The secret entries apply to every bucket opened with the secret. Azure has no
+// requester pays, the storage account owner always pays.
+const (
+	// RequesterPays is true to accept the charges of requester-pays S3 and GCS buckets
+	RequesterPays = "requester-pays"
+	// GCPBillingProject is the project billed for GCS requests, it enables requester pays on its own.
+	// Without it the project of the credentials is billed.
+	GCPBillingProject = "billing-project"
+)
+
+// WithRequesterPays returns a copy of the secret that accepts the charges of requester-pays buckets,
+// GCS requests are billed to project if it is set
+func WithRequesterPays(secret map[string][]byte, project string) map[string][]byte {
+	s := make(map[string][]byte, len(secret)+2)
+	for k, v := range secret {
+		s[k] = v
+	}
+	s[RequesterPays] = []byte("true")
+	if project != "" {
+		s[GCPBillingProject] = []byte(project)
+	}
+	return s
+}
+
+func requesterPays(secret map[string][]byte) (bool, error) {
+	v, ok := secret[RequesterPays]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(string(v))
+	if err != nil {
+		return false, fmt.Errorf("invalid secret: %s must be true or false", RequesterPays)
+	}
+	return b, nil
+}
+
+// openAWSRequesterPays opens the bucket like the s3 URL opener does, the session sends the request
+// payer header with every request before it is signed
+func openAWSRequesterPays(ctx context.Context, bucketURL string) (*blob.Bucket, error) {
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	prefix := q.Get("prefix")
+	q.Del("prefix")
+	sess, rest, err := gcaws.NewSessionFromURLParams(q)
+	if err != nil {
+		return nil, err
+	}
+	sess.Handlers.Build.PushBack(func(r *request.Request) {
+		r.HTTPRequest.Header.Set("x-amz-request-payer", s3.RequestPayerRequester)
+	})
+
+	u.RawQuery = rest.Encode()
+	opener := &s3blob.URLOpener{ConfigProvider: sess}
+	bucket, err := opener.OpenBucketURL(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return blob.PrefixedBucket(bucket, prefix), nil
+}
+
+// userProjectTransport bills the GCS requests to the project, the JSON and the XML API both take
+// the userProject parameter
+type userProjectTransport struct {
+	base    http.RoundTripper
+	project string
+}
+
+func (t *userProjectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	q := r.URL.Query()
+	q.Set("userProject", t.project)
+	r.URL.RawQuery = q.Encode()
+	return t.base.RoundTrip(r)
+}
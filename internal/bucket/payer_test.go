@@ -0,0 +1,72 @@
+package bucket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRequesterPays(t *testing.T) {
+	secret := map[string][]byte{S3AccessKeyID: []byte("id")}
+	s := WithRequesterPays(secret, "billing")
+	require.Equal(t, "id", string(s[S3AccessKeyID]))
+	require.Equal(t, "billing", string(s[GCPBillingProject]))
+	pays, err := requesterPays(s)
+	require.Nil(t, err)
+	require.True(t, pays)
+	// the secret read from Kubernetes is not changed
+	require.Len(t, secret, 1)
+
+	pays, err = requesterPays(secret)
+	require.Nil(t, err)
+	require.False(t, pays)
+	_, err = requesterPays(map[string][]byte{RequesterPays: []byte("yes please")})
+	require.Error(t, err)
+}
+
+func TestOpenAWSRequesterPays(t *testing.T) {
+	var mu sync.Mutex
+	var payer, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		payer, path = r.Header.Get("x-amz-request-payer"), r.URL.Path
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	secret := WithRequesterPays(map[string][]byte{
+		S3AccessKeyID:     []byte("id"),
+		S3SecretAccessKey: []byte("secret"),
+		S3Region:          []byte("us-east-1"),
+	}, "")
+	ctx := context.Background()
+	b, err := OpenBucket(ctx, "s3://dr-bucket?prefix=prod/&region=us-east-1&endpoint="+srv.URL+"&disableSSL=true&s3ForcePathStyle=true", secret)
+	require.Nil(t, err)
+	defer b.Close()
+
+	_, err = b.Attributes(ctx, "2022-07-28-19-00-55/uuid.tar.gz")
+	require.Error(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, "requester", payer)
+	require.Equal(t, "/dr-bucket/prod/2022-07-28-19-00-55/uuid.tar.gz", path)
+}
+
+func TestUserProjectTransport(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &userProjectTransport{base: http.DefaultTransport, project: "billing"}}
+	resp, err := client.Get(srv.URL + "/storage/v1/b/dr-bucket/o?alt=json")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "alt=json&userProject=billing", query)
+}
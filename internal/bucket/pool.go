@@ -0,0 +1,173 @@
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// Pool shares open bucket handles between concurrent operations. Opening a bucket authenticates
+// against the provider, reusing the handle of the same bucket URL and credentials saves the round
+// trips for bursts of small operations. Handles nobody uses for the idle timeout are closed.
+// A nil Pool opens a new handle for every operation and closes it on release.
+type Pool struct {
+	idle time.Duration
+	open func(ctx context.Context, bucketURL string, secretData map[string][]byte) (*blob.Bucket, error)
+
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+	closed  bool
+}
+
+type poolEntry struct {
+	b    *blob.Bucket
+	refs int
+	// timer closes the handle once it was idle for the timeout, it only runs without refs
+	timer *time.Timer
+	// ready is closed once the handle is opened, err is set if opening failed
+	ready chan struct{}
+	err   error
+}
+
+// NewPool returns a pool that closes handles after they were idle for the timeout, a timeout of 0
+// returns nil, i.e. no pooling
+func NewPool(idle time.Duration) *Pool {
+	if idle <= 0 {
+		return nil
+	}
+	return &Pool{idle: idle, open: OpenBucket, entries: make(map[string]*poolEntry)}
+}
+
+// Open returns the shared handle of the bucket with the credentials of secretData and the function
+// releasing it. The handle must not be closed by the caller. It is opened without the deadline of
+// ctx, a pooled handle outlives the operation it was opened for.
+func (p *Pool) Open(ctx context.Context, bucketURL string, secretData map[string][]byte) (*blob.Bucket, func(), error) {
+	if p == nil {
+		b, err := OpenBucket(ctx, bucketURL, secretData)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, func() { b.Close() }, nil
+	}
+
+	key := poolKey(bucketURL, secretData)
+	p.mu.Lock()
+	e, ok := p.entries[key]
+	if !ok {
+		e = &poolEntry{ready: make(chan struct{})}
+		if !p.closed {
+			p.entries[key] = e
+		}
+	}
+	e.refs++
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		// concurrent operations on the same bucket wait for the first one to open it
+		e.b, e.err = p.open(context.Background(), bucketURL, secretData)
+		close(e.ready)
+	}
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		p.release(key, e)
+		return nil, nil, ctx.Err()
+	}
+	if e.err != nil {
+		p.release(key, e)
+		return nil, nil, e.err
+	}
+
+	var once sync.Once
+	return e.b, func() { once.Do(func() { p.release(key, e) }) }, nil
+}
+
+// release drops a reference to the entry, failed entries are removed right away so the next
+// operation retries to open the bucket
+func (p *Pool) release(key string, e *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.refs--
+	if e.refs > 0 {
+		return
+	}
+	if e.err != nil || p.closed || p.entries[key] != e {
+		p.remove(key, e)
+		return
+	}
+	e.timer = time.AfterFunc(p.idle, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if e.refs == 0 && p.entries[key] == e {
+			p.remove(key, e)
+		}
+	})
+}
+
+// remove closes the handle of the entry, the caller holds the lock
+func (p *Pool) remove(key string, e *poolEntry) {
+	if p.entries[key] == e {
+		delete(p.entries, key)
+	}
+	if e.b != nil {
+		e.b.Close()
+		e.b = nil
+	}
+}
+
+// Len returns the number of open or opening handles
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.entries)
+}
+
+// Close closes the idle handles, handles in use are closed when they are released
+func (p *Pool) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for key, e := range p.entries {
+		if e.refs > 0 {
+			delete(p.entries, key)
+			continue
+		}
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		p.remove(key, e)
+	}
+}
+
+// poolKey identifies a bucket URL opened with the credentials, the credentials are hashed so a
+// rotated secret opens a new handle
+func poolKey(bucketURL string, secretData map[string][]byte) string {
+	names := make([]string, 0, len(secretData))
+	for k := range secretData {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, k := range names {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write(secretData[k])
+		h.Write([]byte{0})
+	}
+	return bucketURL + "#" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,152 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+// countingPool returns a pool opening memory buckets that counts the opened handles
+func countingPool(idle time.Duration, opened *atomic.Int64) *Pool {
+	p := NewPool(idle)
+	p.open = func(context.Context, string, map[string][]byte) (*blob.Bucket, error) {
+		opened.Add(1)
+		return memblob.OpenBucket(nil), nil
+	}
+	return p
+}
+
+func TestPoolReusesHandles(t *testing.T) {
+	ctx := context.Background()
+	var opened atomic.Int64
+	p := countingPool(time.Minute, &opened)
+	defer p.Close()
+
+	creds := map[string][]byte{"key": []byte("a")}
+	b1, release1, err := p.Open(ctx, "s3://bucket", creds)
+	require.Nil(t, err)
+	b2, release2, err := p.Open(ctx, "s3://bucket", map[string][]byte{"key": []byte("a")})
+	require.Nil(t, err)
+	require.Same(t, b1, b2)
+	release1()
+	release2()
+
+	b3, release3, err := p.Open(ctx, "s3://bucket", creds)
+	require.Nil(t, err)
+	require.Same(t, b1, b3, "an idle handle is reused")
+	release3()
+	require.Equal(t, int64(1), opened.Load())
+
+	// other credentials or buckets get their own handles
+	_, release4, err := p.Open(ctx, "s3://bucket", map[string][]byte{"key": []byte("rotated")})
+	require.Nil(t, err)
+	_, release5, err := p.Open(ctx, "s3://other", creds)
+	require.Nil(t, err)
+	release4()
+	release5()
+	require.Equal(t, int64(3), opened.Load())
+	require.Equal(t, 3, p.Len())
+}
+
+func TestPoolConcurrentOpen(t *testing.T) {
+	var opened atomic.Int64
+	p := countingPool(time.Minute, &opened)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, release, err := p.Open(context.Background(), "gs://bucket", nil)
+			if err == nil {
+				err = b.WriteAll(context.Background(), "key", []byte("data"), nil)
+				release()
+			}
+			require.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), opened.Load())
+}
+
+func TestPoolIdleEviction(t *testing.T) {
+	var opened atomic.Int64
+	p := countingPool(20*time.Millisecond, &opened)
+	defer p.Close()
+
+	b, release, err := p.Open(context.Background(), "s3://bucket", nil)
+	require.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, p.Len(), "handles in use are not evicted")
+
+	release()
+	release()
+	require.Eventually(t, func() bool { return p.Len() == 0 }, 5*time.Second, 10*time.Millisecond)
+	_, err = b.ReadAll(context.Background(), "key")
+	require.NotNil(t, err, "the evicted handle is closed")
+
+	_, release, err = p.Open(context.Background(), "s3://bucket", nil)
+	require.Nil(t, err)
+	release()
+	require.Equal(t, int64(2), opened.Load())
+}
+
+func TestPoolOpenError(t *testing.T) {
+	p := NewPool(time.Minute)
+	defer p.Close()
+	fail := true
+	p.open = func(context.Context, string, map[string][]byte) (*blob.Bucket, error) {
+		if fail {
+			return nil, errors.New("invalid credentials")
+		}
+		return memblob.OpenBucket(nil), nil
+	}
+
+	_, _, err := p.Open(context.Background(), "s3://bucket", nil)
+	require.NotNil(t, err)
+	require.Equal(t, 0, p.Len(), "failed handles are not pooled")
+
+	fail = false
+	_, release, err := p.Open(context.Background(), "s3://bucket", nil)
+	require.Nil(t, err)
+	release()
+}
+
+func TestPoolClose(t *testing.T) {
+	var opened atomic.Int64
+	p := countingPool(time.Minute, &opened)
+
+	idle, release, err := p.Open(context.Background(), "s3://idle", nil)
+	require.Nil(t, err)
+	release()
+	used, releaseUsed, err := p.Open(context.Background(), "s3://used", nil)
+	require.Nil(t, err)
+
+	p.Close()
+	require.Equal(t, 0, p.Len())
+	_, err = idle.ReadAll(context.Background(), "key")
+	require.NotNil(t, err)
+	require.Nil(t, used.WriteAll(context.Background(), "key", []byte("data"), nil), "handles in use stay open")
+	releaseUsed()
+	_, err = used.ReadAll(context.Background(), "key")
+	require.NotNil(t, err)
+}
+
+func TestNilPool(t *testing.T) {
+	p := NewPool(0)
+	require.Nil(t, p)
+	b, release, err := p.Open(context.Background(), "mem://", nil)
+	require.Nil(t, err)
+	require.Nil(t, b.WriteAll(context.Background(), "key", []byte("data"), nil))
+	release()
+	require.Equal(t, 0, p.Len())
+	p.Close()
+}
@@ -0,0 +1,148 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gocloud.dev/gcerrors"
+
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+var retryLog = logger.New().Named("bucket_retry")
+
+// Retry is the policy for transient errors of bucket operations, e.g. throttling or a DNS blip
+type Retry struct {
+	// Attempts is the maximum number of attempts, less than 2 disables retries
+	Attempts int
+	// Backoff is the delay before the first retry, it doubles with every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomizes the delays by up to this fraction, so that members do not retry in lockstep
+	Jitter float64
+	// Retried counts the retries of all operations if set
+	Retried *atomic.Int64
+}
+
+// Transient returns true for errors another attempt can fix. Missing objects, denied access and
+// invalid requests fail the same way again.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || err == io.EOF {
+		return false
+	}
+	switch gcerrors.Code(err) {
+	case gcerrors.NotFound, gcerrors.PermissionDenied, gcerrors.InvalidArgument, gcerrors.FailedPrecondition,
+		gcerrors.AlreadyExists, gcerrors.Unimplemented, gcerrors.Canceled:
+		return false
+	}
+	return true
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient or runs out of attempts
+func (r Retry) Do(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !Transient(err) || attempt >= r.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		if r.Retried != nil {
+			r.Retried.Add(1)
+		}
+		d := r.delay(attempt)
+		retryLog.Warn(op+" failed, retrying: "+err.Error(), zap.Int("attempt", attempt), zap.Duration("backoff", d))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+// delay returns the backoff before the retry following the given attempt
+func (r Retry) delay(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if r.Jitter > 0 {
+		d += time.Duration(float64(d) * r.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// NewRetryReader opens a stream with open and reopens it at the current offset if a read fails
+// with a transient error, so that a long download does not start over after a network blip.
+// The reader has the Size of the first stream if it reports one.
+func (r Retry) NewRetryReader(ctx context.Context, op string, open func(offset int64) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	rr := &retryReader{ctx: ctx, retry: r, op: op, open: open}
+	err := r.Do(ctx, op, func() error {
+		var err error
+		rr.cur, err = open(0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := rr.cur.(interface{ Size() int64 }); ok {
+		rr.size = s.Size()
+	}
+	return rr, nil
+}
+
+type retryReader struct {
+	ctx    context.Context
+	retry  Retry
+	op     string
+	open   func(offset int64) (io.ReadCloser, error)
+	cur    io.ReadCloser
+	offset int64
+	size   int64
+}
+
+func (rr *retryReader) Size() int64 { return rr.size }
+
+func (rr *retryReader) Read(p []byte) (int, error) {
+	var n int
+	var readErr error
+	err := rr.retry.Do(rr.ctx, rr.op, func() error {
+		if rr.cur == nil {
+			cur, err := rr.open(rr.offset)
+			if err != nil {
+				return err
+			}
+			rr.cur = cur
+		}
+		n, readErr = rr.cur.Read(p)
+		rr.offset += int64(n)
+		if Transient(readErr) {
+			// the stream broke, it is reopened at the offset by the next attempt or read
+			rr.cur.Close()
+			rr.cur = nil
+			if n == 0 {
+				return readErr
+			}
+			readErr = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, readErr
+}
+
+func (rr *retryReader) Close() error {
+	if rr.cur == nil {
+		return nil
+	}
+	return rr.cur.Close()
+}
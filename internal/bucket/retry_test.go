@@ -0,0 +1,118 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+var errThrottled = errors.New("SlowDown: please reduce your request rate")
+
+func TestRetryDo(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	_, notFound := bucket.ReadAll(ctx, "missing")
+	require.NotNil(t, notFound)
+
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		wantCalls   int
+		wantRetried int64
+		wantErr     bool
+	}{
+		{"success", 0, nil, 1, 0, false},
+		{"transient", 2, errThrottled, 3, 2, false},
+		{"out of attempts", 5, errThrottled, 3, 2, true},
+		{"not found", 5, notFound, 1, 0, true},
+		{"canceled", 5, context.Canceled, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retried atomic.Int64
+			r := Retry{Attempts: 3, Backoff: time.Millisecond, Retried: &retried}
+			var calls int
+			err := r.Do(ctx, "test", func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.wantCalls, calls)
+			require.Equal(t, tt.wantRetried, retried.Load())
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := Retry{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, time.Second, r.delay(1))
+	require.Equal(t, 2*time.Second, r.delay(2))
+	require.Equal(t, 4*time.Second, r.delay(3))
+	require.Equal(t, 5*time.Second, r.delay(4))
+	require.Equal(t, 5*time.Second, r.delay(100))
+
+	r.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := r.delay(2)
+		require.GreaterOrEqual(t, d, time.Second)
+		require.LessOrEqual(t, d, 3*time.Second)
+	}
+}
+
+// flakyReader fails with a transient error after every n bytes
+type flakyReader struct {
+	r    io.Reader
+	n, m int
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.m >= f.n {
+		return 0, errThrottled
+	}
+	if len(p) > f.n-f.m {
+		p = p[:f.n-f.m]
+	}
+	k, err := f.r.Read(p)
+	f.m += k
+	return k, err
+}
+
+func (f *flakyReader) Close() error { return nil }
+
+func TestRetryReader(t *testing.T) {
+	content := bytes.Repeat([]byte("hazelcast"), 1000)
+	var offsets []int64
+	open := func(offset int64) (io.ReadCloser, error) {
+		offsets = append(offsets, offset)
+		return &flakyReader{r: bytes.NewReader(content[offset:]), n: 4000}, nil
+	}
+
+	r, err := Retry{Attempts: 2, Backoff: time.Millisecond}.NewRetryReader(context.Background(), "test", open)
+	require.Nil(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, content, got)
+	require.Equal(t, []int64{0, 4000, 8000}, offsets)
+
+	// a stream that keeps failing without progress runs out of attempts
+	broken := func(offset int64) (io.ReadCloser, error) {
+		return &flakyReader{r: bytes.NewReader(content), n: 0}, nil
+	}
+	r, err = Retry{Attempts: 2, Backoff: time.Millisecond}.NewRetryReader(context.Background(), "test", broken)
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, errThrottled)
+}
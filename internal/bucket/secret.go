@@ -0,0 +1,83 @@
+package bucket
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/local"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+// Sources of the bucket credentials when the service account may not read the secret
+const (
+	SecretFallbackNone    = "none"
+	SecretFallbackMounted = "mounted"
+	SecretFallbackAmbient = "ambient"
+)
+
+// AmbientCredentials is a secret entry that is true to use the credentials of the environment instead
+// of the keys in the secret, e.g. an instance profile, IRSA or GKE workload identity
+const AmbientCredentials = "ambient-credentials"
+
+// SecretFallback is used for clusters whose RBAC does not let the agent read secrets yet
+type SecretFallback struct {
+	Mode     string `envconfig:"BUCKET_SECRET_FALLBACK" default:"none" desc:"credentials used if reading the secret is forbidden: none, mounted or ambient"`
+	MountDir string `envconfig:"BUCKET_SECRET_MOUNT_DIR" default:"/etc/hazelcast/secrets" desc:"directory of the mounted secrets for the mounted fallback, one folder per secret name"`
+}
+
+var secretFallback, secretFallbackErr = loadSecretFallback()
+
+func loadSecretFallback() (SecretFallback, error) {
+	var c SecretFallback
+	if err := envconfig.Process("bucket", &c); err != nil {
+		return SecretFallback{Mode: SecretFallbackNone}, err
+	}
+	return c, c.validate()
+}
+
+func (c SecretFallback) validate() error {
+	switch c.Mode {
+	case SecretFallbackNone, SecretFallbackMounted, SecretFallbackAmbient:
+		return nil
+	default:
+		return fmt.Errorf("invalid BUCKET_SECRET_FALLBACK %q: must be %s, %s or %s", c.Mode, SecretFallbackNone, SecretFallbackMounted, SecretFallbackAmbient)
+	}
+}
+
+var secretLog = logger.New().Named("bucket_secret")
+
+// fallbackSecretData returns the credentials of the fallback for the secret that could not be read
+// because of err, or err if there is no fallback
+func (c SecretFallback) fallbackSecretData(name string, err error) (map[string][]byte, error) {
+	switch c.Mode {
+	case SecretFallbackMounted:
+		dir := filepath.Join(c.MountDir, name)
+		data, rerr := local.ReadSecretDir(dir)
+		if rerr != nil {
+			return nil, fmt.Errorf("%w, and the mounted secret cannot be read: %v", err, rerr)
+		}
+		secretLog.Warn("reading secret is forbidden, using the mounted secret instead, grant get on secrets to the service account: "+err.Error(), zap.String("dir", dir))
+		return data, nil
+	case SecretFallbackAmbient:
+		secretLog.Warn("reading secret is forbidden, using the credentials of the environment instead, grant get on secrets to the service account: " + err.Error())
+		return map[string][]byte{AmbientCredentials: []byte("true")}, nil
+	default:
+		return nil, err
+	}
+}
+
+func ambientCredentials(secret map[string][]byte) (bool, error) {
+	v, ok := secret[AmbientCredentials]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(string(v))
+	if err != nil {
+		return false, fmt.Errorf("invalid secret: %s must be true or false", AmbientCredentials)
+	}
+	return b, nil
+}
@@ -0,0 +1,60 @@
+package bucket
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFallbackSecretData(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "aws", nil)
+
+	dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "aws"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "aws", S3AccessKeyID), []byte("id"), 0600))
+
+	data, err := SecretFallback{Mode: SecretFallbackMounted, MountDir: dir}.fallbackSecretData("aws", forbidden)
+	require.Nil(t, err)
+	require.Equal(t, "id", string(data[S3AccessKeyID]))
+
+	// a missing mount keeps the forbidden error
+	_, err = SecretFallback{Mode: SecretFallbackMounted, MountDir: dir}.fallbackSecretData("gcp", forbidden)
+	require.True(t, apierrors.IsForbidden(err))
+
+	data, err = SecretFallback{Mode: SecretFallbackAmbient}.fallbackSecretData("aws", forbidden)
+	require.Nil(t, err)
+	ambient, err := ambientCredentials(data)
+	require.Nil(t, err)
+	require.True(t, ambient)
+
+	_, err = SecretFallback{Mode: SecretFallbackNone}.fallbackSecretData("aws", forbidden)
+	require.Equal(t, forbidden, err)
+}
+
+func TestAmbientCredentials(t *testing.T) {
+	ambient, err := ambientCredentials(map[string][]byte{S3AccessKeyID: []byte("id")})
+	require.Nil(t, err)
+	require.False(t, ambient)
+	_, err = ambientCredentials(map[string][]byte{AmbientCredentials: []byte("maybe")})
+	require.Error(t, err)
+
+	// Azure needs the storage key from the secret
+	_, err = openAZURE(context.Background(), "azblob://backups", map[string][]byte{AmbientCredentials: []byte("true")})
+	require.ErrorContains(t, err, "not supported for Azure")
+}
+
+func TestSecretFallbackValidate(t *testing.T) {
+	for _, mode := range []string{SecretFallbackNone, SecretFallbackMounted, SecretFallbackAmbient} {
+		require.Nil(t, SecretFallback{Mode: mode}.validate())
+	}
+	require.ErrorContains(t, SecretFallback{Mode: "mountd"}.validate(), "invalid BUCKET_SECRET_FALLBACK")
+
+	t.Setenv("BUCKET_SECRET_FALLBACK", "Mounted")
+	_, err := loadSecretFallback()
+	require.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// sizeUnits are the suffixes of ParseSize and ParseBandwidth, longer ones first
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"ki", 1 << 10}, {"mi", 1 << 20}, {"gi", 1 << 30}, {"ti", 1 << 40},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseSize parses a number of bytes, e.g. 10GiB, 500MB or 1048576, an empty string or 0 means no limit
+func ParseSize(s string) (int64, error) {
+	n, ok := parseBytes(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 10GiB", s)
+	}
+	return n, nil
+}
+
+// ParseBandwidth parses a bandwidth in bytes per second, e.g. 50MiB, 100MB/s or 1048576, an
+// empty string or 0 means unlimited
+func ParseBandwidth(s string) (int64, error) {
+	n, ok := parseBytes(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s"))
+	if !ok {
+		return 0, fmt.Errorf("invalid bandwidth %q, expected e.g. 50MiB", s)
+	}
+	return n, nil
+}
+
+func parseBytes(s string) (int64, bool) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if v == "" {
+		return 0, true
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int64(n * float64(unit)), true
+}
+
+// maxThrottleBurst bounds the bytes a throttled reader returns at once, so that parallel readers
+// take turns instead of waiting for large chunks
+const maxThrottleBurst = 256 << 10
+
+// Throttle limits the bytes per second read through all of its readers, a nil Throttle does not limit
+type Throttle struct {
+	limiter *rate.Limiter
+}
+
+// NewThrottle returns a throttle for the bandwidth in bytes per second, nil if it is not positive
+func NewThrottle(bytesPerSecond int64) *Throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst > maxThrottleBurst {
+		burst = maxThrottleBurst
+	}
+	return &Throttle{limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))}
+}
+
+// Reader returns r limited by the throttle, the wait for the bandwidth ends once ctx is done
+func (t *Throttle) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: t.limiter}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if len(b) > t.limiter.Burst() {
+		b = b[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(b)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
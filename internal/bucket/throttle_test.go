@@ -0,0 +1,72 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1048576", 1 << 20, false},
+		{"50MiB", 50 << 20, false},
+		{"50Mi", 50 << 20, false},
+		{"100MB/s", 100e6, false},
+		{"1.5GiB", 3 << 29, false},
+		{"512 KiB", 512 << 10, false},
+		{"fast", 0, true},
+		{"-1MiB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBandwidth(tt.in)
+		require.Equal(t, tt.wantErr, err != nil, tt.in)
+		require.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	n, err := ParseSize("2TiB")
+	require.Nil(t, err)
+	require.Equal(t, int64(2<<40), n)
+	n, err = ParseSize("")
+	require.Nil(t, err)
+	require.Zero(t, n)
+	// only bandwidths are per second
+	_, err = ParseSize("10GiB/s")
+	require.EqualError(t, err, `invalid size "10GiB/s", expected e.g. 10GiB`)
+}
+
+func TestThrottle(t *testing.T) {
+	require.Nil(t, NewThrottle(0))
+	r := bytes.NewReader(nil)
+	require.Equal(t, io.Reader(r), (*Throttle)(nil).Reader(context.Background(), r))
+
+	// two readers share 100KiB/s, after the initial burst of 100KiB the rest takes about a second
+	th := NewThrottle(100 << 10)
+	start := time.Now()
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := io.Copy(io.Discard, th.Reader(context.Background(), bytes.NewReader(make([]byte, 100<<10))))
+			done <- err
+		}()
+	}
+	require.Nil(t, <-done)
+	require.Nil(t, <-done)
+	require.Greater(t, time.Since(start), 800*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := io.Copy(io.Discard, th.Reader(ctx, bytes.NewReader(make([]byte, 1<<20))))
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,112 @@
+package bucket
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+const (
+	minReadBufferSize  = 256 << 10
+	maxReadBufferSize  = 16 << 20
+	minWriteBufferSize = 5 << 20 // smallest S3 multipart upload part
+	maxWriteBufferSize = 64 << 20
+	maxConcurrency     = 16
+
+	// assumed throughput per stream, used for the bandwidth-delay product
+	assumedBandwidth = 100 << 20
+
+	// S3 allows at most 10000 parts per upload, stay well below the limit
+	targetParts = 1000
+
+	// chunks buffered between two pipeline stages, enough to hide latency spikes of a single stage
+	defaultPipelineDepth = 4
+)
+
+// Tuning holds the transfer knobs, zero values are tuned automatically
+type Tuning struct {
+	ReadBufferSize  int `envconfig:"BUCKET_READ_BUFFER_SIZE" desc:"read buffer size in bytes"`
+	WriteBufferSize int `envconfig:"BUCKET_WRITE_BUFFER_SIZE" desc:"write buffer size in bytes"`
+	Concurrency     int `envconfig:"BUCKET_CONCURRENCY" desc:"number of parallel transfers"`
+	PipelineDepth   int `envconfig:"BUCKET_PIPELINE_DEPTH" desc:"number of chunks buffered between the download, decompress and write stages of a restore"`
+}
+
+var tuning = loadTuning()
+
+func loadTuning() Tuning {
+	var t Tuning
+	if err := envconfig.Process("bucket", &t); err != nil {
+		// invalid overrides fall back to auto-tuning
+		return Tuning{}
+	}
+	return t
+}
+
+// ReadBufferSize returns the read buffer size for an object of the given size, 0 if unknown,
+// based on the latency of the first read
+func ReadBufferSize(objectSize int64, latency time.Duration) int {
+	if tuning.ReadBufferSize > 0 {
+		return tuning.ReadBufferSize
+	}
+	return readBufferSize(objectSize, latency)
+}
+
+func readBufferSize(objectSize int64, latency time.Duration) int {
+	size := clamp(int64(latency.Seconds()*assumedBandwidth), minReadBufferSize, maxReadBufferSize)
+
+	// no need for a buffer larger than the object
+	if objectSize > 0 && objectSize < size {
+		size = clamp(objectSize, 4<<10, size)
+	}
+	return int(size)
+}
+
+// WriteBufferSize returns the write buffer size for an object of the expected size, 0 means driver default
+func WriteBufferSize(expectedSize int64) int {
+	if tuning.WriteBufferSize > 0 {
+		return tuning.WriteBufferSize
+	}
+	return writeBufferSize(expectedSize)
+}
+
+func writeBufferSize(expectedSize int64) int {
+	if expectedSize <= 0 {
+		return 0
+	}
+	return int(clamp(expectedSize/targetParts, minWriteBufferSize, maxWriteBufferSize))
+}
+
+// Concurrency returns the number of parallel transfers for the given number of objects,
+// higher latency storage gets more parallel requests
+func Concurrency(objectCount int, latency time.Duration) int {
+	if tuning.Concurrency > 0 {
+		return tuning.Concurrency
+	}
+	return concurrency(objectCount, latency)
+}
+
+func concurrency(objectCount int, latency time.Duration) int {
+	c := int(clamp(int64(latency/(10*time.Millisecond)), 1, maxConcurrency))
+	if objectCount > 0 && objectCount < c {
+		c = objectCount
+	}
+	return c
+}
+
+// PipelineDepth returns the number of chunks buffered between two stages of a transfer pipeline
+func PipelineDepth() int {
+	if tuning.PipelineDepth > 0 {
+		return tuning.PipelineDepth
+	}
+	return defaultPipelineDepth
+}
+
+func clamp(v, min, max int64) int64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
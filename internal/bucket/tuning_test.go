@@ -0,0 +1,65 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBufferSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectSize int64
+		latency    time.Duration
+		want       int
+	}{
+		{"low latency", 0, time.Millisecond, minReadBufferSize},
+		{"cross region", 0, 80 * time.Millisecond, 8 << 20},
+		{"very high latency", 0, 2 * time.Second, maxReadBufferSize},
+		{"small object", 100 << 10, 80 * time.Millisecond, 100 << 10},
+		{"tiny object", 10, 80 * time.Millisecond, 4 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, readBufferSize(tt.objectSize, tt.latency))
+		})
+	}
+}
+
+func TestWriteBufferSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		want int
+	}{
+		{"unknown", 0, 0},
+		{"small", 1 << 20, minWriteBufferSize},
+		{"large", 20 << 30, 20 << 30 / targetParts},
+		{"huge", 1 << 40, maxWriteBufferSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, writeBufferSize(tt.size))
+		})
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects int
+		latency time.Duration
+		want    int
+	}{
+		{"local", 100, time.Millisecond, 1},
+		{"remote", 100, 50 * time.Millisecond, 5},
+		{"far away", 100, time.Second, maxConcurrency},
+		{"few objects", 2, time.Second, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, concurrency(tt.objects, tt.latency))
+		})
+	}
+}
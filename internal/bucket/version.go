@@ -0,0 +1,42 @@
+package bucket
+
+import (
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gocloud.dev/blob"
+)
+
+// VersionOptions returns reader options that read the given version of an object in a bucket with
+// versioning enabled, nil reads the latest version. Versions are S3 version IDs, GCS generations
+// and Azure version IDs, other drivers ignore them.
+func VersionOptions(version string) *blob.ReaderOptions {
+	if version == "" {
+		return nil
+	}
+	return &blob.ReaderOptions{BeforeRead: func(as func(interface{}) bool) error {
+		var in *s3.GetObjectInput
+		if as(&in) {
+			in.VersionId = aws.String(version)
+			return nil
+		}
+		var obj **storage.ObjectHandle
+		if as(&obj) {
+			gen, err := strconv.ParseInt(version, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid GCS object generation %q", version)
+			}
+			*obj = (*obj).Generation(gen)
+			return nil
+		}
+		var u *azblob.BlockBlobURL
+		if as(&u) {
+			*u = u.WithVersionID(version)
+		}
+		return nil
+	}}
+}
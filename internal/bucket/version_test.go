@@ -0,0 +1,46 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestVersionOptions(t *testing.T) {
+	require.Nil(t, VersionOptions(""))
+
+	// the drivers expose their native request types through the as function
+	in := &s3.GetObjectInput{}
+	require.Nil(t, VersionOptions("3sL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY").BeforeRead(func(i interface{}) bool {
+		p, ok := i.(**s3.GetObjectInput)
+		if ok {
+			*p = in
+		}
+		return ok
+	}))
+	require.Equal(t, "3sL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY", *in.VersionId)
+
+	obj := &storage.ObjectHandle{}
+	gcs := func(i interface{}) bool {
+		p, ok := i.(***storage.ObjectHandle)
+		if ok {
+			*p = &obj
+		}
+		return ok
+	}
+	require.Nil(t, VersionOptions("1655078400000000").BeforeRead(gcs))
+	require.NotNil(t, VersionOptions("not-a-generation").BeforeRead(gcs))
+
+	// other drivers read the latest version
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	require.Nil(t, b.WriteAll(ctx, "a.tar.gz", []byte("latest"), nil))
+	r, err := b.NewReader(ctx, "a.tar.gz", VersionOptions("1"))
+	require.Nil(t, err)
+	r.Close()
+}
@@ -0,0 +1,98 @@
+// Package cgroup reads the resource usage of the container the agent runs in.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Root is the mount point of the cgroup file system in a container
+const Root = "/sys/fs/cgroup"
+
+// ErrNoLimit is returned if the cgroup has no memory limit
+var ErrNoLimit = errors.New("no cgroup memory limit")
+
+// cgroup v1 reports an unlimited cgroup with the largest page aligned int64
+const v1Unlimited = 1 << 62
+
+// Memory is the memory limit of the cgroup and its page cache that is not on disk yet
+type Memory struct {
+	Limit     uint64
+	Dirty     uint64
+	Writeback uint64
+}
+
+// Pending returns the bytes of the page cache that still have to be written to disk
+func (m Memory) Pending() uint64 {
+	return m.Dirty + m.Writeback
+}
+
+// ReadMemory reads the memory of the cgroup mounted at root, cgroup v2 is tried before v1.
+// ErrNoLimit is returned for cgroups without a memory limit.
+func ReadMemory(root string) (Memory, error) {
+	if limit, err := os.ReadFile(filepath.Join(root, "memory.max")); err == nil {
+		s := strings.TrimSpace(string(limit))
+		if s == "max" {
+			return Memory{}, ErrNoLimit
+		}
+		m := Memory{}
+		if m.Limit, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return Memory{}, err
+		}
+		stat, err := readStat(filepath.Join(root, "memory.stat"))
+		if err != nil {
+			return Memory{}, err
+		}
+		m.Dirty, m.Writeback = stat["file_dirty"], stat["file_writeback"]
+		return m, nil
+	}
+
+	v1 := filepath.Join(root, "memory")
+	limit, err := os.ReadFile(filepath.Join(v1, "memory.limit_in_bytes"))
+	if err != nil {
+		return Memory{}, err
+	}
+	m := Memory{}
+	if m.Limit, err = strconv.ParseUint(strings.TrimSpace(string(limit)), 10, 64); err != nil {
+		return Memory{}, err
+	}
+	if m.Limit >= v1Unlimited {
+		return Memory{}, ErrNoLimit
+	}
+	stat, err := readStat(filepath.Join(v1, "memory.stat"))
+	if err != nil {
+		return Memory{}, err
+	}
+	// the total_ counters include child cgroups
+	m.Dirty, m.Writeback = stat["total_dirty"], stat["total_writeback"]
+	if _, ok := stat["total_dirty"]; !ok {
+		m.Dirty, m.Writeback = stat["dirty"], stat["writeback"]
+	}
+	return m, nil
+}
+
+// readStat parses the "<name> <value>" lines of a memory.stat file
+func readStat(name string) (map[string]uint64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat := make(map[string]uint64)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			stat[key] = v
+		}
+	}
+	return stat, s.Err()
+}
@@ -0,0 +1,74 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    Memory
+		wantErr error
+	}{
+		{
+			"v2",
+			map[string]string{
+				"memory.max":  "268435456\n",
+				"memory.stat": "anon 1000\nfile 5000\nfile_dirty 4096\nfile_writeback 8192\n",
+			},
+			Memory{Limit: 268435456, Dirty: 4096, Writeback: 8192}, nil,
+		},
+		{
+			"v2 unlimited",
+			map[string]string{"memory.max": "max\n", "memory.stat": "file_dirty 4096\n"},
+			Memory{}, ErrNoLimit,
+		},
+		{
+			"v1",
+			map[string]string{
+				"memory/memory.limit_in_bytes": "536870912\n",
+				"memory/memory.stat":           "cache 5000\ndirty 1\nwriteback 2\ntotal_dirty 4096\ntotal_writeback 8192\n",
+			},
+			Memory{Limit: 536870912, Dirty: 4096, Writeback: 8192}, nil,
+		},
+		{
+			"v1 without totals",
+			map[string]string{
+				"memory/memory.limit_in_bytes": "536870912\n",
+				"memory/memory.stat":           "dirty 1\nwriteback 2\n",
+			},
+			Memory{Limit: 536870912, Dirty: 1, Writeback: 2}, nil,
+		},
+		{
+			"v1 unlimited",
+			map[string]string{
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+				"memory/memory.stat":           "dirty 1\n",
+			},
+			Memory{}, ErrNoLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := os.MkdirTemp("", "cgroup")
+			require.Nil(t, err)
+			defer os.RemoveAll(root)
+			for name, content := range tt.files {
+				require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0700))
+				require.Nil(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0600))
+			}
+
+			got, err := ReadMemory(root)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := ReadMemory(filepath.Join(os.TempDir(), "no-cgroup"))
+	require.NotNil(t, err)
+}
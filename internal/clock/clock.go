@@ -0,0 +1,73 @@
+// Package clock is the source of wall clock time for timestamps, lock ages and grace periods.
+// Tests replace it with a Fake to run deterministically. Durations like latencies and timeouts
+// keep measuring real time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	current Clock = realClock{}
+)
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Now returns the current time of the agent clock
+func Now() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.Now()
+}
+
+// Since returns the time elapsed since t on the agent clock
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Set replaces the agent clock, the returned function restores the previous one
+func Set(c Clock) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := current
+	current = c
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		current = prev
+	}
+}
+
+// Fake is a clock that only moves when it is told to
+type Fake struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFake returns a clock frozen at t
+func NewFake(t time.Time) *Fake {
+	return &Fake{t: t}
+}
+
+// Now returns the time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+// Advance moves the fake clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+}
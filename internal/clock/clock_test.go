@@ -0,0 +1,22 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC)
+	f := NewFake(start)
+	restore := Set(f)
+
+	require.Equal(t, start, Now())
+	f.Advance(time.Hour)
+	require.Equal(t, start.Add(time.Hour), Now())
+	require.Equal(t, 2*time.Hour, Since(start.Add(-time.Hour)))
+
+	restore()
+	require.WithinDuration(t, time.Now(), Now(), time.Minute)
+}
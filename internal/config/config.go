@@ -0,0 +1,131 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Strict makes Process fail on unknown agent environment variables and unexpected arguments
+var Strict = strings.EqualFold(os.Getenv("AGENT_STRICT"), "true")
+
+// Prefixes of the environment variables owned by the agent
+var Prefixes = []string{"RESTORE_", "BACKUP_", "UC_BUCKET_", "UC_URL_", "UC_GIT_", "BUCKET_", "VERIFY_", "CATALOG_", "NET_", "NOTIFY_", "TERMINATION_", "LICENSE_"}
+
+var (
+	known = make(map[string]bool)
+	specs []interface{}
+)
+
+// Register adds the environment variables of the envconfig specs to the known variables
+func Register(s ...interface{}) {
+	specs = append(specs, s...)
+	for _, spec := range s {
+		t := reflect.TypeOf(spec)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if name := t.Field(i).Tag.Get("envconfig"); name != "" {
+				known[name] = true
+			}
+		}
+	}
+}
+
+// Specs returns the registered envconfig specs in registration order
+func Specs() []interface{} {
+	return specs
+}
+
+// Process overwrites spec with environment variables, in strict mode unknown agent
+// variables and positional arguments are rejected
+func Process(prefix string, spec interface{}, f *flag.FlagSet) error {
+	if err := envconfig.Process(prefix, spec); err != nil {
+		return err
+	}
+	if !Strict {
+		return nil
+	}
+
+	if f != nil && f.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(f.Args(), " "))
+	}
+	return checkEnv(os.Environ())
+}
+
+func checkEnv(environ []string) error {
+	var unknown []string
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if known[name] || !hasPrefix(name) {
+			continue
+		}
+		msg := name
+		if s := suggest(name); s != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", s)
+		}
+		unknown = append(unknown, msg)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown environment variables: %s", strings.Join(unknown, ", "))
+}
+
+func hasPrefix(name string) bool {
+	for _, p := range Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the known variable closest to name if it is a likely typo
+func suggest(name string) string {
+	best, bestDist := "", 3
+	for k := range known {
+		if d := distance(name, k); d < bestDist || (d == bestDist && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance of a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
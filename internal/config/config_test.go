@@ -0,0 +1,75 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCmd struct {
+	Bucket      string `envconfig:"RESTORE_BUCKET"`
+	Destination string `envconfig:"RESTORE_DESTINATION"`
+	Other       string
+}
+
+func TestCheckEnv(t *testing.T) {
+	Register(&testCmd{})
+
+	tests := []struct {
+		name    string
+		environ []string
+		wantErr string
+	}{
+		{"known", []string{"RESTORE_BUCKET=s3://bucket", "PATH=/bin"}, ""},
+		{"not owned by the agent", []string{"HOME=/root", "RESTOREBUCKET=x"}, ""},
+		{"typo", []string{"RESTORE_BUKET=s3://bucket"}, "RESTORE_BUKET (did you mean RESTORE_BUCKET?)"},
+		{"unknown", []string{"BACKUP_SOMETHING_ELSE=1"}, "BACKUP_SOMETHING_ELSE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEnv(tt.environ)
+			if tt.wantErr == "" {
+				require.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	Register(&testCmd{})
+	defer func(s bool) { Strict = s }(Strict)
+
+	tests := []struct {
+		name    string
+		strict  bool
+		env     map[string]string
+		args    []string
+		wantErr bool
+	}{
+		{"lenient with typo", false, map[string]string{"RESTORE_BUKET": "s3://bucket"}, nil, false},
+		{"strict with typo", true, map[string]string{"RESTORE_BUKET": "s3://bucket"}, nil, true},
+		{"strict with known", true, map[string]string{"RESTORE_BUCKET": "s3://bucket"}, nil, false},
+		{"strict with arguments", true, nil, []string{"-dst", "/data", "extra"}, true},
+		{"lenient with arguments", false, nil, []string{"-dst", "/data", "extra"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			Strict = tt.strict
+
+			var cmd testCmd
+			f := flag.NewFlagSet("test", flag.ContinueOnError)
+			f.StringVar(&cmd.Destination, "dst", "", "")
+			require.Nil(t, f.Parse(tt.args))
+
+			err := Process("restore", &cmd, f)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+		})
+	}
+}
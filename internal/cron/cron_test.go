@@ -0,0 +1,88 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every 5m",
+	} {
+		_, err := Parse(spec)
+		require.NotNil(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	from := time.Date(2022, 6, 13, 10, 17, 30, 0, time.UTC) // a Monday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2022, 6, 13, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, 6, 13, 10, 30, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2022, 6, 13, 10, 20, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2022, 6, 14, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2022, 6, 14, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2022, 6, 13, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2022, 6, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * MON-FRI", time.Date(2022, 6, 13, 10, 30, 0, 0, time.UTC)},
+		{"0 0 * * sat,sun", time.Date(2022, 6, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, 6, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 JAN-MAR *", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// a restricted day of month or day of week is enough
+		{"0 0 20 * FRI", time.Date(2022, 6, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	s, err := Parse("0 2 * * *")
+	require.Nil(t, err)
+	next := s.Next(time.Date(2022, 6, 13, 10, 0, 0, 0, loc))
+	require.Equal(t, time.Date(2022, 6, 14, 2, 0, 0, 0, loc), next)
+	require.Equal(t, loc, next.Location())
+}
+
+func TestPrev(t *testing.T) {
+	s, err := Parse("0 2 * * *")
+	require.Nil(t, err)
+	at := time.Date(2022, 6, 13, 2, 0, 0, 0, time.UTC)
+	require.Equal(t, at, s.Prev(at), "a run time is its own previous run")
+	require.Equal(t, at, s.Prev(at.Add(5*time.Hour)))
+	require.Equal(t, at.AddDate(0, 0, -1), s.Prev(at.Add(-time.Second)))
+
+	s, err = Parse("*/20 9 * 1 MON")
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2022, 1, 31, 9, 40, 0, 0, time.UTC), s.Prev(time.Date(2022, 6, 13, 10, 0, 0, 0, time.UTC)))
+
+	s, err = Parse("0 0 30 2 *")
+	require.Nil(t, err)
+	require.True(t, s.Prev(at).IsZero())
+}
@@ -0,0 +1,156 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Options control retries and timeouts of downloads
+type Options struct {
+	// Retries is the number of extra attempts for a failed download
+	Retries int
+	// Timeout limits a single attempt, 0 means no limit
+	Timeout time.Duration
+	// Backoff is the delay before the first retry, it doubles with every retry
+	Backoff time.Duration
+	// Concurrency limits the parallel downloads, 0 means no limit
+	Concurrency int
+}
+
+// Result is the outcome of downloading a single file
+type Result struct {
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the outcome of downloading all files
+type Report struct {
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Files     []Result `json:"files"`
+}
+
+// Retries returns the number of attempts after the first one of all downloads
+func (r Report) Retries() int {
+	var n int
+	for _, f := range r.Files {
+		if f.Attempts > 1 {
+			n += f.Attempts - 1
+		}
+	}
+	return n
+}
+
+// Err returns an error if any of the downloads failed
+func (r Report) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d downloads failed", r.Failed, r.Failed+r.Succeeded)
+}
+
+// Reject records a file that is not downloaded at all as failed
+func (r *Report) Reject(name string, err error) {
+	r.Failed++
+	r.Files = append(r.Files, Result{Name: name, Error: err.Error()})
+}
+
+// permanentError is not retried
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Permanent marks an error that another attempt can not fix, e.g. a rejected file type
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// WriteFile writes the report as JSON to name
+func (r Report) WriteFile(name string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0600)
+}
+
+// All downloads every file with fn without stopping at the first failure,
+// failed downloads are retried until they succeed or run out of retries
+func All(ctx context.Context, names []string, opts Options, fn func(ctx context.Context, name string) error) Report {
+	results := make([]Result, len(names))
+
+	var g errgroup.Group
+	if opts.Concurrency > 0 {
+		g.SetLimit(opts.Concurrency)
+	}
+	var mu sync.Mutex
+	report := Report{}
+	for i, name := range names {
+		i, name := i, name
+		g.Go(func() error {
+			results[i] = retry(ctx, name, opts, fn)
+			mu.Lock()
+			if results[i].Success {
+				report.Succeeded++
+			} else {
+				report.Failed++
+			}
+			mu.Unlock()
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	report.Files = results
+	return report
+}
+
+func retry(ctx context.Context, name string, opts Options, fn func(ctx context.Context, name string) error) Result {
+	res := Result{Name: name}
+	backoff := opts.Backoff
+	for {
+		res.Attempts++
+		err := attempt(ctx, name, opts.Timeout, fn)
+		if err == nil {
+			res.Success = true
+			res.Error = ""
+			return res
+		}
+		res.Error = err.Error()
+		var p *permanentError
+		if res.Attempts > opts.Retries || ctx.Err() != nil || errors.As(err, &p) {
+			return res
+		}
+
+		select {
+		case <-ctx.Done():
+			return res
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func attempt(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context, name string) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx, name)
+}
@@ -0,0 +1,107 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		failures map[string]int
+		want     []Result
+	}{
+		{
+			"all succeed", 2, nil,
+			[]Result{{Name: "a.jar", Success: true, Attempts: 1}, {Name: "b.jar", Success: true, Attempts: 1}},
+		},
+		{
+			"retry succeeds", 2, map[string]int{"a.jar": 2},
+			[]Result{{Name: "a.jar", Success: true, Attempts: 3}, {Name: "b.jar", Success: true, Attempts: 1}},
+		},
+		{
+			"out of retries", 1, map[string]int{"a.jar": 5},
+			[]Result{{Name: "a.jar", Attempts: 2, Error: "unavailable"}, {Name: "b.jar", Success: true, Attempts: 1}},
+		},
+		{
+			"no retries", 0, map[string]int{"a.jar": 1, "b.jar": 1},
+			[]Result{{Name: "a.jar", Attempts: 1, Error: "unavailable"}, {Name: "b.jar", Attempts: 1, Error: "unavailable"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := map[string]int{}
+			report := All(context.Background(), []string{"a.jar", "b.jar"}, Options{Retries: tt.retries}, func(_ context.Context, name string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[name]++
+				if calls[name] <= tt.failures[name] {
+					return errors.New("unavailable")
+				}
+				return nil
+			})
+			require.Equal(t, tt.want, report.Files)
+
+			var retries int
+			for _, r := range tt.want {
+				retries += r.Attempts - 1
+			}
+			require.Equal(t, retries, report.Retries())
+
+			var failed int
+			for _, r := range tt.want {
+				if !r.Success {
+					failed++
+				}
+			}
+			require.Equal(t, failed, report.Failed)
+			require.Equal(t, len(tt.want)-failed, report.Succeeded)
+			require.Equal(t, failed > 0, report.Err() != nil)
+		})
+	}
+}
+
+func TestAllTimeout(t *testing.T) {
+	report := All(context.Background(), []string{"slow.jar"}, Options{Retries: 1, Timeout: 10 * time.Millisecond}, func(ctx context.Context, _ string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Equal(t, []Result{{Name: "slow.jar", Attempts: 2, Error: context.DeadlineExceeded.Error()}}, report.Files)
+}
+
+func TestReportWriteFile(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "download_report")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	report := Report{Succeeded: 1, Failed: 1, Files: []Result{
+		{Name: "a.jar", Success: true, Attempts: 1},
+		{Name: "b.jar", Attempts: 3, Error: "status code is 404"},
+	}}
+	name := path.Join(tmpdir, "report.json")
+	require.Nil(t, report.WriteFile(name))
+
+	data, err := os.ReadFile(name)
+	require.Nil(t, err)
+	var got Report
+	require.Nil(t, json.Unmarshal(data, &got))
+	require.Equal(t, report, got)
+	require.EqualError(t, report.Err(), "1 of 2 downloads failed")
+}
+
+func TestAllPermanent(t *testing.T) {
+	report := All(context.Background(), []string{"run.sh"}, Options{Retries: 3}, func(context.Context, string) error {
+		return Permanent(errors.New("file type is not allowed"))
+	})
+	require.Equal(t, []Result{{Name: "run.sh", Attempts: 1, Error: "file type is not allowed"}}, report.Files)
+}
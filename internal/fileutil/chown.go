@@ -0,0 +1,33 @@
+package fileutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseChown parses the numeric uid:gid, uid or :gid of the option, missing IDs are -1. The image has
+// no user database to look up names.
+func ParseChown(chown, option string) (int, int, error) {
+	uid, gid, _ := strings.Cut(chown, ":")
+	u, err := parseOwnerID(uid, chown, option)
+	if err != nil {
+		return 0, 0, err
+	}
+	g, err := parseOwnerID(gid, chown, option)
+	if err != nil {
+		return 0, 0, err
+	}
+	return u, g, nil
+}
+
+func parseOwnerID(s, chown, option string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected numeric uid:gid, uid or :gid", option, chown)
+	}
+	return id, nil
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var (
@@ -13,6 +14,23 @@ var (
 	UUIDRegex     = regexp.MustCompile("^[a-z0-9]{8}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{12}$")
 )
 
+// Backup folder names are formatted dates, the zone offset is only present if the date is not in UTC
+const (
+	FolderTimeFormat = "2006-01-02-15-04-05"
+	FolderZoneFormat = "-0700"
+)
+
+// ParseFolderTime parses a backup folder name, names without zone offset are in loc
+func ParseFolderTime(name string, loc *time.Location) (time.Time, error) {
+	if len(name) > len(FolderTimeFormat) {
+		return time.Parse(FolderTimeFormat+FolderZoneFormat, name)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(FolderTimeFormat, name, loc)
+}
+
 type File struct {
 	Name  string
 	IsDir bool
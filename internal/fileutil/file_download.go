@@ -22,44 +22,54 @@ func init() {
 	mime.AddExtensionType(".jar", "application/java-archive")
 }
 
-func DownloadFileFromURL(ctx context.Context, srcURL, dstFolder string) error {
+// DownloadFileFromURL saves the file at srcURL into dstFolder and returns its path, the file name is guessed
+// from the response. Files that are not in the allow-list of types are rejected before they are created.
+func DownloadFileFromURL(ctx context.Context, srcURL, dstFolder string, types FileTypes) (string, error) {
 	// Get the data
-	resp, err := http.Get(srcURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srcURL, nil)
 	if err != nil {
-		return err
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	// Check server response
 	if c := resp.StatusCode; c < 200 || 299 < c {
-		return fmt.Errorf("Error downloading file, status code is %d", c)
+		return "", fmt.Errorf("Error downloading file, status code is %d", c)
 	}
 
 	// Guess the filename
 	fileName := guessFilename(resp)
 	if fileName == "" {
-		return ErrNoFilename
+		return "", ErrNoFilename
+	}
+	if err = types.Check(fileName, resp.Header.Get("Content-Type")); err != nil {
+		return "", err
 	}
 
 	// Create the file
-	out, err := os.Create(path.Join(dstFolder, fileName))
+	name := path.Join(dstFolder, fileName)
+	out, err := os.Create(name)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer out.Close()
 
 	// Write the body to file
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// flush file
 	if err = out.Sync(); err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return name, nil
 }
 
 // Code snippet taken from https://github.com/cavaliergopher/grab/blob/v3.0.1/v3/util.go
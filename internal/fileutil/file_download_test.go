@@ -2,6 +2,7 @@ package fileutil
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"path"
@@ -93,7 +94,7 @@ func TestDownloadFileFromURL(t *testing.T) {
 				AnyResponse(200, nil, tt.content.contentType, tt.content.contentDispFileName))
 
 			// Run the tests
-			err = DownloadFileFromURL(context.Background(), tt.url, dstPath)
+			_, err = DownloadFileFromURL(context.Background(), tt.url, dstPath, nil)
 			require.Equal(t, tt.wantErr, err, "Error is: ", err)
 			if err != nil {
 				return
@@ -154,7 +155,7 @@ func TestDownloadFileFromURL_DestinationPath(t *testing.T) {
 				AnyResponse(200, nil, tt.content.contentType, tt.content.contentDispFileName))
 
 			// Run the tests
-			err = DownloadFileFromURL(context.Background(), tt.url, dstPath)
+			_, err = DownloadFileFromURL(context.Background(), tt.url, dstPath, nil)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				require.ErrorContains(t, err, "no such file or directory")
@@ -182,3 +183,38 @@ func AnyResponse(status int, bytes []byte, conType, conFileName string) func(req
 		return response, nil
 	}
 }
+
+func TestDownloadFileFromURL_FileTypes(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.Deactivate()
+	tests := []struct {
+		name      string
+		url       string
+		content   httpContent
+		wantFiles []File
+		wantErr   bool
+	}{
+		{"allowed jar", "http://example.com/code.jar", httpContent{contentType: "application/java-archive"}, []File{{Name: "code.jar"}}, false},
+		{"extension from content-type", "http://example.com/code", httpContent{contentType: "application/java-archive"}, []File{{Name: "code.jar"}}, false},
+		{"not allowed extension", "http://example.com/run.sh", httpContent{}, []File{}, true},
+		{"html error page", "http://example.com/code.jar", httpContent{contentType: "text/html; charset=utf-8"}, []File{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer httpmock.Reset()
+
+			tmpdir, err := os.MkdirTemp("", "tmpDir")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			httpmock.RegisterResponder("GET", tt.url,
+				AnyResponse(200, nil, tt.content.contentType, tt.content.contentDispFileName))
+
+			_, err = DownloadFileFromURL(context.Background(), tt.url, tmpdir, ParseFileTypes(DefaultUserCodeTypes))
+			require.Equal(t, tt.wantErr, errors.Is(err, ErrFileTypeNotAllowed), "Error is: ", err)
+			files, err := DirFileList(tmpdir)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.wantFiles, files)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// ErrFileTypeNotAllowed is returned for files that are not in the allow-list
+var ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+
+// DefaultUserCodeTypes are the extensions of the files accepted in the user code directory
+const DefaultUserCodeTypes = "jar,zip,class,properties"
+
+// contentTypes are the media types servers and buckets commonly use for the user code files
+var contentTypes = map[string][]string{
+	".jar":        {"application/java-archive", "application/x-java-archive", "application/zip"},
+	".zip":        {"application/zip", "application/x-zip-compressed"},
+	".class":      {"application/java-vm", "application/x-java-class", "application/java"},
+	".properties": {"text/plain", "text/x-java-properties"},
+}
+
+// binaryContentTypes say nothing about the content, they are accepted for every extension
+var binaryContentTypes = []string{"application/octet-stream", "binary/octet-stream"}
+
+// FileTypes is an allow-list of file extensions, nil allows every file
+type FileTypes []string
+
+// ParseFileTypes parses a comma separated list of extensions, e.g. "jar,zip", an empty list allows every file
+func ParseFileTypes(list string) FileTypes {
+	var t FileTypes
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			t = append(t, "."+ext)
+		}
+	}
+	return t
+}
+
+// Check returns ErrFileTypeNotAllowed if the file has none of the allowed extensions, or if the
+// content type does not fit the extension. An empty content type is not checked.
+func (t FileTypes) Check(name, contentType string) error {
+	if t == nil {
+		return nil
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if !contains(t, ext) {
+		return fmt.Errorf("%w: %s, allowed are %s", ErrFileTypeNotAllowed, name, strings.Join(t, ", "))
+	}
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %s has an invalid content type %q", ErrFileTypeNotAllowed, name, contentType)
+	}
+	if contains(binaryContentTypes, mediaType) || contains(contentTypes[ext], mediaType) {
+		return nil
+	}
+	// extensions without well known types fall back to the system registry
+	if known, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil && known == mediaType {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has content type %s", ErrFileTypeNotAllowed, name, mediaType)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package fileutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTypesCheck(t *testing.T) {
+	types := ParseFileTypes(" JAR, .zip,class,properties,")
+	require.Equal(t, FileTypes{".jar", ".zip", ".class", ".properties"}, types)
+
+	tests := []struct {
+		name        string
+		file        string
+		contentType string
+		wantErr     bool
+	}{
+		{"jar", "code.jar", "", false},
+		{"upper case", "CODE.JAR", "", false},
+		{"jar as zip", "code.jar", "application/zip", false},
+		{"binary", "code.class", "binary/octet-stream", false},
+		{"properties", "app.properties", "text/plain; charset=utf-8", false},
+		{"no extension", "code", "", true},
+		{"script", "run.sh", "", true},
+		{"html page", "code.jar", "text/html", true},
+		{"invalid content type", "code.jar", "/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := types.Check(tt.file, tt.contentType)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if err != nil {
+				require.ErrorIs(t, err, ErrFileTypeNotAllowed)
+			}
+		})
+	}
+
+	// an empty list allows every file
+	require.Nil(t, ParseFileTypes("").Check("run.sh", "text/html"))
+}
@@ -0,0 +1,183 @@
+package fileutil
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrUnsafeZip is returned for zip bundles that would escape the destination or exceed the limits
+var ErrUnsafeZip = errors.New("unsafe zip bundle")
+
+// ZipLimits bound the extraction of a zip bundle, zero values do not limit
+type ZipLimits struct {
+	// MaxSize is the total size of the extracted files
+	MaxSize int64
+	// MaxFiles is the number of extracted files
+	MaxFiles int
+	// MaxRatio is the largest compression ratio of a file, zip bombs compress far better than code
+	MaxRatio int64
+}
+
+// DefaultZipLimits are generous for user code bundles
+var DefaultZipLimits = ZipLimits{MaxSize: 1 << 30, MaxFiles: 10000, MaxRatio: 100}
+
+// IsZip reports whether the file is a zip bundle by its extension
+func IsZip(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".zip")
+}
+
+// ExtractZip extracts the zip bundle into dir and removes it. Files of other types than the allowed ones
+// are skipped and returned, directories are kept. The sizes of the entries are not trusted, the limits
+// are checked against the extracted bytes. The entries are extracted into a temporary folder in dir and
+// moved into place once all of them are extracted, so a failed extraction leaves dir untouched and a
+// retry replaces the files of an earlier attempt.
+func ExtractZip(name, dir string, types FileTypes, limits ZipLimits) ([]string, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	tmp, err := os.MkdirTemp(dir, ".extract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	var created []string
+	var skipped []string
+	var total int64
+	var files int
+	err = func() error {
+		for _, f := range r.File {
+			entry, err := zipEntryName(f.Name)
+			if err != nil {
+				return err
+			}
+			mode := f.Mode()
+			if mode.IsDir() {
+				continue
+			}
+			if !mode.IsRegular() {
+				return fmt.Errorf("%w: %s is not a regular file", ErrUnsafeZip, f.Name)
+			}
+			if types.Check(entry, "") != nil {
+				skipped = append(skipped, entry)
+				continue
+			}
+			files++
+			if limits.MaxFiles > 0 && files > limits.MaxFiles {
+				return fmt.Errorf("%w: more than %d files", ErrUnsafeZip, limits.MaxFiles)
+			}
+
+			target := filepath.Join(tmp, filepath.FromSlash(entry))
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			n, err := extractZipFile(f, target, limits, total)
+			if err != nil {
+				return err
+			}
+			created = append(created, entry)
+			total += n
+		}
+
+		for _, c := range created {
+			target := filepath.Join(dir, filepath.FromSlash(c))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(filepath.Join(tmp, filepath.FromSlash(c)), target); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("extracting %s: %w", filepath.Base(name), err)
+	}
+	return skipped, os.Remove(name)
+}
+
+// ExtractBundle extracts the zip bundle into dir with the default limits and logs the skipped entries
+func ExtractBundle(name, dir string, types FileTypes, log *zap.Logger) error {
+	skipped, err := ExtractZip(name, dir, types, DefaultZipLimits)
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		log.Warn("skipped zip entry of a type that is not allowed", zap.String("bundle", filepath.Base(name)), zap.String("entry", s))
+	}
+	return nil
+}
+
+// zipEntryName returns the cleaned slash separated name of the entry, names that are absolute or leave
+// the destination are rejected
+func zipEntryName(name string) (string, error) {
+	if strings.ContainsAny(name, "\\\x00") || strings.Contains(name, ":") {
+		return "", fmt.Errorf("%w: invalid name %q", ErrUnsafeZip, name)
+	}
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %s is outside of the destination", ErrUnsafeZip, name)
+	}
+	return clean, nil
+}
+
+// extractZipFile writes the entry to target, which must not exist yet, e.g. for duplicate entries, and
+// returns the bytes written.
+// The target is removed if the entry could not be extracted.
+func extractZipFile(f *zip.File, target string, limits ZipLimits, extracted int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	// limit is the allowed size of the entry, one more byte is read to detect an excess
+	limit := int64(-1)
+	if limits.MaxSize > 0 {
+		limit = limits.MaxSize - extracted
+	}
+	if limits.MaxRatio > 0 {
+		ratioLimit := int64(f.CompressedSize64) * limits.MaxRatio
+		if ratioLimit < 1<<20 {
+			// tiny entries, e.g. properties, compress well without being bombs
+			ratioLimit = 1 << 20
+		}
+		if limit < 0 || ratioLimit < limit {
+			limit = ratioLimit
+		}
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	var src io.Reader = rc
+	if limit >= 0 {
+		src = io.LimitReader(rc, limit+1)
+	}
+	n, err := io.Copy(out, src)
+	if err == nil && limit >= 0 && n > limit {
+		err = fmt.Errorf("%w: %s exceeds the size or compression ratio limit", ErrUnsafeZip, f.Name)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		os.Remove(target)
+		return n, err
+	}
+	return n, nil
+}
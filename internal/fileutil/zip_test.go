@@ -0,0 +1,121 @@
+package fileutil
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type zipEntry struct {
+	name    string
+	content []byte
+	mode    os.FileMode
+}
+
+func writeZip(t *testing.T, name string, entries []zipEntry) {
+	f, err := os.Create(name)
+	require.Nil(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		fw, err := w.CreateHeader(h)
+		require.Nil(t, err)
+		_, err = fw.Write(e.content)
+		require.Nil(t, err)
+	}
+	require.Nil(t, w.Close())
+}
+
+func TestExtractZip(t *testing.T) {
+	jar := []byte("PK fake jar")
+	tests := []struct {
+		name        string
+		entries     []zipEntry
+		limits      ZipLimits
+		wantFiles   []string
+		wantSkipped []string
+		wantErr     error
+	}{
+		{
+			"bundle",
+			[]zipEntry{{name: "lib/", mode: os.ModeDir | 0755}, {name: "lib/a.jar", content: jar}, {name: "app.properties", content: []byte("a=b")}, {name: "bin/run.sh", content: []byte("#!/bin/sh")}},
+			DefaultZipLimits,
+			[]string{"lib/a.jar", "app.properties"},
+			[]string{"bin/run.sh"},
+			nil,
+		},
+		{"path traversal", []zipEntry{{name: "a.jar", content: jar}, {name: "lib/../../evil.jar", content: jar}}, DefaultZipLimits, nil, nil, ErrUnsafeZip},
+		{"absolute path", []zipEntry{{name: "/etc/evil.jar", content: jar}}, DefaultZipLimits, nil, nil, ErrUnsafeZip},
+		{"windows path", []zipEntry{{name: `..\evil.jar`, content: jar}}, DefaultZipLimits, nil, nil, ErrUnsafeZip},
+		{"symlink", []zipEntry{{name: "evil.jar", content: []byte("/etc/passwd"), mode: os.ModeSymlink | 0777}}, DefaultZipLimits, nil, nil, ErrUnsafeZip},
+		{"zip bomb", []zipEntry{{name: "a.jar", content: jar}, {name: "bomb.jar", content: make([]byte, 4<<20)}}, DefaultZipLimits, nil, nil, ErrUnsafeZip},
+		{"too large", []zipEntry{{name: "a.jar", content: jar}, {name: "b.jar", content: jar}}, ZipLimits{MaxSize: int64(len(jar)) + 1}, nil, nil, ErrUnsafeZip},
+		{"too many files", []zipEntry{{name: "a.jar", content: jar}, {name: "b.jar", content: jar}}, ZipLimits{MaxFiles: 1}, nil, nil, ErrUnsafeZip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "extract_zip")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			bundle := path.Join(tmpdir, "bundle.zip")
+			writeZip(t, bundle, tt.entries)
+			dst := path.Join(tmpdir, "dst")
+			require.Nil(t, os.Mkdir(dst, 0755))
+
+			skipped, err := ExtractZip(bundle, dst, ParseFileTypes(DefaultUserCodeTypes), tt.limits)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.wantSkipped, skipped)
+
+			// nothing is left of a failed extraction
+			var got []string
+			for _, f := range []string{"a.jar", "b.jar", "lib/a.jar", "app.properties", "bin/run.sh"} {
+				if _, err := os.Stat(path.Join(dst, f)); err == nil {
+					got = append(got, f)
+				}
+			}
+			require.ElementsMatch(t, tt.wantFiles, got)
+			_, err = os.Stat(bundle)
+			require.Equal(t, tt.wantErr == nil, os.IsNotExist(err), "the bundle is removed once it is extracted")
+		})
+	}
+}
+
+func TestExtractZipRetry(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "extract_zip_existing")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	require.Nil(t, os.WriteFile(path.Join(tmpdir, "a.jar"), []byte("old"), 0644))
+
+	// a failed extraction leaves the files of an earlier attempt untouched
+	bundle := path.Join(tmpdir, "bundle.zip")
+	writeZip(t, bundle, []zipEntry{{name: "a.jar", content: []byte("new")}, {name: "../evil.jar", content: []byte("new")}})
+	_, err = ExtractZip(bundle, tmpdir, nil, DefaultZipLimits)
+	require.ErrorIs(t, err, ErrUnsafeZip)
+	data, err := os.ReadFile(path.Join(tmpdir, "a.jar"))
+	require.Nil(t, err)
+	require.Equal(t, "old", string(data))
+
+	// a retry replaces them
+	writeZip(t, bundle, []zipEntry{{name: "a.jar", content: []byte("new")}, {name: "lib/b.jar", content: []byte("new")}})
+	_, err = ExtractZip(bundle, tmpdir, nil, DefaultZipLimits)
+	require.Nil(t, err)
+	data, err = os.ReadFile(path.Join(tmpdir, "a.jar"))
+	require.Nil(t, err)
+	require.Equal(t, "new", string(data))
+
+	entries, err := os.ReadDir(tmpdir)
+	require.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{"a.jar", "lib"}, names, "the temporary folder is removed")
+}
@@ -0,0 +1,100 @@
+// Package fsys is the filesystem of the restore locks and markers, the local backups and the agent
+// state files. Tests replace it to inject failures or to observe the changes, like the clock.
+package fsys
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// FS is the part of the filesystem the agent changes outside of extracting and archiving backups
+type FS interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+}
+
+// File is an open file or folder of an FS
+type File interface {
+	io.ReadWriteCloser
+	Sync() error
+}
+
+// OS is the filesystem of the operating system
+type OS struct{}
+
+func (OS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+func (OS) ReadFile(name string) ([]byte, error)  { return os.ReadFile(name) }
+func (OS) Remove(name string) error              { return os.Remove(name) }
+func (OS) RemoveAll(path string) error           { return os.RemoveAll(path) }
+func (OS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+var (
+	mu      sync.RWMutex
+	current FS = OS{}
+)
+
+func get() FS {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Set replaces the agent filesystem, the returned function restores the previous one
+func Set(f FS) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := current
+	current = f
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		current = prev
+	}
+}
+
+// OpenFile opens the file with the flags of os.OpenFile
+func OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return get().OpenFile(name, flag, perm)
+}
+
+// Open opens the file or folder for reading
+func Open(name string) (File, error) {
+	return get().OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Stat returns the file info of the file
+func Stat(name string) (fs.FileInfo, error) {
+	return get().Stat(name)
+}
+
+// ReadFile returns the content of the file
+func ReadFile(name string) ([]byte, error) {
+	return get().ReadFile(name)
+}
+
+// WriteFile writes data to the file, creating it if necessary
+func WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return get().WriteFile(name, data, perm)
+}
+
+// Remove removes the file or empty folder
+func Remove(name string) error {
+	return get().Remove(name)
+}
+
+// RemoveAll removes the path and everything below it
+func RemoveAll(path string) error {
+	return get().RemoveAll(path)
+}
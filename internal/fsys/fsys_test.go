@@ -0,0 +1,32 @@
+package fsys
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type readOnly struct {
+	OS
+}
+
+func (readOnly) Remove(string) error { return errors.New("read-only file system") }
+
+func TestSet(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	require.Nil(t, WriteFile(name, []byte("{}"), 0600))
+
+	restore := Set(readOnly{})
+	require.ErrorContains(t, Remove(name), "read-only")
+	data, err := ReadFile(name)
+	require.Nil(t, err)
+	require.Equal(t, "{}", string(data))
+
+	restore()
+	require.Nil(t, Remove(name))
+	_, err = Stat(name)
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
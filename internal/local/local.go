@@ -0,0 +1,101 @@
+// Package local keeps the agent usable outside of Kubernetes, e.g. on a developer machine
+// against MinIO. Credentials and state are stored under the user directories of the
+// XDG base directory specification instead of the pod.
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Enabled makes the agent use the user directories instead of the Kubernetes API and pod paths
+var Enabled = strings.EqualFold(os.Getenv("AGENT_LOCAL_MODE"), "true")
+
+// appDir is the folder of the agent in the user directories
+const appDir = "hazelcast-platform-operator-agent"
+
+// defaultSecret is read when a command has no secret name
+const defaultSecret = "default"
+
+// ConfigDir returns the directory of the agent configuration, $XDG_CONFIG_HOME on Linux
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDir), nil
+}
+
+// StateDir returns the directory of the agent state, $XDG_STATE_HOME or ~/.local/state
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, appDir), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", appDir), nil
+}
+
+// SecretDir returns the directory of the named secret, every file is a key of the secret
+// like in a mounted Kubernetes secret
+func SecretDir(name string) (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = defaultSecret
+	}
+	return filepath.Join(dir, "secrets", name), nil
+}
+
+// SecretData reads the named secret from the user configuration directory
+func SecretData(name string) (map[string][]byte, error) {
+	dir, err := SecretDir(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadSecretDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading local secret: %w", err)
+	}
+	return data, nil
+}
+
+// ReadSecretDir reads a secret stored like a mounted Kubernetes secret, every file is a key
+func ReadSecretDir(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]byte)
+	for _, e := range entries {
+		// skip hidden files, e.g. the ..data links of copied secret mounts
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		data[e.Name()] = value
+	}
+	return data, nil
+}
+
+// StatePath returns the path of a state file and creates the state directory
+func StatePath(name string) (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,49 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretData(t *testing.T) {
+	dir, err := os.MkdirTemp("", "local_secret")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	secret := filepath.Join(dir, appDir, "secrets", "minio")
+	require.Nil(t, os.MkdirAll(filepath.Join(secret, "..2022_06_13"), 0700))
+	require.Nil(t, os.WriteFile(filepath.Join(secret, "access-key-id"), []byte("minioadmin"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(secret, "region"), []byte("us-east-1"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(secret, ".hidden"), []byte("x"), 0600))
+
+	got, err := SecretData("minio")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]byte{"access-key-id": []byte("minioadmin"), "region": []byte("us-east-1")}, got)
+
+	_, err = SecretData("")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Contains(t, err.Error(), filepath.Join("secrets", defaultSecret))
+}
+
+func TestStatePath(t *testing.T) {
+	dir, err := os.MkdirTemp("", "local_state")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	t.Setenv("HOME", dir)
+
+	t.Setenv("XDG_STATE_HOME", "")
+	got, err := StatePath("termination-log")
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, ".local", "state", appDir, "termination-log"), got)
+	require.DirExists(t, filepath.Dir(got))
+
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	got, err = StatePath("termination-log")
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "state", appDir, "termination-log"), got)
+}
@@ -0,0 +1,22 @@
+package logger
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var lastError atomic.Value
+
+// LastError returns the redacted message of the last error logged by any logger of the process
+func LastError() string {
+	msg, _ := lastError.Load().(string)
+	return msg
+}
+
+func recordError(ent zapcore.Entry) error {
+	if ent.Level >= zapcore.ErrorLevel {
+		lastError.Store(Redact(ent.Message))
+	}
+	return nil
+}
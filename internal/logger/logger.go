@@ -2,10 +2,18 @@ package logger
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func New() *zap.Logger {
-	logger, err := zap.NewProduction()
+	opts := []zap.Option{zap.Hooks(recordError)}
+	if redactionEnabled() {
+		opts = append(opts, zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return redactCore{c}
+		}))
+	}
+
+	logger, err := zap.NewProduction(opts...)
 	if err != nil {
 		panic(err)
 	}
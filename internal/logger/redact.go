@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "REDACTED"
+
+// Sensitive query parameters of presigned URLs, SAS tokens and common credential names
+var sensitiveParams = []string{
+	"sig", "signature", "x-amz-signature", "x-amz-credential", "x-amz-security-token",
+	"x-goog-signature", "x-goog-credential", "access_token", "token", "secret", "password",
+}
+
+var (
+	// user info in URLs, e.g. s3://user:pass@bucket
+	userInfoRE = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`)
+
+	// AWS access key IDs
+	awsKeyIDRE = regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)
+
+	sensitiveParamRE = paramRE(sensitiveParams)
+)
+
+func init() {
+	// LOG_REDACT_PARAMS is a comma separated list of extra query parameters to redact
+	if extra := os.Getenv("LOG_REDACT_PARAMS"); extra != "" {
+		sensitiveParamRE = paramRE(append(sensitiveParams, strings.Split(extra, ",")...))
+	}
+}
+
+func paramRE(params []string) *regexp.Regexp {
+	var quoted []string
+	for _, p := range params {
+		if p = strings.TrimSpace(p); p != "" {
+			quoted = append(quoted, regexp.QuoteMeta(p))
+		}
+	}
+	return regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(quoted, "|") + `)=)[^&\s"']+`)
+}
+
+// Redact scrubs credentials, SAS tokens and presigned URL signatures from s
+func Redact(s string) string {
+	s = userInfoRE.ReplaceAllString(s, "${1}"+redacted+"@")
+	s = sensitiveParamRE.ReplaceAllString(s, "${1}"+redacted)
+	return awsKeyIDRE.ReplaceAllString(s, redacted)
+}
+
+func redactionEnabled() bool {
+	return !strings.EqualFold(os.Getenv("LOG_REDACTION"), "false")
+}
+
+// redactCore redacts the message and string fields of every entry before it is written
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = Redact(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = Redact(f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Redact(err.Error())}
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
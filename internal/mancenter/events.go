@@ -0,0 +1,94 @@
+package mancenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+)
+
+// Event types
+const (
+	Backup  = "BACKUP"
+	Restore = "RESTORE"
+	Verify  = "VERIFY"
+)
+
+// Event phases
+const (
+	Started   = "STARTED"
+	Succeeded = "SUCCEEDED"
+	Failed    = "FAILED"
+)
+
+// Event is a persistence operation lifecycle event shown in Management Center
+type Event struct {
+	Type      string    `json:"type"`
+	Phase     string    `json:"phase"`
+	Member    string    `json:"member,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Client reports events to a Management Center endpoint, a nil Client discards all events
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the given endpoint or nil if url is empty
+func New(url, token string) *Client {
+	if url == "" {
+		return nil
+	}
+	return &Client{
+		URL:        url,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Report sends the event, the hostname is used as member name if it is not set
+func (c *Client) Report(ctx context.Context, e Event) error {
+	if c == nil {
+		return nil
+	}
+	if e.Member == "" {
+		e.Member, _ = os.Hostname()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = clock.Now().UTC()
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || 299 < code {
+		return fmt.Errorf("management center responded with status code %d", code)
+	}
+	return nil
+}
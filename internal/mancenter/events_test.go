@@ -0,0 +1,56 @@
+package mancenter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		statusCode int
+		wantErr    bool
+	}{
+		{"with token", "secret-token", http.StatusOK, false},
+		{"without token", "", http.StatusAccepted, false},
+		{"error status", "secret-token", http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Event
+			var auth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				require.Nil(t, json.NewDecoder(r.Body).Decode(&got))
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL, tt.token).Report(context.Background(), Event{Type: Backup, Phase: Succeeded, Key: "key"})
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+
+			require.Equal(t, Backup, got.Type)
+			require.Equal(t, Succeeded, got.Phase)
+			require.Equal(t, "key", got.Key)
+			require.NotEmpty(t, got.Member)
+			require.False(t, got.Timestamp.IsZero())
+			if tt.token == "" {
+				require.Empty(t, auth)
+			} else {
+				require.Equal(t, "Bearer "+tt.token, auth)
+			}
+		})
+	}
+}
+
+func TestNilClient(t *testing.T) {
+	c := New("", "token")
+	require.Nil(t, c)
+	require.Nil(t, c.Report(context.Background(), Event{Type: Restore, Phase: Started}))
+}
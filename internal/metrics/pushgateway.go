@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metric is a gauge in the Prometheus text exposition format
+type Metric struct {
+	Name  string
+	Help  string
+	Value float64
+	// Labels are added to the sample, the job and instance labels are set by the Pusher
+	Labels map[string]string
+}
+
+// Pusher pushes the metrics of short-lived jobs to a Prometheus Pushgateway, a nil Pusher discards all metrics
+type Pusher struct {
+	URL        string
+	Job        string
+	HTTPClient *http.Client
+}
+
+// NewPusher returns a pusher for the given Pushgateway or nil if url is empty
+func NewPusher(url, job string) *Pusher {
+	if url == "" {
+		return nil
+	}
+	return &Pusher{
+		URL:        strings.TrimSuffix(url, "/"),
+		Job:        job,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Push replaces the metrics of the job instance in the Pushgateway
+func (p *Pusher) Push(ctx context.Context, instance string, metrics []Metric) error {
+	if p == nil {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&body, "# HELP %s %s\n", m.Name, m.Help)
+		fmt.Fprintf(&body, "# TYPE %s gauge\n", m.Name)
+		fmt.Fprintf(&body, "%s%s %s\n", m.Name, formatLabels(m.Labels), strconv.FormatFloat(m.Value, 'g', -1, 64))
+	}
+
+	u := fmt.Sprintf("%s/metrics/job/%s/instance/%s", p.URL, url.PathEscape(p.Job), url.PathEscape(instance))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || 299 < code {
+		return fmt.Errorf("pushgateway responded with status code %d", code)
+	}
+	return nil
+}
+
+// labelEscaper escapes label values as required by the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels returns the labels sorted by name in braces, empty if there are none
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = n + `="` + labelEscaper.Replace(labels[n]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	err := NewPusher(srv.URL+"/", "restore").Push(context.Background(), "hazelcast-0", []Metric{
+		{Name: "restore_success", Help: "Whether the restore succeeded.", Value: 1},
+		{Name: "restore_duration_seconds", Help: "Duration of the restore.", Value: 1.5},
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.MethodPut, method)
+	require.Equal(t, "/metrics/job/restore/instance/hazelcast-0", path)
+	require.Equal(t, `# HELP restore_success Whether the restore succeeded.
+# TYPE restore_success gauge
+restore_success 1
+# HELP restore_duration_seconds Duration of the restore.
+# TYPE restore_duration_seconds gauge
+restore_duration_seconds 1.5
+`, body)
+}
+
+func TestPushLabels(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	err := NewPusher(srv.URL, "restore").Push(context.Background(), "hazelcast-0", []Metric{
+		{Name: "restore_result", Help: "Outcome of the restore.", Value: 1, Labels: map[string]string{"reason": `say "no"`, "phase": "FAILED"}},
+	})
+	require.Nil(t, err)
+	require.Equal(t, `# HELP restore_result Outcome of the restore.
+# TYPE restore_result gauge
+restore_result{phase="FAILED",reason="say \"no\""} 1
+`, body)
+}
+
+func TestPushErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	require.NotNil(t, NewPusher(srv.URL, "restore").Push(context.Background(), "hazelcast-0", nil))
+}
+
+func TestNilPusher(t *testing.T) {
+	p := NewPusher("", "restore")
+	require.Nil(t, p)
+	require.Nil(t, p.Push(context.Background(), "hazelcast-0", nil))
+}
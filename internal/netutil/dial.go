@@ -0,0 +1,162 @@
+package netutil
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// IP family preferences for outbound connections
+const (
+	FamilyAuto = "auto"
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// Config holds the dial preferences of all outbound connections
+type Config struct {
+	// IPFamily restricts connections to IPv4 or IPv6, auto uses both with happy eyeballs
+	IPFamily string `envconfig:"NET_IP_FAMILY" desc:"IP family of outbound connections, auto, ipv4 or ipv6"`
+	// FallbackDelay is the happy eyeballs delay before the other address family is tried,
+	// 0 means the Go default and a negative value disables the fallback
+	FallbackDelay time.Duration `envconfig:"NET_FALLBACK_DELAY" desc:"delay before happy eyeballs tries the other IP family"`
+	// Hosts maps endpoint hosts to the address that is dialed instead, e.g. for air-gapped
+	// mirrors of the storage APIs whose real endpoints do not resolve
+	Hosts string `envconfig:"NET_HOSTS" desc:"comma separated host=address overrides, e.g. *.s3.amazonaws.com=10.0.0.5"`
+	// HostsFile is a file in /etc/hosts format with more overrides, the entries of Hosts win
+	HostsFile string `envconfig:"NET_HOSTS_FILE" desc:"file with host overrides in /etc/hosts format"`
+
+	overrides map[string]string
+}
+
+var config = loadConfig()
+
+func loadConfig() Config {
+	var c Config
+	if err := envconfig.Process("net", &c); err != nil {
+		// invalid overrides fall back to dual-stack
+		return Config{}
+	}
+	c.IPFamily = strings.ToLower(c.IPFamily)
+	c.overrides = map[string]string{}
+	if c.HostsFile != "" {
+		// an unreadable file keeps the regular resolution, like a missing /etc/hosts
+		if f, err := os.Open(c.HostsFile); err == nil {
+			parseHostsFile(f, c.overrides)
+			f.Close()
+		}
+	}
+	parseHosts(c.Hosts, c.overrides)
+	return c
+}
+
+// parseHosts adds the host=address pairs of a comma separated list to m, malformed pairs are skipped
+func parseHosts(list string, m map[string]string) {
+	for _, pair := range strings.Split(list, ",") {
+		host, addr, ok := strings.Cut(pair, "=")
+		host, addr = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(addr)
+		if ok && host != "" && addr != "" {
+			m[host] = addr
+		}
+	}
+}
+
+// parseHostsFile adds the entries of a file in /etc/hosts format to m, every line is an
+// address followed by its host names, # starts a comment
+func parseHostsFile(r io.Reader, m map[string]string) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, host := range fields[1:] {
+			m[strings.ToLower(host)] = fields[0]
+		}
+	}
+}
+
+// resolve replaces the host of addr with its override, wildcard entries like *.example.com match
+// every subdomain and the exact host wins over a wildcard. Overrides without a port keep the
+// port of addr. TLS still verifies the original host name, the transport takes it from the URL.
+func (c Config) resolve(addr string) string {
+	if len(c.overrides) == 0 {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	target, ok := c.overrides[host]
+	for suffix := host; !ok; {
+		_, rest, found := strings.Cut(suffix, ".")
+		if !found {
+			return addr
+		}
+		target, ok = c.overrides["*."+rest]
+		suffix = rest
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(strings.Trim(target, "[]"), port)
+}
+
+// network restricts tcp and udp networks to the preferred IP family
+func (c Config) network(network string) string {
+	if network != "tcp" && network != "udp" {
+		return network
+	}
+	switch c.IPFamily {
+	case FamilyIPv4:
+		return network + "4"
+	case FamilyIPv6:
+		return network + "6"
+	}
+	return network
+}
+
+func (c Config) dialContext(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{
+		Timeout:       timeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: c.FallbackDelay,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, c.network(network), c.resolve(addr))
+	}
+}
+
+// DialContext dials addr using the configured IP family preference and host overrides
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return config.dialContext(30*time.Second)(ctx, network, addr)
+}
+
+// DialTimeout is like net.DialTimeout using the configured IP family preference
+func DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return config.dialContext(timeout)(context.Background(), network, addr)
+}
+
+// Transport returns a copy of the default HTTP transport dialing with the configured preferences
+func Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = config.dialContext(30 * time.Second)
+	return t
+}
+
+// InstallDefaultTransport makes the clients using http.DefaultTransport, like the
+// storage SDKs, follow the configured preferences
+func InstallDefaultTransport() {
+	if _, ok := http.DefaultTransport.(*http.Transport); ok {
+		http.DefaultTransport = Transport()
+	}
+}
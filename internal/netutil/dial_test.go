@@ -0,0 +1,141 @@
+package netutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		family  string
+		network string
+		want    string
+	}{
+		{"", "tcp", "tcp"},
+		{FamilyAuto, "tcp", "tcp"},
+		{FamilyIPv4, "tcp", "tcp4"},
+		{FamilyIPv6, "tcp", "tcp6"},
+		{FamilyIPv6, "udp", "udp6"},
+		{FamilyIPv6, "tcp4", "tcp4"},
+		{FamilyIPv4, "unix", "unix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family+"/"+tt.network, func(t *testing.T) {
+			require.Equal(t, tt.want, Config{IPFamily: tt.family}.network(tt.network))
+		})
+	}
+}
+
+func listenIPv6(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback is not available: " + err.Error())
+	}
+	return l
+}
+
+func TestDialIPv6(t *testing.T) {
+	l := listenIPv6(t)
+	defer l.Close()
+
+	tests := []struct {
+		family  string
+		wantErr bool
+	}{
+		{FamilyAuto, false},
+		{FamilyIPv6, false},
+		{FamilyIPv4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			conn, err := Config{IPFamily: tt.family}.dialContext(time.Second)(context.Background(), "tcp", l.Addr().String())
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestTransportIPv6(t *testing.T) {
+	l := listenIPv6(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: Transport()}).Get(srv.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestParseHosts(t *testing.T) {
+	m := map[string]string{}
+	parseHostsFile(strings.NewReader(`# mirrors
+10.0.0.5   S3.amazonaws.com  *.s3.amazonaws.com
+10.0.0.6 storage.googleapis.com # gcs
+broken
+`), m)
+	parseHosts(" storage.googleapis.com = mirror.local:9000 ,missing,=10.0.0.7", m)
+
+	require.Equal(t, map[string]string{
+		"s3.amazonaws.com":       "10.0.0.5",
+		"*.s3.amazonaws.com":     "10.0.0.5",
+		"storage.googleapis.com": "mirror.local:9000",
+	}, m)
+}
+
+func TestResolve(t *testing.T) {
+	c := Config{overrides: map[string]string{
+		"*.s3.amazonaws.com":      "10.0.0.5",
+		"bucket.s3.amazonaws.com": "10.0.0.6",
+		"storage.googleapis.com":  "mirror.local:9000",
+		"ipv6.example.com":        "[fd00::1]",
+	}}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"s3.amazonaws.com:443", "s3.amazonaws.com:443"},
+		{"other.s3.amazonaws.com:443", "10.0.0.5:443"},
+		{"a.b.s3.amazonaws.com:443", "10.0.0.5:443"},
+		{"BUCKET.s3.amazonaws.com:443", "10.0.0.6:443"},
+		{"storage.googleapis.com:443", "mirror.local:9000"},
+		{"ipv6.example.com:80", "[fd00::1]:80"},
+		{"example.com:443", "example.com:443"},
+		{"no-port", "no-port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			require.Equal(t, tt.want, c.resolve(tt.addr))
+		})
+	}
+}
+
+func TestTransportHostOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	c := Config{overrides: map[string]string{"storage.example.invalid": srv.Listener.Addr().String()}}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = c.dialContext(time.Second)
+	resp, err := (&http.Client{Transport: tr}).Get("http://storage.example.invalid/bucket")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	// the request still carries the original host
+	require.Equal(t, "storage.example.invalid", string(body))
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// slack posts to an incoming webhook
+type slack struct {
+	url    string
+	client *http.Client
+}
+
+func newSlack(url string) *slack {
+	return &slack{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *slack) Send(ctx context.Context, subject, body string) error {
+	data, err := json.Marshal(map[string]string{"text": "*" + subject + "*\n" + body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || 299 < code {
+		return fmt.Errorf("slack responded with status code %d", code)
+	}
+	return nil
+}
+
+// email sends plain text mails over SMTP
+type email struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+func newSMTP(addr, from string, to []string, username, password string) *email {
+	e := &email{addr: addr, from: from, to: to}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		e.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return e
+}
+
+func (e *email) Send(_ context.Context, subject, body string) error {
+	return smtp.SendMail(e.addr, e.auth, e.from, e.to, e.message(subject, body))
+}
+
+func (e *email) message(subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// publisher is the part of the SNS client used by topic
+type publisher interface {
+	PublishWithContext(ctx aws.Context, in *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error)
+}
+
+// topic publishes to an AWS SNS topic, credentials are taken from the environment
+type topic struct {
+	arn    string
+	client publisher
+}
+
+func newSNS(topicARN string) (*topic, error) {
+	a, err := arn.Parse(topicARN)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(a.Region)})
+	if err != nil {
+		return nil, err
+	}
+	return &topic{arn: topicARN, client: sns.New(sess)}, nil
+}
+
+func (t *topic) Send(ctx context.Context, subject, body string) error {
+	_, err := t.client.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(t.arn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(body),
+	})
+	return err
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+)
+
+// DefaultTemplate renders the message body of an event
+const DefaultTemplate = `Hazelcast {{.Type}} {{.Phase}} on member {{.Member}}
+{{- if .Key}}
+Key: {{.Key}}{{end}}
+{{- if .Message}}
+Error: {{.Message}}{{end}}
+Time: {{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}`
+
+const subjectTemplate = `Hazelcast {{.Type}} {{.Phase}}`
+
+// Config selects the notification backends, a backend is enabled when its endpoint is set
+type Config struct {
+	SlackURL     string `envconfig:"NOTIFY_SLACK_URL" desc:"Slack incoming webhook URL"`
+	SMTPAddr     string `envconfig:"NOTIFY_SMTP_ADDR" desc:"SMTP server host:port for email notifications"`
+	SMTPFrom     string `envconfig:"NOTIFY_SMTP_FROM" desc:"sender address of email notifications"`
+	SMTPTo       string `envconfig:"NOTIFY_SMTP_TO" desc:"comma separated recipients of email notifications"`
+	SMTPUsername string `envconfig:"NOTIFY_SMTP_USERNAME" desc:"SMTP username"`
+	SMTPPassword string `envconfig:"NOTIFY_SMTP_PASSWORD" desc:"SMTP password"`
+	SNSTopicARN  string `envconfig:"NOTIFY_SNS_TOPIC_ARN" desc:"AWS SNS topic ARN"`
+	Template     string `envconfig:"NOTIFY_TEMPLATE" desc:"Go template of the notification message"`
+}
+
+// Backend delivers a rendered notification
+type Backend interface {
+	Send(ctx context.Context, subject, body string) error
+}
+
+// Dispatcher renders events and sends them to all backends, a nil Dispatcher discards all events
+type Dispatcher struct {
+	subject  *template.Template
+	body     *template.Template
+	backends []Backend
+}
+
+// New returns a dispatcher for the configured backends or nil if none is configured
+func New(c Config) (*Dispatcher, error) {
+	var backends []Backend
+	if c.SlackURL != "" {
+		backends = append(backends, newSlack(c.SlackURL))
+	}
+	if c.SMTPAddr != "" {
+		if c.SMTPFrom == "" || c.SMTPTo == "" {
+			return nil, errors.New("email notifications need a sender and recipients")
+		}
+		backends = append(backends, newSMTP(c.SMTPAddr, c.SMTPFrom, strings.Split(c.SMTPTo, ","), c.SMTPUsername, c.SMTPPassword))
+	}
+	if c.SNSTopicARN != "" {
+		b, err := newSNS(c.SNSTopicARN)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, b)
+	}
+	if len(backends) == 0 {
+		return nil, nil
+	}
+	return NewDispatcher(c.Template, backends...)
+}
+
+// NewDispatcher returns a dispatcher rendering the message body with tmpl, DefaultTemplate if empty
+func NewDispatcher(tmpl string, backends ...Backend) (*Dispatcher, error) {
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	body, err := template.New("body").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{
+		subject:  template.Must(template.New("subject").Parse(subjectTemplate)),
+		body:     body,
+		backends: backends,
+	}, nil
+}
+
+// Send notifies all backends about finished operations, started events are skipped
+func (d *Dispatcher) Send(ctx context.Context, e mancenter.Event) error {
+	if d == nil || e.Phase == mancenter.Started {
+		return nil
+	}
+	if e.Member == "" {
+		e.Member, _ = os.Hostname()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = clock.Now().UTC()
+	}
+
+	var subject, body bytes.Buffer
+	if err := d.subject.Execute(&subject, e); err != nil {
+		return err
+	}
+	if err := d.body.Execute(&body, e); err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, b := range d.backends {
+		if err := b.Send(ctx, subject.String(), body.String()); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var std, stdErr = load()
+
+func load() (*Dispatcher, error) {
+	var c Config
+	if err := envconfig.Process("notify", &c); err != nil {
+		return nil, err
+	}
+	return New(c)
+}
+
+// Send notifies the backends configured by the environment
+func Send(ctx context.Context, e mancenter.Event) error {
+	if stdErr != nil {
+		return stdErr
+	}
+	return std.Send(ctx, e)
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+)
+
+type recorder struct {
+	subjects []string
+	bodies   []string
+	err      error
+}
+
+func (r *recorder) Send(_ context.Context, subject, body string) error {
+	r.subjects = append(r.subjects, subject)
+	r.bodies = append(r.bodies, body)
+	return r.err
+}
+
+func TestDispatcherSend(t *testing.T) {
+	ts := time.Date(2022, 6, 13, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		tmpl        string
+		event       mancenter.Event
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			"backup succeeded",
+			"",
+			mancenter.Event{Type: mancenter.Backup, Phase: mancenter.Succeeded, Member: "hz-0", Key: "s3://bucket/2022-06-13-10-00-00", Timestamp: ts},
+			"Hazelcast BACKUP SUCCEEDED",
+			"Hazelcast BACKUP SUCCEEDED on member hz-0\nKey: s3://bucket/2022-06-13-10-00-00\nTime: 2022-06-13T10:00:00Z",
+		},
+		{
+			"restore failed",
+			"",
+			mancenter.Event{Type: mancenter.Restore, Phase: mancenter.Failed, Member: "hz-1", Message: "access denied", Timestamp: ts},
+			"Hazelcast RESTORE FAILED",
+			"Hazelcast RESTORE FAILED on member hz-1\nError: access denied\nTime: 2022-06-13T10:00:00Z",
+		},
+		{
+			"custom template",
+			"{{.Type}}/{{.Phase}}: {{.Member}}",
+			mancenter.Event{Type: mancenter.Backup, Phase: mancenter.Failed, Member: "hz-2", Timestamp: ts},
+			"Hazelcast BACKUP FAILED",
+			"BACKUP/FAILED: hz-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			d, err := NewDispatcher(tt.tmpl, r)
+			require.Nil(t, err)
+
+			require.Nil(t, d.Send(context.Background(), tt.event))
+			require.Equal(t, []string{tt.wantSubject}, r.subjects)
+			require.Equal(t, []string{tt.wantBody}, r.bodies)
+		})
+	}
+}
+
+func TestDispatcherSkipsStarted(t *testing.T) {
+	r := &recorder{}
+	d, err := NewDispatcher("", r)
+	require.Nil(t, err)
+
+	require.Nil(t, d.Send(context.Background(), mancenter.Event{Type: mancenter.Backup, Phase: mancenter.Started}))
+	require.Empty(t, r.bodies)
+
+	var nilDispatcher *Dispatcher
+	require.Nil(t, nilDispatcher.Send(context.Background(), mancenter.Event{Phase: mancenter.Failed}))
+}
+
+func TestDispatcherSendsToAllBackends(t *testing.T) {
+	failing := &recorder{err: errors.New("unavailable")}
+	ok := &recorder{}
+	d, err := NewDispatcher("", failing, ok)
+	require.Nil(t, err)
+
+	err = d.Send(context.Background(), mancenter.Event{Type: mancenter.Backup, Phase: mancenter.Failed})
+	require.EqualError(t, err, "unavailable")
+	require.Len(t, ok.bodies, 1)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    int
+		wantErr bool
+	}{
+		{"none", Config{}, 0, false},
+		{"slack", Config{SlackURL: "https://hooks.slack.com/services/x"}, 1, false},
+		{"email", Config{SMTPAddr: "smtp:25", SMTPFrom: "agent@example.com", SMTPTo: "ops@example.com"}, 1, false},
+		{"email without recipients", Config{SMTPAddr: "smtp:25", SMTPFrom: "agent@example.com"}, 0, true},
+		{"sns", Config{SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:backups"}, 1, false},
+		{"invalid sns arn", Config{SNSTopicARN: "backups"}, 0, true},
+		{"invalid template", Config{SlackURL: "https://hooks.slack.com/services/x", Template: "{{.Type"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(tt.config)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if tt.want == 0 {
+				require.Nil(t, d)
+				return
+			}
+			require.Len(t, d.backends, tt.want)
+		})
+	}
+}
+
+func TestSlackSend(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	err := newSlack(srv.URL).Send(context.Background(), "Hazelcast BACKUP FAILED", "details")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"text": "*Hazelcast BACKUP FAILED*\ndetails"}, got)
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	err = newSlack(srv.URL).Send(context.Background(), "subject", "body")
+	require.EqualError(t, err, "slack responded with status code 403")
+}
+
+func TestEmailMessage(t *testing.T) {
+	e := newSMTP("smtp:25", "agent@example.com", []string{"a@example.com", "b@example.com"}, "", "")
+	msg := string(e.message("Hazelcast RESTORE FAILED", "line1\nline2"))
+
+	require.True(t, strings.HasPrefix(msg, "From: agent@example.com\r\nTo: a@example.com, b@example.com\r\nSubject: Hazelcast RESTORE FAILED\r\n"))
+	require.True(t, strings.HasSuffix(msg, "\r\n\r\nline1\r\nline2\r\n"))
+}
+
+type fakePublisher struct {
+	in *sns.PublishInput
+}
+
+func (f *fakePublisher) PublishWithContext(_ aws.Context, in *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	f.in = in
+	return &sns.PublishOutput{}, nil
+}
+
+func TestTopicSend(t *testing.T) {
+	p := &fakePublisher{}
+	tp := &topic{arn: "arn:aws:sns:eu-west-1:123456789012:backups", client: p}
+
+	require.Nil(t, tp.Send(context.Background(), "subject", "body"))
+	require.Equal(t, "arn:aws:sns:eu-west-1:123456789012:backups", aws.StringValue(p.in.TopicArn))
+	require.Equal(t, "subject", aws.StringValue(p.in.Subject))
+	require.Equal(t, "body", aws.StringValue(p.in.Message))
+}
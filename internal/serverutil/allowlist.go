@@ -0,0 +1,87 @@
+package serverutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// LocalCIDRs are the loopback networks that are always allowed
+var LocalCIDRs = []string{"127.0.0.0/8", "::1/128"}
+
+// HostNet returns the network of the single address ip
+func HostNet(ip string) (*net.IPNet, error) {
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	if v4 := addr.To4(); v4 != nil {
+		addr = v4
+	}
+	bits := len(addr) * 8
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// AllowsAll returns true if one of the networks contains every address of its family
+func AllowsAll(nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if ones, _ := n.Mask.Size(); ones == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs, empty items are ignored
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", c, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// AllowList rejects requests using mutating methods if the client IP is not in one of the networks
+func AllowList(nets []*net.IPNet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) || clientAllowed(nets, r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		HttpError(w, http.StatusForbidden)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func clientAllowed(nets []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package serverutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"single", "10.0.0.0/8", 1, false},
+		{"multiple with spaces", "10.0.0.0/8, fd00::/8 ,", 2, false},
+		{"invalid", "10.0.0.0/33", 0, true},
+		{"no mask", "10.0.0.1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCIDRs(tt.list)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	nets, err := ParseCIDRs("127.0.0.0/8,::1/128,10.96.0.0/12")
+	require.Nil(t, err)
+
+	tests := []struct {
+		name       string
+		method     string
+		remoteAddr string
+		want       int
+	}{
+		{"local post", http.MethodPost, "127.0.0.1:1234", http.StatusOK},
+		{"local ipv6 delete", http.MethodDelete, "[::1]:1234", http.StatusOK},
+		{"operator post", http.MethodPost, "10.100.0.5:1234", http.StatusOK},
+		{"foreign post", http.MethodPost, "192.168.0.5:1234", http.StatusForbidden},
+		{"foreign delete", http.MethodDelete, "192.168.0.5:1234", http.StatusForbidden},
+		{"foreign get", http.MethodGet, "192.168.0.5:1234", http.StatusOK},
+		{"invalid address", http.MethodPost, "invalid", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := AllowList(nets, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(tt.method, "http://request/upload", nil)
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+			require.Equal(t, tt.want, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestHostNet(t *testing.T) {
+	n, err := HostNet("10.244.1.7")
+	require.Nil(t, err)
+	require.Equal(t, "10.244.1.7/32", n.String())
+	n, err = HostNet("fd00::7")
+	require.Nil(t, err)
+	require.Equal(t, "fd00::7/128", n.String())
+	_, err = HostNet("pod")
+	require.Error(t, err)
+}
+
+func TestAllowsAll(t *testing.T) {
+	nets, err := ParseCIDRs("127.0.0.0/8,10.96.0.0/12")
+	require.Nil(t, err)
+	require.False(t, AllowsAll(nets))
+	nets, err = ParseCIDRs("127.0.0.0/8,0.0.0.0/0")
+	require.Nil(t, err)
+	require.True(t, AllowsAll(nets))
+}
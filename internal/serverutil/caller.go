@@ -0,0 +1,65 @@
+package serverutil
+
+import (
+	"net/http"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+)
+
+// RequestIDHeader is the header callers can use to correlate their requests with tasks
+const RequestIDHeader = "X-Request-ID"
+
+// Caller returns the identity and metadata of the request, the identity is
+// taken from the client certificate that was verified during the TLS handshake
+func Caller(r *http.Request) api.Caller {
+	return api.Caller{
+		Identity:   Identity(r),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		RequestID:  r.Header.Get(RequestIDHeader),
+		ReceivedAt: clock.Now().UTC(),
+	}
+}
+
+// Identity returns the common name of the verified client certificate or its
+// first DNS name, it is empty for plain HTTP requests
+func Identity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// RequireIdentity rejects requests whose client certificate identity is not one of identities,
+// an empty list allows every verified client certificate
+func RequireIdentity(identities []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := Identity(r)
+		if id == "" {
+			HttpError(w, http.StatusUnauthorized)
+			return
+		}
+		if len(identities) > 0 && !contains(identities, id) {
+			HttpError(w, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package serverutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaller(t *testing.T) {
+	tests := []struct {
+		name         string
+		cert         *x509.Certificate
+		wantIdentity string
+	}{
+		{"plain http", nil, ""},
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "hazelcast-platform-controller-manager"}, DNSNames: []string{"operator.svc"}}, "hazelcast-platform-controller-manager"},
+		{"dns name", &x509.Certificate{DNSNames: []string{"operator.svc"}}, "operator.svc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "https://agent/upload", nil)
+			r.TLS = nil
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			r.Header.Set(RequestIDHeader, "abc")
+			r.Header.Set("User-Agent", "kubectl")
+
+			c := Caller(r)
+			require.Equal(t, tt.wantIdentity, c.Identity)
+			require.Equal(t, "abc", c.RequestID)
+			require.Equal(t, "kubectl", c.UserAgent)
+			require.Equal(t, r.RemoteAddr, c.RemoteAddr)
+			require.False(t, c.ReceivedAt.IsZero())
+		})
+	}
+}
+
+func TestRequireIdentity(t *testing.T) {
+	operator := &x509.Certificate{Subject: pkix.Name{CommonName: "hazelcast-platform-controller-manager"}}
+	other := &x509.Certificate{Subject: pkix.Name{CommonName: "someone"}}
+	tests := []struct {
+		name       string
+		identities []string
+		cert       *x509.Certificate
+		want       int
+	}{
+		{"plain http", nil, nil, http.StatusUnauthorized},
+		{"any verified client", nil, other, http.StatusOK},
+		{"allowed identity", []string{"hazelcast-platform-controller-manager"}, operator, http.StatusOK},
+		{"other identity", []string{"hazelcast-platform-controller-manager"}, other, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireIdentity(tt.identities, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest("GET", "https://agent/debug/runtime", nil)
+			r.TLS = nil
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.want, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package serverutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"gocloud.dev/gcerrors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// Error classes of failed requests, handlers wrap their errors with them and respond with
+// HttpErrorFor so clients can tell which failures are worth retrying
+var (
+	ErrInvalid      = errors.New("invalid request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrThrottled    = errors.New("too many requests")
+	ErrUnavailable  = errors.New("temporarily unavailable")
+)
+
+// statusCodes maps the error classes to the status codes, the first matching class wins
+var statusCodes = []struct {
+	class error
+	code  int
+}{
+	{ErrInvalid, http.StatusBadRequest},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrConflict, http.StatusConflict},
+	{ErrThrottled, http.StatusTooManyRequests},
+	{ErrUnavailable, http.StatusServiceUnavailable},
+}
+
+// classError adds an error class to an error without changing its message
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+func (e *classError) Is(target error) bool {
+	return e.class == target
+}
+
+// WithClass wraps err with one of the error classes, nil stays nil
+func WithClass(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// StatusCode returns the status code of the response to a failed request. Errors without a
+// class are classified by the errors of the bucket, Kubernetes and file system APIs, all
+// others are internal server errors.
+func StatusCode(err error) int {
+	for _, s := range statusCodes {
+		if errors.Is(err, s.class) {
+			return s.code
+		}
+	}
+
+	var valErr *api.ValidationError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &valErr), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return http.StatusBadRequest
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+
+	switch {
+	case apierrors.IsBadRequest(err), apierrors.IsInvalid(err):
+		return http.StatusBadRequest
+	case apierrors.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return http.StatusConflict
+	case apierrors.IsTooManyRequests(err):
+		return http.StatusTooManyRequests
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsServiceUnavailable(err):
+		return http.StatusServiceUnavailable
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.InvalidArgument:
+		return http.StatusBadRequest
+	case gcerrors.PermissionDenied:
+		return http.StatusForbidden
+	case gcerrors.NotFound:
+		return http.StatusNotFound
+	case gcerrors.AlreadyExists, gcerrors.FailedPrecondition:
+		return http.StatusConflict
+	case gcerrors.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case gcerrors.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// HttpErrorFor responds with the status code of err
+func HttpErrorFor(w http.ResponseWriter, err error) {
+	HttpError(w, StatusCode(err))
+}
@@ -0,0 +1,77 @@
+package serverutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func TestStatusCode(t *testing.T) {
+	secret := schema.GroupResource{Resource: "secrets"}
+	_, notExist := os.Stat("/does/not/exist")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid", WithClass(ErrInvalid, errors.New("bad")), http.StatusBadRequest},
+		{"wrapped class", fmt.Errorf("listing: %w", WithClass(ErrNotFound, errors.New("gone"))), http.StatusNotFound},
+		{"unauthorized", WithClass(ErrUnauthorized, errors.New("no token")), http.StatusUnauthorized},
+		{"forbidden", WithClass(ErrForbidden, errors.New("denied")), http.StatusForbidden},
+		{"conflict", WithClass(ErrConflict, errors.New("locked")), http.StatusConflict},
+		{"throttled", WithClass(ErrThrottled, errors.New("queue full")), http.StatusTooManyRequests},
+		{"unavailable", WithClass(ErrUnavailable, errors.New("try again")), http.StatusServiceUnavailable},
+		{"validation", &api.ValidationError{Field: "bucket_url", Reason: "is required"}, http.StatusBadRequest},
+		{"missing file", notExist, http.StatusNotFound},
+		{"deadline", fmt.Errorf("uploading: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"secret forbidden", apierrors.NewForbidden(secret, "creds", errors.New("rbac")), http.StatusForbidden},
+		{"secret not found", apierrors.NewNotFound(secret, "creds"), http.StatusNotFound},
+		{"api throttled", apierrors.NewTooManyRequests("slow down", 1), http.StatusTooManyRequests},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, StatusCode(tt.err))
+		})
+	}
+}
+
+func TestWithClass(t *testing.T) {
+	require.Nil(t, WithClass(ErrInvalid, nil))
+
+	cause := errors.New("bad limit")
+	err := WithClass(ErrInvalid, cause)
+	require.Equal(t, "bad limit", err.Error(), "the class does not change the message")
+	require.True(t, errors.Is(err, cause))
+	require.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestDecodeBodyInvalid(t *testing.T) {
+	var v struct{ Name string }
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"Name": 1}`))
+	err := DecodeBody(r, &v)
+	require.True(t, errors.Is(err, ErrInvalid), "Error is: ", err)
+
+	rec := httptest.NewRecorder()
+	HttpErrorFor(rec, err)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// unknown fields are only logged
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"Name": "hz", "unknown": 1}`))
+	require.Nil(t, DecodeBody(r, &v))
+	require.Equal(t, "hz", v.Name)
+	require.Equal(t, "unknown", unknownField([]byte(`{"Name": "hz", "unknown": 1}`), &v))
+	require.Empty(t, unknownField([]byte(`{"Name": "hz"}`), &v))
+}
@@ -1,23 +1,70 @@
 package serverutil
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
 )
 
+var serverLog = logger.New().Named("server")
+
+// DecodeBody decodes the JSON body into v and validates it if it implements api.Validator, errors
+// are of the ErrInvalid class. Unknown fields are only logged, so that an operator newer than the
+// agent can send fields the agent does not know yet.
 func DecodeBody(r *http.Request, v interface{}) error {
 	defer r.Body.Close()
-	d := json.NewDecoder(r.Body)
-	if err := d.Decode(v); err != nil {
-		return err
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return WithClass(ErrInvalid, err)
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return WithClass(ErrInvalid, err)
+	}
+	if field := unknownField(body, v); field != "" {
+		serverLog.Warn("ignoring unknown field of the request body", zap.String("field", field), zap.String("path", r.URL.Path))
+	}
+	if val, ok := v.(api.Validator); ok {
+		return WithClass(ErrInvalid, val.Validate())
 	}
 	return nil
 }
 
+// unknownField returns the first field of the body that v does not have, empty if there is none
+func unknownField(body []byte, v interface{}) string {
+	strict := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.DisallowUnknownFields()
+	err := d.Decode(strict)
+	if err == nil || !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+}
+
 func HttpError(w http.ResponseWriter, code int) {
 	http.Error(w, http.StatusText(code), code)
 }
 
+// HttpJSONStatus writes v with the status code, HttpJSON always responds with 200
+func HttpJSONStatus(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		HttpError(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(append(data, '\n'))
+}
+
 func HttpJSON(w http.ResponseWriter, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	e := json.NewEncoder(w)
@@ -0,0 +1,128 @@
+package termination
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/local"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+// DefaultPath is the default terminationMessagePath of Kubernetes containers
+const DefaultPath = "/dev/termination-log"
+
+// maxSize is the limit of a termination message, longer messages are truncated by the kubelet
+const maxSize = 4096
+
+// Config is the destination of the termination message
+type Config struct {
+	Path string `envconfig:"TERMINATION_MESSAGE_PATH" default:"/dev/termination-log" desc:"file the outcome summary is written to, empty disables it"`
+}
+
+var config = loadConfig()
+
+func loadConfig() Config {
+	var c Config
+	if err := envconfig.Process("termination", &c); err != nil {
+		return Config{Path: DefaultPath}
+	}
+	return c
+}
+
+var log = logger.New().Named("termination")
+
+// Summary is the outcome of a command, kubectl shows it in the container's terminated state
+type Summary struct {
+	Command  string      `json:"command"`
+	Status   string      `json:"status"`
+	Message  string      `json:"message,omitempty"`
+	Duration string      `json:"duration"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+var mu sync.Mutex
+
+// Write writes the summary as JSON to the termination message path. Outside of
+// Kubernetes the default path does not exist and nothing is written, in local mode
+// the summary is written to the state directory instead.
+func Write(s Summary) error {
+	name := config.Path
+	if name == DefaultPath && local.Enabled {
+		var err error
+		if name, err = local.StatePath("termination-log"); err != nil {
+			return err
+		}
+	}
+	return write(name, s)
+}
+
+func write(name string, s Summary) error {
+	if name == "" {
+		return nil
+	}
+	if name == DefaultPath {
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+
+	data, err := marshal(s)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return os.WriteFile(name, data, 0644)
+}
+
+// marshal drops the details and then shortens the message until the summary fits into a termination message
+func marshal(s Summary) ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil || len(data) <= maxSize {
+		return data, err
+	}
+	s.Details = nil
+	if data, err = json.Marshal(s); err != nil || len(data) <= maxSize {
+		return data, err
+	}
+	msg := s.Message
+	for len(data) > maxSize && msg != "" {
+		cut := len(data) - maxSize + len("...")
+		if cut > len(msg) {
+			cut = len(msg)
+		}
+		msg = strings.ToValidUTF8(msg[:len(msg)-cut], "")
+		s.Message = msg + "..."
+		if data, err = json.Marshal(s); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Report writes the outcome of a command that was started at start, failures use the last logged error as
+// message. Errors are only logged, the summary must not change the exit status of the command.
+func Report(command string, status subcommands.ExitStatus, start time.Time, details interface{}) {
+	s := Summary{
+		Command:  command,
+		Status:   api.StatusSuccess,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Details:  details,
+	}
+	if status != subcommands.ExitSuccess {
+		s.Status = api.StatusFailure
+		s.Message = logger.LastError()
+	}
+	if err := Write(s); err != nil {
+		log.Warn("could not write termination message: " + err.Error())
+	}
+}
@@ -0,0 +1,55 @@
+package termination
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "termination")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	name := path.Join(tmpdir, "termination-log")
+	s := Summary{Command: "restore_pvc", Status: "FAILURE", Message: "access denied", Duration: "1.5s", Details: map[string]interface{}{"bytes": 0.0}}
+	require.Nil(t, write(name, s))
+
+	data, err := os.ReadFile(name)
+	require.Nil(t, err)
+	var got Summary
+	require.Nil(t, json.Unmarshal(data, &got))
+	require.Equal(t, s, got)
+
+	// disabled
+	require.Nil(t, write("", s))
+}
+
+func TestMarshalLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		summary     Summary
+		wantDetails bool
+		wantSuffix  string
+	}{
+		{"small", Summary{Command: "verify", Message: "ok", Details: []int{1}}, true, "ok"},
+		{"large details", Summary{Command: "verify", Message: "ok", Details: strings.Repeat("x", maxSize)}, false, "ok"},
+		{"large message", Summary{Command: "verify", Message: strings.Repeat("\"ü", maxSize)}, false, "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := marshal(tt.summary)
+			require.Nil(t, err)
+			require.LessOrEqual(t, len(data), maxSize)
+
+			var got Summary
+			require.Nil(t, json.Unmarshal(data, &got))
+			require.Equal(t, tt.wantDetails, got.Details != nil)
+			require.True(t, strings.HasSuffix(got.Message, tt.wantSuffix), got.Message)
+		})
+	}
+}
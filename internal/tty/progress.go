@@ -0,0 +1,234 @@
+// Package tty shows the progress of long transfers. Run from a terminal, e.g. while debugging a
+// restore locally, the agent draws progress bars with an ETA. Otherwise the progress is logged as lines.
+package tty
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// drawInterval is the redraw interval of the bars in a terminal
+const drawInterval = 200 * time.Millisecond
+
+// barWidth is the number of characters of the bar itself
+const barWidth = 20
+
+// Counter returns the bytes done and the total, the total is 0 if unknown
+type Counter func() (done, total int64)
+
+type bar struct {
+	label string
+	count Counter
+	start time.Time
+}
+
+// Progress shows the bars added to it. In a terminal all bars share one line that is redrawn, so
+// that log lines written in between are not overwritten. Otherwise every bar is logged once per
+// log interval.
+type Progress struct {
+	out         io.Writer
+	terminal    bool
+	log         *zap.Logger
+	logInterval time.Duration
+
+	mu   sync.Mutex
+	bars []*bar
+	stop chan struct{}
+	done chan struct{}
+	// width is the length of the line drawn last, it is cleared before the next one
+	width int
+}
+
+// New returns the progress of the terminal f, or logs the progress with log every logInterval if f is
+// not a terminal. A zero interval disables the logs.
+func New(f *os.File, log *zap.Logger, logInterval time.Duration) *Progress {
+	return &Progress{out: f, terminal: IsTerminal(f), log: log, logInterval: logInterval}
+}
+
+// Enabled reports whether the bars are shown, a nil Progress shows nothing
+func (p *Progress) Enabled() bool {
+	return p != nil && (p.terminal || p.logInterval > 0)
+}
+
+// Add shows a new bar until the returned function is called
+func (p *Progress) Add(label string, count Counter) func() {
+	if !p.Enabled() {
+		return func() {}
+	}
+	b := &bar{label: label, count: count, start: time.Now()}
+
+	p.mu.Lock()
+	p.bars = append(p.bars, b)
+	if p.stop == nil {
+		p.stop, p.done = make(chan struct{}), make(chan struct{})
+		go p.run(p.stop, p.done)
+	}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { p.remove(b) }) }
+}
+
+func (p *Progress) remove(b *bar) {
+	p.mu.Lock()
+	for i := range p.bars {
+		if p.bars[i] == b {
+			p.bars = append(p.bars[:i], p.bars[i+1:]...)
+			break
+		}
+	}
+	// the final state of the bar is kept above the line of the others
+	if done, total := b.count(); p.terminal && done > 0 {
+		p.clear()
+		fmt.Fprintln(p.out, b.label+" "+format(done, total, time.Since(b.start), true))
+		p.draw()
+	}
+	var stop, finished chan struct{}
+	if len(p.bars) == 0 && p.stop != nil {
+		stop, finished = p.stop, p.done
+		p.stop, p.done = nil, nil
+	}
+	p.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-finished
+	}
+}
+
+func (p *Progress) run(stop, done chan struct{}) {
+	defer close(done)
+	interval := p.logInterval
+	if p.terminal {
+		interval = drawInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.terminal {
+				p.draw()
+			} else {
+				p.logBars()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw redraws the line of the bars, the caller holds the lock
+func (p *Progress) draw() {
+	var parts []string
+	for _, b := range p.bars {
+		done, total := b.count()
+		// bars that did not start yet, e.g. the extraction of an archive that is still staged, are hidden
+		if done == 0 {
+			continue
+		}
+		parts = append(parts, b.label+" "+format(done, total, time.Since(b.start), false))
+	}
+	line := strings.Join(parts, " | ")
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 1 && len(line) >= cols {
+		line = line[:cols-1]
+	}
+	p.clear()
+	fmt.Fprint(p.out, line)
+	p.width = len(line)
+}
+
+// clear returns to the start of the line drawn last and erases it
+func (p *Progress) clear() {
+	if p.width > 0 {
+		fmt.Fprint(p.out, "\r\x1b[K")
+		p.width = 0
+	}
+}
+
+func (p *Progress) logBars() {
+	for _, b := range p.bars {
+		done, total := b.count()
+		if done == 0 {
+			continue
+		}
+		fields := []zap.Field{zap.Int64("bytes", done)}
+		if total > 0 {
+			fields = append(fields, zap.Int64("total", total))
+		}
+		if eta, ok := remaining(done, total, time.Since(b.start)); ok {
+			fields = append(fields, zap.Duration("eta", eta))
+		}
+		p.log.Info(b.label+" progress", fields...)
+	}
+}
+
+// format renders the state of a bar, e.g. [=========>          ]  45%  1.2 GiB/2.6 GiB  85.3 MiB/s  ETA 17s.
+// Without a total only the bytes and the rate are shown.
+func format(done, total int64, elapsed time.Duration, finished bool) string {
+	var rate float64
+	if s := elapsed.Seconds(); s > 0 {
+		rate = float64(done) / s
+	}
+	if finished {
+		return fmt.Sprintf("%s in %s (%s/s)", formatBytes(float64(done)), elapsed.Round(time.Second), formatBytes(rate))
+	}
+	if total <= 0 {
+		return fmt.Sprintf("%s  %s/s", formatBytes(float64(done)), formatBytes(rate))
+	}
+
+	// estimated totals can be exceeded, the bar stays short of complete until it is removed
+	frac := float64(done) / float64(total)
+	if frac > 0.99 {
+		frac = 0.99
+	}
+	filled := int(frac * barWidth)
+	b := strings.Repeat("=", filled) + ">" + strings.Repeat(" ", barWidth-filled-1)
+	s := fmt.Sprintf("[%s] %3d%%  %s/%s  %s/s", b, int(frac*100), formatBytes(float64(done)), formatBytes(float64(total)), formatBytes(rate))
+	if eta, ok := remaining(done, total, elapsed); ok {
+		s += "  ETA " + eta.String()
+	}
+	return s
+}
+
+// remaining extrapolates the time left from the average rate so far
+func remaining(done, total int64, elapsed time.Duration) (time.Duration, bool) {
+	if total <= 0 || done <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+	left := total - done
+	if left < 0 {
+		left = 0
+	}
+	eta := time.Duration(float64(elapsed) * float64(left) / float64(done))
+	return eta.Round(time.Second), true
+}
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+func formatBytes(n float64) string {
+	i := 0
+	for n >= 1024 && i < len(byteUnits)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, byteUnits[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, byteUnits[i])
+}
@@ -0,0 +1,95 @@
+package tty
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		done     int64
+		total    int64
+		elapsed  time.Duration
+		finished bool
+		want     string
+	}{
+		{"half", 512 << 20, 1 << 30, 10 * time.Second, false, "[==========>         ]  50%  512.0 MiB/1.0 GiB  51.2 MiB/s  ETA 10s"},
+		{"unknown total", 3 << 10, 0, time.Second, false, "3.0 KiB  3.0 KiB/s"},
+		{"exceeded estimate", 2 << 30, 1 << 30, 10 * time.Second, false, "[===================>]  99%  2.0 GiB/1.0 GiB  204.8 MiB/s  ETA 0s"},
+		{"finished", 1 << 30, 1 << 30, 20 * time.Second, true, "1.0 GiB in 20s (51.2 MiB/s)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, format(tt.done, tt.total, tt.elapsed, tt.finished))
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "0 B", formatBytes(0))
+	require.Equal(t, "1023 B", formatBytes(1023))
+	require.Equal(t, "1.5 KiB", formatBytes(1536))
+	require.Equal(t, "2.0 TiB", formatBytes(2<<40))
+}
+
+func TestProgressTerminal(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, terminal: true}
+	var n atomic.Int64
+	remove := p.Add("download", func() (int64, int64) { return n.Load(), 100 })
+	idle := p.Add("extract", func() (int64, int64) { return 0, 0 })
+
+	n.Store(50)
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+	require.Contains(t, out.String(), "download [")
+	// bars that did not start are hidden
+	require.NotContains(t, out.String(), "extract")
+
+	n.Store(100)
+	remove()
+	remove()
+	idle()
+	require.Equal(t, 1, strings.Count(out.String(), "\n"))
+	require.Contains(t, out.String(), "\r\x1b[Kdownload 100 B in")
+	require.Nil(t, p.stop)
+}
+
+func TestProgressLogs(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	p := &Progress{out: &bytes.Buffer{}, log: zap.New(core), logInterval: 10 * time.Millisecond}
+	remove := p.Add("upload", func() (int64, int64) { return 10, 100 })
+	require.Eventually(t, func() bool { return logs.FilterMessage("upload progress").Len() > 0 }, time.Second, 10*time.Millisecond)
+	remove()
+
+	e := logs.FilterMessage("upload progress").All()[0]
+	require.Equal(t, int64(10), e.ContextMap()["bytes"])
+	require.Equal(t, int64(100), e.ContextMap()["total"])
+}
+
+func TestProgressDisabled(t *testing.T) {
+	f, err := os.CreateTemp("", "progress")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// a file is no terminal, without log interval nothing is shown
+	require.False(t, IsTerminal(f))
+	p := New(f, zap.NewNop(), 0)
+	require.False(t, p.Enabled())
+	p.Add("download", func() (int64, int64) { return 1, 1 })()
+
+	var nilProgress *Progress
+	require.False(t, nilProgress.Enabled())
+	nilProgress.Add("download", func() (int64, int64) { return 1, 1 })()
+}
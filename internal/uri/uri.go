@@ -3,8 +3,12 @@ package uri
 import (
 	"net/url"
 	"path/filepath"
+	"strings"
 )
 
+// fileScheme is the scheme of buckets in a local directory, e.g. an NFS-backed volume
+const fileScheme = "file"
+
 func NormalizeURI(commonURI string) (uri string, err error) {
 	u, err := url.ParseRequestURI(commonURI)
 	if err != nil {
@@ -17,6 +21,15 @@ func NormalizeURI(commonURI string) (uri string, err error) {
 		RawQuery: u.RawQuery,
 	}
 
+	// the path of a file bucket is its directory on a mounted volume, not a prefix
+	if u.Scheme == fileScheme {
+		formated.Path = u.Path
+		if len(formated.Path) > 1 {
+			formated.Path = strings.TrimSuffix(formated.Path, "/")
+		}
+		return formated.String(), nil
+	}
+
 	if u.Path == "" {
 		return formated.String(), nil
 	}
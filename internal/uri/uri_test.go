@@ -17,6 +17,9 @@ func TestBasicNormalizeURI(t *testing.T) {
 		{"query", "s3://bucket-name/hazelcast?region=us-west-1", "s3://bucket-name?prefix=hazelcast/&region=us-west-1", false},
 		{"legacy", "s3://bucket-name?prefix=hazelcast/", "s3://bucket-name?prefix=hazelcast/", false},
 		{"duplicate", "s3://bucket-name/hazelcast??prefix=hazelcast", "s3://bucket-name?prefix=hazelcast/", false},
+		{"file", "file:///mnt/backups/", "file:///mnt/backups", false},
+		{"file root", "file:///", "file:///", false},
+		{"file prefix", "file:///mnt/backups?prefix=hazelcast/", "file:///mnt/backups?prefix=hazelcast/", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -43,6 +46,7 @@ func TestAddFolderKeyToURI(t *testing.T) {
 		{"with folder", "gs://bucket-name", "prefix/seq1", "gs://bucket-name?prefix=prefix/seq1", false},
 		{"without prefix", "s3://bucket-name/hazelcast", "seq2", "s3://bucket-name?prefix=hazelcast/seq2", false},
 		{"with prefix", "s3://bucket-name?prefix=hazelcast/", "seq2", "s3://bucket-name?prefix=hazelcast/seq2", false},
+		{"file", "file:///mnt/backups", "prefix/seq1", "file:///mnt/backups?prefix=prefix/seq1", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,19 @@
+// Package version reports the version of the agent
+package version
+
+import "runtime/debug"
+
+// Version is set when the image is built, e.g. with
+// -ldflags "-X github.com/hazelcast/platform-operator-agent/internal/version.Version=1.2.3"
+var Version = ""
+
+// Get returns the version the agent was built with, the version of the main module if none was set
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
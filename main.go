@@ -4,13 +4,25 @@ import (
 	"context"
 	"flag"
 	"os"
+	_ "time/tzdata"
 
 	"github.com/google/subcommands"
 
+	"github.com/hazelcast/platform-operator-agent/catalog"
+	"github.com/hazelcast/platform-operator-agent/docs"
+	"github.com/hazelcast/platform-operator-agent/init/license"
 	"github.com/hazelcast/platform-operator-agent/init/restore"
 	"github.com/hazelcast/platform-operator-agent/init/usercode_bucket"
+	"github.com/hazelcast/platform-operator-agent/init/usercode_git"
 	"github.com/hazelcast/platform-operator-agent/init/usercode_url"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/local"
+	"github.com/hazelcast/platform-operator-agent/internal/netutil"
+	"github.com/hazelcast/platform-operator-agent/internal/notify"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
 	"github.com/hazelcast/platform-operator-agent/sidecar"
+	"github.com/hazelcast/platform-operator-agent/verify"
 )
 
 func main() {
@@ -20,12 +32,25 @@ func main() {
 
 	subcommands.Register(&usercode_bucket.Cmd{}, "")
 	subcommands.Register(&usercode_url.Cmd{}, "")
+	subcommands.Register(&usercode_git.Cmd{}, "")
 	subcommands.Register(&restore.LocalInPVCCmd{}, "")
 	subcommands.Register(&restore.BucketToPVCCmd{}, "")
+	subcommands.Register(&license.Cmd{}, "")
 	subcommands.Register(&sidecar.Cmd{}, "")
+	subcommands.Register(&verify.Cmd{}, "")
+	subcommands.Register(&catalog.Cmd{}, "")
+	subcommands.Register(&docs.Cmd{}, "")
 
+	config.Register(&usercode_bucket.Cmd{}, &usercode_url.Cmd{}, &usercode_git.Cmd{},
+		&restore.LocalInPVCCmd{}, &restore.BucketToPVCCmd{}, &license.Cmd{}, &sidecar.Cmd{}, &verify.Cmd{}, &catalog.AggregateCmd{}, &bucket.Tuning{}, &netutil.Config{}, &notify.Config{}, &termination.Config{}, &bucket.SecretFallback{})
+
+	flag.BoolVar(&config.Strict, "strict", config.Strict, "reject unknown agent environment variables and arguments")
+	flag.BoolVar(&local.Enabled, "local-mode", local.Enabled, "run outside of Kubernetes, credentials and state are read from the user directories")
 	flag.Parse()
 
+	// storage SDKs and webhooks use the default transport
+	netutil.InstallDefaultTransport()
+
 	ctx := context.Background()
 	os.Exit(int(subcommands.Execute(ctx)))
 }
@@ -0,0 +1,105 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+func (s *Service) batchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req api.BatchUploadReq
+	if err := serverutil.DecodeBody(r, &req); err != nil {
+		routerLog.Error("error occurred while parsing body: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+
+	ID, waiting, err := s.startBatch(req, serverutil.Caller(r))
+	if err != nil {
+		if errors.Is(err, errQueueFull) {
+			s.backpressure(w, waiting)
+		}
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+	if waiting > 0 {
+		s.backpressure(w, waiting)
+		serverutil.HttpJSONStatus(w, http.StatusAccepted, UploadResp{ID: ID})
+		return
+	}
+
+	serverutil.HttpJSON(w, UploadResp{ID: ID})
+}
+
+// startBatch submits a task that uploads the items of the request one after the other. It takes a
+// single slot of the queue, the items are canceled with it.
+func (s *Service) startBatch(req api.BatchUploadReq, caller api.Caller) (uuid.UUID, int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := s.newTask(ctx, cancel, req.UploadReq, caller)
+	for i := range req.Items {
+		ictx, icancel := context.WithCancel(ctx)
+		item := s.newTask(ictx, icancel, req.Item(i), caller)
+		item.uploaded = new(atomic.Int64)
+		t.batch = append(t.batch, item)
+	}
+	return s.submit(t)
+}
+
+// processBatch uploads the items in the order of the request, a failed item does not stop the others
+func (t *task) processBatch(ID uuid.UUID) {
+	failed := 0
+	for i, item := range t.batch {
+		if t.ctx.Err() != nil {
+			item.err = t.ctx.Err()
+			item.cancel()
+			continue
+		}
+		backupLog.Info("batch task uploads item", zap.Uint32("task id", ID.ID()), zap.Int("item", i),
+			zap.String("backup base dir", item.req.BackupBaseDir), zap.Int("member id", item.req.MemberID))
+		item.process(ID)
+		if failedStatus(item.status().Status) {
+			failed++
+		}
+	}
+
+	switch {
+	case t.ctx.Err() != nil:
+		t.err = t.ctx.Err()
+	case failed > 0:
+		t.err = fmt.Errorf("%d of %d backups of the batch failed", failed, len(t.batch))
+	}
+}
+
+// batchStatus returns the aggregate progress of the items of a batch upload
+func (t *task) batchStatus() *api.BatchStatus {
+	b := &api.BatchStatus{Total: len(t.batch), Items: make([]api.BatchItemStatus, 0, len(t.batch))}
+	for _, item := range t.batch {
+		st := item.status()
+		// the caller of the batch is the caller of every item
+		st.Caller = nil
+		if st.Status != api.StatusInProgress {
+			b.Done++
+		}
+		if failedStatus(st.Status) {
+			b.Failed++
+		}
+		b.UploadedBytes += item.uploaded.Load()
+		b.Items = append(b.Items, api.BatchItemStatus{
+			BatchItem:  api.BatchItem{BackupBaseDir: item.req.BackupBaseDir, HazelcastCRName: item.req.HazelcastCRName, MemberID: item.req.MemberID},
+			StatusResp: st,
+		})
+	}
+	return b
+}
+
+func failedStatus(status string) bool {
+	return status == api.StatusFailure || status == api.StatusSizeExceeded
+}
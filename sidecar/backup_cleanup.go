@@ -0,0 +1,346 @@
+package sidecar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/fsys"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+var (
+	errUploadInProgress = serverutil.WithClass(serverutil.ErrConflict, errors.New("an upload of the backup base dir is in progress"))
+	errUnknownBaseDir   = serverutil.WithClass(serverutil.ErrInvalid, errors.New("backup base dir is neither configured nor used by a task"))
+)
+
+// cleanLocal deletes the local backups of the member whose upload was verified. The archive of the
+// upload is read back from the bucket and compared with its checksum, its sequence is then recorded
+// as verified, so that the persistence volume does not fill up.
+func (t *task) cleanLocal(ID uuid.UUID, bucketURL, key string, secretData map[string][]byte) *api.LocalCleanup {
+	if !t.localCleanup || t.req.Snapshot {
+		return nil
+	}
+	backupsDir := path.Join(t.req.BackupBaseDir, DirName)
+	seq, err := t.verifyUpload(bucketURL, key, secretData)
+	if err == nil {
+		err = recordVerified(backupsDir, t.req.MemberID, seq)
+	}
+	if err != nil {
+		backupLog.Error("task keeps the local backups, the upload could not be verified: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		return &api.LocalCleanup{Deleted: []string{}, Message: logger.Redact(err.Error())}
+	}
+
+	res, err := cleanLocalBackups(backupsDir, t.req.MemberID)
+	if err != nil {
+		backupLog.Error("task could not delete local backups: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		res.Message = err.Error()
+	}
+	backupLog.Info("task deleted local backups", zap.Uint32("task id", ID.ID()), zap.Strings("backups", res.Deleted), zap.Int64("bytes", res.Bytes))
+	return res
+}
+
+// verifyUpload reads the archive stored under key and compares it with its checksum, it returns the
+// backup sequence the archive was created from
+func (t *task) verifyUpload(bucketURL, key string, secretData map[string][]byte) (string, error) {
+	bucketURI, err := uri.NormalizeURI(bucketURL)
+	if err != nil {
+		return "", err
+	}
+	b, release, err := t.buckets.Open(t.ctx, bucketURI, secretData)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if err = verifyArchive(t.ctx, b, key); err != nil {
+		return "", err
+	}
+	m, err := archive.ReadArchiveManifest(t.ctx, b, key)
+	if err != nil {
+		return "", err
+	}
+	if m == nil || m.Sequence == "" {
+		return "", fmt.Errorf("archive %s has no manifest naming its backup sequence", key)
+	}
+	return m.Sequence, nil
+}
+
+// verifiedName is the file in the backups dir listing the backup sequences whose upload of the member
+// was verified
+func verifiedName(backupsDir string, memberID int) string {
+	return filepath.Join(backupsDir, fmt.Sprintf(".verified-%d.json", memberID))
+}
+
+func readVerified(name string) (map[string]bool, error) {
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var seqs []string
+	if err = json.Unmarshal(data, &seqs); err != nil {
+		return nil, err
+	}
+	verified := make(map[string]bool, len(seqs))
+	for _, seq := range seqs {
+		verified[seq] = true
+	}
+	return verified, nil
+}
+
+func writeVerified(name string, verified map[string]bool) error {
+	seqs := make([]string, 0, len(verified))
+	for seq := range verified {
+		seqs = append(seqs, seq)
+	}
+	sort.Strings(seqs)
+	data, err := json.Marshal(seqs)
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(name, data, 0600)
+}
+
+// recordVerified adds the sequence to the verified uploads of the member
+func recordVerified(backupsDir string, memberID int, seq string) error {
+	name := verifiedName(backupsDir, memberID)
+	verified, err := readVerified(name)
+	if err != nil {
+		return err
+	}
+	verified[seq] = true
+	return writeVerified(name, verified)
+}
+
+func verifyArchive(ctx context.Context, b *blob.Bucket, key string) error {
+	want, err := archive.ReadChecksum(ctx, b, key)
+	if err != nil {
+		return err
+	}
+	if want == nil {
+		// the reader verifies the digest of every object of an incremental archive
+		incremental, err := archive.Incremental(ctx, b, key)
+		if err != nil {
+			return err
+		}
+		if !incremental {
+			return fmt.Errorf("archive %s has no checksum", key)
+		}
+	}
+	r, err := archive.NewReader(ctx, b, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return err
+	}
+	if want == nil {
+		return nil
+	}
+	return archive.VerifyChecksum(key, want, h.Sum(nil))
+}
+
+// cleanLocalBackups deletes the backups of the member in backupsDir whose upload was verified. The
+// latest backup is kept even once it is verified, Hot Restart may still write it and the schedule
+// dates its last run by it, it is deleted by the cleanup after the next backup. A sequence folder is
+// deleted once it holds no backup of any member.
+func cleanLocalBackups(backupsDir string, memberID int) (*api.LocalCleanup, error) {
+	res := &api.LocalCleanup{Deleted: []string{}}
+	name := verifiedName(backupsDir, memberID)
+	verified, err := readVerified(name)
+	if err != nil {
+		return res, err
+	}
+	seqs, err := fileutil.FolderSequence(backupsDir)
+	if err != nil {
+		return res, err
+	}
+
+	exists := make(map[string]bool, len(seqs))
+	for _, seq := range seqs {
+		exists[seq.Name()] = true
+	}
+	// sequences that no longer exist or hold no backup of the member are forgotten, the index of the
+	// member points to the backup of another member once its own is deleted
+	changed := false
+	defer func() {
+		for seq := range verified {
+			if !exists[seq] {
+				delete(verified, seq)
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+		if werr := writeVerified(name, verified); werr != nil {
+			backupLog.Warn("could not write verified uploads: " + werr.Error())
+		}
+	}()
+
+	if len(seqs) > 0 {
+		seqs = seqs[:len(seqs)-1]
+	}
+	for _, seq := range seqs {
+		if !verified[seq.Name()] {
+			continue
+		}
+		seqDir := filepath.Join(backupsDir, seq.Name())
+		uuids, err := fileutil.FolderUUIDs(seqDir)
+		if err != nil {
+			return res, err
+		}
+		// If there is only one backup, members are isolated. No need for memberID
+		id := memberID
+		if len(uuids) == 1 {
+			id = 0
+		}
+		if id < len(uuids) {
+			dir := filepath.Join(seqDir, uuids[id].Name())
+			files, err := scanBackup(dir)
+			if err != nil {
+				return res, err
+			}
+			if err = removeBackup(dir); err != nil {
+				return res, err
+			}
+			for _, f := range files {
+				res.Bytes += f.Size
+			}
+			res.Deleted = append(res.Deleted, path.Join(seq.Name(), uuids[id].Name()))
+		}
+		delete(verified, seq.Name())
+		changed = true
+
+		if uuids, err = fileutil.FolderUUIDs(seqDir); err != nil {
+			return res, err
+		}
+		if len(uuids) == 0 {
+			if err = fsys.RemoveAll(seqDir); err != nil {
+				return res, err
+			}
+
+		}
+	}
+	return res, nil
+}
+
+// removeBackup deletes the backup folder with its upload markers
+func removeBackup(dir string) error {
+	if err := fsys.RemoveAll(dir); err != nil {
+		return err
+	}
+	for _, suffix := range []string{".delete", ".progress"} {
+		if err := fsys.Remove(dir + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploading reports whether a task uploading from the backup base dir is running or queued
+func (s *Service) uploading(baseDir string) bool {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	for _, t := range s.Tasks {
+		if t.ctx.Err() != nil {
+			continue
+		}
+		if t.req.BackupBaseDir == baseDir {
+			return true
+		}
+		for _, item := range t.batch {
+			if item.req.BackupBaseDir == baseDir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// knownBaseDir reports whether dir is the configured backup base dir, or the one of a task if
+// none is configured
+func (s *Service) knownBaseDir(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	dir = filepath.Clean(dir)
+	if s.BaseDir != "" {
+		return dir == filepath.Clean(s.BaseDir)
+	}
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	for _, t := range s.Tasks {
+		if filepath.Clean(t.req.BackupBaseDir) == dir {
+			return true
+		}
+		for _, item := range t.batch {
+			if filepath.Clean(item.req.BackupBaseDir) == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Service) cleanLocalHandler(w http.ResponseWriter, r *http.Request) {
+	var req Req
+	if err := serverutil.DecodeBody(r, &req); err != nil {
+		routerLog.Error("error occurred while parsing body: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+
+	// only the backups of the member of the sidecar may be deleted
+	if !s.knownBaseDir(req.BackupBaseDir) {
+		serverutil.HttpErrorFor(w, errUnknownBaseDir)
+		return
+	}
+	// a backup that became older while it is uploaded must not be deleted
+	if s.uploading(req.BackupBaseDir) {
+		serverutil.HttpErrorFor(w, errUploadInProgress)
+		return
+	}
+	// the member writes a new sequence folder while it creates a backup, the cleanup does not wait for it
+	member := s.Member
+	member.Policy = MemberPolicyReject
+	if err := member.waitIdle(r.Context()); errors.Is(err, ErrMemberBusy) {
+		serverutil.HttpErrorFor(w, serverutil.WithClass(serverutil.ErrConflict, err))
+		return
+	} else if err != nil {
+		routerLog.Error("error checking the member: " + err.Error())
+		serverutil.HttpErrorFor(w, serverutil.WithClass(serverutil.ErrUnavailable, err))
+		return
+	}
+
+	res, err := cleanLocalBackups(path.Join(req.BackupBaseDir, DirName), req.MemberID)
+	if err != nil {
+		routerLog.Error("error deleting local backups: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+	routerLog.Info("deleted local backups", zap.Strings("backups", res.Deleted), zap.Int64("bytes", res.Bytes))
+	serverutil.HttpJSON(w, res)
+}
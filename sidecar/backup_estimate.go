@@ -0,0 +1,218 @@
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+// fileState is compared between the latest local backup and the backup uploaded last
+type fileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// uploadRecord describes the backup uploaded last by a member, it is kept in the backups dir
+// because the uploaded backup itself is deleted
+type uploadRecord struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+	// Bytes is the size of the backup, ArchiveBytes the size of its archive in the bucket
+	Bytes        int64 `json:"bytes"`
+	ArchiveBytes int64 `json:"archive_bytes"`
+	// BytesPerSecond is the archive throughput of the last upload completed in a single window
+	BytesPerSecond float64              `json:"bytes_per_second,omitempty"`
+	Files          map[string]fileState `json:"files"`
+}
+
+func uploadRecordName(backupsDir string, memberID int) string {
+	return filepath.Join(backupsDir, fmt.Sprintf(".last-upload-%d.json", memberID))
+}
+
+func readUploadRecord(name string) (*uploadRecord, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r uploadRecord
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// recordUpload remembers the uploaded backup for the estimates of the following ones, elapsed is zero if
+// the upload took more than one window and the throughput of the previous record is kept
+func recordUpload(ctx context.Context, bucket *blob.Bucket, backupsDir string, memberID int, key string, files map[string]fileState, elapsed time.Duration) error {
+	archiveBytes, err := archiveSize(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	name := uploadRecordName(backupsDir, memberID)
+	r := uploadRecord{Key: key, Time: clock.Now(), ArchiveBytes: archiveBytes, Files: files}
+	for _, f := range files {
+		r.Bytes += f.Size
+	}
+	switch {
+	case elapsed > 0:
+		r.BytesPerSecond = float64(archiveBytes) / elapsed.Seconds()
+	default:
+		if last, err := readUploadRecord(name); err == nil && last != nil {
+			r.BytesPerSecond = last.BytesPerSecond
+		}
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0600)
+}
+
+// archiveSize returns the size of the archive, the sum of its parts if it was uploaded in parts
+func archiveSize(ctx context.Context, bucket *blob.Bucket, key string) (int64, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if err == nil {
+		return attrs.Size, nil
+	}
+	m, merr := archive.ReadManifest(ctx, bucket, key)
+	if merr != nil {
+		return 0, err
+	}
+	var size int64
+	for _, k := range m.Keys(key) {
+		attrs, err := bucket.Attributes(ctx, k)
+		if err != nil {
+			return 0, err
+		}
+		size += attrs.Size
+	}
+	return size, nil
+}
+
+// scanBackup returns the files of the backup by their path relative to dir
+func scanBackup(dir string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = fileState{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		return nil
+	})
+	return files, err
+}
+
+func (s *Service) estimateHandler(w http.ResponseWriter, r *http.Request) {
+	var req Req
+	if err := serverutil.DecodeBody(r, &req); err != nil {
+		routerLog.Error("error occurred while parsing body: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+
+	resp, err := estimateUpload(req.BackupBaseDir, req.MemberID)
+	if err != nil {
+		routerLog.Error("error estimating upload: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+	serverutil.HttpJSON(w, resp)
+}
+
+// estimateUpload compares the latest local backup of the member with the backup uploaded last, the
+// archive size and the duration are extrapolated from the last upload
+func estimateUpload(baseDir string, memberID int) (*api.EstimateResp, error) {
+	est, _, err := estimateBackup(baseDir, memberID)
+	return est, err
+}
+
+// estimateBackup estimates the upload like estimateUpload and also returns the scanned files of the
+// backup, so that callers do not walk it again
+func estimateBackup(baseDir string, memberID int) (*api.EstimateResp, map[string]fileState, error) {
+	backupsDir := filepath.Join(baseDir, DirName)
+	backups, err := listBackups(baseDir, memberID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(backups) == 0 {
+		return nil, nil, ErrEmptyBackupDir
+	}
+	latest := backups[len(backups)-1]
+
+	// the record is named after the member ID the upload used
+	uuids, err := fileutil.FolderUUIDs(filepath.Join(backupsDir, filepath.Dir(latest)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(uuids) == 1 {
+		memberID = 0
+	}
+	last, err := readUploadRecord(uploadRecordName(backupsDir, memberID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := scanBackup(filepath.Join(backupsDir, latest))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp := &api.EstimateResp{Backup: latest, Files: len(files)}
+	for name, f := range files {
+		resp.Bytes += f.Size
+		if last != nil {
+			if prev, ok := last.Files[name]; ok && prev.Size == f.Size && prev.ModTime.Equal(f.ModTime) {
+				continue
+			}
+		}
+		resp.ChangedFiles++
+		resp.ChangedBytes += f.Size
+	}
+
+	resp.UploadBytes = resp.Bytes
+	if last == nil {
+		return resp, files, nil
+	}
+	for name := range last.Files {
+		if _, ok := files[name]; !ok {
+			resp.RemovedFiles++
+		}
+	}
+	if last.Bytes > 0 {
+		resp.UploadBytes = int64(math.Round(float64(resp.Bytes) * float64(last.ArchiveBytes) / float64(last.Bytes)))
+	}
+	if last.BytesPerSecond > 0 {
+		resp.DurationSeconds = math.Round(float64(resp.UploadBytes)/last.BytesPerSecond*10) / 10
+	}
+	t := last.Time
+	resp.LastUpload, resp.LastKey = &t, last.Key
+	return resp, files, nil
+}
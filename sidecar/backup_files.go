@@ -0,0 +1,79 @@
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+// hashCacheName is the file in the backups dir holding the digests of the files of the member's last
+// manifest. Hazelcast keeps most files between backups, they are not hashed again.
+func hashCacheName(backupsDir string, memberID int) string {
+	return filepath.Join(backupsDir, fmt.Sprintf(".hashes-%d.json", memberID))
+}
+
+func readHashCache(name string) (archive.HashCache, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c archive.HashCache
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// hashBackup returns the files of the backup with their digests, the paths start with baseDirName
+// like the entries of the archive. The cache is updated with the digests.
+func hashBackup(ctx context.Context, backupDir, baseDirName, cacheName string, workers int) ([]archive.FileEntry, error) {
+	cache, err := readHashCache(cacheName)
+	if err != nil {
+		// a broken cache only costs the time to hash every file
+		backupLog.Warn("ignoring hash cache: " + err.Error())
+	}
+	files, cache, err := archive.HashFiles(ctx, backupDir, workers, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(cache)
+	if err == nil {
+		err = os.WriteFile(cacheName, data, 0600)
+	}
+	if err != nil {
+		backupLog.Warn("could not write hash cache: " + err.Error())
+	}
+
+	for i := range files {
+		files[i].Path = path.Join(baseDirName, files[i].Path)
+	}
+	return files, nil
+}
+
+// writeFileManifest writes the files of the backup into a new temporary folder, the caller removes the folder
+func writeFileManifest(files []archive.FileEntry) (string, error) {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "backup-files")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, archive.FileManifestName)
+	if err = os.WriteFile(name, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,261 @@
+package sidecar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/fsys"
+)
+
+// objectsDir is the folder below the prefix of the cluster holding the chunk files of incremental
+// archives, they are shared by the archives of all dated folders
+const objectsDir = "objects"
+
+// incrementalStateName is the file in the backups dir recording the chunk files of the member's last
+// incremental upload and the objects holding them
+func incrementalStateName(backupsDir string, memberID int) string {
+	return filepath.Join(backupsDir, fmt.Sprintf(".incremental-%d.json", memberID))
+}
+
+type incrementalState struct {
+	// Bucket is the bucket the objects were written to, they are only reused in the same bucket
+	Bucket      string                             `json:"bucket"`
+	Compression archive.Compression                `json:"compression"`
+	Files       map[string]archive.IncrementalFile `json:"files"`
+}
+
+func readIncrementalState(name string) (*incrementalState, error) {
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s incrementalState
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// uploadIncremental writes the backup as an incremental archive. Only the chunk files that changed
+// since the last incremental upload of the member to the same bucket are uploaded, the manifest of
+// the archive references the objects of the others. A chunk file is unchanged if its digest in files
+// is the same. The objects are verified by their digests when the archive is read, the archive has
+// no checksum of its own.
+func uploadIncremental(ctx context.Context, bucket *blob.Bucket, key, prefix, backupDir, baseDirName string, meta []string, c archive.Codec, snap *api.SnapshotInfo, files []archive.FileEntry, stateName string, opts UploadOptions) error {
+	state, err := readIncrementalState(stateName)
+	if err != nil {
+		// a broken state only costs a full upload
+		backupLog.Warn("ignoring incremental upload state: " + err.Error())
+	}
+	var prev map[string]archive.IncrementalFile
+	if state != nil && state.Bucket == opts.Bucket && state.Compression == c.Compression {
+		if prev, err = storedObjects(ctx, bucket, state.Files); err != nil {
+			return err
+		}
+	}
+
+	digests := make(map[string]string, len(files))
+	for _, f := range files {
+		digests[f.Path] = f.SHA256
+	}
+
+	wo, err := writerOptions(0, opts.ACL)
+	if err != nil {
+		return err
+	}
+	parts := 0
+	var written int64
+	objects, chunks, err := archive.CreateIncremental(c, backupDir, baseDirName, meta, prev, digests, func(shared bool, fn func(w io.Writer) error) (archive.ObjectRef, error) {
+		name := archive.PartKey(key, parts)
+		if shared {
+			name = path.Join(prefix, objectsDir, uuid.NewString())
+		} else {
+			parts++
+		}
+		ref, err := writeObject(ctx, bucket, name, wo, fn, opts.Uploaded)
+		written += ref.Size
+		return ref, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Reused != nil {
+		for _, o := range objects {
+			opts.Reused.Add(o.Size)
+		}
+		opts.Reused.Add(-written)
+	}
+	if err = archive.WriteObjectManifest(ctx, bucket, key, objects, archive.WithSnapshot(archive.WithClusterSize(wo, opts.ClusterSize), snap)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(incrementalState{Bucket: opts.Bucket, Compression: c.Compression, Files: chunks})
+	if err == nil {
+		err = fsys.WriteFile(stateName, data, 0600)
+	}
+	if err != nil {
+		// the next upload is a full one
+		backupLog.Warn("could not write incremental upload state: " + err.Error())
+	}
+	return nil
+}
+
+// storedObjects returns the files whose objects are still stored in the bucket, the others are
+// uploaded again
+func storedObjects(ctx context.Context, bucket *blob.Bucket, files map[string]archive.IncrementalFile) (map[string]archive.IncrementalFile, error) {
+	stored := make(map[string]archive.IncrementalFile, len(files))
+	for name, f := range files {
+		attrs, err := bucket.Attributes(ctx, f.Object.Key)
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if attrs.Size == f.Object.Size {
+			stored[name] = f
+		}
+	}
+	return stored, nil
+}
+
+// writeObject writes the output of fn to a new object and returns its reference
+func writeObject(ctx context.Context, bucket *blob.Bucket, key string, wo *blob.WriterOptions, fn func(w io.Writer) error, uploaded *atomic.Int64) (archive.ObjectRef, error) {
+	w, err := bucket.NewWriter(ctx, key, wo)
+	if err != nil {
+		return archive.ObjectRef{}, err
+	}
+	h := sha256.New()
+	size := &countWriter{}
+	if err = fn(io.MultiWriter(w, h, uploadCounter{uploaded}, size)); err != nil {
+		w.Close()
+		return archive.ObjectRef{}, err
+	}
+	if err = w.Close(); err != nil {
+		return archive.ObjectRef{}, err
+	}
+	return archive.ObjectRef{Key: key, Size: size.n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// referencedObjects returns the shared objects referenced by the incremental archives of the kept
+// folders. The objects of the newest archive of every member are kept as well, even if its folder
+// expired, as the next upload of the member references them.
+func referencedObjects(ctx context.Context, b *blob.Bucket, folders []string, expired map[string]bool, loc *time.Location) (map[string]bool, error) {
+	type newest struct {
+		time    time.Time
+		objects []archive.ObjectRef
+	}
+	referenced := make(map[string]bool)
+	latest := make(map[string]newest)
+	for _, folder := range folders {
+		t, err := fileutil.ParseFolderTime(path.Base(folder), loc)
+		if err != nil {
+			continue
+		}
+		keys, err := listKeys(ctx, b, folder+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			key, ok := archive.Key(k)
+			if !ok || key == k {
+				continue
+			}
+			m, err := archive.ReadManifest(ctx, b, key)
+			if err != nil {
+				return nil, err
+			}
+			if len(m.Objects) == 0 {
+				continue
+			}
+			if !expired[folder] {
+				for _, o := range m.Objects {
+					referenced[o.Key] = true
+				}
+			}
+			member := path.Base(key)
+			if n, ok := latest[member]; !ok || t.After(n.time) {
+				latest[member] = newest{time: t, objects: m.Objects}
+			}
+		}
+	}
+	for _, n := range latest {
+		for _, o := range n.objects {
+			referenced[o.Key] = true
+		}
+	}
+	return referenced, nil
+}
+
+// listKeys returns the keys of the objects below prefix
+func listKeys(ctx context.Context, b *blob.Bucket, prefix string) ([]string, error) {
+	var keys []string
+	it := b.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := it.Next(ctx)
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, obj.Key)
+	}
+}
+
+// pruneObjects deletes the shared objects below prefix that no archive references in batches. Objects
+// younger than grace are kept, they could belong to an upload that is still running.
+func pruneObjects(ctx context.Context, b *blob.Bucket, prefix string, referenced map[string]bool, now time.Time, grace time.Duration, opts bucket.DeleteOptions, res *api.PruneResult) error {
+	var keys []string
+	sizes := make(map[string]int64)
+	it := b.List(&blob.ListOptions{Prefix: path.Join(prefix, objectsDir) + "/"})
+	for {
+		obj, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if referenced[obj.Key] || now.Sub(obj.ModTime) < grace {
+			continue
+		}
+		keys = append(keys, obj.Key)
+		sizes[obj.Key] = obj.Size
+	}
+	deleted, err := bucket.DeleteKeys(ctx, b, keys, opts)
+	res.SharedObjects += len(deleted)
+	countPruned(res, deleted, sizes)
+	return err
+}
@@ -0,0 +1,143 @@
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrMemberBusy is returned if the member is still busy when the policy rejects or the wait times out
+var ErrMemberBusy = errors.New("member is busy with a backup")
+
+// Policies when the member is busy
+const (
+	MemberPolicyWait   = "wait"
+	MemberPolicyReject = "reject"
+)
+
+// memberPolicy configures the check of the Hazelcast member before the backup is archived
+type memberPolicy struct {
+	// URL is the REST endpoint of the member, empty disables the check
+	URL      string
+	Policy   string
+	Timeout  time.Duration
+	Interval time.Duration
+	// ClusterName and Password authenticate the hot backup requests of the scheduler
+	ClusterName string
+	Password    string
+}
+
+// memberHealth is the response of the member health endpoint
+type memberHealth struct {
+	NodeState          string `json:"nodeState"`
+	ClusterState       string `json:"clusterState"`
+	ClusterSafe        bool   `json:"clusterSafe"`
+	MigrationQueueSize int    `json:"migrationQueueSize"`
+	ClusterSize        int    `json:"clusterSize"`
+}
+
+// busy returns the reason the member must not be archived now. The cluster is in transition while
+// Hazelcast creates a native backup, partitions are not safe while they are migrated.
+func (h *memberHealth) busy() string {
+	switch {
+	case h.ClusterState == "IN_TRANSITION":
+		return "cluster state is in transition"
+	case h.MigrationQueueSize > 0:
+		return fmt.Sprintf("%d migrations are pending", h.MigrationQueueSize)
+	case !h.ClusterSafe:
+		return "cluster is not safe"
+	}
+	return ""
+}
+
+var memberClient = &http.Client{Timeout: 10 * time.Second}
+
+// waitIdle waits until the member is not busy, with the reject policy it fails on the first busy response
+func (p memberPolicy) waitIdle(ctx context.Context) error {
+	if p.URL == "" {
+		return nil
+	}
+	deadline := time.Now().Add(p.Timeout)
+	for {
+		h, err := readMemberHealth(ctx, p.URL)
+		if err != nil {
+			return err
+		}
+		reason := h.busy()
+		if reason == "" {
+			return nil
+		}
+		if p.Policy == MemberPolicyReject || time.Now().Add(p.Interval).After(deadline) {
+			return fmt.Errorf("%w: %s", ErrMemberBusy, reason)
+		}
+
+		backupLog.Info("member is busy, waiting", zap.String("reason", reason), zap.Duration("wait", p.Interval))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.Interval):
+		}
+	}
+}
+
+func readMemberHealth(ctx context.Context, memberURL string) (*memberHealth, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(memberURL, "/")+"/hazelcast/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := memberClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("member health returned %s", res.Status)
+	}
+
+	var h memberHealth
+	if err = json.NewDecoder(res.Body).Decode(&h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// hotBackupPath is the member REST endpoint that starts a hot backup of the whole cluster
+const hotBackupPath = "/hazelcast/rest/management/cluster/hotBackup"
+
+// hotBackup asks the member to create a new hot backup. The member only starts the backup, the
+// sequence folder appears while the cluster is in transition.
+func (p memberPolicy) hotBackup(ctx context.Context) error {
+	body := strings.NewReader(url.QueryEscape(p.ClusterName) + "&" + url.QueryEscape(p.Password))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.URL, "/")+hotBackupPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := memberClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("member hot backup returned %s", res.Status)
+	}
+
+	var resp struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Status != "success" {
+		return fmt.Errorf("member hot backup failed with status %q: %s", resp.Status, resp.Message)
+	}
+	return nil
+}
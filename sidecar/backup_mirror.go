@@ -0,0 +1,161 @@
+package sidecar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+// mirror copies the completed archive under key from the bucket it was written to into the other buckets
+// of the failover list and into the mirror buckets of the request, so that every region holds the backup.
+// The mirror buckets are only written until the grace period of a bucket migration ends.
+func (t *task) mirror(ID uuid.UUID, bucketURL, key string, secretData map[string][]byte) []api.MirrorStatus {
+	var targets []string
+	seen := map[string]bool{bucketURL: true}
+	add := func(urls []string) {
+		for _, u := range urls {
+			// the backup failed over to the mirror itself
+			if n, err := uri.NormalizeURI(u); seen[u] || err == nil && seen[n] {
+				continue
+			}
+			seen[u] = true
+			targets = append(targets, u)
+		}
+	}
+	if len(t.req.FallbackBucketURLs) > 0 {
+		add(t.req.BucketURLs())
+	}
+	if len(t.req.MirrorBucketURLs) > 0 {
+		if t.req.MirrorUntil != nil && clock.Now().After(*t.req.MirrorUntil) {
+			backupLog.Info("mirror grace period is over, skipping mirror buckets", zap.Uint32("task id", ID.ID()), zap.Time("mirror until", *t.req.MirrorUntil))
+		} else {
+			add(t.req.MirrorBucketURLs)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	srcURI, err := uri.NormalizeURI(bucketURL)
+	if err != nil {
+		return mirrorFailures(targets, err)
+	}
+	src, release, err := t.buckets.Open(t.ctx, srcURI, secretData)
+	if err != nil {
+		return mirrorFailures(targets, err)
+	}
+	defer release()
+
+	var statuses []api.MirrorStatus
+	for _, m := range targets {
+		s := api.MirrorStatus{BucketURL: m, Status: api.StatusSuccess}
+		if err = t.copyTo(src, m, key, secretData); err != nil {
+			backupLog.Error("task could not copy backup to mirror bucket: "+err.Error(), zap.Uint32("task id", ID.ID()), zap.String("bucket URL", logger.Redact(m)))
+			s.Status = api.StatusFailure
+			s.Message = logger.Redact(err.Error())
+		} else {
+			backupLog.Info("task copied backup to mirror bucket", zap.Uint32("task id", ID.ID()), zap.String("bucket URL", logger.Redact(m)))
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+func (t *task) copyTo(src *blob.Bucket, mirrorURL, key string, secretData map[string][]byte) error {
+	mirrorURI, err := uri.NormalizeURI(mirrorURL)
+	if err != nil {
+		return err
+	}
+	dst, release, err := t.buckets.Open(t.ctx, mirrorURI, secretData)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	acl := t.acl
+	if t.req.ACL != "" {
+		acl = t.req.ACL
+	}
+	return copyArchive(t.ctx, src, dst, key, acl)
+}
+
+// copyArchive writes the archive under key in src as a single object with its checksum to dst.
+// Archives stored in parts are joined, the checksum of the parts is the one of the joined object.
+func copyArchive(ctx context.Context, src, dst *blob.Bucket, key, acl string) error {
+	want, err := archive.ReadChecksum(ctx, src, key)
+	if err != nil {
+		return err
+	}
+
+	r, err := archive.NewReader(ctx, src, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// the mirror is restored like the original, so it keeps the recorded cluster size
+	size, err := archive.ReadClusterSize(ctx, src, key)
+	if err != nil {
+		return err
+	}
+	wo, err := bucket.WithACL(&blob.WriterOptions{}, acl)
+	if err != nil {
+		return err
+	}
+	w, err := dst.NewWriter(ctx, key, archive.WithClusterSize(wo, size))
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	sum := h.Sum(nil)
+	if want != nil {
+		if err = archive.VerifyChecksum(key, want, sum); err != nil {
+			return err
+		}
+	}
+	co, err := bucket.WithACL(nil, acl)
+	if err != nil {
+		return err
+	}
+	if err = archive.WriteChecksum(ctx, dst, key, sum, co); err != nil {
+		return err
+	}
+
+	// the mirror is a single object with a checksum, even if the original is incremental
+	m, err := archive.ReadArchiveManifest(ctx, src, key)
+	if err != nil || m == nil {
+		return err
+	}
+	m.SHA256, m.Size = hex.EncodeToString(sum), n
+	return archive.WriteArchiveManifest(ctx, dst, key, m, co)
+}
+
+func mirrorFailures(mirrorURLs []string, err error) []api.MirrorStatus {
+	statuses := make([]api.MirrorStatus, 0, len(mirrorURLs))
+	for _, m := range mirrorURLs {
+		statuses = append(statuses, api.MirrorStatus{BucketURL: m, Status: api.StatusFailure, Message: logger.Redact(err.Error())})
+	}
+	return statuses
+}
@@ -0,0 +1,264 @@
+package sidecar
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/metrics"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+// retentionPolicy prunes the dated backup folders of the cluster prefix after a successful upload,
+// so that no lifecycle rules of the provider are needed. A folder is kept if any rule keeps it.
+type retentionPolicy struct {
+	// KeepLast keeps the newest backups, 0 keeps none by count
+	KeepLast int
+	// KeepDays keeps the backups younger than the number of days, 0 keeps none by age
+	KeepDays int
+	// UploadWindow is how long the upload of a backup may take, younger folders are never deleted
+	// and do not count as kept, the other members may still be uploading into them
+	UploadWindow time.Duration
+	// DryRun only reports the folders that would be deleted
+	DryRun bool
+	// Rate is the maximum number of objects deleted per second, 0 means unlimited
+	Rate float64
+	// Metrics receives the pruned bytes of every pruning as Instance, nil pushes nothing
+	Metrics  *metrics.Pusher
+	Instance string
+}
+
+func (p retentionPolicy) enabled() bool {
+	return p.KeepLast > 0 || p.KeepDays > 0
+}
+
+// deleteOptions returns the options of the batch deletes of the bucket
+func (p retentionPolicy) deleteOptions(bucketURL string) bucket.DeleteOptions {
+	return bucket.DeleteOptions{BucketURL: bucketURL, Rate: p.Rate, DryRun: p.DryRun}
+}
+
+// expired returns the dated folders of the cluster that the policy does not keep. The folders are
+// named after the time of the backup, the current folder is always kept. Only complete folders
+// count towards KeepLast, a failed backup must not push the last good one out.
+func (p retentionPolicy) expired(folders []string, complete map[string]bool, current string, loc *time.Location, now time.Time) []string {
+	type dated struct {
+		name string
+		time time.Time
+	}
+	var backups []dated
+	for _, f := range folders {
+		t, err := fileutil.ParseFolderTime(path.Base(f), loc)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, dated{name: f, time: t})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	var expired []string
+	kept := 0
+	for _, b := range backups {
+		switch {
+		case now.Sub(b.time) < p.UploadWindow:
+		case b.name == current || (complete[b.name] && kept < p.KeepLast):
+			if complete[b.name] {
+				kept++
+			}
+		case p.KeepDays > 0 && now.Sub(b.time) < time.Duration(p.KeepDays)*24*time.Hour:
+		default:
+			expired = append(expired, b.name)
+		}
+	}
+	return expired
+}
+
+// completeFolders returns the folders whose archives were all completed. An archive stored as a
+// single object is complete once its checksum or manifest is written, archives in parts and
+// incremental archives once their parts manifest is. Folders without any archive are not complete.
+func completeFolders(ctx context.Context, b *blob.Bucket, folders []string) (map[string]bool, error) {
+	complete := make(map[string]bool, len(folders))
+	for _, folder := range folders {
+		objects := make(map[string]bool)
+		it := b.List(&blob.ListOptions{Prefix: folder + "/", Delimiter: "/"})
+		for {
+			obj, err := it.Next(ctx)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			objects[obj.Key] = true
+		}
+
+		archives, done := 0, 0
+		for key := range objects {
+			switch {
+			case strings.HasSuffix(key, archive.ManifestSuffix):
+				if _, ok := archive.Key(key); ok {
+					archives++
+					done++
+				}
+			case objects[key+archive.ManifestSuffix]:
+				// the parts manifest stands for the archive
+			default:
+				if _, ok := archive.CompressionOf(key); !ok {
+					continue
+				}
+				archives++
+				if objects[archive.ChecksumKey(key)] || objects[archive.ArchiveManifestKey(key)] {
+					done++
+				}
+			}
+		}
+		complete[folder] = archives > 0 && archives == done
+	}
+	return complete, nil
+}
+
+// prune applies the retention policy below the parent of the folder of the backup stored under key
+func (t *task) prune(ID uuid.UUID, bucketURL, key string, secretData map[string][]byte) *api.PruneResult {
+	if !t.retention.enabled() {
+		return nil
+	}
+	if t.req.Snapshot {
+		backupLog.Info("task skips pruning, snapshots are not pruned", zap.Uint32("task id", ID.ID()))
+		return nil
+	}
+	res := &api.PruneResult{DryRun: t.retention.DryRun}
+
+	current := path.Dir(key)
+	prefix := path.Dir(current)
+	if prefix == "." {
+		prefix = ""
+	}
+	err := t.pruneBucket(bucketURL, prefix, current, secretData, res)
+	if err != nil {
+		backupLog.Error("task could not prune backups: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		res.Message = logger.Redact(err.Error())
+	}
+	backupLog.Info("task pruned backups", zap.Uint32("task id", ID.ID()), zap.Bool("dry run", res.DryRun),
+		zap.Strings("folders", res.Folders), zap.Int("objects", res.Objects), zap.Int64("bytes", res.Bytes))
+	t.retention.push(t.ctx, prefix, res)
+	return res
+}
+
+func (t *task) pruneBucket(bucketURL, prefix, current string, secretData map[string][]byte, res *api.PruneResult) error {
+	bucketURI, err := uri.NormalizeURI(bucketURL)
+	if err != nil {
+		return err
+	}
+	b, release, err := t.buckets.Open(t.ctx, bucketURI, secretData)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	folders, err := listFolders(t.ctx, b, prefix)
+	if err != nil {
+		return err
+	}
+	complete, err := completeFolders(t.ctx, b, folders)
+	if err != nil {
+		return err
+	}
+	expired := t.retention.expired(folders, complete, current, t.location, clock.Now())
+	// the shared objects of incremental archives are referenced from the manifests of the folders, the
+	// objects of uploads within the upload window may not be referenced yet
+	isExpired := make(map[string]bool, len(expired))
+	for _, f := range expired {
+		isExpired[f] = true
+	}
+	referenced, err := referencedObjects(t.ctx, b, folders, isExpired, t.location)
+	if err != nil {
+		return err
+	}
+	opts := t.retention.deleteOptions(bucketURI)
+	for _, f := range expired {
+		if err = pruneFolder(t.ctx, b, f, opts, res); err != nil {
+			return err
+		}
+		res.Folders = append(res.Folders, f)
+	}
+	return pruneObjects(t.ctx, b, prefix, referenced, clock.Now(), t.retention.UploadWindow, opts, res)
+}
+
+// listFolders returns the folders directly below prefix
+func listFolders(ctx context.Context, b *blob.Bucket, prefix string) ([]string, error) {
+	opts := &blob.ListOptions{Delimiter: "/"}
+	if prefix != "" {
+		opts.Prefix = prefix + "/"
+	}
+	var folders []string
+	it := b.List(opts)
+	for {
+		obj, err := it.Next(ctx)
+		if err == io.EOF {
+			return folders, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if obj.IsDir {
+			folders = append(folders, strings.TrimSuffix(obj.Key, "/"))
+		}
+	}
+}
+
+// pruneFolder deletes the objects of the folder in batches and counts them. The other members of the
+// cluster prune the same folders, objects they deleted first count as deleted.
+func pruneFolder(ctx context.Context, b *blob.Bucket, folder string, opts bucket.DeleteOptions, res *api.PruneResult) error {
+	var keys []string
+	sizes := make(map[string]int64)
+	it := b.List(&blob.ListOptions{Prefix: folder + "/"})
+	for {
+		obj, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		keys = append(keys, obj.Key)
+		sizes[obj.Key] = obj.Size
+	}
+	deleted, err := bucket.DeleteKeys(ctx, b, keys, opts)
+	countPruned(res, deleted, sizes)
+	return err
+}
+
+// countPruned adds the deleted objects to the result
+func countPruned(res *api.PruneResult, deleted []string, sizes map[string]int64) {
+	for _, key := range deleted {
+		res.Objects++
+		res.Bytes += sizes[key]
+	}
+}
+
+// push reports the pruning to the Pushgateway, failures are only logged
+func (p retentionPolicy) push(ctx context.Context, prefix string, res *api.PruneResult) {
+	labels := map[string]string{"prefix": prefix, "dry_run": strconv.FormatBool(res.DryRun)}
+	err := p.Metrics.Push(ctx, p.Instance, []metrics.Metric{
+		{Name: "hazelcast_backup_pruned_bytes", Help: "Bytes deleted by the last pruning of the backups, or that would have been in a dry run", Value: float64(res.Bytes), Labels: labels},
+		{Name: "hazelcast_backup_pruned_folders", Help: "Dated backup folders deleted by the last pruning", Value: float64(len(res.Folders)), Labels: labels},
+	})
+	if err != nil {
+		backupLog.Warn("could not push metrics to pushgateway: " + err.Error())
+	}
+}
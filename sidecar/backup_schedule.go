@@ -0,0 +1,57 @@
+package sidecar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// missedRunPolicy decides whether a scheduled backup that starts late still runs, like the
+// startingDeadlineSeconds of a CronJob. A backup starts late if the sidecar was down when it was
+// due, or if it waited in the queue.
+type missedRunPolicy struct {
+	// Policy is used for requests without a missed-run policy, SKIP or RUN
+	Policy string
+	// Grace is how late a backup of the SKIP policy may start, the trigger itself takes a moment
+	Grace time.Duration
+}
+
+// missedRunError skips a backup that started too late for its missed-run policy
+type missedRunError struct {
+	ScheduledAt time.Time
+	Late        time.Duration
+	Policy      string
+	Deadline    time.Duration
+}
+
+func (e *missedRunError) Error() string {
+	return fmt.Sprintf("backup scheduled at %s started %s late, the %s policy allows %s, skipping it",
+		e.ScheduledAt.Format(time.RFC3339), e.Late.Round(time.Second), e.Policy, e.Deadline)
+}
+
+// check returns a missedRunError if the backup of the request starting at now missed its run
+func (p missedRunPolicy) check(req UploadReq, now time.Time) error {
+	if req.ScheduledAt == nil {
+		return nil
+	}
+	policy := req.MissedRunPolicy
+	if policy == "" {
+		policy = p.Policy
+	}
+
+	var deadline time.Duration
+	switch policy {
+	case api.MissedRunSkip:
+		deadline = p.Grace
+	case api.MissedRunDeadline:
+		deadline = time.Duration(req.StartingDeadlineSeconds) * time.Second
+	default:
+		return nil
+	}
+	late := now.Sub(*req.ScheduledAt)
+	if late <= deadline {
+		return nil
+	}
+	return &missedRunError{ScheduledAt: *req.ScheduledAt, Late: late, Policy: policy, Deadline: deadline}
+}
@@ -0,0 +1,65 @@
+package sidecar
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+// maxContributors is the number of folders listed when a backup exceeds the maximum size
+const maxContributors = 10
+
+// sizeExceededError fails the upload of a backup whose archive would exceed the maximum backup size
+type sizeExceededError struct {
+	Backup string
+	// Bytes is the estimated size of the archive
+	Bytes        int64
+	Max          int64
+	Contributors []api.SizeContributor
+}
+
+func (e *sizeExceededError) Error() string {
+	return fmt.Sprintf("backup %s exceeds the maximum backup size, the archive would have %d bytes, the limit is %d bytes", e.Backup, e.Bytes, e.Max)
+}
+
+// checkBackupSize fails if the estimated archive of the backup would exceed max bytes, the files are
+// those of the estimate. The archive size is extrapolated from the compression ratio of the last
+// upload, the first backup of a member counts with its uncompressed size.
+func checkBackupSize(est *api.EstimateResp, files map[string]fileState, max int64) error {
+	if max <= 0 || est.UploadBytes <= max {
+		return nil
+	}
+	return &sizeExceededError{Backup: est.Backup, Bytes: est.UploadBytes, Max: max, Contributors: largestContributors(files, maxContributors)}
+}
+
+// largestContributors sums the files of the backup by their folder and returns the n largest folders
+func largestContributors(files map[string]fileState, n int) []api.SizeContributor {
+	byDir := make(map[string]*api.SizeContributor)
+	for name, f := range files {
+		dir := path.Dir(name)
+		c, ok := byDir[dir]
+		if !ok {
+			c = &api.SizeContributor{Path: dir}
+			byDir[dir] = c
+		}
+		c.Files++
+		c.Bytes += f.Size
+	}
+
+	l := make([]api.SizeContributor, 0, len(byDir))
+	for _, c := range byDir {
+		l = append(l, *c)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Bytes != l[j].Bytes {
+			return l[i].Bytes > l[j].Bytes
+		}
+		return l[i].Path < l[j].Path
+	})
+	if len(l) > n {
+		l = l[:n]
+	}
+	return l
+}
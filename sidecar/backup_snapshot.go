@@ -0,0 +1,283 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+var ErrSnapshotNotFileBucket = errors.New("snapshots are only written to file buckets")
+
+// snapshotRoot returns the directory a normalized file bucket URI stores its objects in, including
+// the prefix parameter
+func snapshotRoot(bucketURI string) (string, error) {
+	u, err := url.Parse(bucketURI)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", ErrSnapshotNotFileBucket
+	}
+	return filepath.Join(u.Path, u.Query().Get("prefix")), nil
+}
+
+// snapshotStats counts the files of a snapshot
+type snapshotStats struct {
+	Linked      int
+	Copied      int
+	CopiedBytes int64
+}
+
+// SnapshotBackup stores the latest backup of the member as the plain directory
+// <root>/<prefix>/<folder>/<uuid> instead of an archive. Files that did not change since the member's
+// previous snapshot are hard links to it, so frequent snapshots only take the space of the changed
+// files. The root must be on a local or NFS volume that supports hard links.
+func SnapshotBackup(ctx context.Context, root, backupsDir, prefix string, memberID int, opts UploadOptions) (string, error) {
+	mb, err := latestMemberBackup(backupsDir, memberID, opts.Location)
+	if err != nil {
+		return "", err
+	}
+	key := filepath.Join(prefix, mb.folder, mb.uuid)
+	dst := filepath.Join(root, key)
+
+	// the snapshot is only renamed into place once it is complete, a retried task finds it
+	if _, err = os.Stat(dst); err == nil {
+		backupLog.Info("snapshot exists already", zap.String("key", key))
+		return key, mb.markDone()
+	}
+
+	if err = waitStable(ctx, mb.dir, opts.StableWindow, opts.StableTimeout); err != nil {
+		return "", err
+	}
+
+	prev, err := previousSnapshot(filepath.Join(root, prefix), mb.folder, mb.uuid, opts.Location)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), "."+mb.uuid+".tmp")
+	if err != nil {
+		return "", err
+	}
+	stats, err := linkTree(ctx, mb.dir, tmp, prev)
+	if err == nil {
+		err = os.Chmod(tmp, 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	backupLog.Info("snapshot written", zap.String("key", key), zap.String("previous", prev),
+		zap.Int("linked files", stats.Linked), zap.Int("copied files", stats.Copied), zap.Int64("copied bytes", stats.CopiedBytes))
+
+	if err = mb.markDone(); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// previousSnapshot returns the latest snapshot of the member in a dated folder before folder, empty if there is none
+func previousSnapshot(dir, folder, uuid string, loc *time.Location) (string, error) {
+	current, err := fileutil.ParseFolderTime(folder, loc)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	type dated struct {
+		name string
+		t    time.Time
+	}
+	var folders []dated
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t, err := fileutil.ParseFolderTime(e.Name(), loc)
+		if err != nil || !t.Before(current) {
+			continue
+		}
+		folders = append(folders, dated{e.Name(), t})
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].t.After(folders[j].t) })
+	for _, f := range folders {
+		prev := filepath.Join(dir, f.name, uuid)
+		if info, err := os.Stat(prev); err == nil && info.IsDir() {
+			return prev, nil
+		}
+	}
+	return "", nil
+}
+
+// linkTree recreates src in dst. A regular file is a hard link to the file with the same path in
+// prev if both have the same size and modification time, or the same content. Other files are
+// copied with their modification time, so that the next snapshot can link them without reading them.
+func linkTree(ctx context.Context, src, dst, prev string) (snapshotStats, error) {
+	var stats snapshotStats
+	err := filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			backupLog.Warn("skipping file that is neither regular file nor directory", zap.String("file", name))
+			return nil
+		}
+
+		if prev != "" {
+			old := filepath.Join(prev, rel)
+			same, err := sameFile(ctx, name, old, info)
+			if err != nil {
+				return err
+			}
+			// a file that cannot be linked, e.g. after too many links, is copied
+			if same && os.Link(old, target) == nil {
+				stats.Linked++
+				return nil
+			}
+		}
+		if err = copyFile(ctx, name, target, info); err != nil {
+			return err
+		}
+		stats.Copied++
+		stats.CopiedBytes += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// sameFile reports whether the file old of the previous snapshot has the content of name
+func sameFile(ctx context.Context, name, old string, info fs.FileInfo) (bool, error) {
+	oldInfo, err := os.Lstat(old)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !oldInfo.Mode().IsRegular() || oldInfo.Size() != info.Size() || oldInfo.Mode().Perm() != info.Mode().Perm() {
+		return false, nil
+	}
+	if oldInfo.ModTime().Equal(info.ModTime()) {
+		return true, nil
+	}
+	// Hazelcast copies unchanged files into every backup, they have the same content with a new time
+	return sameContent(ctx, name, old)
+}
+
+func sameContent(ctx context.Context, a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, len(bufA))
+	for {
+		if err = ctx.Err(); err != nil {
+			return false, err
+		}
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		doneA := errors.Is(errA, io.EOF) || errors.Is(errA, io.ErrUnexpectedEOF)
+		doneB := errors.Is(errB, io.EOF) || errors.Is(errB, io.ErrUnexpectedEOF)
+		if errA != nil && !doneA {
+			return false, errA
+		}
+		if errB != nil && !doneB {
+			return false, errB
+		}
+		if doneA || doneB {
+			return doneA == doneB, nil
+		}
+	}
+}
+
+func copyFile(ctx context.Context, name, target string, info fs.FileInfo) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &ctxReader{ctx: ctx, r: in})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", name, err)
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+// ctxReader stops reading once the context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,69 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrSourceNotStable is returned if the backup directory is still modified when the stability timeout is exceeded
+var ErrSourceNotStable = errors.New("backup directory is still being modified")
+
+// stablePolicy configures the quiescence check of the backup directory
+type stablePolicy struct {
+	Window  time.Duration
+	Timeout time.Duration
+}
+
+// waitStable waits until no file or directory under dir was modified for the window. Hazelcast could
+// still be writing the backup, archiving it then would produce an inconsistent copy.
+func waitStable(ctx context.Context, dir string, window, timeout time.Duration) error {
+	if window <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		last, err := lastModified(dir)
+		if err != nil {
+			return err
+		}
+		stableAt := last.Add(window)
+		wait := time.Until(stableAt)
+		if wait <= 0 {
+			return nil
+		}
+		if stableAt.After(deadline) {
+			return ErrSourceNotStable
+		}
+
+		backupLog.Info("backup directory was modified recently, waiting", zap.String("dir", dir), zap.Duration("wait", wait))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// lastModified returns the latest modification time of dir and the entries under it
+func lastModified(dir string) (time.Time, error) {
+	var last time.Time
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		return nil
+	})
+	return last, err
+}
@@ -2,14 +2,24 @@ package sidecar
 
 import (
 	"context"
+	"errors"
 	"log"
 	"path"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/notify"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
+	"github.com/hazelcast/platform-operator-agent/internal/tty"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
 
@@ -21,7 +31,43 @@ type task struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	backupKey string
+	bucketURL string
+	partial   bool
 	err       error
+	events    *mancenter.Client
+	location  *time.Location
+	metaFiles []string
+	stable    stablePolicy
+	member    memberPolicy
+	acl       string
+	codec     archive.Codec
+	caller    api.Caller
+	mirrors   []api.MirrorStatus
+	// fileManifest and hashWorkers configure the manifest of the backup files
+	fileManifest bool
+	hashWorkers  int
+	progress     *tty.Progress
+	// maxBytes is the maximum archive size of the backup, 0 means unlimited
+	maxBytes  int64
+	buckets   *bucket.Pool
+	missedRun missedRunPolicy
+	retention retentionPolicy
+	pruned    *api.PruneResult
+	// localCleanup deletes the local backups once the upload is verified
+	localCleanup bool
+	cleaned      *api.LocalCleanup
+	// batch are the items of a batch upload, nil for the upload of a single backup
+	batch []*task
+	// uploaded counts the bytes written to the bucket, nil counts only for the progress bars
+	uploaded *atomic.Int64
+	// incremental uploads only the chunk files that changed, reused counts the bytes that did not
+	incremental bool
+	reused      atomic.Int64
+	// queue and release are set once the queue starts the task, release frees its slot early
+	queue   *taskQueue
+	release func()
+	// dropped is set if the task was removed from the queue before it started
+	dropped atomic.Bool
 }
 
 func (t *task) process(ID uuid.UUID) {
@@ -30,14 +76,30 @@ func (t *task) process(ID uuid.UUID) {
 	defer backupLog.Info("task is finished", zap.Uint32("task id", ID.ID()))
 	defer t.cancel()
 
-	bucketURI, err := uri.NormalizeURI(t.req.BucketURL)
-	if err != nil {
-		backupLog.Error("error occurred while parsing bucket URI: "+err.Error(), zap.Uint32("task id", ID.ID()))
+	if t.batch != nil {
+		t.processBatch(ID)
+		return
+	}
+
+	start := time.Now()
+	// a missed run is not started, so no events are sent for it
+	if err := t.missedRun.check(t.req, clock.Now()); err != nil {
+		backupLog.Warn("task missed its scheduled run: "+err.Error(), zap.Uint32("task id", ID.ID()))
 		t.err = err
+		t.writeSummary(ID, start)
 		return
 	}
 
-	backupLog.Info("bucket URI successfully normalized", zap.String("bucket URI", bucketURI))
+	t.report(mancenter.Started)
+	defer func() {
+		switch {
+		case t.err != nil:
+			t.report(mancenter.Failed)
+		case !t.partial:
+			t.report(mancenter.Succeeded)
+		}
+		t.writeSummary(ID, start)
+	}()
 
 	secretData, err := bucket.SecretData(t.ctx, t.req.SecretName)
 	if err != nil {
@@ -48,22 +110,65 @@ func (t *task) process(ID uuid.UUID) {
 
 	backupLog.Info("task successfully read secret", zap.Uint32("task id", ID.ID()), zap.String("secret name", t.req.SecretName))
 
-	b, err := bucket.OpenBucket(t.ctx, bucketURI, secretData)
-	if err != nil {
-		backupLog.Error("task could not open bucket: "+err.Error(), zap.Uint32("task id", ID.ID()))
+	var encryptionKey []byte
+	if t.req.EncryptionSecret != "" {
+		encryptionKey, err = bucket.EncryptionKey(t.ctx, t.req.EncryptionSecret)
+		if err != nil {
+			backupLog.Error("error occurred while reading encryption key: "+err.Error(), zap.Uint32("task id", ID.ID()))
+			t.err = err
+			return
+		}
+	}
+
+	// a native backup of the member must not interleave with the archive
+	if err = t.member.waitIdle(t.ctx); err != nil {
+		backupLog.Error("task could not check member: "+err.Error(), zap.Uint32("task id", ID.ID()))
 		t.err = err
 		return
 	}
 
-	backupsDir := path.Join(t.req.BackupBaseDir, DirName)
+	// the backup is scanned once for the size check and the total of the progress bar, the total is
+	// the archive size estimated from the last upload, the size of the backup for the first one
+	var total int64
+	if t.maxBytes > 0 || t.progress.Enabled() {
+		est, files, err := estimateBackup(t.req.BackupBaseDir, t.req.MemberID)
+		if err == nil {
+			total = est.UploadBytes
+			err = checkBackupSize(est, files, t.maxBytes)
+		}
+		var sizeErr *sizeExceededError
+		if errors.As(err, &sizeErr) {
+			backupLog.Error("task backup exceeds the maximum size: "+err.Error(), zap.Uint32("task id", ID.ID()), zap.Any("largest contributors", sizeErr.Contributors))
+			t.err = err
+			return
+		}
+		// the estimate only matters for the size check
+		if err != nil && t.maxBytes > 0 {
+			backupLog.Error("task could not check the backup size: "+err.Error(), zap.Uint32("task id", ID.ID()))
+			t.err = err
+			return
+		}
+	}
 
-	log.Println("TASK", ID, "Staring backup upload:", backupsDir, t.req.MemberID)
-	folderKey, err := UploadBackup(t.ctx, b, backupsDir, t.req.HazelcastCRName, t.req.MemberID)
+	// the backup is written to the first bucket that accepts it
+	var folderKey string
+	var done bool
+	bucketURI, err := bucket.Failover(t.ctx, t.req.BucketURLs(), func(bucketURL string) error {
+		var err error
+		folderKey, done, err = t.upload(ID, bucketURL, secretData, encryptionKey, total)
+		return err
+	})
 	if err != nil {
-		backupLog.Error("task could not upload to bucket: "+err.Error(), zap.Uint32("task id", ID.ID()))
 		t.err = err
 		return
 	}
+	t.bucketURL = bucketURI
+
+	if !done {
+		backupLog.Info("task exceeded time box, upload will continue with the next task", zap.Uint32("task id", ID.ID()))
+		t.partial = true
+		return
+	}
 
 	backupLog.Info("task finished upload", zap.Uint32("task id", ID.ID()))
 
@@ -75,4 +180,154 @@ func (t *task) process(ID uuid.UUID) {
 	}
 
 	t.backupKey = backupKey
+
+	// mirroring and pruning wait behind the queued uploads in a slot of their own
+	if t.release != nil {
+		t.release()
+		release, err := t.queue.acquire(t.ctx)
+		if err != nil {
+			backupLog.Warn("task skips mirroring and pruning: "+err.Error(), zap.Uint32("task id", ID.ID()))
+			return
+		}
+		defer release()
+	}
+
+	// during a bucket migration the completed backup is copied to the old buckets as well
+	t.mirrors = t.mirror(ID, bucketURI, folderKey, secretData)
+
+	// only the bucket the backup was written to is pruned, a failed pruning does not fail the task
+	t.pruned = t.prune(ID, bucketURI, folderKey, secretData)
+
+	t.cleaned = t.cleanLocal(ID, bucketURI, folderKey, secretData)
+}
+
+// upload writes the backup to a single bucket and returns the normalized bucket URI on success
+func (t *task) upload(ID uuid.UUID, bucketURL string, secretData map[string][]byte, encryptionKey []byte, total int64) (string, bool, error) {
+	bucketURI, err := uri.NormalizeURI(bucketURL)
+	if err != nil {
+		backupLog.Error("error occurred while parsing bucket URI: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		return "", false, err
+	}
+
+	backupLog.Info("bucket URI successfully normalized", zap.String("bucket URI", bucketURI))
+
+	b, release, err := t.buckets.Open(t.ctx, bucketURI, secretData)
+	if err != nil {
+		backupLog.Error("task could not open bucket: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		return "", false, err
+	}
+	defer release()
+
+	backupsDir := path.Join(t.req.BackupBaseDir, DirName)
+
+	if t.req.Snapshot {
+		root, err := snapshotRoot(bucketURI)
+		if err != nil {
+			return "", false, err
+		}
+		backupLog.Info("task starts snapshot", zap.Uint32("task id", ID.ID()), zap.String("backups dir", backupsDir), zap.Int("member id", t.req.MemberID))
+		folderKey, err := SnapshotBackup(t.ctx, root, backupsDir, t.req.HazelcastCRName, t.req.MemberID, UploadOptions{
+			Location:      t.location,
+			StableWindow:  t.stable.Window,
+			StableTimeout: t.stable.Timeout,
+		})
+		if err != nil {
+			backupLog.Error("task could not write snapshot: "+err.Error(), zap.Uint32("task id", ID.ID()))
+			return "", false, err
+		}
+		return folderKey, true, nil
+	}
+
+	log.Println("TASK", ID, "Staring backup upload:", backupsDir, t.req.MemberID)
+	opts := UploadOptions{
+		TimeBox:          time.Duration(t.req.TimeBoxSeconds) * time.Second,
+		Location:         t.location,
+		MetaFiles:        t.metaFiles,
+		StableWindow:     t.stable.Window,
+		StableTimeout:    t.stable.Timeout,
+		ACL:              t.acl,
+		Codec:            t.codec,
+		ClusterSize:      t.req.ClusterSize,
+		Manifest:         t.req.Manifest(),
+		ClusterName:      t.req.ClusterName,
+		HazelcastVersion: t.req.HazelcastVersion,
+		EncryptionKey:    encryptionKey,
+		FileManifest:     t.fileManifest,
+		HashWorkers:      t.hashWorkers,
+		Incremental:      t.incremental,
+		Bucket:           bucketURI,
+		Reused:           &t.reused,
+	}
+	if t.req.ACL != "" {
+		opts.ACL = t.req.ACL
+	}
+	opts.Uploaded = t.uploaded
+	if t.progress.Enabled() {
+		if opts.Uploaded == nil {
+			opts.Uploaded = new(atomic.Int64)
+		}
+		uploaded := opts.Uploaded
+		defer t.progress.Add("upload "+ID.String()[:8], func() (int64, int64) { return uploaded.Load(), total })()
+	}
+	folderKey, done, err := UploadBackupWithin(t.ctx, b, backupsDir, t.req.HazelcastCRName, t.req.MemberID, opts)
+	if err != nil {
+		backupLog.Error("task could not upload to bucket: "+err.Error(), zap.Uint32("task id", ID.ID()))
+		return "", false, err
+	}
+	return folderKey, done, nil
+}
+
+// taskSummary is the detail of the termination message of a task
+type taskSummary struct {
+	TaskID    uuid.UUID `json:"task_id"`
+	BackupKey string    `json:"backup_key,omitempty"`
+	// LargestContributors are the largest folders of a backup that exceeded the maximum size
+	LargestContributors []api.SizeContributor `json:"largest_contributors,omitempty"`
+}
+
+// writeSummary writes the outcome of the task to the termination message, the sidecar keeps
+// running but if the container exits the result of the last task is shown in the pod status
+func (t *task) writeSummary(ID uuid.UUID, start time.Time) {
+	s := termination.Summary{
+		Command:  "sidecar",
+		Status:   api.StatusSuccess,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Details:  taskSummary{TaskID: ID, BackupKey: logger.Redact(t.backupKey)},
+	}
+	var sizeErr *sizeExceededError
+	var missedErr *missedRunError
+	switch {
+	case errors.Is(t.err, context.Canceled):
+		s.Status = api.StatusCanceled
+	case errors.As(t.err, &missedErr):
+		s.Status = api.StatusSkipped
+		s.Message = t.err.Error()
+	case errors.As(t.err, &sizeErr):
+		s.Status = api.StatusSizeExceeded
+		s.Message = logger.Redact(t.err.Error())
+		s.Details = taskSummary{TaskID: ID, LargestContributors: sizeErr.Contributors}
+	case t.err != nil:
+		s.Status = api.StatusFailure
+		s.Message = logger.Redact(t.err.Error())
+	case t.partial:
+		s.Status = api.StatusPartial
+	}
+	if err := termination.Write(s); err != nil {
+		backupLog.Warn("could not write termination message: " + err.Error())
+	}
+}
+
+// report sends a backup event to Management Center, failures are only logged
+func (t *task) report(phase string) {
+	e := mancenter.Event{Type: mancenter.Backup, Phase: phase, Key: t.backupKey}
+	if t.err != nil {
+		e.Message = logger.Redact(t.err.Error())
+	}
+	// the task context could already be canceled
+	if err := t.events.Report(context.Background(), e); err != nil {
+		backupLog.Warn("could not report event to management center: " + err.Error())
+	}
+	if err := notify.Send(context.Background(), e); err != nil {
+		backupLog.Warn("could not send notification: " + err.Error())
+	}
 }
@@ -1,9 +1,11 @@
 package sidecar
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/fs"
@@ -11,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"gocloud.dev/blob"
@@ -18,66 +21,268 @@ import (
 	_ "gocloud.dev/blob/s3blob"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	bkt "github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+	"github.com/hazelcast/platform-operator-agent/internal/version"
 )
 
 var (
-	ErrEmptyBackupDir     = errors.New("empty backup directory")
-	ErrMemberIDOutOfIndex = errors.New("MemberID is out of index for present backup folders")
+	ErrEmptyBackupDir     = serverutil.WithClass(serverutil.ErrNotFound, errors.New("empty backup directory"))
+	ErrMemberIDOutOfIndex = serverutil.WithClass(serverutil.ErrInvalid, errors.New("MemberID is out of index for present backup folders"))
 )
 
 func UploadBackup(ctx context.Context, bucket *blob.Bucket, backupsDir, prefix string, memberID int) (string, error) {
+	key, _, err := UploadBackupWithin(ctx, bucket, backupsDir, prefix, memberID, UploadOptions{})
+	return key, err
+}
+
+// UploadOptions are the optional settings of an upload
+type UploadOptions struct {
+	// TimeBox limits the duration of a single upload window, zero means no limit
+	TimeBox time.Duration
+	// Location is the time zone of the backup folder names, UTC if nil
+	Location *time.Location
+	// MetaFiles are stored under meta/ in the archive, e.g. the Hazelcast configuration files
+	MetaFiles []string
+	// StableWindow is the time the backup must not have been modified before it is archived, zero disables the check
+	StableWindow time.Duration
+	// StableTimeout limits the time to wait for a stable backup
+	StableTimeout time.Duration
+	// ACL is the canned ACL of the uploaded objects, empty keeps the bucket default
+	ACL string
+	// Codec is the compression of the archive, gzip with the default level if not set
+	Codec archive.Codec
+	// ClusterSize is the number of members taking the backup, recorded on the archive if set
+	ClusterSize int
+	// Manifest is stored as meta/manifest.json in the archive if set
+	Manifest *api.BackupManifest
+	// ClusterName and HazelcastVersion are recorded in the manifest next to the archive, empty if not known
+	ClusterName      string
+	HazelcastVersion string
+	// EncryptionKey encrypts the archive with AES-256-GCM if set, the key of the archive gets the .enc extension
+	EncryptionKey []byte
+	// FileManifest stores the files of the backup with their SHA-256 digests as meta/files.json
+	FileManifest bool
+	// HashWorkers is the number of files hashed in parallel for the file manifest, the number of CPUs if 0
+	HashWorkers int
+	// Uploaded counts the bytes written to the bucket if set, e.g. for a progress bar
+	Uploaded *atomic.Int64
+	// Incremental uploads only the chunk files that changed since the last incremental upload to
+	// Bucket, encrypted and time-boxed uploads are always full
+	Incremental bool
+	// Bucket is the URI of the bucket written to, the objects of incremental uploads are only reused in the same
+	// bucket and time-boxed uploads only resume in the same bucket
+	Bucket string
+	// Reused counts the bytes of an incremental archive that were not uploaded again if set
+	Reused *atomic.Int64
+}
+
+// UploadBackupWithin uploads the latest backup of the member. If the time box is positive the archive is
+// uploaded in parts and the upload stops once it is exceeded, the progress is kept next to the
+// backup and the following call continues from there. It returns false if the upload is not complete yet.
+func UploadBackupWithin(ctx context.Context, bucket *blob.Bucket, backupsDir, prefix string, memberID int, opts UploadOptions) (string, bool, error) {
+	mb, err := latestMemberBackup(backupsDir, memberID, opts.Location)
+	if err != nil {
+		return "", false, err
+	}
+	memberID = mb.memberID
+	uuidDir := mb.dir
+	codec := opts.Codec
+	if codec.Compression == "" {
+		codec = archive.DefaultCodec
+	}
+	key := filepath.Join(prefix, mb.folder, mb.uuid+codec.Compression.Extension())
+	if opts.EncryptionKey != nil {
+		key += archive.EncryptedExtension
+	}
+
+	if err = waitStable(ctx, uuidDir, opts.StableWindow, opts.StableTimeout); err != nil {
+		return "", false, err
+	}
+
+	// the files scanned for the snapshot also size the upload buffer and are recorded for estimates
+	snap, scanned, err := snapshotBackup(uuidDir, key, opts.Bucket)
+	if err != nil {
+		return "", false, err
+	}
+	var size int64
+	for _, f := range scanned {
+		size += f.Size
+	}
+
+	meta := existingFiles(opts.MetaFiles)
+	if opts.Manifest != nil {
+		manifest := *opts.Manifest
+		manifest.Snapshot = snap
+		name, err := writeManifest(&manifest)
+		if err != nil {
+			return "", false, err
+		}
+		defer os.RemoveAll(filepath.Dir(name))
+		meta = append(meta, name)
+	}
+	// the files are described in the manifest next to the archive as well
+	files, err := backupFiles(ctx, mb, backupsDir, key, opts)
+	if err != nil {
+		return "", false, err
+	}
+	if opts.FileManifest {
+		name, err := writeFileManifest(files)
+		if err != nil {
+			return "", false, err
+		}
+		defer os.RemoveAll(filepath.Dir(name))
+		meta = append(meta, name)
+	}
+	// the throughput is only measured if the archive is uploaded in a single window
+	start := time.Now()
+	_, err = os.Stat(uuidDir + ".progress")
+	resumed := err == nil
+	incremental := opts.Incremental && opts.EncryptionKey == nil && opts.TimeBox == 0
+	if opts.Incremental && !incremental {
+		backupLog.Info("encrypted and time-boxed backups are uploaded in full")
+	}
+	var sum []byte
+	switch {
+	case incremental:
+		// the throughput of an incremental upload says nothing about the bandwidth
+		resumed = true
+		err = uploadIncremental(ctx, bucket, key, prefix, uuidDir, mb.uuid, meta, codec, snap, files, incrementalStateName(backupsDir, memberID), opts)
+		if err != nil {
+			return "", false, err
+		}
+	case opts.TimeBox > 0:
+		var done bool
+		done, sum, err = uploadBackupParts(ctx, bucket, opts.Bucket, key, uuidDir, mb.uuid, meta, codec, opts.TimeBox, size, opts.ACL, opts.ClusterSize, snap, files, opts.EncryptionKey, opts.Uploaded)
+		if err != nil {
+			return "", false, err
+		}
+		if !done {
+			return key, false, nil
+		}
+	default:
+		sum, err = uploadBackup(ctx, bucket, key, uuidDir, mb.uuid, meta, codec, size, opts.ACL, opts.ClusterSize, snap, opts.EncryptionKey, opts.Uploaded)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	m := &archive.ArchiveManifest{
+		MemberID:         memberID,
+		Sequence:         filepath.Base(mb.seqDir),
+		Archive:          key,
+		Compression:      codec.Compression,
+		Encrypted:        opts.EncryptionKey != nil,
+		Files:            files,
+		ClusterName:      opts.ClusterName,
+		HazelcastVersion: opts.HazelcastVersion,
+		AgentVersion:     version.Get(),
+		Created:          clock.Now().UTC(),
+	}
+	if err = writeArchiveManifest(ctx, bucket, m, sum, opts.ACL); err != nil {
+		return "", false, err
+	}
+
+	var elapsed time.Duration
+	if !resumed {
+		elapsed = time.Since(start)
+	}
+	if err = recordUpload(ctx, bucket, backupsDir, memberID, key, scanned, elapsed); err != nil {
+		backupLog.Warn("could not record upload for estimates: " + err.Error())
+	}
+
+	if err = mb.markDone(); err != nil {
+		return "", false, err
+	}
+	return key, true, nil
+}
+
+// backupFiles returns the files of the backup with their digests. A time-boxed upload hashes the files
+// in its first window and keeps them with its progress, the following windows do not hash them again.
+func backupFiles(ctx context.Context, mb memberBackup, backupsDir, key string, opts UploadOptions) ([]archive.FileEntry, error) {
+	if opts.TimeBox > 0 {
+		p, err := readProgress(mb.dir+".progress", key, opts.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if p.Files != nil {
+			return p.Files, nil
+		}
+	}
+	return hashBackup(ctx, mb.dir, mb.uuid, hashCacheName(backupsDir, mb.memberID), opts.HashWorkers)
+}
+
+// memberBackup is the latest local backup of a member
+type memberBackup struct {
+	seqDir string
+	// folder is the dated folder name of the sequence
+	folder string
+	uuids  []fs.DirEntry
+	uuid   string
+	dir    string
+	// memberID is 0 if the members are isolated
+	memberID int
+}
+
+func latestMemberBackup(backupsDir string, memberID int, loc *time.Location) (memberBackup, error) {
 	backupSeqs, err := fileutil.FolderSequence(backupsDir)
 	if err != nil {
-		return "", err
+		return memberBackup{}, err
 	}
 
 	if len(backupSeqs) == 0 {
-		return "", ErrEmptyBackupDir
+		return memberBackup{}, ErrEmptyBackupDir
 	}
 
 	// Get the latest <backup-dir>/backup-<backupSeq> dir, ReadDir returns sorted slice
 	latestSeq := backupSeqs[len(backupSeqs)-1]
 	latestSeqDir := filepath.Join(backupsDir, latestSeq.Name())
-	humanReadableSeq, err := convertHumanReadableFormat(latestSeq.Name())
+	humanReadableSeq, err := convertHumanReadableFormat(latestSeq.Name(), loc)
 	if err != nil {
-		return "", err
+		return memberBackup{}, err
 	}
 
 	backupUUIDS, err := fileutil.FolderUUIDs(latestSeqDir)
 	if err != nil {
-		return "", err
+		return memberBackup{}, err
 	}
 
 	// If there are multiple backup UUIDs in the folder and memberID is out of index
 	if len(backupUUIDS) != 1 && len(backupUUIDS) <= memberID {
-		return "", ErrMemberIDOutOfIndex
+		return memberBackup{}, ErrMemberIDOutOfIndex
 	}
 
 	// If there is only one backup, members are isolated. No need for memberID
 	if len(backupUUIDS) == 1 {
 		memberID = 0
 	}
-	uuid := backupUUIDS[memberID]
-	uuidDir := filepath.Join(latestSeqDir, uuid.Name())
-	key := filepath.Join(prefix, humanReadableSeq, uuid.Name()+".tar.gz")
-
-	err = uploadBackup(ctx, bucket, key, uuidDir, uuid.Name())
-	if err != nil {
-		return "", err
-	}
+	uuid := backupUUIDS[memberID].Name()
+	return memberBackup{
+		seqDir:   latestSeqDir,
+		folder:   humanReadableSeq,
+		uuids:    backupUUIDS,
+		uuid:     uuid,
+		dir:      filepath.Join(latestSeqDir, uuid),
+		memberID: memberID,
+	}, nil
+}
 
-	err = os.WriteFile(uuidDir+".delete", []byte{}, 0600)
+// markDone marks the backup to be deleted once it is stored
+func (b memberBackup) markDone() error {
+	err := os.WriteFile(b.dir+".delete", []byte{}, 0600)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	// we finished uploading backups, delete the sequence dir if all uuids are marked to be deleted
-	if allFilesMarkedToBeDeleted(backupUUIDS, latestSeqDir) {
-		os.RemoveAll(latestSeqDir)
+	if allFilesMarkedToBeDeleted(b.uuids, b.seqDir) {
+		os.RemoveAll(b.seqDir)
 	}
-
-	return key, nil
+	return nil
 }
 
 func allFilesMarkedToBeDeleted(files []fs.DirEntry, dir string) bool {
@@ -90,63 +295,294 @@ func allFilesMarkedToBeDeleted(files []fs.DirEntry, dir string) bool {
 	return true
 }
 
-func uploadBackup(ctx context.Context, bucket *blob.Bucket, name, backupDir, baseDirName string) error {
-	w, err := bucket.NewWriter(ctx, name, nil)
+// uploadBackup writes the archive as a single object and returns its digest
+func uploadBackup(ctx context.Context, bucket *blob.Bucket, name, backupDir, baseDirName string, meta []string, c archive.Codec, size int64, acl string, clusterSize int, snap *api.SnapshotInfo, encryptionKey []byte, uploaded *atomic.Int64) ([]byte, error) {
+	wo, err := writerOptions(size, acl)
+	if err != nil {
+		return nil, err
+	}
+	w, err := bucket.NewWriter(ctx, name, archive.WithSnapshot(archive.WithClusterSize(wo, clusterSize), snap))
+	if err != nil {
+		return nil, err
+	}
+
+	// the checksum covers the stored bytes, it is verified before the archive is decrypted
+	h := sha256.New()
+	aw, err := archiveWriter(io.MultiWriter(w, h, uploadCounter{uploaded}), encryptionKey)
+	if err == nil {
+		_, err = archive.CreatePart(aw, c, backupDir, baseDirName, meta, &archive.Progress{}, func() bool { return false })
+	}
+	if err == nil {
+		err = aw.Close()
+	}
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	// the checksum is written once the archive is complete
+	co, err := writerOptions(0, acl)
+	if err != nil {
+		return nil, err
+	}
+	sum := h.Sum(nil)
+	return sum, archive.WriteChecksum(ctx, bucket, name, sum, co)
+}
+
+// writeArchiveManifest completes the manifest with the size and the digest of the uploaded archive and
+// writes it next to the archive, incremental archives have no digest
+func writeArchiveManifest(ctx context.Context, bucket *blob.Bucket, m *archive.ArchiveManifest, sum []byte, acl string) error {
+	size, err := archiveSize(ctx, bucket, m.Archive)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	m.Size = size
+	if sum != nil {
+		m.SHA256 = hex.EncodeToString(sum)
+	}
+	mo, err := writerOptions(0, acl)
+	if err != nil {
+		return err
+	}
+	return archive.WriteArchiveManifest(ctx, bucket, m.Archive, m, mo)
+}
 
-	return CreateArchive(w, backupDir, baseDirName)
+// archiveWriter encrypts the archive written to w if a key is set, closing it does not close w
+func archiveWriter(w io.Writer, encryptionKey []byte) (io.WriteCloser, error) {
+	if encryptionKey == nil {
+		return nopWriteCloser{w}, nil
+	}
+	return archive.NewEncryptWriter(w, encryptionKey)
 }
 
-func CreateArchive(w io.Writer, dir, baseDirName string) error {
-	g := gzip.NewWriter(w)
-	defer g.Close()
+// uploadCounter counts the bytes written through it, a nil counter counts nothing
+type uploadCounter struct {
+	n *atomic.Int64
+}
 
-	t := tar.NewWriter(g)
-	defer t.Close()
+func (c uploadCounter) Write(p []byte) (int, error) {
+	if c.n != nil {
+		c.n.Add(int64(len(p)))
+	}
+	return len(p), nil
+}
 
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeManifest writes the backup manifest into a new temporary folder, the caller removes the folder
+func writeManifest(m *api.BackupManifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "backup-manifest")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, archive.BackupManifestName)
+	if err = os.WriteFile(name, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return name, nil
+}
+
+// snapshotBackup scans the backup files right before the backup is archived and records their
+// modification times, it also returns the scanned files. A time-boxed upload keeps the snapshot of
+// its first window.
+func snapshotBackup(backupDir, key, bucketURI string) (*api.SnapshotInfo, map[string]fileState, error) {
+	p, err := readProgress(backupDir+".progress", key, bucketURI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &api.SnapshotInfo{Start: clock.Now().UTC()}
+	files, err := scanBackup(backupDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Snapshot != nil {
+		return p.Snapshot, files, nil
+	}
+	for _, f := range files {
+		if s.OldestModTime.IsZero() || f.ModTime.Before(s.OldestModTime) {
+			s.OldestModTime = f.ModTime
+		}
+		if f.ModTime.After(s.NewestModTime) {
+			s.NewestModTime = f.ModTime
 		}
+	}
+	s.End = clock.Now().UTC()
+	return s, files, nil
+}
 
-		header, err := tar.FileInfoHeader(info, info.Name())
-		if err != nil {
-			return err
+// existingFiles drops the files that do not exist, a missing configuration snapshot must not fail the backup
+func existingFiles(files []string) []string {
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			backupLog.Warn("skipping meta file: " + err.Error())
+			continue
 		}
+		existing = append(existing, f)
+	}
+	return existing
+}
 
-		// make sure files are relative to baseDirName
-		header.Name = filepath.Join(baseDirName, strings.TrimPrefix(path, dir))
+// uploadProgress is persisted next to the backup directory between time-boxed upload windows
+type uploadProgress struct {
+	Key string `json:"key"`
+	// Bucket is the URI of the bucket holding the parts written so far, a window that failed over
+	// to another bucket starts over
+	Bucket string `json:"bucket,omitempty"`
+	// Hash is the state of the checksum of the parts written so far
+	Hash []byte `json:"hash,omitempty"`
+	// Snapshot is taken in the first window, so that all parts record the same one
+	Snapshot *api.SnapshotInfo `json:"snapshot,omitempty"`
+	// Files are hashed in the first window as well
+	Files []archive.FileEntry `json:"files,omitempty"`
+	archive.Progress
+}
 
-		if err = t.WriteHeader(header); err != nil {
-			return err
-		}
+// uploadBackupParts writes the next part of the archive within the time box, it returns the digest of
+// the archive once the last part is written
+func uploadBackupParts(ctx context.Context, bucket *blob.Bucket, bucketURI, key, backupDir, baseDirName string, meta []string, c archive.Codec, timeBox time.Duration, size int64, acl string, clusterSize int, snap *api.SnapshotInfo, files []archive.FileEntry, encryptionKey []byte, uploaded *atomic.Int64) (bool, []byte, error) {
+	wo, err := writerOptions(size, acl)
+	if err != nil {
+		return false, nil, err
+	}
+
+	progressFile := backupDir + ".progress"
+	p, err := readProgress(progressFile, key, bucketURI)
+	if err != nil {
+		return false, nil, err
+	}
+	if p.Snapshot == nil {
+		p.Snapshot = snap
+	}
+	if p.Files == nil {
+		p.Files = files
+	}
 
-		if info.IsDir() {
-			return nil
+	// the checksum covers all parts, its state is carried over between the upload windows
+	h := sha256.New()
+	if len(p.Hash) > 0 {
+		if err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(p.Hash); err != nil {
+			return false, nil, err
 		}
+	}
 
-		f, err := os.Open(path)
-		if err != nil {
-			return err
+	deadline := time.Now().Add(timeBox)
+	w, err := bucket.NewWriter(ctx, archive.PartKey(key, p.Parts), wo)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// every part is encrypted on its own, the parts are decrypted one after the other
+	next := p.Progress
+	var done bool
+	aw, err := archiveWriter(io.MultiWriter(w, h, uploadCounter{uploaded}), encryptionKey)
+	if err == nil {
+		done, err = archive.CreatePart(aw, c, backupDir, baseDirName, meta, &next, func() bool {
+			return time.Now().After(deadline)
+		})
+	}
+	if err == nil {
+		err = aw.Close()
+	}
+	if err != nil {
+		w.Close()
+		return false, nil, err
+	}
+	if err = w.Close(); err != nil {
+		return false, nil, err
+	}
+	p.Progress = next
+
+	if !done {
+		if p.Hash, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return false, nil, err
 		}
-		defer f.Close()
+		return false, nil, writeProgress(progressFile, p)
+	}
 
-		_, err = io.Copy(t, f)
+	// the manifest has no size to tune for, only the ACL applies
+	mo, err := writerOptions(0, acl)
+	if err != nil {
+		return false, nil, err
+	}
+	// the manifest completes the archive, so the checksum is written before
+	sum := h.Sum(nil)
+	if err = archive.WriteChecksum(ctx, bucket, key, sum, mo); err != nil {
+		return false, nil, err
+	}
+	if err = archive.WriteManifest(ctx, bucket, key, p.Parts, archive.WithSnapshot(archive.WithClusterSize(mo, clusterSize), p.Snapshot)); err != nil {
+		return false, nil, err
+	}
+	// an archive completed in its first window never wrote a progress file
+	if err = os.Remove(progressFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, nil, err
+	}
+	return true, sum, nil
+}
+
+func readProgress(name, key, bucketURI string) (*uploadProgress, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return &uploadProgress{Key: key, Bucket: bucketURI}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p uploadProgress
+	if err = json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	// progress of an upload to another location, start over
+	if p.Key != key || p.Bucket != bucketURI {
+		return &uploadProgress{Key: key, Bucket: bucketURI}, nil
+	}
+	return &p, nil
+}
+
+func writeProgress(name string, p *uploadProgress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
 		return err
-	})
+	}
+	return os.WriteFile(name, data, 0600)
+}
+
+// writerOptions sizes the upload buffer for a backup of size bytes, archives are never larger than the
+// files. The objects get the canned ACL if one is set.
+func writerOptions(size int64, acl string) (*blob.WriterOptions, error) {
+	return bkt.WithACL(&blob.WriterOptions{BufferSize: bkt.WriteBufferSize(size)}, acl)
 }
 
-// convertHumanReadableFormat converts backup-sequenceID into human-readable format.
-// backup-1643801670242 --> 2022-02-18-14-57-44
-func convertHumanReadableFormat(backupFolderName string) (string, error) {
+func CreateArchive(w io.Writer, dir, baseDirName string) error {
+	return archive.Create(w, dir, baseDirName)
+}
+
+// convertHumanReadableFormat converts backup-sequenceID into human-readable format in the given time zone.
+// Names in UTC have no zone suffix, other zones have their offset appended.
+// backup-1643801670242 --> 2022-02-18-14-57-44 (UTC) or 2022-02-18-15-57-44+0100 (Europe/Berlin)
+func convertHumanReadableFormat(backupFolderName string, loc *time.Location) (string, error) {
 	epochString := strings.ReplaceAll(backupFolderName, "backup-", "")
 	timestamp, err := strconv.ParseInt(epochString, 10, 64)
 	if err != nil {
 		return "", err
 	}
-	t := time.UnixMilli(timestamp).UTC()
-	return t.Format("2006-01-02-15-04-05"), nil
+	if loc == nil || loc == time.UTC {
+		return time.UnixMilli(timestamp).UTC().Format(fileutil.FolderTimeFormat), nil
+	}
+	return time.UnixMilli(timestamp).In(loc).Format(fileutil.FolderTimeFormat + fileutil.FolderZoneFormat), nil
 }
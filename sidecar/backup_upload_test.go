@@ -1,29 +1,53 @@
 package sidecar
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 )
 
 func TestConvertHumanReadableFormat(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.Nil(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.Nil(t, err)
+
 	tests := []struct {
 		name    string
 		date    string
+		loc     *time.Location
 		want    string
 		wantErr bool
 	}{
 		{
-			"Only UTC/GMT time zone should work", "backup-1659457880416", "2022-08-02-16-31-20", false,
+			"Only UTC/GMT time zone should work", "backup-1659457880416", nil, "2022-08-02-16-31-20", false,
+		},
+		{
+			"explicit UTC has no suffix", "backup-1659457880416", time.UTC, "2022-08-02-16-31-20", false,
+		},
+		{
+			"positive offset", "backup-1659457880416", berlin, "2022-08-02-18-31-20+0200", false,
+		},
+		{
+			"negative offset", "backup-1659457880416", newYork, "2022-08-02-12-31-20-0400", false,
 		},
 		{
-			"incorrect input should fail", "backup-1659aaaa", "", true,
+			"incorrect input should fail", "backup-1659aaaa", nil, "", true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			i, err := convertHumanReadableFormat(tt.date)
+			i, err := convertHumanReadableFormat(tt.date, tt.loc)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -32,3 +56,72 @@ func TestConvertHumanReadableFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestWaitStable(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		modified time.Time
+		window   time.Duration
+		timeout  time.Duration
+		wantErr  error
+	}{
+		{"disabled", time.Now(), 0, 0, nil},
+		{"stable", old, time.Minute, 0, nil},
+		{"becomes stable", time.Now(), 50 * time.Millisecond, time.Second, nil},
+		{"timeout", time.Now(), time.Minute, 50 * time.Millisecond, ErrSourceNotStable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := os.MkdirTemp("", "wait_stable")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			err = fileutil.CreateFiles(tmpdir, []fileutil.File{{Name: "s00/value/01/0000000000000001.chunk"}}, false)
+			require.Nil(t, err)
+			for _, p := range []string{"s00/value/01/0000000000000001.chunk", "s00/value/01", "s00/value", "s00", ""} {
+				require.Nil(t, os.Chtimes(filepath.Join(tmpdir, p), old, old))
+			}
+			require.Nil(t, os.Chtimes(filepath.Join(tmpdir, "s00/value/01/0000000000000001.chunk"), tt.modified, tt.modified))
+
+			err = waitStable(context.Background(), tmpdir, tt.window, tt.timeout)
+			require.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestMemberWaitIdle(t *testing.T) {
+	idle := memberHealth{ClusterState: "ACTIVE", ClusterSafe: true}
+	busy := memberHealth{ClusterState: "IN_TRANSITION", ClusterSafe: true}
+	tests := []struct {
+		name      string
+		responses []memberHealth
+		policy    string
+		timeout   time.Duration
+		wantErr   error
+	}{
+		{"idle", []memberHealth{idle}, MemberPolicyWait, time.Second, nil},
+		{"becomes idle", []memberHealth{busy, busy, idle}, MemberPolicyWait, time.Second, nil},
+		{"reject", []memberHealth{busy, idle}, MemberPolicyReject, time.Second, ErrMemberBusy},
+		{"timeout", []memberHealth{busy}, MemberPolicyWait, 50 * time.Millisecond, ErrMemberBusy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/hazelcast/health", r.URL.Path)
+				i := calls
+				if i >= len(tt.responses) {
+					i = len(tt.responses) - 1
+				}
+				calls++
+				_ = json.NewEncoder(w).Encode(tt.responses[i])
+			}))
+			defer server.Close()
+
+			p := memberPolicy{URL: server.URL, Policy: tt.policy, Timeout: tt.timeout, Interval: 10 * time.Millisecond}
+			err := p.waitIdle(context.Background())
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -3,20 +3,66 @@ package sidecar
 import (
 	"context"
 	"flag"
+	"time"
 
 	"github.com/google/subcommands"
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
-	"github.com/kelseyhightower/envconfig"
 )
 
 var cmdLog = logger.New().Named("cmd")
 
 type Cmd struct {
-	HTTPAddress  string `envconfig:"BACKUP_HTTP_ADDRESS"`
-	HTTPSAddress string `envconfig:"BACKUP_HTTPS_ADDRESS"`
-	CA           string `envconfig:"BACKUP_CA"`
-	Cert         string `envconfig:"BACKUP_CERT"`
-	Key          string `envconfig:"BACKUP_KEY"`
+	HTTPAddress   string        `envconfig:"BACKUP_HTTP_ADDRESS"`
+	HTTPSAddress  string        `envconfig:"BACKUP_HTTPS_ADDRESS"`
+	CA            string        `envconfig:"BACKUP_CA"`
+	Cert          string        `envconfig:"BACKUP_CERT"`
+	Key           string        `envconfig:"BACKUP_KEY"`
+	OperatorCIDR  string        `envconfig:"BACKUP_OPERATOR_CIDR"`
+	AllowedCIDRs  string        `envconfig:"BACKUP_ALLOWED_CIDRS"`
+	PodIP         string        `envconfig:"POD_IP"`
+	MCURL         string        `envconfig:"BACKUP_MC_URL"`
+	MCToken       string        `envconfig:"BACKUP_MC_TOKEN"`
+	Timezone      string        `envconfig:"BACKUP_TIMEZONE"`
+	MaxTasks      int           `envconfig:"BACKUP_MAX_TASKS"`
+	MaxQueued     int           `envconfig:"BACKUP_MAX_QUEUED"`
+	ConfigFiles   string        `envconfig:"BACKUP_CONFIG_FILES"`
+	UI            bool          `envconfig:"BACKUP_UI"`
+	BaseDir       string        `envconfig:"BACKUP_BASE_DIR"`
+	StableWindow  time.Duration `envconfig:"BACKUP_STABLE_WINDOW"`
+	StableTimeout time.Duration `envconfig:"BACKUP_STABLE_TIMEOUT"`
+	ObjectACL     string        `envconfig:"BACKUP_OBJECT_ACL"`
+	MemberURL     string        `envconfig:"BACKUP_MEMBER_URL"`
+	MemberPolicy  string        `envconfig:"BACKUP_MEMBER_POLICY"`
+	MemberTimeout time.Duration `envconfig:"BACKUP_MEMBER_TIMEOUT"`
+	MemberCluster string        `envconfig:"BACKUP_MEMBER_CLUSTER_NAME"`
+	MemberPass    string        `envconfig:"BACKUP_MEMBER_PASSWORD"`
+	Compression   string        `envconfig:"BACKUP_COMPRESSION"`
+	Level         int           `envconfig:"BACKUP_COMPRESSION_LEVEL"`
+	FileManifest  bool          `envconfig:"BACKUP_FILE_MANIFEST"`
+	HashWorkers   int           `envconfig:"BACKUP_HASH_WORKERS"`
+	ProgressLog   time.Duration `envconfig:"BACKUP_PROGRESS_LOG_INTERVAL"`
+	MaxBytes      string        `envconfig:"BACKUP_MAX_BYTES"`
+	BucketIdle    time.Duration `envconfig:"BACKUP_BUCKET_IDLE_TIMEOUT"`
+	MissedRun     string        `envconfig:"BACKUP_MISSED_RUN_POLICY"`
+	MissedGrace   time.Duration `envconfig:"BACKUP_MISSED_RUN_GRACE"`
+	Schedule      string        `envconfig:"BACKUP_SCHEDULE"`
+	ScheduleURL   string        `envconfig:"BACKUP_SCHEDULE_BUCKET_URL"`
+	ScheduleCreds string        `envconfig:"BACKUP_SCHEDULE_SECRET_NAME"`
+	SchedulePath  string        `envconfig:"BACKUP_SCHEDULE_PREFIX"`
+	ScheduleID    int           `envconfig:"BACKUP_SCHEDULE_MEMBER_ID"`
+	KeepLast      int           `envconfig:"BACKUP_KEEP_LAST"`
+	KeepDays      int           `envconfig:"BACKUP_KEEP_DAYS"`
+	UploadWindow  time.Duration `envconfig:"BACKUP_UPLOAD_WINDOW"`
+	PruneDryRun   bool          `envconfig:"BACKUP_PRUNE_DRY_RUN"`
+	PruneRate     float64       `envconfig:"BACKUP_PRUNE_RATE"`
+	Pushgateway   string        `envconfig:"BACKUP_PUSHGATEWAY_URL"`
+	LocalCleanup  bool          `envconfig:"BACKUP_LOCAL_CLEANUP"`
+	Incremental   bool          `envconfig:"BACKUP_INCREMENTAL"`
+	Debug         bool          `envconfig:"BACKUP_DEBUG"`
+	DebugCallers  string        `envconfig:"BACKUP_DEBUG_IDENTITIES"`
 }
 
 func (*Cmd) Name() string     { return "sidecar" }
@@ -29,13 +75,56 @@ func (p *Cmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.CA, "ca", "ca.crt", "http server client ca")
 	f.StringVar(&p.Cert, "cert", "tls.crt", "http server tls cert")
 	f.StringVar(&p.Key, "key", "tls.key", "http server tls key")
+	f.StringVar(&p.OperatorCIDR, "operator-cidr", "", "operator service CIDR allowed to call mutating endpoints, in addition to the loopback and pod addresses")
+	f.StringVar(&p.AllowedCIDRs, "allowed-cidrs", "", "comma separated extra CIDRs allowed to call mutating endpoints, 0.0.0.0/0,::/0 allows every client with a valid certificate")
+	f.StringVar(&p.PodIP, "pod-ip", "", "IP address of the pod, allowed to call mutating endpoints like the loopback addresses")
+	f.StringVar(&p.MCURL, "mc-url", "", "management center endpoint for backup events")
+	f.StringVar(&p.MCToken, "mc-token", "", "management center endpoint token")
+	f.StringVar(&p.Timezone, "timezone", "UTC", "time zone of the backup folder names")
+	f.IntVar(&p.MaxTasks, "max-tasks", 0, "maximum number of concurrently running tasks, 0 means unlimited")
+	f.IntVar(&p.MaxQueued, "max-queued", 0, "maximum number of waiting tasks before uploads are rejected, 0 means unlimited")
+	f.StringVar(&p.ConfigFiles, "config-files", "", "comma separated Hazelcast configuration files stored under meta/ in the backup archive")
+	f.BoolVar(&p.UI, "ui", false, "serve a read-only status page on the http address")
+	f.DurationVar(&p.StableWindow, "stable-window", 0, "time the backup must not have been modified before it is archived, 0 disables the check")
+	f.DurationVar(&p.StableTimeout, "stable-timeout", 5*time.Minute, "maximum time to wait for the backup to become stable")
+	f.StringVar(&p.ObjectACL, "object-acl", "", "canned ACL of uploaded objects: private, bucket-owner-read or bucket-owner-full-control")
+	f.StringVar(&p.MemberURL, "member-url", "", "REST endpoint of the Hazelcast member checked before archiving, e.g. http://localhost:5701")
+	f.StringVar(&p.MemberPolicy, "member-policy", MemberPolicyWait, "action if the member is busy with a backup: wait or reject")
+	f.DurationVar(&p.MemberTimeout, "member-timeout", 5*time.Minute, "maximum time to wait for a busy member")
+	f.StringVar(&p.MemberCluster, "member-cluster-name", "dev", "cluster name sent with the hot backup requests of the schedule")
+	f.StringVar(&p.MemberPass, "member-password", "", "cluster password sent with the hot backup requests of the schedule")
+	f.StringVar(&p.Compression, "compression", string(archive.Gzip), "compression of the backup archives: gzip, zstd or none")
+	f.IntVar(&p.Level, "compression-level", 0, "compression level, gzip 1-9 or zstd 1-22, 0 means the default of the compression")
+	f.BoolVar(&p.FileManifest, "file-manifest", false, "store the files of the backup with their SHA-256 digests as meta/files.json in the archive")
+	f.IntVar(&p.HashWorkers, "hash-workers", 0, "number of files hashed in parallel for the file manifest, 0 means the number of CPUs")
+	f.DurationVar(&p.ProgressLog, "progress-log-interval", 30*time.Second, "interval of the upload progress log lines when stdout is not a terminal, a terminal shows progress bars, 0 disables the lines")
+	f.StringVar(&p.MaxBytes, "max-bytes", "", "maximum archive size of a backup, e.g. 100GiB, larger backups fail with status SIZE_EXCEEDED, empty means unlimited")
+	f.DurationVar(&p.BucketIdle, "bucket-idle-timeout", 5*time.Minute, "time an unused bucket handle is kept open for the next task, 0 opens the bucket for every task")
+	f.StringVar(&p.MissedRun, "missed-run-policy", api.MissedRunRun, "policy of scheduled backups that start late, e.g. after the sidecar was down, if the request sets none: SKIP or RUN")
+	f.DurationVar(&p.MissedGrace, "missed-run-grace", time.Minute, "time a scheduled backup of the SKIP policy may start late")
+	f.IntVar(&p.KeepLast, "keep-last", 0, "number of the newest dated backup folders of the cluster kept in the bucket after an upload, 0 keeps none by count")
+	f.IntVar(&p.KeepDays, "keep-days", 0, "days the dated backup folders of the cluster are kept in the bucket after an upload, 0 keeps none by age, no backup is deleted if neither -keep-last nor -keep-days is set")
+	f.DurationVar(&p.UploadWindow, "upload-window", 24*time.Hour, "maximum duration of the uploads of a backup, younger backup folders and incremental objects are never pruned")
+	f.BoolVar(&p.PruneDryRun, "prune-dry-run", false, "only report the backups the retention policy would delete")
+	f.Float64Var(&p.PruneRate, "prune-rate", 0, "maximum number of objects deleted per second by the retention policy, 0 means unlimited")
+	f.StringVar(&p.Pushgateway, "pushgateway-url", "", "prometheus pushgateway for the pruning metrics")
+	f.BoolVar(&p.LocalCleanup, "local-cleanup", false, "delete the local backups of the member once the uploaded archive was read back and matches its checksum")
+	f.BoolVar(&p.Incremental, "incremental", false, "upload only the chunk files that changed since the last upload of the member to the bucket, the archive references the objects of the others")
+	f.BoolVar(&p.Debug, "debug", false, "serve the pprof profiles under /debug/pprof/ and the runtime stats under /debug/runtime on the https address")
+	f.StringVar(&p.DebugCallers, "debug-identities", "", "comma separated client certificate identities allowed to call the debug endpoints, empty allows every verified client")
+	f.StringVar(&p.BaseDir, "backup-base-dir", "", "backup base dir shown on the status page, defaults to the one of the latest task, required by the schedule")
+	f.StringVar(&p.Schedule, "schedule", "", "cron expression of backups triggered by the sidecar itself in its time zone, e.g. \"0 2 * * *\" or @daily, empty leaves the backups to the operator")
+	f.StringVar(&p.ScheduleURL, "schedule-bucket-url", "", "bucket URL of the scheduled backups")
+	f.StringVar(&p.ScheduleCreds, "schedule-secret-name", "", "secret name for the bucket credentials of the scheduled backups")
+	f.StringVar(&p.SchedulePath, "schedule-prefix", "", "key prefix of the scheduled backups in the bucket, usually the Hazelcast CR name")
+	f.IntVar(&p.ScheduleID, "schedule-member-id", 0, "backup UUID folder index of the member if the backup folder holds several")
 }
 
-func (p *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (p *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	cmdLog.Info("starting sidecar agent...")
 
 	// overwrite config with environment variables
-	if err := envconfig.Process("sidecar", p); err != nil {
+	if err := config.Process("sidecar", p, f); err != nil {
 		cmdLog.Error("an error occurred while processing config from env: " + err.Error())
 		return subcommands.ExitFailure
 	}
@@ -0,0 +1,50 @@
+package sidecar
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+var started = clock.Now()
+
+// debugHandler serves the pprof profiles and the runtime stats of the sidecar to the clients with
+// one of the certificate identities, any verified client if there are none
+func debugHandler(identities []string) http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("/debug/pprof/", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.HandleFunc("/debug/runtime", runtimeHandler)
+	return serverutil.RequireIdentity(identities, router)
+}
+
+func runtimeHandler(w http.ResponseWriter, _ *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := api.RuntimeStats{
+		GoVersion:      runtime.Version(),
+		UptimeSeconds:  clock.Now().Sub(started).Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+		NumCPU:         runtime.NumCPU(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		HeapAlloc:      m.HeapAlloc,
+		HeapInuse:      m.HeapInuse,
+		Sys:            m.Sys,
+		TotalAlloc:     m.TotalAlloc,
+		NumGC:          m.NumGC,
+		GCPauseSeconds: time.Duration(m.PauseTotalNs).Seconds(),
+	}
+	if m.LastGC > 0 {
+		last := time.Unix(0, int64(m.LastGC)).UTC()
+		stats.LastGC = &last
+	}
+	serverutil.HttpJSON(w, stats)
+}
@@ -0,0 +1,239 @@
+package sidecar
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+const (
+	// defaultTaskLimit is the page size of the task list if the request sets no limit
+	defaultTaskLimit = 100
+	maxListLimit     = 1000
+)
+
+// listQuery holds the pagination and filter parameters of a list request
+type listQuery struct {
+	// Limit is the maximum number of items on a page, 0 if not set
+	Limit int
+	// Continue is the decoded continue token, the page starts after this item
+	Continue string
+	States   map[string]bool
+	Types    map[string]bool
+	Since    time.Time
+	Until    time.Time
+}
+
+func parseListQuery(r *http.Request) (*listQuery, error) {
+	v := r.URL.Query()
+	q := &listQuery{
+		States: parseSet(v.Get("state")),
+		Types:  parseSet(v.Get("type")),
+	}
+
+	if l := v.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return nil, serverutil.WithClass(serverutil.ErrInvalid, fmt.Errorf("limit must be between 1 and %d", maxListLimit))
+		}
+		q.Limit = limit
+	}
+
+	if c := v.Get("continue"); c != "" {
+		token, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil {
+			return nil, serverutil.WithClass(serverutil.ErrInvalid, fmt.Errorf("invalid continue token"))
+		}
+		q.Continue = string(token)
+	}
+
+	var err error
+	if q.Since, err = parseQueryTime(v.Get("since")); err != nil {
+		return nil, serverutil.WithClass(serverutil.ErrInvalid, fmt.Errorf("invalid since: %w", err))
+	}
+	if q.Until, err = parseQueryTime(v.Get("until")); err != nil {
+		return nil, serverutil.WithClass(serverutil.ErrInvalid, fmt.Errorf("invalid until: %w", err))
+	}
+	return q, nil
+}
+
+// parseSet splits a comma separated list, nil means no filter
+func parseSet(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		set[strings.ToUpper(strings.TrimSpace(s))] = true
+	}
+	return set
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// inRange returns true if t is within the since and until bounds of the query, both inclusive
+func (q *listQuery) inRange(t time.Time) bool {
+	if !q.Since.IsZero() && t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && t.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+func continueToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func (s *Service) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		routerLog.Error("error occurred while parsing query: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultTaskLimit
+	}
+
+	serverutil.HttpJSON(w, pageTasks(s.taskInfos(), q))
+}
+
+// taskInfos returns all tasks, newest first
+func (s *Service) taskInfos() []api.TaskInfo {
+	s.Mu.RLock()
+	tasks := make([]api.TaskInfo, 0, len(s.Tasks))
+	for ID, t := range s.Tasks {
+		typ := api.TaskTypeUpload
+		if t.batch != nil {
+			typ = api.TaskTypeBatchUpload
+		}
+		tasks = append(tasks, api.TaskInfo{
+			ID:         ID,
+			Type:       typ,
+			Priority:   t.req.Priority,
+			MemberID:   t.req.MemberID,
+			StatusResp: t.status(),
+		})
+	}
+	s.Mu.RUnlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return taskBefore(tasks[i], tasks[j])
+	})
+	return tasks
+}
+
+// taskBefore orders tasks by the time they were received, newest first, the ID breaks ties
+func taskBefore(a, b api.TaskInfo) bool {
+	ta, tb := a.Caller.ReceivedAt, b.Caller.ReceivedAt
+	if !ta.Equal(tb) {
+		return ta.After(tb)
+	}
+	return a.ID.String() < b.ID.String()
+}
+
+// taskCursor is the continue token of a task, it stays valid if tasks are added or deleted
+func taskCursor(t api.TaskInfo) string {
+	return strconv.FormatInt(t.Caller.ReceivedAt.UnixNano(), 10) + "/" + t.ID.String()
+}
+
+func parseTaskCursor(c string) (api.TaskInfo, error) {
+	nanos, id, ok := strings.Cut(c, "/")
+	if !ok {
+		return api.TaskInfo{}, fmt.Errorf("invalid continue token")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return api.TaskInfo{}, fmt.Errorf("invalid continue token")
+	}
+	ID, err := uuid.Parse(id)
+	if err != nil {
+		return api.TaskInfo{}, fmt.Errorf("invalid continue token")
+	}
+	return api.TaskInfo{ID: ID, StatusResp: api.StatusResp{Caller: &api.Caller{ReceivedAt: time.Unix(0, n)}}}, nil
+}
+
+// pageTasks filters the sorted tasks and returns the page after the continue token
+func pageTasks(tasks []api.TaskInfo, q *listQuery) api.TaskListResp {
+	var after *api.TaskInfo
+	if q.Continue != "" {
+		// an invalid token starts from the beginning, like an expired one
+		if c, err := parseTaskCursor(q.Continue); err == nil {
+			after = &c
+		}
+	}
+
+	resp := api.TaskListResp{Tasks: []api.TaskInfo{}}
+	for _, t := range tasks {
+		if after != nil && !taskBefore(*after, t) {
+			continue
+		}
+		if q.States != nil && !q.States[t.Status] {
+			continue
+		}
+		if q.Types != nil && !q.Types[t.Type] {
+			continue
+		}
+		if !q.inRange(t.Caller.ReceivedAt) {
+			continue
+		}
+		if len(resp.Tasks) == q.Limit {
+			resp.Continue = continueToken(taskCursor(resp.Tasks[len(resp.Tasks)-1]))
+			break
+		}
+		resp.Tasks = append(resp.Tasks, t)
+	}
+	return resp
+}
+
+// pageBackups filters the sorted <sequence>/<uuid> backup paths by their sequence time and
+// returns the page after the continue token, a zero limit returns all backups
+func pageBackups(backups []string, q *listQuery) (Resp, error) {
+	resp := Resp{Backups: []string{}}
+	for _, b := range backups {
+		if q.Continue != "" && b <= q.Continue {
+			continue
+		}
+		if !q.Since.IsZero() || !q.Until.IsZero() {
+			t, err := sequenceTime(b)
+			if err != nil {
+				return Resp{}, err
+			}
+			if !q.inRange(t) {
+				continue
+			}
+		}
+		if q.Limit > 0 && len(resp.Backups) == q.Limit {
+			resp.Continue = continueToken(resp.Backups[len(resp.Backups)-1])
+			break
+		}
+		resp.Backups = append(resp.Backups, b)
+	}
+	return resp, nil
+}
+
+// sequenceTime returns the creation time of a backup from its backup-<epoch millis> folder
+func sequenceTime(backup string) (time.Time, error) {
+	seq, _, _ := strings.Cut(backup, "/")
+	millis, err := strconv.ParseInt(strings.TrimPrefix(seq, "backup-"), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(millis), nil
+}
@@ -0,0 +1,209 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+// errQueueFull is returned if a task is submitted while the maximum number of tasks is waiting
+var errQueueFull = serverutil.WithClass(serverutil.ErrThrottled, errors.New("task queue is full"))
+
+const (
+	// retry estimate until the first task finished
+	defaultRetryAfter = 30 * time.Second
+	maxRetryAfter     = 10 * time.Minute
+)
+
+// taskQueue limits the number of running tasks, waiting tasks are started by priority
+// and then in submission order. High priority tasks never wait, they preempt the limit.
+// The mirroring and pruning after an upload wait for a slot of their own behind all waiting tasks.
+type taskQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	seq     uint64
+	waiting []*queuedTask
+	// maintenance are the finished uploads waiting to mirror and prune, a slot is granted by closing
+	maintenance []chan struct{}
+	// avg is the moving average duration of finished tasks
+	avg time.Duration
+}
+
+type queuedTask struct {
+	id  uuid.UUID
+	t   *task
+	seq uint64
+}
+
+func rank(priority string) int {
+	switch priority {
+	case api.PriorityHigh:
+		return 0
+	case api.PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// submit starts the task or queues it if the limit of running tasks is reached, 0 means unlimited.
+// It returns the number of waiting tasks, 0 if the task was started. If maxWaiting tasks are already
+// waiting the task is rejected with errQueueFull, 0 means unlimited.
+func (q *taskQueue) submit(ID uuid.UUID, t *task, limit, maxWaiting int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limit = limit
+
+	if q.limit <= 0 || q.running < q.limit || t.req.Priority == api.PriorityHigh {
+		q.start(ID, t)
+		return 0, nil
+	}
+	if maxWaiting > 0 && len(q.waiting) >= maxWaiting {
+		return len(q.waiting), errQueueFull
+	}
+
+	q.seq++
+	q.waiting = append(q.waiting, &queuedTask{id: ID, t: t, seq: q.seq})
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		a, b := q.waiting[i], q.waiting[j]
+		if ra, rb := rank(a.t.req.Priority), rank(b.t.req.Priority); ra != rb {
+			return ra < rb
+		}
+		return a.seq < b.seq
+	})
+	routerLog.Info("task is queued", zap.Uint32("task id", ID.ID()), zap.Int("waiting", len(q.waiting)))
+	return len(q.waiting), nil
+}
+
+// retryAfter estimates when the waiting tasks are started, based on the duration of finished tasks
+func (q *taskQueue) retryAfter() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	avg := q.avg
+	if avg == 0 {
+		avg = defaultRetryAfter
+	}
+	slots := q.limit
+	if slots <= 0 {
+		slots = 1
+	}
+	d := avg * time.Duration(len(q.waiting)+1) / time.Duration(slots)
+	switch {
+	case d < time.Second:
+		return time.Second
+	case d > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return d
+}
+
+// remove drops a waiting task, it returns false if the task is not waiting
+func (q *taskQueue) remove(ID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, w := range q.waiting {
+		if w.id == ID {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// start must be called with the lock held
+func (q *taskQueue) start(ID uuid.UUID, t *task) {
+	q.running++
+	start := time.Now()
+	var once sync.Once
+	t.queue = q
+	t.release = func() {
+		once.Do(func() { q.done(time.Since(start)) })
+	}
+	go func() {
+		t.process(ID)
+		t.release()
+	}()
+}
+
+// done frees the slot of a task that ran for d, 0 for the maintenance of a task
+func (q *taskQueue) done(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	switch {
+	case d == 0:
+	case q.avg == 0:
+		q.avg = d
+	default:
+		q.avg = (3*q.avg + d) / 4
+	}
+	q.next()
+}
+
+// next starts the waiting tasks and then the maintenance while slots are free, it must be called
+// with the lock held
+func (q *taskQueue) next() {
+	for len(q.waiting) > 0 && q.free() {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.start(next.id, next.t)
+	}
+	for len(q.waiting) == 0 && len(q.maintenance) > 0 && q.free() {
+		q.running++
+		close(q.maintenance[0])
+		q.maintenance = q.maintenance[1:]
+	}
+}
+
+func (q *taskQueue) free() bool {
+	return q.limit <= 0 || q.running < q.limit
+}
+
+// acquire waits for a slot for the mirroring and pruning of a finished upload. It is granted after
+// all waiting tasks, so that maintenance never delays an upload, e.g. one a restore depends on.
+// The returned function frees the slot.
+func (q *taskQueue) acquire(ctx context.Context) (func(), error) {
+	release := func() { q.done(0) }
+
+	q.mu.Lock()
+	if len(q.waiting) == 0 && q.free() {
+		q.running++
+		q.mu.Unlock()
+		return release, nil
+	}
+	granted := make(chan struct{})
+	q.maintenance = append(q.maintenance, granted)
+	q.mu.Unlock()
+
+	select {
+	case <-granted:
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, m := range q.maintenance {
+		if m == granted {
+			q.maintenance = append(q.maintenance[:i], q.maintenance[i+1:]...)
+			return nil, ctx.Err()
+		}
+	}
+	// the slot was granted at the same time, it goes to the next one
+	q.running--
+	q.next()
+	return nil, ctx.Err()
+}
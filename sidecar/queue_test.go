@@ -0,0 +1,131 @@
+package sidecar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+)
+
+func newQueueTask(priority string) (uuid.UUID, *task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return uuid.New(), &task{req: UploadReq{Priority: priority}, ctx: ctx, cancel: cancel}
+}
+
+func TestTaskQueueOrder(t *testing.T) {
+	// a running task occupies the only slot
+	q := &taskQueue{running: 1}
+
+	var ids []uuid.UUID
+	for _, p := range []string{api.PriorityLow, "", api.PriorityLow, api.PriorityNormal} {
+		id, tsk := newQueueTask(p)
+		q.submit(id, tsk, 1, 0)
+		ids = append(ids, id)
+	}
+
+	var got []uuid.UUID
+	for _, w := range q.waiting {
+		got = append(got, w.id)
+	}
+	require.Equal(t, []uuid.UUID{ids[1], ids[3], ids[0], ids[2]}, got)
+
+	require.True(t, q.remove(ids[3]))
+	require.False(t, q.remove(ids[3]))
+	require.Len(t, q.waiting, 3)
+}
+
+func TestTaskQueueHighPriorityPreempts(t *testing.T) {
+	q := &taskQueue{running: 1}
+
+	lowID, low := newQueueTask(api.PriorityLow)
+	q.submit(lowID, low, 1, 0)
+	require.Len(t, q.waiting, 1)
+
+	highID, high := newQueueTask(api.PriorityHigh)
+	q.submit(highID, high, 1, 0)
+
+	// the high priority task starts despite the limit and fails without a bucket
+	require.Eventually(t, func() bool { return high.ctx.Err() != nil }, time.Second, 10*time.Millisecond)
+	require.NotNil(t, high.err)
+	require.Nil(t, low.ctx.Err())
+}
+
+func TestTaskQueueFull(t *testing.T) {
+	q := &taskQueue{running: 1}
+
+	for i := 1; i <= 2; i++ {
+		id, tsk := newQueueTask("")
+		waiting, err := q.submit(id, tsk, 1, 2)
+		require.Nil(t, err)
+		require.Equal(t, i, waiting)
+	}
+
+	id, tsk := newQueueTask(api.PriorityLow)
+	waiting, err := q.submit(id, tsk, 1, 2)
+	require.ErrorIs(t, err, errQueueFull)
+	require.Equal(t, 2, waiting)
+	require.False(t, q.remove(id))
+}
+
+func TestTaskQueueMaintenanceWaits(t *testing.T) {
+	q := &taskQueue{limit: 1, running: 1}
+	id, waiting := newQueueTask("")
+	q.submit(id, waiting, 1, 0)
+
+	// the finished upload frees its slot for the waiting task before it may prune
+	acquired := make(chan func())
+	go func() {
+		release, err := q.acquire(context.Background())
+		require.Nil(t, err)
+		acquired <- release
+	}()
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.maintenance) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	q.done(time.Second)
+	// the waiting task starts first and fails without a bucket, then the maintenance gets the slot
+	require.Eventually(t, func() bool { return waiting.ctx.Err() != nil }, time.Second, 10*time.Millisecond)
+	release := <-acquired
+	release()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	require.Zero(t, q.running)
+}
+
+func TestTaskQueueMaintenanceCanceled(t *testing.T) {
+	q := &taskQueue{limit: 1, running: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := q.acquire(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, q.maintenance)
+	require.Equal(t, 1, q.running)
+}
+
+func TestTaskQueueRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		q    *taskQueue
+		want time.Duration
+	}{
+		{"no finished tasks", &taskQueue{limit: 1}, defaultRetryAfter},
+		{"waiting tasks", &taskQueue{limit: 2, avg: time.Minute, waiting: make([]*queuedTask, 3)}, 2 * time.Minute},
+		{"unlimited", &taskQueue{avg: 10 * time.Second}, 10 * time.Second},
+		{"short tasks", &taskQueue{limit: 4, avg: time.Millisecond}, time.Second},
+		{"long tasks", &taskQueue{limit: 1, avg: time.Hour}, maxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.q.retryAfter())
+		})
+	}
+}
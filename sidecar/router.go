@@ -5,18 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
-	"net"
+	"math"
 	"net/http"
 	"path"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/netutil"
 	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+	"github.com/hazelcast/platform-operator-agent/internal/tty"
 )
 
 const (
@@ -27,103 +34,191 @@ var routerLog = logger.New().Named("router")
 
 // Service handles requests and keeps track of Tasks
 type Service struct {
-	Mu    sync.RWMutex
-	Tasks map[uuid.UUID]*task
+	Mu       sync.RWMutex
+	Tasks    map[uuid.UUID]*task
+	Events   *mancenter.Client
+	Location *time.Location
+	// MaxTasks limits the concurrently running tasks, 0 means unlimited
+	MaxTasks int
+	// MaxQueued limits the waiting tasks, further uploads are rejected, 0 means unlimited
+	MaxQueued int
+	// MetaFiles are included in every backup archive
+	MetaFiles []string
+	// BaseDir is the backup base dir shown on the status page
+	BaseDir string
+	// Stable is the quiescence check of the backup before it is archived
+	Stable stablePolicy
+	// Member is the check that the Hazelcast member is not busy with a backup
+	Member memberPolicy
+	// ACL is the canned ACL of uploaded objects if the request does not set one
+	ACL string
+	// Codec is the compression of the archives
+	Codec archive.Codec
+	// FileManifest stores the digests of the backup files in the archives, hashed by HashWorkers
+	FileManifest bool
+	HashWorkers  int
+	// Progress shows the uploads, nil shows nothing
+	Progress *tty.Progress
+	// MaxBytes is the maximum archive size of a backup, 0 means unlimited
+	MaxBytes int64
+	// Buckets shares the open bucket handles between the tasks, nil opens them per task
+	Buckets *bucket.Pool
+	// MissedRun decides whether scheduled backups that start late still run
+	MissedRun missedRunPolicy
+	// Retention prunes the old backups of the cluster after every successful upload
+	Retention retentionPolicy
+	// LocalCleanup deletes the local backups of the member after every verified upload
+	LocalCleanup bool
+	// Incremental uploads only the chunk files of the backups that changed since the last upload
+	Incremental bool
+	// Schedule triggers the backups of the sidecar's own cron schedule, nil if there is none
+	Schedule *scheduler
+
+	queue taskQueue
 }
 
-// Req is a backup Service backup method request
-type Req struct {
-	BackupBaseDir string `json:"backup_base_dir"`
-	MemberID      int    `json:"member_id"`
-}
-
-// Resp is a backup Service backup method response
-type Resp struct {
-	Backups []string `json:"backups"`
-}
+// Request and response types are defined in the api package shared with the operator
+type (
+	Req          = api.Req
+	Resp         = api.Resp
+	UploadReq    = api.UploadReq
+	UploadResp   = api.UploadResp
+	StatusResp   = api.StatusResp
+	DialRequest  = api.DialRequest
+	DialResponse = api.DialResponse
+)
 
 func (s *Service) listBackupsHandler(w http.ResponseWriter, r *http.Request) {
 	var req Req
 	if err := serverutil.DecodeBody(r, &req); err != nil {
 		routerLog.Error("error occurred while parsing body: " + err.Error())
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
-	backupsDir := path.Join(req.BackupBaseDir, DirName)
-	backupSeqs, err := fileutil.FolderSequence(backupsDir)
+	q, err := parseListQuery(r)
+	if err != nil {
+		routerLog.Error("error occurred while parsing query: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+
+	backups, err := listBackups(req.BackupBaseDir, req.MemberID)
+	if err != nil {
+		routerLog.Error("error listing backups: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
+		return
+	}
+
+	resp, err := pageBackups(backups, q)
 	if err != nil {
-		routerLog.Error("error reading backup sequence directory: " + err.Error())
-		serverutil.HttpError(w, http.StatusBadRequest)
+		routerLog.Error("error listing backups: " + err.Error())
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
+	serverutil.HttpJSON(w, resp)
+}
+
+// listBackups returns the <sequence>/<uuid> paths of the member's local backups
+func listBackups(baseDir string, memberID int) ([]string, error) {
+	backupsDir := path.Join(baseDir, DirName)
+	backupSeqs, err := fileutil.FolderSequence(backupsDir)
+	if err != nil {
+		return nil, err
+	}
+
 	var backups []string
 	for _, backupSeq := range backupSeqs {
 		backupDir := path.Join(backupsDir, backupSeq.Name())
 		backupUUIDs, err := fileutil.FolderUUIDs(backupDir)
 		if err != nil {
-			routerLog.Error("error reading backup directory: " + err.Error())
-			serverutil.HttpError(w, http.StatusBadRequest)
-			return
+			return nil, err
 		}
 
-		if len(backupUUIDs) != 1 && len(backupUUIDs) <= req.MemberID {
-			err = fmt.Errorf("invalid UUID")
-			routerLog.Error(err.Error())
-			serverutil.HttpError(w, http.StatusBadRequest)
-			return
+		if len(backupUUIDs) != 1 && len(backupUUIDs) <= memberID {
+			return nil, serverutil.WithClass(serverutil.ErrInvalid, fmt.Errorf("invalid UUID"))
 		}
 
 		// If there is only one backup, members are isolated. No need for memberID
 		if len(backupUUIDs) == 1 {
 			routerLog.Info("skip member ID")
-			req.MemberID = 0
+			memberID = 0
 		}
 
-		backupPath := path.Join(backupSeq.Name(), backupUUIDs[req.MemberID].Name())
+		backupPath := path.Join(backupSeq.Name(), backupUUIDs[memberID].Name())
 		backups = append(backups, backupPath)
 
 		routerLog.Info("found backup", zap.String("backup path", backupPath))
 	}
-
-	serverutil.HttpJSON(w, Resp{Backups: backups})
-}
-
-// UploadReq is a backup Service upload method request
-type UploadReq struct {
-	BucketURL       string `json:"bucket_url"`
-	BackupBaseDir   string `json:"backup_base_dir"`
-	HazelcastCRName string `json:"hz_cr_name"`
-	SecretName      string `json:"secret_name"`
-	MemberID        int    `json:"member_id"`
-}
-
-// UploadResp ia a backup Service upload method response
-type UploadResp struct {
-	ID uuid.UUID `json:"id"`
+	return backups, nil
 }
 
 func (s *Service) uploadHandler(w http.ResponseWriter, r *http.Request) {
 	var req UploadReq
 	if err := serverutil.DecodeBody(r, &req); err != nil {
 		routerLog.Error("error occurred while parsing body: " + err.Error())
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
-	ID, err := uuid.NewRandom()
+	ID, waiting, err := s.startTask(req, serverutil.Caller(r))
 	if err != nil {
-		routerLog.Error("error occurred while generating new UUID: " + err.Error())
-		serverutil.HttpError(w, http.StatusBadRequest)
+		if errors.Is(err, errQueueFull) {
+			s.backpressure(w, waiting)
+		}
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
+	if waiting > 0 {
+		s.backpressure(w, waiting)
+		serverutil.HttpJSONStatus(w, http.StatusAccepted, UploadResp{ID: ID})
+		return
+	}
+
+	serverutil.HttpJSON(w, UploadResp{ID: ID})
+}
 
+// startTask submits the backup task of the request to the queue. It returns the number of waiting
+// tasks, 0 if the task was started.
+func (s *Service) startTask(req UploadReq, caller api.Caller) (uuid.UUID, int, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	t := &task{
-		req:    req,
-		ctx:    ctx,
-		cancel: cancel,
+	return s.submit(s.newTask(ctx, cancel, req, caller))
+}
+
+func (s *Service) newTask(ctx context.Context, cancel context.CancelFunc, req UploadReq, caller api.Caller) *task {
+	return &task{
+		req:       req,
+		ctx:       ctx,
+		cancel:    cancel,
+		events:    s.Events,
+		location:  s.Location,
+		metaFiles: s.MetaFiles,
+		stable:    s.Stable,
+		member:    s.Member,
+		acl:       s.ACL,
+		codec:     s.Codec,
+		caller:    caller,
+
+		fileManifest: s.FileManifest,
+		hashWorkers:  s.HashWorkers,
+		progress:     s.Progress,
+		maxBytes:     s.MaxBytes,
+		buckets:      s.Buckets,
+		missedRun:    s.MissedRun,
+		retention:    s.Retention,
+		localCleanup: s.LocalCleanup,
+		incremental:  s.Incremental,
+	}
+}
+
+// submit registers the task and submits it to the queue
+func (s *Service) submit(t *task) (uuid.UUID, int, error) {
+	ID, err := uuid.NewRandom()
+	if err != nil {
+		routerLog.Error("error occurred while generating new UUID: " + err.Error())
+		t.cancel()
+		return uuid.UUID{}, 0, err
 	}
 
 	s.Mu.Lock()
@@ -131,25 +226,45 @@ func (s *Service) uploadHandler(w http.ResponseWriter, r *http.Request) {
 	s.Mu.Unlock()
 
 	// run upload in background
-	routerLog.Info("Starting new task", zap.Uint32("task id", ID.ID()))
-	go t.process(ID)
+	routerLog.Info("Starting new task", zap.Uint32("task id", ID.ID()), zap.String("priority", t.req.Priority),
+		zap.String("caller", t.caller.Identity), zap.String("request id", t.caller.RequestID))
+	waiting, err := s.queue.submit(ID, t, s.MaxTasks, s.MaxQueued)
+	if err != nil {
+		routerLog.Warn("rejecting task: "+err.Error(), zap.Uint32("task id", ID.ID()), zap.Int("waiting", waiting))
+		t.cancel()
+		s.Mu.Lock()
+		delete(s.Tasks, ID)
+		s.Mu.Unlock()
+		return uuid.UUID{}, waiting, err
+	}
+	return ID, waiting, nil
+}
 
-	serverutil.HttpJSON(w, UploadResp{ID: ID})
+// backpressure tells a client of a saturated agent how many tasks are waiting and when to retry
+func (s *Service) backpressure(w http.ResponseWriter, waiting int) {
+	w.Header().Set(api.QueueLengthHeader, strconv.Itoa(waiting))
+	retry := s.queue.retryAfter()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
 }
 
-// StatusResp is a backup Service task status response
-type StatusResp struct {
-	Status    string `json:"status"`
-	Message   string `json:"message,omitempty"`
-	BackupKey string `json:"backup_key,omitempty"`
+// errTaskNotFound is returned for task IDs the agent does not know, e.g. deleted tasks
+var errTaskNotFound = serverutil.WithClass(serverutil.ErrNotFound, errors.New("task not found"))
+
+// parseTaskID parses the task ID of the request path
+func parseTaskID(id string) (uuid.UUID, error) {
+	ID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, serverutil.WithClass(serverutil.ErrInvalid, err)
+	}
+	return ID, nil
 }
 
 func (s *Service) statusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	ID, err := uuid.Parse(vars["id"])
+	ID, err := parseTaskID(vars["id"])
 	if err != nil {
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
@@ -160,41 +275,71 @@ func (s *Service) statusHandler(w http.ResponseWriter, r *http.Request) {
 	// unknown task
 	if !ok {
 		routerLog.Error("task not found", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpError(w, http.StatusNotFound)
+		serverutil.HttpErrorFor(w, errTaskNotFound)
 		return
 	}
 
+	resp := t.status()
+	routerLog.Info("task status", zap.Uint32("task id", ID.ID()), zap.String("status", resp.Status))
+	serverutil.HttpJSON(w, resp)
+}
+
+// status returns the current status of the task
+func (t *task) status() StatusResp {
+	resp := t.taskStatus()
+	if t.batch != nil {
+		resp.Batch = t.batchStatus()
+	}
+	return resp
+}
+
+func (t *task) taskStatus() StatusResp {
 	// context error is set to non-nil by the first cancel call
 	if t.ctx.Err() == nil {
-		routerLog.Info("task is in progress: ", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpJSON(w, StatusResp{Status: "IN_PROGRESS"})
-		return
+		return StatusResp{Status: api.StatusInProgress, Caller: &t.caller}
+	}
+
+	// a task removed from the queue never ran
+	if t.dropped.Load() {
+		return StatusResp{Status: api.StatusCanceled, Message: context.Canceled.Error(), Caller: &t.caller}
 	}
 
 	// error from the task could be just info that it was canceled
 	if errors.Is(t.err, context.Canceled) {
-		routerLog.Info("task is canceled: ", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpJSON(w, StatusResp{Status: "CANCELED", Message: t.err.Error()})
-		return
+		return StatusResp{Status: api.StatusCanceled, Message: logger.Redact(t.err.Error()), Caller: &t.caller}
+	}
+
+	// the scheduled backup started too late and was not run
+	var missedErr *missedRunError
+	if errors.As(t.err, &missedErr) {
+		return StatusResp{Status: api.StatusSkipped, Message: t.err.Error(), Caller: &t.caller}
+	}
+
+	// the backup is larger than the policy allows, retrying does not help
+	var sizeErr *sizeExceededError
+	if errors.As(t.err, &sizeErr) {
+		return StatusResp{Status: api.StatusSizeExceeded, Message: logger.Redact(t.err.Error()), Caller: &t.caller, LargestContributors: sizeErr.Contributors}
 	}
 
 	// there was some actual error
 	if t.err != nil {
-		routerLog.Info("task is failed", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpJSON(w, StatusResp{Status: "FAILURE", Message: t.err.Error()})
-		return
+		return StatusResp{Status: api.StatusFailure, Message: logger.Redact(t.err.Error()), Caller: &t.caller}
+	}
+
+	// time box was exceeded, the upload continues with the next request
+	if t.partial {
+		return StatusResp{Status: api.StatusPartial, BucketURL: t.bucketURL, Caller: &t.caller}
 	}
 
-	routerLog.Info("task is successful", zap.Uint32("task id", ID.ID()))
-	serverutil.HttpJSON(w, StatusResp{Status: "SUCCESS", BackupKey: t.backupKey})
+	return StatusResp{Status: api.StatusSuccess, BackupKey: t.backupKey, BucketURL: t.bucketURL, Caller: &t.caller, Mirrors: t.mirrors, Pruned: t.pruned, LocalCleanup: t.cleaned, ReusedBytes: t.reused.Load()}
 }
 
 func (s *Service) cancelHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	ID, err := uuid.Parse(vars["id"])
+	ID, err := parseTaskID(vars["id"])
 	if err != nil {
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
@@ -203,10 +348,15 @@ func (s *Service) cancelHandler(w http.ResponseWriter, r *http.Request) {
 	s.Mu.RUnlock()
 	if !ok {
 		routerLog.Error("task not found", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpError(w, http.StatusNotFound)
+		serverutil.HttpErrorFor(w, errTaskNotFound)
 		return
 	}
 
+	// a waiting task never starts, mark it canceled right away
+	if s.queue.remove(ID) {
+		t.dropped.Store(true)
+	}
+
 	// send signal to stop task
 	routerLog.Info("canceling task", zap.Uint32("task id", ID.ID()))
 	t.cancel()
@@ -215,32 +365,29 @@ func (s *Service) cancelHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Service) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	ID, err := uuid.Parse(vars["id"])
+	ID, err := parseTaskID(vars["id"])
 	if err != nil {
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
-	s.Mu.RLock()
-	if _, ok := s.Tasks[ID]; !ok {
-		s.Mu.RUnlock()
+	s.Mu.Lock()
+	t, ok := s.Tasks[ID]
+	delete(s.Tasks, ID)
+	s.Mu.Unlock()
+	if !ok {
 		routerLog.Error("task not found", zap.Uint32("task id", ID.ID()))
-		serverutil.HttpError(w, http.StatusNotFound)
+		serverutil.HttpErrorFor(w, errTaskNotFound)
 		return
 	}
-	delete(s.Tasks, ID)
-	s.Mu.RUnlock()
 
-	routerLog.Info("task deleted successfully", zap.Uint32("task id", ID.ID()))
-}
-
-type DialRequest struct {
-	Endpoints []string `json:"endpoints"`
-}
+	// a deleted task must not start later
+	if s.queue.remove(ID) {
+		t.dropped.Store(true)
+		t.cancel()
+	}
 
-type DialResponse struct {
-	Success       bool     `json:"success"`
-	ErrorMessages []string `json:"error_messages"`
+	routerLog.Info("task deleted successfully", zap.Uint32("task id", ID.ID()))
 }
 
 type DialService struct{}
@@ -249,7 +396,7 @@ func (d *DialService) dialHandler(w http.ResponseWriter, r *http.Request) {
 	var req DialRequest
 	if err := serverutil.DecodeBody(r, &req); err != nil {
 		routerLog.Error("error occurred while parsing body: " + err.Error())
-		serverutil.HttpError(w, http.StatusBadRequest)
+		serverutil.HttpErrorFor(w, err)
 		return
 	}
 
@@ -278,7 +425,7 @@ func (d *DialService) dialHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func tryDial(endpoint string) error {
-	_, err := net.DialTimeout("tcp", endpoint, 3*time.Second)
+	_, err := netutil.DialTimeout("tcp", endpoint, 3*time.Second)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,240 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
+	"github.com/hazelcast/platform-operator-agent/internal/cron"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+var schedulerLog = logger.New().Named("scheduler")
+
+// errNoSchedule is returned for the schedule status of a sidecar without a schedule
+var errNoSchedule = serverutil.WithClass(serverutil.ErrNotFound, errors.New("no backup schedule configured"))
+
+// scheduler triggers the backups of the member on a cron schedule, without requests of the
+// operator. Every run asks the member for a new hot backup and uploads it. A run is skipped while
+// the backup of the previous run is still running or queued.
+type scheduler struct {
+	spec     string
+	schedule *cron.Schedule
+	location *time.Location
+	// req is the upload request of every run, ScheduledAt is set to the time the run was due
+	req     UploadReq
+	service *Service
+
+	mu       sync.Mutex
+	next     time.Time
+	last     time.Time
+	lastID   uuid.UUID
+	skipped  int
+	lastSkip string
+}
+
+func newScheduler(spec string, loc *time.Location, req UploadReq, service *Service) (*scheduler, error) {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduler{spec: spec, schedule: schedule, location: loc, req: req, service: service}, nil
+}
+
+// run triggers the backups until the context is done. The wall clock is checked again after every
+// wake-up, a run due while the sidecar was suspended is triggered late and handled by the
+// missed-run policy. A run missed while the sidecar was down is triggered on start.
+func (s *scheduler) run(ctx context.Context) {
+	schedulerLog.Info("scheduling backups", zap.String("schedule", s.spec), zap.String("timezone", s.location.String()))
+	if missed, ok := s.missedRun(clock.Now().In(s.location)); ok {
+		schedulerLog.Warn("the last run was missed", zap.Time("scheduled at", missed))
+		s.trigger(ctx, missed)
+	}
+	for {
+		now := clock.Now().In(s.location)
+		next := s.schedule.Next(now)
+		s.mu.Lock()
+		s.next = next
+		s.mu.Unlock()
+		if next.IsZero() {
+			schedulerLog.Warn("the schedule never runs again", zap.String("schedule", s.spec))
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.trigger(ctx, next)
+	}
+}
+
+// missedRun returns the last run due before now if the member has no backup created since. Without
+// any local backup nothing was missed, the sidecar is started for the first time.
+func (s *scheduler) missedRun(now time.Time) (time.Time, bool) {
+	prev := s.schedule.Prev(now)
+	if prev.IsZero() {
+		return time.Time{}, false
+	}
+	latest, err := latestSequence(path.Join(s.req.BackupBaseDir, DirName))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return prev, latest.Before(prev)
+}
+
+// trigger creates and uploads the backup of the run due at, unless the backup of the previous run
+// is not done or the run is too late for the missed-run policy
+func (s *scheduler) trigger(ctx context.Context, at time.Time) {
+	s.mu.Lock()
+	if s.lastID != uuid.Nil && s.service.pending(s.lastID) {
+		s.skip(zap.WarnLevel, fmt.Sprintf("backup due at %s skipped, task %s of the run at %s is still in progress",
+			at.Format(time.RFC3339), s.lastID, s.last.Format(time.RFC3339)))
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	req := s.req
+	req.ScheduledAt = &at
+	if err := s.service.MissedRun.check(req, clock.Now()); err != nil {
+		s.mu.Lock()
+		s.skip(zap.WarnLevel, err.Error())
+		s.mu.Unlock()
+		return
+	}
+	// the member is not locked while it creates the backup, the status stays readable
+	err := s.createBackup(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.skip(zap.ErrorLevel, fmt.Sprintf("backup due at %s could not be created: %s", at.Format(time.RFC3339), err.Error()))
+		return
+	}
+	ID, waiting, err := s.service.startTask(req, api.Caller{Identity: api.SchedulerIdentity, ReceivedAt: clock.Now().UTC()})
+	if err != nil {
+		s.skip(zap.ErrorLevel, fmt.Sprintf("backup due at %s could not be started: %s", at.Format(time.RFC3339), err.Error()))
+		return
+	}
+	s.last, s.lastID = at, ID
+	schedulerLog.Info("triggered scheduled backup", zap.Uint32("task id", ID.ID()), zap.Time("scheduled at", at), zap.Int("waiting", waiting))
+}
+
+// skip records a run that was skipped, s.mu must be held
+func (s *scheduler) skip(level zapcore.Level, reason string) {
+	s.skipped++
+	s.lastSkip = reason
+	if level == zap.ErrorLevel {
+		schedulerLog.Error(reason)
+	} else {
+		schedulerLog.Warn(reason)
+	}
+}
+
+// createBackup asks the member for a hot backup and waits until its sequence folder appears
+func (s *scheduler) createBackup(ctx context.Context) error {
+	member := s.service.Member
+	if member.URL == "" {
+		return nil
+	}
+	backupsDir := path.Join(s.req.BackupBaseDir, DirName)
+	before, _ := latestSequence(backupsDir)
+	if err := member.hotBackup(ctx); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(member.Timeout)
+	for {
+		if latest, err := latestSequence(backupsDir); err == nil && latest.After(before) {
+			return nil
+		}
+		if time.Now().Add(member.Interval).After(deadline) {
+			return fmt.Errorf("the member created no backup in %s within %s", backupsDir, member.Timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(member.Interval):
+		}
+	}
+}
+
+// latestSequence returns the creation time of the newest backup-<epoch millis> folder
+func latestSequence(backupsDir string) (time.Time, error) {
+	seqs, err := fileutil.FolderSequence(backupsDir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, seq := range seqs {
+		t, err := sequenceTime(seq.Name())
+		if err != nil {
+			continue
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, os.ErrNotExist
+	}
+	return latest, nil
+}
+
+// status returns the state of the schedule
+func (s *scheduler) status() api.ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := api.ScheduleStatus{Schedule: s.spec, Timezone: s.location.String(), Skipped: s.skipped, LastSkip: s.lastSkip}
+	if !s.next.IsZero() {
+		next := s.next
+		st.NextRun = &next
+	}
+	if s.lastID != uuid.Nil {
+		last, ID := s.last, s.lastID
+		st.LastRun, st.LastTaskID = &last, &ID
+		if t, ok := s.service.task(ID); ok {
+			st.LastStatus = t.status().Status
+		}
+	}
+	return st
+}
+
+// pending reports whether the task is running or waiting in the queue
+func (s *Service) pending(ID uuid.UUID) bool {
+	t, ok := s.task(ID)
+	return ok && t.ctx.Err() == nil
+}
+
+func (s *Service) task(ID uuid.UUID) (*task, bool) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	t, ok := s.Tasks[ID]
+	return t, ok
+}
+
+func (s *Service) scheduleHandler(w http.ResponseWriter, _ *http.Request) {
+	if s.Schedule == nil {
+		serverutil.HttpErrorFor(w, errNoSchedule)
+		return
+	}
+	serverutil.HttpJSON(w, s.Schedule.status())
+}
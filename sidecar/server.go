@@ -4,19 +4,35 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/metrics"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+	"github.com/hazelcast/platform-operator-agent/internal/tty"
 )
 
 var serverLog = logger.New().Named("server")
 
+// shutdownTimeout bounds the time the servers wait for open requests on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func startServer(ctx context.Context, s *Cmd) error {
 	ca, err := os.ReadFile(s.CA)
 	if err != nil {
@@ -31,37 +47,154 @@ func startServer(ctx context.Context, s *Cmd) error {
 		return err
 	}
 
+	allowList, err := s.allowList()
+	if err != nil {
+		serverLog.Error("error while parsing allowed CIDRs: " + err.Error())
+		return err
+	}
+	if serverutil.AllowsAll(allowList) {
+		serverLog.Warn("allowed CIDRs include every address, every client with a valid certificate may call the mutating endpoints")
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		serverLog.Error("error while loading time zone: " + err.Error())
+		return err
+	}
+
+	if err = bucket.ValidateACL(s.ObjectACL); err != nil {
+		serverLog.Error("error while parsing object ACL: " + err.Error())
+		return err
+	}
+
+	switch s.MemberPolicy {
+	case MemberPolicyWait, MemberPolicyReject:
+	default:
+		err = fmt.Errorf("unknown member policy %q", s.MemberPolicy)
+		serverLog.Error("error while parsing member policy: " + err.Error())
+		return err
+	}
+
+	switch s.MissedRun {
+	case api.MissedRunSkip, api.MissedRunRun:
+	default:
+		err = fmt.Errorf("unknown missed-run policy %q, expected %s or %s", s.MissedRun, api.MissedRunSkip, api.MissedRunRun)
+		serverLog.Error("error while parsing missed-run policy: " + err.Error())
+		return err
+	}
+
+	if s.KeepLast < 0 || s.KeepDays < 0 || s.UploadWindow < 0 || s.PruneRate < 0 {
+		err = fmt.Errorf("invalid retention policy, keep-last %d, keep-days %d, upload-window %s and prune-rate %g must not be negative", s.KeepLast, s.KeepDays, s.UploadWindow, s.PruneRate)
+		serverLog.Error("error while parsing retention policy: " + err.Error())
+		return err
+	}
+
+	codec := archive.Codec{Compression: archive.Compression(s.Compression), Level: s.Level}
+	if err = codec.Validate(); err != nil {
+		serverLog.Error("error while parsing compression: " + err.Error())
+		return err
+	}
+
+	maxBytes, err := bucket.ParseSize(s.MaxBytes)
+	if err != nil {
+		serverLog.Error("error while parsing maximum backup size: " + err.Error())
+		return err
+	}
+
+	hostname, _ := os.Hostname()
 	backupService := Service{
-		Tasks: make(map[uuid.UUID]*task),
+		Tasks:     make(map[uuid.UUID]*task),
+		Events:    mancenter.New(s.MCURL, s.MCToken),
+		Location:  loc,
+		MaxTasks:  s.MaxTasks,
+		MaxQueued: s.MaxQueued,
+		BaseDir:   s.BaseDir,
+		Stable:    stablePolicy{Window: s.StableWindow, Timeout: s.StableTimeout},
+		ACL:       s.ObjectACL,
+		Codec:     codec,
+		Member:    memberPolicy{URL: s.MemberURL, Policy: s.MemberPolicy, Timeout: s.MemberTimeout, Interval: 5 * time.Second, ClusterName: s.MemberCluster, Password: s.MemberPass},
+
+		FileManifest: s.FileManifest,
+		HashWorkers:  s.HashWorkers,
+		Progress:     tty.New(os.Stdout, backupLog, s.ProgressLog),
+		MaxBytes:     maxBytes,
+		Buckets:      bucket.NewPool(s.BucketIdle),
+		MissedRun:    missedRunPolicy{Policy: s.MissedRun, Grace: s.MissedGrace},
+		LocalCleanup: s.LocalCleanup,
+		Incremental:  s.Incremental,
+		Retention:    retentionPolicy{KeepLast: s.KeepLast, KeepDays: s.KeepDays, UploadWindow: s.UploadWindow, DryRun: s.PruneDryRun, Rate: s.PruneRate, Metrics: metrics.NewPusher(s.Pushgateway, "hazelcast_backup"), Instance: hostname},
 	}
+	if s.ConfigFiles != "" {
+		backupService.MetaFiles = strings.Split(s.ConfigFiles, ",")
+	}
+	if s.Schedule != "" {
+		if backupService.Schedule, err = s.scheduler(loc, &backupService); err != nil {
+			serverLog.Error("error while parsing backup schedule: " + err.Error())
+			return err
+		}
+	}
+
+	// the open bucket handles are closed once the servers stopped, handles of running tasks when they are released
+	defer backupService.Buckets.Close()
 
 	dialService := DialService{}
 
-	g, _ := errgroup.WithContext(ctx)
-	g.Go(func() error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	g, gctx := errgroup.WithContext(ctx)
+	if backupService.Schedule != nil {
+		go backupService.Schedule.run(gctx)
+	}
+	tlsServer := func() *http.Server {
 		router := mux.NewRouter().StrictSlash(true)
 		router.HandleFunc("/backup", backupService.listBackupsHandler).Methods("GET")
+		router.HandleFunc("/backup/estimate", backupService.estimateHandler).Methods("GET")
+		router.HandleFunc("/backups/local", backupService.cleanLocalHandler).Methods("DELETE")
 		router.HandleFunc("/upload", backupService.uploadHandler).Methods("POST")
+		router.HandleFunc("/upload/batch", backupService.batchUploadHandler).Methods("POST")
 		router.HandleFunc("/upload/{id}", backupService.statusHandler).Methods("GET")
+		router.HandleFunc("/tasks", backupService.listTasksHandler).Methods("GET")
+		router.HandleFunc("/schedule", backupService.scheduleHandler).Methods("GET")
 		router.HandleFunc("/upload/{id}/cancel", backupService.cancelHandler).Methods("POST")
 		router.HandleFunc("/upload/{id}", backupService.deleteHandler).Methods("DELETE")
 		router.HandleFunc("/dial", dialService.dialHandler).Methods("POST")
 		router.HandleFunc("/health", healthcheckHandler)
-		server := &http.Server{
+		if s.Debug {
+			router.PathPrefix("/debug/").Handler(debugHandler(s.debugIdentities()))
+		}
+		return &http.Server{
 			Addr:    s.HTTPSAddress,
-			Handler: router,
+			Handler: serverutil.AllowList(allowList, router),
 			TLSConfig: &tls.Config{
 				ClientAuth: tls.RequireAndVerifyClientCert,
 				ClientCAs:  pool,
 			},
 		}
-		return server.ListenAndServeTLS(s.Cert, s.Key)
+	}()
+	g.Go(func() error {
+		return ignoreClosed(tlsServer.ListenAndServeTLS(s.Cert, s.Key))
 	})
 
+	router := http.NewServeMux()
+	router.HandleFunc("/health", healthcheckHandler)
+	if s.UI {
+		router.HandleFunc("/", uiHandler)
+		router.HandleFunc("/ui/state", backupService.uiStateHandler)
+	}
+	httpServer := &http.Server{Addr: s.HTTPAddress, Handler: router}
 	g.Go(func() error {
-		router := http.NewServeMux()
-		router.HandleFunc("/health", healthcheckHandler)
-		return http.ListenAndServe(s.HTTPAddress, router)
+		return ignoreClosed(httpServer.ListenAndServe())
+	})
+
+	// both servers stop on a termination signal or once one of them failed
+	g.Go(func() error {
+		<-gctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		serverLog.Info("shutting down the servers")
+		tlsServer.Shutdown(sctx)
+		httpServer.Shutdown(sctx)
+		return nil
 	})
 
 	if err = g.Wait(); err != nil {
@@ -71,3 +204,52 @@ func startServer(ctx context.Context, s *Cmd) error {
 
 	return nil
 }
+
+// ignoreClosed returns nil for the error of a server that was shut down
+func ignoreClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// scheduler returns the scheduler of the backups triggered by the sidecar itself
+func (s *Cmd) scheduler(loc *time.Location, service *Service) (*scheduler, error) {
+	if s.ScheduleURL == "" || s.BaseDir == "" || s.MemberURL == "" {
+		return nil, fmt.Errorf("a schedule requires the bucket URL, the backup base dir and the member URL")
+	}
+	req := UploadReq{
+		BucketURL:       s.ScheduleURL,
+		BackupBaseDir:   s.BaseDir,
+		HazelcastCRName: s.SchedulePath,
+		SecretName:      s.ScheduleCreds,
+		MemberID:        s.ScheduleID,
+	}
+	return newScheduler(s.Schedule, loc, req, service)
+}
+
+// debugIdentities returns the client certificate identities allowed to call the debug endpoints
+func (s *Cmd) debugIdentities() []string {
+	var identities []string
+	for _, id := range strings.Split(s.DebugCallers, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			identities = append(identities, id)
+		}
+	}
+	return identities
+}
+
+// allowList returns the networks allowed to call mutating endpoints, the loopback and pod addresses
+// are always allowed
+func (s *Cmd) allowList() ([]*net.IPNet, error) {
+	cidrs := strings.Join(serverutil.LocalCIDRs, ",")
+	nets, err := serverutil.ParseCIDRs(cidrs + "," + s.OperatorCIDR + "," + s.AllowedCIDRs)
+	if err != nil || s.PodIP == "" {
+		return nets, err
+	}
+	pod, err := serverutil.HostNet(s.PodIP)
+	if err != nil {
+		return nil, err
+	}
+	return append(nets, pod), nil
+}
@@ -1,24 +1,44 @@
 package sidecar
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/clock"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
 )
 
 var exampleTarGzFiles = []fileutil.File{
@@ -77,7 +97,7 @@ func TestBackupHandler(t *testing.T) {
 				BackupBaseDir: "does-not-exist",
 			},
 			nil,
-			http.StatusBadRequest,
+			http.StatusNotFound,
 			nil,
 		},
 	}
@@ -119,15 +139,18 @@ func TestBackupHandler(t *testing.T) {
 
 func TestUploadHandler(t *testing.T) {
 	uq := &UploadReq{
-		BucketURL:       "",
-		BackupBaseDir:   "",
-		HazelcastCRName: "",
+		BucketURL:       "s3://bucket",
+		BackupBaseDir:   "/data/persistence/backup",
+		HazelcastCRName: "hazelcast",
 		SecretName:      "",
 	}
 	uqb, err := json.Marshal(uq)
 	uqStr := string(uqb)
 	require.Nil(t, err)
 
+	invalid, err := json.Marshal(&UploadReq{BackupBaseDir: "/data/persistence/backup", HazelcastCRName: "hazelcast"})
+	require.Nil(t, err)
+
 	tests := []struct {
 		name           string
 		body           string
@@ -139,6 +162,12 @@ func TestUploadHandler(t *testing.T) {
 		{
 			"incorrect body", "false-body", http.StatusBadRequest,
 		},
+		{
+			"missing bucket url", string(invalid), http.StatusBadRequest,
+		},
+		{
+			"unknown field is ignored", strings.Replace(uqStr, "{", `{"added_by_newer_operator": true,`, 1), http.StatusOK,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -146,6 +175,8 @@ func TestUploadHandler(t *testing.T) {
 			require.Nil(t, err)
 			us := &Service{Tasks: map[uuid.UUID]*task{}}
 			req := httptest.NewRequest(http.MethodPost, "http://request/upload", strings.NewReader(tt.body))
+			req.Header.Set("X-Request-ID", "req-1")
+			req.Header.Set("User-Agent", "operator/5.5")
 			w := httptest.NewRecorder()
 
 			// Test
@@ -164,6 +195,8 @@ func TestUploadHandler(t *testing.T) {
 			err = d.Decode(resBody)
 			require.Nil(t, err)
 			require.NotEmpty(t, resBody.ID)
+			require.Equal(t, "req-1", us.Tasks[resBody.ID].caller.RequestID)
+			require.Equal(t, "operator/5.5", us.Tasks[resBody.ID].caller.UserAgent)
 
 			//clean up
 			us.Tasks[resBody.ID].cancel()
@@ -171,6 +204,36 @@ func TestUploadHandler(t *testing.T) {
 	}
 }
 
+func TestUploadHandlerBackpressure(t *testing.T) {
+	body, err := json.Marshal(&UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data/persistence/backup", HazelcastCRName: "hazelcast"})
+	require.Nil(t, err)
+
+	// a running task occupies the only slot
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1, MaxQueued: 1}
+	us.queue.running = 1
+	us.queue.avg = 90 * time.Second
+
+	upload := func() *http.Response {
+		w := httptest.NewRecorder()
+		us.uploadHandler(w, httptest.NewRequest(http.MethodPost, "http://request/upload", strings.NewReader(string(body))))
+		return w.Result()
+	}
+
+	res := upload()
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	require.Equal(t, "1", res.Header.Get(api.QueueLengthHeader))
+	require.Equal(t, "180", res.Header.Get("Retry-After"))
+	var resp UploadResp
+	require.Nil(t, json.NewDecoder(res.Body).Decode(&resp))
+	require.Contains(t, us.Tasks, resp.ID)
+
+	res = upload()
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	require.Equal(t, "1", res.Header.Get(api.QueueLengthHeader))
+	require.Equal(t, "180", res.Header.Get("Retry-After"))
+	require.Len(t, us.Tasks, 1)
+}
+
 func TestStatusHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -221,6 +284,20 @@ func TestStatusHandler(t *testing.T) {
 			http.StatusOK,
 			"FAILURE",
 		},
+		{
+			"task exceeded maximum size",
+			map[uuid.UUID]*task{stringToUUID(""): sizeExceededTask(UploadReq{})},
+			stringToUUID("").String(),
+			http.StatusOK,
+			"SIZE_EXCEEDED",
+		},
+		{
+			"task missed its scheduled run",
+			map[uuid.UUID]*task{stringToUUID(""): missedRunTask(UploadReq{})},
+			stringToUUID("").String(),
+			http.StatusOK,
+			"SKIPPED",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -249,11 +326,172 @@ func TestStatusHandler(t *testing.T) {
 			err := d.Decode(status)
 			require.Nil(t, err)
 			require.Equal(t, tt.wantStatus, status.Status)
+			require.NotNil(t, status.Caller)
 
 		})
 	}
 }
 
+func TestUIStateHandler(t *testing.T) {
+	baseDir, err := os.MkdirTemp("", "ui_state")
+	require.Nil(t, err)
+	defer os.RemoveAll(baseDir)
+
+	err = fileutil.CreateFiles(path.Join(baseDir, DirName), []fileutil.File{
+		{Name: "backup-0000000000001/00000000-0000-0000-0000-000000000001/cluster/members.bin"},
+		{Name: "backup-0000000000002/00000000-0000-0000-0000-000000000001/cluster/members.bin"},
+	}, false)
+	require.Nil(t, err)
+
+	older := successfulTask(UploadReq{BackupBaseDir: baseDir})
+	older.caller.ReceivedAt = time.Now().Add(-time.Minute)
+	newer := inProgressTask(UploadReq{BackupBaseDir: baseDir, Priority: "HIGH"})
+	newer.caller.ReceivedAt = time.Now()
+	defer newer.cancel()
+
+	us := &Service{Tasks: map[uuid.UUID]*task{
+		stringToUUID("older"): older,
+		stringToUUID("newer"): newer,
+	}}
+	w := httptest.NewRecorder()
+	us.uiStateHandler(w, httptest.NewRequest(http.MethodGet, "http://request/ui/state", nil))
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var state uiState
+	require.Nil(t, json.NewDecoder(res.Body).Decode(&state))
+	require.Len(t, state.Tasks, 2)
+	require.Equal(t, "IN_PROGRESS", state.Tasks[0].Status)
+	require.Equal(t, "HIGH", state.Tasks[0].Priority)
+	require.Equal(t, "SUCCESS", state.Tasks[1].Status)
+	require.Equal(t, []string{
+		"backup-0000000000001/00000000-0000-0000-0000-000000000001",
+		"backup-0000000000002/00000000-0000-0000-0000-000000000001",
+	}, state.Backups)
+	require.Equal(t, 2, state.Storage.Backups)
+	require.Empty(t, state.Storage.Error)
+
+	w = httptest.NewRecorder()
+	uiHandler(w, httptest.NewRequest(http.MethodGet, "http://request/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "ui/state")
+}
+
+func TestListTasksHandler(t *testing.T) {
+	now := time.Date(2022, 7, 28, 19, 0, 0, 0, time.UTC)
+	tasks := map[uuid.UUID]*task{}
+	var ids []uuid.UUID
+	for i, newTask := range []func(UploadReq) *task{successfulTask, failedTask, successfulTask, cancelledTask, successfulTask} {
+		tk := newTask(UploadReq{})
+		tk.caller.ReceivedAt = now.Add(time.Duration(i) * time.Minute)
+		ID := stringToUUID(fmt.Sprintf("task-%d", i))
+		tasks[ID] = tk
+		ids = append(ids, ID)
+	}
+	s := &Service{Tasks: tasks}
+
+	list := func(query string) (int, api.TaskListResp) {
+		w := httptest.NewRecorder()
+		s.listTasksHandler(w, httptest.NewRequest(http.MethodGet, "http://request/tasks?"+query, nil))
+		res := w.Result()
+		defer res.Body.Close()
+		var resp api.TaskListResp
+		if res.StatusCode == http.StatusOK {
+			require.Nil(t, json.NewDecoder(res.Body).Decode(&resp))
+		}
+		return res.StatusCode, resp
+	}
+	idsOf := func(resp api.TaskListResp) []uuid.UUID {
+		var got []uuid.UUID
+		for _, tk := range resp.Tasks {
+			got = append(got, tk.ID)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []uuid.UUID
+	}{
+		{"all", "", http.StatusOK, []uuid.UUID{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{"state", "state=SUCCESS", http.StatusOK, []uuid.UUID{ids[4], ids[2], ids[0]}},
+		{"states", "state=failure,canceled", http.StatusOK, []uuid.UUID{ids[3], ids[1]}},
+		{"type", "type=UPLOAD&limit=1", http.StatusOK, []uuid.UUID{ids[4]}},
+		{"unknown type", "type=RESTORE", http.StatusOK, nil},
+		{"time range", "since=2022-07-28T19:01:00Z&until=2022-07-28T19:03:00Z", http.StatusOK, []uuid.UUID{ids[3], ids[2], ids[1]}},
+		{"invalid limit", "limit=0", http.StatusBadRequest, nil},
+		{"invalid since", "since=yesterday", http.StatusBadRequest, nil},
+		{"invalid continue", "continue=not*base64", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := list(tt.query)
+			require.Equal(t, tt.wantStatus, status)
+			require.Equal(t, tt.want, idsOf(resp))
+		})
+	}
+
+	// pages continue after the last task, even if newer tasks were added in between
+	var got []uuid.UUID
+	query := "limit=2&state=SUCCESS,FAILURE,CANCELED"
+	for page := 0; ; page++ {
+		require.Less(t, page, 5)
+		status, resp := list(query)
+		require.Equal(t, http.StatusOK, status)
+		got = append(got, idsOf(resp)...)
+		if resp.Continue == "" {
+			break
+		}
+		newer := successfulTask(UploadReq{})
+		newer.caller.ReceivedAt = now.Add(time.Hour + time.Duration(page)*time.Minute)
+		s.Tasks[stringToUUID(fmt.Sprintf("newer-%d", page))] = newer
+		query = "limit=2&continue=" + resp.Continue
+	}
+	require.Equal(t, []uuid.UUID{ids[4], ids[3], ids[2], ids[1], ids[0]}, got)
+}
+
+func TestListBackupsPagination(t *testing.T) {
+	baseDir, err := os.MkdirTemp("", "list_backups_pagination")
+	require.Nil(t, err)
+	defer os.RemoveAll(baseDir)
+
+	err = fileutil.CreateFiles(path.Join(baseDir, DirName), []fileutil.File{
+		{Name: "backup-1659034800000/00000000-0000-0000-0000-000000000001", IsDir: true},
+		{Name: "backup-1659034860000/00000000-0000-0000-0000-000000000001", IsDir: true},
+		{Name: "backup-1659034920000/00000000-0000-0000-0000-000000000001", IsDir: true},
+	}, false)
+	require.Nil(t, err)
+
+	bs := &Service{Tasks: map[uuid.UUID]*task{}}
+	list := func(query string) Resp {
+		body := fmt.Sprintf(`{"backup_base_dir": %q}`, baseDir)
+		w := httptest.NewRecorder()
+		bs.listBackupsHandler(w, httptest.NewRequest(http.MethodGet, "http://request/backup?"+query, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp Resp
+		require.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	first := list("limit=2")
+	require.Equal(t, []string{
+		"backup-1659034800000/00000000-0000-0000-0000-000000000001",
+		"backup-1659034860000/00000000-0000-0000-0000-000000000001",
+	}, first.Backups)
+	require.NotEmpty(t, first.Continue)
+
+	second := list("limit=2&continue=" + first.Continue)
+	require.Equal(t, []string{"backup-1659034920000/00000000-0000-0000-0000-000000000001"}, second.Backups)
+	require.Empty(t, second.Continue)
+
+	// 2022-07-28T19:01:00Z is the second backup
+	ranged := list("since=2022-07-28T19:01:00Z&until=2022-07-28T19:01:00Z")
+	require.Equal(t, []string{"backup-1659034860000/00000000-0000-0000-0000-000000000001"}, ranged.Backups)
+}
+
 func TestCancelHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -357,6 +595,27 @@ func TestDeleteHandler(t *testing.T) {
 	}
 }
 
+func TestDeleteHandlerQueuedTask(t *testing.T) {
+	// a running task occupies the only slot, so that the task waits in the queue
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1}
+	us.queue.running = 1
+	ID, waiting, err := us.startTask(UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data/persistence/backup"}, api.Caller{})
+	require.Nil(t, err)
+	require.Equal(t, 1, waiting)
+	tsk := us.Tasks[ID]
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/upload/"+ID.String(), nil), map[string]string{"id": ID.String()})
+	w := httptest.NewRecorder()
+	us.deleteHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	// the deleted task is neither listed nor started once the slot is free
+	require.NotContains(t, us.Tasks, ID)
+	require.Empty(t, us.queue.waiting)
+	require.NotNil(t, tsk.ctx.Err())
+	require.Equal(t, api.StatusCanceled, tsk.status().Status)
+}
+
 func TestUploadBackup(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -495,6 +754,7 @@ func TestUploadBackup(t *testing.T) {
 			backupKey, err := UploadBackup(ctx, bucket, backupDir, prefix, tt.memberID)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
+				require.Less(t, serverutil.StatusCode(err), 500, "the error is the caller's")
 				return
 			}
 			require.Equal(t, path.Join(prefix, tt.wantBucket), backupKey)
@@ -506,11 +766,17 @@ func TestUploadBackup(t *testing.T) {
 				require.FileExists(t, path.Join(backupDir, tt.want+".delete"))
 			}
 
-			// check if only one tar exists in the bucket
+			// check if only one tar, its manifest and its checksum exist in the bucket
 			it := bucket.List(nil)
 			obj, err := it.Next(ctx)
 			require.Nil(t, err)
-			require.Contains(t, obj.Key, path.Base(tt.want))
+			require.Equal(t, backupKey, obj.Key)
+			obj, err = it.Next(ctx)
+			require.Nil(t, err)
+			require.Equal(t, archive.ArchiveManifestKey(backupKey), obj.Key)
+			obj, err = it.Next(ctx)
+			require.Nil(t, err)
+			require.Equal(t, archive.ChecksumKey(backupKey), obj.Key)
 			_, err = it.Next(ctx)
 			require.True(t, err == io.EOF, "Error is", err)
 
@@ -525,10 +791,584 @@ func TestUploadBackup(t *testing.T) {
 			require.Nil(t, err)
 
 			require.Equal(t, str.String(), string(content))
+
+			sum, err := archive.ReadChecksum(ctx, bucket, backupKey)
+			require.Nil(t, err)
+			require.Nil(t, archive.VerifyChecksum(backupKey, sum, sha256Sum(content)))
+
+			m, err := archive.ReadArchiveManifest(ctx, bucket, backupKey)
+			require.Nil(t, err)
+			require.Equal(t, hex.EncodeToString(sum), m.SHA256)
+			require.Equal(t, int64(len(content)), m.Size)
+			require.Equal(t, path.Base(path.Dir(tt.want)), m.Sequence)
+			require.NotEmpty(t, m.Files)
+			require.NotEmpty(t, m.AgentVersion)
+		})
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func TestUploadBackupWithinTimeBox(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "upload_backup_time_box")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	err = fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true)
+	require.Nil(t, err)
+
+	bucketPath := path.Join(tmpdir, "bucket")
+	require.Nil(t, os.MkdirAll(bucketPath, 0700))
+	bucket, err := fileblob.OpenBucket(bucketPath, nil)
+	require.Nil(t, err)
+	defer bucket.Close()
+
+	// every window uploads a single entry
+	var key string
+	var windows int
+	for done := false; !done; windows++ {
+		require.Less(t, windows, 100, "upload did not finish")
+		key, done, err = UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, UploadOptions{TimeBox: time.Nanosecond})
+		require.Nil(t, err)
+		if windows > 0 {
+			require.NoFileExists(t, hashCacheName(backupDir, 0), "the files are only hashed in the first window")
+		}
+		if !done {
+			require.FileExists(t, path.Join(backupDir, seq+".progress"))
+			require.Nil(t, os.RemoveAll(hashCacheName(backupDir, 0)))
+		}
+	}
+	require.Equal(t, "prefix/2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.gz", key)
+	require.Greater(t, windows, 1)
+	require.NoDirExists(t, path.Join(backupDir, path.Dir(seq)))
+
+	exists, err := bucket.Exists(ctx, archive.ManifestKey(key))
+	require.Nil(t, err)
+	require.True(t, exists)
+
+	// the parts form a regular archive
+	r, err := archive.NewReader(ctx, bucket, key)
+	require.Nil(t, err)
+	defer r.Close()
+	g, err := gzip.NewReader(r)
+	require.Nil(t, err)
+	tr := tar.NewReader(g)
+	var files []fileutil.File
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		name := strings.TrimPrefix(h.Name, path.Base(seq)+"/")
+		if name == path.Base(seq) {
+			continue
+		}
+		files = append(files, fileutil.File{Name: name, IsDir: h.Typeflag == tar.TypeDir})
+	}
+	require.ElementsMatch(t, exampleTarGzFiles, files)
+
+	// the checksum covers all parts
+	all, err := archive.NewReader(ctx, bucket, key)
+	require.Nil(t, err)
+	defer all.Close()
+	content, err := io.ReadAll(all)
+	require.Nil(t, err)
+	sum, err := archive.ReadChecksum(ctx, bucket, key)
+	require.Nil(t, err)
+	require.Nil(t, archive.VerifyChecksum(key, sum, sha256Sum(content)))
+	m, err := archive.ReadArchiveManifest(ctx, bucket, key)
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(sum), m.SHA256)
+	require.Equal(t, int64(len(content)), m.Size)
+	require.NotEmpty(t, m.Files)
+}
+
+func TestUploadBackupWithinTimeBoxFailover(t *testing.T) {
+	ctx := context.Background()
+	backupDir := path.Join(t.TempDir(), "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true))
+
+	primary := memblob.OpenBucket(nil)
+	defer primary.Close()
+	fallback := memblob.OpenBucket(nil)
+	defer fallback.Close()
+
+	key, done, err := UploadBackupWithin(ctx, primary, backupDir, "prefix", 0, UploadOptions{TimeBox: time.Nanosecond, Bucket: "mem://primary"})
+	require.Nil(t, err)
+	require.False(t, done)
+
+	// the window failing over to the fallback writes the parts of the primary again
+	for windows := 0; !done; windows++ {
+		require.Less(t, windows, 100, "upload did not finish")
+		key, done, err = UploadBackupWithin(ctx, fallback, backupDir, "prefix", 0, UploadOptions{TimeBox: time.Nanosecond, Bucket: "mem://fallback"})
+		require.Nil(t, err)
+	}
+	r, err := archive.NewReader(ctx, fallback, key)
+	require.Nil(t, err)
+	content, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	sum, err := archive.ReadChecksum(ctx, fallback, key)
+	require.Nil(t, err)
+	require.Nil(t, archive.VerifyChecksum(key, sum, sha256Sum(content)))
+}
+
+func TestCopyArchive(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "copy_archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	err = fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true)
+	require.Nil(t, err)
+
+	src := memblob.OpenBucket(nil)
+	defer src.Close()
+	dst := memblob.OpenBucket(nil)
+	defer dst.Close()
+
+	// an archive in parts is copied as a single object
+	var key string
+	for done := false; !done; {
+		key, done, err = UploadBackupWithin(ctx, src, backupDir, "prefix", 0, UploadOptions{TimeBox: time.Nanosecond})
+		require.Nil(t, err)
+	}
+	require.Nil(t, copyArchive(ctx, src, dst, key, ""))
+
+	content, err := dst.ReadAll(ctx, key)
+	require.Nil(t, err)
+	sum, err := archive.ReadChecksum(ctx, dst, key)
+	require.Nil(t, err)
+	require.Nil(t, archive.VerifyChecksum(key, sum, sha256Sum(content)))
+	_, err = archive.ReadIndex(ctx, dst, key)
+	require.Nil(t, err)
+	m, err := archive.ReadArchiveManifest(ctx, dst, key)
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(sum), m.SHA256)
+	require.Equal(t, int64(len(content)), m.Size)
+
+	// a corrupted source is not mirrored
+	require.Nil(t, archive.WriteChecksum(ctx, src, key, make([]byte, 32), nil))
+	require.ErrorIs(t, copyArchive(ctx, src, memblob.OpenBucket(nil), key, ""), archive.ErrChecksumMismatch)
+}
+
+func TestMirrorGracePeriod(t *testing.T) {
+	fake := clock.NewFake(time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC))
+	defer clock.Set(fake)()
+	until := fake.Now().Add(time.Minute)
+	fake.Advance(2 * time.Minute)
+	tsk := &task{
+		ctx: context.Background(),
+		req: UploadReq{BucketURL: "s3://new-bucket", MirrorBucketURLs: []string{"s3://old-bucket"}, MirrorUntil: &until},
+	}
+	require.Nil(t, tsk.mirror(uuid.New(), "s3://new-bucket", "prefix/key.tar.gz", nil))
+}
+
+func TestMirrorFailoverBuckets(t *testing.T) {
+	ctx := context.Background()
+	backupDir := path.Join(t.TempDir(), "backupDir")
+	require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, "backup-1659034855438/00000000-0000-0000-0000-000000000001"), exampleTarGzFiles, true))
+	primary, fallback := t.TempDir(), t.TempDir()
+	src, err := fileblob.OpenBucket(fallback, nil)
+	require.Nil(t, err)
+	key, err := UploadBackup(ctx, src, backupDir, "prefix", 0)
+	require.Nil(t, err)
+	require.Nil(t, src.Close())
+
+	// the backup failed over to the fallback, it is written to the primary as well
+	tsk := &task{
+		ctx: ctx,
+		req: UploadReq{BucketURL: "file://" + primary, FallbackBucketURLs: []string{"file://" + fallback}},
+	}
+	statuses := tsk.mirror(uuid.New(), "file://"+fallback, key, nil)
+	require.Equal(t, []api.MirrorStatus{{BucketURL: "file://" + primary, Status: api.StatusSuccess}}, statuses)
+	dst, err := fileblob.OpenBucket(primary, nil)
+	require.Nil(t, err)
+	defer dst.Close()
+	exists, err := dst.Exists(ctx, key)
+	require.Nil(t, err)
+	require.True(t, exists)
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2022, 7, 28, 19, 0, 0, 0, time.UTC)
+	folders := []string{
+		"hazelcast/2022-07-28-18-00-00",
+		"hazelcast/2022-07-20-18-00-00",
+		"hazelcast/2022-07-27-18-00-00",
+		"hazelcast/2022-07-01-18-00-00",
+		"hazelcast/not-a-backup",
+	}
+	current := "hazelcast/2022-07-28-18-00-00"
+	complete := map[string]bool{}
+	for _, f := range folders {
+		complete[f] = true
+	}
+	tests := []struct {
+		name   string
+		policy retentionPolicy
+		want   []string
+	}{
+		{"keep last", retentionPolicy{KeepLast: 2}, []string{"hazelcast/2022-07-20-18-00-00", "hazelcast/2022-07-01-18-00-00"}},
+		{"keep days", retentionPolicy{KeepDays: 10}, []string{"hazelcast/2022-07-01-18-00-00"}},
+		{"either rule keeps", retentionPolicy{KeepLast: 3, KeepDays: 1}, []string{"hazelcast/2022-07-01-18-00-00"}},
+		{"current is kept", retentionPolicy{KeepLast: 1, KeepDays: 0}, []string{"hazelcast/2022-07-27-18-00-00", "hazelcast/2022-07-20-18-00-00", "hazelcast/2022-07-01-18-00-00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.policy.expired(folders, complete, current, time.UTC, now))
+		})
+	}
+
+	// a partial folder does not count towards keep-last, the last complete backup is kept
+	complete["hazelcast/2022-07-27-18-00-00"] = false
+	require.Equal(t, []string{"hazelcast/2022-07-27-18-00-00", "hazelcast/2022-07-01-18-00-00"},
+		retentionPolicy{KeepLast: 2}.expired(folders, complete, current, time.UTC, now))
+
+	// folders within the upload window are neither deleted nor counted
+	require.Equal(t, []string{"hazelcast/2022-07-01-18-00-00"},
+		retentionPolicy{KeepLast: 1, UploadWindow: 48 * time.Hour}.expired(folders, complete, current, time.UTC, now))
+}
+
+func TestCompleteFolders(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	for _, key := range []string{
+		"hazelcast/2022-07-01-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz",
+		"hazelcast/2022-07-01-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz.sha256",
+		"hazelcast/2022-07-01-18-00-00/00000000-0000-0000-0000-000000000002.tar.gz.parts",
+		"hazelcast/2022-07-20-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz",
+		"hazelcast/2022-07-20-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz.sha256",
+		"hazelcast/2022-07-20-18-00-00/00000000-0000-0000-0000-000000000002.tar.gz",
+		"hazelcast/2022-07-27-18-00-00/00000000-0000-0000-0000-000000000001.tar.zst.manifest.json",
+		"hazelcast/2022-07-27-18-00-00/00000000-0000-0000-0000-000000000001.tar.zst",
+	} {
+		require.Nil(t, b.WriteAll(ctx, key, []byte("backup"), nil))
+	}
+	folders, err := listFolders(ctx, b, "hazelcast")
+	require.Nil(t, err)
+	complete, err := completeFolders(ctx, b, append(folders, "hazelcast/2022-07-28-18-00-00"))
+	require.Nil(t, err)
+	require.Equal(t, map[string]bool{
+		"hazelcast/2022-07-01-18-00-00": true,
+		"hazelcast/2022-07-20-18-00-00": false,
+		"hazelcast/2022-07-27-18-00-00": true,
+		"hazelcast/2022-07-28-18-00-00": false,
+	}, complete)
+}
+
+func TestPruneFolders(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	for _, key := range []string{
+		"hazelcast/2022-07-01-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz",
+		"hazelcast/2022-07-01-18-00-00/00000000-0000-0000-0000-000000000002.tar.gz",
+		"hazelcast/2022-07-28-18-00-00/00000000-0000-0000-0000-000000000001.tar.gz",
+	} {
+		require.Nil(t, b.WriteAll(ctx, key, []byte("backup"), nil))
+	}
+
+	folders, err := listFolders(ctx, b, "hazelcast")
+	require.Nil(t, err)
+	require.Equal(t, []string{"hazelcast/2022-07-01-18-00-00", "hazelcast/2022-07-28-18-00-00"}, folders)
+
+	// a dry run counts the objects without deleting them
+	res := &api.PruneResult{DryRun: true}
+	require.Nil(t, pruneFolder(ctx, b, folders[0], bucket.DeleteOptions{DryRun: true}, res))
+	require.Equal(t, 2, res.Objects)
+	require.Equal(t, int64(12), res.Bytes)
+	folders, err = listFolders(ctx, b, "hazelcast")
+	require.Nil(t, err)
+	require.Len(t, folders, 2)
+
+	res = &api.PruneResult{}
+	require.Nil(t, pruneFolder(ctx, b, folders[0], bucket.DeleteOptions{Rate: 1000}, res))
+	require.Equal(t, 2, res.Objects)
+	folders, err = listFolders(ctx, b, "hazelcast")
+	require.Nil(t, err)
+	require.Equal(t, []string{"hazelcast/2022-07-28-18-00-00"}, folders)
+}
+
+func TestUploadBackupZstd(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "upload_backup_zstd")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	err = fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true)
+	require.Nil(t, err)
+
+	bucketPath := path.Join(tmpdir, "bucket")
+	require.Nil(t, os.MkdirAll(bucketPath, 0700))
+	bucket, err := fileblob.OpenBucket(bucketPath, nil)
+	require.Nil(t, err)
+	defer bucket.Close()
+
+	opts := UploadOptions{Codec: archive.Codec{Compression: archive.Zstd, Level: 3}}
+	key, done, err := UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, opts)
+	require.Nil(t, err)
+	require.True(t, done)
+	require.Equal(t, "prefix/2022-07-28-19-00-55/00000000-0000-0000-0000-000000000001.tar.zst", key)
+
+	index, err := archive.ReadIndex(ctx, bucket, key)
+	require.Nil(t, err)
+	_, ok := index.Find("00000000-0000-0000-0000-000000000001/cluster/members.bin")
+	require.True(t, ok)
+}
+
+func TestUploadBackupClusterSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeBox time.Duration
+	}{
+		{"single object", 0},
+		{"parts", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tmpdir, err := os.MkdirTemp("", "upload_backup_cluster_size")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			backupDir := path.Join(tmpdir, "backupDir")
+			seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+			require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true))
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			key, done, err := UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, UploadOptions{TimeBox: tt.timeBox, ClusterSize: 3})
+			require.Nil(t, err)
+			require.True(t, done)
+
+			size, err := archive.ReadClusterSize(ctx, bucket, key)
+			require.Nil(t, err)
+			require.Equal(t, 3, size)
+		})
+	}
+}
+
+func TestUploadBackupEncrypted(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeBox time.Duration
+	}{
+		{"single object", 0},
+		// every window uploads a single entry, each part is encrypted on its own
+		{"parts", time.Nanosecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tmpdir, err := os.MkdirTemp("", "upload_backup_encrypted")
+			require.Nil(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			backupDir := path.Join(tmpdir, "backupDir")
+			seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+			require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true))
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			encryptionKey := make([]byte, 32)
+			opts := UploadOptions{TimeBox: tt.timeBox, EncryptionKey: encryptionKey}
+			var key string
+			for done := false; !done; {
+				key, done, err = UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, opts)
+				require.Nil(t, err)
+			}
+			require.True(t, strings.HasSuffix(key, ".tar.gz.enc"), key)
+
+			r, err := archive.NewReader(ctx, bucket, key)
+			require.Nil(t, err)
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			require.Nil(t, err)
+			want, err := archive.ReadChecksum(ctx, bucket, key)
+			require.Nil(t, err)
+			sum := sha256.Sum256(data)
+			require.Equal(t, want, sum[:])
+
+			g, err := archive.Decompress(archive.NewDecryptReader(bytes.NewReader(data), encryptionKey), key)
+			require.Nil(t, err)
+			defer g.Close()
+			var names []string
+			tr := tar.NewReader(g)
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				require.Nil(t, err)
+				names = append(names, h.Name)
+			}
+			require.Contains(t, names, "00000000-0000-0000-0000-000000000001/cluster/cluster-state.txt")
 		})
 	}
 }
 
+func TestUploadBackupManifest(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "upload_backup_manifest")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true))
+	oldest := time.Date(2022, 7, 28, 18, 0, 0, 0, time.UTC)
+	newest := time.Date(2022, 7, 28, 18, 59, 0, 0, time.UTC)
+	require.Nil(t, filepath.WalkDir(path.Join(backupDir, seq), func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(name, oldest, oldest)
+	}))
+	require.Nil(t, os.Chtimes(path.Join(backupDir, seq, "cluster/cluster-state.txt"), newest, newest))
+
+	now := time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC)
+	defer clock.Set(clock.NewFake(now))()
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	want := &api.BackupManifest{ClusterName: "prod", HazelcastVersion: "5.3.1", MemberCount: 3, PartitionCount: 271}
+	key, _, err := UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, UploadOptions{Manifest: want, ClusterName: "prod", HazelcastVersion: "5.3.1"})
+	require.Nil(t, err)
+	require.Nil(t, want.Snapshot, "the manifest of the caller is not changed")
+
+	m, err := archive.ReadArchiveManifest(ctx, bucket, key)
+	require.Nil(t, err)
+	require.Equal(t, "prod", m.ClusterName)
+	require.Equal(t, "5.3.1", m.HazelcastVersion)
+
+	snap := &api.SnapshotInfo{Start: now, End: now, OldestModTime: oldest, NewestModTime: newest}
+	stored, err := archive.ReadSnapshot(ctx, bucket, key)
+	require.Nil(t, err)
+	require.Equal(t, snap, stored)
+
+	index, err := archive.ReadIndex(ctx, bucket, key)
+	require.Nil(t, err)
+	e, ok := index.Find("meta/manifest.json")
+	require.True(t, ok)
+	_, r, err := archive.OpenEntry(ctx, bucket, key, e)
+	require.Nil(t, err)
+	defer r.Close()
+	var got api.BackupManifest
+	require.Nil(t, json.NewDecoder(r).Decode(&got))
+	want.Snapshot = snap
+	require.Equal(t, *want, got)
+}
+
+func TestUploadBackupFileManifest(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "upload_backup_file_manifest")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	require.Nil(t, fileutil.CreateFiles(path.Join(backupDir, seq), exampleTarGzFiles, true))
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	key, _, err := UploadBackupWithin(ctx, bucket, backupDir, "prefix", 0, UploadOptions{FileManifest: true, HashWorkers: 2})
+	require.Nil(t, err)
+
+	index, err := archive.ReadIndex(ctx, bucket, key)
+	require.Nil(t, err)
+	e, ok := index.Find("meta/files.json")
+	require.True(t, ok)
+	_, r, err := archive.OpenEntry(ctx, bucket, key, e)
+	require.Nil(t, err)
+	defer r.Close()
+	var got []archive.FileEntry
+	require.Nil(t, json.NewDecoder(r).Decode(&got))
+	require.NotEmpty(t, got)
+	for _, f := range got {
+		require.Len(t, f.SHA256, 64, f.Path)
+		require.True(t, strings.HasPrefix(f.Path, "00000000-0000-0000-0000-000000000001/"), f.Path)
+	}
+
+	// the digests are cached for the following backup of the member
+	cache, err := readHashCache(hashCacheName(backupDir, 0))
+	require.Nil(t, err)
+	require.Len(t, cache, len(got))
+}
+
+func TestSnapshotBackup(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "snapshot_backup")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupDir := path.Join(tmpdir, "backupDir")
+	root := path.Join(tmpdir, "snapshots")
+	member := "00000000-0000-0000-0000-000000000001"
+	writeBackup := func(seq string, files map[string]string) {
+		for name, content := range files {
+			name = path.Join(backupDir, seq, member, name)
+			require.Nil(t, os.MkdirAll(path.Dir(name), 0755))
+			require.Nil(t, os.WriteFile(name, []byte(content), 0600))
+		}
+	}
+
+	writeBackup("backup-1659034855438", map[string]string{"s00/value/01.chunk": "one", "s00/value/02.chunk": "two", "cluster/cluster-state.txt": "ACTIVE"})
+	first, err := SnapshotBackup(ctx, root, backupDir, "prefix", 0, UploadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "prefix/2022-07-28-19-00-55/"+member, first)
+	// the local backup is removed once the snapshot is complete
+	_, err = os.Stat(path.Join(backupDir, "backup-1659034855438"))
+	require.True(t, os.IsNotExist(err))
+
+	// Hazelcast copies the unchanged files into the next backup with a new modification time
+	time.Sleep(10 * time.Millisecond)
+	writeBackup("backup-1659034955438", map[string]string{"s00/value/01.chunk": "one", "s00/value/02.chunk": "changed", "cluster/cluster-state.txt": "ACTIVE"})
+	second, err := SnapshotBackup(ctx, root, backupDir, "prefix", 0, UploadOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "prefix/2022-07-28-19-02-35/"+member, second)
+
+	for name, linked := range map[string]bool{"s00/value/01.chunk": true, "s00/value/02.chunk": false, "cluster/cluster-state.txt": true} {
+		a, err := os.Stat(path.Join(root, first, name))
+		require.Nil(t, err)
+		b, err := os.Stat(path.Join(root, second, name))
+		require.Nil(t, err)
+		require.Equal(t, linked, os.SameFile(a, b), name)
+	}
+	content, err := os.ReadFile(path.Join(root, second, "s00/value/02.chunk"))
+	require.Nil(t, err)
+	require.Equal(t, "changed", string(content))
+	content, err = os.ReadFile(path.Join(root, first, "s00/value/02.chunk"))
+	require.Nil(t, err)
+	require.Equal(t, "two", string(content))
+}
+
+func TestSnapshotRoot(t *testing.T) {
+	root, err := snapshotRoot("file:///mnt/backups?prefix=hazelcast/")
+	require.Nil(t, err)
+	require.Equal(t, "/mnt/backups/hazelcast", root)
+
+	_, err = snapshotRoot("s3://bucket?prefix=hazelcast/")
+	require.ErrorIs(t, err, ErrSnapshotNotFileBucket)
+}
+
 func TestCreateArchive(t *testing.T) {
 	_, err := exec.LookPath("tar")
 	require.Nil(t, err, "Need tar executable for this test")
@@ -629,6 +1469,18 @@ func failedTask(req UploadReq) *task {
 	return t
 }
 
+func sizeExceededTask(req UploadReq) *task {
+	t := failedTask(req)
+	t.err = &sizeExceededError{Backup: "backup-1", Bytes: 2, Max: 1, Contributors: []api.SizeContributor{{Path: "s00", Files: 1, Bytes: 2}}}
+	return t
+}
+
+func missedRunTask(req UploadReq) *task {
+	t := failedTask(req)
+	t.err = &missedRunError{ScheduledAt: time.Date(2022, 7, 28, 19, 0, 0, 0, time.UTC), Late: time.Hour, Policy: api.MissedRunSkip, Deadline: time.Minute}
+	return t
+}
+
 func successfulTask(req UploadReq) *task {
 	ctx, cancel := context.WithCancel(context.Background())
 	t := &task{
@@ -649,3 +1501,540 @@ func countSubstring(list []string, substr string) (count int) {
 	}
 	return
 }
+
+func TestEstimateUpload(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "estimate_upload")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	backupsDir := path.Join(tmpdir, DirName)
+	uuid := "00000000-0000-0000-0000-000000000001"
+	first := path.Join(backupsDir, "backup-1659034855438", uuid)
+	require.Nil(t, os.MkdirAll(path.Join(first, "s00"), 0755))
+	for name, size := range map[string]int{"cluster/cluster-state.txt": 10, "s00/chunk-1": 1000, "s00/chunk-2": 1000} {
+		require.Nil(t, os.MkdirAll(path.Dir(path.Join(first, name)), 0755))
+		require.Nil(t, os.WriteFile(path.Join(first, name), make([]byte, size), 0600))
+	}
+
+	// nothing was uploaded yet, the whole backup is uploaded uncompressed
+	got, err := estimateUpload(tmpdir, 0)
+	require.Nil(t, err)
+	require.Equal(t, api.EstimateResp{Backup: "backup-1659034855438/" + uuid, Files: 3, Bytes: 2010, ChangedFiles: 3, ChangedBytes: 2010, UploadBytes: 2010}, *got)
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "backup.tar.gz", make([]byte, 201), nil))
+	files, err := scanBackup(first)
+	require.Nil(t, err)
+	require.Nil(t, recordUpload(ctx, bucket, backupsDir, 0, "backup.tar.gz", files, 2*time.Second))
+
+	// the next backup keeps a chunk, rewrites one and drops one
+	second := path.Join(backupsDir, "backup-1659034955438", uuid)
+	require.Nil(t, os.MkdirAll(path.Dir(second), 0755))
+	require.Nil(t, os.Rename(first, second))
+	require.Nil(t, os.Remove(path.Dir(first)))
+	require.Nil(t, os.WriteFile(path.Join(second, "cluster/cluster-state.txt"), make([]byte, 20), 0600))
+	require.Nil(t, os.Remove(path.Join(second, "s00/chunk-2")))
+	require.Nil(t, os.WriteFile(path.Join(second, "s00/chunk-3"), make([]byte, 3000), 0600))
+
+	got, err = estimateUpload(tmpdir, 0)
+	require.Nil(t, err)
+	require.NotNil(t, got.LastUpload)
+	require.Equal(t, "backup.tar.gz", got.LastKey)
+	require.Equal(t, "backup-1659034955438/"+uuid, got.Backup)
+	require.Equal(t, 3, got.Files)
+	require.Equal(t, int64(4020), got.Bytes)
+	require.Equal(t, 2, got.ChangedFiles)
+	require.Equal(t, int64(3020), got.ChangedBytes)
+	require.Equal(t, 1, got.RemovedFiles)
+	// the compression ratio and the throughput of the last upload apply
+	require.Equal(t, int64(402), got.UploadBytes)
+	require.Equal(t, 4.0, got.DurationSeconds)
+}
+
+func TestCheckBackupSize(t *testing.T) {
+	tmpdir := t.TempDir()
+	uuid := "00000000-0000-0000-0000-000000000001"
+	backup := path.Join(tmpdir, DirName, "backup-1659034855438", uuid)
+	for name, size := range map[string]int{"cluster/cluster-state.txt": 10, "s00/value/01/1.chunk": 1000, "s00/value/01/2.chunk": 500, "s00/tombstone/02/1.chunk": 600} {
+		require.Nil(t, os.MkdirAll(path.Dir(path.Join(backup, name)), 0755))
+		require.Nil(t, os.WriteFile(path.Join(backup, name), make([]byte, size), 0600))
+	}
+
+	est, files, err := estimateBackup(tmpdir, 0)
+	require.Nil(t, err)
+	require.Len(t, files, 4)
+	require.Nil(t, checkBackupSize(est, files, 0))
+	require.Nil(t, checkBackupSize(est, files, 2110))
+
+	err = checkBackupSize(est, files, 2000)
+	var sizeErr *sizeExceededError
+	require.ErrorAs(t, err, &sizeErr)
+	require.Equal(t, int64(2110), sizeErr.Bytes)
+	require.Equal(t, []api.SizeContributor{
+		{Path: "s00/value/01", Files: 2, Bytes: 1500},
+		{Path: "s00/tombstone/02", Files: 1, Bytes: 600},
+		{Path: "cluster", Files: 1, Bytes: 10},
+	}, sizeErr.Contributors)
+
+	require.Len(t, largestContributors(map[string]fileState{"a/1": {Size: 1}, "b/1": {Size: 2}, "c/1": {Size: 2}}, 2),
+		2, "only the largest folders are listed")
+}
+
+func TestMissedRunPolicy(t *testing.T) {
+	due := time.Date(2022, 7, 28, 19, 0, 0, 0, time.UTC)
+	policy := missedRunPolicy{Policy: api.MissedRunRun, Grace: time.Minute}
+	tests := []struct {
+		name     string
+		policy   string
+		deadline int
+		late     time.Duration
+		wantSkip bool
+	}{
+		{"default runs missed backups", "", 0, 6 * time.Hour, false},
+		{"skip on time", api.MissedRunSkip, 0, 30 * time.Second, false},
+		{"skip late", api.MissedRunSkip, 0, 2 * time.Minute, true},
+		{"run late", api.MissedRunRun, 0, 6 * time.Hour, false},
+		{"within deadline", api.MissedRunDeadline, 600, 9 * time.Minute, false},
+		{"past deadline", api.MissedRunDeadline, 600, 11 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := UploadReq{ScheduledAt: &due, MissedRunPolicy: tt.policy, StartingDeadlineSeconds: tt.deadline}
+			err := policy.check(req, due.Add(tt.late))
+			if tt.wantSkip {
+				require.IsType(t, &missedRunError{}, err)
+			} else {
+				require.Nil(t, err)
+			}
+		})
+	}
+
+	require.Nil(t, policy.check(UploadReq{}, due), "unscheduled backups always run")
+	skip := missedRunPolicy{Policy: api.MissedRunSkip, Grace: time.Minute}
+	require.NotNil(t, skip.check(UploadReq{ScheduledAt: &due}, due.Add(time.Hour)), "the policy of the sidecar applies without one in the request")
+}
+
+func TestScheduler(t *testing.T) {
+	// a running task occupies the only slot, so that the scheduled tasks wait in the queue
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1}
+	us.queue.running = 1
+	req := UploadReq{BucketURL: "s3://bucket", BackupBaseDir: "/data/persistence/backup", HazelcastCRName: "hazelcast"}
+	_, err := newScheduler("0 2 * *", time.UTC, req, us)
+	require.NotNil(t, err)
+	sch, err := newScheduler("0 2 * * *", time.UTC, req, us)
+	require.Nil(t, err)
+	us.Schedule = sch
+
+	due := time.Date(2022, 7, 28, 2, 0, 0, 0, time.UTC)
+	sch.trigger(context.Background(), due)
+	require.Len(t, us.Tasks, 1)
+	first := *sch.status().LastTaskID
+	require.Equal(t, api.SchedulerIdentity, us.Tasks[first].caller.Identity)
+	require.Equal(t, due, *us.Tasks[first].req.ScheduledAt)
+	require.Equal(t, "hazelcast", us.Tasks[first].req.HazelcastCRName)
+
+	// the backup of the first run is still waiting
+	sch.trigger(context.Background(), due.AddDate(0, 0, 1))
+	require.Len(t, us.Tasks, 1)
+	st := sch.status()
+	require.Equal(t, 1, st.Skipped)
+	require.Contains(t, st.LastSkip, first.String())
+	require.Equal(t, first, *st.LastTaskID)
+
+	us.Tasks[first].cancel()
+	sch.trigger(context.Background(), due.AddDate(0, 0, 2))
+	require.Len(t, us.Tasks, 2)
+
+	w := httptest.NewRecorder()
+	us.scheduleHandler(w, httptest.NewRequest(http.MethodGet, "http://request/schedule", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp api.ScheduleStatus
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "0 2 * * *", resp.Schedule)
+	require.Equal(t, due.AddDate(0, 0, 2), *resp.LastRun)
+	require.NotEqual(t, first, *resp.LastTaskID)
+	require.Equal(t, api.StatusInProgress, resp.LastStatus)
+	require.Equal(t, 1, resp.Skipped)
+
+	w = httptest.NewRecorder()
+	(&Service{}).scheduleHandler(w, httptest.NewRequest(http.MethodGet, "http://request/schedule", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1}
+	us.queue.running = 1
+	sch, err := newScheduler("@daily", time.UTC, UploadReq{}, us)
+	require.Nil(t, err)
+	defer clock.Set(clock.NewFake(time.Date(2022, 7, 28, 19, 0, 55, 0, time.UTC)))()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sch.run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		next := sch.status().NextRun
+		return next != nil && next.Equal(time.Date(2022, 7, 29, 0, 0, 0, 0, time.UTC))
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	require.Empty(t, us.Tasks)
+}
+
+func TestSchedulerHotBackup(t *testing.T) {
+	baseDir := t.TempDir()
+	backupsDir := filepath.Join(baseDir, DirName)
+	require.Nil(t, os.MkdirAll(filepath.Join(backupsDir, "backup-1659034855438"), 0o755))
+	var body string
+	member := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, hotBackupPath, r.URL.Path)
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		require.Nil(t, os.MkdirAll(filepath.Join(backupsDir, "backup-1659121255438"), 0o755))
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer member.Close()
+
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1,
+		Member: memberPolicy{URL: member.URL, Timeout: time.Second, Interval: 10 * time.Millisecond, ClusterName: "dev"}}
+	us.queue.running = 1
+	sch, err := newScheduler("0 2 * * *", time.UTC, UploadReq{BucketURL: "s3://bucket", BackupBaseDir: baseDir}, us)
+	require.Nil(t, err)
+
+	// the last backup was created before the run of July 29, which was missed
+	missed, ok := sch.missedRun(time.Date(2022, 7, 29, 8, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, time.Date(2022, 7, 29, 2, 0, 0, 0, time.UTC), missed)
+	_, ok = sch.missedRun(time.Date(2022, 7, 28, 20, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+
+	sch.trigger(context.Background(), missed)
+	require.Equal(t, "dev&", body)
+	require.Len(t, us.Tasks, 1)
+	require.Zero(t, sch.status().Skipped)
+
+	// the missed-run policy skips a late run before the member creates a backup
+	us.Tasks[*sch.status().LastTaskID].cancel()
+	us.MissedRun = missedRunPolicy{Policy: api.MissedRunSkip, Grace: time.Minute}
+	body = ""
+	sch.trigger(context.Background(), missed)
+	require.Empty(t, body)
+	require.Len(t, us.Tasks, 1)
+	require.Contains(t, sch.status().LastSkip, "late")
+
+	// a failing member skips the run
+	us.MissedRun = missedRunPolicy{}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"fail","message":"hot backup is not enabled"}`))
+	}))
+	defer failing.Close()
+	us.Member.URL = failing.URL
+	sch.trigger(context.Background(), missed)
+	require.Len(t, us.Tasks, 1)
+	require.Contains(t, sch.status().LastSkip, "hot backup is not enabled")
+}
+
+func TestCleanLocalBackups(t *testing.T) {
+	backupsDir := filepath.Join(t.TempDir(), DirName)
+	for _, dir := range []string{
+		"backup-1659034855438/00000000-0000-0000-0000-000000000001",
+		"backup-1659034855438/00000000-0000-0000-0000-000000000002",
+		"backup-1659034955438/00000000-0000-0000-0000-000000000001",
+		"backup-1659034955438/00000000-0000-0000-0000-000000000002",
+		"backup-1659035055438/00000000-0000-0000-0000-000000000001",
+		"backup-1659035055438/00000000-0000-0000-0000-000000000002",
+	} {
+		require.Nil(t, fileutil.CreateFiles(filepath.Join(backupsDir, dir), exampleTarGzFiles, true))
+	}
+
+	// backups whose upload was not verified are kept
+	res, err := cleanLocalBackups(backupsDir, 1)
+	require.Nil(t, err)
+	require.Empty(t, res.Deleted)
+
+	// the latest backup is kept even once it is verified
+	for _, seq := range []string{"backup-1659034955438", "backup-1659035055438"} {
+		require.Nil(t, recordVerified(backupsDir, 1, seq))
+	}
+	res, err = cleanLocalBackups(backupsDir, 1)
+	require.Nil(t, err)
+	require.Equal(t, []string{"backup-1659034955438/00000000-0000-0000-0000-000000000002"}, res.Deleted)
+	backups, err := listBackups(filepath.Dir(backupsDir), 0)
+	require.Nil(t, err)
+	require.Len(t, backups, 3, "the backups of the other member are kept")
+
+	// the verified uploads of a member do not delete the backups of the other
+	for _, seq := range []string{"backup-1659034855438", "backup-1659034955438"} {
+		require.Nil(t, recordVerified(backupsDir, 0, seq))
+	}
+	res, err = cleanLocalBackups(backupsDir, 0)
+	require.Nil(t, err)
+	require.Len(t, res.Deleted, 2)
+	seqs, err := fileutil.FolderSequence(backupsDir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"backup-1659034855438", "backup-1659035055438"}, []string{seqs[0].Name(), seqs[1].Name()}, "sequences without backups are deleted")
+
+	// cleaned up sequences are forgotten, the index of the member would point to another backup now
+	verified, err := readVerified(verifiedName(backupsDir, 0))
+	require.Nil(t, err)
+	require.Empty(t, verified)
+	verified, err = readVerified(verifiedName(backupsDir, 1))
+	require.Nil(t, err)
+	require.Equal(t, map[string]bool{"backup-1659035055438": true}, verified)
+}
+
+func TestCleanLocalHandler(t *testing.T) {
+	baseDir := t.TempDir()
+	seq := "backup-1659034855438/00000000-0000-0000-0000-000000000001"
+	latest := "backup-1659034955438/00000000-0000-0000-0000-000000000001"
+	for _, dir := range []string{seq, latest} {
+		require.Nil(t, fileutil.CreateFiles(filepath.Join(baseDir, DirName, dir), exampleTarGzFiles, true))
+	}
+	require.Nil(t, os.WriteFile(filepath.Join(baseDir, DirName, seq+".delete"), nil, 0600))
+	require.Nil(t, recordVerified(filepath.Join(baseDir, DirName), 0, path.Dir(seq)))
+	body := fmt.Sprintf(`{"backup_base_dir": %q}`, baseDir)
+	health := `{"clusterState": "IN_TRANSITION", "clusterSafe": true}`
+	member := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(health))
+	}))
+	defer member.Close()
+
+	// a running upload of the base dir blocks the cleanup
+	ctx, cancel := context.WithCancel(context.Background())
+	us := &Service{Tasks: map[uuid.UUID]*task{uuid.New(): {ctx: ctx, req: UploadReq{BackupBaseDir: baseDir}}}, Member: memberPolicy{URL: member.URL, Policy: MemberPolicyWait, Timeout: time.Minute}}
+
+	// only the base dir of the sidecar may be cleaned up
+	rec := httptest.NewRecorder()
+	other := fmt.Sprintf(`{"backup_base_dir": %q}`, t.TempDir())
+	us.cleanLocalHandler(rec, httptest.NewRequest(http.MethodDelete, "/backups/local", strings.NewReader(other)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	us.cleanLocalHandler(rec, httptest.NewRequest(http.MethodDelete, "/backups/local", strings.NewReader(body)))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// a member creating a backup blocks the cleanup without waiting
+	cancel()
+	rec = httptest.NewRecorder()
+	us.cleanLocalHandler(rec, httptest.NewRequest(http.MethodDelete, "/backups/local", strings.NewReader(body)))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	health = `{"clusterState": "ACTIVE", "clusterSafe": true}`
+	rec = httptest.NewRecorder()
+	us.cleanLocalHandler(rec, httptest.NewRequest(http.MethodDelete, "/backups/local", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res api.LocalCleanup
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, []string{seq}, res.Deleted)
+	_, err := os.Stat(filepath.Join(baseDir, DirName, seq+".delete"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestVerifyArchive(t *testing.T) {
+	ctx := context.Background()
+	backupDir := filepath.Join(t.TempDir(), DirName)
+	require.Nil(t, fileutil.CreateFiles(filepath.Join(backupDir, "backup-1659034855438/00000000-0000-0000-0000-000000000001"), exampleTarGzFiles, true))
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	key, err := UploadBackup(ctx, b, backupDir, "prefix", 0)
+	require.Nil(t, err)
+	require.Nil(t, verifyArchive(ctx, b, key))
+
+	require.Nil(t, archive.WriteChecksum(ctx, b, key, make([]byte, 32), nil))
+	require.ErrorIs(t, verifyArchive(ctx, b, key), archive.ErrChecksumMismatch)
+	require.Nil(t, b.Delete(ctx, archive.ChecksumKey(key)))
+	require.NotNil(t, verifyArchive(ctx, b, key), "archives without a checksum are not verified")
+}
+
+func TestDebugHandler(t *testing.T) {
+	h := debugHandler([]string{"operator"})
+	request := func(path, identity string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: identity}}}}}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("/debug/runtime", "operator")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats api.RuntimeStats
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, runtime.Version(), stats.GoVersion)
+	require.Positive(t, stats.Goroutines)
+	require.Positive(t, stats.HeapAlloc)
+
+	require.Equal(t, http.StatusOK, request("/debug/pprof/heap", "operator").Code)
+	require.Equal(t, http.StatusForbidden, request("/debug/runtime", "someone").Code)
+}
+
+func TestEstimateHandlerNoBackup(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "estimate_handler")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	require.Nil(t, os.MkdirAll(path.Join(tmpdir, DirName), 0755))
+
+	body := strings.NewReader(fmt.Sprintf(`{"backup_base_dir": %q}`, tmpdir))
+	req := httptest.NewRequest(http.MethodGet, "/backup/estimate", body)
+	rec := httptest.NewRecorder()
+	(&Service{}).estimateHandler(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestBatchUpload(t *testing.T) {
+	backups := t.TempDir()
+	present := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(filepath.Join(present, DirName, "backup-1659034855438/00000000-0000-0000-0000-000000000001"), exampleTarGzFiles, true))
+	req := api.BatchUploadReq{
+		UploadReq: UploadReq{BucketURL: "file://" + backups, BackupBaseDir: present, HazelcastCRName: "hazelcast"},
+		// the second item has no backup
+		Items: []api.BatchItem{{}, {BackupBaseDir: filepath.Join(t.TempDir(), "missing"), MemberID: 1}},
+	}
+
+	// a running task occupies the only slot, so that the batch waits in the queue
+	us := &Service{Tasks: map[uuid.UUID]*task{}, MaxTasks: 1}
+	us.queue.running = 1
+	ID, waiting, err := us.startBatch(req, api.Caller{})
+	require.Nil(t, err)
+	require.Equal(t, 1, waiting)
+	require.Len(t, us.Tasks, 1)
+	bt := us.Tasks[ID]
+	require.Equal(t, present, bt.batch[0].req.BackupBaseDir)
+	require.Equal(t, "hazelcast", bt.batch[1].req.HazelcastCRName)
+
+	st := bt.status()
+	require.Equal(t, api.StatusInProgress, st.Status)
+	require.Equal(t, 2, st.Batch.Total)
+	require.Zero(t, st.Batch.Done)
+
+	bt.process(ID)
+	st = bt.status()
+	require.Equal(t, api.StatusFailure, st.Status)
+	require.Equal(t, 2, st.Batch.Done)
+	require.Equal(t, 1, st.Batch.Failed)
+	require.Equal(t, api.StatusSuccess, st.Batch.Items[0].Status)
+	require.NotEmpty(t, st.Batch.Items[0].BackupKey)
+	require.Equal(t, api.StatusFailure, st.Batch.Items[1].Status)
+	require.Equal(t, 1, st.Batch.Items[1].MemberID)
+
+	// a canceled batch cancels the items that did not run
+	ID, _, err = us.startBatch(req, api.Caller{})
+	require.Nil(t, err)
+	bt = us.Tasks[ID]
+	bt.cancel()
+	bt.process(ID)
+	st = bt.status()
+	require.Equal(t, api.StatusCanceled, st.Status)
+	for _, item := range st.Batch.Items {
+		require.Equal(t, api.StatusCanceled, item.Status)
+	}
+}
+
+func TestIncrementalUpload(t *testing.T) {
+	ctx := context.Background()
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+	// Hazelcast hard links the unchanged chunk files into every backup
+	src := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(src, exampleTarGzFiles, false))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "s00/value/01/0000000000000001.chunk"), bytes.Repeat([]byte("x"), 4096), 0600))
+	backupDir := filepath.Join(t.TempDir(), DirName)
+	link := func(seq string) {
+		dst := filepath.Join(backupDir, seq, "00000000-0000-0000-0000-000000000001")
+		require.Nil(t, filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, strings.TrimPrefix(p, src))
+			if info.IsDir() {
+				return os.MkdirAll(target, 0700)
+			}
+			return os.Link(p, target)
+		}))
+	}
+	upload := func(seq string) (string, int64) {
+		link(seq)
+		var reused atomic.Int64
+		key, done, err := UploadBackupWithin(ctx, b, backupDir, "prefix", 0, UploadOptions{Incremental: true, Bucket: "mem://", Reused: &reused})
+		require.Nil(t, err)
+		require.True(t, done)
+		return key, reused.Load()
+	}
+
+	first, reused := upload("backup-1659034855438")
+	require.Zero(t, reused)
+	second, reused := upload("backup-1659035055438")
+	require.Positive(t, reused)
+	require.Nil(t, verifyArchive(ctx, b, second))
+	shared, err := listKeys(ctx, b, "prefix/objects/")
+	require.Nil(t, err)
+	require.Len(t, shared, 2, "the chunk files are not uploaded again")
+
+	// the archive is read like any other
+	r, err := archive.NewReader(ctx, b, second)
+	require.Nil(t, err)
+	g, err := gzip.NewReader(r)
+	require.Nil(t, err)
+	tr := tar.NewReader(g)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, h.Name)
+	}
+	require.Nil(t, r.Close())
+	require.Contains(t, names, "00000000-0000-0000-0000-000000000001/s00/value/01/0000000000000001.chunk")
+
+	// the objects of the newest archive of the member are kept although its folder expired
+	require.Nil(t, b.WriteAll(ctx, "prefix/objects/orphan", []byte("orphan"), nil))
+	folders := []string{path.Dir(first), path.Dir(second)}
+	referenced, err := referencedObjects(ctx, b, folders, map[string]bool{path.Dir(first): true, path.Dir(second): true}, time.UTC)
+	require.Nil(t, err)
+	res := &api.PruneResult{}
+	require.Nil(t, pruneObjects(ctx, b, "prefix", referenced, clock.Now(), time.Hour, bucket.DeleteOptions{}, res))
+	require.Zero(t, res.SharedObjects, "young objects are kept")
+	require.Nil(t, pruneObjects(ctx, b, "prefix", referenced, clock.Now().Add(2*time.Hour), time.Hour, bucket.DeleteOptions{}, res))
+	require.Equal(t, 1, res.SharedObjects)
+	shared, err = listKeys(ctx, b, "prefix/objects/")
+	require.Nil(t, err)
+	require.Len(t, shared, 2)
+}
+
+func TestCmdAllowList(t *testing.T) {
+	contains := func(nets []*net.IPNet, ip string) bool {
+		for _, n := range nets {
+			if n.Contains(net.ParseIP(ip)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// only the pod itself may call the mutating endpoints by default
+	nets, err := (&Cmd{PodIP: "10.244.1.7"}).allowList()
+	require.Nil(t, err)
+	require.True(t, contains(nets, "127.0.0.1"))
+	require.True(t, contains(nets, "10.244.1.7"))
+	require.False(t, contains(nets, "10.244.1.8"))
+	require.False(t, serverutil.AllowsAll(nets))
+
+	nets, err = (&Cmd{OperatorCIDR: "10.96.0.0/12"}).allowList()
+	require.Nil(t, err)
+	require.True(t, contains(nets, "10.100.0.5"))
+
+	nets, err = (&Cmd{AllowedCIDRs: "0.0.0.0/0,::/0"}).allowList()
+	require.Nil(t, err)
+	require.True(t, serverutil.AllowsAll(nets))
+
+	_, err = (&Cmd{PodIP: "pod"}).allowList()
+	require.Error(t, err)
+}
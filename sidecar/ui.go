@@ -0,0 +1,103 @@
+package sidecar
+
+import (
+	_ "embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/hazelcast/platform-operator-agent/api"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/serverutil"
+)
+
+//go:embed ui/index.html
+var uiPage []byte
+
+// uiHistory limits the number of tasks shown on the status page
+const uiHistory = 50
+
+type uiStorage struct {
+	Dir     string `json:"dir"`
+	Bytes   int64  `json:"bytes"`
+	Backups int    `json:"backups"`
+	Error   string `json:"error,omitempty"`
+}
+
+type uiState struct {
+	Tasks   []api.TaskInfo `json:"tasks"`
+	Storage uiStorage      `json:"storage"`
+	Backups []string       `json:"backups"`
+}
+
+func uiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		serverutil.HttpError(w, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+// uiStateHandler returns the tasks, the local backups and their storage usage for the status page
+func (s *Service) uiStateHandler(w http.ResponseWriter, _ *http.Request) {
+	state := uiState{Tasks: s.recentTasks()}
+
+	baseDir, memberID := s.BaseDir, 0
+	if len(state.Tasks) > 0 {
+		memberID = state.Tasks[0].MemberID
+		if baseDir == "" {
+			s.Mu.RLock()
+			if t, ok := s.Tasks[state.Tasks[0].ID]; ok {
+				baseDir = t.req.BackupBaseDir
+			}
+			s.Mu.RUnlock()
+		}
+	}
+	if baseDir != "" {
+		state.Storage = storageUsage(path.Join(baseDir, DirName))
+		backups, err := listBackups(baseDir, memberID)
+		if err != nil {
+			state.Storage.Error = err.Error()
+		}
+		state.Backups = backups
+		state.Storage.Backups = len(backups)
+	}
+
+	serverutil.HttpJSON(w, state)
+}
+
+// recentTasks returns the latest tasks, newest first
+func (s *Service) recentTasks() []api.TaskInfo {
+	tasks := s.taskInfos()
+	if len(tasks) > uiHistory {
+		tasks = tasks[:uiHistory]
+	}
+	// the status page is served over plain HTTP
+	for i := range tasks {
+		tasks[i].BucketURL = logger.Redact(tasks[i].BucketURL)
+		tasks[i].BackupKey = logger.Redact(tasks[i].BackupKey)
+	}
+	return tasks
+}
+
+// storageUsage sums the size of the files under dir
+func storageUsage(dir string) uiStorage {
+	u := uiStorage{Dir: dir}
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		u.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		u.Error = err.Error()
+	}
+	return u
+}
@@ -0,0 +1,166 @@
+package verify
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/google/subcommands"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/config"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/mancenter"
+	"github.com/hazelcast/platform-operator-agent/internal/notify"
+	"github.com/hazelcast/platform-operator-agent/internal/termination"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+var log = logger.New().Named("verify")
+
+type Cmd struct {
+	BucketURL     string        `envconfig:"VERIFY_BUCKET_URL"`
+	SecretName    string        `envconfig:"VERIFY_SECRET_NAME"`
+	Encryption    string        `envconfig:"VERIFY_ENCRYPTION_SECRET"`
+	Sample        int           `envconfig:"VERIFY_SAMPLE"`
+	ManifestsOnly bool          `envconfig:"VERIFY_MANIFESTS_ONLY"`
+	Interval      time.Duration `envconfig:"VERIFY_INTERVAL"`
+	MCURL         string        `envconfig:"VERIFY_MC_URL"`
+	MCToken       string        `envconfig:"VERIFY_MC_TOKEN"`
+	Dir           string        `envconfig:"VERIFY_DIR"`
+}
+
+func (*Cmd) Name() string     { return "verify" }
+func (*Cmd) Synopsis() string { return "verify the integrity of backups stored in a bucket" }
+func (*Cmd) Usage() string    { return "" }
+
+func (v *Cmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&v.BucketURL, "src", "", "src bucket path")
+	f.StringVar(&v.SecretName, "secret-name", "", "secret name for the bucket credentials")
+	f.StringVar(&v.Encryption, "encryption-secret", "", "secret name for the key of encrypted backups, without it only their manifests are checked")
+	f.IntVar(&v.Sample, "sample", 1, "number of randomly chosen backup archives to check, 0 checks all")
+	f.BoolVar(&v.ManifestsOnly, "manifests-only", false, "check manifests and indexes without downloading archives")
+	f.DurationVar(&v.Interval, "interval", 0, "time between verification runs, 0 runs once")
+	f.StringVar(&v.MCURL, "mc-url", "", "management center endpoint for corruption alerts")
+	f.StringVar(&v.MCToken, "mc-token", "", "management center endpoint token")
+	f.StringVar(&v.Dir, "dir", "", "restored destination to check against its file manifest instead of the bucket, e.g. /data/persistence/backup")
+}
+
+func (v *Cmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) (status subcommands.ExitStatus) {
+	log.Info("starting verify agent...")
+
+	start := time.Now()
+	var last verifySummary
+	defer func() { termination.Report(v.Name(), status, start, last) }()
+
+	// overwrite config with environment variables
+	if err := config.Process("verify", v, f); err != nil {
+		log.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if v.Dir != "" {
+		checked, corrupted, err := CheckDir(ctx, v.Dir)
+		if err != nil {
+			log.Error("verification failed: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		last = verifySummary{Checked: checked, Corrupted: len(corrupted)}
+		if len(corrupted) > 0 {
+			log.Error("restored files do not match the file manifest", zap.String("dir", v.Dir), zap.Strings("files", corrupted))
+			return subcommands.ExitFailure
+		}
+		log.Info("restored files verified", zap.String("dir", v.Dir), zap.Int("files", checked))
+		return subcommands.ExitSuccess
+	}
+
+	bucketURI, err := uri.NormalizeURI(v.BucketURL)
+	if err != nil {
+		return subcommands.ExitFailure
+	}
+	log.Info("bucket URI normalized successfully", zap.String("bucket URI", bucketURI))
+
+	log.Info("reading secret", zap.String("secret name", v.SecretName))
+	secretData, err := bucket.SecretData(ctx, v.SecretName)
+	if err != nil {
+		log.Error("error fetching secret data: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	b, err := bucket.OpenBucket(ctx, bucketURI, secretData)
+	if err != nil {
+		log.Error("could not open bucket: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	defer b.Close()
+
+	events := mancenter.New(v.MCURL, v.MCToken)
+	opts := Options{Sample: v.Sample, ManifestsOnly: v.ManifestsOnly}
+	if v.Encryption != "" {
+		log.Info("reading encryption key", zap.String("secret name", v.Encryption))
+		if opts.EncryptionKey, err = bucket.EncryptionKey(ctx, v.Encryption); err != nil {
+			log.Error("error reading encryption key: " + err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+	for {
+		results, err := Run(ctx, b, opts)
+		if err != nil {
+			log.Error("verification failed: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		corrupted := summarize(ctx, events, results)
+		last = verifySummary{Checked: len(results), Corrupted: corrupted}
+
+		// a single run fails on corruption so that the job shows up as failed
+		if v.Interval <= 0 {
+			if corrupted > 0 {
+				return subcommands.ExitFailure
+			}
+			return subcommands.ExitSuccess
+		}
+
+		select {
+		case <-ctx.Done():
+			return subcommands.ExitSuccess
+		case <-time.After(v.Interval):
+		}
+	}
+}
+
+// verifySummary is the detail of the termination message of the last verification
+type verifySummary struct {
+	Checked   int `json:"checked"`
+	Corrupted int `json:"corrupted"`
+}
+
+// summarize logs the results, reports corrupted archives to Management Center and returns their number
+func summarize(ctx context.Context, events *mancenter.Client, results []Result) int {
+	var corrupted int
+	var bytes int64
+	for _, r := range results {
+		bytes += r.Bytes
+		if r.Err == nil {
+			log.Info("backup archive verified", zap.String("key", r.Key), zap.Int64("bytes", r.Bytes))
+			continue
+		}
+
+		corrupted++
+		msg := logger.Redact(r.Err.Error())
+		log.Error("backup archive is corrupted: "+msg, zap.String("key", r.Key))
+		e := mancenter.Event{Type: mancenter.Verify, Phase: mancenter.Failed, Key: r.Key, Message: msg}
+		if err := events.Report(ctx, e); err != nil {
+			log.Warn("could not report event to management center: " + err.Error())
+		}
+		if err := notify.Send(ctx, e); err != nil {
+			log.Warn("could not send notification: " + err.Error())
+		}
+	}
+
+	log.Info("verification finished",
+		zap.Int("checked", len(results)),
+		zap.Int("corrupted", corrupted),
+		zap.Int64("bytes", bytes))
+	return corrupted
+}
@@ -0,0 +1,26 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+// ErrNoFileManifest is returned for a restored directory without the file manifest of its backup
+var ErrNoFileManifest = errors.New("no file manifest, the backup was taken without -file-manifest")
+
+// CheckDir compares the files of a restored destination with the file manifest that was restored
+// with them. It returns the number of files in the manifest and the paths of the corrupted ones.
+func CheckDir(ctx context.Context, dir string) (int, []string, error) {
+	files, err := archive.ReadFileManifest(filepath.Join(dir, archive.MetaDir, archive.FileManifestName))
+	if err != nil {
+		return 0, nil, err
+	}
+	if files == nil {
+		return 0, nil, ErrNoFileManifest
+	}
+	corrupted, err := archive.VerifyFiles(ctx, dir, files, 0)
+	return len(files), corrupted, err
+}
@@ -0,0 +1,255 @@
+package verify
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+)
+
+// Options of a verification run
+type Options struct {
+	// Sample is the number of randomly chosen archives to check, 0 checks all archives
+	Sample int
+	// ManifestsOnly checks manifests and indexes without downloading the archives
+	ManifestsOnly bool
+	// EncryptionKey decrypts encrypted archives, without it only their manifests are checked
+	EncryptionKey []byte
+}
+
+// ErrNoChecksum is the finding for an archive stored without a checksum, its content cannot be verified
+var ErrNoChecksum = errors.New("archive has no checksum")
+
+// Result is the outcome of checking a single archive
+type Result struct {
+	Key   string
+	Bytes int64
+	Err   error
+}
+
+// Run checks a sample of the archives stored in the bucket, a corrupted archive is reported
+// in its Result, the returned error means that the run itself failed
+func Run(ctx context.Context, bucket *blob.Bucket, opts Options) ([]Result, error) {
+	keys, err := archiveKeys(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Sample > 0 && opts.Sample < len(keys) {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		keys = keys[:opts.Sample]
+		sort.Strings(keys)
+	}
+
+	results := make([]Result, 0, len(keys))
+	for _, key := range keys {
+		r := Result{Key: key}
+		if opts.ManifestsOnly || (archive.Encrypted(key) && opts.EncryptionKey == nil) {
+			r.Err = checkManifest(ctx, bucket, key)
+		} else {
+			r.Bytes, r.Err = checkArchive(ctx, bucket, key, opts.EncryptionKey)
+		}
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func archiveKeys(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	iter := bucket.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := archive.Key(obj.Key)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// checkArchive reads the whole archive and compares its SHA-256 digest with the one of its checksum
+// or manifest, gzip and zstd also verify the checksums of every member and tar the header checksums.
+// Entries of v2 archives are compared with the index, encrypted archives are decrypted with the key.
+func checkArchive(ctx context.Context, bucket *blob.Bucket, key string, encryptionKey []byte) (int64, error) {
+	index, err := archive.ReadIndex(ctx, bucket, key)
+	if err != nil && !errors.Is(err, archive.ErrNoIndex) && !isNotFound(err) {
+		return 0, err
+	}
+	want, incremental, err := archiveDigest(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := archive.NewReader(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	h := sha256.New()
+	c := &countingReader{r: io.TeeReader(s, h)}
+	var r io.Reader = c
+	if archive.Encrypted(key) {
+		r = archive.NewDecryptReader(c, encryptionKey)
+	}
+	g, err := archive.Decompress(r, key)
+	if err != nil {
+		return c.n, err
+	}
+	defer g.Close()
+
+	var entries int
+	t := tar.NewReader(g)
+	for {
+		header, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return c.n, err
+		}
+		if _, err = io.Copy(io.Discard, t); err != nil {
+			return c.n, err
+		}
+		entries++
+
+		if index == nil {
+			continue
+		}
+		e, ok := index.Find(header.Name)
+		if !ok {
+			return c.n, fmt.Errorf("entry %s is missing from the index", header.Name)
+		}
+		if e.Size != header.Size {
+			return c.n, fmt.Errorf("entry %s has size %d, index says %d", header.Name, header.Size, e.Size)
+		}
+	}
+
+	if index != nil && entries != len(index.Entries) {
+		return c.n, fmt.Errorf("archive has %d entries, index says %d", entries, len(index.Entries))
+	}
+
+	// the digest covers the padding after the tar trailer as well
+	if _, err = io.Copy(io.Discard, c); err != nil {
+		return c.n, err
+	}
+	switch {
+	case want != nil:
+		return c.n, archive.VerifyChecksum(key, want, h.Sum(nil))
+	case incremental:
+		// the objects were compared with the digests of the manifest while reading them
+		return c.n, nil
+	default:
+		return c.n, ErrNoChecksum
+	}
+}
+
+// archiveDigest returns the SHA-256 digest of the archive from its checksum object, or from its archive
+// manifest. Incremental archives have none, the digests of their objects are in their parts manifest.
+func archiveDigest(ctx context.Context, bucket *blob.Bucket, key string) ([]byte, bool, error) {
+	want, err := archive.ReadChecksum(ctx, bucket, key)
+	if err != nil || want != nil {
+		return want, false, err
+	}
+
+	am, err := archive.ReadArchiveManifest(ctx, bucket, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if am != nil && am.SHA256 != "" {
+		want, err = hex.DecodeString(am.SHA256)
+		if err != nil || len(want) != sha256.Size {
+			return nil, false, fmt.Errorf("invalid digest in the manifest of %s", key)
+		}
+		return want, false, nil
+	}
+
+	m, err := archive.ReadManifest(ctx, bucket, key)
+	if isNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return nil, len(m.Objects) > 0, nil
+}
+
+// checkManifest checks that all parts listed in the manifest exist, or that the index
+// of a single object archive points inside the object
+func checkManifest(ctx context.Context, bucket *blob.Bucket, key string) error {
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		index, err := archive.ReadIndex(ctx, bucket, key)
+		if errors.Is(err, archive.ErrNoIndex) {
+			// legacy archives have nothing to check without downloading them
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range index.Entries {
+			if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > attrs.Size {
+				return fmt.Errorf("index entry %s is outside of the archive", e.Name)
+			}
+		}
+		return nil
+	}
+
+	m, err := archive.ReadManifest(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	for n, k := range m.Keys(key) {
+		ok, err := bucket.Exists(ctx, k)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("part %d of %d is missing", n, m.Parts)
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	return gcerrors.Code(err) == gcerrors.NotFound
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
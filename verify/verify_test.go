@@ -0,0 +1,201 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/archive"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+func writeArchive(t *testing.T, b *blob.Bucket, key string) []byte {
+	tmpdir, err := os.MkdirTemp("", "verify")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	require.Nil(t, fileutil.CreateFiles(tmpdir, []fileutil.File{
+		{Name: "cluster", IsDir: true},
+		{Name: "cluster/cluster-state.txt"},
+		{Name: "s00/value/01", IsDir: true},
+		{Name: "s00/value/01/0000000000000001.chunk"},
+	}, true))
+
+	var buf bytes.Buffer
+	require.Nil(t, archive.Create(&buf, tmpdir, "uuid"))
+	require.Nil(t, b.WriteAll(context.Background(), key, buf.Bytes(), nil))
+	writeChecksum(t, b, key, buf.Bytes())
+	return buf.Bytes()
+}
+
+// writeTar stores an uncompressed archive, it has no checksums of its own
+func writeTar(t *testing.T, b *blob.Bucket, key string) []byte {
+	tmpdir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(tmpdir, "cluster-state.txt"), []byte("ACTIVE"), 0600))
+
+	var buf bytes.Buffer
+	_, err := archive.CreatePart(&buf, archive.Codec{Compression: archive.None}, tmpdir, "uuid", nil, &archive.Progress{}, func() bool { return false })
+	require.Nil(t, err)
+	require.Nil(t, b.WriteAll(context.Background(), key, buf.Bytes(), nil))
+	writeChecksum(t, b, key, buf.Bytes())
+	return buf.Bytes()
+}
+
+func writeChecksum(t *testing.T, b *blob.Bucket, key string, data []byte) {
+	sum := sha256.Sum256(data)
+	require.Nil(t, archive.WriteChecksum(context.Background(), b, key, sum[:], nil))
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(t *testing.T, b *blob.Bucket)
+		opts          Options
+		wantChecked   int
+		wantCorrupted int
+	}{
+		{
+			"valid archives",
+			func(t *testing.T, b *blob.Bucket) {
+				writeArchive(t, b, "2022-01-01-00-00-00/a.tar.gz")
+				writeArchive(t, b, "2022-01-01-00-00-00/b.tar.gz")
+			},
+			Options{}, 2, 0,
+		},
+		{
+			"bit rot",
+			func(t *testing.T, b *blob.Bucket) {
+				data := writeArchive(t, b, "a.tar.gz")
+				// flip a bit in the compressed data of the first member
+				data[12] ^= 0x01
+				require.Nil(t, b.WriteAll(context.Background(), "a.tar.gz", data, nil))
+			},
+			Options{}, 1, 1,
+		},
+		{
+			"sample",
+			func(t *testing.T, b *blob.Bucket) {
+				writeArchive(t, b, "a.tar.gz")
+				writeArchive(t, b, "b.tar.gz")
+				writeArchive(t, b, "c.tar.gz")
+			},
+			Options{Sample: 2}, 2, 0,
+		},
+		{
+			"archive in parts",
+			func(t *testing.T, b *blob.Bucket) {
+				data := writeArchive(t, b, archive.PartKey("a.tar.gz", 0))
+				require.Nil(t, b.Delete(context.Background(), archive.PartKey("a.tar.gz", 0)))
+				half := len(data) / 2
+				ctx := context.Background()
+				require.Nil(t, b.WriteAll(ctx, archive.PartKey("a.tar.gz", 0), data[:half], nil))
+				require.Nil(t, b.WriteAll(ctx, archive.PartKey("a.tar.gz", 1), data[half:], nil))
+				require.Nil(t, archive.WriteManifest(ctx, b, "a.tar.gz", 2, nil))
+				writeChecksum(t, b, "a.tar.gz", data)
+			},
+			Options{}, 1, 0,
+		},
+		{
+			"modified uncompressed archive",
+			func(t *testing.T, b *blob.Bucket) {
+				data := writeTar(t, b, "a.tar")
+				require.Nil(t, b.WriteAll(context.Background(), "a.tar", bytes.Replace(data, []byte("ACTIVE"), []byte("PASSIV"), 1), nil))
+			},
+			Options{}, 1, 1,
+		},
+		{
+			"missing checksum",
+			func(t *testing.T, b *blob.Bucket) {
+				writeArchive(t, b, "a.tar.gz")
+				require.Nil(t, b.Delete(context.Background(), archive.ChecksumKey("a.tar.gz")))
+			},
+			Options{}, 1, 1,
+		},
+		{
+			"digest in archive manifest",
+			func(t *testing.T, b *blob.Bucket) {
+				ctx := context.Background()
+				data := writeTar(t, b, "a.tar")
+				require.Nil(t, b.Delete(ctx, archive.ChecksumKey("a.tar")))
+				sum := sha256.Sum256(data)
+				require.Nil(t, archive.WriteArchiveManifest(ctx, b, "a.tar", &archive.ArchiveManifest{Archive: "a.tar", SHA256: hex.EncodeToString(sum[:])}, nil))
+			},
+			Options{}, 1, 0,
+		},
+		{
+			"manifest with missing part",
+			func(t *testing.T, b *blob.Bucket) {
+				writeArchive(t, b, archive.PartKey("a.tar.gz", 0))
+				require.Nil(t, archive.WriteManifest(context.Background(), b, "a.tar.gz", 2, nil))
+			},
+			Options{ManifestsOnly: true}, 1, 1,
+		},
+		{
+			"manifests only",
+			func(t *testing.T, b *blob.Bucket) {
+				writeArchive(t, b, "a.tar.gz")
+			},
+			Options{ManifestsOnly: true}, 1, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := memblob.OpenBucket(nil)
+			defer b.Close()
+			tt.setup(t, b)
+
+			results, err := Run(context.Background(), b, tt.opts)
+			require.Nil(t, err)
+			require.Len(t, results, tt.wantChecked)
+
+			var corrupted int
+			for _, r := range results {
+				if r.Err != nil {
+					corrupted++
+				}
+			}
+			require.Equal(t, tt.wantCorrupted, corrupted)
+		})
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "verify_dir")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	_, _, err = CheckDir(context.Background(), tmpdir)
+	require.ErrorIs(t, err, ErrNoFileManifest)
+
+	require.Nil(t, fileutil.CreateFiles(filepath.Join(tmpdir, "uuid"), []fileutil.File{
+		{Name: "cluster", IsDir: true},
+		{Name: "cluster/cluster-state.txt"},
+		{Name: "s00/value/01", IsDir: true},
+		{Name: "s00/value/01/0000000000000001.chunk"},
+	}, true))
+	files, _, err := archive.HashFiles(context.Background(), tmpdir, 0, nil)
+	require.Nil(t, err)
+	data, err := json.Marshal(files)
+	require.Nil(t, err)
+	require.Nil(t, os.Mkdir(filepath.Join(tmpdir, archive.MetaDir), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(tmpdir, archive.MetaDir, archive.FileManifestName), data, 0600))
+
+	checked, corrupted, err := CheckDir(context.Background(), tmpdir)
+	require.Nil(t, err)
+	require.Equal(t, 2, checked)
+	require.Empty(t, corrupted)
+
+	require.Nil(t, os.WriteFile(filepath.Join(tmpdir, "uuid", "cluster", "cluster-state.txt"), []byte("ACTIVE"), 0600))
+	_, corrupted, err = CheckDir(context.Background(), tmpdir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"uuid/cluster/cluster-state.txt"}, corrupted)
+}